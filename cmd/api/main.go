@@ -2,12 +2,14 @@ package main
 
 import (
 	"errors"
+	"log"
 	"log/slog"
 	"net/http"
 	"os"
 
 	"pm4devs.strawhats/internal/app"
 	"pm4devs.strawhats/internal/config"
+	"pm4devs.strawhats/internal/jobs"
 	"pm4devs.strawhats/internal/mailer"
 	"pm4devs.strawhats/internal/models"
 	"pm4devs.strawhats/internal/rest"
@@ -18,6 +20,10 @@ func main() {
 	config := config.New()
 	database := OpenDatabase(config.DB.DSN)
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	envelope, err := config.Keys.Open()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
 
 	// Log if successful connection
 	logger.Info("database connection pool established")
@@ -28,10 +34,13 @@ func main() {
 		config,
 		logger,
 		mailer.New(config, logger),
-		models.New(database),
+		models.New(database, envelope, config.SecretKey()),
 		rest.New(logger),
 	)
 
+	// Schedule recurring background jobs
+	jobs.New(app).Start()
+
 	if err := serve(app); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		app.Logger.Error(err.Error())
 		os.Exit(1)
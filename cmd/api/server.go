@@ -54,7 +54,13 @@ func serve(app *app.App) error {
 
 		// Log a message to say we're waiting for any background tasks
 		app.Logger.Info("completing background tasks", "addr", srv.Addr)
+		app.BG.Stop()
 		app.BG.Wait()
+
+		// Save the uses of sessions since the job last ran
+		if _, err := app.Models.Tokens.SaveUses(); err != nil {
+			app.Logger.Error(err.Error())
+		}
 		shutdownError <- nil
 	}()
 
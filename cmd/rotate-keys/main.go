@@ -0,0 +1,103 @@
+// rotate-keys wraps the data keys of every row encrypted at rest with the
+// current master key
+//
+// Rotate the keyfile by passing -generate, which appends a new key to it
+// first. Rotate the KMS by passing the ID of the new master key. Secrets
+// stored before envelope encryption are encrypted at rest along the way.
+// Previous master keys must stay available until the command completes.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"log"
+	"log/slog"
+	"os"
+	"time"
+
+	_ "github.com/lib/pq"
+	"pm4devs.strawhats/internal/config"
+	"pm4devs.strawhats/internal/envelope"
+	"pm4devs.strawhats/internal/models/secrets"
+)
+
+func main() {
+	var (
+		dsn       string
+		keys      config.Keys
+		generate  bool
+		batchSize int
+	)
+	flag.StringVar(&dsn, "db-dsn", "", "Postgres DSN")
+	keys.Flags(flag.CommandLine)
+	flag.BoolVar(&generate, "generate", false, "Append a new master key to the keyfile before rotating")
+	flag.IntVar(&batchSize, "batch-size", 100, "Number of rows of each table re-wrapped per transaction")
+	flag.Parse()
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	if dsn == "" {
+		log.Fatalln("Missing db-dsn flag")
+	}
+	if batchSize <= 0 {
+		log.Fatalln("The batch-size flag must be positive")
+	}
+
+	// Append a new master key, it becomes the current one
+	if generate {
+		if keys.Provider != envelope.ProviderKeyfile {
+			log.Fatalln("The generate flag requires the keyfile provider")
+		}
+		keyID, err := envelope.AppendKey(keys.Keyfile)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		logger.Info("master key generated", "key_id", keyID, "keyfile", keys.Keyfile)
+	}
+
+	envelope, err := keys.Open()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	database := openDatabase(dsn)
+	defer database.Close()
+
+	repository := secrets.Repository(database, envelope)
+	logger.Info("re-wrapping data keys", "key_id", envelope.CurrentKeyID())
+
+	var total int64
+	for {
+		count, err := repository.RewrapKeys(batchSize)
+		if err != nil {
+			logger.Error(err.Error(), "rewrapped", total)
+			os.Exit(1)
+		}
+		if count == 0 {
+			break
+		}
+		total += count
+		logger.Info("data keys re-wrapped", "rewrapped", total)
+	}
+
+	logger.Info("rotation complete", "key_id", envelope.CurrentKeyID(), "rewrapped", total)
+}
+
+// Opens a connection to the database using the provided DSN
+func openDatabase(dsn string) *sql.DB {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err = db.PingContext(ctx); err != nil {
+		db.Close()
+		log.Fatal(err.Error())
+	}
+
+	return db
+}
@@ -10,10 +10,10 @@ require (
 require (
 	github.com/brianvoe/gofakeit/v7 v7.0.4
 	github.com/go-mail/mail/v2 v2.3.0
+	github.com/treblle/treblle-go v0.7.2
 )
 
 require (
-	github.com/treblle/treblle-go v0.7.2 // indirect
 	gopkg.in/alexcesaro/quotedprintable.v3 v3.0.0-20150716171945-2caba252f4dc // indirect
 	gopkg.in/mail.v2 v2.3.1 // indirect
 )
@@ -3,6 +3,7 @@ package app
 import (
 	"fmt"
 	"sync"
+	"time"
 
 	"pm4devs.strawhats/internal/xerrors"
 	"pm4devs.strawhats/internal/xlogger"
@@ -15,6 +16,8 @@ import (
 // Defines a type that can run background tasks
 type Backgrounder interface {
 	Run(fn func())
+	Every(interval time.Duration, fn func())
+	Stop()
 	Wait()
 }
 
@@ -24,13 +27,15 @@ type Backgrounder interface {
 
 // Concrete implementation that runs background tasks with a wait group
 type Background struct {
-	logger xlogger.Logger
-	wg     sync.WaitGroup
+	logger   xlogger.Logger
+	wg       sync.WaitGroup
+	stop     chan struct{}
+	stopOnce sync.Once
 }
 
 // Creates a new Background instance
 func NewBackground(logger xlogger.Logger) *Background {
-	return &Background{logger: logger}
+	return &Background{logger: logger, stop: make(chan struct{})}
 }
 
 // ============================================================================
@@ -58,6 +63,35 @@ func (bg *Background) Run(fn func()) {
 	}()
 }
 
+// Runs a background task on every tick of the interval until Stop is called
+func (bg *Background) Every(interval time.Duration, fn func()) {
+	bg.wg.Add(1)
+
+	go func() {
+		defer bg.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-bg.stop:
+				return
+
+			case <-ticker.C:
+				bg.Run(fn)
+			}
+		}
+	}()
+}
+
+// Stops scheduling recurring tasks. Call Wait to wait for running tasks.
+func (bg *Background) Stop() {
+	bg.stopOnce.Do(func() {
+		close(bg.stop)
+	})
+}
+
 // Waits for background tasks
 func (bg *Background) Wait() {
 	bg.wg.Wait()
@@ -1,16 +1,25 @@
 package config
 
 import (
+	"crypto/rand"
+	"encoding/base64"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"strings"
+	"time"
+
+	"pm4devs.strawhats/internal/envelope"
 )
 
 // ============================================================================
 // Constants
 // ============================================================================
 
+// Bytes of the server secret
+const minSecretBytes = 32
+
 const (
 	EnvLocal = "local"
 	EnvDev   = "dev"
@@ -39,6 +48,48 @@ type Config struct {
 		Password string
 		Sender   string
 	}
+	Trash struct {
+		Retention     time.Duration
+		PurgeInterval time.Duration
+	}
+	Shares struct {
+		SweepInterval time.Duration
+	}
+	Emergency struct {
+		GrantInterval time.Duration
+	}
+	Tokens struct {
+		AccessTTL   time.Duration
+		RefreshTTL  time.Duration
+		UseInterval time.Duration
+	}
+	WebAuthn struct {
+		RPID    string
+		RPName  string
+		Origins []string
+	}
+	OIDC struct {
+		Issuer       string
+		ClientID     string
+		ClientSecret string
+		RedirectURL  string
+		Scopes       []string
+		GroupsClaim  string
+	}
+	Device struct {
+		VerificationURL string
+	}
+	PasswordLogin bool
+	Secret        string
+	Keys          Keys
+}
+
+// Defines the master keys secrets are encrypted with at rest
+type Keys struct {
+	Provider   string
+	Keyfile    string
+	KMSRootKey string
+	KMSKeyID   string
 }
 
 // Create validated config
@@ -61,6 +112,60 @@ func New() Config {
 	flag.StringVar(&cfg.SMTP.Password, "smtp-password", "", "SMTP password")
 	flag.StringVar(&cfg.SMTP.Sender, "smtp-sender", "", "SMTP sender")
 
+	// Trash
+	flag.DurationVar(&cfg.Trash.Retention, "trash-retention", 30*24*time.Hour, "How long deleted items are kept before being purged")
+	flag.DurationVar(&cfg.Trash.PurgeInterval, "trash-purge-interval", time.Hour, "How often expired items are purged from the trash")
+
+	// Shares
+	flag.DurationVar(&cfg.Shares.SweepInterval, "share-sweep-interval", 10*time.Minute, "How often expired shares and links are removed")
+
+	// Emergency access
+	flag.DurationVar(&cfg.Emergency.GrantInterval, "emergency-grant-interval", 10*time.Minute, "How often emergency access is granted to contacts whose waiting period ended")
+
+	// Tokens
+	flag.DurationVar(&cfg.Tokens.AccessTTL, "access-token-ttl", 5*time.Minute, "How long access tokens are valid for, even once their session is revoked")
+	flag.DurationVar(&cfg.Tokens.RefreshTTL, "refresh-token-ttl", 30*24*time.Hour, "How long refresh tokens are valid for, each refresh hands out a new one")
+	flag.DurationVar(&cfg.Tokens.UseInterval, "session-use-interval", time.Minute, "How often the last uses of sessions are saved")
+
+	// WebAuthn
+	flag.StringVar(&cfg.WebAuthn.RPID, "webauthn-rp-id", "localhost", "Domain passkeys and security keys are scoped to")
+	flag.StringVar(&cfg.WebAuthn.RPName, "webauthn-rp-name", "pm4devs", "Name of the relying party shown by authenticators")
+	flag.Func("webauthn-origins", "Comma-separated origins WebAuthn ceremonies run on (default http://localhost:<port>)", func(value string) error {
+		for _, origin := range strings.Split(value, ",") {
+			if origin = strings.TrimSpace(origin); origin != "" {
+				cfg.WebAuthn.Origins = append(cfg.WebAuthn.Origins, origin)
+			}
+		}
+		return nil
+	})
+
+	// Single sign-on
+	flag.StringVar(&cfg.OIDC.Issuer, "oidc-issuer", "", "Issuer URL of the OpenID Connect provider users sign in with, disabled if empty")
+	flag.StringVar(&cfg.OIDC.ClientID, "oidc-client-id", "", "Client ID registered with the OpenID Connect provider")
+	flag.StringVar(&cfg.OIDC.ClientSecret, "oidc-client-secret", "", "Client secret registered with the OpenID Connect provider, empty for a public client")
+	flag.StringVar(&cfg.OIDC.RedirectURL, "oidc-redirect-url", "", "Where the OpenID Connect provider sends users back with a code")
+	cfg.OIDC.Scopes = []string{"openid", "email", "profile"}
+	flag.Func("oidc-scopes", "Comma-separated scopes requested from the OpenID Connect provider (default openid,email,profile)", func(value string) error {
+		cfg.OIDC.Scopes = nil
+		for _, scope := range strings.Split(value, ",") {
+			if scope = strings.TrimSpace(scope); scope != "" {
+				cfg.OIDC.Scopes = append(cfg.OIDC.Scopes, scope)
+			}
+		}
+		return nil
+	})
+	flag.StringVar(&cfg.OIDC.GroupsClaim, "oidc-groups-claim", "groups", "ID token claim listing the groups of a user, mapped onto groups of the same name, ignored if empty")
+	flag.BoolVar(&cfg.PasswordLogin, "password-login", true, "Whether users can register and log in with a password, disable to require single sign-on")
+
+	// Device authorization
+	flag.StringVar(&cfg.Device.VerificationURL, "device-verification-url", "", "Page users approve the login of a terminal on (default http://localhost:<port>/v1/auth/device)")
+
+	// Server secret
+	flag.StringVar(&cfg.Secret, "secret", "", "Base64 encoded secret of at least 32 bytes access tokens are signed with and the login parameters of unknown emails are derived from (random at each start if empty in local)")
+
+	// Keys
+	cfg.Keys.Flags(flag.CommandLine)
+
 	// Version
 	displayVersion := flag.Bool("version", false, "Display version and exit")
 
@@ -71,6 +176,20 @@ func New() Config {
 
 	flag.Parse()
 
+	if len(cfg.WebAuthn.Origins) == 0 {
+		cfg.WebAuthn.Origins = []string{fmt.Sprintf("http://localhost:%d", cfg.Port)}
+	}
+	if cfg.Device.VerificationURL == "" {
+		cfg.Device.VerificationURL = fmt.Sprintf("http://localhost:%d/v1/auth/device", cfg.Port)
+	}
+	if cfg.Secret == "" && cfg.IsLocal() {
+		secret := make([]byte, minSecretBytes)
+		if _, err := rand.Read(secret); err != nil {
+			log.Fatalln(err)
+		}
+		cfg.Secret = base64.StdEncoding.EncodeToString(secret)
+	}
+
 	if *displayVersion {
 		fmt.Printf("Version:\t%s\n", version())
 		os.Exit(0)
@@ -84,6 +203,17 @@ func New() Config {
 	return *cfg
 }
 
+// Returns true if users can sign in with an OpenID Connect provider
+func (config *Config) SSOEnabled() bool {
+	return config.OIDC.Issuer != ""
+}
+
+// Returns the decoded server secret
+func (config *Config) SecretKey() []byte {
+	secret, _ := base64.StdEncoding.DecodeString(config.Secret)
+	return secret
+}
+
 // Returns true if the local environment is used
 func (config *Config) IsLocal() bool {
 	return config.Env == EnvLocal
@@ -115,6 +245,58 @@ func (config *Config) validate() (bool, string) {
 		}
 	}
 
+	// Validate durations
+	switch {
+	case config.Trash.Retention <= 0:
+		return false, "The trash-retention flag must be positive"
+
+	case config.Trash.PurgeInterval <= 0:
+		return false, "The trash-purge-interval flag must be positive"
+
+	case config.Shares.SweepInterval <= 0:
+		return false, "The share-sweep-interval flag must be positive"
+
+	case config.Emergency.GrantInterval <= 0:
+		return false, "The emergency-grant-interval flag must be positive"
+
+	case config.Tokens.AccessTTL <= 0:
+		return false, "The access-token-ttl flag must be positive"
+
+	case config.Tokens.RefreshTTL <= config.Tokens.AccessTTL:
+		return false, "The refresh-token-ttl flag must be longer than access-token-ttl"
+
+	case config.Tokens.UseInterval <= 0:
+		return false, "The session-use-interval flag must be positive"
+	}
+
+	// Validate WebAuthn
+	if config.WebAuthn.RPID == "" {
+		return false, "Missing webauthn-rp-id flag"
+	}
+
+	// Validate single sign-on
+	if config.OIDC.Issuer != "" {
+		switch "" {
+		case config.OIDC.ClientID:
+			return false, "Missing oidc-client-id flag"
+
+		case config.OIDC.RedirectURL:
+			return false, "Missing oidc-redirect-url flag"
+		}
+	} else if !config.PasswordLogin {
+		return false, "The password-login flag can only be disabled along with the oidc-issuer flag"
+	}
+
+	// Validate secret
+	if secret, err := base64.StdEncoding.DecodeString(config.Secret); err != nil || len(secret) < minSecretBytes {
+		return false, "The secret flag must be at least 32 bytes, base64 encoded"
+	}
+
+	// Validate keys
+	if ok, err := config.Keys.validate(); !ok {
+		return false, err
+	}
+
 	// Validate strings
 	if !config.IsLocal() {
 		switch "" {
@@ -137,3 +319,48 @@ func (config *Config) validate() (bool, string) {
 
 	return true, ""
 }
+
+// ============================================================================
+// Keys
+// ============================================================================
+
+// Registers the key flags, shared with the commands reading secrets
+func (keys *Keys) Flags(flags *flag.FlagSet) {
+	flags.StringVar(&keys.Provider, "key-provider", envelope.ProviderKeyfile, "Provider of the master keys secrets are encrypted with at rest (keyfile | kms)")
+	flags.StringVar(&keys.Keyfile, "keyfile", "", "Path of the keyfile, the last key is the current one")
+	flags.StringVar(&keys.KMSRootKey, "kms-root-key", "", "Base64 encoded root key of the KMS")
+	flags.StringVar(&keys.KMSKeyID, "kms-key-id", "", "ID of the current KMS master key")
+}
+
+// Creates the envelope secrets are encrypted with at rest
+func (keys Keys) Open() (*envelope.Envelope, error) {
+	provider, err := envelope.NewProvider(keys.Provider, keys.Keyfile, keys.KMSRootKey, keys.KMSKeyID)
+	if err != nil {
+		return nil, err
+	}
+	return envelope.New(provider), nil
+}
+
+// Validate key flags and return ok or error
+func (keys *Keys) validate() (bool, string) {
+	switch keys.Provider {
+	case envelope.ProviderKeyfile:
+		if keys.Keyfile == "" {
+			return false, "Missing keyfile flag"
+		}
+
+	case envelope.ProviderKMS:
+		switch "" {
+		case keys.KMSRootKey:
+			return false, "Missing kms-root-key flag"
+
+		case keys.KMSKeyID:
+			return false, "Missing kms-key-id flag"
+		}
+
+	default:
+		return false, fmt.Sprintf("Invalid key-provider flag (%s | %s)", envelope.ProviderKeyfile, envelope.ProviderKMS)
+	}
+
+	return true, ""
+}
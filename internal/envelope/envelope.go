@@ -0,0 +1,284 @@
+// envelope encrypts data at rest with a data key per record
+//
+// Each record is encrypted with its own random data key. The data key is
+// stored next to the record, wrapped by a master key held by a KeyProvider,
+// so a database dump alone reveals nothing. Rotating the master key only
+// re-wraps the data keys, the records themselves are left as they are.
+//
+// Fields are bound to the table, column and ID of their record, so they can't
+// be moved to another column or record in the database.
+package envelope
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ============================================================================
+// Constants
+// ============================================================================
+
+const (
+	ProviderKeyfile = "keyfile"
+	ProviderKMS     = "kms"
+)
+
+// Size of data keys and master keys, for AES-256
+const KeySize = 32
+
+// Prefixed to data keys before they are wrapped, telling the keys of fields
+// bound to their record apart from those sealed before
+const boundKey byte = 1
+
+var (
+	ErrUnknownKey  = errors.New("unknown master key")
+	ErrDecryption  = errors.New("decryption failed")
+	ErrInvalidKeys = errors.New("invalid master keys")
+	ErrUnbound     = errors.New("fields not bound to their record")
+)
+
+// ============================================================================
+// KeyProvider
+// ============================================================================
+
+// Holds the master keys data keys are wrapped with
+type KeyProvider interface {
+	// Returns the ID of the master key new data keys are wrapped with
+	CurrentKeyID() string
+	// Wraps a data key with the given master key
+	Wrap(keyID string, dataKey []byte) ([]byte, error)
+	// Unwraps a data key wrapped with the given master key
+	Unwrap(keyID string, wrapped []byte) ([]byte, error)
+}
+
+// Creates the provider of the given name
+//
+// The keyfile provider reads its keys from keyfile. The KMS provider is a
+// stand-in for a managed KMS, deriving its keys from rootKey, with keyID as
+// the current key.
+func NewProvider(name, keyfile, rootKey, keyID string) (KeyProvider, error) {
+	switch name {
+	case ProviderKeyfile:
+		return NewKeyfile(keyfile)
+
+	case ProviderKMS:
+		return NewStandInKMS(rootKey, keyID)
+
+	default:
+		return nil, fmt.Errorf("unknown key provider %q, must be %s or %s", name, ProviderKeyfile, ProviderKMS)
+	}
+}
+
+// ============================================================================
+// Envelope
+// ============================================================================
+
+// A data key wrapped by a master key, as stored next to a record. Records
+// stored before envelope encryption have neither.
+type Key struct {
+	Wrapped     []byte
+	MasterKeyID *string
+}
+
+// Where the encrypted fields of a record are stored
+type Record struct {
+	Table   string   // Table the record is stored in
+	ID      string   // Values identifying the record
+	Columns []string // Column of each field, in order
+}
+
+// Returns where the fields of a record are stored, in the given columns of
+// the table and identified by the given values
+func Bind(table string, columns []string, ids ...any) Record {
+	values := make([]string, len(ids))
+	for i, id := range ids {
+		values[i] = fmt.Sprint(id)
+	}
+	return Record{Table: table, ID: strings.Join(values, "/"), Columns: columns}
+}
+
+// Returns the additional data of a field, its table, column and record
+func (r Record) aad(field int) ([]byte, error) {
+	if field >= len(r.Columns) {
+		return nil, fmt.Errorf("envelope: %s has no column for field %d", r.Table, field)
+	}
+	return []byte(r.Table + "." + r.Columns[field] + ":" + r.ID), nil
+}
+
+// Encrypts and decrypts records with data keys wrapped by a KeyProvider
+type Envelope struct {
+	provider KeyProvider
+}
+
+func New(provider KeyProvider) *Envelope {
+	return &Envelope{provider: provider}
+}
+
+// Returns the ID of the master key new data keys are wrapped with
+func (e *Envelope) CurrentKeyID() string {
+	return e.provider.CurrentKeyID()
+}
+
+// Encrypts the fields of a record with a new data key
+//
+// Returns the wrapped data key and the encrypted fields, in order.
+func (e *Envelope) Seal(record Record, fields ...[]byte) (Key, [][]byte, error) {
+	dataKey := make([]byte, KeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return Key{}, nil, err
+	}
+
+	sealed := make([][]byte, len(fields))
+	for i, field := range fields {
+		aad, err := record.aad(i)
+		if err != nil {
+			return Key{}, nil, err
+		}
+		if sealed[i], err = seal(dataKey, field, aad); err != nil {
+			return Key{}, nil, err
+		}
+	}
+
+	key, err := e.wrap(dataKey)
+	if err != nil {
+		return Key{}, nil, err
+	}
+
+	return key, sealed, nil
+}
+
+// Decrypts the fields of a record in place
+//
+// Fields of records stored before envelope encryption are left as they are,
+// those sealed before fields were bound to their record are opened without.
+func (e *Envelope) Open(key Key, record Record, fields ...*[]byte) error {
+	if key.Wrapped == nil || key.MasterKeyID == nil {
+		return nil
+	}
+
+	dataKey, bound, err := e.unwrap(key)
+	if err != nil {
+		return err
+	}
+
+	for i, field := range fields {
+		var aad []byte
+		if bound {
+			if aad, err = record.aad(i); err != nil {
+				return err
+			}
+		}
+		opened, err := open(dataKey, *field, aad)
+		if err != nil {
+			return err
+		}
+		*field = opened
+	}
+
+	return nil
+}
+
+// Wraps a data key again with the current master key
+//
+// Returns ErrUnbound for the keys of fields sealed before they were bound to
+// their record, which are sealed again instead.
+func (e *Envelope) Rewrap(key Key) (Key, error) {
+	if key.Wrapped == nil || key.MasterKeyID == nil {
+		return Key{}, fmt.Errorf("%w: the record has no data key", ErrUnknownKey)
+	}
+
+	dataKey, bound, err := e.unwrap(key)
+	if err != nil {
+		return Key{}, err
+	}
+	if !bound {
+		return Key{}, ErrUnbound
+	}
+
+	return e.wrap(dataKey)
+}
+
+// ============================================================================
+// Helpers
+// ============================================================================
+
+// Wraps a data key with the current master key, marked as bound
+func (e *Envelope) wrap(dataKey []byte) (Key, error) {
+	keyID := e.provider.CurrentKeyID()
+	wrapped, err := e.provider.Wrap(keyID, append([]byte{boundKey}, dataKey...))
+	if err != nil {
+		return Key{}, err
+	}
+
+	return Key{Wrapped: wrapped, MasterKeyID: &keyID}, nil
+}
+
+// Unwraps a data key, returning whether its fields are bound to their record
+func (e *Envelope) unwrap(key Key) ([]byte, bool, error) {
+	dataKey, err := e.provider.Unwrap(*key.MasterKeyID, key.Wrapped)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if len(dataKey) == KeySize+1 && dataKey[0] == boundKey {
+		return dataKey[1:], true, nil
+	}
+	return dataKey, false, nil
+}
+
+// Encrypts plaintext with AES-256-GCM, prefixing the random nonce
+func seal(key, plaintext, additionalData []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// Decrypts the output of seal
+func open(key, ciphertext, additionalData []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, ErrDecryption
+	}
+
+	nonce, ciphertext := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		return nil, ErrDecryption
+	}
+
+	// Keep empty fields distinct from NULL
+	if plaintext == nil {
+		plaintext = []byte{}
+	}
+	return plaintext, nil
+}
+
+// Creates an AES-256-GCM cipher
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("%w: keys must be %d bytes", ErrInvalidKeys, KeySize)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,184 @@
+package envelope
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"pm4devs.strawhats/internal/assert"
+)
+
+// Base64 encoded root key of the stand-in KMS used in tests
+var testRootKey = base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", KeySize)))
+
+// Record the fields sealed in tests belong to
+var testRecord = Bind("secrets", []string{"encrypted_data", "iv"}, 1)
+
+func TestSealAndOpen(t *testing.T) {
+	provider, err := NewStandInKMS(testRootKey, "v1")
+	assert.Is(t, err, nil)
+	e := New(provider)
+
+	key, sealed, err := e.Seal(testRecord, []byte("ciphertext"), []byte("iv"))
+	assert.Is(t, err, nil)
+	assert.Equal(t, *key.MasterKeyID, "v1")
+	assert.Equal(t, len(sealed), 2)
+	assert.False(t, strings.Contains(string(sealed[0]), "ciphertext"))
+
+	data, iv := sealed[0], sealed[1]
+	assert.Is(t, e.Open(key, testRecord, &data, &iv), nil)
+	assert.Equal(t, string(data), "ciphertext")
+	assert.Equal(t, string(iv), "iv")
+
+	t.Run("Legacy", func(t *testing.T) {
+		data := []byte("ciphertext")
+		assert.Is(t, e.Open(Key{}, testRecord, &data), nil)
+		assert.Equal(t, string(data), "ciphertext")
+	})
+
+	t.Run("Tampered", func(t *testing.T) {
+		data := append([]byte{}, sealed[0]...)
+		data[len(data)-1] ^= 1
+		assert.Is(t, e.Open(key, testRecord, &data), ErrDecryption)
+	})
+
+	t.Run("OtherRootKey", func(t *testing.T) {
+		other, err := NewStandInKMS(base64.StdEncoding.EncodeToString(make([]byte, KeySize)), "v1")
+		assert.Is(t, err, nil)
+		data := sealed[0]
+		assert.Is(t, New(other).Open(key, testRecord, &data), ErrDecryption)
+	})
+
+	// Fields can't be moved to another record or column
+	t.Run("OtherRecord", func(t *testing.T) {
+		data := sealed[0]
+		other := Bind("secrets", []string{"encrypted_data", "iv"}, 2)
+		assert.Is(t, e.Open(key, other, &data), ErrDecryption)
+	})
+
+	t.Run("OtherColumn", func(t *testing.T) {
+		data, iv := sealed[0], sealed[1]
+		assert.Is(t, e.Open(key, testRecord, &iv, &data), ErrDecryption)
+	})
+
+	// Fields sealed before they were bound to their record still open
+	t.Run("Unbound", func(t *testing.T) {
+		key, data := unboundKey(t, provider, "ciphertext")
+		assert.Is(t, e.Open(key, testRecord, &data), nil)
+		assert.Equal(t, string(data), "ciphertext")
+	})
+}
+
+func TestRewrap(t *testing.T) {
+	previous, err := NewStandInKMS(testRootKey, "v1")
+	assert.Is(t, err, nil)
+	key, sealed, err := New(previous).Seal(testRecord, []byte("ciphertext"))
+	assert.Is(t, err, nil)
+
+	current, err := NewStandInKMS(testRootKey, "v2")
+	assert.Is(t, err, nil)
+	e := New(current)
+
+	rewrapped, err := e.Rewrap(key)
+	assert.Is(t, err, nil)
+	assert.Equal(t, *rewrapped.MasterKeyID, "v2")
+
+	// The record itself is left as it is
+	data := sealed[0]
+	assert.Is(t, e.Open(rewrapped, testRecord, &data), nil)
+	assert.Equal(t, string(data), "ciphertext")
+
+	_, err = e.Rewrap(Key{})
+	assert.Is(t, err, ErrUnknownKey)
+
+	// Unbound fields are sealed again instead
+	unbound, _ := unboundKey(t, previous, "ciphertext")
+	_, err = e.Rewrap(unbound)
+	assert.Is(t, err, ErrUnbound)
+}
+
+func TestKeyfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "master.keys")
+
+	_, err := NewKeyfile(path)
+	assert.True(t, os.IsNotExist(err))
+
+	first, err := AppendKey(path)
+	assert.Is(t, err, nil)
+	keyfile, err := NewKeyfile(path)
+	assert.Is(t, err, nil)
+	assert.Equal(t, keyfile.CurrentKeyID(), first)
+
+	key, sealed, err := New(keyfile).Seal(testRecord, []byte("ciphertext"))
+	assert.Is(t, err, nil)
+
+	// Rotate to a new key, keeping the first one to unwrap existing rows
+	contents, err := os.ReadFile(path)
+	assert.Is(t, err, nil)
+	second := base64.StdEncoding.EncodeToString(make([]byte, KeySize))
+	contents = append(contents, []byte("# rotated\n\nsecond "+second+"\n")...)
+	assert.Is(t, os.WriteFile(path, contents, 0o600), nil)
+
+	keyfile, err = NewKeyfile(path)
+	assert.Is(t, err, nil)
+	assert.Equal(t, keyfile.CurrentKeyID(), "second")
+
+	// Previous keys still unwrap
+	e := New(keyfile)
+	rewrapped, err := e.Rewrap(key)
+	assert.Is(t, err, nil)
+	assert.Equal(t, *rewrapped.MasterKeyID, "second")
+	data := sealed[0]
+	assert.Is(t, e.Open(rewrapped, testRecord, &data), nil)
+	assert.Equal(t, string(data), "ciphertext")
+
+	tests := []struct {
+		Name     string
+		Contents string
+	}{
+		{Name: "Empty", Contents: "# no keys\n"},
+		{Name: "MissingKey", Contents: "v1\n"},
+		{Name: "ShortKey", Contents: "v1 " + base64.StdEncoding.EncodeToString([]byte("short")) + "\n"},
+		{Name: "RepeatedID", Contents: "v1 " + second + "\nv1 " + second + "\n"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.Name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "master.keys")
+			assert.Is(t, os.WriteFile(path, []byte(tc.Contents), 0o600), nil)
+			_, err := NewKeyfile(path)
+			assert.Is(t, err, ErrInvalidKeys)
+		})
+	}
+}
+
+func TestNewProvider(t *testing.T) {
+	_, err := NewProvider("vault", "", "", "")
+	assert.True(t, err != nil)
+
+	_, err = NewProvider(ProviderKMS, "", "not-base64", "v1")
+	assert.Is(t, err, ErrInvalidKeys)
+
+	_, err = NewProvider(ProviderKMS, "", testRootKey, "")
+	assert.Is(t, err, ErrInvalidKeys)
+
+	provider, err := NewProvider(ProviderKMS, "", testRootKey, "v1")
+	assert.Is(t, err, nil)
+	assert.Equal(t, provider.CurrentKeyID(), "v1")
+}
+
+// Seals a field as before fields were bound to their record, returning its
+// data key and the sealed field
+func unboundKey(t *testing.T, provider KeyProvider, field string) (Key, []byte) {
+	t.Helper()
+	dataKey := make([]byte, KeySize)
+	sealed, err := seal(dataKey, []byte(field), nil)
+	assert.Is(t, err, nil)
+
+	keyID := provider.CurrentKeyID()
+	wrapped, err := provider.Wrap(keyID, dataKey)
+	assert.Is(t, err, nil)
+	return Key{Wrapped: wrapped, MasterKeyID: &keyID}, sealed
+}
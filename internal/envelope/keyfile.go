@@ -0,0 +1,105 @@
+package envelope
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Reads master keys from a local file
+//
+// Each line holds a key ID and a base64 encoded 32 byte key separated by a
+// space. Blank lines and lines starting with # are ignored. The last key is
+// the current one, earlier keys are kept to unwrap data keys until they are
+// re-wrapped.
+type Keyfile struct {
+	keys    map[string][]byte
+	current string
+}
+
+func NewKeyfile(path string) (*Keyfile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	keyfile := &Keyfile{keys: map[string][]byte{}}
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%w: %s:%d must hold a key ID and a key", ErrInvalidKeys, path, line)
+		}
+		key, err := base64.StdEncoding.DecodeString(fields[1])
+		if err != nil || len(key) != KeySize {
+			return nil, fmt.Errorf("%w: %s:%d must hold a base64 encoded %d byte key", ErrInvalidKeys, path, line, KeySize)
+		}
+		if _, exists := keyfile.keys[fields[0]]; exists {
+			return nil, fmt.Errorf("%w: %s:%d repeats the key ID %s", ErrInvalidKeys, path, line, fields[0])
+		}
+
+		keyfile.keys[fields[0]] = key
+		keyfile.current = fields[0]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if keyfile.current == "" {
+		return nil, fmt.Errorf("%w: %s holds no key", ErrInvalidKeys, path)
+	}
+
+	return keyfile, nil
+}
+
+func (k *Keyfile) CurrentKeyID() string {
+	return k.current
+}
+
+func (k *Keyfile) Wrap(keyID string, dataKey []byte) ([]byte, error) {
+	key, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, keyID)
+	}
+	return seal(key, dataKey, []byte(keyID))
+}
+
+func (k *Keyfile) Unwrap(keyID string, wrapped []byte) ([]byte, error) {
+	key, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, keyID)
+	}
+	return open(key, wrapped, []byte(keyID))
+}
+
+// Appends a new random key to a keyfile, creating it if needed, and returns
+// its ID. The new key becomes the current one the next time the file is read.
+func AppendKey(path string) (string, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	keyID := time.Now().UTC().Format("20060102T150405Z")
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	if _, err := fmt.Fprintf(file, "%s %s\n", keyID, base64.StdEncoding.EncodeToString(key)); err != nil {
+		return "", err
+	}
+
+	return keyID, file.Close()
+}
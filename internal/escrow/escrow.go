@@ -0,0 +1,129 @@
+// escrow seals data to a recovery key pair
+//
+// The recovery key is an X25519 key pair. Anyone holding the public key can
+// seal data to it, only the private key opens it. A sealed box is the
+// ephemeral public key of the sender, a nonce and the AES-256-GCM ciphertext,
+// keyed with the SHA-256 of the shared secret followed by both public keys.
+package escrow
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+)
+
+// Size of private and public keys
+const KeySize = 32
+
+var (
+	ErrInvalidKey = errors.New("invalid recovery key")
+	ErrDecryption = errors.New("decryption failed")
+)
+
+// ============================================================================
+// Keys
+// ============================================================================
+
+// Generates a new recovery key pair
+func GenerateKey() (privateKey, publicKey []byte, err error) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key.Bytes(), key.PublicKey().Bytes(), nil
+}
+
+// Returns the public key of a private key
+func PublicKey(privateKey []byte) ([]byte, error) {
+	key, err := ecdh.X25519().NewPrivateKey(privateKey)
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+	return key.PublicKey().Bytes(), nil
+}
+
+// ============================================================================
+// Seal and Open
+// ============================================================================
+
+// Seals plaintext to a public key
+func Seal(publicKey, plaintext []byte) ([]byte, error) {
+	recipient, err := ecdh.X25519().NewPublicKey(publicKey)
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := ephemeral.ECDH(recipient)
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+
+	aead, err := newAEAD(shared, ephemeral.PublicKey().Bytes(), publicKey)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	sealed := append(ephemeral.PublicKey().Bytes(), nonce...)
+	return aead.Seal(sealed, nonce, plaintext, nil), nil
+}
+
+// Opens a box sealed to the public key of privateKey
+func Open(privateKey, sealed []byte) ([]byte, error) {
+	key, err := ecdh.X25519().NewPrivateKey(privateKey)
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+	if len(sealed) < KeySize {
+		return nil, ErrDecryption
+	}
+	ephemeral, err := ecdh.X25519().NewPublicKey(sealed[:KeySize])
+	if err != nil {
+		return nil, ErrDecryption
+	}
+	shared, err := key.ECDH(ephemeral)
+	if err != nil {
+		return nil, ErrDecryption
+	}
+
+	aead, err := newAEAD(shared, sealed[:KeySize], key.PublicKey().Bytes())
+	if err != nil {
+		return nil, err
+	}
+	sealed = sealed[KeySize:]
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrDecryption
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, ErrDecryption
+	}
+	return plaintext, nil
+}
+
+// ============================================================================
+// Helpers
+// ============================================================================
+
+// Returns the AES-256-GCM cipher keyed with the shared secret of a box
+func newAEAD(shared, ephemeralPublic, recipientPublic []byte) (cipher.AEAD, error) {
+	digest := sha256.New()
+	digest.Write(shared)
+	digest.Write(ephemeralPublic)
+	digest.Write(recipientPublic)
+
+	block, err := aes.NewCipher(digest.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
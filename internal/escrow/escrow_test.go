@@ -0,0 +1,53 @@
+package escrow
+
+import (
+	"bytes"
+	"testing"
+
+	"pm4devs.strawhats/internal/assert"
+)
+
+func TestSealAndOpen(t *testing.T) {
+	privateKey, publicKey, err := GenerateKey()
+	assert.Check(t, err == nil)
+
+	derived, err := PublicKey(privateKey)
+	assert.Check(t, err == nil)
+	assert.Check(t, bytes.Equal(derived, publicKey))
+
+	sealed, err := Seal(publicKey, []byte("content key"))
+	assert.Check(t, err == nil)
+
+	plaintext, err := Open(privateKey, sealed)
+	assert.Check(t, err == nil)
+	assert.Equal(t, string(plaintext), "content key")
+
+	// Each box uses a new ephemeral key
+	again, err := Seal(publicKey, []byte("content key"))
+	assert.Check(t, err == nil)
+	assert.Check(t, !bytes.Equal(sealed, again))
+}
+
+func TestOpenErrors(t *testing.T) {
+	privateKey, publicKey, err := GenerateKey()
+	assert.Check(t, err == nil)
+	otherKey, _, err := GenerateKey()
+	assert.Check(t, err == nil)
+
+	sealed, err := Seal(publicKey, []byte("content key"))
+	assert.Check(t, err == nil)
+
+	_, err = Open(otherKey, sealed)
+	assert.Equal(t, err, ErrDecryption)
+
+	tampered := bytes.Clone(sealed)
+	tampered[len(tampered)-1] ^= 1
+	_, err = Open(privateKey, tampered)
+	assert.Equal(t, err, ErrDecryption)
+
+	_, err = Open(privateKey, sealed[:10])
+	assert.Equal(t, err, ErrDecryption)
+
+	_, err = Seal([]byte("short"), []byte("content key"))
+	assert.Equal(t, err, ErrInvalidKey)
+}
@@ -0,0 +1,32 @@
+package jobs
+
+import "pm4devs.strawhats/internal/models/emergency"
+
+// Grants emergency access to the trusted contacts whose waiting period ended
+// without a veto and emails each of them
+func (jobs *Jobs) GrantEmergencyAccess() {
+	granted, err := jobs.emergency.GrantDue()
+	if err != nil {
+		jobs.logger.Error(err.Error())
+		return
+	}
+
+	for _, contact := range *granted {
+		jobs.notifyGranted(contact)
+	}
+
+	if len(*granted) > 0 {
+		jobs.logger.Info("granted emergency access", "contacts", len(*granted))
+	}
+}
+
+// Tells a trusted contact they were granted access
+func (jobs *Jobs) notifyGranted(contact emergency.ContactRecord) {
+	data := map[string]string{
+		"grantor": contact.GrantorEmail,
+		"access":  string(contact.Access),
+	}
+	if err := jobs.mailer.SendEmergencyGrantedEmail(contact.GranteeEmail, data); err != nil {
+		jobs.logger.Error(err.Error())
+	}
+}
@@ -0,0 +1,61 @@
+// jobs schedules the recurring background work of the API
+//
+// Every job runs on the app.Backgrounder so it is stopped and waited for
+// during a graceful shutdown.
+package jobs
+
+import (
+	"pm4devs.strawhats/internal/app"
+	"pm4devs.strawhats/internal/config"
+	"pm4devs.strawhats/internal/mailer"
+	"pm4devs.strawhats/internal/models/emergency"
+	"pm4devs.strawhats/internal/models/group"
+	"pm4devs.strawhats/internal/models/links"
+	"pm4devs.strawhats/internal/models/secrets"
+	"pm4devs.strawhats/internal/models/tokens"
+	"pm4devs.strawhats/internal/xlogger"
+)
+
+// ============================================================================
+// Jobs Type
+// ============================================================================
+
+// Encapsulates the Application dependencies required by jobs
+type Jobs struct {
+	bg        app.Backgrounder
+	config    config.Config
+	logger    xlogger.Logger
+	mailer    mailer.Mailer
+	emergency emergency.EmergencyRepository
+	group     group.GroupRepository
+	links     links.LinksRepository
+	secrets   secrets.SecretsRepository
+	tokens    tokens.TokensRepository
+}
+
+func New(app *app.App) *Jobs {
+	return &Jobs{
+		bg:        app.BG,
+		config:    app.Config,
+		logger:    app.Logger,
+		mailer:    app.Mailer,
+		emergency: app.Models.Emergency,
+		group:     app.Models.Group,
+		links:     app.Models.Links,
+		secrets:   app.Models.Secrets,
+		tokens:    app.Models.Tokens,
+	}
+}
+
+// ============================================================================
+// Schedule
+// ============================================================================
+
+// Schedules all recurring jobs
+func (jobs *Jobs) Start() {
+	jobs.bg.Every(jobs.config.Trash.PurgeInterval, jobs.PurgeTrash)
+	jobs.bg.Every(jobs.config.Shares.SweepInterval, jobs.SweepExpiredShares)
+	jobs.bg.Every(jobs.config.Shares.SweepInterval, jobs.PurgeExpiredLinks)
+	jobs.bg.Every(jobs.config.Emergency.GrantInterval, jobs.GrantEmergencyAccess)
+	jobs.bg.Every(jobs.config.Tokens.UseInterval, jobs.SaveSessionUses)
+}
@@ -0,0 +1,14 @@
+package jobs
+
+// Removes the one-time links that expired before being used up
+func (jobs *Jobs) PurgeExpiredLinks() {
+	links, err := jobs.links.DeleteExpired()
+	if err != nil {
+		jobs.logger.Error(err.Error())
+		return
+	}
+
+	if links > 0 {
+		jobs.logger.Info("removed expired links", "links", links)
+	}
+}
@@ -0,0 +1,9 @@
+package jobs
+
+// Saves where sessions were last used from, recorded in memory by the
+// requests made with them
+func (jobs *Jobs) SaveSessionUses() {
+	if _, err := jobs.tokens.SaveUses(); err != nil {
+		jobs.logger.Error(err.Error())
+	}
+}
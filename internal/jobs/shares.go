@@ -0,0 +1,31 @@
+package jobs
+
+import "time"
+
+// Removes the shares that have expired and emails the owner of each secret,
+// service accounts aside
+func (jobs *Jobs) SweepExpiredShares() {
+	expired, err := jobs.secrets.DeleteExpiredShares()
+	if err != nil {
+		jobs.logger.Error(err.Error())
+		return
+	}
+
+	for _, share := range *expired {
+		if !share.Notify {
+			continue
+		}
+		data := map[string]string{
+			"secretName": share.SecretName,
+			"recipient":  share.Recipient,
+			"expiredAt":  share.ExpiredAt.UTC().Format(time.RFC1123),
+		}
+		if err := jobs.mailer.SendShareExpiredEmail(share.OwnerEmail, data); err != nil {
+			jobs.logger.Error(err.Error())
+		}
+	}
+
+	if len(*expired) > 0 {
+		jobs.logger.Info("removed expired shares", "shares", len(*expired))
+	}
+}
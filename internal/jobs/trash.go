@@ -0,0 +1,23 @@
+package jobs
+
+import "time"
+
+// Permanently removes secrets and groups that have been in the trash for
+// longer than the configured retention window
+func (jobs *Jobs) PurgeTrash() {
+	cutoff := time.Now().Add(-jobs.config.Trash.Retention)
+
+	secrets, err := jobs.secrets.PurgeDeletedBefore(cutoff)
+	if err != nil {
+		jobs.logger.Error(err.Error())
+	}
+
+	groups, err := jobs.group.PurgeDeletedBefore(cutoff)
+	if err != nil {
+		jobs.logger.Error(err.Error())
+	}
+
+	if secrets > 0 || groups > 0 {
+		jobs.logger.Info("purged trash", "secrets", secrets, "groups", groups)
+	}
+}
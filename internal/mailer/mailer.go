@@ -23,6 +23,9 @@ var templateFS embed.FS
 type Mailer interface {
 	SendWelcomeEmail(recipient string, data map[string]string) *xerrors.AppError
 	SendPasswordResetEmail(recipientemail string, data map[string]string) *xerrors.AppError
+	SendShareExpiredEmail(recipient string, data map[string]string) *xerrors.AppError
+	SendEmergencyRequestEmail(recipient string, data map[string]string) *xerrors.AppError
+	SendEmergencyGrantedEmail(recipient string, data map[string]string) *xerrors.AppError
 }
 
 // ============================================================================
@@ -44,6 +47,10 @@ type Mail struct {
 const (
 	welcomeTemplate       = "user_welcome.tmpl"
 	passwordResetTemplate = "password_reset.tmpl"
+	shareExpiredTemplate  = "share_expired.tmpl"
+
+	emergencyRequestTemplate = "emergency_request.tmpl"
+	emergencyGrantedTemplate = "emergency_granted.tmpl"
 )
 
 // Creates a new Mailer
@@ -87,6 +94,34 @@ func (m Mail) SendPasswordResetEmail(recipient string, data map[string]string) *
 	return m.send(recipient, passwordResetTemplate, data)
 }
 
+// Tells the owner of a secret that a share has expired
+func (m Mail) SendShareExpiredEmail(recipient string, data map[string]string) *xerrors.AppError {
+	if m.skip {
+		m.logger.Info("Share Expired", "secret", data["secretName"], "recipient", data["recipient"])
+		return nil
+	}
+	return m.send(recipient, shareExpiredTemplate, data)
+}
+
+// Tells the grantor a trusted contact requested access, with a token to veto
+// the request
+func (m Mail) SendEmergencyRequestEmail(recipient string, data map[string]string) *xerrors.AppError {
+	if m.skip {
+		m.logger.Info("Emergency Access Requested", "contact", data["contact"], "token", data["vetoToken"])
+		return nil
+	}
+	return m.send(recipient, emergencyRequestTemplate, data)
+}
+
+// Tells a trusted contact they were granted access
+func (m Mail) SendEmergencyGrantedEmail(recipient string, data map[string]string) *xerrors.AppError {
+	if m.skip {
+		m.logger.Info("Emergency Access Granted", "grantor", data["grantor"], "access", data["access"])
+		return nil
+	}
+	return m.send(recipient, emergencyGrantedTemplate, data)
+}
+
 // ============================================================================
 // Private
 // ============================================================================
@@ -19,12 +19,18 @@ func App(t *testing.T) *app.App {
 	// Create a shared logger
 	logger := logger()
 
+	// Secrets are encrypted at rest with the stand-in KMS
+	envelope, err := cfg.Keys.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
 	mock := app.New(
 		app.NewBackground(logger),
 		cfg,
 		logger,
 		mail(),
-		models.New(db),
+		models.New(db, envelope, cfg.SecretKey()),
 		rest.New(logger),
 	)
 
@@ -0,0 +1,188 @@
+package mocks
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+)
+
+// ============================================================================
+// Authenticator
+// ============================================================================
+
+// Software WebAuthn authenticator with a P-256 credential, standing in for a
+// security key or passkey in tests
+type Authenticator struct {
+	RPID         string // Relying party the credential is scoped to
+	Origin       string // Origin the browser reports
+	Format       string // Attestation format, "none" or "packed" self attestation
+	UserVerified bool   // Whether the user verifies with a PIN or biometrics
+	CredentialID []byte
+	UserHandle   []byte
+	SignCount    uint32
+	key          *ecdsa.PrivateKey
+}
+
+// Creates an authenticator verifying its user, without attestation
+func NewAuthenticator(rpID, origin string) *Authenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+
+	return &Authenticator{
+		RPID:         rpID,
+		Origin:       origin,
+		Format:       "none",
+		UserVerified: true,
+		CredentialID: id,
+		key:          key,
+	}
+}
+
+// Creates the credential for a user, returning the JSON response of
+// navigator.credentials.create
+func (a *Authenticator) Create(challenge, userHandle []byte) string {
+	a.UserHandle = userHandle
+	clientData := a.clientData("webauthn.create", challenge)
+
+	// Attested credential data: AAGUID, credential ID and COSE key
+	x, y := make([]byte, 32), make([]byte, 32)
+	a.key.X.FillBytes(x)
+	a.key.Y.FillBytes(y)
+	coseKey := encodeCBOR(cborMap{{1, 2}, {3, -7}, {-1, 1}, {-2, x}, {-3, y}})
+	attested := make([]byte, 16, 18)
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.CredentialID)))
+	attested = append(append(attested, a.CredentialID...), coseKey...)
+	authData := append(a.authData(0x40), attested...)
+
+	statement := cborMap{}
+	if a.Format == "packed" {
+		statement = cborMap{{"alg", -7}, {"sig", a.sign(authData, clientData)}}
+	}
+	attestation := encodeCBOR(cborMap{{"fmt", a.Format}, {"attStmt", statement}, {"authData", authData}})
+
+	return a.response(map[string]string{
+		"clientDataJSON":    encode(clientData),
+		"attestationObject": encode(attestation),
+	})
+}
+
+// Asserts the credential, returning the JSON response of
+// navigator.credentials.get
+func (a *Authenticator) Get(challenge []byte) string {
+	a.SignCount++
+	clientData := a.clientData("webauthn.get", challenge)
+	authData := a.authData(0)
+
+	return a.response(map[string]string{
+		"clientDataJSON":    encode(clientData),
+		"authenticatorData": encode(authData),
+		"signature":         encode(a.sign(authData, clientData)),
+		"userHandle":        encode(a.UserHandle),
+	})
+}
+
+// ============================================================================
+// Helpers
+// ============================================================================
+
+// Returns the client data the browser collects
+func (a *Authenticator) clientData(ceremony string, challenge []byte) []byte {
+	data, _ := json.Marshal(map[string]any{
+		"type":        ceremony,
+		"challenge":   encode(challenge),
+		"origin":      a.Origin,
+		"crossOrigin": false,
+	})
+	return data
+}
+
+// Returns authenticator data with the given flags, along with user presence
+// and verification
+func (a *Authenticator) authData(flags byte) []byte {
+	flags |= 0x01
+	if a.UserVerified {
+		flags |= 0x04
+	}
+	rpIDHash := sha256.Sum256([]byte(a.RPID))
+	data := append(rpIDHash[:], flags)
+	return binary.BigEndian.AppendUint32(data, a.SignCount)
+}
+
+// Signs authenticator data along with the hash of client data
+func (a *Authenticator) sign(authData, clientData []byte) []byte {
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		panic(err)
+	}
+	return signature
+}
+
+// Returns the JSON serialization of a public key credential
+func (a *Authenticator) response(fields map[string]string) string {
+	data, _ := json.Marshal(map[string]any{
+		"id":       encode(a.CredentialID),
+		"rawId":    encode(a.CredentialID),
+		"type":     "public-key",
+		"response": fields,
+	})
+	return string(data)
+}
+
+// Encodes binary data in unpadded base64url
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// CBOR map keeping the order of its entries
+type cborMap []struct {
+	key   any
+	value any
+}
+
+// Encodes integers, strings, byte strings and maps in CBOR
+func encodeCBOR(item any) []byte {
+	header := func(major byte, arg uint64) []byte {
+		switch {
+		case arg < 24:
+			return []byte{major<<5 | byte(arg)}
+		case arg <= 0xff:
+			return []byte{major<<5 | 24, byte(arg)}
+		default:
+			return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(arg))
+		}
+	}
+
+	switch item := item.(type) {
+	case int:
+		if item < 0 {
+			return header(1, uint64(-1-item))
+		}
+		return header(0, uint64(item))
+	case []byte:
+		return append(header(2, uint64(len(item))), item...)
+	case string:
+		return append(header(3, uint64(len(item))), item...)
+	case cborMap:
+		data := header(5, uint64(len(item)))
+		for _, entry := range item {
+			data = append(data, encodeCBOR(entry.key)...)
+			data = append(data, encodeCBOR(entry.value)...)
+		}
+		return data
+	default:
+		panic(fmt.Sprintf("cannot encode %T in CBOR", item))
+	}
+}
@@ -2,8 +2,10 @@ package mocks
 
 import (
 	"os"
+	"time"
 
 	"pm4devs.strawhats/internal/config"
+	"pm4devs.strawhats/internal/envelope"
 )
 
 // Only exists because flags aren't parsing correctly
@@ -12,5 +14,21 @@ func cfg() config.Config {
 	cfg.Env = "local"
 	cfg.Port = 4000
 	cfg.DB.DSN = os.Getenv("TEST_DSN")
+	cfg.Trash.Retention = 30 * 24 * time.Hour
+	cfg.Trash.PurgeInterval = time.Hour
+	cfg.Shares.SweepInterval = 10 * time.Minute
+	cfg.Emergency.GrantInterval = 10 * time.Minute
+	cfg.Tokens.AccessTTL = 15 * time.Minute
+	cfg.Tokens.RefreshTTL = 30 * 24 * time.Hour
+	cfg.Tokens.UseInterval = time.Minute
+	cfg.WebAuthn.RPID = "localhost"
+	cfg.WebAuthn.RPName = "pm4devs"
+	cfg.WebAuthn.Origins = []string{"http://localhost:4000"}
+	cfg.Device.VerificationURL = "http://localhost:4000/v1/auth/device"
+	cfg.PasswordLogin = true
+	cfg.Secret = "ICEiIyQlJicoKSorLC0uLzAxMjM0NTY3ODk6Ozw9Pj8="
+	cfg.Keys.Provider = envelope.ProviderKMS
+	cfg.Keys.KMSRootKey = "AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8="
+	cfg.Keys.KMSKeyID = "test"
 	return cfg
 }
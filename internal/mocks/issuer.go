@@ -0,0 +1,227 @@
+package mocks
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"pm4devs.strawhats/internal/app"
+)
+
+// ============================================================================
+// Issuer
+// ============================================================================
+
+// In-process OpenID Connect provider signing RS256 ID tokens, standing in for
+// the identity provider of a company in tests
+//
+// Authorize stands in for the user signing in at the provider, it returns the
+// code and state the provider would redirect the client back with.
+type Issuer struct {
+	URL          string
+	ClientID     string
+	ClientSecret string
+	KeyID        string
+	key          *rsa.PrivateKey
+	mu           sync.Mutex
+	grants       map[string]grant
+}
+
+// Sign-in awaiting the exchange of its code
+type grant struct {
+	clientID    string
+	redirectURI string
+	challenge   string
+	nonce       string
+	claims      map[string]any
+}
+
+// Starts an issuer, stopped at the end of the test
+func NewIssuer(t *testing.T) *Issuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issuer := &Issuer{
+		ClientID:     "pm4devs",
+		ClientSecret: "secret",
+		KeyID:        "test",
+		key:          key,
+		grants:       map[string]grant{},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", issuer.discovery)
+	mux.HandleFunc("GET /jwks", issuer.jwks)
+	mux.HandleFunc("POST /token", issuer.token)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	issuer.URL = server.URL
+	return issuer
+}
+
+// Configures the single sign-on of an app with the issuer
+func SSO(app *app.App, issuer *Issuer) {
+	app.Config.OIDC.Issuer = issuer.URL
+	app.Config.OIDC.ClientID = issuer.ClientID
+	app.Config.OIDC.ClientSecret = issuer.ClientSecret
+	app.Config.OIDC.RedirectURL = "http://localhost:4000/sso/callback"
+	app.Config.OIDC.Scopes = []string{"openid", "email", "profile"}
+	app.Config.OIDC.GroupsClaim = "groups"
+}
+
+// Signs a user in with the given claims, merged into the ID token, for the
+// authorization request at the given URL. Returns the code and state of the
+// redirect back to the client.
+func (i *Issuer) Authorize(authURL string, claims map[string]any) (string, string, error) {
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		return "", "", err
+	}
+	query := parsed.Query()
+	switch {
+	case query.Get("response_type") != "code":
+		return "", "", fmt.Errorf("unsupported response_type %q", query.Get("response_type"))
+	case query.Get("client_id") != i.ClientID:
+		return "", "", fmt.Errorf("unknown client_id %q", query.Get("client_id"))
+	case query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "":
+		return "", "", fmt.Errorf("PKCE with S256 is required")
+	}
+
+	code := randomString()
+	i.mu.Lock()
+	i.grants[code] = grant{
+		clientID:    query.Get("client_id"),
+		redirectURI: query.Get("redirect_uri"),
+		challenge:   query.Get("code_challenge"),
+		nonce:       query.Get("nonce"),
+		claims:      claims,
+	}
+	i.mu.Unlock()
+	return code, query.Get("state"), nil
+}
+
+// Signs an ID token with the key of the issuer, for tests crafting their own
+func (i *Issuer) Sign(claims map[string]any) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": i.KeyID, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, i.key, crypto.SHA256, digest[:])
+	if err != nil {
+		panic(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// ============================================================================
+// Endpoints
+// ============================================================================
+
+func (i *Issuer) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                i.URL,
+		"authorization_endpoint":                i.URL + "/authorize",
+		"token_endpoint":                        i.URL + "/token",
+		"jwks_uri":                              i.URL + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (i *Issuer) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": i.KeyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(i.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(i.key.E)).Bytes()),
+		}},
+	})
+}
+
+// Exchanges a code once, checking the client, the redirect URI and the code
+// verifier
+func (i *Issuer) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok || clientID != i.ClientID || clientSecret != i.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	code := r.PostForm.Get("code")
+	i.mu.Lock()
+	grant, ok := i.grants[code]
+	delete(i.grants, code)
+	i.mu.Unlock()
+
+	digest := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	switch {
+	case r.PostForm.Get("grant_type") != "authorization_code":
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+
+	case !ok || grant.clientID != clientID || grant.redirectURI != r.PostForm.Get("redirect_uri") ||
+		grant.challenge != base64.RawURLEncoding.EncodeToString(digest[:]):
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	claims := map[string]any{
+		"iss":   i.URL,
+		"aud":   i.ClientID,
+		"iat":   now.Unix(),
+		"exp":   now.Add(5 * time.Minute).Unix(),
+		"nonce": grant.nonce,
+	}
+	for name, value := range grant.claims {
+		claims[name] = value
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     i.Sign(claims),
+	})
+}
+
+// ============================================================================
+// Helpers
+// ============================================================================
+
+func writeJSON(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(data)
+}
+
+func randomString() string {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(random)
+}
@@ -13,6 +13,11 @@ type Mail struct {
 	WelcomeActivationToken string
 	PasswordResetCount     int
 	PasswordResetToken     string
+	ShareExpiredCount      int
+	ShareExpiredRecipients []string
+	EmergencyRequestCount  int
+	EmergencyVetoToken     string
+	EmergencyGrantedCount  int
 }
 
 // Create a mock mail
@@ -37,3 +42,29 @@ func (m *Mail) SendPasswordResetEmail(recipient string, data map[string]string)
 	m.mu.Unlock()
 	return nil
 }
+
+// Tells the owner of a secret that a share has expired
+func (m *Mail) SendShareExpiredEmail(recipient string, data map[string]string) *xerrors.AppError {
+	m.mu.Lock()
+	m.ShareExpiredCount += 1
+	m.ShareExpiredRecipients = append(m.ShareExpiredRecipients, recipient)
+	m.mu.Unlock()
+	return nil
+}
+
+// Tells the grantor a trusted contact requested access
+func (m *Mail) SendEmergencyRequestEmail(recipient string, data map[string]string) *xerrors.AppError {
+	m.mu.Lock()
+	m.EmergencyRequestCount += 1
+	m.EmergencyVetoToken = data["vetoToken"]
+	m.mu.Unlock()
+	return nil
+}
+
+// Tells a trusted contact they were granted access
+func (m *Mail) SendEmergencyGrantedEmail(recipient string, data map[string]string) *xerrors.AppError {
+	m.mu.Lock()
+	m.EmergencyGrantedCount += 1
+	m.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,96 @@
+package accesstokens
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"slices"
+	"strings"
+	"time"
+
+	"pm4devs.strawhats/internal/models/tokens"
+	"pm4devs.strawhats/internal/xerrors"
+)
+
+// ============================================================================
+// Constants
+// ============================================================================
+
+// Prefix of every personal access token, telling them apart from the tokens of
+// a session
+const Prefix = "pat_"
+
+// Scopes an access token can carry
+const (
+	ScopeSecretsRead  = "secrets:read"   // Reading secrets, their versions and the user's keys
+	ScopeSecretsWrite = "secrets:write"  // Creating, updating, rolling back and deleting secrets
+	ScopeGroupsManage = "groups:manage"  // Creating, renaming and deleting groups, and managing members
+	ScopeSCIM         = "scim:provision" // Provisioning users and groups over SCIM, for admins
+)
+
+// Every scope, in the order they are documented
+var Scopes = []string{ScopeSecretsRead, ScopeSecretsWrite, ScopeGroupsManage, ScopeSCIM}
+
+// ============================================================================
+// Types
+// ============================================================================
+
+// Encapsulates the database properties of a personal access token
+type AccessToken struct {
+	ID         int64      `db:"id" json:"id"`                     // Unique identifier
+	UserID     int64      `db:"user_id" json:"-"`                 // Foreign key referencing users(id)
+	Name       string     `db:"name" json:"name"`                 // Name given by the user
+	Plaintext  string     `db:"-" json:"token,omitempty"`         // Only known when created
+	Hash       []byte     `db:"hash" json:"-"`                    // SHA-256 of the plaintext
+	Scopes     []string   `db:"scopes" json:"scopes"`             // What the token can be used for
+	SecretIDs  []int64    `db:"secret_ids" json:"secret_ids"`     // Secrets the token is restricted to, if any
+	GroupIDs   []int64    `db:"group_ids" json:"group_ids"`       // Groups the token is restricted to, if any
+	ExpiresAt  *time.Time `db:"expires_at" json:"expires_at"`     // Never expires when nil
+	CreatedAt  time.Time  `db:"created_at" json:"created_at"`     // Timestamp of creation
+	LastUsedAt *time.Time `db:"last_used_at" json:"last_used_at"` // Timestamp of the last request, to the minute
+}
+
+// Creates an access token for a user with a random plaintext
+func new(userID int64, name string, scopes []string, expiresAt *time.Time) (*AccessToken, *xerrors.AppError) {
+	randomBytes := make([]byte, 20)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return nil, xerrors.ServerError("accesstokens.new", xerrors.ErrServerInternal)
+	}
+
+	plaintext := Prefix + strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes))
+	return &AccessToken{
+		UserID:    userID,
+		Name:      name,
+		Plaintext: plaintext,
+		Hash:      tokens.Hash(plaintext),
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// Reports whether a scope is known
+func ValidScope(scope string) bool {
+	return slices.Contains(Scopes, scope)
+}
+
+// Reports whether a plaintext is a personal access token rather than the
+// token of a session
+func IsAccessToken(plaintext string) bool {
+	return strings.HasPrefix(plaintext, Prefix)
+}
+
+// Reports whether the token carries a scope
+func (t *AccessToken) Includes(scope string) bool {
+	return slices.Contains(t.Scopes, scope)
+}
+
+// Reports whether the token reaches a secret. A nil token, for requests made
+// with a session, reaches every secret.
+func (t *AccessToken) AllowsSecret(secretID int64) bool {
+	return t == nil || t.SecretIDs == nil || slices.Contains(t.SecretIDs, secretID)
+}
+
+// Reports whether the token reaches a group. A nil token, for requests made
+// with a session, reaches every group.
+func (t *AccessToken) AllowsGroup(groupID int64) bool {
+	return t == nil || t.GroupIDs == nil || slices.Contains(t.GroupIDs, groupID)
+}
@@ -0,0 +1,190 @@
+package accesstokens
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/lib/pq"
+	"pm4devs.strawhats/internal/models/core"
+	"pm4devs.strawhats/internal/models/tokens"
+	"pm4devs.strawhats/internal/models/users"
+	"pm4devs.strawhats/internal/xerrors"
+)
+
+// ============================================================================
+// Interface
+// ============================================================================
+
+// Defines a mockable interface for personal access token operations
+type AccessTokensRepository interface {
+	New(userID int64, name string, scopes []string, expiresAt *time.Time) (*AccessToken, *xerrors.AppError)
+	Insert(token *AccessToken) *xerrors.AppError
+	GetByPlaintext(plaintext string) (*AccessToken, *users.UserRecord, *xerrors.AppError)
+	GetByUserID(userID int64) (*[]AccessToken, *xerrors.AppError)
+	Touch(id int64) *xerrors.AppError
+	Delete(id, userID int64) *xerrors.AppError
+}
+
+func Repository(db core.Queryable) AccessTokensRepository {
+	return &AccessTokens{DB: db}
+}
+
+// ============================================================================
+// Implementation
+// ============================================================================
+
+// Provides access to the AccessTokens database methods
+type AccessTokens struct {
+	DB core.Queryable
+}
+
+// Columns of an access token record
+const tokenColumns = `t.id, t.user_id, t.name, t.hash, t.scopes, t.secret_ids, t.group_ids, t.expires_at,
+	t.created_at, t.last_used_at`
+
+// Creates an access token for a user, carrying the given scopes until it
+// expires, if ever
+func (AccessTokens) New(userID int64, name string, scopes []string, expiresAt *time.Time) (*AccessToken, *xerrors.AppError) {
+	return new(userID, name, scopes, expiresAt)
+}
+
+// Stores an access token, setting its ID and creation date
+func (m *AccessTokens) Insert(token *AccessToken) *xerrors.AppError {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		INSERT INTO access_tokens (user_id, name, hash, scopes, secret_ids, group_ids, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at;
+	`
+
+	args := []any{token.UserID, token.Name, token.Hash, pq.Array(token.Scopes), pq.Array(token.SecretIDs),
+		pq.Array(token.GroupIDs), token.ExpiresAt}
+	if err := m.DB.QueryRowContext(ctx, query, args...).Scan(&token.ID, &token.CreatedAt); err != nil {
+		return xerrors.DatabaseError(err, "accesstokens.Insert")
+	}
+
+	return nil
+}
+
+// Gets an access token that has not expired by its plaintext, along with its
+// user
+//
+// The tokens of service accounts stop working while their group is deleted,
+// and the tokens of users while they are deactivated.
+func (m *AccessTokens) GetByPlaintext(plaintext string) (*AccessToken, *users.UserRecord, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT ` + tokenColumns + `,
+			u.id, u.email, u.password, u.activated, u.created_at, u.version, u.owner_group_id
+		FROM access_tokens t
+		INNER JOIN users u ON u.id = t.user_id
+		LEFT JOIN groups g ON g.id = u.owner_group_id
+		WHERE t.hash = $1 AND (t.expires_at IS NULL OR t.expires_at > NOW()) AND g.deleted_at IS NULL
+			AND u.deactivated_at IS NULL;
+	`
+
+	var token AccessToken
+	var user users.UserRecord
+	dest := append(tokenDest(&token),
+		&user.ID, &user.Email, &user.Password, &user.Activated, &user.CreatedAt, &user.Version, &user.OwnerGroupID)
+	if err := m.DB.QueryRowContext(ctx, query, tokens.Hash(plaintext)).Scan(dest...); err != nil {
+		return nil, nil, xerrors.DatabaseError(err, "accesstokens.GetByPlaintext")
+	}
+
+	return &token, &user, nil
+}
+
+// Lists the access tokens of a user, expired ones included
+func (m *AccessTokens) GetByUserID(userID int64) (*[]AccessToken, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT ` + tokenColumns + `
+		FROM access_tokens t
+		WHERE t.user_id = $1
+		ORDER BY t.created_at, t.id;
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, "accesstokens.GetByUserID")
+	}
+	defer rows.Close()
+
+	accessTokens := []AccessToken{}
+	for rows.Next() {
+		var token AccessToken
+		if err := rows.Scan(tokenDest(&token)...); err != nil {
+			return nil, xerrors.DatabaseError(err, "accesstokens.GetByUserID - scan")
+		}
+		accessTokens = append(accessTokens, token)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, xerrors.DatabaseError(err, "accesstokens.GetByUserID - rows error")
+	}
+
+	return &accessTokens, nil
+}
+
+// Records the use of an access token
+//
+// Writes are spread out to once a minute per token, so last_used_at is only
+// as precise.
+func (m *AccessTokens) Touch(id int64) *xerrors.AppError {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		UPDATE access_tokens
+		SET last_used_at = NOW()
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute');
+	`
+
+	if _, err := m.DB.ExecContext(ctx, query, id); err != nil {
+		return xerrors.DatabaseError(err, "accesstokens.Touch")
+	}
+
+	return nil
+}
+
+// Revokes an access token of a user
+func (m *AccessTokens) Delete(id, userID int64) *xerrors.AppError {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM access_tokens WHERE id = $1 AND user_id = $2;`, id, userID)
+	if err != nil {
+		return xerrors.DatabaseError(err, "accesstokens.Delete")
+	}
+
+	rowsAffected, appErr := core.RowsAffected(result, "accesstokens.Delete")
+	if appErr != nil {
+		return appErr
+	}
+
+	if rowsAffected == 0 {
+		return xerrors.ClientError(http.StatusNotFound,
+			fmt.Sprintf("No access token found with id: %d", id), "accesstokens.Delete", xerrors.ErrNotFound)
+	}
+
+	return nil
+}
+
+// ============================================================================
+// Helpers
+// ============================================================================
+
+// Returns the scan destinations of tokenColumns
+func tokenDest(token *AccessToken) []any {
+	return []any{&token.ID, &token.UserID, &token.Name, &token.Hash, pq.Array(&token.Scopes),
+		pq.Array(&token.SecretIDs), pq.Array(&token.GroupIDs), &token.ExpiresAt, &token.CreatedAt,
+		&token.LastUsedAt}
+}
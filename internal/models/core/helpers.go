@@ -16,3 +16,8 @@ func RowsAffected(result sql.Result, op string) (int64, *xerrors.AppError) {
 
 	return rowsAffected, nil
 }
+
+// Converts an optional ID to a nullable value, where 0 is stored as NULL
+func NullableID(id int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: id, Valid: id > 0}
+}
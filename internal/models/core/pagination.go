@@ -0,0 +1,274 @@
+package core
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"pm4devs.strawhats/internal/validator"
+	"pm4devs.strawhats/internal/xerrors"
+)
+
+// ============================================================================
+// Page
+// ============================================================================
+
+const (
+	DefaultPageLimit = 50
+	MaxPageLimit     = 200
+)
+
+// A window into a sorted listing requested by a client
+type Page struct {
+	Limit  int      // Number of rows, DefaultPageLimit when 0
+	Sort   string   // Sort key of the listing, the row keys when empty
+	Desc   bool     // Sort in descending order
+	Cursor *Cursor  // Position after which the page starts, nil for the first page
+	Fields []string // JSON fields of the rows to return, every field when empty
+}
+
+// Parses the pagination query parameters of a listing
+//
+//	?limit=<1-200>&cursor=<next_cursor>&sort=<key>|-<key>&fields=<field>,...
+//
+// A leading '-' on the sort key sorts in descending order.
+func ParsePage(query url.Values, op string) (Page, *xerrors.AppError) {
+	v := validator.New()
+
+	var page Page
+	if raw := query.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		v.Check(err == nil && limit > 0 && limit <= MaxPageLimit, "limit",
+			fmt.Sprintf("must be between 1 and %d", MaxPageLimit))
+		page.Limit = limit
+	}
+
+	page.Sort = query.Get("sort")
+	if strings.HasPrefix(page.Sort, "-") {
+		page.Sort = strings.TrimPrefix(page.Sort, "-")
+		page.Desc = true
+	}
+
+	if raw := query.Get("cursor"); raw != "" {
+		cursor, err := DecodeCursor(raw)
+		v.Check(err == nil, "cursor", "is invalid")
+		page.Cursor = cursor
+	}
+
+	if raw := query.Get("fields"); raw != "" {
+		for _, field := range strings.Split(raw, ",") {
+			page.Fields = append(page.Fields, strings.TrimSpace(field))
+		}
+	}
+
+	if err := v.Valid(op); err != nil {
+		return Page{}, err
+	}
+	return page, nil
+}
+
+// Reports whether the rows of the page carry a JSON field. Listings don't
+// read the large values of fields that were left out.
+func (p Page) Wants(field string) bool {
+	return len(p.Fields) == 0 || slices.Contains(p.Fields, field)
+}
+
+// The position of the last row of a page. Cursors are handed to clients as
+// opaque strings and are only valid for the sort they were created with.
+type Cursor struct {
+	Sort  string  `json:"s,omitempty"`
+	Desc  bool    `json:"d,omitempty"`
+	Value *string `json:"v,omitempty"`
+	Keys  []int64 `json:"k"`
+}
+
+// Encodes a cursor to an opaque string
+func (c Cursor) String() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Decodes a cursor created by Cursor.String
+func DecodeCursor(s string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	var cursor Cursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
+
+// ============================================================================
+// Listing
+// ============================================================================
+
+// Describes how the rows of a query can be sorted and paged
+type Listing struct {
+	Sorts map[string]string // Sort key to the SQL expression it orders by
+	Keys  []string          // bigint SQL expressions uniquely identifying a row
+}
+
+// Tracks the rows of a query to produce the cursor of the next page
+//
+// Add Where, Columns and OrderBy to the query, append Dest to the scan
+// destinations of every row and stop iterating once Keep returns false.
+type Pager struct {
+	listing Listing
+	page    Page
+	expr    string
+
+	count int
+	value sql.NullString
+	keys  []int64
+	last  Cursor
+	next  string
+}
+
+// Creates a pager for the page, returning a validation error if the sort key
+// or cursor do not belong to the listing
+func (l Listing) Pager(page Page, op string) (*Pager, *xerrors.AppError) {
+	pager := &Pager{listing: l, page: page, keys: make([]int64, len(l.Keys))}
+
+	if page.Limit <= 0 {
+		pager.page.Limit = DefaultPageLimit
+	}
+
+	if page.Sort != "" {
+		expr, ok := l.Sorts[page.Sort]
+		if !ok {
+			return nil, pageError("sort", "must be one of "+l.sortKeys(), op)
+		}
+		pager.expr = expr
+	}
+
+	if c := page.Cursor; c != nil {
+		if c.Sort != page.Sort || c.Desc != page.Desc || len(c.Keys) != len(l.Keys) ||
+			(page.Sort != "" && c.Value == nil) {
+			return nil, pageError("cursor", "does not match the requested sort", op)
+		}
+	}
+
+	return pager, nil
+}
+
+// Returns the condition restricting the rows to those after the cursor.
+// Placeholders continue from the args already given.
+func (p *Pager) Where(args []any) (string, []any) {
+	c := p.page.Cursor
+	if c == nil {
+		return "", args
+	}
+
+	var columns, params []string
+	if p.expr != "" {
+		args = append(args, *c.Value)
+		columns = append(columns, p.expr)
+		params = append(params, fmt.Sprintf("$%d", len(args)))
+	}
+	for i, key := range p.listing.Keys {
+		args = append(args, c.Keys[i])
+		columns = append(columns, key)
+		params = append(params, fmt.Sprintf("$%d", len(args)))
+	}
+
+	operator := ">"
+	if p.page.Desc {
+		operator = "<"
+	}
+
+	return fmt.Sprintf(" AND (%s) %s (%s)", strings.Join(columns, ", "), operator,
+		strings.Join(params, ", ")), args
+}
+
+// Returns the extra select columns used to build cursors
+func (p *Pager) Columns() string {
+	value := "NULL::text"
+	if p.expr != "" {
+		value = p.expr + "::text"
+	}
+	return ", " + value + ", " + strings.Join(p.listing.Keys, ", ")
+}
+
+// Returns the ORDER BY and LIMIT clauses. One extra row is requested to know
+// whether there is a next page.
+func (p *Pager) OrderBy() string {
+	direction := ""
+	if p.page.Desc {
+		direction = " DESC"
+	}
+
+	var columns []string
+	if p.expr != "" {
+		columns = append(columns, p.expr+direction)
+	}
+	for _, key := range p.listing.Keys {
+		columns = append(columns, key+direction)
+	}
+
+	return fmt.Sprintf(" ORDER BY %s LIMIT %d", strings.Join(columns, ", "), p.page.Limit+1)
+}
+
+// Returns the scan destinations of the columns added by Columns
+func (p *Pager) Dest() []any {
+	dest := []any{&p.value}
+	for i := range p.keys {
+		dest = append(dest, &p.keys[i])
+	}
+	return dest
+}
+
+// Records the row that was just scanned. Returns false for the extra row past
+// the end of the page, which should be discarded.
+func (p *Pager) Keep() bool {
+	p.count++
+	if p.count > p.page.Limit {
+		p.next = p.last.String()
+		return false
+	}
+
+	p.last = Cursor{Sort: p.page.Sort, Desc: p.page.Desc, Keys: append([]int64(nil), p.keys...)}
+	if p.value.Valid {
+		value := p.value.String
+		p.last.Value = &value
+	}
+	return true
+}
+
+// Returns the cursor of the next page, or an empty string on the last page
+func (p *Pager) Next() string {
+	return p.next
+}
+
+// ============================================================================
+// Helpers
+// ============================================================================
+
+func (l Listing) sortKeys() string {
+	keys := make([]string, 0, len(l.Sorts))
+	for key := range l.Sorts {
+		keys = append(keys, key)
+	}
+	// Map order is random, keep error messages stable
+	sort.Strings(keys)
+	return strings.Join(keys, ", ")
+}
+
+func pageError(key, message, op string) *xerrors.AppError {
+	return xerrors.ClientError(
+		http.StatusUnprocessableEntity,
+		map[string]string{key: message},
+		op,
+		xerrors.ErrFailedValidation,
+	)
+}
@@ -0,0 +1,72 @@
+package emergency
+
+import (
+	"time"
+
+	"pm4devs.strawhats/internal/models/users"
+)
+
+// ============================================================================
+// Constants
+// ============================================================================
+
+// Access a trusted contact gets to the vault of the grantor
+type Access string
+
+const (
+	AccessView     Access = "view"     // Reads the secrets of the grantor
+	AccessTakeover Access = "takeover" // Also resets the password of the grantor
+)
+
+// Returns true if the access is known
+func (a Access) Valid() bool {
+	return a == AccessView || a == AccessTakeover
+}
+
+// Status of the recovery of a trusted contact
+type Status string
+
+const (
+	StatusIdle      Status = "idle"      // No recovery requested
+	StatusRequested Status = "requested" // Waiting for the grantor to veto until grants_at
+	StatusGranted   Status = "granted"   // The waiting period ended without a veto
+)
+
+// Bounds of the waiting period, in days
+const (
+	DefaultWaitDays = 7
+	MaxWaitDays     = 90
+)
+
+// ============================================================================
+// Type
+// ============================================================================
+
+// ContactRecord represents the emergency_contacts table in the database.
+type ContactRecord struct {
+	ID             int64      `db:"id" json:"id"`                           // Unique identifier
+	GrantorID      int64      `db:"grantor_id" json:"grantor_id"`           // User whose vault is recovered
+	GrantorEmail   string     `db:"-" json:"grantor_email"`                 // Email of the grantor
+	GranteeID      int64      `db:"grantee_id" json:"grantee_id"`           // Trusted contact
+	GranteeEmail   string     `db:"-" json:"grantee_email"`                 // Email of the trusted contact
+	Access         Access     `db:"access" json:"access"`                   // One of view or takeover
+	WaitDays       int        `db:"wait_days" json:"wait_days"`             // Days the grantor has to veto a request
+	WrappedKey     *string    `db:"wrapped_key" json:"wrapped_key"`         // Private key of the grantor wrapped for the contact, only returned once granted
+	KeyFingerprint string     `db:"key_fingerprint" json:"key_fingerprint"` // Fingerprint of the public key of the contact it was wrapped with
+	Status         Status     `db:"status" json:"status"`                   // One of idle, requested or granted
+	RequestedAt    *time.Time `db:"requested_at" json:"requested_at"`       // When the contact requested access
+	GrantsAt       *time.Time `db:"grants_at" json:"grants_at"`             // When access is granted unless vetoed
+	CreatedAt      time.Time  `db:"created_at" json:"created_at"`           // Timestamp with time zone
+	UpdatedAt      time.Time  `db:"updated_at" json:"updated_at"`           // Timestamp with time zone
+}
+
+// Takeover holds the changes made to the account of a grantor taken over by a
+// trusted contact
+type Takeover struct {
+	ContactID           int64             // Contact with granted takeover access
+	GranteeID           int64             // Trusted contact taking over the account
+	Grantor             *users.UserRecord // Grantor as read, with their new password set
+	KDF                 *users.KDF        // KDF parameters of the new password, unchanged when nil
+	PublicKey           string            // Public key of the grantor, unchanged when empty
+	EncryptedPrivateKey string            // Private key of the grantor encrypted for the new password
+}
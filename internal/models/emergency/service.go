@@ -0,0 +1,456 @@
+package emergency
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"pm4devs.strawhats/internal/models/core"
+	"pm4devs.strawhats/internal/models/keys"
+	"pm4devs.strawhats/internal/models/tokens"
+	"pm4devs.strawhats/internal/xerrors"
+)
+
+// ============================================================================
+// Interface
+// ============================================================================
+
+// Defines a mockable interface for emergency access operations
+type EmergencyRepository interface {
+	NewRecord(grantorID, granteeID int64, access Access, waitDays int, wrappedKey, fingerprint string) (*ContactRecord, *xerrors.AppError)
+	GetByID(contactID int64) (*ContactRecord, *xerrors.AppError)
+	GetByUserID(userID int64) (*[]ContactRecord, *xerrors.AppError)
+	Delete(contactID, userID int64) *xerrors.AppError
+	Request(contactID, granteeID int64, veto *tokens.Token) (*ContactRecord, *xerrors.AppError)
+	Cancel(contactID, userID int64) *xerrors.AppError
+	Takeover(takeover Takeover) *xerrors.AppError
+	Veto(plaintext string) (*ContactRecord, *xerrors.AppError)
+	GrantDue() (*[]ContactRecord, *xerrors.AppError)
+}
+
+func Repository(db core.Queryable) EmergencyRepository {
+	return &Emergency{DB: db}
+}
+
+// ============================================================================
+// Implementation
+// ============================================================================
+
+// Provides access to the Emergency database methods
+type Emergency struct {
+	DB core.Queryable
+}
+
+// Columns of a contact record, along with the emails of its users. The
+// wrapped key is left out until access is granted.
+const contactColumns = `c.id, c.grantor_id, g.email, c.grantee_id, e.email, c.access, c.wait_days,
+	CASE WHEN c.status = 'granted' THEN c.wrapped_key END, c.key_fingerprint, c.status,
+	c.requested_at, c.grants_at, c.created_at, c.updated_at`
+
+// Joins the users of a contact record
+const contactJoins = `
+	JOIN users g ON g.id = c.grantor_id
+	JOIN users e ON e.id = c.grantee_id`
+
+// Nominates a trusted contact of the grantor
+//
+// The wrapped key is the private key of the grantor wrapped with the public
+// key of the contact of the given fingerprint. Check for
+// xerrors.ErrUniqueViolation if the contact was already nominated.
+func (em *Emergency) NewRecord(grantorID, granteeID int64, access Access, waitDays int, wrappedKey, fingerprint string) (*ContactRecord, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		WITH c AS (
+			INSERT INTO emergency_contacts (grantor_id, grantee_id, access, wait_days, wrapped_key, key_fingerprint)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			RETURNING *
+		)
+		SELECT ` + contactColumns + `
+		FROM c` + contactJoins + `;
+	`
+
+	var contact ContactRecord
+	err := em.DB.QueryRowContext(ctx, query, grantorID, granteeID, access, waitDays, wrappedKey, fingerprint).
+		Scan(contactDest(&contact)...)
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, "emergency.NewRecord")
+	}
+
+	return &contact, nil
+}
+
+// Gets a trusted contact
+func (em *Emergency) GetByID(contactID int64) (*ContactRecord, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT ` + contactColumns + `
+		FROM emergency_contacts c` + contactJoins + `
+		WHERE c.id = $1;
+	`
+
+	var contact ContactRecord
+	err := em.DB.QueryRowContext(ctx, query, contactID).Scan(contactDest(&contact)...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, noContact(contactID, "emergency.GetByID")
+	}
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, "emergency.GetByID")
+	}
+
+	return &contact, nil
+}
+
+// Lists the trusted contacts of a user along with the users who trust them
+func (em *Emergency) GetByUserID(userID int64) (*[]ContactRecord, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT ` + contactColumns + `
+		FROM emergency_contacts c` + contactJoins + `
+		WHERE c.grantor_id = $1 OR c.grantee_id = $1
+		ORDER BY c.created_at, c.id;
+	`
+
+	rows, err := em.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, "emergency.GetByUserID")
+	}
+	defer rows.Close()
+
+	contacts := []ContactRecord{}
+	for rows.Next() {
+		var contact ContactRecord
+		if err := rows.Scan(contactDest(&contact)...); err != nil {
+			return nil, xerrors.DatabaseError(err, "emergency.GetByUserID - scan")
+		}
+		contacts = append(contacts, contact)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, xerrors.DatabaseError(err, "emergency.GetByUserID - rows error")
+	}
+
+	return &contacts, nil
+}
+
+// Removes a trusted contact, as either the grantor or the contact
+func (em *Emergency) Delete(contactID, userID int64) *xerrors.AppError {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		DELETE FROM emergency_contacts
+		WHERE id = $1 AND (grantor_id = $2 OR grantee_id = $2);
+	`
+
+	result, err := em.DB.ExecContext(ctx, query, contactID, userID)
+	if err != nil {
+		return xerrors.DatabaseError(err, "emergency.Delete")
+	}
+
+	rowsAffected, appErr := core.RowsAffected(result, "emergency.Delete")
+	if appErr != nil {
+		return appErr
+	}
+
+	if rowsAffected == 0 {
+		return noContact(contactID, "emergency.Delete")
+	}
+
+	return nil
+}
+
+// Requests access to the vault of the grantor as their trusted contact
+//
+// The veto token is created with tokens.ScopeEmergencyVeto and only its hash
+// is stored. Its expiry ends the waiting period, it should be the number of
+// days the contact waits from now.
+func (em *Emergency) Request(contactID, granteeID int64, veto *tokens.Token) (*ContactRecord, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		WITH c AS (
+			UPDATE emergency_contacts
+			SET status = 'requested', veto_hash = $3, requested_at = NOW(), grants_at = $4, updated_at = NOW()
+			WHERE id = $1 AND grantee_id = $2 AND status = 'idle'
+			RETURNING *
+		)
+		SELECT ` + contactColumns + `
+		FROM c` + contactJoins + `;
+	`
+
+	var contact ContactRecord
+	err := em.DB.QueryRowContext(ctx, query, contactID, granteeID, veto.Hash, veto.Expiry).
+		Scan(contactDest(&contact)...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, em.notIdle(ctx, contactID, granteeID, "emergency.Request")
+	}
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, "emergency.Request")
+	}
+
+	return &contact, nil
+}
+
+// Ends a pending request or a granted access, as either the grantor or the
+// contact. The contact must request access again to recover the vault.
+func (em *Emergency) Cancel(contactID, userID int64) *xerrors.AppError {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		UPDATE emergency_contacts
+		SET status = 'idle', veto_hash = NULL, requested_at = NULL, grants_at = NULL, updated_at = NOW()
+		WHERE id = $1 AND (grantor_id = $2 OR grantee_id = $2) AND status <> 'idle';
+	`
+
+	result, err := em.DB.ExecContext(ctx, query, contactID, userID)
+	if err != nil {
+		return xerrors.DatabaseError(err, "emergency.Cancel")
+	}
+
+	rowsAffected, appErr := core.RowsAffected(result, "emergency.Cancel")
+	if appErr != nil {
+		return appErr
+	}
+
+	if rowsAffected == 0 {
+		return xerrors.ClientError(http.StatusNotFound,
+			fmt.Sprintf("No pending request or granted access for emergency contact %d", contactID),
+			"emergency.Cancel", xerrors.ErrNotFound)
+	}
+
+	return nil
+}
+
+// Takes over the account of a grantor as their trusted contact in a
+// transaction: the password, KDF parameters and key pair of the grantor are
+// replaced, their sessions ended and the granted access ended
+//
+// Returns xerrors.ErrEditConflict if the grantor changed since they were read.
+func (em *Emergency) Takeover(takeover Takeover) *xerrors.AppError {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Start a new transaction
+	db, ok := em.DB.(*sql.DB)
+	if !ok {
+		return xerrors.DatabaseError(fmt.Errorf("failed to cast DB to *sql.DB"), "emergency.Takeover")
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return xerrors.DatabaseError(err, "emergency.Takeover")
+	}
+	// Rollback is a no-op once the transaction is committed
+	defer tx.Rollback()
+
+	grantor := takeover.Grantor
+
+	// End the granted access first, concurrent takeovers stop here
+	query := `
+		UPDATE emergency_contacts
+		SET status = 'idle', veto_hash = NULL, requested_at = NULL, grants_at = NULL, updated_at = NOW()
+		WHERE id = $1 AND grantee_id = $2 AND grantor_id = $3 AND status = 'granted';
+	`
+	result, err := tx.ExecContext(ctx, query, takeover.ContactID, takeover.GranteeID, grantor.ID)
+	if err != nil {
+		return xerrors.DatabaseError(err, "emergency.Takeover: failed to end access")
+	}
+	rowsAffected, appErr := core.RowsAffected(result, "emergency.Takeover")
+	if appErr != nil {
+		return appErr
+	}
+	if rowsAffected == 0 {
+		return xerrors.ClientError(http.StatusNotFound,
+			fmt.Sprintf("No granted access for emergency contact %d", takeover.ContactID),
+			"emergency.Takeover", xerrors.ErrNotFound)
+	}
+
+	// Set the password of the grantor
+	query = `
+		UPDATE users
+		SET password = $1, version = version + 1
+		WHERE id = $2 AND version = $3;
+	`
+	result, err = tx.ExecContext(ctx, query, grantor.Password, grantor.ID, grantor.Version)
+	if err != nil {
+		return xerrors.DatabaseError(err, "emergency.Takeover: failed to set password")
+	}
+	rowsAffected, appErr = core.RowsAffected(result, "emergency.Takeover")
+	if appErr != nil {
+		return appErr
+	}
+	if rowsAffected == 0 {
+		return xerrors.ClientError(http.StatusConflict,
+			"The account was changed by another request, try again", "emergency.Takeover", xerrors.ErrEditConflict)
+	}
+
+	if kdf := takeover.KDF; kdf != nil {
+		query = `
+			UPDATE users
+			SET kdf_algorithm = $1, kdf_salt = $2, kdf_iterations = $3, kdf_memory = $4, kdf_parallelism = $5,
+				version = version + 1
+			WHERE id = $6;
+		`
+		_, err = tx.ExecContext(ctx, query, kdf.Algorithm, kdf.Salt, kdf.Iterations, kdf.Memory, kdf.Parallelism,
+			grantor.ID)
+		if err != nil {
+			return xerrors.DatabaseError(err, "emergency.Takeover: failed to set KDF")
+		}
+	}
+
+	// Replace the key pair, its private key encrypted for the new password
+	if takeover.PublicKey != "" {
+		query = `
+			UPDATE user_keys SET status = 'retired', updated_at = NOW()
+			WHERE user_id = $1 AND status = 'active';
+		`
+		if _, err = tx.ExecContext(ctx, query, grantor.ID); err != nil {
+			return xerrors.DatabaseError(err, "emergency.Takeover: failed to retire active key")
+		}
+
+		query = `
+			INSERT INTO user_keys (user_id, version, public_key, encrypted_private_key, fingerprint)
+			SELECT $1, COALESCE(MAX(version), 0) + 1, $2, $3, $4
+			FROM user_keys WHERE user_id = $1;
+		`
+		_, err = tx.ExecContext(ctx, query, grantor.ID, takeover.PublicKey, takeover.EncryptedPrivateKey,
+			keys.Fingerprint(takeover.PublicKey))
+		if err != nil {
+			return xerrors.DatabaseError(err, "emergency.Takeover: failed to insert key")
+		}
+	}
+
+	// End the sessions of the grantor
+	query = `DELETE FROM tokens WHERE user_id = $1 AND scope = $2 AND family_id IS NULL;`
+	if _, err = tx.ExecContext(ctx, query, grantor.ID, tokens.ScopeAuthentication); err != nil {
+		return xerrors.DatabaseError(err, "emergency.Takeover: failed to end sessions")
+	}
+	if _, err = tx.ExecContext(ctx, `DELETE FROM token_families WHERE user_id = $1;`, grantor.ID); err != nil {
+		return xerrors.DatabaseError(err, "emergency.Takeover: failed to end sessions")
+	}
+
+	// Commit the transaction
+	if err = tx.Commit(); err != nil {
+		return xerrors.DatabaseError(err, "emergency.Takeover: failed to commit transaction")
+	}
+
+	return nil
+}
+
+// Rejects a pending request with the veto token emailed to the grantor and
+// returns the contact
+//
+// Tokens of requests that were cancelled or already granted are reported as
+// not found.
+func (em *Emergency) Veto(plaintext string) (*ContactRecord, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		WITH c AS (
+			UPDATE emergency_contacts
+			SET status = 'idle', veto_hash = NULL, requested_at = NULL, grants_at = NULL, updated_at = NOW()
+			WHERE veto_hash = $1 AND status = 'requested' AND grants_at > NOW()
+			RETURNING *
+		)
+		SELECT ` + contactColumns + `
+		FROM c` + contactJoins + `;
+	`
+
+	var contact ContactRecord
+	err := em.DB.QueryRowContext(ctx, query, tokens.Hash(plaintext)).Scan(contactDest(&contact)...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, xerrors.ClientError(http.StatusNotFound,
+			"The request does not exist, was cancelled or was already granted",
+			"emergency.Veto", xerrors.ErrNotFound)
+	}
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, "emergency.Veto")
+	}
+
+	return &contact, nil
+}
+
+// Grants access to the contacts whose waiting period ended without a veto and
+// returns them
+func (em *Emergency) GrantDue() (*[]ContactRecord, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		WITH c AS (
+			UPDATE emergency_contacts
+			SET status = 'granted', veto_hash = NULL, updated_at = NOW()
+			WHERE status = 'requested' AND grants_at <= NOW()
+			RETURNING *
+		)
+		SELECT ` + contactColumns + `
+		FROM c` + contactJoins + `
+		ORDER BY c.id;
+	`
+
+	rows, err := em.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, "emergency.GrantDue")
+	}
+	defer rows.Close()
+
+	contacts := []ContactRecord{}
+	for rows.Next() {
+		var contact ContactRecord
+		if err := rows.Scan(contactDest(&contact)...); err != nil {
+			return nil, xerrors.DatabaseError(err, "emergency.GrantDue - scan")
+		}
+		contacts = append(contacts, contact)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, xerrors.DatabaseError(err, "emergency.GrantDue - rows error")
+	}
+
+	return &contacts, nil
+}
+
+// ============================================================================
+// Helpers
+// ============================================================================
+
+// Returns the scan destinations of contactColumns
+func contactDest(contact *ContactRecord) []any {
+	return []any{&contact.ID, &contact.GrantorID, &contact.GrantorEmail, &contact.GranteeID, &contact.GranteeEmail,
+		&contact.Access, &contact.WaitDays, &contact.WrappedKey, &contact.KeyFingerprint, &contact.Status,
+		&contact.RequestedAt, &contact.GrantsAt, &contact.CreatedAt, &contact.UpdatedAt}
+}
+
+// Returns a not found error for a missing contact
+func noContact(contactID int64, op string) *xerrors.AppError {
+	return xerrors.ClientError(http.StatusNotFound,
+		fmt.Sprintf("No emergency contact found with id: %d", contactID), op, xerrors.ErrNotFound)
+}
+
+// Explains why a contact could not request access
+func (em *Emergency) notIdle(ctx context.Context, contactID, granteeID int64, op string) *xerrors.AppError {
+	var status Status
+	err := em.DB.QueryRowContext(ctx, `SELECT status FROM emergency_contacts WHERE id = $1 AND grantee_id = $2;`,
+		contactID, granteeID).Scan(&status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return noContact(contactID, op)
+	}
+	if err != nil {
+		return xerrors.DatabaseError(err, op)
+	}
+
+	return xerrors.ClientError(http.StatusConflict,
+		fmt.Sprintf("Access was already %s", status), op, xerrors.ErrEditConflict)
+}
@@ -0,0 +1,30 @@
+package folders
+
+import (
+	"time"
+
+	"pm4devs.strawhats/internal/models/secrets"
+)
+
+// FolderRecord represents the folders table in the database.
+type FolderRecord struct {
+	ID        int64     `db:"id" json:"id"`                 // Bigserial primary key
+	Name      string    `db:"name" json:"name"`             // Name of the folder, unique within its parent
+	OwnerID   int64     `db:"owner_id" json:"owner_id"`     // Foreign key referencing users(id)
+	ParentID  *int64    `db:"parent_id" json:"parent_id"`   // Foreign key referencing folders(id), NULL for the root
+	CreatedAt time.Time `db:"created_at" json:"created_at"` // Timestamp with time zone
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"` // Timestamp with time zone
+}
+
+// FolderContents lists the direct children of a folder
+type FolderContents struct {
+	Folder  *FolderRecord          `json:"folder"`
+	Folders []FolderRecord         `json:"folders"`
+	Secrets []secrets.SecretRecord `json:"secrets"`
+}
+
+// SharedFolderDetail is a folder shared with a user and the permission granted
+type SharedFolderDetail struct {
+	FolderRecord
+	Permission secrets.Permission `json:"permission"`
+}
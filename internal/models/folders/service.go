@@ -0,0 +1,363 @@
+package folders
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"pm4devs.strawhats/internal/envelope"
+	"pm4devs.strawhats/internal/models/core"
+	"pm4devs.strawhats/internal/models/secrets"
+	"pm4devs.strawhats/internal/xerrors"
+)
+
+// ============================================================================
+// Interface
+// ============================================================================
+
+// Defines a mockable interface for folder operations
+//
+// A parent or folder ID of 0 refers to the root of the owner's vault.
+type FoldersRepository interface {
+	NewRecord(name string, ownerID, parentID int64) (*FolderRecord, *xerrors.AppError)
+	GetByID(folderID int64) (*FolderRecord, *xerrors.AppError)
+	GetRootContents(ownerID int64) (*FolderContents, *xerrors.AppError)
+	GetContents(folderID int64) (*FolderContents, *xerrors.AppError)
+	Rename(folderID int64, name string) (*FolderRecord, *xerrors.AppError)
+	Move(folderID, parentID int64) *xerrors.AppError
+	Delete(folderID int64) *xerrors.AppError
+	MoveSecret(secretID, folderID int64) *xerrors.AppError
+	GetUserFolderPermission(userID, folderID int64) (secrets.Permission, *xerrors.AppError)
+	GetFoldersSharedWithUser(userID int64, page core.Page) (*[]SharedFolderDetail, string, *xerrors.AppError)
+	ShareToUser(folderID, userID int64, permission secrets.Permission) *xerrors.AppError
+	ShareToGroup(folderID, groupID int64, permission secrets.Permission) *xerrors.AppError
+	UpdateUserPermission(folderID, userID int64, permission secrets.Permission) *xerrors.AppError
+	UpdateGroupPermission(folderID, groupID int64, permission secrets.Permission) *xerrors.AppError
+	RevokeFromUser(folderID, userID int64) *xerrors.AppError
+	RevokeFromGroup(folderID, groupID int64) *xerrors.AppError
+}
+
+func Repository(db core.Queryable, envelope *envelope.Envelope) FoldersRepository {
+	return &Folders{DB: db, Envelope: envelope}
+}
+
+// ============================================================================
+// Implementation
+// ============================================================================
+
+// Provides access to the Folders database methods
+type Folders struct {
+	DB       core.Queryable
+	Envelope *envelope.Envelope // Decrypts the secrets listed in folders, encrypted at rest
+}
+
+// Creates a folder inside the given parent
+//
+// Check for xerrors.ErrUniqueViolation for name conflicts within the parent.
+func (f *Folders) NewRecord(name string, ownerID, parentID int64) (*FolderRecord, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		INSERT INTO folders (name, owner_id, parent_id)
+		VALUES ($1, $2, $3)
+		RETURNING id, name, owner_id, parent_id, created_at, updated_at;
+	`
+
+	var folder FolderRecord
+	err := f.DB.QueryRowContext(ctx, query, name, ownerID, core.NullableID(parentID)).Scan(
+		&folder.ID, &folder.Name, &folder.OwnerID, &folder.ParentID, &folder.CreatedAt, &folder.UpdatedAt,
+	)
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, "folders.NewRecord")
+	}
+
+	return &folder, nil
+}
+
+// Gets a folder by its ID
+func (f *Folders) GetByID(folderID int64) (*FolderRecord, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT id, name, owner_id, parent_id, created_at, updated_at
+		FROM folders
+		WHERE id = $1;
+	`
+
+	var folder FolderRecord
+	err := f.DB.QueryRowContext(ctx, query, folderID).Scan(
+		&folder.ID, &folder.Name, &folder.OwnerID, &folder.ParentID, &folder.CreatedAt, &folder.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, xerrors.ClientError(http.StatusNotFound,
+				fmt.Sprintf("No folder found with id: %d", folderID),
+				"folders.GetByID", fmt.Errorf("%w: %v", xerrors.ErrNotFound, err))
+		}
+		return nil, xerrors.DatabaseError(err, "folders.GetByID")
+	}
+
+	return &folder, nil
+}
+
+// Lists the folders and secrets at the root of a user's vault
+func (f *Folders) GetRootContents(ownerID int64) (*FolderContents, *xerrors.AppError) {
+	foldersQuery := `
+		SELECT id, name, owner_id, parent_id, created_at, updated_at
+		FROM folders
+		WHERE owner_id = $1 AND parent_id IS NULL
+		ORDER BY name;
+	`
+	secretsQuery := `
+		SELECT id, name, encrypted_data, iv, cipher, cipher_version, owner_id, folder_id, created_at, data_key, master_key_id
+		FROM secrets
+		WHERE owner_id = $1 AND folder_id IS NULL AND deleted_at IS NULL
+		ORDER BY name;
+	`
+
+	return f.getContents(nil, foldersQuery, secretsQuery, ownerID, "folders.GetRootContents")
+}
+
+// Lists the folders and secrets directly inside a folder
+func (f *Folders) GetContents(folderID int64) (*FolderContents, *xerrors.AppError) {
+	folder, err := f.GetByID(folderID)
+	if err != nil {
+		return nil, err
+	}
+
+	foldersQuery := `
+		SELECT id, name, owner_id, parent_id, created_at, updated_at
+		FROM folders
+		WHERE parent_id = $1
+		ORDER BY name;
+	`
+	secretsQuery := `
+		SELECT id, name, encrypted_data, iv, cipher, cipher_version, owner_id, folder_id, created_at, data_key, master_key_id
+		FROM secrets
+		WHERE folder_id = $1 AND deleted_at IS NULL
+		ORDER BY name;
+	`
+
+	return f.getContents(folder, foldersQuery, secretsQuery, folderID, "folders.GetContents")
+}
+
+// Renames a folder
+//
+// Check for xerrors.ErrUniqueViolation for name conflicts within the parent.
+func (f *Folders) Rename(folderID int64, name string) (*FolderRecord, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		UPDATE folders
+		SET name = $1, updated_at = NOW()
+		WHERE id = $2
+		RETURNING id, name, owner_id, parent_id, created_at, updated_at;
+	`
+
+	var folder FolderRecord
+	err := f.DB.QueryRowContext(ctx, query, name, folderID).Scan(
+		&folder.ID, &folder.Name, &folder.OwnerID, &folder.ParentID, &folder.CreatedAt, &folder.UpdatedAt,
+	)
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, "folders.Rename")
+	}
+
+	return &folder, nil
+}
+
+// Moves a folder into a new parent
+//
+// Returns a validation error if the new parent is the folder itself or one of
+// its descendants. The move runs at serializable isolation, so concurrent
+// moves that would nest two folders into each other can't both pass the check:
+// check for xerrors.ErrSerialization.
+func (f *Folders) Move(folderID, parentID int64) *xerrors.AppError {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Start a new transaction
+	db, ok := f.DB.(*sql.DB)
+	if !ok {
+		return xerrors.DatabaseError(fmt.Errorf("failed to cast DB to *sql.DB"), "folders.Move")
+	}
+
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return xerrors.DatabaseError(err, "folders.Move")
+	}
+	// Rollback is a no-op once the transaction is committed
+	defer tx.Rollback()
+
+	query := `
+		WITH RECURSIVE descendants AS (
+			SELECT id FROM folders WHERE id = $1
+			UNION ALL
+			SELECT folders.id FROM folders JOIN descendants ON folders.parent_id = descendants.id
+		)
+		UPDATE folders
+		SET parent_id = $2, updated_at = NOW()
+		WHERE id = $1 AND ($2::bigint IS NULL OR $2::bigint NOT IN (SELECT id FROM descendants));
+	`
+
+	result, err := tx.ExecContext(ctx, query, folderID, core.NullableID(parentID))
+	if err != nil {
+		return xerrors.DatabaseError(err, "folders.Move")
+	}
+
+	rowsAffected, appErr := core.RowsAffected(result, "folders.Move")
+	if appErr != nil {
+		return appErr
+	}
+
+	if rowsAffected == 0 {
+		return xerrors.ClientError(
+			http.StatusUnprocessableEntity,
+			map[string]string{"parent_id": "cannot be the folder itself or one of its subfolders"},
+			"folders.Move",
+			xerrors.ErrFailedValidation,
+		)
+	}
+
+	// Commit the transaction
+	if err = tx.Commit(); err != nil {
+		return xerrors.DatabaseError(err, "folders.Move: failed to commit transaction")
+	}
+
+	return nil
+}
+
+// Deletes a folder
+//
+// The subfolders and secrets inside the folder are moved up to its parent.
+func (f *Folders) Delete(folderID int64) *xerrors.AppError {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Start a new transaction
+	db, ok := f.DB.(*sql.DB)
+	if !ok {
+		return xerrors.DatabaseError(fmt.Errorf("failed to cast DB to *sql.DB"), "folders.Delete")
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return xerrors.DatabaseError(err, "folders.Delete")
+	}
+	// Rollback is a no-op once the transaction is committed
+	defer tx.Rollback()
+
+	var parentID sql.NullInt64
+	err = tx.QueryRowContext(ctx, `SELECT parent_id FROM folders WHERE id = $1 FOR UPDATE;`, folderID).Scan(&parentID)
+	if err != nil {
+		return xerrors.DatabaseError(err, "folders.Delete: failed to get folder")
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE secrets SET folder_id = $1 WHERE folder_id = $2;`, parentID, folderID)
+	if err != nil {
+		return xerrors.DatabaseError(err, "folders.Delete: failed to move secrets")
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE folders SET parent_id = $1, updated_at = NOW() WHERE parent_id = $2;`, parentID, folderID)
+	if err != nil {
+		return xerrors.DatabaseError(err, "folders.Delete: failed to move subfolders")
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM folders WHERE id = $1;`, folderID)
+	if err != nil {
+		return xerrors.DatabaseError(err, "folders.Delete: failed to delete folder")
+	}
+
+	// Commit the transaction
+	if err = tx.Commit(); err != nil {
+		return xerrors.DatabaseError(err, "folders.Delete: failed to commit transaction")
+	}
+
+	return nil
+}
+
+// Moves a secret into a folder
+func (f *Folders) MoveSecret(secretID, folderID int64) *xerrors.AppError {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		UPDATE secrets
+		SET folder_id = $1, updated_at = NOW(), version = version + 1
+		WHERE id = $2 AND deleted_at IS NULL;
+	`
+
+	_, err := f.DB.ExecContext(ctx, query, core.NullableID(folderID), secretID)
+	if err != nil {
+		return xerrors.DatabaseError(err, "folders.MoveSecret")
+	}
+
+	return nil
+}
+
+// ============================================================================
+// Helpers
+// ============================================================================
+
+// Runs the given folder and secret queries to build the contents of a folder
+func (f *Folders) getContents(folder *FolderRecord, foldersQuery, secretsQuery string, id int64, op string) (*FolderContents, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	contents := FolderContents{
+		Folder:  folder,
+		Folders: []FolderRecord{},
+		Secrets: []secrets.SecretRecord{},
+	}
+
+	// Subfolders
+	rows, err := f.DB.QueryContext(ctx, foldersQuery, id)
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, op)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var folder FolderRecord
+		if err := rows.Scan(&folder.ID, &folder.Name, &folder.OwnerID, &folder.ParentID,
+			&folder.CreatedAt, &folder.UpdatedAt); err != nil {
+			return nil, xerrors.DatabaseError(err, op+" - scan folder")
+		}
+		contents.Folders = append(contents.Folders, folder)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, xerrors.DatabaseError(err, op+" - folders rows error")
+	}
+
+	// Secrets
+	secretRows, err := f.DB.QueryContext(ctx, secretsQuery, id)
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, op)
+	}
+	defer secretRows.Close()
+
+	for secretRows.Next() {
+		var secret secrets.SecretRecord
+		var key envelope.Key
+		if err := secretRows.Scan(&secret.ID, &secret.Name, &secret.EncryptedData, &secret.IV,
+			&secret.Cipher, &secret.CipherVersion, &secret.OwnerID, &secret.FolderID, &secret.CreatedAt,
+			&key.Wrapped, &key.MasterKeyID); err != nil {
+			return nil, xerrors.DatabaseError(err, op+" - scan secret")
+		}
+		if err := f.Envelope.Open(key, secrets.Binding(secret.ID), &secret.EncryptedData, &secret.IV); err != nil {
+			return nil, xerrors.ServerError(op+" - decrypt secret", err)
+		}
+		contents.Secrets = append(contents.Secrets, secret)
+	}
+
+	if err := secretRows.Err(); err != nil {
+		return nil, xerrors.DatabaseError(err, op+" - secrets rows error")
+	}
+
+	return &contents, nil
+}
@@ -0,0 +1,247 @@
+package folders
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"pm4devs.strawhats/internal/models/core"
+	"pm4devs.strawhats/internal/models/secrets"
+	"pm4devs.strawhats/internal/xerrors"
+)
+
+func (f *Folders) ShareToUser(folderID, userID int64, permission secrets.Permission) *xerrors.AppError {
+	// Context with a timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// SQL query to share a folder with a user
+	query := `
+		INSERT INTO shared_folders_user (folder_id, user_id, permission, created_at, updated_at)
+		VALUES ($1, $2, $3, NOW(), NOW())
+		ON CONFLICT (folder_id, user_id) DO NOTHING;
+	`
+
+	// Execute the query
+	_, err := f.DB.ExecContext(ctx, query, folderID, userID, permission)
+	if err != nil {
+		return xerrors.DatabaseError(err, "folders.ShareToUser")
+	}
+
+	return nil
+}
+
+func (f *Folders) ShareToGroup(folderID, groupID int64, permission secrets.Permission) *xerrors.AppError {
+	// Context with a timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// SQL query to share a folder with a group
+	query := `
+		INSERT INTO shared_folders_group (folder_id, group_id, permission, created_at, updated_at)
+		VALUES ($1, $2, $3, NOW(), NOW())
+		ON CONFLICT (folder_id, group_id) DO NOTHING;
+	`
+
+	// Execute the query
+	_, err := f.DB.ExecContext(ctx, query, folderID, groupID, permission)
+	if err != nil {
+		return xerrors.DatabaseError(err, "folders.ShareToGroup")
+	}
+
+	return nil
+}
+
+func (f *Folders) UpdateUserPermission(folderID, userID int64, permission secrets.Permission) *xerrors.AppError {
+	// Context with a timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// SQL query to update the permission for a folder shared with a user
+	query := `
+		UPDATE shared_folders_user
+		SET permission = $1, updated_at = NOW()
+		WHERE folder_id = $2 AND user_id = $3;
+	`
+
+	// Execute the update query
+	_, err := f.DB.ExecContext(ctx, query, permission, folderID, userID)
+	if err != nil {
+		return xerrors.DatabaseError(err, "folders.UpdateUserPermission")
+	}
+
+	return nil
+}
+
+func (f *Folders) UpdateGroupPermission(folderID, groupID int64, permission secrets.Permission) *xerrors.AppError {
+	// Context with a timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// SQL query to update the permission for a folder shared with a group
+	query := `
+		UPDATE shared_folders_group
+		SET permission = $1, updated_at = NOW()
+		WHERE folder_id = $2 AND group_id = $3;
+	`
+
+	// Execute the update query
+	_, err := f.DB.ExecContext(ctx, query, permission, folderID, groupID)
+	if err != nil {
+		return xerrors.DatabaseError(err, "folders.UpdateGroupPermission")
+	}
+
+	return nil
+}
+
+func (f *Folders) RevokeFromUser(folderID, userID int64) *xerrors.AppError {
+	// Context with a timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// SQL query to stop sharing a folder with a user
+	query := `
+		DELETE FROM shared_folders_user
+		WHERE folder_id = $1 AND user_id = $2;
+	`
+
+	// Execute the delete query
+	_, err := f.DB.ExecContext(ctx, query, folderID, userID)
+	if err != nil {
+		return xerrors.DatabaseError(err, "folders.RevokeFromUser")
+	}
+
+	return nil
+}
+
+func (f *Folders) RevokeFromGroup(folderID, groupID int64) *xerrors.AppError {
+	// Context with a timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// SQL query to stop sharing a folder with a group
+	query := `
+		DELETE FROM shared_folders_group
+		WHERE folder_id = $1 AND group_id = $2;
+	`
+
+	// Execute the delete query
+	_, err := f.DB.ExecContext(ctx, query, folderID, groupID)
+	if err != nil {
+		return xerrors.DatabaseError(err, "folders.RevokeFromGroup")
+	}
+
+	return nil
+}
+
+// GetUserFolderPermission retrieves the permission of a user for a given folder
+//
+// Shares on a folder apply to everything nested inside it, so the folder's
+// ancestors are checked as well. The strongest permission wins.
+func (f *Folders) GetUserFolderPermission(userID, folderID int64) (secrets.Permission, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if folder, err := f.GetByID(folderID); err != nil {
+		return secrets.NOTALLOWED, err
+	} else if folder.OwnerID == userID {
+		return secrets.ReadWrite, nil
+	}
+
+	query := `
+		WITH RECURSIVE ancestors AS (
+			SELECT id, parent_id FROM folders WHERE id = $1
+			UNION ALL
+			SELECT folders.id, folders.parent_id FROM folders JOIN ancestors ON folders.id = ancestors.parent_id
+		)
+		SELECT permission FROM (
+			SELECT sfu.permission
+			FROM shared_folders_user sfu
+			WHERE sfu.folder_id IN (SELECT id FROM ancestors) AND sfu.user_id = $2
+			UNION ALL
+			SELECT sfg.permission
+			FROM shared_folders_group sfg
+			JOIN group_members gm ON gm.group_id = sfg.group_id
+			JOIN groups g ON g.id = sfg.group_id
+			WHERE sfg.folder_id IN (SELECT id FROM ancestors) AND gm.user_id = $2 AND g.deleted_at IS NULL
+		) AS grants
+		ORDER BY permission DESC
+		LIMIT 1;
+	`
+
+	var permission secrets.Permission
+	err := f.DB.QueryRowContext(ctx, query, folderID, userID).Scan(&permission)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return secrets.NOTALLOWED, nil
+		}
+		return secrets.NOTALLOWED, xerrors.DatabaseError(err, "folders.GetUserFolderPermission")
+	}
+
+	return permission, nil
+}
+
+// Folders listed by GetFoldersSharedWithUser, one row per folder
+var sharedListing = core.Listing{
+	Sorts: map[string]string{
+		"name":       "f.name",
+		"created_at": "f.created_at",
+		"updated_at": "f.updated_at",
+	},
+	Keys: []string{"f.id"},
+}
+
+// Lists the folders shared directly with a user or one of their groups
+func (f *Folders) GetFoldersSharedWithUser(userID int64, page core.Page) (*[]SharedFolderDetail, string, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	pager, appErr := sharedListing.Pager(page, "folders.GetFoldersSharedWithUser")
+	if appErr != nil {
+		return nil, "", appErr
+	}
+
+	cursor, args := pager.Where([]any{userID})
+	query := `
+		SELECT f.id, f.name, f.owner_id, f.parent_id, f.created_at, f.updated_at, MAX(grants.permission)` + pager.Columns() + `
+		FROM folders f
+		JOIN (
+			SELECT folder_id, permission
+			FROM shared_folders_user
+			WHERE user_id = $1
+			UNION ALL
+			SELECT sfg.folder_id, sfg.permission
+			FROM shared_folders_group sfg
+			JOIN group_members gm ON gm.group_id = sfg.group_id
+			JOIN groups g ON g.id = sfg.group_id
+			WHERE gm.user_id = $1 AND g.deleted_at IS NULL
+		) AS grants ON grants.folder_id = f.id` + cursor + `
+		GROUP BY f.id` + pager.OrderBy() + `;
+	`
+
+	rows, err := f.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, "", xerrors.DatabaseError(err, "folders.GetFoldersSharedWithUser")
+	}
+	defer rows.Close()
+
+	folders := []SharedFolderDetail{}
+	for rows.Next() {
+		var folder SharedFolderDetail
+		dest := append([]any{&folder.ID, &folder.Name, &folder.OwnerID, &folder.ParentID,
+			&folder.CreatedAt, &folder.UpdatedAt, &folder.Permission}, pager.Dest()...)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, "", xerrors.DatabaseError(err, "folders.GetFoldersSharedWithUser - scan")
+		}
+		if !pager.Keep() {
+			break
+		}
+		folders = append(folders, folder)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, "", xerrors.DatabaseError(err, "folders.GetFoldersSharedWithUser - rows error")
+	}
+
+	return &folders, pager.Next(), nil
+}
@@ -4,24 +4,40 @@ import (
 	"context"
 	"time"
 
+	"pm4devs.strawhats/internal/models/core"
 	"pm4devs.strawhats/internal/xerrors"
 )
 
-func (g *Group) GetGroupsByUserID(userID int64) ([]GroupRecord, *xerrors.AppError) {
+// Groups listed by GetGroupsByUserID, one row per group
+var groupListing = core.Listing{
+	Sorts: map[string]string{
+		"name":       "gr.name",
+		"created_at": "gr.created_at",
+	},
+	Keys: []string{"gr.id"},
+}
+
+func (g *Group) GetGroupsByUserID(userID int64, page core.Page) ([]GroupRecord, string, *xerrors.AppError) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
+	pager, appErr := groupListing.Pager(page, "group.GetGroupsByUserID")
+	if appErr != nil {
+		return nil, "", appErr
+	}
+
 	// Query to get groups the user is part of
+	cursor, args := pager.Where([]any{userID})
 	queryGroups := `
-		SELECT gr.id, gr.name, gr.creator_id, gr.created_at
+		SELECT gr.id, gr.name, gr.creator_id, gr.created_at, gr.version` + pager.Columns() + `
 		FROM groups gr
 		JOIN group_members gm ON gm.group_id = gr.id
-		WHERE gm.user_id = $1;
+		WHERE gm.user_id = $1 AND gr.deleted_at IS NULL` + cursor + pager.OrderBy() + `;
 	`
 
-	rows, err := g.DB.QueryContext(ctx, queryGroups, userID)
+	rows, err := g.DB.QueryContext(ctx, queryGroups, args...)
 	if err != nil {
-		return nil, xerrors.DatabaseError(err, "group.GetGroupsByUserID")
+		return nil, "", xerrors.DatabaseError(err, "group.GetGroupsByUserID")
 	}
 	defer rows.Close()
 
@@ -29,15 +45,19 @@ func (g *Group) GetGroupsByUserID(userID int64) ([]GroupRecord, *xerrors.AppErro
 
 	for rows.Next() {
 		var group GroupRecord
-		if err := rows.Scan(&group.ID, &group.Name, &group.CreatorID, &group.CreatedAt); err != nil {
-			return nil, xerrors.DatabaseError(err, "group.GetGroupsByUserID")
+		dest := append([]any{&group.ID, &group.Name, &group.CreatorID, &group.CreatedAt, &group.Version}, pager.Dest()...)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, "", xerrors.DatabaseError(err, "group.GetGroupsByUserID")
+		}
+		if !pager.Keep() {
+			break
 		}
 		groups = append(groups, group)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, xerrors.DatabaseError(err, "group.GetGroupsByUserID")
+		return nil, "", xerrors.DatabaseError(err, "group.GetGroupsByUserID")
 	}
 
-	return groups, nil
+	return groups, pager.Next(), nil
 }
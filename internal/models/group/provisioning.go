@@ -0,0 +1,263 @@
+package group
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"pm4devs.strawhats/internal/models/users"
+	"pm4devs.strawhats/internal/xerrors"
+)
+
+// ============================================================================
+// Types
+// ============================================================================
+
+// GroupFilter narrows down group listings. Zero values are ignored.
+type GroupFilter struct {
+	ID   int64  // Unique identifier, negative to match no group
+	Name string // Group name
+}
+
+// Builds the SQL conditions for the filter against the groups table aliased
+// as g. Placeholders continue from the args already given.
+func (f GroupFilter) where(args []any) (string, []any) {
+	var conditions []string
+	add := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if f.ID != 0 {
+		add("g.id = $%d", f.ID)
+	}
+	if f.Name != "" {
+		add("g.name = $%d", f.Name)
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return " AND " + strings.Join(conditions, " AND "), args
+}
+
+// ============================================================================
+// Provisioning
+// ============================================================================
+
+// Lists the groups bound to the identity provider matching a filter with
+// their members, along with how many match in total
+//
+// Groups created by hand are left out, unless an admin bound them to the
+// provider. Service accounts are left out of the members, the identity
+// provider doesn't know them.
+func (g *Group) GetAll(filter GroupFilter, offset, limit int) (*[]GroupRecordWithUsers, int, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	where, args := filter.where(nil)
+
+	var total int
+	query := `SELECT COUNT(*) FROM groups g WHERE g.deleted_at IS NULL AND g.idp_managed` + where
+	if err := g.DB.QueryRowContext(ctx, query, args...).Scan(&total); err != nil {
+		return nil, 0, xerrors.DatabaseError(err, "group.GetAll: failed to count groups")
+	}
+
+	args = append(args, offset, limit)
+	query = fmt.Sprintf(`
+		SELECT g.id, g.name, g.creator_id, g.created_at, g.version
+		FROM groups g
+		WHERE g.deleted_at IS NULL AND g.idp_managed%s
+		ORDER BY g.id
+		OFFSET $%d LIMIT $%d
+	`, where, len(args)-1, len(args))
+
+	rows, err := g.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, xerrors.DatabaseError(err, "group.GetAll")
+	}
+	defer rows.Close()
+
+	result := []GroupRecordWithUsers{}
+	byID := map[int64]int{}
+	var ids []int64
+	for rows.Next() {
+		var group GroupRecordWithUsers
+		dest := []any{&group.ID, &group.Name, &group.CreatorID, &group.CreatedAt, &group.Version}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, 0, xerrors.DatabaseError(err, "group.GetAll")
+		}
+		byID[group.ID] = len(result)
+		ids = append(ids, group.ID)
+		result = append(result, group)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, xerrors.DatabaseError(err, "group.GetAll")
+	}
+	if len(ids) == 0 {
+		return &result, total, nil
+	}
+
+	query = `
+		SELECT gm.group_id, u.id, u.email
+		FROM group_members gm
+		INNER JOIN users u ON u.id = gm.user_id
+		WHERE gm.group_id = ANY($1) AND u.owner_group_id IS NULL
+		ORDER BY u.id;
+	`
+	members, err := g.DB.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, 0, xerrors.DatabaseError(err, "group.GetAll: failed to get members")
+	}
+	defer members.Close()
+
+	for members.Next() {
+		var groupID int64
+		var user users.UserRecord
+		if err := members.Scan(&groupID, &user.ID, &user.Email); err != nil {
+			return nil, 0, xerrors.DatabaseError(err, "group.GetAll: failed to get members")
+		}
+		group := &result[byID[groupID]]
+		group.Users = append(group.Users, &user)
+	}
+	if err := members.Err(); err != nil {
+		return nil, 0, xerrors.DatabaseError(err, "group.GetAll: failed to get members")
+	}
+
+	return &result, total, nil
+}
+
+// Creates a group pushed by the identity provider with the given members,
+// bound to the provider
+//
+// Unlike NewRecord, the creator, who set up provisioning, doesn't become a
+// member. Unknown users and service accounts are skipped.
+func (g *Group) InsertProvisioned(name string, creatorID int64, memberIDs []int64) (*GroupRecord, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	db, ok := g.DB.(*sql.DB)
+	if !ok {
+		return nil, xerrors.DatabaseError(fmt.Errorf("failed to cast DB to *sql.DB"), "group.InsertProvisioned")
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, "group.InsertProvisioned")
+	}
+	// Rollback is a no-op once the transaction is committed
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO groups (name, creator_id, created_at, idp_managed)
+		VALUES ($1, $2, NOW(), true)
+		RETURNING id, name, creator_id, created_at, version;
+	`
+	var group GroupRecord
+	dest := []any{&group.ID, &group.Name, &group.CreatorID, &group.CreatedAt, &group.Version}
+	if err = tx.QueryRowContext(ctx, query, name, creatorID).Scan(dest...); err != nil {
+		return nil, xerrors.DatabaseError(err, "group.InsertProvisioned: failed to create group")
+	}
+
+	query = `
+		INSERT INTO group_members (group_id, user_id)
+		SELECT $1, id FROM users WHERE id = ANY($2) AND owner_group_id IS NULL;
+	`
+	if _, err = tx.ExecContext(ctx, query, group.ID, pq.Array(memberIDs)); err != nil {
+		return nil, xerrors.DatabaseError(err, "group.InsertProvisioned: failed to add members")
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, xerrors.DatabaseError(err, "group.InsertProvisioned: failed to commit transaction")
+	}
+
+	return &group, nil
+}
+
+// Renames a group pushed by the identity provider and replaces its members,
+// using optimistic locking
+//
+// Removed members lose the wrapped keys of the group and its secrets are
+// flagged for re-keying, as with RemoveUser. Service accounts are left in
+// place and unknown users are skipped.
+//
+// Returns xerrors.ErrEditConflict if the group changed since it was read, or
+// is no longer bound to the provider.
+func (g *Group) UpdateProvisioned(groupID int64, name string, memberIDs []int64, version int) (*GroupRecord, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	db, ok := g.DB.(*sql.DB)
+	if !ok {
+		return nil, xerrors.DatabaseError(fmt.Errorf("failed to cast DB to *sql.DB"), "group.UpdateProvisioned")
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, "group.UpdateProvisioned")
+	}
+	// Rollback is a no-op once the transaction is committed
+	defer tx.Rollback()
+
+	// A NULL array would match no member to remove
+	if memberIDs == nil {
+		memberIDs = []int64{}
+	}
+
+	query := `
+		UPDATE groups
+		SET name = $1, updated_at = NOW(), version = version + 1
+		WHERE id = $2 AND version = $3 AND deleted_at IS NULL AND idp_managed
+		RETURNING id, name, creator_id, created_at, version;
+	`
+	var group GroupRecord
+	dest := []any{&group.ID, &group.Name, &group.CreatorID, &group.CreatedAt, &group.Version}
+	err = tx.QueryRowContext(ctx, query, name, groupID, version).Scan(dest...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, xerrors.ClientError(http.StatusConflict,
+			fmt.Sprintf("Group %d was changed by another request, fetch it again and retry", groupID),
+			"group.UpdateProvisioned", xerrors.ErrEditConflict)
+	}
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, "group.UpdateProvisioned")
+	}
+
+	query = `
+		INSERT INTO group_members (group_id, user_id)
+		SELECT $1, id FROM users WHERE id = ANY($2) AND owner_group_id IS NULL
+		ON CONFLICT (group_id, user_id) DO NOTHING;
+	`
+	if _, err = tx.ExecContext(ctx, query, groupID, pq.Array(memberIDs)); err != nil {
+		return nil, xerrors.DatabaseError(err, "group.UpdateProvisioned: failed to add members")
+	}
+
+	query = `
+		WITH member AS (
+			DELETE FROM group_members
+			WHERE group_id = $1 AND NOT (user_id = ANY($2))
+				AND user_id IN (SELECT id FROM users WHERE owner_group_id IS NULL)
+			RETURNING user_id
+		), wrapped_keys AS (
+			DELETE FROM shared_secrets_group_keys
+			WHERE group_id = $1 AND user_id IN (SELECT user_id FROM member)
+		)
+		-- Removed members may still hold the content keys of the group's secrets
+		UPDATE secrets SET rekey_required = true
+		WHERE id IN (SELECT secret_id FROM shared_secrets_group WHERE group_id = $1)
+			AND EXISTS (SELECT 1 FROM member);
+	`
+	if _, err = tx.ExecContext(ctx, query, groupID, pq.Array(memberIDs)); err != nil {
+		return nil, xerrors.DatabaseError(err, "group.UpdateProvisioned: failed to remove members")
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, xerrors.DatabaseError(err, "group.UpdateProvisioned: failed to commit transaction")
+	}
+
+	return &group, nil
+}
@@ -7,7 +7,9 @@ import (
 	"net/http"
 	"time"
 
+	"pm4devs.strawhats/internal/envelope"
 	"pm4devs.strawhats/internal/models/core"
+	"pm4devs.strawhats/internal/models/secrets"
 	"pm4devs.strawhats/internal/models/users"
 	"pm4devs.strawhats/internal/xerrors"
 )
@@ -16,17 +18,25 @@ type GroupRepository interface {
 	GetByGroupID(id int64) (*GroupRecordWithUsers, *xerrors.AppError)
 	GetGroupUsers(name string) (*GroupRecordWithUsers, *xerrors.AppError)
 	GetGroupSharedSecrets(name string) (*GroupRecordWithSecrets, *xerrors.AppError)
-	UpdateGroupName(newName string, groupName string) (*GroupRecord, *xerrors.AppError)
-	DeleteByGroupID(groupID int64) *xerrors.AppError
+	UpdateGroupName(newName string, groupName string, version int) (*GroupRecord, *xerrors.AppError)
+	DeleteByGroupID(groupID int64, version int) *xerrors.AppError
 	NewRecord(name string, ownerID int64) (*GroupRecord, *xerrors.AppError)
 	AddUser(groupId, userId int64) *xerrors.AppError
 	RemoveUser(groupId, userId int64) *xerrors.AppError
-	GetGroupsByUserID(userID int64) ([]GroupRecord, *xerrors.AppError)
+	GetGroupsByUserID(userID int64, page core.Page) ([]GroupRecord, string, *xerrors.AppError)
+	GetAll(filter GroupFilter, offset, limit int) (*[]GroupRecordWithUsers, int, *xerrors.AppError)
+	InsertProvisioned(name string, creatorID int64, memberIDs []int64) (*GroupRecord, *xerrors.AppError)
+	UpdateProvisioned(groupID int64, name string, memberIDs []int64, version int) (*GroupRecord, *xerrors.AppError)
 	IsUserInGroup(groupID, userID int64) (bool, *xerrors.AppError)
+	GetDeletedByCreatorID(userID int64, page core.Page) ([]GroupRecord, string, *xerrors.AppError)
+	Restore(groupID, creatorID int64) *xerrors.AppError
+	Purge(groupID, creatorID int64) *xerrors.AppError
+	PurgeDeletedBefore(cutoff time.Time) (int64, *xerrors.AppError)
 }
 
 type Group struct {
-	DB core.Queryable
+	DB       core.Queryable
+	Envelope *envelope.Envelope // Decrypts the secrets shared with groups, encrypted at rest
 }
 
 type GroupRecordWithUsers struct {
@@ -34,8 +44,8 @@ type GroupRecordWithUsers struct {
 	Users []*users.UserRecord
 }
 
-func Repository(db core.Queryable) GroupRepository {
-	return &Group{DB: db}
+func Repository(db core.Queryable, envelope *envelope.Envelope) GroupRepository {
+	return &Group{DB: db, Envelope: envelope}
 }
 
 func (g *Group) NewRecord(name string, ownerID int64) (*GroupRecord, *xerrors.AppError) {
@@ -63,11 +73,11 @@ func (g *Group) NewRecord(name string, ownerID int64) (*GroupRecord, *xerrors.Ap
 	query := `
 		INSERT INTO groups (name, creator_id, created_at)
 		VALUES ($1, $2, NOW())
-		RETURNING id, name, creator_id, created_at;
+		RETURNING id, name, creator_id, created_at, version;
 	`
 	var newGroup GroupRecord
 	err = tx.QueryRowContext(ctx, query, name, ownerID).
-		Scan(&newGroup.ID, &newGroup.Name, &newGroup.CreatorID, &newGroup.CreatedAt)
+		Scan(&newGroup.ID, &newGroup.Name, &newGroup.CreatorID, &newGroup.CreatedAt, &newGroup.Version)
 	if err != nil {
 		return nil, xerrors.DatabaseError(err, "group.NewRecord: failed to create group")
 	}
@@ -97,13 +107,13 @@ func (g *Group) GetByGroupID(id int64) (*GroupRecordWithUsers, *xerrors.AppError
 
 	// First query to get the group details
 	queryGroup := `
-		SELECT id, name, creator_id, created_at
+		SELECT id, name, creator_id, created_at, version
 		FROM groups
-		WHERE id = $1;
+		WHERE id = $1 AND deleted_at IS NULL;
 	`
 
 	var group GroupRecordWithUsers
-	err := g.DB.QueryRowContext(ctx, queryGroup, id).Scan(&group.ID, &group.Name, &group.CreatorID, &group.CreatedAt)
+	err := g.DB.QueryRowContext(ctx, queryGroup, id).Scan(&group.ID, &group.Name, &group.CreatorID, &group.CreatedAt, &group.Version)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, xerrors.DatabaseError(err, "group.GetByGroupID")
@@ -146,13 +156,13 @@ func (g *Group) GetGroupUsers(name string) (*GroupRecordWithUsers, *xerrors.AppE
 
 	// First query to get the group details
 	queryGroup := `
-		SELECT id, name, creator_id, created_at
+		SELECT id, name, creator_id, created_at, version
 		FROM groups
-		WHERE name = $1;
+		WHERE name = $1 AND deleted_at IS NULL;
 	`
 
 	var group GroupRecordWithUsers
-	err := g.DB.QueryRowContext(ctx, queryGroup, name).Scan(&group.ID, &group.Name, &group.CreatorID, &group.CreatedAt)
+	err := g.DB.QueryRowContext(ctx, queryGroup, name).Scan(&group.ID, &group.Name, &group.CreatorID, &group.CreatedAt, &group.Version)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, xerrors.DatabaseError(err, "group.GetByGroupID")
@@ -194,10 +204,13 @@ type SharedSecretDetailForGroup struct {
 	Name          string    `json:"name"`
 	EncryptedData []byte    `json:"encrypted_data"`
 	IV            []byte    `json:"iv"`
+	Cipher        string    `json:"cipher"`
+	CipherVersion int       `json:"cipher_version"`
 	OwnerID       int64     `json:"owner_id"`
 	Permission    string    `json:"permission"`
 	CreatedAt     time.Time `json:"created_at"`
 	UpdatedAt     time.Time `json:"updated_at"`
+	Version       int       `json:"version"`
 }
 
 type GroupRecordWithSecrets struct {
@@ -217,7 +230,7 @@ func (g *Group) GetGroupSharedSecrets(name string) (*GroupRecordWithSecrets, *xe
 	queryGroup := `
         SELECT id, name, creator_id, created_at
         FROM groups
-        WHERE name = $1;
+        WHERE name = $1 AND deleted_at IS NULL;
     `
 
 	var group GroupRecordWithSecrets
@@ -231,10 +244,13 @@ func (g *Group) GetGroupSharedSecrets(name string) (*GroupRecordWithSecrets, *xe
 
 	// Second query to get secrets shared with the group
 	querySecrets := `
-        SELECT s.id AS secret_id, s.name, s.encrypted_data, s.iv, s.owner_id, ssg.permission, s.created_at, s.updated_at
+        SELECT s.id AS secret_id, s.name, s.encrypted_data, s.iv, s.cipher, s.cipher_version, s.owner_id, ssg.permission, s.created_at, s.updated_at, s.version,
+            s.data_key, s.master_key_id
         FROM secrets s
         JOIN shared_secrets_group ssg ON ssg.secret_id = s.id
-        WHERE ssg.group_id = $1;
+        WHERE ssg.group_id = $1 AND s.deleted_at IS NULL
+            AND (ssg.expires_at IS NULL OR ssg.expires_at > NOW())
+        ORDER BY s.id;
     `
 
 	rows, err := g.DB.QueryContext(ctx, querySecrets, group.GroupID)
@@ -245,9 +261,14 @@ func (g *Group) GetGroupSharedSecrets(name string) (*GroupRecordWithSecrets, *xe
 
 	for rows.Next() {
 		var secret SharedSecretDetailForGroup
-		if err := rows.Scan(&secret.SecretID, &secret.Name, &secret.EncryptedData, &secret.IV, &secret.OwnerID, &secret.Permission, &secret.CreatedAt, &secret.UpdatedAt); err != nil {
+		var key envelope.Key
+		if err := rows.Scan(&secret.SecretID, &secret.Name, &secret.EncryptedData, &secret.IV, &secret.Cipher, &secret.CipherVersion, &secret.OwnerID, &secret.Permission, &secret.CreatedAt, &secret.UpdatedAt, &secret.Version,
+			&key.Wrapped, &key.MasterKeyID); err != nil {
 			return nil, xerrors.DatabaseError(err, "group.GetGroupSharedSecrets - scan secret")
 		}
+		if err := g.Envelope.Open(key, secrets.Binding(secret.SecretID), &secret.EncryptedData, &secret.IV); err != nil {
+			return nil, xerrors.ServerError("group.GetGroupSharedSecrets - decrypt secret", err)
+		}
 		group.Secrets = append(group.Secrets, &secret)
 	}
 
@@ -258,37 +279,62 @@ func (g *Group) GetGroupSharedSecrets(name string) (*GroupRecordWithSecrets, *xe
 	return &group, nil
 }
 
-func (g *Group) UpdateGroupName(newName string, groupName string) (*GroupRecord, *xerrors.AppError) {
+// Renames a group using optimistic locking.
+//
+// Returns xerrors.ErrEditConflict if the group changed since it was read.
+func (g *Group) UpdateGroupName(newName string, groupName string, version int) (*GroupRecord, *xerrors.AppError) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
 	query := `
 		UPDATE groups
-		SET name = $1
-		WHERE name = $2
-		RETURNING id, name, creator_id, created_at;
+		SET name = $1, updated_at = NOW(), version = version + 1
+		WHERE name = $2 AND version = $3 AND deleted_at IS NULL
+		RETURNING id, name, creator_id, created_at, version;
 	`
 
 	var updatedGroup GroupRecord
-	err := g.DB.QueryRowContext(ctx, query, newName, groupName).
-		Scan(&updatedGroup.ID, &updatedGroup.Name, &updatedGroup.CreatorID, &updatedGroup.CreatedAt)
+	err := g.DB.QueryRowContext(ctx, query, newName, groupName, version).
+		Scan(&updatedGroup.ID, &updatedGroup.Name, &updatedGroup.CreatorID, &updatedGroup.CreatedAt, &updatedGroup.Version)
 	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, xerrors.ClientError(
+				http.StatusConflict,
+				fmt.Sprintf("Group %s was changed by another request, fetch it again and retry", groupName),
+				"group.UpdateByGroupID",
+				xerrors.ErrEditConflict,
+			)
+		}
 		return nil, xerrors.DatabaseError(err, "group.UpdateByGroupID")
 	}
 
 	return &updatedGroup, nil
 }
 
-func (g *Group) DeleteByGroupID(groupID int64) *xerrors.AppError {
+// Moves a group to the trash, at the version it was read at
+//
+// Members and secrets shared to the group are kept so it can be restored.
+// Returns xerrors.ErrEditConflict if the group changed since it was read.
+func (g *Group) DeleteByGroupID(groupID int64, version int) *xerrors.AppError {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	query := `DELETE FROM groups WHERE id = $1;`
+	query := `UPDATE groups SET deleted_at = NOW() WHERE id = $1 AND version = $2 AND deleted_at IS NULL;`
 
-	_, err := g.DB.ExecContext(ctx, query, groupID)
+	result, err := g.DB.ExecContext(ctx, query, groupID, version)
 	if err != nil {
 		return xerrors.DatabaseError(err, "group.DeleteByGroupID")
 	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return xerrors.DatabaseError(err, "group.DeleteByGroupID")
+	} else if rows == 0 {
+		return xerrors.ClientError(
+			http.StatusConflict,
+			fmt.Sprintf("Group with id %d was changed by another request, fetch it again and retry", groupID),
+			"group.DeleteByGroupID",
+			xerrors.ErrEditConflict,
+		)
+	}
 
 	return nil
 }
@@ -300,9 +346,13 @@ func (g *Group) AddUser(groupId, userId int64) *xerrors.AppError {
 
 	// Prepare the SQL query to insert a new user into the group_members table
 	query := `
-		INSERT INTO group_members (group_id, user_id)
-		VALUES ($1, $2)
-		ON CONFLICT (group_id, user_id) DO NOTHING;  -- Prevents duplicate entries
+		WITH member AS (
+			INSERT INTO group_members (group_id, user_id)
+			VALUES ($1, $2)
+			ON CONFLICT (group_id, user_id) DO NOTHING  -- Prevents duplicate entries
+			RETURNING group_id
+		)
+		UPDATE groups SET version = version + 1 WHERE id IN (SELECT group_id FROM member);
 	`
 
 	_, err := g.DB.ExecContext(ctx, query, groupId, userId)
@@ -319,8 +369,19 @@ func (g *Group) RemoveUser(groupId, userId int64) *xerrors.AppError {
 
 	// Prepare the SQL query to remove a user from the group_members table
 	query := `
-		DELETE FROM group_members
-		WHERE group_id = $1 AND user_id = $2;
+		WITH member AS (
+			DELETE FROM group_members
+			WHERE group_id = $1 AND user_id = $2
+			RETURNING group_id
+		), wrapped_keys AS (
+			DELETE FROM shared_secrets_group_keys
+			WHERE group_id IN (SELECT group_id FROM member) AND user_id = $2
+		), rekeyed AS (
+			-- The member may still hold the content keys of the group's secrets
+			UPDATE secrets SET rekey_required = true
+			WHERE id IN (SELECT secret_id FROM shared_secrets_group WHERE group_id IN (SELECT group_id FROM member))
+		)
+		UPDATE groups SET version = version + 1 WHERE id IN (SELECT group_id FROM member);
 	`
 
 	result, err := g.DB.ExecContext(ctx, query, groupId, userId)
@@ -354,7 +415,7 @@ func (g *Group) IsUserInGroup(groupID, userID int64) (bool, *xerrors.AppError) {
 	query := `
 		SELECT 1
 		FROM groups
-		WHERE id = $1 AND (creator_id = $2 OR EXISTS (
+		WHERE id = $1 AND deleted_at IS NULL AND (creator_id = $2 OR EXISTS (
 			SELECT 1 
 			FROM group_members 
 			WHERE group_id = $1 AND user_id = $2
@@ -0,0 +1,144 @@
+package group
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"pm4devs.strawhats/internal/models/core"
+	"pm4devs.strawhats/internal/xerrors"
+)
+
+// Groups listed by GetDeletedByCreatorID, one row per group
+var trashListing = core.Listing{
+	Sorts: map[string]string{
+		"name":       "gr.name",
+		"created_at": "gr.created_at",
+		"deleted_at": "gr.deleted_at",
+	},
+	Keys: []string{"gr.id"},
+}
+
+// GetDeletedByCreatorID lists the groups a user created that are in the trash,
+// most recently deleted first unless the page asks for another sort
+func (g *Group) GetDeletedByCreatorID(userID int64, page core.Page) ([]GroupRecord, string, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if page.Sort == "" {
+		page.Sort, page.Desc = "deleted_at", true
+	}
+	pager, appErr := trashListing.Pager(page, "group.GetDeletedByCreatorID")
+	if appErr != nil {
+		return nil, "", appErr
+	}
+
+	cursor, args := pager.Where([]any{userID})
+	query := `
+		SELECT gr.id, gr.name, gr.creator_id, gr.created_at, gr.deleted_at` + pager.Columns() + `
+		FROM groups gr
+		WHERE gr.creator_id = $1 AND gr.deleted_at IS NOT NULL` + cursor + pager.OrderBy() + `;
+	`
+
+	rows, err := g.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, "", xerrors.DatabaseError(err, "group.GetDeletedByCreatorID")
+	}
+	defer rows.Close()
+
+	groups := []GroupRecord{}
+
+	for rows.Next() {
+		var group GroupRecord
+		dest := append([]any{&group.ID, &group.Name, &group.CreatorID, &group.CreatedAt, &group.DeletedAt}, pager.Dest()...)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, "", xerrors.DatabaseError(err, "group.GetDeletedByCreatorID")
+		}
+		if !pager.Keep() {
+			break
+		}
+		groups = append(groups, group)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, "", xerrors.DatabaseError(err, "group.GetDeletedByCreatorID")
+	}
+
+	return groups, pager.Next(), nil
+}
+
+// Restore moves a group created by the user out of the trash
+//
+// Check for xerrors.ErrUniqueViolation if another group has taken the name.
+func (g *Group) Restore(groupID, creatorID int64) *xerrors.AppError {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		UPDATE groups
+		SET deleted_at = NULL, updated_at = NOW()
+		WHERE id = $1 AND creator_id = $2 AND deleted_at IS NOT NULL;
+	`
+
+	result, err := g.DB.ExecContext(ctx, query, groupID, creatorID)
+	if err != nil {
+		return xerrors.DatabaseError(err, "group.Restore")
+	}
+
+	return notInTrash(result, groupID, "group.Restore")
+}
+
+// Purge permanently deletes a group created by the user from the trash
+func (g *Group) Purge(groupID, creatorID int64) *xerrors.AppError {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		DELETE FROM groups
+		WHERE id = $1 AND creator_id = $2 AND deleted_at IS NOT NULL;
+	`
+
+	result, err := g.DB.ExecContext(ctx, query, groupID, creatorID)
+	if err != nil {
+		return xerrors.DatabaseError(err, "group.Purge")
+	}
+
+	return notInTrash(result, groupID, "group.Purge")
+}
+
+// PurgeDeletedBefore permanently deletes every group moved to the trash
+// before the cutoff and returns the number of groups removed
+func (g *Group) PurgeDeletedBefore(cutoff time.Time) (int64, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		DELETE FROM groups
+		WHERE deleted_at IS NOT NULL AND deleted_at < $1;
+	`
+
+	result, err := g.DB.ExecContext(ctx, query, cutoff)
+	if err != nil {
+		return 0, xerrors.DatabaseError(err, "group.PurgeDeletedBefore")
+	}
+
+	return core.RowsAffected(result, "group.PurgeDeletedBefore")
+}
+
+// Returns a not found error if no group in the trash was affected
+func notInTrash(result sql.Result, groupID int64, op string) *xerrors.AppError {
+	rowsAffected, err := core.RowsAffected(result, op)
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return xerrors.ClientError(http.StatusNotFound,
+			fmt.Sprintf("No group in the trash with id: %d", groupID),
+			op, xerrors.ErrNotFound)
+	}
+
+	return nil
+}
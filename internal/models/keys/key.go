@@ -0,0 +1,45 @@
+package keys
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"time"
+)
+
+// ============================================================================
+// Constants
+// ============================================================================
+
+// Status of a key in the history of a user
+type Status string
+
+const (
+	StatusActive  Status = "active"  // Used to wrap new content keys
+	StatusRetired Status = "retired" // Replaced by a rotation, still unwraps older content keys
+	StatusRevoked Status = "revoked" // Compromised, content keys wrapped with it must be replaced
+)
+
+// ============================================================================
+// Type
+// ============================================================================
+
+// KeyRecord represents the user_keys table in the database.
+type KeyRecord struct {
+	ID                  int64     `db:"id" json:"id"`                                                 // Unique identifier
+	UserID              int64     `db:"user_id" json:"user_id"`                                       // Foreign key referencing users(id)
+	Email               string    `db:"-" json:"email"`                                               // Email of the user
+	Version             int       `db:"version" json:"version"`                                       // Starts at 1 and grows with each rotation
+	PublicKey           string    `db:"public_key" json:"public_key"`                                 // Public key used to wrap content keys for the user
+	EncryptedPrivateKey *string   `db:"encrypted_private_key" json:"encrypted_private_key,omitempty"` // Private key encrypted by the client, only returned to its owner
+	Fingerprint         string    `db:"fingerprint" json:"fingerprint"`                               // Digest of the public key that other users can verify
+	Status              Status    `db:"status" json:"status"`                                         // One of active, retired or revoked
+	CreatedAt           time.Time `db:"created_at" json:"created_at"`                                 // Timestamp with time zone
+	UpdatedAt           time.Time `db:"updated_at" json:"updated_at"`                                 // Timestamp with time zone, set when the status changes
+}
+
+// Returns the fingerprint of a public key, the unpadded base64 SHA-256 of the
+// key as registered, in the format used by OpenSSH
+func Fingerprint(publicKey string) string {
+	sum := sha256.Sum256([]byte(publicKey))
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,270 @@
+package keys
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"pm4devs.strawhats/internal/models/core"
+	"pm4devs.strawhats/internal/xerrors"
+)
+
+// ============================================================================
+// Interface
+// ============================================================================
+
+// Defines a mockable interface for public key operations
+type KeysRepository interface {
+	Rotate(userID int64, publicKey, encryptedPrivateKey string) (*KeyRecord, *xerrors.AppError)
+	Revoke(userID int64, fingerprint string) (*KeyRecord, int64, *xerrors.AppError)
+	GetActive(userID int64) (*KeyRecord, *xerrors.AppError)
+	GetByEmail(email string) (*KeyRecord, *xerrors.AppError)
+	GetHistory(email string) ([]*KeyRecord, *xerrors.AppError)
+}
+
+func Repository(db core.Queryable) KeysRepository {
+	return &Keys{DB: db}
+}
+
+// ============================================================================
+// Implementation
+// ============================================================================
+
+// Provides access to the Keys database methods
+type Keys struct {
+	DB core.Queryable
+}
+
+// Columns of a key record, along with the email of its user
+const keyColumns = `k.id, k.user_id, u.email, k.version, k.public_key, k.encrypted_private_key, k.fingerprint,
+	k.status, k.created_at, k.updated_at`
+
+// Registers a new key pair for a user and retires the active one
+//
+// Retired keys stay in the history so content keys wrapped with them can
+// still be unwrapped.
+func (k *Keys) Rotate(userID int64, publicKey, encryptedPrivateKey string) (*KeyRecord, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Start a new transaction
+	db, ok := k.DB.(*sql.DB)
+	if !ok {
+		return nil, xerrors.DatabaseError(fmt.Errorf("failed to cast DB to *sql.DB"), "keys.Rotate")
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, "keys.Rotate")
+	}
+	// Rollback is a no-op once the transaction is committed
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE user_keys SET status = 'retired', updated_at = NOW()
+		WHERE user_id = $1 AND status = 'active';
+	`, userID)
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, "keys.Rotate: failed to retire active key")
+	}
+
+	// Concurrent rotations conflict on the version of the user
+	query := `
+		WITH saved AS (
+			INSERT INTO user_keys (user_id, version, public_key, encrypted_private_key, fingerprint)
+			SELECT $1, COALESCE(MAX(version), 0) + 1, $2, $3, $4
+			FROM user_keys WHERE user_id = $1
+			RETURNING *
+		)
+		SELECT ` + keyColumns + `
+		FROM saved k
+		JOIN users u ON u.id = k.user_id;
+	`
+
+	var key KeyRecord
+	err = tx.QueryRowContext(ctx, query, userID, publicKey, encryptedPrivateKey, Fingerprint(publicKey)).Scan(keyDest(&key)...)
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, "keys.Rotate: failed to insert key")
+	}
+
+	// Commit the transaction
+	if err = tx.Commit(); err != nil {
+		return nil, xerrors.DatabaseError(err, "keys.Rotate: failed to commit transaction")
+	}
+
+	return &key, nil
+}
+
+// Revokes a key of a user, the active one when the fingerprint is empty, and
+// returns it along with the number of secrets flagged for re-keying
+//
+// Every secret with a content key wrapped with the revoked key must be
+// re-keyed, as the holder of the compromised private key could unwrap it.
+func (k *Keys) Revoke(userID int64, fingerprint string) (*KeyRecord, int64, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Start a new transaction
+	db, ok := k.DB.(*sql.DB)
+	if !ok {
+		return nil, 0, xerrors.DatabaseError(fmt.Errorf("failed to cast DB to *sql.DB"), "keys.Revoke")
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, 0, xerrors.DatabaseError(err, "keys.Revoke")
+	}
+	// Rollback is a no-op once the transaction is committed
+	defer tx.Rollback()
+
+	query := `
+		WITH revoked AS (
+			UPDATE user_keys SET status = 'revoked', updated_at = NOW()
+			WHERE user_id = $1 AND status <> 'revoked'
+				AND (fingerprint = $2 OR ($2 = '' AND status = 'active'))
+			RETURNING *
+		)
+		SELECT ` + keyColumns + `
+		FROM revoked k
+		JOIN users u ON u.id = k.user_id;
+	`
+
+	var key KeyRecord
+	err = tx.QueryRowContext(ctx, query, userID, fingerprint).Scan(keyDest(&key)...)
+	if errors.Is(err, sql.ErrNoRows) {
+		message := "No active key to revoke"
+		if fingerprint != "" {
+			message = fmt.Sprintf("No key to revoke with fingerprint %s", fingerprint)
+		}
+		return nil, 0, xerrors.ClientError(http.StatusNotFound, message, "keys.Revoke", xerrors.ErrNotFound)
+	}
+	if err != nil {
+		return nil, 0, xerrors.DatabaseError(err, "keys.Revoke: failed to revoke key")
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE secrets SET rekey_required = true
+		WHERE NOT rekey_required AND (
+			(owner_id = $1 AND key_fingerprint = $2)
+			OR id IN (SELECT secret_id FROM shared_secrets_user WHERE user_id = $1 AND key_fingerprint = $2)
+			OR id IN (SELECT secret_id FROM shared_secrets_group_keys WHERE user_id = $1 AND key_fingerprint = $2)
+		);
+	`, userID, key.Fingerprint)
+	if err != nil {
+		return nil, 0, xerrors.DatabaseError(err, "keys.Revoke: failed to flag secrets")
+	}
+	flagged, appErr := core.RowsAffected(result, "keys.Revoke")
+	if appErr != nil {
+		return nil, 0, appErr
+	}
+
+	// Commit the transaction
+	if err = tx.Commit(); err != nil {
+		return nil, 0, xerrors.DatabaseError(err, "keys.Revoke: failed to commit transaction")
+	}
+
+	return &key, flagged, nil
+}
+
+// Gets the active key of a user, including the encrypted private key
+func (k *Keys) GetActive(userID int64) (*KeyRecord, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT ` + keyColumns + `
+		FROM user_keys k
+		JOIN users u ON u.id = k.user_id
+		WHERE k.user_id = $1 AND k.status = 'active';
+	`
+
+	var key KeyRecord
+	err := k.DB.QueryRowContext(ctx, query, userID).Scan(keyDest(&key)...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, xerrors.ClientError(http.StatusNotFound, "No active key registered",
+			"keys.GetActive", xerrors.ErrNotFound)
+	}
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, "keys.GetActive")
+	}
+
+	return &key, nil
+}
+
+// Gets the active public key of the user with the given email, without the
+// encrypted private key
+func (k *Keys) GetByEmail(email string) (*KeyRecord, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT ` + keyColumns + `
+		FROM user_keys k
+		JOIN users u ON u.id = k.user_id
+		WHERE u.email = $1 AND k.status = 'active';
+	`
+
+	var key KeyRecord
+	err := k.DB.QueryRowContext(ctx, query, email).Scan(keyDest(&key)...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, xerrors.ClientError(http.StatusNotFound,
+			fmt.Sprintf("No public key registered for %s", email),
+			"keys.GetByEmail", xerrors.ErrNotFound)
+	}
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, "keys.GetByEmail")
+	}
+
+	key.EncryptedPrivateKey = nil
+	return &key, nil
+}
+
+// Gets every key registered by the user with the given email, newest first
+//
+// The encrypted private keys are included, callers strip them before handing
+// the history of a user to someone else.
+func (k *Keys) GetHistory(email string) ([]*KeyRecord, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT ` + keyColumns + `
+		FROM user_keys k
+		JOIN users u ON u.id = k.user_id
+		WHERE u.email = $1
+		ORDER BY k.version DESC;
+	`
+
+	rows, err := k.DB.QueryContext(ctx, query, email)
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, "keys.GetHistory")
+	}
+	defer rows.Close()
+
+	history := []*KeyRecord{}
+	for rows.Next() {
+		var key KeyRecord
+		if err := rows.Scan(keyDest(&key)...); err != nil {
+			return nil, xerrors.DatabaseError(err, "keys.GetHistory.Scan")
+		}
+		history = append(history, &key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, xerrors.DatabaseError(err, "keys.GetHistory.Rows")
+	}
+
+	return history, nil
+}
+
+// ============================================================================
+// Helpers
+// ============================================================================
+
+// Returns the scan destinations matching keyColumns
+func keyDest(key *KeyRecord) []any {
+	return []any{&key.ID, &key.UserID, &key.Email, &key.Version, &key.PublicKey, &key.EncryptedPrivateKey,
+		&key.Fingerprint, &key.Status, &key.CreatedAt, &key.UpdatedAt}
+}
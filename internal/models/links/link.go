@@ -0,0 +1,23 @@
+package links
+
+import "time"
+
+// LinkRecord represents the secret_links table in the database.
+//
+// The payload is left out as it is only returned once through Open.
+type LinkRecord struct {
+	ID        int64     `db:"id" json:"id"`                 // Bigserial primary key
+	Token     string    `db:"-" json:"token,omitempty"`     // Plaintext token, only known when the link is created
+	CreatorID int64     `db:"creator_id" json:"creator_id"` // Foreign key referencing users(id)
+	MaxViews  int       `db:"max_views" json:"max_views"`   // Number of times the link can be opened
+	Views     int       `db:"views" json:"views"`           // Number of times the link has been opened
+	ExpiresAt time.Time `db:"expires_at" json:"expires_at"` // Timestamp with time zone
+	CreatedAt time.Time `db:"created_at" json:"created_at"` // Timestamp with time zone
+}
+
+// LinkPayload is the client encrypted payload behind a link
+type LinkPayload struct {
+	EncryptedData string `json:"encrypted_data"`
+	IV            string `json:"iv"`
+	ViewsLeft     int    `json:"views_left"`
+}
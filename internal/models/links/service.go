@@ -0,0 +1,189 @@
+package links
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"pm4devs.strawhats/internal/envelope"
+	"pm4devs.strawhats/internal/models/core"
+	"pm4devs.strawhats/internal/models/tokens"
+	"pm4devs.strawhats/internal/xerrors"
+)
+
+// ============================================================================
+// Interface
+// ============================================================================
+
+// Defines a mockable interface for one-time link operations
+type LinksRepository interface {
+	NewRecord(token *tokens.Token, encryptedData, iv string, maxViews int) (*LinkRecord, *xerrors.AppError)
+	Open(plaintext string) (*LinkPayload, *xerrors.AppError)
+	Delete(linkID, creatorID int64) *xerrors.AppError
+	DeleteExpired() (int64, *xerrors.AppError)
+}
+
+func Repository(db core.Queryable, envelope *envelope.Envelope) LinksRepository {
+	return &Links{DB: db, Envelope: envelope}
+}
+
+// ============================================================================
+// Implementation
+// ============================================================================
+
+// Provides access to the Links database methods
+type Links struct {
+	DB       core.Queryable
+	Envelope *envelope.Envelope // Encrypts the payloads at rest
+}
+
+// Stores a payload behind the given token
+//
+// The token is created with tokens.ScopeShareLink and only its hash is
+// stored. Its expiry becomes the expiry of the link. The payload is encrypted
+// at rest like secrets.
+func (l *Links) NewRecord(token *tokens.Token, encryptedData, iv string, maxViews int) (*LinkRecord, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// The payload is bound to the ID of the link, taken before it is inserted
+	link := LinkRecord{Token: token.Plaintext}
+	err := l.DB.QueryRowContext(ctx, `SELECT nextval(pg_get_serial_sequence('secret_links', 'id'));`).Scan(&link.ID)
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, "links.NewRecord - id")
+	}
+
+	key, sealed, err := l.Envelope.Seal(Binding(link.ID), []byte(encryptedData), []byte(iv))
+	if err != nil {
+		return nil, xerrors.ServerError("links.NewRecord", err)
+	}
+
+	query := `
+		INSERT INTO secret_links (id, hash, creator_id, encrypted_data, iv, max_views, expires_at, data_key, master_key_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING creator_id, max_views, views, expires_at, created_at;
+	`
+	args := []any{link.ID, token.Hash, token.UserID, sealed[0], sealed[1], maxViews, token.Expiry,
+		key.Wrapped, key.MasterKeyID}
+
+	err = l.DB.QueryRowContext(ctx, query, args...).Scan(
+		&link.CreatorID, &link.MaxViews, &link.Views, &link.ExpiresAt, &link.CreatedAt,
+	)
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, "links.NewRecord")
+	}
+
+	return &link, nil
+}
+
+// Returns the payload behind a link and counts the view
+//
+// The link is burned on its last view. Expired, burned and unknown links are
+// all reported as not found.
+func (l *Links) Open(plaintext string) (*LinkPayload, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Start a new transaction
+	db, ok := l.DB.(*sql.DB)
+	if !ok {
+		return nil, xerrors.DatabaseError(fmt.Errorf("failed to cast DB to *sql.DB"), "links.Open")
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, "links.Open")
+	}
+	// Rollback is a no-op once the transaction is committed
+	defer tx.Rollback()
+
+	query := `
+		SELECT id, encrypted_data, iv, max_views - views - 1, data_key, master_key_id
+		FROM secret_links
+		WHERE hash = $1 AND expires_at > NOW()
+		FOR UPDATE;
+	`
+
+	var linkID int64
+	var encryptedData, iv []byte
+	var payload LinkPayload
+	var key envelope.Key
+	err = tx.QueryRowContext(ctx, query, tokens.Hash(plaintext)).Scan(&linkID, &encryptedData, &iv, &payload.ViewsLeft,
+		&key.Wrapped, &key.MasterKeyID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, xerrors.ClientError(http.StatusNotFound,
+			"The link does not exist, has expired or was already used",
+			"links.Open", xerrors.ErrNotFound)
+	}
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, "links.Open: failed to get link")
+	}
+
+	if payload.ViewsLeft > 0 {
+		_, err = tx.ExecContext(ctx, `UPDATE secret_links SET views = views + 1 WHERE id = $1;`, linkID)
+	} else {
+		_, err = tx.ExecContext(ctx, `DELETE FROM secret_links WHERE id = $1;`, linkID)
+	}
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, "links.Open: failed to count view")
+	}
+
+	if err := l.Envelope.Open(key, Binding(linkID), &encryptedData, &iv); err != nil {
+		return nil, xerrors.ServerError("links.Open", err)
+	}
+
+	// Commit the transaction
+	if err = tx.Commit(); err != nil {
+		return nil, xerrors.DatabaseError(err, "links.Open: failed to commit transaction")
+	}
+
+	payload.EncryptedData = string(encryptedData)
+	payload.IV = string(iv)
+	return &payload, nil
+}
+
+// Returns where the payload of a link is stored, which its encryption at
+// rest is bound to
+func Binding(linkID any) envelope.Record {
+	return envelope.Bind("secret_links", []string{"encrypted_data", "iv"}, linkID)
+}
+
+// Deletes a link before it is used up
+func (l *Links) Delete(linkID, creatorID int64) *xerrors.AppError {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := l.DB.ExecContext(ctx, `DELETE FROM secret_links WHERE id = $1 AND creator_id = $2;`, linkID, creatorID)
+	if err != nil {
+		return xerrors.DatabaseError(err, "links.Delete")
+	}
+
+	rowsAffected, appErr := core.RowsAffected(result, "links.Delete")
+	if appErr != nil {
+		return appErr
+	}
+
+	if rowsAffected == 0 {
+		return xerrors.ClientError(http.StatusNotFound,
+			fmt.Sprintf("No link with id: %d", linkID),
+			"links.Delete", xerrors.ErrNotFound)
+	}
+
+	return nil
+}
+
+// Deletes every link that has expired
+func (l *Links) DeleteExpired() (int64, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := l.DB.ExecContext(ctx, `DELETE FROM secret_links WHERE expires_at <= NOW();`)
+	if err != nil {
+		return 0, xerrors.DatabaseError(err, "links.DeleteExpired")
+	}
+
+	return core.RowsAffected(result, "links.DeleteExpired")
+}
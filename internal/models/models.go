@@ -3,28 +3,59 @@ package models
 import (
 	"database/sql"
 
+	"pm4devs.strawhats/internal/envelope"
+	"pm4devs.strawhats/internal/models/accesstokens"
+	"pm4devs.strawhats/internal/models/emergency"
+	"pm4devs.strawhats/internal/models/folders"
 	"pm4devs.strawhats/internal/models/group"
+	"pm4devs.strawhats/internal/models/keys"
+	"pm4devs.strawhats/internal/models/links"
+	"pm4devs.strawhats/internal/models/passkeys"
 	"pm4devs.strawhats/internal/models/permissions"
+	"pm4devs.strawhats/internal/models/recovery"
 	"pm4devs.strawhats/internal/models/secrets"
+	"pm4devs.strawhats/internal/models/sso"
 	"pm4devs.strawhats/internal/models/tokens"
+	"pm4devs.strawhats/internal/models/twofactor"
 	"pm4devs.strawhats/internal/models/users"
 )
 
 // Encapsulates all the models
 type Models struct {
-	Permissions permissions.PermissionsRepository
-	Tokens      tokens.TokensRepository
-	Users       users.UsersRepository
-	Secrets     secrets.SecretsRepository
-	Group       group.GroupRepository
+	Permissions  permissions.PermissionsRepository
+	Tokens       tokens.TokensRepository
+	Users        users.UsersRepository
+	Secrets      secrets.SecretsRepository
+	Group        group.GroupRepository
+	Folders      folders.FoldersRepository
+	Links        links.LinksRepository
+	Keys         keys.KeysRepository
+	Emergency    emergency.EmergencyRepository
+	Recovery     recovery.RecoveryRepository
+	TwoFactor    twofactor.TwoFactorRepository
+	Passkeys     passkeys.PasskeysRepository
+	AccessTokens accesstokens.AccessTokensRepository
+	SSO          sso.SSORepository
 }
 
-func New(db *sql.DB) *Models {
+// Secrets, link payloads, pending recovery shares and TOTP secrets are
+// encrypted at rest with the given envelope, access tokens are signed with
+// the server secret
+func New(db *sql.DB, envelope *envelope.Envelope, secret []byte) *Models {
 	return &Models{
-		Permissions: permissions.Repository(db),
-		Tokens:      tokens.Repository(db),
-		Users:       users.Repository(db),
-		Secrets:     secrets.Repository(db),
-		Group:       group.Repository(db),
+		Permissions:  permissions.Repository(db),
+		Tokens:       tokens.Repository(db, secret),
+		Users:        users.Repository(db),
+		Secrets:      secrets.Repository(db, envelope),
+		Group:        group.Repository(db, envelope),
+		Folders:      folders.Repository(db, envelope),
+		Links:        links.Repository(db, envelope),
+		Keys:         keys.Repository(db),
+		Emergency:    emergency.Repository(db),
+		Recovery:     recovery.Repository(db, envelope),
+		TwoFactor:    twofactor.Repository(db, envelope),
+		Passkeys:     passkeys.Repository(db),
+		AccessTokens: accesstokens.Repository(db),
+		SSO:          sso.Repository(db),
 	}
 }
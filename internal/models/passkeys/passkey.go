@@ -0,0 +1,29 @@
+package passkeys
+
+import "time"
+
+// Ceremonies a challenge is handed out for
+const (
+	CeremonyRegister     = "register"      // Registering a credential
+	CeremonyLogin        = "login"         // Logging in with a passkey
+	CeremonySecondFactor = "second-factor" // Using a security key as a second factor
+)
+
+// ============================================================================
+// Types
+// ============================================================================
+
+// Encapsulates the database properties of a WebAuthn credential, a passkey or
+// a security key
+type CredentialRecord struct {
+	ID                int64      `db:"id" json:"id"`                                 // Unique identifier
+	UserID            int64      `db:"user_id" json:"user_id"`                       // Foreign key referencing users(id)
+	CredentialID      []byte     `db:"credential_id" json:"credential_id"`           // ID chosen by the authenticator
+	PublicKey         []byte     `db:"public_key" json:"-"`                          // COSE public key
+	SignCount         uint32     `db:"sign_count" json:"sign_count"`                 // Signature counter last reported
+	AttestationFormat string     `db:"attestation_format" json:"attestation_format"` // Attestation format at registration
+	AAGUID            []byte     `db:"aaguid" json:"aaguid"`                         // Model of the authenticator
+	Name              string     `db:"name" json:"name"`                             // Name given by the user
+	CreatedAt         time.Time  `db:"created_at" json:"created_at"`                 // Timestamp of registration
+	LastUsedAt        *time.Time `db:"last_used_at" json:"last_used_at"`             // Timestamp of the last assertion
+}
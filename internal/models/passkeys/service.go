@@ -0,0 +1,263 @@
+package passkeys
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"pm4devs.strawhats/internal/models/core"
+	"pm4devs.strawhats/internal/xerrors"
+)
+
+// ============================================================================
+// Interface
+// ============================================================================
+
+// Defines a mockable interface for WebAuthn credential operations
+type PasskeysRepository interface {
+	NewChallenge(challenge []byte, userID *int64, ceremony string, ttl time.Duration) *xerrors.AppError
+	TakeChallenge(challenge []byte, ceremony string) (*int64, *xerrors.AppError)
+	Insert(credential *CredentialRecord) *xerrors.AppError
+	GetByCredentialID(credentialID []byte) (*CredentialRecord, *xerrors.AppError)
+	GetByUserID(userID int64) (*[]CredentialRecord, *xerrors.AppError)
+	UpdateSignCount(id int64, signCount uint32) *xerrors.AppError
+	Delete(id, userID int64) *xerrors.AppError
+}
+
+func Repository(db core.Queryable) PasskeysRepository {
+	return &Passkeys{DB: db}
+}
+
+// ============================================================================
+// Implementation
+// ============================================================================
+
+// Provides access to the Passkeys database methods
+type Passkeys struct {
+	DB core.Queryable
+}
+
+// Columns of a credential record
+const credentialColumns = `id, user_id, credential_id, public_key, sign_count, attestation_format, aaguid, name,
+	created_at, last_used_at`
+
+// Stores a challenge handed out for a ceremony, bound to the user expected to
+// answer it if known, and removes the expired ones
+func (pk *Passkeys) NewChallenge(challenge []byte, userID *int64, ceremony string, ttl time.Duration) *xerrors.AppError {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		WITH expired AS (
+			DELETE FROM webauthn_challenges WHERE expiry < NOW()
+		)
+		INSERT INTO webauthn_challenges (challenge, user_id, ceremony, expiry)
+		VALUES ($1, $2, $3, $4);
+	`
+
+	_, err := pk.DB.ExecContext(ctx, query, challenge, userID, ceremony, time.Now().Add(ttl))
+	if err != nil {
+		return xerrors.DatabaseError(err, "passkeys.NewChallenge")
+	}
+
+	return nil
+}
+
+// Removes a challenge handed out for a ceremony and returns the user it is
+// bound to, if any
+//
+// A challenge can only be answered once, unknown and expired ones are
+// reported as unauthenticated.
+func (pk *Passkeys) TakeChallenge(challenge []byte, ceremony string) (*int64, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		DELETE FROM webauthn_challenges
+		WHERE challenge = $1 AND ceremony = $2 AND expiry > NOW()
+		RETURNING user_id;
+	`
+
+	var userID *int64
+	err := pk.DB.QueryRowContext(ctx, query, challenge, ceremony).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, xerrors.ClientError(http.StatusUnauthorized,
+			"The challenge is invalid or expired, start over", "passkeys.TakeChallenge", xerrors.ErrUnauthenticated)
+	}
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, "passkeys.TakeChallenge")
+	}
+
+	return userID, nil
+}
+
+// Stores a credential verified at registration, setting its ID and creation
+// date
+//
+// Check for xerrors.ErrUniqueViolation if the credential was already
+// registered.
+func (pk *Passkeys) Insert(credential *CredentialRecord) *xerrors.AppError {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		INSERT INTO webauthn_credentials (user_id, credential_id, public_key, sign_count, attestation_format, aaguid, name)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at;
+	`
+
+	args := []any{credential.UserID, credential.CredentialID, credential.PublicKey, credential.SignCount,
+		credential.AttestationFormat, credential.AAGUID, credential.Name}
+	err := pk.DB.QueryRowContext(ctx, query, args...).Scan(&credential.ID, &credential.CreatedAt)
+	if err != nil {
+		return xerrors.DatabaseError(err, "passkeys.Insert")
+	}
+
+	return nil
+}
+
+// Gets a credential by the ID chosen by its authenticator
+func (pk *Passkeys) GetByCredentialID(credentialID []byte) (*CredentialRecord, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT ` + credentialColumns + `
+		FROM webauthn_credentials
+		WHERE credential_id = $1;
+	`
+
+	var credential CredentialRecord
+	err := pk.DB.QueryRowContext(ctx, query, credentialID).Scan(credentialDest(&credential)...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, xerrors.ClientError(http.StatusNotFound,
+			"The credential is not registered", "passkeys.GetByCredentialID", xerrors.ErrNotFound)
+	}
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, "passkeys.GetByCredentialID")
+	}
+
+	return &credential, nil
+}
+
+// Lists the credentials of a user
+func (pk *Passkeys) GetByUserID(userID int64) (*[]CredentialRecord, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT ` + credentialColumns + `
+		FROM webauthn_credentials
+		WHERE user_id = $1
+		ORDER BY created_at, id;
+	`
+
+	rows, err := pk.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, "passkeys.GetByUserID")
+	}
+	defer rows.Close()
+
+	credentials := []CredentialRecord{}
+	for rows.Next() {
+		var credential CredentialRecord
+		if err := rows.Scan(credentialDest(&credential)...); err != nil {
+			return nil, xerrors.DatabaseError(err, "passkeys.GetByUserID - scan")
+		}
+		credentials = append(credentials, credential)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, xerrors.DatabaseError(err, "passkeys.GetByUserID - rows error")
+	}
+
+	return &credentials, nil
+}
+
+// Records the signature counter of a credential after an assertion, if it
+// still grows. Check for xerrors.ErrEditConflict if another assertion already
+// reported the same or a higher counter, as a cloned authenticator would.
+//
+// Authenticators without a counter always report 0.
+func (pk *Passkeys) UpdateSignCount(id int64, signCount uint32) *xerrors.AppError {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		UPDATE webauthn_credentials
+		SET sign_count = $2, last_used_at = NOW()
+		WHERE id = $1 AND (sign_count < $2 OR (sign_count = 0 AND $2 = 0));
+	`
+
+	result, err := pk.DB.ExecContext(ctx, query, id, signCount)
+	if err != nil {
+		return xerrors.DatabaseError(err, "passkeys.UpdateSignCount")
+	}
+
+	rowsAffected, appErr := core.RowsAffected(result, "passkeys.UpdateSignCount")
+	if appErr != nil {
+		return appErr
+	}
+
+	if rowsAffected == 0 {
+		return xerrors.ClientError(http.StatusConflict,
+			fmt.Sprintf("The sign count of credential %d did not increase", id), "passkeys.UpdateSignCount",
+			xerrors.ErrEditConflict)
+	}
+
+	return nil
+}
+
+// Removes a credential of a user
+//
+// The recovery codes of the user are removed along with their last second
+// factor.
+func (pk *Passkeys) Delete(id, userID int64) *xerrors.AppError {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		WITH c AS (
+			DELETE FROM webauthn_credentials
+			WHERE id = $1 AND user_id = $2
+			RETURNING id
+		), codes AS (
+			DELETE FROM totp_recovery_codes
+			WHERE user_id = $2 AND EXISTS (SELECT 1 FROM c)
+			AND NOT EXISTS (SELECT 1 FROM webauthn_credentials w WHERE w.user_id = $2 AND w.id <> $1)
+			AND NOT EXISTS (SELECT 1 FROM user_totp t WHERE t.user_id = $2 AND t.confirmed_at IS NOT NULL)
+		)
+		SELECT COUNT(*) FROM c;
+	`
+
+	var count int
+	if err := pk.DB.QueryRowContext(ctx, query, id, userID).Scan(&count); err != nil {
+		return xerrors.DatabaseError(err, "passkeys.Delete")
+	}
+
+	if count == 0 {
+		return noCredential(id, "passkeys.Delete")
+	}
+
+	return nil
+}
+
+// ============================================================================
+// Helpers
+// ============================================================================
+
+// Returns the scan destinations of credentialColumns
+func credentialDest(credential *CredentialRecord) []any {
+	return []any{&credential.ID, &credential.UserID, &credential.CredentialID, &credential.PublicKey,
+		&credential.SignCount, &credential.AttestationFormat, &credential.AAGUID, &credential.Name,
+		&credential.CreatedAt, &credential.LastUsedAt}
+}
+
+// Returns a not found error for a missing credential
+func noCredential(id int64, op string) *xerrors.AppError {
+	return xerrors.ClientError(http.StatusNotFound,
+		fmt.Sprintf("No credential found with id: %d", id), op, xerrors.ErrNotFound)
+}
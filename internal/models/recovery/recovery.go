@@ -0,0 +1,111 @@
+package recovery
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// ============================================================================
+// Constants
+// ============================================================================
+
+// Status of a recovery key
+type KeyStatus string
+
+const (
+	KeyActive  KeyStatus = "active"  // New escrows are sealed to it
+	KeyRetired KeyStatus = "retired" // Replaced by a new key, still opens older escrows
+)
+
+// Status of a recovery ceremony
+type CeremonyStatus string
+
+const (
+	CeremonyOpen      CeremonyStatus = "open"      // Collecting shares from admins
+	CeremonyCompleted CeremonyStatus = "completed" // The group was handed to its new creator
+	CeremonyAborted   CeremonyStatus = "aborted"   // Cancelled, or the shares did not rebuild the key
+)
+
+// Events of the audit log
+const (
+	EventKeyCreated        = "key_created"
+	EventShareCollected    = "share_collected"
+	EventEscrowStored      = "escrow_stored"
+	EventCeremonyOpened    = "ceremony_opened"
+	EventShareSubmitted    = "share_submitted"
+	EventCeremonyCompleted = "ceremony_completed"
+	EventCeremonyAborted   = "ceremony_aborted"
+)
+
+// ============================================================================
+// Types
+// ============================================================================
+
+// KeyRecord represents the recovery_keys table in the database.
+type KeyRecord struct {
+	ID           int64         `db:"id" json:"id"`                 // Unique identifier
+	PublicKey    []byte        `db:"public_key" json:"public_key"` // X25519 public key escrows are sealed to
+	Threshold    int           `db:"threshold" json:"threshold"`   // Number of shares rebuilding the private key
+	Shares       int           `db:"shares" json:"shares"`         // Number of shares handed out
+	Status       KeyStatus     `db:"status" json:"status"`         // Either active or retired
+	CreatedBy    *int64        `db:"created_by" json:"created_by"` // Superadmin who created the key
+	CreatedAt    time.Time     `db:"created_at" json:"created_at"` // Timestamp of creation
+	Shareholders []Shareholder `db:"-" json:"shareholders"`        // Admins holding a share
+}
+
+// Shareholder represents the recovery_shareholders table in the database.
+type Shareholder struct {
+	UserID      int64      `db:"user_id" json:"user_id"`           // Foreign key referencing users(id)
+	Email       string     `db:"-" json:"email"`                   // Email of the admin
+	ShareIndex  int        `db:"share_index" json:"share_index"`   // X coordinate of the share
+	CollectedAt *time.Time `db:"collected_at" json:"collected_at"` // Set once the admin collected the share
+}
+
+// A share of a new recovery key for an admin
+type PendingShare struct {
+	UserID      int64
+	ShareIndex  int     // X coordinate of the share
+	Share       []byte  // Share sealed to the active public key of the admin
+	Fingerprint *string // Fingerprint of the public key the share was sealed to, nil for shares stored unsealed
+}
+
+// A content key recovered by a ceremony, wrapped for the new creator of the
+// group
+type RecoveredKey struct {
+	SecretID    int64
+	WrappedKey  string // Content key sealed to the active public key of the new creator
+	Fingerprint string // Fingerprint of that public key
+}
+
+// Escrow represents the recovery_escrows table in the database.
+type Escrow struct {
+	SecretID  int64  `db:"secret_id" json:"secret_id"`   // Foreign key referencing secrets(id)
+	GroupID   int64  `db:"group_id" json:"group_id"`     // Foreign key referencing groups(id)
+	KeyID     int64  `db:"key_id" json:"key_id"`         // Recovery key the content key is sealed to
+	SealedKey []byte `db:"sealed_key" json:"sealed_key"` // Content key of the secret sealed to the recovery key
+}
+
+// CeremonyRecord represents the recovery_ceremonies table in the database.
+type CeremonyRecord struct {
+	ID              int64          `db:"id" json:"id"`                         // Unique identifier
+	KeyID           int64          `db:"key_id" json:"key_id"`                 // Recovery key being rebuilt
+	GroupID         int64          `db:"group_id" json:"group_id"`             // Group being recovered
+	GroupName       string         `db:"-" json:"group_name"`                  // Name of the group
+	NewCreatorID    int64          `db:"new_creator_id" json:"new_creator_id"` // User the group is handed to
+	NewCreatorEmail string         `db:"-" json:"new_creator_email"`           // Email of the new creator
+	OpenedBy        *int64         `db:"opened_by" json:"opened_by"`           // Admin who opened the ceremony
+	Status          CeremonyStatus `db:"status" json:"status"`                 // Either open, completed or aborted
+	CreatedAt       time.Time      `db:"created_at" json:"created_at"`         // Timestamp of opening
+	ClosedAt        *time.Time     `db:"closed_at" json:"closed_at,omitempty"` // Set once completed or aborted
+}
+
+// AuditRecord represents the recovery_audit table in the database.
+type AuditRecord struct {
+	ID         int64           `db:"id" json:"id"`                   // Unique identifier
+	KeyID      *int64          `db:"key_id" json:"key_id"`           // Recovery key concerned
+	CeremonyID *int64          `db:"ceremony_id" json:"ceremony_id"` // Ceremony concerned, if any
+	ActorID    *int64          `db:"actor_id" json:"actor_id"`       // User who acted
+	Event      string          `db:"event" json:"event"`             // One of the Event constants
+	Details    json.RawMessage `db:"details" json:"details"`         // Context of the event
+	CreatedAt  time.Time       `db:"created_at" json:"created_at"`   // Timestamp of the event
+}
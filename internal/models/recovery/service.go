@@ -0,0 +1,641 @@
+package recovery
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"pm4devs.strawhats/internal/envelope"
+	"pm4devs.strawhats/internal/models/core"
+	"pm4devs.strawhats/internal/xerrors"
+)
+
+// ============================================================================
+// Interface
+// ============================================================================
+
+// Defines a mockable interface for organization recovery operations
+type RecoveryRepository interface {
+	NewKey(createdBy int64, publicKey []byte, threshold int, shares []PendingShare) (*KeyRecord, *xerrors.AppError)
+	GetActiveKey() (*KeyRecord, *xerrors.AppError)
+	GetKey(keyID int64) (*KeyRecord, *xerrors.AppError)
+	CollectShare(userID int64) (*PendingShare, *KeyRecord, *xerrors.AppError)
+	SetEscrow(escrow *Escrow, actorID int64) *xerrors.AppError
+	GetEscrows(groupID, keyID int64) ([]Escrow, *xerrors.AppError)
+	NewCeremony(keyID, groupID, newCreatorID, openedBy int64) (*CeremonyRecord, *xerrors.AppError)
+	GetCeremony(ceremonyID int64) (*CeremonyRecord, *xerrors.AppError)
+	Complete(ceremony *CeremonyRecord, actorID int64, recovered []RecoveredKey) *xerrors.AppError
+	Abort(ceremony *CeremonyRecord, actorID int64, reason string) *xerrors.AppError
+	Audit(ceremony *CeremonyRecord, actorID int64, event string, details map[string]any) *xerrors.AppError
+	GetAudit(page core.Page) ([]AuditRecord, string, *xerrors.AppError)
+}
+
+func Repository(db core.Queryable, envelope *envelope.Envelope) RecoveryRepository {
+	return &Recovery{DB: db, Envelope: envelope}
+}
+
+// ============================================================================
+// Implementation
+// ============================================================================
+
+// Provides access to the Recovery database methods
+type Recovery struct {
+	DB       core.Queryable
+	Envelope *envelope.Envelope // Encrypts the shares waiting to be collected at rest
+}
+
+// Listing of the audit log, oldest first by default
+var auditListing = core.Listing{
+	Sorts: map[string]string{"created_at": "a.created_at"},
+	Keys:  []string{"a.id"},
+}
+
+// ============================================================================
+// Keys
+// ============================================================================
+
+// Stores a new recovery key and the shares of its private key, retiring the
+// active key
+//
+// The shares are sealed to the public key of their admin and wait, encrypted
+// at rest, until each admin collects theirs.
+// Escrows sealed to the retired key are kept, a ceremony on that key still
+// opens them.
+func (rc *Recovery) NewKey(createdBy int64, publicKey []byte, threshold int, shares []PendingShare) (*KeyRecord, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Start a new transaction
+	db, ok := rc.DB.(*sql.DB)
+	if !ok {
+		return nil, xerrors.DatabaseError(fmt.Errorf("failed to cast DB to *sql.DB"), "recovery.NewKey")
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, "recovery.NewKey")
+	}
+	// Rollback is a no-op once the transaction is committed
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `UPDATE recovery_keys SET status = 'retired' WHERE status = 'active';`)
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, "recovery.NewKey: failed to retire key")
+	}
+
+	var keyID int64
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO recovery_keys (public_key, threshold, shares, created_by)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id;
+	`, publicKey, threshold, len(shares), createdBy).Scan(&keyID)
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, "recovery.NewKey: failed to insert key")
+	}
+
+	for _, pending := range shares {
+		dataKey, sealed, err := rc.Envelope.Seal(Binding(keyID, pending.UserID), pending.Share)
+		if err != nil {
+			return nil, xerrors.ServerError("recovery.NewKey", err)
+		}
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO recovery_shareholders (key_id, user_id, share_index, pending_share, data_key, master_key_id,
+				key_fingerprint)
+			VALUES ($1, $2, $3, $4, $5, $6, $7);
+		`, keyID, pending.UserID, pending.ShareIndex, sealed[0], dataKey.Wrapped, dataKey.MasterKeyID, pending.Fingerprint)
+		if err != nil {
+			return nil, xerrors.DatabaseError(err, "recovery.NewKey: failed to insert shareholder")
+		}
+	}
+
+	appErr := audit(ctx, tx, &keyID, nil, createdBy, EventKeyCreated, map[string]any{
+		"threshold": threshold,
+		"shares":    len(shares),
+	}, "recovery.NewKey")
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	key, appErr := getKey(ctx, tx, `WHERE k.id = $1`, keyID)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	// Commit the transaction
+	if err = tx.Commit(); err != nil {
+		return nil, xerrors.DatabaseError(err, "recovery.NewKey: failed to commit transaction")
+	}
+
+	return key, nil
+}
+
+// Gets the active recovery key along with its shareholders
+func (rc *Recovery) GetActiveKey() (*KeyRecord, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return getKey(ctx, rc.DB, `WHERE k.status = 'active'`)
+}
+
+// Gets a recovery key along with its shareholders
+func (rc *Recovery) GetKey(keyID int64) (*KeyRecord, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return getKey(ctx, rc.DB, `WHERE k.id = $1`, keyID)
+}
+
+// Hands an admin their share of the active recovery key, sealed to their
+// public key, once
+//
+// The share is deleted as it is returned, so it only ever exists with the
+// admin afterwards.
+func (rc *Recovery) CollectShare(userID int64) (*PendingShare, *KeyRecord, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Start a new transaction
+	db, ok := rc.DB.(*sql.DB)
+	if !ok {
+		return nil, nil, xerrors.DatabaseError(fmt.Errorf("failed to cast DB to *sql.DB"), "recovery.CollectShare")
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, xerrors.DatabaseError(err, "recovery.CollectShare")
+	}
+	// Rollback is a no-op once the transaction is committed
+	defer tx.Rollback()
+
+	var keyID int64
+	share := PendingShare{UserID: userID}
+	var dataKey envelope.Key
+	err = tx.QueryRowContext(ctx, `
+		SELECT sh.key_id, sh.share_index, sh.pending_share, sh.key_fingerprint, sh.data_key, sh.master_key_id
+		FROM recovery_shareholders sh
+		JOIN recovery_keys k ON k.id = sh.key_id
+		WHERE sh.user_id = $1 AND k.status = 'active'
+		FOR UPDATE OF sh;
+	`, userID).Scan(&keyID, &share.ShareIndex, &share.Share, &share.Fingerprint, &dataKey.Wrapped, &dataKey.MasterKeyID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, xerrors.ClientError(http.StatusNotFound,
+			"You do not hold a share of the active recovery key", "recovery.CollectShare", xerrors.ErrNotFound)
+	}
+	if err != nil {
+		return nil, nil, xerrors.DatabaseError(err, "recovery.CollectShare")
+	}
+	if share.Share == nil {
+		return nil, nil, xerrors.ClientError(http.StatusConflict,
+			"Your share was already collected", "recovery.CollectShare", xerrors.ErrEditConflict)
+	}
+	if err := rc.Envelope.Open(dataKey, Binding(keyID, userID), &share.Share); err != nil {
+		return nil, nil, xerrors.ServerError("recovery.CollectShare", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE recovery_shareholders
+		SET pending_share = NULL, data_key = NULL, master_key_id = NULL, collected_at = NOW()
+		WHERE key_id = $1 AND user_id = $2;
+	`, keyID, userID)
+	if err != nil {
+		return nil, nil, xerrors.DatabaseError(err, "recovery.CollectShare: failed to clear share")
+	}
+
+	if appErr := audit(ctx, tx, &keyID, nil, userID, EventShareCollected, nil, "recovery.CollectShare"); appErr != nil {
+		return nil, nil, appErr
+	}
+
+	key, appErr := getKey(ctx, tx, `WHERE k.id = $1`, keyID)
+	if appErr != nil {
+		return nil, nil, appErr
+	}
+
+	// Commit the transaction
+	if err = tx.Commit(); err != nil {
+		return nil, nil, xerrors.DatabaseError(err, "recovery.CollectShare: failed to commit transaction")
+	}
+
+	return &share, key, nil
+}
+
+// ============================================================================
+// Escrows
+// ============================================================================
+
+// Stores the content key of a secret shared with a group, sealed to a
+// recovery key, replacing any previous one
+func (rc *Recovery) SetEscrow(escrow *Escrow, actorID int64) *xerrors.AppError {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		INSERT INTO recovery_escrows (secret_id, group_id, key_id, sealed_key)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (secret_id, group_id)
+		DO UPDATE SET key_id = EXCLUDED.key_id, sealed_key = EXCLUDED.sealed_key, created_at = NOW();
+	`
+
+	_, err := rc.DB.ExecContext(ctx, query, escrow.SecretID, escrow.GroupID, escrow.KeyID, escrow.SealedKey)
+	if err != nil {
+		return xerrors.DatabaseError(err, "recovery.SetEscrow")
+	}
+
+	if appErr := audit(ctx, rc.DB, &escrow.KeyID, nil, actorID, EventEscrowStored, map[string]any{
+		"secret_id": escrow.SecretID,
+		"group_id":  escrow.GroupID,
+	}, "recovery.SetEscrow"); appErr != nil {
+		return appErr
+	}
+
+	return nil
+}
+
+// Lists the escrows of the secrets shared with a group sealed to a recovery
+// key
+func (rc *Recovery) GetEscrows(groupID, keyID int64) ([]Escrow, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT secret_id, group_id, key_id, sealed_key
+		FROM recovery_escrows
+		WHERE group_id = $1 AND key_id = $2
+		ORDER BY secret_id;
+	`
+
+	rows, err := rc.DB.QueryContext(ctx, query, groupID, keyID)
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, "recovery.GetEscrows")
+	}
+	defer rows.Close()
+
+	escrows := []Escrow{}
+	for rows.Next() {
+		var escrow Escrow
+		if err := rows.Scan(&escrow.SecretID, &escrow.GroupID, &escrow.KeyID, &escrow.SealedKey); err != nil {
+			return nil, xerrors.DatabaseError(err, "recovery.GetEscrows - scan")
+		}
+		escrows = append(escrows, escrow)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, xerrors.DatabaseError(err, "recovery.GetEscrows - rows error")
+	}
+
+	return escrows, nil
+}
+
+// ============================================================================
+// Ceremonies
+// ============================================================================
+
+// Opens a ceremony to recover a group with a recovery key. Check for
+// xerrors.ErrUniqueViolation if the group already has an open ceremony.
+func (rc *Recovery) NewCeremony(keyID, groupID, newCreatorID, openedBy int64) (*CeremonyRecord, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Start a new transaction
+	db, ok := rc.DB.(*sql.DB)
+	if !ok {
+		return nil, xerrors.DatabaseError(fmt.Errorf("failed to cast DB to *sql.DB"), "recovery.NewCeremony")
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, "recovery.NewCeremony")
+	}
+	// Rollback is a no-op once the transaction is committed
+	defer tx.Rollback()
+
+	query := `
+		WITH c AS (
+			INSERT INTO recovery_ceremonies (key_id, group_id, new_creator_id, opened_by)
+			VALUES ($1, $2, $3, $4)
+			RETURNING *
+		)
+		SELECT ` + ceremonyColumns + `
+		FROM c` + ceremonyJoins + `;
+	`
+
+	var ceremony CeremonyRecord
+	err = tx.QueryRowContext(ctx, query, keyID, groupID, newCreatorID, openedBy).Scan(ceremonyDest(&ceremony)...)
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, "recovery.NewCeremony")
+	}
+
+	if appErr := audit(ctx, tx, &keyID, &ceremony.ID, openedBy, EventCeremonyOpened, map[string]any{
+		"group_id":       groupID,
+		"new_creator_id": newCreatorID,
+	}, "recovery.NewCeremony"); appErr != nil {
+		return nil, appErr
+	}
+
+	// Commit the transaction
+	if err = tx.Commit(); err != nil {
+		return nil, xerrors.DatabaseError(err, "recovery.NewCeremony: failed to commit transaction")
+	}
+
+	return &ceremony, nil
+}
+
+// Gets a recovery ceremony
+func (rc *Recovery) GetCeremony(ceremonyID int64) (*CeremonyRecord, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT ` + ceremonyColumns + `
+		FROM recovery_ceremonies c` + ceremonyJoins + `
+		WHERE c.id = $1;
+	`
+
+	var ceremony CeremonyRecord
+	err := rc.DB.QueryRowContext(ctx, query, ceremonyID).Scan(ceremonyDest(&ceremony)...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, xerrors.ClientError(http.StatusNotFound,
+			fmt.Sprintf("No recovery ceremony found with id: %d", ceremonyID), "recovery.GetCeremony", xerrors.ErrNotFound)
+	}
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, "recovery.GetCeremony")
+	}
+
+	return &ceremony, nil
+}
+
+// Completes an open ceremony once the recovery key was rebuilt, handing the
+// group to its new creator, who joins it if they were not a member, along
+// with the recovered content keys wrapped for them
+func (rc *Recovery) Complete(ceremony *CeremonyRecord, actorID int64, recovered []RecoveredKey) *xerrors.AppError {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Start a new transaction
+	db, ok := rc.DB.(*sql.DB)
+	if !ok {
+		return xerrors.DatabaseError(fmt.Errorf("failed to cast DB to *sql.DB"), "recovery.Complete")
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return xerrors.DatabaseError(err, "recovery.Complete")
+	}
+	// Rollback is a no-op once the transaction is committed
+	defer tx.Rollback()
+
+	if appErr := closeCeremony(ctx, tx, ceremony, CeremonyCompleted, "recovery.Complete"); appErr != nil {
+		return appErr
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE groups SET creator_id = $1, version = version + 1, updated_at = NOW()
+		WHERE id = $2;
+	`, ceremony.NewCreatorID, ceremony.GroupID)
+	if err != nil {
+		return xerrors.DatabaseError(err, "recovery.Complete: failed to update group")
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO group_members (group_id, user_id) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING;
+	`, ceremony.GroupID, ceremony.NewCreatorID)
+	if err != nil {
+		return xerrors.DatabaseError(err, "recovery.Complete: failed to add member")
+	}
+
+	for _, key := range recovered {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO shared_secrets_group_keys (secret_id, group_id, user_id, wrapped_key, key_fingerprint)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (secret_id, group_id, user_id) DO UPDATE
+			SET wrapped_key = EXCLUDED.wrapped_key, key_fingerprint = EXCLUDED.key_fingerprint;
+		`, key.SecretID, ceremony.GroupID, ceremony.NewCreatorID, key.WrappedKey, key.Fingerprint)
+		if err != nil {
+			return xerrors.DatabaseError(err, "recovery.Complete: failed to store group key")
+		}
+	}
+
+	if appErr := audit(ctx, tx, &ceremony.KeyID, &ceremony.ID, actorID, EventCeremonyCompleted, map[string]any{
+		"group_id":       ceremony.GroupID,
+		"new_creator_id": ceremony.NewCreatorID,
+		"recovered_keys": len(recovered),
+	}, "recovery.Complete"); appErr != nil {
+		return appErr
+	}
+
+	// Commit the transaction
+	if err = tx.Commit(); err != nil {
+		return xerrors.DatabaseError(err, "recovery.Complete: failed to commit transaction")
+	}
+
+	return nil
+}
+
+// Aborts an open ceremony
+func (rc *Recovery) Abort(ceremony *CeremonyRecord, actorID int64, reason string) *xerrors.AppError {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Start a new transaction
+	db, ok := rc.DB.(*sql.DB)
+	if !ok {
+		return xerrors.DatabaseError(fmt.Errorf("failed to cast DB to *sql.DB"), "recovery.Abort")
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return xerrors.DatabaseError(err, "recovery.Abort")
+	}
+	// Rollback is a no-op once the transaction is committed
+	defer tx.Rollback()
+
+	if appErr := closeCeremony(ctx, tx, ceremony, CeremonyAborted, "recovery.Abort"); appErr != nil {
+		return appErr
+	}
+
+	if appErr := audit(ctx, tx, &ceremony.KeyID, &ceremony.ID, actorID, EventCeremonyAborted, map[string]any{
+		"reason": reason,
+	}, "recovery.Abort"); appErr != nil {
+		return appErr
+	}
+
+	// Commit the transaction
+	if err = tx.Commit(); err != nil {
+		return xerrors.DatabaseError(err, "recovery.Abort: failed to commit transaction")
+	}
+
+	return nil
+}
+
+// ============================================================================
+// Audit
+// ============================================================================
+
+// Appends an event to the audit log, for the active key when no ceremony is
+// given
+func (rc *Recovery) Audit(ceremony *CeremonyRecord, actorID int64, event string, details map[string]any) *xerrors.AppError {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var keyID, ceremonyID *int64
+	if ceremony != nil {
+		keyID, ceremonyID = &ceremony.KeyID, &ceremony.ID
+	}
+
+	return audit(ctx, rc.DB, keyID, ceremonyID, actorID, event, details, "recovery.Audit")
+}
+
+// Lists the audit log
+func (rc *Recovery) GetAudit(page core.Page) ([]AuditRecord, string, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	pager, appErr := auditListing.Pager(page, "recovery.GetAudit")
+	if appErr != nil {
+		return nil, "", appErr
+	}
+
+	cursor, args := pager.Where([]any{})
+	query := `
+		SELECT a.id, a.key_id, a.ceremony_id, a.actor_id, a.event, a.details, a.created_at` + pager.Columns() + `
+		FROM recovery_audit a
+		WHERE true` + cursor + pager.OrderBy() + `;
+	`
+
+	rows, err := rc.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, "", xerrors.DatabaseError(err, "recovery.GetAudit")
+	}
+	defer rows.Close()
+
+	entries := []AuditRecord{}
+	for rows.Next() {
+		var entry AuditRecord
+		dest := append([]any{&entry.ID, &entry.KeyID, &entry.CeremonyID, &entry.ActorID, &entry.Event,
+			&entry.Details, &entry.CreatedAt}, pager.Dest()...)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, "", xerrors.DatabaseError(err, "recovery.GetAudit - scan")
+		}
+		if !pager.Keep() {
+			break
+		}
+		entries = append(entries, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, "", xerrors.DatabaseError(err, "recovery.GetAudit - rows error")
+	}
+
+	return entries, pager.Next(), nil
+}
+
+// ============================================================================
+// Helpers
+// ============================================================================
+
+// Columns of a ceremony record, along with the group name and the email of
+// the new creator
+const ceremonyColumns = `c.id, c.key_id, c.group_id, g.name, c.new_creator_id, u.email, c.opened_by,
+	c.status, c.created_at, c.closed_at`
+
+// Joins the group and new creator of a ceremony record
+const ceremonyJoins = `
+	JOIN groups g ON g.id = c.group_id
+	JOIN users u ON u.id = c.new_creator_id`
+
+// Returns where the pending share of a shareholder is stored, which its
+// encryption at rest is bound to
+func Binding(keyID, userID any) envelope.Record {
+	return envelope.Bind("recovery_shareholders", []string{"pending_share"}, keyID, userID)
+}
+
+// Returns the scan destinations of ceremonyColumns
+func ceremonyDest(ceremony *CeremonyRecord) []any {
+	return []any{&ceremony.ID, &ceremony.KeyID, &ceremony.GroupID, &ceremony.GroupName, &ceremony.NewCreatorID,
+		&ceremony.NewCreatorEmail, &ceremony.OpenedBy, &ceremony.Status, &ceremony.CreatedAt, &ceremony.ClosedAt}
+}
+
+// Gets the recovery key matching the condition, along with its shareholders
+func getKey(ctx context.Context, db core.Queryable, where string, args ...any) (*KeyRecord, *xerrors.AppError) {
+	var key KeyRecord
+	err := db.QueryRowContext(ctx, `
+		SELECT k.id, k.public_key, k.threshold, k.shares, k.status, k.created_by, k.created_at
+		FROM recovery_keys k `+where+`;
+	`, args...).Scan(&key.ID, &key.PublicKey, &key.Threshold, &key.Shares, &key.Status, &key.CreatedBy, &key.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, xerrors.ClientError(http.StatusNotFound,
+			"No recovery key found", "recovery.getKey", xerrors.ErrNotFound)
+	}
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, "recovery.getKey")
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT sh.user_id, u.email, sh.share_index, sh.collected_at
+		FROM recovery_shareholders sh
+		JOIN users u ON u.id = sh.user_id
+		WHERE sh.key_id = $1
+		ORDER BY sh.share_index;
+	`, key.ID)
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, "recovery.getKey: shareholders")
+	}
+	defer rows.Close()
+
+	key.Shareholders = []Shareholder{}
+	for rows.Next() {
+		var holder Shareholder
+		if err := rows.Scan(&holder.UserID, &holder.Email, &holder.ShareIndex, &holder.CollectedAt); err != nil {
+			return nil, xerrors.DatabaseError(err, "recovery.getKey - scan")
+		}
+		key.Shareholders = append(key.Shareholders, holder)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, xerrors.DatabaseError(err, "recovery.getKey - rows error")
+	}
+
+	return &key, nil
+}
+
+// Moves an open ceremony to its final status
+func closeCeremony(ctx context.Context, tx *sql.Tx, ceremony *CeremonyRecord, status CeremonyStatus, op string) *xerrors.AppError {
+	err := tx.QueryRowContext(ctx, `
+		UPDATE recovery_ceremonies SET status = $1, closed_at = NOW()
+		WHERE id = $2 AND status = 'open'
+		RETURNING status, closed_at;
+	`, status, ceremony.ID).Scan(&ceremony.Status, &ceremony.ClosedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return xerrors.ClientError(http.StatusConflict,
+			fmt.Sprintf("Recovery ceremony %d is not open", ceremony.ID), op, xerrors.ErrEditConflict)
+	}
+	if err != nil {
+		return xerrors.DatabaseError(err, op)
+	}
+	return nil
+}
+
+// Appends an event to the audit log
+func audit(ctx context.Context, db core.Queryable, keyID, ceremonyID *int64, actorID int64, event string, details map[string]any, op string) *xerrors.AppError {
+	if details == nil {
+		details = map[string]any{}
+	}
+	data, err := json.Marshal(details)
+	if err != nil {
+		return xerrors.ServerError(op, err)
+	}
+
+	// Events outside of a ceremony are logged against the active key
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO recovery_audit (key_id, ceremony_id, actor_id, event, details)
+		VALUES (COALESCE($1, (SELECT id FROM recovery_keys WHERE status = 'active')), $2, $3, $4, $5);
+	`, keyID, ceremonyID, core.NullableID(actorID), event, data)
+	if err != nil {
+		return xerrors.DatabaseError(err, op+": failed to write audit log")
+	}
+	return nil
+}
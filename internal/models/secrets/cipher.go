@@ -0,0 +1,27 @@
+package secrets
+
+// The algorithm the client encrypted a secret with. Along with the cipher
+// version, the format of the encrypted data and IV for that algorithm, it
+// lets clients move to a new algorithm while older secrets and versions stay
+// readable.
+type Cipher string
+
+const (
+	CipherAES256GCM         Cipher = "aes-256-gcm"
+	CipherXChaCha20Poly1305 Cipher = "xchacha20-poly1305"
+)
+
+// The cipher and version of secrets created without one
+const (
+	DefaultCipher        = CipherAES256GCM
+	DefaultCipherVersion = 1
+)
+
+// Checks if the cipher is supported
+func (c Cipher) Valid() bool {
+	switch c {
+	case CipherAES256GCM, CipherXChaCha20Poly1305:
+		return true
+	}
+	return false
+}
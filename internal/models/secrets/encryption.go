@@ -0,0 +1,209 @@
+package secrets
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"pm4devs.strawhats/internal/envelope"
+	"pm4devs.strawhats/internal/models/links"
+	"pm4devs.strawhats/internal/models/recovery"
+	"pm4devs.strawhats/internal/models/twofactor"
+	"pm4devs.strawhats/internal/xerrors"
+)
+
+// Tables holding fields encrypted at rest with the data keys stored next to
+// them, with the columns identifying their rows and the record the fields of
+// a row are bound to, which names their columns
+var sealedTables = []struct {
+	name   string
+	ids    []string
+	record func(ids []any) envelope.Record
+}{
+	{name: "secrets", ids: []string{"id"}, record: func(ids []any) envelope.Record { return Binding(ids[0]) }},
+	{name: "secret_versions", ids: []string{"secret_id", "version"},
+		record: func(ids []any) envelope.Record { return Binding(ids[0]) }},
+	{name: "secret_links", ids: []string{"id"}, record: func(ids []any) envelope.Record { return links.Binding(ids[0]) }},
+	{name: "user_totp", ids: []string{"user_id"},
+		record: func(ids []any) envelope.Record { return twofactor.Binding(ids[0]) }},
+	{name: "recovery_shareholders", ids: []string{"key_id", "user_id"},
+		record: func(ids []any) envelope.Record { return recovery.Binding(ids[0], ids[1]) }},
+}
+
+// Returns where the encrypted data and IV of a secret are stored, which their
+// encryption at rest is bound to
+//
+// Versions are bound to their secret as well, since they are copied back and
+// forth between the secret and its versions.
+func Binding(secretID any) envelope.Record {
+	return envelope.Bind("secrets", []string{"encrypted_data", "iv"}, secretID)
+}
+
+// Wraps the data keys of up to batchSize rows of each table with the current
+// master key and returns the number of rows changed
+//
+// Rows stored before envelope encryption are encrypted at rest as well. Call
+// until it returns 0 to rotate every row.
+func (s *Secrets) RewrapKeys(batchSize int) (int64, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Start a new transaction
+	db, ok := s.DB.(*sql.DB)
+	if !ok {
+		return 0, xerrors.DatabaseError(fmt.Errorf("failed to cast DB to *sql.DB"), "secrets.RewrapKeys")
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, xerrors.DatabaseError(err, "secrets.RewrapKeys")
+	}
+	// Rollback is a no-op once the transaction is committed
+	defer tx.Rollback()
+
+	var total int64
+	for _, table := range sealedTables {
+		count, err := s.rewrapTable(ctx, tx, table.name, table.ids, table.record, batchSize)
+		if err != nil {
+			return 0, err
+		}
+		total += count
+	}
+
+	// Commit the transaction
+	if err = tx.Commit(); err != nil {
+		return 0, xerrors.DatabaseError(err, "secrets.RewrapKeys: failed to commit transaction")
+	}
+
+	return total, nil
+}
+
+// ============================================================================
+// Helpers
+// ============================================================================
+
+// Encrypts the encrypted data and IV of a secret at rest
+func (s *Secrets) seal(record envelope.Record, encryptedData, iv []byte, op string) (envelope.Key, [][]byte, *xerrors.AppError) {
+	key, sealed, err := s.Envelope.Seal(record, encryptedData, iv)
+	if err != nil {
+		return envelope.Key{}, nil, xerrors.ServerError(op, err)
+	}
+	return key, sealed, nil
+}
+
+// Decrypts the encrypted data and IV of a secret read from the database
+func (s *Secrets) open(key envelope.Key, secretID int64, encryptedData, iv *[]byte, op string) *xerrors.AppError {
+	if err := s.Envelope.Open(key, Binding(secretID), encryptedData, iv); err != nil {
+		return xerrors.ServerError(op, err)
+	}
+	return nil
+}
+
+// A row of a sealed table as stored
+type sealedRow struct {
+	ids    []any
+	fields [][]byte
+	key    envelope.Key
+}
+
+// Wraps the data keys of up to batchSize rows of a table with the current
+// master key in a transaction
+func (s *Secrets) rewrapTable(ctx context.Context, tx *sql.Tx, table string, ids []string,
+	record func(ids []any) envelope.Record, batchSize int) (int64, *xerrors.AppError) {
+	op := "secrets.RewrapKeys: " + table
+	columns := record(make([]any, len(ids))).Columns
+
+	// Lock the rows so they aren't updated with the previous data key meanwhile.
+	// Rows whose fields were cleared, like collected shares, have no key.
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf(`
+		SELECT %[1]s, %[2]s, data_key, master_key_id
+		FROM %[3]s
+		WHERE master_key_id IS DISTINCT FROM $1 AND %[4]s IS NOT NULL
+		ORDER BY %[1]s
+		LIMIT $2
+		FOR UPDATE;
+	`, strings.Join(ids, ", "), strings.Join(columns, ", "), table, columns[0]),
+		s.Envelope.CurrentKeyID(), batchSize)
+	if err != nil {
+		return 0, xerrors.DatabaseError(err, op)
+	}
+	defer rows.Close()
+
+	var sealed []sealedRow
+	for rows.Next() {
+		row := sealedRow{ids: make([]any, len(ids)), fields: make([][]byte, len(columns))}
+		dest := make([]any, 0, len(ids)+len(columns)+2)
+		for i := range ids {
+			dest = append(dest, &row.ids[i])
+		}
+		for i := range columns {
+			dest = append(dest, &row.fields[i])
+		}
+		dest = append(dest, &row.key.Wrapped, &row.key.MasterKeyID)
+		if err := rows.Scan(dest...); err != nil {
+			return 0, xerrors.DatabaseError(err, op+" - scan")
+		}
+		sealed = append(sealed, row)
+	}
+
+	if err := rows.Err(); err != nil {
+		return 0, xerrors.DatabaseError(err, op+" - rows error")
+	}
+	rows.Close()
+
+	// The values set come first, followed by the columns identifying the row
+	assignments := make([]string, 0, len(columns)+2)
+	for _, column := range columns {
+		assignments = append(assignments, fmt.Sprintf("%s = $%d", column, len(assignments)+1))
+	}
+	assignments = append(assignments, fmt.Sprintf("data_key = $%d, master_key_id = $%d", len(columns)+1,
+		len(columns)+2))
+	conditions := make([]string, len(ids))
+	for i, column := range ids {
+		conditions[i] = fmt.Sprintf("%s = $%d", column, len(assignments)+i+1)
+	}
+	query := fmt.Sprintf(`
+		UPDATE %s
+		SET %s
+		WHERE %s;
+	`, table, strings.Join(assignments, ", "), strings.Join(conditions, " AND "))
+
+	for _, row := range sealed {
+		// Rows stored before envelope encryption, or before their fields were
+		// bound to their record, are encrypted with a new data key, others only
+		// have their data key wrapped again
+		key, err := s.Envelope.Rewrap(row.key)
+		if row.key.Wrapped == nil || errors.Is(err, envelope.ErrUnbound) {
+			fields := make([]*[]byte, len(row.fields))
+			for i := range row.fields {
+				fields[i] = &row.fields[i]
+			}
+			if err := s.Envelope.Open(row.key, envelope.Record{}, fields...); err != nil {
+				return 0, xerrors.ServerError(op, err)
+			}
+			key, sealed, err := s.Envelope.Seal(record(row.ids), row.fields...)
+			if err != nil {
+				return 0, xerrors.ServerError(op, err)
+			}
+			row.key, row.fields = key, sealed
+		} else if err != nil {
+			return 0, xerrors.ServerError(op, err)
+		} else {
+			row.key = key
+		}
+
+		args := make([]any, 0, len(row.fields)+len(row.ids)+2)
+		for _, field := range row.fields {
+			args = append(args, field)
+		}
+		args = append(append(args, row.key.Wrapped, row.key.MasterKeyID), row.ids...)
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return 0, xerrors.DatabaseError(err, op+" - update")
+		}
+	}
+
+	return int64(len(sealed)), nil
+}
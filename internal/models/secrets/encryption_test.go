@@ -0,0 +1,53 @@
+package secrets
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"pm4devs.strawhats/internal/assert"
+)
+
+// Tables given a master_key_id column by a migration, added to an existing
+// table or created with it
+var (
+	alteredTable = regexp.MustCompile(`(?i)ALTER TABLE (?:IF EXISTS )?(\w+) ADD COLUMN (?:IF NOT EXISTS )?master_key_id\b`)
+	createdTable = regexp.MustCompile(`(?is)CREATE TABLE (?:IF NOT EXISTS )?(\w+) \(([^;]*)\)`)
+)
+
+// Every table storing data keys has its rows re-wrapped, or dropping a
+// previous master key after a rotation leaves them unreadable
+func TestSealedTables(t *testing.T) {
+	migrations, err := filepath.Glob(filepath.Join("..", "..", "..", "migrations", "*.up.sql"))
+	assert.Is(t, err, nil)
+	assert.True(t, len(migrations) > 0)
+
+	covered := map[string]bool{}
+	for _, table := range sealedTables {
+		covered[table.name] = true
+	}
+
+	for _, migration := range migrations {
+		content, err := os.ReadFile(migration)
+		assert.Is(t, err, nil)
+
+		var tables []string
+		for _, match := range alteredTable.FindAllStringSubmatch(string(content), -1) {
+			tables = append(tables, match[1])
+		}
+		for _, match := range createdTable.FindAllStringSubmatch(string(content), -1) {
+			if strings.Contains(match[2], "master_key_id") {
+				tables = append(tables, match[1])
+			}
+		}
+
+		for _, table := range tables {
+			if !covered[table] {
+				t.Errorf("%s: %s has a master_key_id column but is not in sealedTables", filepath.Base(migration),
+					table)
+			}
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package secrets
+
+import (
+	"context"
+	"time"
+
+	"pm4devs.strawhats/internal/xerrors"
+)
+
+// A user or group share removed because it expired
+type ExpiredShare struct {
+	SecretID   int64     `json:"secret_id"`
+	SecretName string    `json:"secret_name"`
+	OwnerEmail string    `json:"owner_email"`
+	Recipient  string    `json:"recipient"` // Email of the user or name of the group
+	ExpiredAt  time.Time `json:"expired_at"`
+	Notify     bool      `json:"-"` // False when the owner is a service account, which has no mailbox
+}
+
+// DeleteExpiredShares removes the user and group shares that have expired and
+// returns them so their owners can be notified, unless they are service
+// accounts
+//
+// Expired shares already stop granting access before they are removed. The
+// secrets are flagged for re-keying like on a revoke.
+func (s *Secrets) DeleteExpiredShares() (*[]ExpiredShare, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		WITH expired_users AS (
+			DELETE FROM shared_secrets_user
+			WHERE expires_at <= NOW()
+			RETURNING secret_id, user_id, expires_at
+		), expired_groups AS (
+			DELETE FROM shared_secrets_group
+			WHERE expires_at <= NOW()
+			RETURNING secret_id, group_id, expires_at
+		), rekeyed AS (
+			UPDATE secrets SET rekey_required = true
+			WHERE id IN (SELECT secret_id FROM expired_users UNION SELECT secret_id FROM expired_groups)
+		)
+		SELECT s.id, s.name, owner.email, u.email::text, e.expires_at, owner.owner_group_id IS NULL
+		FROM expired_users e
+		JOIN secrets s ON s.id = e.secret_id
+		JOIN users owner ON owner.id = s.owner_id
+		JOIN users u ON u.id = e.user_id
+		UNION ALL
+		SELECT s.id, s.name, owner.email, g.name, e.expires_at, owner.owner_group_id IS NULL
+		FROM expired_groups e
+		JOIN secrets s ON s.id = e.secret_id
+		JOIN users owner ON owner.id = s.owner_id
+		JOIN groups g ON g.id = e.group_id;
+	`
+
+	rows, err := s.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, "secrets.DeleteExpiredShares")
+	}
+	defer rows.Close()
+
+	expired := []ExpiredShare{}
+	for rows.Next() {
+		var share ExpiredShare
+		if err := rows.Scan(&share.SecretID, &share.SecretName, &share.OwnerEmail, &share.Recipient,
+			&share.ExpiredAt, &share.Notify); err != nil {
+			return nil, xerrors.DatabaseError(err, "secrets.DeleteExpiredShares - scan")
+		}
+		expired = append(expired, share)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, xerrors.DatabaseError(err, "secrets.DeleteExpiredShares - rows error")
+	}
+
+	return &expired, nil
+}
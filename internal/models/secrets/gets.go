@@ -4,9 +4,38 @@ import (
 	"context"
 	"time"
 
+	"github.com/lib/pq"
+	"pm4devs.strawhats/internal/envelope"
+	"pm4devs.strawhats/internal/models/core"
 	"pm4devs.strawhats/internal/xerrors"
 )
 
+// Sort keys accepted by the secret listings
+var secretSorts = map[string]string{
+	"name":       "s.name",
+	"created_at": "s.created_at",
+	"updated_at": "s.updated_at",
+}
+
+// Listings of secrets, one row per secret
+var secretListing = core.Listing{Sorts: secretSorts, Keys: []string{"s.id"}}
+
+// Listings of secret shares, one row per secret and recipient
+var (
+	userShareListing  = core.Listing{Sorts: secretSorts, Keys: []string{"s.id", "ssu.user_id"}}
+	groupShareListing = core.Listing{Sorts: secretSorts, Keys: []string{"s.id", "ssg.group_id"}}
+)
+
+// Returns the encrypted data, IV and data key columns of the secrets of a
+// listing, or NULLs when the page leaves out the encrypted data so it is
+// neither read nor decrypted
+func sealedColumns(page core.Page) string {
+	if !page.Wants("encrypted_data") && !page.Wants("iv") {
+		return "NULL, NULL, NULL, NULL"
+	}
+	return "s.encrypted_data, s.iv, s.data_key, s.master_key_id"
+}
+
 type SharedSecretUser struct {
 	SecretID   int64      `db:"secret_id" json:"secret_id"`   // ID of the secret
 	UserID     int64      `db:"user_id" json:"user_id"`       // ID of the user the secret is shared with
@@ -17,86 +46,126 @@ type SharedSecretGroup struct {
 	SecretID   int64      `db:"secret_id" json:"secret_id"`   // ID of the secret
 	GroupID    int64      `db:"group_id" json:"group_id"`     // ID of the group the secret is shared with
 	Permission Permission `db:"permission" json:"permission"` // Permission for the shared secret
+	ExpiresAt  *time.Time `db:"expires_at" json:"expires_at"` // When the share stops granting access, NULL for never
 }
 
 type FullSharedSecretUserDetail struct {
-    SecretID      int64     `json:"secret_id"`
-    Name          string    `json:"name"`
-    EncryptedData []byte    `json:"encrypted_data"`
-    IV            []byte    `json:"iv"`
-    OwnerID       int64     `json:"owner_id"`
-    UserID        int64     `json:"user_id"`
-    Permission    string    `json:"permission"`
-    CreatedAt     time.Time `json:"created_at"`
-    UpdatedAt     time.Time `json:"updated_at"`
+	SecretID      int64      `json:"secret_id"`
+	Name          string     `json:"name"`
+	EncryptedData []byte     `json:"encrypted_data"`
+	IV            []byte     `json:"iv"`
+	Cipher        Cipher     `json:"cipher"`
+	CipherVersion int        `json:"cipher_version"`
+	OwnerID       int64      `json:"owner_id"`
+	UserID        int64      `json:"user_id"`
+	Permission    string     `json:"permission"`
+	ExpiresAt     *time.Time `json:"expires_at"`
+	Kind          Kind       `json:"kind"`
+	Tags          []string   `json:"tags"`
+	Metadata      Metadata   `json:"metadata"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
 }
 
-func (s *Secrets) GetSecretsSharedToOtherUsers(userID int64) (*[]FullSharedSecretUserDetail, *xerrors.AppError) {
-    ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-    defer cancel()
+func (s *Secrets) GetSecretsSharedToOtherUsers(userID int64, filter SecretFilter, page core.Page) (*[]FullSharedSecretUserDetail, string, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
 
-    // Prepare the SQL query to select full secret details shared to other users
-    query := `
-        SELECT s.id AS secret_id, s.name, s.encrypted_data, s.iv, s.owner_id, ssu.user_id, ssu.permission, s.created_at, s.updated_at
+	pager, appErr := userShareListing.Pager(page, "secrets.GetSecretsSharedToOtherUsers")
+	if appErr != nil {
+		return nil, "", appErr
+	}
+
+	// Prepare the SQL query to select full secret details shared to other users
+	conditions, args := filter.where("s", []any{userID})
+	cursor, args := pager.Where(args)
+	query := `
+        SELECT s.id AS secret_id, s.name, ` + sealedColumns(page) + `, s.cipher, s.cipher_version, s.owner_id, ssu.user_id, ssu.permission, ssu.expires_at, s.kind, s.tags, s.metadata, s.created_at, s.updated_at` + pager.Columns() + `
         FROM secrets s
         JOIN shared_secrets_user ssu ON ssu.secret_id = s.id
-        WHERE s.owner_id = $1;
+        WHERE s.owner_id = $1 AND s.deleted_at IS NULL
+            AND (ssu.expires_at IS NULL OR ssu.expires_at > NOW())` + conditions + cursor + pager.OrderBy() + `;
     `
 
-    // Execute the query
-    rows, err := s.DB.QueryContext(ctx, query, userID)
-    if err != nil {
-        return nil, xerrors.DatabaseError(err, "secrets.GetSecretsSharedToOtherUsers - query execution")
-    }
-    defer rows.Close()
-
-    // Initialize a slice to hold the retrieved shared secret details
-    var sharedSecrets []FullSharedSecretUserDetail
-
-    // Iterate through the rows and scan the data into FullSharedSecretUserDetail structs
-    for rows.Next() {
-        var sharedSecret FullSharedSecretUserDetail
-        if err := rows.Scan(
-            &sharedSecret.SecretID,
-            &sharedSecret.Name,
-            &sharedSecret.EncryptedData,
-            &sharedSecret.IV,
-            &sharedSecret.OwnerID,
-            &sharedSecret.UserID,
-            &sharedSecret.Permission,
-            &sharedSecret.CreatedAt,
-            &sharedSecret.UpdatedAt,
-        ); err != nil {
-            return nil, xerrors.DatabaseError(err, "secrets.GetSecretsSharedToOtherUsers - scan error")
-        }
-        sharedSecrets = append(sharedSecrets, sharedSecret)
-    }
-
-    // Check for any error that may have occurred during iteration
-    if err := rows.Err(); err != nil {
-        return nil, xerrors.DatabaseError(err, "secrets.GetSecretsSharedToOtherUsers - rows error")
-    }
-
-    // Return the slice of shared secret records with full details
-    return &sharedSecrets, nil
+	// Execute the query
+	rows, err := s.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, "", xerrors.DatabaseError(err, "secrets.GetSecretsSharedToOtherUsers - query execution")
+	}
+	defer rows.Close()
+
+	// Initialize a slice to hold the retrieved shared secret details
+	var sharedSecrets []FullSharedSecretUserDetail
+
+	// Iterate through the rows and scan the data into FullSharedSecretUserDetail structs
+	for rows.Next() {
+		var sharedSecret FullSharedSecretUserDetail
+		var key envelope.Key
+		dest := []any{
+			&sharedSecret.SecretID,
+			&sharedSecret.Name,
+			&sharedSecret.EncryptedData,
+			&sharedSecret.IV,
+			&key.Wrapped,
+			&key.MasterKeyID,
+			&sharedSecret.Cipher,
+			&sharedSecret.CipherVersion,
+			&sharedSecret.OwnerID,
+			&sharedSecret.UserID,
+			&sharedSecret.Permission,
+			&sharedSecret.ExpiresAt,
+			&sharedSecret.Kind,
+			pq.Array(&sharedSecret.Tags),
+			&sharedSecret.Metadata,
+			&sharedSecret.CreatedAt,
+			&sharedSecret.UpdatedAt,
+		}
+		if err := rows.Scan(append(dest, pager.Dest()...)...); err != nil {
+			return nil, "", xerrors.DatabaseError(err, "secrets.GetSecretsSharedToOtherUsers - scan error")
+		}
+		if err := s.open(key, sharedSecret.SecretID, &sharedSecret.EncryptedData, &sharedSecret.IV, "secrets.GetSecretsSharedToOtherUsers"); err != nil {
+			return nil, "", err
+		}
+		if !pager.Keep() {
+			break
+		}
+		sharedSecrets = append(sharedSecrets, sharedSecret)
+	}
+
+	// Check for any error that may have occurred during iteration
+	if err := rows.Err(); err != nil {
+		return nil, "", xerrors.DatabaseError(err, "secrets.GetSecretsSharedToOtherUsers - rows error")
+	}
+
+	// Return the slice of shared secret records with full details
+	return &sharedSecrets, pager.Next(), nil
 }
 
-func (s *Secrets) GetSecretsSharedToGroups(userID int64) (*[]SharedSecretGroup, *xerrors.AppError) {
+func (s *Secrets) GetSecretsSharedToGroups(userID int64, filter SecretFilter, page core.Page) (*[]SharedSecretGroup, string, *xerrors.AppError) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
+	pager, appErr := groupShareListing.Pager(page, "secrets.GetSecretsSharedToGroups")
+	if appErr != nil {
+		return nil, "", appErr
+	}
+
 	// Prepare the SQL query to select secrets shared to groups
+	conditions, args := filter.where("s", []any{userID})
+	cursor, args := pager.Where(args)
 	query := `
-		SELECT s.id AS secret_id, ssg.group_id, ssg.permission
+		SELECT s.id AS secret_id, ssg.group_id, ssg.permission, ssg.expires_at` + pager.Columns() + `
 		FROM secrets s
 		JOIN shared_secrets_group ssg ON ssg.secret_id = s.id
-		WHERE s.owner_id = $1;
+		JOIN groups g ON g.id = ssg.group_id
+		WHERE s.owner_id = $1 AND s.deleted_at IS NULL AND g.deleted_at IS NULL
+			AND (ssg.expires_at IS NULL OR ssg.expires_at > NOW())` + conditions + cursor + pager.OrderBy() + `;
 	`
 
 	// Execute the query
-	rows, err := s.DB.QueryContext(ctx, query, userID)
+	rows, err := s.DB.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, xerrors.DatabaseError(err, "secrets.GetSecretsSharedToGroups")
+		return nil, "", xerrors.DatabaseError(err, "secrets.GetSecretsSharedToGroups")
 	}
 	defer rows.Close()
 
@@ -106,47 +175,67 @@ func (s *Secrets) GetSecretsSharedToGroups(userID int64) (*[]SharedSecretGroup,
 	// Iterate through the rows and scan the data into SharedSecretToGroup structs
 	for rows.Next() {
 		var sharedSecret SharedSecretGroup
-		if err := rows.Scan(&sharedSecret.SecretID, &sharedSecret.GroupID, &sharedSecret.Permission); err != nil {
-			return nil, xerrors.DatabaseError(err, "secrets.GetSecretsSharedToGroups - scan")
+		dest := append([]any{&sharedSecret.SecretID, &sharedSecret.GroupID, &sharedSecret.Permission, &sharedSecret.ExpiresAt}, pager.Dest()...)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, "", xerrors.DatabaseError(err, "secrets.GetSecretsSharedToGroups - scan")
+		}
+		if !pager.Keep() {
+			break
 		}
 		sharedSecrets = append(sharedSecrets, sharedSecret)
 	}
 
 	// Check for any error that may have occurred during iteration
 	if err := rows.Err(); err != nil {
-		return nil, xerrors.DatabaseError(err, "secrets.GetSecretsSharedToGroups - rows error")
+		return nil, "", xerrors.DatabaseError(err, "secrets.GetSecretsSharedToGroups - rows error")
 	}
 
 	// Return the slice of shared secret records
-	return &sharedSecrets, nil
+	return &sharedSecrets, pager.Next(), nil
 }
 
 type SharedSecretDetail struct {
-	SecretID      int64  `json:"secret_id"`
-	Name          string `json:"name"`
-	EncryptedData []byte `json:"encrypted_data"`
-	IV            []byte `json:"iv"`
-	OwnerID       int64  `json:"owner_id"`
-	Permission    string `json:"permission"`
+	SecretID       int64      `json:"secret_id"`
+	Name           string     `json:"name"`
+	EncryptedData  []byte     `json:"encrypted_data"`
+	IV             []byte     `json:"iv"`
+	Cipher         Cipher     `json:"cipher"`
+	CipherVersion  int        `json:"cipher_version"`
+	OwnerID        int64      `json:"owner_id"`
+	Permission     string     `json:"permission"`
+	ExpiresAt      *time.Time `json:"expires_at"`
+	WrappedKey     *string    `json:"wrapped_key"`
+	KeyFingerprint *string    `json:"key_fingerprint"`
+	Kind           Kind       `json:"kind"`
+	Tags           []string   `json:"tags"`
+	Metadata       Metadata   `json:"metadata"`
 }
 
 // GetSecretsSharedWithUser returns a list of secrets, including details, that are shared with the specified user.
-func (s *Secrets) GetSecretsSharedWithUser(userID int64) (*[]SharedSecretDetail, *xerrors.AppError) {
+func (s *Secrets) GetSecretsSharedWithUser(userID int64, filter SecretFilter, page core.Page) (*[]SharedSecretDetail, string, *xerrors.AppError) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
+	pager, appErr := secretListing.Pager(page, "secrets.GetSecretsSharedWithUser")
+	if appErr != nil {
+		return nil, "", appErr
+	}
+
 	// SQL query to select detailed information for secrets shared with the specified user
+	conditions, args := filter.where("s", []any{userID})
+	cursor, args := pager.Where(args)
 	query := `
-        SELECT s.id AS secret_id, s.name, s.encrypted_data, s.iv, s.owner_id, ssu.permission
+        SELECT s.id AS secret_id, s.name, ` + sealedColumns(page) + `, s.cipher, s.cipher_version, s.owner_id, ssu.permission, ssu.expires_at, ssu.wrapped_key, ssu.key_fingerprint, s.kind, s.tags, s.metadata` + pager.Columns() + `
         FROM secrets s
         JOIN shared_secrets_user ssu ON ssu.secret_id = s.id
-        WHERE ssu.user_id = $1;
+        WHERE ssu.user_id = $1 AND s.deleted_at IS NULL
+            AND (ssu.expires_at IS NULL OR ssu.expires_at > NOW())` + conditions + cursor + pager.OrderBy() + `;
     `
 
 	// Execute the query
-	rows, err := s.DB.QueryContext(ctx, query, userID)
+	rows, err := s.DB.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, xerrors.DatabaseError(err, "secrets.GetSecretsSharedWithUser")
+		return nil, "", xerrors.DatabaseError(err, "secrets.GetSecretsSharedWithUser")
 	}
 	defer rows.Close()
 
@@ -156,17 +245,26 @@ func (s *Secrets) GetSecretsSharedWithUser(userID int64) (*[]SharedSecretDetail,
 	// Iterate through the rows and scan the data into SharedSecretDetail structs
 	for rows.Next() {
 		var sharedSecret SharedSecretDetail
-		if err := rows.Scan(&sharedSecret.SecretID, &sharedSecret.Name, &sharedSecret.EncryptedData, &sharedSecret.IV, &sharedSecret.OwnerID, &sharedSecret.Permission); err != nil {
-			return nil, xerrors.DatabaseError(err, "secrets.GetSecretsSharedWithUser - scan")
+		var key envelope.Key
+		dest := append([]any{&sharedSecret.SecretID, &sharedSecret.Name, &sharedSecret.EncryptedData, &sharedSecret.IV, &key.Wrapped, &key.MasterKeyID, &sharedSecret.Cipher, &sharedSecret.CipherVersion, &sharedSecret.OwnerID, &sharedSecret.Permission,
+			&sharedSecret.ExpiresAt, &sharedSecret.WrappedKey, &sharedSecret.KeyFingerprint, &sharedSecret.Kind, pq.Array(&sharedSecret.Tags), &sharedSecret.Metadata}, pager.Dest()...)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, "", xerrors.DatabaseError(err, "secrets.GetSecretsSharedWithUser - scan")
+		}
+		if err := s.open(key, sharedSecret.SecretID, &sharedSecret.EncryptedData, &sharedSecret.IV, "secrets.GetSecretsSharedWithUser"); err != nil {
+			return nil, "", err
+		}
+		if !pager.Keep() {
+			break
 		}
 		sharedSecrets = append(sharedSecrets, sharedSecret)
 	}
 
 	// Check for any error that may have occurred during iteration
 	if err := rows.Err(); err != nil {
-		return nil, xerrors.DatabaseError(err, "secrets.GetSecretsSharedWithUser - rows error")
+		return nil, "", xerrors.DatabaseError(err, "secrets.GetSecretsSharedWithUser - rows error")
 	}
 
 	// Return the slice of detailed shared secret records
-	return &sharedSecrets, nil
+	return &sharedSecrets, pager.Next(), nil
 }
@@ -0,0 +1,267 @@
+package secrets
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"pm4devs.strawhats/internal/models/core"
+	"pm4devs.strawhats/internal/xerrors"
+)
+
+// The content key of a secret wrapped with the public key of a recipient
+type WrappedKey struct {
+	GroupID     int64   // Group the secret is shared with, 0 for a direct share
+	UserID      int64   // Recipient holding the private key
+	WrappedKey  string  // Opaque to the server
+	Fingerprint *string // Fingerprint of the public key the content key was wrapped with, as given by the client
+}
+
+// Content key of a secret wrapped for a recipient, given as the first and
+// second arguments. The key of a direct share is preferred over the keys of
+// the recipient's groups.
+const recipientKey = `
+	SELECT wrapped_key, key_fingerprint FROM (
+		SELECT ssu.wrapped_key, ssu.key_fingerprint, 0 AS priority
+		FROM shared_secrets_user ssu
+		WHERE ssu.secret_id = %[1]s AND ssu.user_id = %[2]s AND ssu.wrapped_key IS NOT NULL
+			AND (ssu.expires_at IS NULL OR ssu.expires_at > NOW())
+		UNION ALL
+		SELECT k.wrapped_key, k.key_fingerprint, 1 AS priority
+		FROM shared_secrets_group_keys k
+		JOIN shared_secrets_group ssg ON ssg.secret_id = k.secret_id AND ssg.group_id = k.group_id
+		JOIN group_members gm ON gm.group_id = k.group_id AND gm.user_id = k.user_id
+		WHERE k.secret_id = %[1]s AND k.user_id = %[2]s
+			AND (ssg.expires_at IS NULL OR ssg.expires_at > NOW())
+	) wrapped
+	ORDER BY priority
+	LIMIT 1`
+
+// Gets the content key of a secret wrapped for a recipient
+//
+// Returns nil if no key was stored for the recipient.
+func (s *Secrets) GetWrappedKey(secretID, userID int64) (*WrappedKey, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := fmt.Sprintf(recipientKey, "$1", "$2")
+
+	wrappedKey := WrappedKey{UserID: userID}
+	err := s.DB.QueryRowContext(ctx, query, secretID, userID).Scan(&wrappedKey.WrappedKey, &wrappedKey.Fingerprint)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, "secrets.GetWrappedKey")
+	}
+
+	return &wrappedKey, nil
+}
+
+// Stores content keys wrapped for the owner and the recipients of a secret
+//
+// The owner's key is left as is when nil. Keys replace the ones stored for
+// the same recipient. Every recipient must already have access through the
+// share the key belongs to, and every key must be wrapped with the active
+// public key of its recipient.
+func (s *Secrets) SetWrappedKeys(secretID int64, ownerKey *WrappedKey, keys []WrappedKey) *xerrors.AppError {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Start a new transaction
+	db, ok := s.DB.(*sql.DB)
+	if !ok {
+		return xerrors.DatabaseError(fmt.Errorf("failed to cast DB to *sql.DB"), "secrets.SetWrappedKeys")
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return xerrors.DatabaseError(err, "secrets.SetWrappedKeys")
+	}
+	// Rollback is a no-op once the transaction is committed
+	defer tx.Rollback()
+
+	var wrappedKey, fingerprint *string
+	if ownerKey != nil {
+		if err := checkFingerprint(ctx, tx, *ownerKey, "secrets.SetWrappedKeys"); err != nil {
+			return err
+		}
+		wrappedKey, fingerprint = &ownerKey.WrappedKey, ownerKey.Fingerprint
+	}
+
+	// The version is bumped as the key is part of the secret returned to each user
+	_, err = tx.ExecContext(ctx, `
+		UPDATE secrets
+		SET wrapped_key = COALESCE($1, wrapped_key), key_fingerprint = COALESCE($2, key_fingerprint),
+			version = version + 1
+		WHERE id = $3;
+	`, wrappedKey, fingerprint, secretID)
+	if err != nil {
+		return xerrors.DatabaseError(err, "secrets.SetWrappedKeys: failed to set owner key")
+	}
+
+	if err := storeWrappedKeys(ctx, tx, secretID, keys, "secrets.SetWrappedKeys"); err != nil {
+		return err
+	}
+
+	// Commit the transaction
+	if err = tx.Commit(); err != nil {
+		return xerrors.DatabaseError(err, "secrets.SetWrappedKeys: failed to commit transaction")
+	}
+
+	return nil
+}
+
+// Replaces the content of a secret encrypted with a new content key, along
+// with the keys wrapped for the owner and the recipients
+//
+// The owner's key and its fingerprint are the ones of the secret.
+// Keys wrapped for the previous content key are dropped, recipients left out
+// can no longer decrypt the secret. Clears the re-key flag, and versions kept
+// before can no longer be rolled back to. The version of the secret must
+// still match, as with Update.
+func (s *Secrets) Rekey(secret *SecretRecord, keys []WrappedKey) *xerrors.AppError {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Start a new transaction
+	db, ok := s.DB.(*sql.DB)
+	if !ok {
+		return xerrors.DatabaseError(fmt.Errorf("failed to cast DB to *sql.DB"), "secrets.Rekey")
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return xerrors.DatabaseError(err, "secrets.Rekey")
+	}
+	// Rollback is a no-op once the transaction is committed
+	defer tx.Rollback()
+
+	args, appErr := s.updateArgs(secret, "secrets.Rekey")
+	if appErr != nil {
+		return appErr
+	}
+
+	err = tx.QueryRowContext(ctx, updateQuery, args...).Scan(&secret.UpdatedAt, &secret.Version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return editConflict(secret.ID, "secrets.Rekey")
+	}
+	if err != nil {
+		return versionConflict(err, secret.ID, "secrets.Rekey: failed to update secret")
+	}
+
+	ownerKey := WrappedKey{UserID: secret.OwnerID, WrappedKey: *secret.WrappedKey, Fingerprint: secret.KeyFingerprint}
+	if err := checkFingerprint(ctx, tx, ownerKey, "secrets.Rekey"); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE secrets SET wrapped_key = $1, key_fingerprint = $2, rekey_required = false, rekeyed_version = version
+		WHERE id = $3;
+	`, secret.WrappedKey, secret.KeyFingerprint, secret.ID)
+	if err != nil {
+		return xerrors.DatabaseError(err, "secrets.Rekey: failed to set owner key")
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE shared_secrets_user SET wrapped_key = NULL, key_fingerprint = NULL WHERE secret_id = $1;`, secret.ID)
+	if err != nil {
+		return xerrors.DatabaseError(err, "secrets.Rekey: failed to drop user keys")
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM shared_secrets_group_keys WHERE secret_id = $1;`, secret.ID)
+	if err != nil {
+		return xerrors.DatabaseError(err, "secrets.Rekey: failed to drop group keys")
+	}
+
+	// Escrows hold the previous content key, the owner escrows the new one
+	_, err = tx.ExecContext(ctx, `DELETE FROM recovery_escrows WHERE secret_id = $1;`, secret.ID)
+	if err != nil {
+		return xerrors.DatabaseError(err, "secrets.Rekey: failed to drop escrows")
+	}
+
+	if err := storeWrappedKeys(ctx, tx, secret.ID, keys, "secrets.Rekey"); err != nil {
+		return err
+	}
+
+	// Commit the transaction
+	if err = tx.Commit(); err != nil {
+		return xerrors.DatabaseError(err, "secrets.Rekey: failed to commit transaction")
+	}
+
+	secret.RekeyRequired = false
+	return nil
+}
+
+// ============================================================================
+// Helpers
+// ============================================================================
+
+// Checks that a key was wrapped with the active public key of its recipient,
+// so the fingerprint stored along with it names the key the client used
+//
+// Keys wrapped with a key rotated in the meantime are rejected for the client
+// to fetch the new public key and wrap again.
+func checkFingerprint(ctx context.Context, db core.Queryable, key WrappedKey, op string) *xerrors.AppError {
+	var active string
+	err := db.QueryRowContext(ctx, `
+		SELECT fingerprint FROM user_keys WHERE user_id = $1 AND status = 'active';
+	`, key.UserID).Scan(&active)
+	if errors.Is(err, sql.ErrNoRows) {
+		return xerrors.ClientError(http.StatusConflict,
+			fmt.Sprintf("User %d has no active public key to wrap the content key with", key.UserID),
+			op, xerrors.ErrEditConflict)
+	}
+	if err != nil {
+		return xerrors.DatabaseError(err, op+": failed to get active key")
+	}
+
+	if key.Fingerprint == nil || *key.Fingerprint != active {
+		return xerrors.ClientError(http.StatusConflict,
+			fmt.Sprintf("The content key for user %d must be wrapped with their active public key %s", key.UserID, active),
+			op, xerrors.ErrEditConflict)
+	}
+	return nil
+}
+
+// Stores wrapped keys of recipients in a transaction
+func storeWrappedKeys(ctx context.Context, tx *sql.Tx, secretID int64, keys []WrappedKey, op string) *xerrors.AppError {
+	for _, key := range keys {
+		if err := checkFingerprint(ctx, tx, key, op); err != nil {
+			return err
+		}
+
+		if key.GroupID == 0 {
+			result, err := tx.ExecContext(ctx, `
+				UPDATE shared_secrets_user SET wrapped_key = $1, key_fingerprint = $4, updated_at = NOW()
+				WHERE secret_id = $2 AND user_id = $3;
+			`, key.WrappedKey, secretID, key.UserID, key.Fingerprint)
+			if err != nil {
+				return xerrors.DatabaseError(err, op+": failed to store user key")
+			}
+			rowsAffected, appErr := core.RowsAffected(result, op)
+			if appErr != nil {
+				return appErr
+			}
+			if rowsAffected == 0 {
+				return xerrors.ClientError(http.StatusNotFound,
+					fmt.Sprintf("Secret %d is not shared with user %d", secretID, key.UserID),
+					op, xerrors.ErrNotFound)
+			}
+			continue
+		}
+
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO shared_secrets_group_keys (secret_id, group_id, user_id, wrapped_key, key_fingerprint)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (secret_id, group_id, user_id) DO UPDATE
+			SET wrapped_key = EXCLUDED.wrapped_key, key_fingerprint = EXCLUDED.key_fingerprint;
+		`, secretID, key.GroupID, key.UserID, key.WrappedKey, key.Fingerprint)
+		if err != nil {
+			return xerrors.DatabaseError(err, op+": failed to store group key")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,63 @@
+package secrets
+
+import "pm4devs.strawhats/internal/validator"
+
+// The kind of credential stored in a secret. It decides which plaintext
+// metadata is expected alongside the encrypted data.
+type Kind string
+
+const (
+	KindLogin          Kind = "login"
+	KindAPIKey         Kind = "api_key"
+	KindSSHKey         Kind = "ssh_key"
+	KindDatabase       Kind = "database"
+	KindTLSCertificate Kind = "tls_certificate"
+	KindNote           Kind = "note"
+	KindEnvFile        Kind = "env_file"
+)
+
+// The metadata schema of every kind. Keys outside the schema are free-form.
+var kindSchemas = map[Kind]validator.Schema{
+	KindLogin: {
+		"url":      {Type: validator.FieldURL},
+		"username": {Type: validator.FieldText},
+	},
+	KindAPIKey: {
+		"service": {Type: validator.FieldText},
+		"url":     {Type: validator.FieldURL},
+		"expires": {Type: validator.FieldDate},
+	},
+	KindSSHKey: {
+		"host":        {Type: validator.FieldHost},
+		"username":    {Type: validator.FieldText},
+		"fingerprint": {Type: validator.FieldText},
+	},
+	KindDatabase: {
+		"engine":   {Type: validator.FieldText},
+		"host":     {Type: validator.FieldHost, Required: true},
+		"port":     {Type: validator.FieldPort},
+		"database": {Type: validator.FieldText},
+		"username": {Type: validator.FieldText},
+	},
+	KindTLSCertificate: {
+		"domain":  {Type: validator.FieldHost, Required: true},
+		"issuer":  {Type: validator.FieldText},
+		"expires": {Type: validator.FieldDate, Required: true},
+	},
+	KindNote: {},
+	KindEnvFile: {
+		"service":     {Type: validator.FieldText},
+		"environment": {Type: validator.FieldText},
+	},
+}
+
+// Reports whether k is a known kind
+func (k Kind) Valid() bool {
+	_, ok := kindSchemas[k]
+	return ok
+}
+
+// Returns the metadata schema of the kind
+func (k Kind) Schema() validator.Schema {
+	return kindSchemas[k]
+}
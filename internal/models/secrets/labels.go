@@ -0,0 +1,132 @@
+package secrets
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"pm4devs.strawhats/internal/models/core"
+	"pm4devs.strawhats/internal/xerrors"
+)
+
+// Metadata holds plaintext key/value pairs describing a secret, such as the
+// service, environment or owning team. It is stored as jsonb.
+type Metadata map[string]string
+
+// Implements driver.Valuer
+func (m Metadata) Value() (driver.Value, error) {
+	if m == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(m)
+}
+
+// Implements sql.Scanner
+func (m *Metadata) Scan(src any) error {
+	switch src := src.(type) {
+	case nil:
+		*m = Metadata{}
+		return nil
+	case []byte:
+		return json.Unmarshal(src, m)
+	case string:
+		return json.Unmarshal([]byte(src), m)
+	default:
+		return fmt.Errorf("secrets.Metadata: cannot scan %T", src)
+	}
+}
+
+// SecretFilter narrows down secret listings. Zero values are ignored.
+type SecretFilter struct {
+	NamePrefix    string     // Case-insensitive prefix of the secret name
+	Kind          Kind       // Kind of credential
+	Tags          []string   // Secrets must carry every tag
+	Metadata      Metadata   // Secrets must contain every key/value pair
+	CreatedAfter  *time.Time // Inclusive lower bound on created_at
+	CreatedBefore *time.Time // Exclusive upper bound on created_at
+	UpdatedAfter  *time.Time // Inclusive lower bound on updated_at
+	UpdatedBefore *time.Time // Exclusive upper bound on updated_at
+	IDs           []int64    // Secrets must be among these, as with restricted access tokens
+}
+
+// Builds the SQL conditions for the filter against the secrets table aliased
+// as alias. Placeholders continue from the args already given.
+func (f SecretFilter) where(alias string, args []any) (string, []any) {
+	var conditions []string
+	add := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, alias, len(args)))
+	}
+
+	if f.NamePrefix != "" {
+		add("starts_with(lower(%s.name), lower($%d))", f.NamePrefix)
+	}
+	if f.Kind != "" {
+		add("%s.kind = $%d", f.Kind)
+	}
+	if len(f.Tags) > 0 {
+		add("%s.tags @> $%d", pq.Array(f.Tags))
+	}
+	if len(f.Metadata) > 0 {
+		add("%s.metadata @> $%d", f.Metadata)
+	}
+	if f.CreatedAfter != nil {
+		add("%s.created_at >= $%d", *f.CreatedAfter)
+	}
+	if f.CreatedBefore != nil {
+		add("%s.created_at < $%d", *f.CreatedBefore)
+	}
+	if f.UpdatedAfter != nil {
+		add("%s.updated_at >= $%d", *f.UpdatedAfter)
+	}
+	if f.UpdatedBefore != nil {
+		add("%s.updated_at < $%d", *f.UpdatedBefore)
+	}
+	if f.IDs != nil {
+		add("%s.id = ANY($%d)", pq.Array(f.IDs))
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return " AND " + strings.Join(conditions, " AND "), args
+}
+
+// Replaces the kind, tags and metadata of a secret
+func (s *Secrets) SetLabels(secretID int64, kind Kind, tags []string, metadata Metadata) *xerrors.AppError {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if tags == nil {
+		tags = []string{}
+	}
+
+	query := `
+		UPDATE secrets
+		SET kind = $1, tags = $2, metadata = $3, updated_at = NOW(), version = version + 1
+		WHERE id = $4 AND deleted_at IS NULL;
+	`
+
+	result, err := s.DB.ExecContext(ctx, query, kind, pq.Array(tags), metadata, secretID)
+	if err != nil {
+		return xerrors.DatabaseError(err, "secrets.SetLabels")
+	}
+
+	rowsAffected, appErr := core.RowsAffected(result, "secrets.SetLabels")
+	if appErr != nil {
+		return appErr
+	}
+
+	if rowsAffected == 0 {
+		return xerrors.ClientError(http.StatusNotFound,
+			fmt.Sprintf("No secret found with id: %d", secretID),
+			"secrets.SetLabels", xerrors.ErrNotFound)
+	}
+
+	return nil
+}
@@ -3,12 +3,16 @@ package secrets
 import (
 	"context"
 	"database/sql"
+	"fmt"
+	"net/http"
 	"time"
 
 	"pm4devs.strawhats/internal/xerrors"
 )
 
-// GetUserSecretPermission retrieves the permission of a user for a given secret
+// GetUserSecretPermission retrieves the permission of a user for a given secret,
+// the highest of the ones shared with them directly, through their groups and
+// through folders
 func (s *Secrets) GetUserSecretPermission(userID int64, secretID int64) (
 	Permission,
 	*xerrors.AppError,
@@ -16,26 +20,39 @@ func (s *Secrets) GetUserSecretPermission(userID int64, secretID int64) (
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	if currSecret, err := s.GetSecretByID(secretID); err != nil {
-		return NOTALLOWED, err
-	} else if currSecret.OwnerID == userID {
+	// Check for ownership, without decrypting the secret
+	var ownerID int64
+	var deletedAt *time.Time
+	err := s.DB.QueryRowContext(ctx, `SELECT owner_id, deleted_at FROM secrets WHERE id = $1`, secretID).
+		Scan(&ownerID, &deletedAt)
+	if err == sql.ErrNoRows || (err == nil && deletedAt != nil) {
+		return NOTALLOWED, xerrors.ClientError(http.StatusNotFound,
+			fmt.Sprintf("No secret found with id: %d", secretID), "secrets.GetUserSecretPermission",
+			fmt.Errorf("Secret not found with id: %d", secretID))
+	} else if err != nil {
+		return NOTALLOWED, xerrors.DatabaseError(err, "secrets.GetUserSecretPermission (owner check)")
+	} else if ownerID == userID {
 		return ReadWrite, nil
 	}
 
+	// Read-write is the highest permission, read-only ones are kept until every
+	// share is checked
+	best := NOTALLOWED
+
 	// Check for direct user permission
 	directPermissionQuery := `
 		SELECT permission
 		FROM shared_secrets_user
-		WHERE secret_id = $1 AND user_id = $2;
+		WHERE secret_id = $1 AND user_id = $2 AND (expires_at IS NULL OR expires_at > NOW());
 	`
 
 	var permission string
-	err := s.DB.QueryRowContext(ctx, directPermissionQuery, secretID, userID).Scan(&permission)
+	err = s.DB.QueryRowContext(ctx, directPermissionQuery, secretID, userID).Scan(&permission)
 
 	if err == nil {
 		// Direct permission found
 		if permission == "read-only" {
-			return ReadOnly, nil
+			best = ReadOnly
 		} else if permission == "read-write" {
 			return ReadWrite, nil
 		}
@@ -48,7 +65,10 @@ func (s *Secrets) GetUserSecretPermission(userID int64, secretID int64) (
 		SELECT sg.permission
 		FROM shared_secrets_group sg
 		JOIN group_members gm ON gm.group_id = sg.group_id
-		WHERE sg.secret_id = $1 AND gm.user_id = $2
+		JOIN groups g ON g.id = sg.group_id
+		WHERE sg.secret_id = $1 AND gm.user_id = $2 AND g.deleted_at IS NULL
+			AND (sg.expires_at IS NULL OR sg.expires_at > NOW())
+		ORDER BY sg.permission DESC
 		LIMIT 1;
 	`
 
@@ -57,7 +77,7 @@ func (s *Secrets) GetUserSecretPermission(userID int64, secretID int64) (
 	if err == nil {
 		// Group permission found
 		if permission == "read-only" {
-			return ReadOnly, nil
+			best = ReadOnly
 		} else if permission == "read-write" {
 			return ReadWrite, nil
 		}
@@ -65,6 +85,44 @@ func (s *Secrets) GetUserSecretPermission(userID int64, secretID int64) (
 		return NOTALLOWED, xerrors.DatabaseError(err, "secrets.GetUserSecretPermission (group permission check)")
 	}
 
-	// If no permissions found
-	return NOTALLOWED, nil
+	// Check if the secret sits inside a folder shared with the user or one of
+	// their groups. Shares apply to every folder nested below them.
+	folderPermissionQuery := `
+		WITH RECURSIVE ancestors AS (
+			SELECT f.id, f.parent_id
+			FROM folders f
+			JOIN secrets s ON s.folder_id = f.id
+			WHERE s.id = $1
+			UNION ALL
+			SELECT folders.id, folders.parent_id FROM folders JOIN ancestors ON folders.id = ancestors.parent_id
+		)
+		SELECT permission FROM (
+			SELECT sfu.permission
+			FROM shared_folders_user sfu
+			WHERE sfu.folder_id IN (SELECT id FROM ancestors) AND sfu.user_id = $2
+			UNION ALL
+			SELECT sfg.permission
+			FROM shared_folders_group sfg
+			JOIN group_members gm ON gm.group_id = sfg.group_id
+			JOIN groups g ON g.id = sfg.group_id
+			WHERE sfg.folder_id IN (SELECT id FROM ancestors) AND gm.user_id = $2 AND g.deleted_at IS NULL
+		) AS grants
+		ORDER BY permission DESC
+		LIMIT 1;
+	`
+
+	err = s.DB.QueryRowContext(ctx, folderPermissionQuery, secretID, userID).Scan(&permission)
+
+	if err == nil {
+		// Folder permission found
+		if permission == "read-only" {
+			best = ReadOnly
+		} else if permission == "read-write" {
+			return ReadWrite, nil
+		}
+	} else if err != sql.ErrNoRows {
+		return NOTALLOWED, xerrors.DatabaseError(err, "secrets.GetUserSecretPermission (folder permission check)")
+	}
+
+	return best, nil
 }
@@ -6,10 +6,22 @@ import (
 
 // SecretRecord represents the secrets table in the database.
 type SecretRecord struct {
-	ID            int64     `db:"id" json:"id"`                       // Bigserial primary key
-	Name          string    `db:"name" json:"name"`                   // Name of the secret
-	EncryptedData []byte    `db:"encrypted_data" json:"encrypted_data"` // Encrypted credentials (bytea)
-	IV            []byte    `db:"iv" json:"iv"`                       // Initialization Vector (bytea)
-	OwnerID       int64     `db:"owner_id" json:"owner_id"`           // Foreign key referencing users(id)
-	CreatedAt     time.Time `db:"created_at" json:"created_at"`       // Timestamp with time zone
+	ID             int64      `db:"id" json:"id"`                           // Bigserial primary key
+	Name           string     `db:"name" json:"name"`                       // Name of the secret
+	EncryptedData  []byte     `db:"encrypted_data" json:"encrypted_data"`   // Encrypted credentials (bytea)
+	IV             []byte     `db:"iv" json:"iv"`                           // Initialization Vector (bytea)
+	Cipher         Cipher     `db:"cipher" json:"cipher"`                   // Algorithm the data is encrypted with
+	CipherVersion  int        `db:"cipher_version" json:"cipher_version"`   // Format of the encrypted data and IV for the cipher
+	OwnerID        int64      `db:"owner_id" json:"owner_id"`               // Foreign key referencing users(id)
+	FolderID       *int64     `db:"folder_id" json:"folder_id"`             // Foreign key referencing folders(id), NULL at the root
+	Kind           Kind       `db:"kind" json:"kind"`                       // Kind of credential, decides the metadata schema
+	Tags           []string   `db:"tags" json:"tags"`                       // Plaintext tags used for search
+	Metadata       Metadata   `db:"metadata" json:"metadata"`               // Plaintext key/value pairs used for search
+	CreatedAt      time.Time  `db:"created_at" json:"created_at"`           // Timestamp with time zone
+	UpdatedAt      time.Time  `db:"updated_at" json:"updated_at"`           // Timestamp with time zone
+	DeletedAt      *time.Time `db:"deleted_at" json:"deleted_at,omitempty"` // Set while the secret is in the trash
+	Version        int        `db:"version" json:"version"`                 // Bumped on every change, used for optimistic locking
+	WrappedKey     *string    `db:"wrapped_key" json:"wrapped_key"`         // Content key wrapped for the caller, NULL if none was stored
+	KeyFingerprint *string    `db:"key_fingerprint" json:"key_fingerprint"` // Fingerprint of the public key the content key was wrapped with
+	RekeyRequired  bool       `db:"rekey_required" json:"rekey_required"`   // Set when a recipient lost access until the content key is replaced
 }
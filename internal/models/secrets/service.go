@@ -7,6 +7,8 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/lib/pq"
+	"pm4devs.strawhats/internal/envelope"
 	"pm4devs.strawhats/internal/models/core"
 	"pm4devs.strawhats/internal/models/users"
 	"pm4devs.strawhats/internal/xerrors"
@@ -21,130 +23,207 @@ const (
 )
 
 type SecretsRepository interface {
-	GetByUserID(id int64) (*[]SecretRecord, *xerrors.AppError)
+	GetByUserID(id int64, filter SecretFilter, page core.Page) (*[]SecretRecord, string, *xerrors.AppError)
 	GetByUserEmail(email string) (*[]SecretRecord, *xerrors.AppError)
-	GetByGroupID(id int64) (*[]SecretRecord, *xerrors.AppError)
-	NewRecord(name, EncryptedData, IV string, ownerID int64) (*SecretRecord, *xerrors.AppError)
-	Delete(secretID int64) *xerrors.AppError
-	Update(secretID int64, newName, newEncryptedData, IV string) *xerrors.AppError
+	GetByGroupID(id, userID int64, page core.Page) (*[]SecretRecord, string, *xerrors.AppError)
+	NewRecord(secret *SecretRecord) *xerrors.AppError
+	Delete(secretID int64, version int) *xerrors.AppError
+	Update(secret *SecretRecord) *xerrors.AppError
 	GetSecretByID(secretID int64) (*SecretRecord, *xerrors.AppError)
-	ShareToGroup(secretID, groupID int64, permission Permission) *xerrors.AppError
-	ShareToUser(secretID, userID int64, permission Permission) *xerrors.AppError
-	UpdateGroupPermission(secretID, groupID int64, permission Permission) *xerrors.AppError
-	UpdateUserPermission(secretID, userID int64, permission Permission) *xerrors.AppError
+	ShareToGroup(secretID, groupID int64, permission Permission, expiresAt *time.Time, keys []WrappedKey) *xerrors.AppError
+	ShareToUser(secretID, userID int64, permission Permission, expiresAt *time.Time, wrappedKey *WrappedKey) *xerrors.AppError
+	UpdateGroupPermission(secretID, groupID int64, permission Permission, expiresAt *time.Time, clearExpiry bool) *xerrors.AppError
+	UpdateUserPermission(secretID, userID int64, permission Permission, expiresAt *time.Time, clearExpiry bool) *xerrors.AppError
 	RevokeFromGroup(secretID, groupID int64) *xerrors.AppError
 	RevokeFromUser(secretID, userID int64) *xerrors.AppError
 	GetUserSecretPermission(userID int64, secretID int64) (Permission, *xerrors.AppError)
-	GetSecretsSharedToOtherUsers(userID int64) (*[]FullSharedSecretUserDetail, *xerrors.AppError)
-	GetSecretsSharedToGroups(userID int64) (*[]SharedSecretGroup, *xerrors.AppError)
-	GetSecretsSharedWithUser(userID int64) (*[]SharedSecretDetail, *xerrors.AppError)
+	GetSecretsSharedToOtherUsers(userID int64, filter SecretFilter, page core.Page) (*[]FullSharedSecretUserDetail, string, *xerrors.AppError)
+	GetSecretsSharedToGroups(userID int64, filter SecretFilter, page core.Page) (*[]SharedSecretGroup, string, *xerrors.AppError)
+	GetSecretsSharedWithUser(userID int64, filter SecretFilter, page core.Page) (*[]SharedSecretDetail, string, *xerrors.AppError)
+	SetLabels(secretID int64, kind Kind, tags []string, metadata Metadata) *xerrors.AppError
+	GetVersions(secretID int64) (*[]SecretVersionRecord, *xerrors.AppError)
+	GetVersion(secretID int64, version int) (*SecretVersionRecord, *xerrors.AppError)
+	Rollback(secretID int64, version int) *xerrors.AppError
+	GetDeletedByUserID(userID int64, page core.Page) (*[]SecretRecord, string, *xerrors.AppError)
+	Restore(secretID, ownerID int64) *xerrors.AppError
+	Purge(secretID, ownerID int64) *xerrors.AppError
+	PurgeDeletedBefore(cutoff time.Time) (int64, *xerrors.AppError)
+	DeleteExpiredShares() (*[]ExpiredShare, *xerrors.AppError)
+	ProposeTransfer(secretID, fromUserID, toUserID int64) *xerrors.AppError
+	GetTransfers(userID int64) (*[]TransferRecord, *xerrors.AppError)
+	AcceptTransfer(secretID, toUserID int64) *xerrors.AppError
+	CancelTransfer(secretID, userID int64) *xerrors.AppError
+	ForceTransfer(secretID, toUserID int64) *xerrors.AppError
+	ForceTransferAll(fromUserID, toUserID int64) (int64, *xerrors.AppError)
+	GetWrappedKey(secretID, userID int64) (*WrappedKey, *xerrors.AppError)
+	SetWrappedKeys(secretID int64, ownerKey *WrappedKey, keys []WrappedKey) *xerrors.AppError
+	Rekey(secret *SecretRecord, keys []WrappedKey) *xerrors.AppError
+	RewrapKeys(batchSize int) (int64, *xerrors.AppError)
 }
 
+// Encrypted data and IVs are encrypted again at rest with the envelope
 type Secrets struct {
-	DB core.Queryable
+	DB       core.Queryable
+	Envelope *envelope.Envelope
 }
 
-func Repository(db core.Queryable) SecretsRepository {
-	return &Secrets{DB: db}
+func Repository(db core.Queryable, envelope *envelope.Envelope) SecretsRepository {
+	return &Secrets{DB: db, Envelope: envelope}
 }
 
-func (s *Secrets) GetByGroupID(id int64) (*[]SecretRecord, *xerrors.AppError) {
+// Lists the secrets shared with a group, with the content key wrapped for the
+// given member
+func (s *Secrets) GetByGroupID(id, userID int64, page core.Page) (*[]SecretRecord, string, *xerrors.AppError) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
+	pager, appErr := secretListing.Pager(page, "secrets.GetByGroupID")
+	if appErr != nil {
+		return nil, "", appErr
+	}
+
 	// SQL query to get secrets shared with the group
+	cursor, args := pager.Where([]any{id, userID})
 	query := `
-		SELECT secrets.id, secrets.name, secrets.encrypted_data, secrets.created_at
-		FROM secrets
-		INNER JOIN shared_secrets_group ON shared_secrets_group.secret_id = secrets.id
-		WHERE shared_secrets_group.group_id = $1;
+		SELECT s.id, s.name, ` + sealedColumns(page) + `, s.cipher, s.cipher_version, s.kind, s.tags, s.metadata, s.created_at, s.updated_at, s.version,
+			k.wrapped_key, k.key_fingerprint` + pager.Columns() + `
+		FROM secrets s
+		INNER JOIN shared_secrets_group ssg ON ssg.secret_id = s.id
+		LEFT JOIN shared_secrets_group_keys k
+			ON k.secret_id = ssg.secret_id AND k.group_id = ssg.group_id AND k.user_id = $2
+		WHERE ssg.group_id = $1 AND s.deleted_at IS NULL
+			AND (ssg.expires_at IS NULL OR ssg.expires_at > NOW())` + cursor + pager.OrderBy() + `;
 	`
 
 	// Slice to hold the results
 	var secrets []SecretRecord
 
 	// Execute the query and iterate over the rows
-	rows, err := s.DB.QueryContext(ctx, query, id)
+	rows, err := s.DB.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, xerrors.DatabaseError(err, "secrets.GetByGroupID")
+		return nil, "", xerrors.DatabaseError(err, "secrets.GetByGroupID")
 	}
 	defer rows.Close()
 
 	// Loop through the rows and scan the data into the SecretRecord slice
 	for rows.Next() {
 		var secret SecretRecord
-		if err := rows.Scan(&secret.ID, &secret.Name, &secret.EncryptedData, &secret.CreatedAt); err != nil {
-			return nil, xerrors.DatabaseError(err, "secrets.GetByGroupID.Scan")
+		var key envelope.Key
+		dest := append([]any{&secret.ID, &secret.Name, &secret.EncryptedData, &secret.IV, &key.Wrapped, &key.MasterKeyID, &secret.Cipher, &secret.CipherVersion, &secret.Kind,
+			pq.Array(&secret.Tags), &secret.Metadata, &secret.CreatedAt, &secret.UpdatedAt, &secret.Version,
+			&secret.WrappedKey, &secret.KeyFingerprint}, pager.Dest()...)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, "", xerrors.DatabaseError(err, "secrets.GetByGroupID.Scan")
+		}
+		if err := s.open(key, secret.ID, &secret.EncryptedData, &secret.IV, "secrets.GetByGroupID"); err != nil {
+			return nil, "", err
+		}
+		if !pager.Keep() {
+			break
 		}
 		secrets = append(secrets, secret)
 	}
 
 	// Check for any error that might have occurred during iteration
 	if err := rows.Err(); err != nil {
-		return nil, xerrors.DatabaseError(err, "secrets.GetByGroupID.Rows")
+		return nil, "", xerrors.DatabaseError(err, "secrets.GetByGroupID.Rows")
 	}
 
-	return &secrets, nil
+	return &secrets, pager.Next(), nil
 }
 
 // func (s *Secrets) GetByGroupName(name string) (*[]SecretRecord, *xerrors.AppError) {
 //
 // }
 
+// Lists the first page of secrets owned by the user with the given email
 func (s *Secrets) GetByUserEmail(email string) (*[]SecretRecord, *xerrors.AppError) {
 	userRepo := users.Users{DB: s.DB}
 	user, err := userRepo.GetByEmail(email)
 	if err != nil {
 		return nil, err
 	}
-	return s.GetByUserID(user.ID)
+	secrets, _, err := s.GetByUserID(user.ID, SecretFilter{}, core.Page{Limit: core.MaxPageLimit})
+	return secrets, err
 }
 
-func (s *Secrets) NewRecord(name, encryptedData, iv string, ownerID int64) (*SecretRecord, *xerrors.AppError) {
+// Creates a secret along with its labels and the content key wrapped for its
+// owner, if any, in a single statement so none is stored without the others
+//
+// The owner's key must be wrapped with their active public key, named by the
+// key fingerprint of the secret. The ID, creation time and version are set on
+// the secret.
+func (s *Secrets) NewRecord(secret *SecretRecord) *xerrors.AppError {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
+	if secret.Tags == nil {
+		secret.Tags = []string{}
+	}
+
+	if secret.WrappedKey != nil {
+		ownerKey := WrappedKey{UserID: secret.OwnerID, WrappedKey: *secret.WrappedKey, Fingerprint: secret.KeyFingerprint}
+		if err := checkFingerprint(ctx, s.DB, ownerKey, "secrets.New"); err != nil {
+			return err
+		}
+	}
+
+	// The data and IV are bound to the ID of the secret, taken before it is
+	// inserted
+	err := s.DB.QueryRowContext(ctx, `SELECT nextval(pg_get_serial_sequence('secrets', 'id'));`).Scan(&secret.ID)
+	if err != nil {
+		return xerrors.DatabaseError(err, "secrets.New - id")
+	}
+
+	// Encrypt the data and IV at rest
+	key, sealed, appErr := s.seal(Binding(secret.ID), secret.EncryptedData, secret.IV, "secrets.New")
+	if appErr != nil {
+		return appErr
+	}
+
 	// Prepare the SQL query to insert a new secret
 	query := `
-		INSERT INTO secrets (name, encrypted_data, iv, owner_id, created_at)
-		VALUES ($1, $2, $3, $4, NOW())
-		RETURNING id, created_at;
+		INSERT INTO secrets (id, name, encrypted_data, iv, cipher, cipher_version, owner_id, kind, tags, metadata,
+			wrapped_key, key_fingerprint, data_key, master_key_id, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, NOW())
+		RETURNING created_at, version;
 	`
 
-	// Create a new SecretRecord instance to hold the result
-	var secret SecretRecord
-
 	// Execute the insert statement with the provided values
-	err := s.DB.QueryRowContext(ctx, query, name, []byte(encryptedData), []byte(iv),
-		ownerID).Scan(&secret.ID, &secret.CreatedAt)
+	err = s.DB.QueryRowContext(ctx, query, secret.ID, secret.Name, sealed[0], sealed[1], secret.Cipher,
+		secret.CipherVersion, secret.OwnerID, secret.Kind, pq.Array(secret.Tags), secret.Metadata, secret.WrappedKey,
+		secret.KeyFingerprint, key.Wrapped, key.MasterKeyID).Scan(&secret.CreatedAt, &secret.Version)
 	if err != nil {
-		return nil, xerrors.DatabaseError(err, "secrets.New")
+		return xerrors.DatabaseError(err, "secrets.New")
 	}
 
-	// Set the Name and EncryptedData fields
-	secret.Name = name
-	secret.EncryptedData = []byte(encryptedData)
-	secret.IV = []byte(encryptedData)
-
-	// Return the newly created secret record
-	return &secret, nil
+	return nil
 }
 
-func (s *Secrets) GetByUserID(userID int64) (*[]SecretRecord, *xerrors.AppError) {
+// Lists the user's secrets matching the filter
+func (s *Secrets) GetByUserID(userID int64, filter SecretFilter, page core.Page) (*[]SecretRecord, string, *xerrors.AppError) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
+	pager, appErr := secretListing.Pager(page, "secrets.GetByUserID")
+	if appErr != nil {
+		return nil, "", appErr
+	}
+
 	// Prepare the SQL query to select secrets for the given user ID
+	conditions, args := filter.where("s", []any{userID})
+	cursor, args := pager.Where(args)
 	query := `
-		SELECT id, name, encrypted_data, iv, created_at
-		FROM secrets
-		WHERE owner_id = $1;
+		SELECT s.id, s.name, ` + sealedColumns(page) + `, s.cipher, s.cipher_version, s.folder_id, s.kind, s.tags, s.metadata, s.created_at, s.updated_at, s.version,
+			s.wrapped_key, s.key_fingerprint, s.rekey_required` + pager.Columns() + `
+		FROM secrets s
+		WHERE s.owner_id = $1 AND s.deleted_at IS NULL` + conditions + cursor + pager.OrderBy() + `;
 	`
 
 	// Execute the query
-	rows, err := s.DB.QueryContext(ctx, query, userID)
+	rows, err := s.DB.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, xerrors.DatabaseError(err, "secrets.GetByUserID")
+		return nil, "", xerrors.DatabaseError(err, "secrets.GetByUserID")
 	}
 	defer rows.Close()
 
@@ -154,32 +233,46 @@ func (s *Secrets) GetByUserID(userID int64) (*[]SecretRecord, *xerrors.AppError)
 	// Iterate through the rows and scan the data into SecretRecord structs
 	for rows.Next() {
 		var secret SecretRecord
-		if err := rows.Scan(&secret.ID, &secret.Name, &secret.EncryptedData, &secret.IV, &secret.CreatedAt); err != nil {
-			return nil, xerrors.DatabaseError(err, "secrets.GetByUserID - scan")
+		var key envelope.Key
+		dest := append([]any{&secret.ID, &secret.Name, &secret.EncryptedData, &secret.IV, &key.Wrapped, &key.MasterKeyID, &secret.Cipher, &secret.CipherVersion, &secret.FolderID,
+			&secret.Kind, pq.Array(&secret.Tags), &secret.Metadata, &secret.CreatedAt, &secret.UpdatedAt, &secret.Version,
+			&secret.WrappedKey, &secret.KeyFingerprint, &secret.RekeyRequired}, pager.Dest()...)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, "", xerrors.DatabaseError(err, "secrets.GetByUserID - scan")
+		}
+		if err := s.open(key, secret.ID, &secret.EncryptedData, &secret.IV, "secrets.GetByUserID"); err != nil {
+			return nil, "", err
+		}
+		if !pager.Keep() {
+			break
 		}
 		secrets = append(secrets, secret)
 	}
 
 	// Check for any error that may have occurred during iteration
 	if err := rows.Err(); err != nil {
-		return nil, xerrors.DatabaseError(err, "secrets.GetByUserID - rows error")
+		return nil, "", xerrors.DatabaseError(err, "secrets.GetByUserID - rows error")
 	}
 
 	// Return the slice of secret records
-	return &secrets, nil
+	return &secrets, pager.Next(), nil
 }
 
-// Delete a secret by secret ID and owner ID
-func (s *Secrets) Delete(secretID int64) *xerrors.AppError {
+// Delete a secret by secret ID, at the version it was read at
+//
+// The secret is moved to the trash and keeps its shares so it can be restored.
+// Returns xerrors.ErrEditConflict if the secret changed since it was read.
+func (s *Secrets) Delete(secretID int64, version int) *xerrors.AppError {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
 	query := `
-		DELETE FROM secrets
-		WHERE id = $1;
+		UPDATE secrets
+		SET deleted_at = NOW()
+		WHERE id = $1 AND version = $2 AND deleted_at IS NULL;
 	`
 
-	result, err := s.DB.ExecContext(ctx, query, secretID)
+	result, err := s.DB.ExecContext(ctx, query, secretID, version)
 	if err != nil {
 		return xerrors.DatabaseError(err, "secrets.Delete")
 	}
@@ -190,27 +283,43 @@ func (s *Secrets) Delete(secretID int64) *xerrors.AppError {
 	}
 
 	if rowsAffected == 0 {
-		return xerrors.DatabaseError(fmt.Errorf("No secret found with id: %d", secretID),
-			"secrets.Delete")
+		return editConflict(secretID, "secrets.Delete")
 	}
 
 	return nil
 }
 
-// Update a secret by secret ID
-func (s *Secrets) Update(secretID int64, newName, newEncryptedData, iv string) *xerrors.AppError {
+// Updates a secret using optimistic locking.
+//
+// The previous name, encrypted data and IV are kept as a new entry in
+// secret_versions before being overwritten. Returns xerrors.ErrEditConflict
+// if the secret changed since it was read.
+//
+// Sets:
+//
+// name
+// encrypted_data
+// iv
+// cipher
+// cipher_version
+// kind
+// tags
+// metadata
+func (s *Secrets) Update(secret *SecretRecord) *xerrors.AppError {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	query := `
-		UPDATE secrets
-		SET name = $1, encrypted_data = $2, iv = $3, updated_at = NOW()
-		WHERE id = $4;
-	`
+	args, appErr := s.updateArgs(secret, "secrets.Update")
+	if appErr != nil {
+		return appErr
+	}
 
-	_, err := s.DB.ExecContext(ctx, query, newName, []byte(newEncryptedData), []byte(iv), secretID)
+	err := s.DB.QueryRowContext(ctx, updateQuery, args...).Scan(&secret.UpdatedAt, &secret.Version)
 	if err != nil {
-		return xerrors.DatabaseError(err, "secrets.Update")
+		if err == sql.ErrNoRows {
+			return editConflict(secret.ID, "secrets.Update")
+		}
+		return versionConflict(err, secret.ID, "secrets.Update")
 	}
 
 	return nil
@@ -222,17 +331,22 @@ func (s *Secrets) GetSecretByID(secretID int64) (*SecretRecord, *xerrors.AppErro
 
 	// Prepare the SQL query to get the secret by its ID
 	query := `
-		SELECT id, name, encrypted_data, iv, owner_id, created_at
+		SELECT id, name, encrypted_data, iv, cipher, cipher_version, owner_id, folder_id, kind, tags, metadata, created_at, updated_at, version,
+			wrapped_key, key_fingerprint, rekey_required, data_key, master_key_id
 		FROM secrets
-		WHERE id = $1;
+		WHERE id = $1 AND deleted_at IS NULL;
 	`
 
 	// Create a SecretRecord instance to hold the result
 	var secret SecretRecord
+	var key envelope.Key
 
 	// Execute the query and scan the result into the secret struct
 	err := s.DB.QueryRowContext(ctx, query, secretID).Scan(
-		&secret.ID, &secret.Name, &secret.EncryptedData, &secret.IV, &secret.OwnerID, &secret.CreatedAt,
+		&secret.ID, &secret.Name, &secret.EncryptedData, &secret.IV, &secret.Cipher, &secret.CipherVersion,
+		&secret.OwnerID, &secret.FolderID,
+		&secret.Kind, pq.Array(&secret.Tags), &secret.Metadata, &secret.CreatedAt, &secret.UpdatedAt, &secret.Version,
+		&secret.WrappedKey, &secret.KeyFingerprint, &secret.RekeyRequired, &key.Wrapped, &key.MasterKeyID,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -241,5 +355,62 @@ func (s *Secrets) GetSecretByID(secretID int64) (*SecretRecord, *xerrors.AppErro
 		return nil, xerrors.DatabaseError(err, "secrets.GetSecretByID")
 	}
 
+	if err := s.open(key, secret.ID, &secret.EncryptedData, &secret.IV, "secrets.GetSecretByID"); err != nil {
+		return nil, err
+	}
+
 	return &secret, nil
 }
+
+// Reports that a secret changed after it was read
+func editConflict(secretID int64, op string) *xerrors.AppError {
+	return xerrors.ClientError(
+		http.StatusConflict,
+		fmt.Sprintf("Secret with id %d was changed by another request, fetch it again and retry", secretID),
+		op,
+		xerrors.ErrEditConflict,
+	)
+}
+
+// Reports a version kept by a concurrent update as an edit conflict
+func versionConflict(err error, secretID int64, op string) *xerrors.AppError {
+	appErr := xerrors.DatabaseError(err, op)
+	if appErr.Matches(xerrors.ErrUniqueViolation) {
+		return editConflict(secretID, op)
+	}
+	return appErr
+}
+
+// Keeps the current values as a version and updates a secret if its version
+// still matches
+//
+// The kept version is numbered after the row, so concurrent updates of the
+// same version conflict on the key of secret_versions.
+const updateQuery = `
+	WITH previous AS (
+		INSERT INTO secret_versions (secret_id, version, name, encrypted_data, iv, cipher, cipher_version, data_key, master_key_id)
+		SELECT id, version, name, encrypted_data, iv, cipher, cipher_version, data_key, master_key_id
+		FROM secrets
+		WHERE id = $7 AND version = $8 AND deleted_at IS NULL
+	)
+	UPDATE secrets
+	SET name = $1, encrypted_data = $2, iv = $3, kind = $4, tags = $5, metadata = $6,
+		cipher = $9, cipher_version = $10, data_key = $11, master_key_id = $12, updated_at = NOW(), version = version + 1
+	WHERE id = $7 AND version = $8 AND deleted_at IS NULL
+	RETURNING updated_at, version;
+`
+
+// Returns the arguments of updateQuery, with the encrypted data and IV
+// encrypted at rest
+func (s *Secrets) updateArgs(secret *SecretRecord, op string) ([]any, *xerrors.AppError) {
+	if secret.Tags == nil {
+		secret.Tags = []string{}
+	}
+	key, sealed, err := s.seal(Binding(secret.ID), secret.EncryptedData, secret.IV, op)
+	if err != nil {
+		return nil, err
+	}
+	return []any{secret.Name, sealed[0], sealed[1], secret.Kind, pq.Array(secret.Tags),
+		secret.Metadata, secret.ID, secret.Version, secret.Cipher, secret.CipherVersion,
+		key.Wrapped, key.MasterKeyID}, nil
+}
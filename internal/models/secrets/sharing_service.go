@@ -2,54 +2,53 @@ package secrets
 
 import (
 	"context"
+	"database/sql"
+	"fmt"
 	"time"
 
 	"pm4devs.strawhats/internal/xerrors"
 )
 
-func (s *Secrets) ShareToUser(secretID, userID int64, permission Permission) *xerrors.AppError {
-	// Context with a timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
+// Shares a secret with a user, along with the content key wrapped for them if
+// given. The share stops granting access at expiresAt unless it is nil.
+//
+// Sharing again replaces the permission and expiry of the existing share.
+func (s *Secrets) ShareToUser(secretID, userID int64, permission Permission, expiresAt *time.Time, wrappedKey *WrappedKey) *xerrors.AppError {
 	// SQL query to insert a shared secret for a user
 	query := `
-		INSERT INTO shared_secrets_user (secret_id, user_id, permission, created_at, updated_at)
-		VALUES ($1, $2, $3, NOW(), NOW())
-		ON CONFLICT (secret_id, user_id) DO NOTHING;
+		INSERT INTO shared_secrets_user (secret_id, user_id, permission, expires_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, NOW(), NOW())
+		ON CONFLICT (secret_id, user_id) DO UPDATE
+		SET permission = EXCLUDED.permission, expires_at = EXCLUDED.expires_at, updated_at = NOW();
 	`
 
-	// Execute the query
-	_, err := s.DB.ExecContext(ctx, query, secretID, userID, permission)
-	if err != nil {
-		return xerrors.DatabaseError(err, "secrets.ShareToUser")
+	var keys []WrappedKey
+	if wrappedKey != nil {
+		keys = []WrappedKey{*wrappedKey}
 	}
-
-	return nil
+	return s.share(secretID, query, []any{secretID, userID, permission, expiresAt}, keys, "secrets.ShareToUser")
 }
 
-func (s *Secrets) ShareToGroup(secretID, groupID int64, permission Permission) *xerrors.AppError {
-	// Context with a timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
+// Shares a secret with a group, along with the content key wrapped for each
+// of the given members. The share stops granting access at expiresAt unless
+// it is nil.
+//
+// Sharing again replaces the permission and expiry of the existing share.
+func (s *Secrets) ShareToGroup(secretID, groupID int64, permission Permission, expiresAt *time.Time, keys []WrappedKey) *xerrors.AppError {
 	// SQL query to insert a shared secret for a group
 	query := `
-		INSERT INTO shared_secrets_group (secret_id, group_id, permission, created_at, updated_at)
-		VALUES ($1, $2, $3, NOW(), NOW())
-		ON CONFLICT (secret_id, group_id) DO NOTHING;
+		INSERT INTO shared_secrets_group (secret_id, group_id, permission, expires_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, NOW(), NOW())
+		ON CONFLICT (secret_id, group_id) DO UPDATE
+		SET permission = EXCLUDED.permission, expires_at = EXCLUDED.expires_at, updated_at = NOW();
 	`
 
-	// Execute the query
-	_, err := s.DB.ExecContext(ctx, query, secretID, groupID, permission)
-	if err != nil {
-		return xerrors.DatabaseError(err, "secrets.ShareToGroup")
-	}
-
-	return nil
+	return s.share(secretID, query, []any{secretID, groupID, permission, expiresAt}, keys, "secrets.ShareToGroup")
 }
 
-func (s *Secrets) UpdateGroupPermission(secretID, groupID int64, permission Permission) *xerrors.AppError {
+// Replaces the permission of a group share, and its expiry when expiresAt is
+// given. The expiry is removed when clearExpiry is set and kept otherwise.
+func (s *Secrets) UpdateGroupPermission(secretID, groupID int64, permission Permission, expiresAt *time.Time, clearExpiry bool) *xerrors.AppError {
 	// Context with a timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -57,12 +56,12 @@ func (s *Secrets) UpdateGroupPermission(secretID, groupID int64, permission Perm
 	// SQL query to update the permission for a shared secret in a group
 	query := `
 		UPDATE shared_secrets_group
-		SET permission = $1, updated_at = NOW()
+		SET permission = $1, expires_at = CASE WHEN $5 THEN NULL ELSE COALESCE($4, expires_at) END, updated_at = NOW()
 		WHERE secret_id = $2 AND group_id = $3;
 	`
 
 	// Execute the update query
-	_, err := s.DB.ExecContext(ctx, query, permission, secretID, groupID)
+	_, err := s.DB.ExecContext(ctx, query, permission, secretID, groupID, expiresAt, clearExpiry)
 	if err != nil {
 		return xerrors.DatabaseError(err, "secrets.UpdateGroupPermission")
 	}
@@ -70,7 +69,9 @@ func (s *Secrets) UpdateGroupPermission(secretID, groupID int64, permission Perm
 	return nil
 }
 
-func (s *Secrets) UpdateUserPermission(secretID, userID int64, permission Permission) *xerrors.AppError {
+// Replaces the permission of a user share, and its expiry when expiresAt is
+// given. The expiry is removed when clearExpiry is set and kept otherwise.
+func (s *Secrets) UpdateUserPermission(secretID, userID int64, permission Permission, expiresAt *time.Time, clearExpiry bool) *xerrors.AppError {
 	// Context with a timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -78,12 +79,12 @@ func (s *Secrets) UpdateUserPermission(secretID, userID int64, permission Permis
 	// SQL query to update the permission for a shared secret with a user
 	query := `
 		UPDATE shared_secrets_user
-		SET permission = $1, updated_at = NOW()
+		SET permission = $1, expires_at = CASE WHEN $5 THEN NULL ELSE COALESCE($4, expires_at) END, updated_at = NOW()
 		WHERE secret_id = $2 AND user_id = $3;
 	`
 
 	// Execute the update query
-	_, err := s.DB.ExecContext(ctx, query, permission, secretID, userID)
+	_, err := s.DB.ExecContext(ctx, query, permission, secretID, userID, expiresAt, clearExpiry)
 	if err != nil {
 		return xerrors.DatabaseError(err, "secrets.UpdateUserPermission")
 	}
@@ -96,10 +97,16 @@ func (s *Secrets) RevokeFromGroup(secretID, groupID int64) *xerrors.AppError {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	// SQL query to delete a shared secret from a group
+	// SQL query to delete a shared secret from a group. The group may still
+	// hold the content key, so the secret must be re-keyed.
 	query := `
-		DELETE FROM shared_secrets_group
-		WHERE secret_id = $1 AND group_id = $2;
+		WITH revoked AS (
+			DELETE FROM shared_secrets_group
+			WHERE secret_id = $1 AND group_id = $2
+			RETURNING secret_id
+		)
+		UPDATE secrets SET rekey_required = true
+		WHERE id IN (SELECT secret_id FROM revoked);
 	`
 
 	// Execute the delete query
@@ -116,10 +123,16 @@ func (s *Secrets) RevokeFromUser(secretID, userID int64) *xerrors.AppError {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	// SQL query to delete a shared secret from a user
+	// SQL query to delete a shared secret from a user. The user may still
+	// hold the content key, so the secret must be re-keyed.
 	query := `
-		DELETE FROM shared_secrets_user
-		WHERE secret_id = $1 AND user_id = $2;
+		WITH revoked AS (
+			DELETE FROM shared_secrets_user
+			WHERE secret_id = $1 AND user_id = $2
+			RETURNING secret_id
+		)
+		UPDATE secrets SET rekey_required = true
+		WHERE id IN (SELECT secret_id FROM revoked);
 	`
 
 	// Execute the delete query
@@ -130,3 +143,47 @@ func (s *Secrets) RevokeFromUser(secretID, userID int64) *xerrors.AppError {
 
 	return nil
 }
+
+// Inserts a share of a secret with the query and stores the content keys wrapped for its
+// recipients in the same transaction, so no recipient gets access without
+// their key
+func (s *Secrets) share(secretID int64, query string, args []any, keys []WrappedKey, op string) *xerrors.AppError {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Start a new transaction
+	db, ok := s.DB.(*sql.DB)
+	if !ok {
+		return xerrors.DatabaseError(fmt.Errorf("failed to cast DB to *sql.DB"), op)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return xerrors.DatabaseError(err, op)
+	}
+	// Rollback is a no-op once the transaction is committed
+	defer tx.Rollback()
+
+	// Execute the query
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return xerrors.DatabaseError(err, op)
+	}
+
+	if len(keys) > 0 {
+		// The version is bumped as the key is part of the secret returned to each user
+		_, err = tx.ExecContext(ctx, `UPDATE secrets SET version = version + 1 WHERE id = $1;`, secretID)
+		if err != nil {
+			return xerrors.DatabaseError(err, op+": failed to bump version")
+		}
+		if err := storeWrappedKeys(ctx, tx, secretID, keys, op); err != nil {
+			return err
+		}
+	}
+
+	// Commit the transaction
+	if err = tx.Commit(); err != nil {
+		return xerrors.DatabaseError(err, op+": failed to commit transaction")
+	}
+
+	return nil
+}
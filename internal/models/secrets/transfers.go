@@ -0,0 +1,260 @@
+package secrets
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/lib/pq"
+	"pm4devs.strawhats/internal/models/core"
+	"pm4devs.strawhats/internal/xerrors"
+)
+
+// A pending ownership transfer of a secret
+type TransferRecord struct {
+	SecretID   int64     `json:"secret_id"`
+	SecretName string    `json:"secret_name"`
+	FromUserID int64     `json:"from_user_id"`
+	FromEmail  string    `json:"from_email"`
+	ToUserID   int64     `json:"to_user_id"`
+	ToEmail    string    `json:"to_email"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Proposes to transfer a secret to another user, replacing any pending
+// transfer of the secret
+func (s *Secrets) ProposeTransfer(secretID, fromUserID, toUserID int64) *xerrors.AppError {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		INSERT INTO secret_transfers (secret_id, from_user_id, to_user_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (secret_id) DO UPDATE
+		SET from_user_id = EXCLUDED.from_user_id, to_user_id = EXCLUDED.to_user_id, created_at = NOW();
+	`
+
+	_, err := s.DB.ExecContext(ctx, query, secretID, fromUserID, toUserID)
+	if err != nil {
+		return xerrors.DatabaseError(err, "secrets.ProposeTransfer")
+	}
+
+	return nil
+}
+
+// Lists the pending transfers proposed by or to a user
+func (s *Secrets) GetTransfers(userID int64) (*[]TransferRecord, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT t.secret_id, s.name, t.from_user_id, f.email, t.to_user_id, u.email, t.created_at
+		FROM secret_transfers t
+		JOIN secrets s ON s.id = t.secret_id
+		JOIN users f ON f.id = t.from_user_id
+		JOIN users u ON u.id = t.to_user_id
+		WHERE (t.from_user_id = $1 OR t.to_user_id = $1) AND s.deleted_at IS NULL
+		ORDER BY t.created_at, t.secret_id;
+	`
+
+	rows, err := s.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, "secrets.GetTransfers")
+	}
+	defer rows.Close()
+
+	transfers := []TransferRecord{}
+	for rows.Next() {
+		var transfer TransferRecord
+		if err := rows.Scan(&transfer.SecretID, &transfer.SecretName, &transfer.FromUserID, &transfer.FromEmail,
+			&transfer.ToUserID, &transfer.ToEmail, &transfer.CreatedAt); err != nil {
+			return nil, xerrors.DatabaseError(err, "secrets.GetTransfers")
+		}
+		transfers = append(transfers, transfer)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, xerrors.DatabaseError(err, "secrets.GetTransfers")
+	}
+
+	return &transfers, nil
+}
+
+// Accepts a transfer proposed to the user, making them the owner
+//
+// The transfer fails if the secret changed owner since it was proposed.
+func (s *Secrets) AcceptTransfer(secretID, toUserID int64) *xerrors.AppError {
+	ids, err := s.transfer("secrets.AcceptTransfer", toUserID, func(ctx context.Context, tx *sql.Tx) (string, []any, error) {
+		var fromUserID int64
+		err := tx.QueryRowContext(ctx, `
+			DELETE FROM secret_transfers
+			WHERE secret_id = $1 AND to_user_id = $2
+			RETURNING from_user_id;
+		`, secretID, toUserID).Scan(&fromUserID)
+		if err != nil {
+			return "", nil, err
+		}
+		return "id = $2 AND owner_id = $3 AND deleted_at IS NULL", []any{secretID, fromUserID}, nil
+	})
+	if err != nil {
+		return err
+	}
+	return transferred(ids, "secrets.AcceptTransfer")
+}
+
+// Cancels or declines a pending transfer, as either of its users
+func (s *Secrets) CancelTransfer(secretID, userID int64) *xerrors.AppError {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		DELETE FROM secret_transfers
+		WHERE secret_id = $1 AND (from_user_id = $2 OR to_user_id = $2);
+	`
+
+	result, err := s.DB.ExecContext(ctx, query, secretID, userID)
+	if err != nil {
+		return xerrors.DatabaseError(err, "secrets.CancelTransfer")
+	}
+
+	rowsAffected, appErr := core.RowsAffected(result, "secrets.CancelTransfer")
+	if appErr != nil {
+		return appErr
+	}
+
+	if rowsAffected == 0 {
+		return noTransfer(secretID, "secrets.CancelTransfer")
+	}
+
+	return nil
+}
+
+// Transfers a secret without the consent of its owner
+func (s *Secrets) ForceTransfer(secretID, toUserID int64) *xerrors.AppError {
+	ids, err := s.transfer("secrets.ForceTransfer", toUserID, func(ctx context.Context, tx *sql.Tx) (string, []any, error) {
+		return "id = $2 AND deleted_at IS NULL", []any{secretID}, nil
+	})
+	if err != nil {
+		return err
+	}
+	return transferred(ids, "secrets.ForceTransfer")
+}
+
+// Transfers every secret of a user, including the ones in the trash, and
+// returns the number of secrets transferred
+func (s *Secrets) ForceTransferAll(fromUserID, toUserID int64) (int64, *xerrors.AppError) {
+	ids, err := s.transfer("secrets.ForceTransferAll", toUserID, func(ctx context.Context, tx *sql.Tx) (string, []any, error) {
+		return "owner_id = $2", []any{fromUserID}, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(ids)), nil
+}
+
+// ============================================================================
+// Helpers
+// ============================================================================
+
+// Moves the secrets matching a condition to a new owner in a transaction and
+// returns their IDs
+//
+// The condition is returned by the given function, run first in the
+// transaction, and refers to the new owner as $1. User and group shares are
+// kept. The secrets move to the root of the new owner as the folders stay
+// with the previous owner, and a direct share to the new owner is dropped as
+// it is now redundant. The content key wrapped for the new owner through
+// their shares becomes the owner's key, and the secrets must be re-keyed as
+// the previous owner can still unwrap theirs.
+func (s *Secrets) transfer(op string, toUserID int64, where func(ctx context.Context, tx *sql.Tx) (string, []any, error)) ([]int64, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Start a new transaction
+	db, ok := s.DB.(*sql.DB)
+	if !ok {
+		return nil, xerrors.DatabaseError(fmt.Errorf("failed to cast DB to *sql.DB"), op)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, op)
+	}
+	// Rollback is a no-op once the transaction is committed
+	defer tx.Rollback()
+
+	condition, args, err := where(ctx, tx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, noTransfer(0, op)
+	}
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, op)
+	}
+
+	query := fmt.Sprintf(`
+		UPDATE secrets
+		SET owner_id = $1, folder_id = NULL, updated_at = NOW(), version = version + 1,
+			(wrapped_key, key_fingerprint) = (%s),
+			rekey_required = true
+		WHERE %s AND owner_id <> $1
+		RETURNING id;
+	`, fmt.Sprintf(recipientKey, "secrets.id", "$1"), condition)
+
+	rows, err := tx.QueryContext(ctx, query, append([]any{toUserID}, args...)...)
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, op+": failed to change owner")
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, xerrors.DatabaseError(err, op+": failed to change owner")
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, xerrors.DatabaseError(err, op+": failed to change owner")
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM shared_secrets_user WHERE user_id = $1 AND secret_id = ANY($2);`,
+		toUserID, pq.Array(ids))
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, op+": failed to drop redundant share")
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM secret_transfers WHERE secret_id = ANY($1);`, pq.Array(ids))
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, op+": failed to drop pending transfers")
+	}
+
+	// Commit the transaction
+	if err = tx.Commit(); err != nil {
+		return nil, xerrors.DatabaseError(err, op+": failed to commit transaction")
+	}
+
+	return ids, nil
+}
+
+// Returns a not found error for a missing transfer
+func noTransfer(secretID int64, op string) *xerrors.AppError {
+	message := "No pending transfer for the user"
+	if secretID > 0 {
+		message = fmt.Sprintf("No pending transfer of secret %d for the user", secretID)
+	}
+	return xerrors.ClientError(http.StatusNotFound, message, op, xerrors.ErrNotFound)
+}
+
+// Returns a conflict error if no secret was transferred
+func transferred(ids []int64, op string) *xerrors.AppError {
+	if len(ids) == 0 {
+		return xerrors.ClientError(http.StatusConflict,
+			"The secret no longer belongs to the user proposing the transfer or is already owned by the recipient",
+			op, xerrors.ErrEditConflict)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package secrets
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"pm4devs.strawhats/internal/models/core"
+	"pm4devs.strawhats/internal/xerrors"
+)
+
+// Secrets listed by GetDeletedByUserID, one row per secret
+var trashListing = core.Listing{
+	Sorts: map[string]string{
+		"name":       "s.name",
+		"created_at": "s.created_at",
+		"deleted_at": "s.deleted_at",
+	},
+	Keys: []string{"s.id"},
+}
+
+// GetDeletedByUserID lists the secrets a user has in the trash, most recently
+// deleted first unless the page asks for another sort
+func (s *Secrets) GetDeletedByUserID(userID int64, page core.Page) (*[]SecretRecord, string, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if page.Sort == "" {
+		page.Sort, page.Desc = "deleted_at", true
+	}
+	pager, appErr := trashListing.Pager(page, "secrets.GetDeletedByUserID")
+	if appErr != nil {
+		return nil, "", appErr
+	}
+
+	cursor, args := pager.Where([]any{userID})
+	query := `
+		SELECT s.id, s.name, s.owner_id, s.created_at, s.deleted_at` + pager.Columns() + `
+		FROM secrets s
+		WHERE s.owner_id = $1 AND s.deleted_at IS NOT NULL` + cursor + pager.OrderBy() + `;
+	`
+
+	rows, err := s.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, "", xerrors.DatabaseError(err, "secrets.GetDeletedByUserID")
+	}
+	defer rows.Close()
+
+	secrets := []SecretRecord{}
+
+	for rows.Next() {
+		var secret SecretRecord
+		dest := append([]any{&secret.ID, &secret.Name, &secret.OwnerID, &secret.CreatedAt, &secret.DeletedAt}, pager.Dest()...)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, "", xerrors.DatabaseError(err, "secrets.GetDeletedByUserID - scan")
+		}
+		if !pager.Keep() {
+			break
+		}
+		secrets = append(secrets, secret)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, "", xerrors.DatabaseError(err, "secrets.GetDeletedByUserID - rows error")
+	}
+
+	return &secrets, pager.Next(), nil
+}
+
+// Restore moves a secret owned by the user out of the trash
+//
+// Shares are never removed by a soft delete, so they are restored as well.
+func (s *Secrets) Restore(secretID, ownerID int64) *xerrors.AppError {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		UPDATE secrets
+		SET deleted_at = NULL
+		WHERE id = $1 AND owner_id = $2 AND deleted_at IS NOT NULL;
+	`
+
+	result, err := s.DB.ExecContext(ctx, query, secretID, ownerID)
+	if err != nil {
+		return xerrors.DatabaseError(err, "secrets.Restore")
+	}
+
+	return notInTrash(result, secretID, "secrets.Restore")
+}
+
+// Purge permanently deletes a secret owned by the user from the trash
+func (s *Secrets) Purge(secretID, ownerID int64) *xerrors.AppError {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		DELETE FROM secrets
+		WHERE id = $1 AND owner_id = $2 AND deleted_at IS NOT NULL;
+	`
+
+	result, err := s.DB.ExecContext(ctx, query, secretID, ownerID)
+	if err != nil {
+		return xerrors.DatabaseError(err, "secrets.Purge")
+	}
+
+	return notInTrash(result, secretID, "secrets.Purge")
+}
+
+// PurgeDeletedBefore permanently deletes every secret moved to the trash
+// before the cutoff and returns the number of secrets removed
+func (s *Secrets) PurgeDeletedBefore(cutoff time.Time) (int64, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		DELETE FROM secrets
+		WHERE deleted_at IS NOT NULL AND deleted_at < $1;
+	`
+
+	result, err := s.DB.ExecContext(ctx, query, cutoff)
+	if err != nil {
+		return 0, xerrors.DatabaseError(err, "secrets.PurgeDeletedBefore")
+	}
+
+	return core.RowsAffected(result, "secrets.PurgeDeletedBefore")
+}
+
+// Returns a not found error if no secret in the trash was affected
+func notInTrash(result sql.Result, secretID int64, op string) *xerrors.AppError {
+	rowsAffected, err := core.RowsAffected(result, op)
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return xerrors.ClientError(http.StatusNotFound,
+			fmt.Sprintf("No secret in the trash with id: %d", secretID),
+			op, xerrors.ErrNotFound)
+	}
+
+	return nil
+}
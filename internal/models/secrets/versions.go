@@ -0,0 +1,173 @@
+package secrets
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"pm4devs.strawhats/internal/envelope"
+	"pm4devs.strawhats/internal/models/core"
+	"pm4devs.strawhats/internal/xerrors"
+)
+
+// SecretVersionRecord represents a previous value of a secret
+type SecretVersionRecord struct {
+	SecretID      int64     `db:"secret_id" json:"secret_id"`           // Foreign key referencing secrets(id)
+	Version       int       `db:"version" json:"version"`               // Incrementing version number per secret
+	Name          string    `db:"name" json:"name"`                     // Name of the secret at this version
+	EncryptedData []byte    `db:"encrypted_data" json:"encrypted_data"` // Encrypted credentials (bytea)
+	IV            []byte    `db:"iv" json:"iv"`                         // Initialization Vector (bytea)
+	Cipher        Cipher    `db:"cipher" json:"cipher"`                 // Algorithm the data was encrypted with
+	CipherVersion int       `db:"cipher_version" json:"cipher_version"` // Format of the encrypted data and IV for the cipher
+	CreatedAt     time.Time `db:"created_at" json:"created_at"`         // When this version was replaced
+}
+
+// GetVersions lists the previous versions of a secret, newest first
+func (s *Secrets) GetVersions(secretID int64) (*[]SecretVersionRecord, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT secret_id, version, name, encrypted_data, iv, cipher, cipher_version, created_at, data_key, master_key_id
+		FROM secret_versions
+		WHERE secret_id = $1
+		ORDER BY version DESC;
+	`
+
+	rows, err := s.DB.QueryContext(ctx, query, secretID)
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, "secrets.GetVersions")
+	}
+	defer rows.Close()
+
+	versions := []SecretVersionRecord{}
+
+	for rows.Next() {
+		var version SecretVersionRecord
+		var key envelope.Key
+		if err := rows.Scan(&version.SecretID, &version.Version, &version.Name,
+			&version.EncryptedData, &version.IV, &version.Cipher, &version.CipherVersion, &version.CreatedAt,
+			&key.Wrapped, &key.MasterKeyID); err != nil {
+			return nil, xerrors.DatabaseError(err, "secrets.GetVersions - scan")
+		}
+		if err := s.open(key, version.SecretID, &version.EncryptedData, &version.IV, "secrets.GetVersions"); err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, xerrors.DatabaseError(err, "secrets.GetVersions - rows error")
+	}
+
+	return &versions, nil
+}
+
+// GetVersion gets a single previous version of a secret
+func (s *Secrets) GetVersion(secretID int64, version int) (*SecretVersionRecord, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT secret_id, version, name, encrypted_data, iv, cipher, cipher_version, created_at, data_key, master_key_id
+		FROM secret_versions
+		WHERE secret_id = $1 AND version = $2;
+	`
+
+	var record SecretVersionRecord
+	var key envelope.Key
+	err := s.DB.QueryRowContext(ctx, query, secretID, version).Scan(
+		&record.SecretID, &record.Version, &record.Name, &record.EncryptedData, &record.IV,
+		&record.Cipher, &record.CipherVersion, &record.CreatedAt, &key.Wrapped, &key.MasterKeyID,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, noVersion(secretID, version, "secrets.GetVersion")
+		}
+		return nil, xerrors.DatabaseError(err, "secrets.GetVersion")
+	}
+
+	if err := s.open(key, record.SecretID, &record.EncryptedData, &record.IV, "secrets.GetVersion"); err != nil {
+		return nil, err
+	}
+
+	return &record, nil
+}
+
+// Rollback restores a secret to a previous version
+//
+// The current value is kept as a new version first, so a rollback can itself
+// be rolled back. Rollbacks racing with another change conflict on that
+// version. Versions kept before the last re-key are encrypted with a content
+// key the recipients no longer hold, and can't be restored.
+func (s *Secrets) Rollback(secretID int64, version int) *xerrors.AppError {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var rekeyed bool
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT v.version < COALESCE(s.rekeyed_version, 0)
+		FROM secret_versions v
+		JOIN secrets s ON s.id = v.secret_id
+		WHERE v.secret_id = $1 AND v.version = $2;
+	`, secretID, version).Scan(&rekeyed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return noVersion(secretID, version, "secrets.Rollback")
+	}
+	if err != nil {
+		return xerrors.DatabaseError(err, "secrets.Rollback")
+	}
+	if rekeyed {
+		return xerrors.ClientError(http.StatusConflict,
+			fmt.Sprintf("Version %d of secret %d was saved before the secret was re-keyed and can't be restored", version, secretID),
+			"secrets.Rollback", xerrors.ErrEditConflict)
+	}
+
+	query := `
+		WITH target AS (
+			SELECT v.name, v.encrypted_data, v.iv, v.cipher, v.cipher_version, v.data_key, v.master_key_id
+			FROM secret_versions v
+			JOIN secrets s ON s.id = v.secret_id
+			WHERE v.secret_id = $1 AND v.version = $2 AND v.version >= COALESCE(s.rekeyed_version, 0)
+		), previous AS (
+			INSERT INTO secret_versions (secret_id, version, name, encrypted_data, iv, cipher, cipher_version, data_key, master_key_id)
+			SELECT s.id, s.version, s.name, s.encrypted_data, s.iv, s.cipher, s.cipher_version, s.data_key, s.master_key_id
+			FROM secrets s, target
+			WHERE s.id = $1
+		)
+		UPDATE secrets
+		SET name = target.name, encrypted_data = target.encrypted_data, iv = target.iv, cipher = target.cipher,
+			cipher_version = target.cipher_version, data_key = target.data_key, master_key_id = target.master_key_id,
+			updated_at = NOW(),
+			version = secrets.version + 1
+		FROM target
+		WHERE secrets.id = $1;
+	`
+
+	result, err := s.DB.ExecContext(ctx, query, secretID, version)
+	if err != nil {
+		return versionConflict(err, secretID, "secrets.Rollback")
+	}
+
+	rowsAffected, appErr := core.RowsAffected(result, "secrets.Rollback")
+	if appErr != nil {
+		return appErr
+	}
+
+	// The secret was re-keyed since the version was checked
+	if rowsAffected == 0 {
+		return editConflict(secretID, "secrets.Rollback")
+	}
+
+	return nil
+}
+
+// Returns a not found error for a missing version of a secret
+func noVersion(secretID int64, version int, op string) *xerrors.AppError {
+	return xerrors.ClientError(http.StatusNotFound,
+		fmt.Sprintf("No version %d found for secret with id: %d", version, secretID),
+		op, xerrors.ErrNotFound)
+}
@@ -0,0 +1,295 @@
+package sso
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/lib/pq"
+	"pm4devs.strawhats/internal/models/core"
+	"pm4devs.strawhats/internal/models/tokens"
+	"pm4devs.strawhats/internal/models/users"
+	"pm4devs.strawhats/internal/xerrors"
+)
+
+// ============================================================================
+// Interface
+// ============================================================================
+
+// Defines a mockable interface for single sign-on operations
+type SSORepository interface {
+	NewState(state, nonce, verifier, redirectURL string, ttl time.Duration) *xerrors.AppError
+	TakeState(state string) (*State, *xerrors.AppError)
+	Provision(identity Identity) (*users.UserRecord, bool, *xerrors.AppError)
+	SyncGroups(userID int64, names []string) *xerrors.AppError
+	SetGroupManaged(groupName string, managed bool) *xerrors.AppError
+}
+
+func Repository(db core.Queryable) SSORepository {
+	return &SSO{DB: db}
+}
+
+// ============================================================================
+// Implementation
+// ============================================================================
+
+// Provides access to the SSO database methods
+type SSO struct {
+	DB core.Queryable
+}
+
+// Stores a sign-in started with the provider and removes the expired ones
+func (m *SSO) NewState(state, nonce, verifier, redirectURL string, ttl time.Duration) *xerrors.AppError {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		WITH expired AS (
+			DELETE FROM sso_states WHERE expiry < NOW()
+		)
+		INSERT INTO sso_states (hash, nonce, code_verifier, redirect_url, expiry)
+		VALUES ($1, $2, $3, $4, $5);
+	`
+
+	_, err := m.DB.ExecContext(ctx, query, tokens.Hash(state), nonce, verifier, redirectURL, time.Now().Add(ttl))
+	if err != nil {
+		return xerrors.DatabaseError(err, "sso.NewState")
+	}
+
+	return nil
+}
+
+// Removes a sign-in started with the provider and returns it
+//
+// A sign-in can only be finished once, unknown and expired ones are reported
+// as unauthenticated.
+func (m *SSO) TakeState(state string) (*State, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		DELETE FROM sso_states
+		WHERE hash = $1 AND expiry > NOW()
+		RETURNING nonce, code_verifier, redirect_url;
+	`
+
+	var result State
+	err := m.DB.QueryRowContext(ctx, query, tokens.Hash(state)).Scan(&result.Nonce, &result.Verifier, &result.RedirectURL)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, xerrors.ClientError(http.StatusUnauthorized,
+			"The sign-in is invalid or expired, start over", "sso.TakeState", xerrors.ErrUnauthenticated)
+	}
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, "sso.TakeState")
+	}
+
+	return &result, nil
+}
+
+// Returns the user of an identity at the provider, provisioning them just in
+// time, and whether they were created
+//
+// Identities signing in for the first time are linked to the account with the
+// same email if its owner verified the email too, activating it, or get a new
+// account without a password. Check for xerrors.ErrEditConflict if the
+// account with the same email has not verified it: anyone could have
+// registered it, with a password they would keep.
+func (m *SSO) Provision(identity Identity) (*users.UserRecord, bool, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	db, ok := m.DB.(*sql.DB)
+	if !ok {
+		return nil, false, xerrors.DatabaseError(fmt.Errorf("failed to cast DB to *sql.DB"), "sso.Provision")
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, false, xerrors.DatabaseError(err, "sso.Provision")
+	}
+	// Rollback is a no-op once the transaction is committed
+	defer tx.Rollback()
+
+	// Known identity
+	query := `
+		SELECT u.id, u.email, u.activated, u.created_at, u.version, u.owner_group_id, u.deactivated_at
+		FROM sso_identities i
+		INNER JOIN users u ON u.id = i.user_id
+		WHERE i.issuer = $1 AND i.subject = $2;
+	`
+	var user users.UserRecord
+	dest := []any{&user.ID, &user.Email, &user.Activated, &user.CreatedAt, &user.Version, &user.OwnerGroupID,
+		&user.DeactivatedAt}
+	err = tx.QueryRowContext(ctx, query, identity.Issuer, identity.Subject).Scan(dest...)
+	if err == nil {
+		if user.IsDeactivated() {
+			return nil, false, deactivated()
+		}
+		return &user, false, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, false, xerrors.DatabaseError(err, "sso.Provision: failed to get identity")
+	}
+
+	// Account with the same verified email, activated if it was not yet
+	query = `
+		UPDATE users
+		SET activated = true, version = CASE WHEN activated THEN version ELSE version + 1 END
+		WHERE email = $1 AND email_verified
+		RETURNING id, email, activated, created_at, version, owner_group_id, deactivated_at;
+	`
+	created := false
+	err = tx.QueryRowContext(ctx, query, identity.Email).Scan(dest...)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Without a password, the account only signs in with the provider
+		query = `
+			INSERT INTO users (email, password, name, activated, email_verified)
+			VALUES ($1, '', NULLIF($2, ''), true, true)
+			ON CONFLICT (email) DO NOTHING
+			RETURNING id, email, activated, created_at, version, owner_group_id, deactivated_at;
+		`
+		err = tx.QueryRowContext(ctx, query, identity.Email, identity.Name).Scan(dest...)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, false, xerrors.ClientError(http.StatusConflict,
+				"An account with your email exists but has not verified it. Verify it with the activation email "+
+					"or a password reset, then sign in again", "sso.Provision", xerrors.ErrEditConflict)
+		}
+		created = true
+	}
+	if err != nil {
+		return nil, false, xerrors.DatabaseError(err, "sso.Provision: failed to provision user")
+	}
+	if user.IsServiceAccount() {
+		return nil, false, xerrors.ClientError(http.StatusForbidden,
+			"Service accounts can't sign in", "sso.Provision", xerrors.ErrUnauthorized)
+	}
+	if user.IsDeactivated() {
+		return nil, false, deactivated()
+	}
+
+	query = `
+		INSERT INTO sso_identities (issuer, subject, user_id)
+		VALUES ($1, $2, $3);
+	`
+	if _, err = tx.ExecContext(ctx, query, identity.Issuer, identity.Subject, user.ID); err != nil {
+		return nil, false, xerrors.DatabaseError(err, "sso.Provision: failed to link identity")
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, false, xerrors.DatabaseError(err, "sso.Provision: failed to commit transaction")
+	}
+
+	return &user, created, nil
+}
+
+// Maps the groups claim of a user onto the groups of the same names bound to
+// the provider
+//
+// The user joins the listed groups they are not a member of yet, and leaves
+// the groups the claim granted them before but no longer lists, which flags
+// their secrets for re-keying like removing a member does. Groups are never
+// created from the claim, and groups that are not bound are left alone
+// whatever their name.
+func (m *SSO) SyncGroups(userID int64, names []string) *xerrors.AppError {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	db, ok := m.DB.(*sql.DB)
+	if !ok {
+		return xerrors.DatabaseError(fmt.Errorf("failed to cast DB to *sql.DB"), "sso.SyncGroups")
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return xerrors.DatabaseError(err, "sso.SyncGroups")
+	}
+	// Rollback is a no-op once the transaction is committed
+	defer tx.Rollback()
+
+	query := `
+		WITH member AS (
+			INSERT INTO group_members (group_id, user_id, sso_managed)
+			SELECT id, $1, true FROM groups WHERE name = ANY($2) AND idp_managed AND deleted_at IS NULL
+			ON CONFLICT (group_id, user_id) DO NOTHING
+			RETURNING group_id
+		)
+		UPDATE groups SET version = version + 1 WHERE id IN (SELECT group_id FROM member);
+	`
+	if _, err = tx.ExecContext(ctx, query, userID, pq.Array(names)); err != nil {
+		return xerrors.DatabaseError(err, "sso.SyncGroups: failed to join groups")
+	}
+
+	query = `
+		WITH member AS (
+			DELETE FROM group_members
+			WHERE user_id = $1 AND sso_managed
+				AND group_id NOT IN (SELECT id FROM groups WHERE name = ANY($2))
+			RETURNING group_id
+		), wrapped_keys AS (
+			DELETE FROM shared_secrets_group_keys
+			WHERE group_id IN (SELECT group_id FROM member) AND user_id = $1
+		), rekeyed AS (
+			UPDATE secrets SET rekey_required = true
+			WHERE id IN (SELECT secret_id FROM shared_secrets_group WHERE group_id IN (SELECT group_id FROM member))
+		)
+		UPDATE groups SET version = version + 1 WHERE id IN (SELECT group_id FROM member);
+	`
+	if _, err = tx.ExecContext(ctx, query, userID, pq.Array(names)); err != nil {
+		return xerrors.DatabaseError(err, "sso.SyncGroups: failed to leave groups")
+	}
+
+	if err = tx.Commit(); err != nil {
+		return xerrors.DatabaseError(err, "sso.SyncGroups: failed to commit transaction")
+	}
+
+	return nil
+}
+
+// Binds a group to the provider, so its members follow the groups claim, or
+// unbinds it
+//
+// Members the claim granted stay in an unbound group, as if added by hand.
+func (m *SSO) SetGroupManaged(groupName string, managed bool) *xerrors.AppError {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		WITH g AS (
+			UPDATE groups
+			SET idp_managed = $2, updated_at = NOW(), version = version + 1
+			WHERE name = $1 AND deleted_at IS NULL
+			RETURNING id
+		), member AS (
+			UPDATE group_members
+			SET sso_managed = false
+			WHERE NOT $2 AND sso_managed AND group_id IN (SELECT id FROM g)
+		)
+		SELECT COUNT(*) FROM g;
+	`
+
+	var count int
+	if err := m.DB.QueryRowContext(ctx, query, groupName, managed).Scan(&count); err != nil {
+		return xerrors.DatabaseError(err, "sso.SetGroupManaged")
+	}
+
+	if count == 0 {
+		return xerrors.ClientError(http.StatusNotFound,
+			fmt.Sprintf("No group found with name: %s", groupName), "sso.SetGroupManaged", xerrors.ErrNotFound)
+	}
+
+	return nil
+}
+
+// ============================================================================
+// Helpers
+// ============================================================================
+
+// Returns the error of users deprovisioned by the identity provider, before
+// their groups are synced
+func deactivated() *xerrors.AppError {
+	return xerrors.ClientError(http.StatusForbidden, "Your account has been deactivated", "sso.Provision",
+		xerrors.ErrUnauthorized)
+}
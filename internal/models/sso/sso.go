@@ -0,0 +1,20 @@
+package sso
+
+// ============================================================================
+// Types
+// ============================================================================
+
+// Sign-in started with the OpenID Connect provider
+type State struct {
+	Nonce       string // The ID token must carry it
+	Verifier    string // PKCE code verifier the code is exchanged with
+	RedirectURL string // Where the provider sends the user back, empty for the default
+}
+
+// Identity of a user at the provider, from a verified ID token
+type Identity struct {
+	Issuer  string
+	Subject string
+	Email   string // Verified by the provider
+	Name    string
+}
@@ -0,0 +1,84 @@
+package tokens
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"pm4devs.strawhats/internal/xerrors"
+)
+
+// ============================================================================
+// Access Tokens
+// ============================================================================
+
+// Access tokens are signed with the server secret instead of being stored, so
+// requests are authenticated without a database lookup. Revoking a session
+// revokes its refresh token, its access token is accepted until it expires.
+
+// Claims an access token is signed with
+type Claims struct {
+	UserID   int64  `json:"uid"`
+	FamilyID int64  `json:"fid"` // Session the token belongs to
+	Email    string `json:"email"`
+	Expiry   int64  `json:"exp"` // Unix time
+}
+
+// Verifies an access token, returning its claims
+func (m Tokens) Verify(plaintext string) (*Claims, *xerrors.AppError) {
+	invalid := xerrors.ClientError(http.StatusUnauthorized, "Auth token is invalid or expired", "tokens.Verify",
+		xerrors.ErrUnauthenticated)
+
+	payload, signature, ok := strings.Cut(plaintext, ".")
+	if !ok {
+		return nil, invalid
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, sign(m.Secret, payload)) {
+		return nil, invalid
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, invalid
+	}
+	var claims Claims
+	if err := json.Unmarshal(data, &claims); err != nil || time.Now().Unix() >= claims.Expiry {
+		return nil, invalid
+	}
+
+	return &claims, nil
+}
+
+// Creates an access token of a family, signed with the server secret
+func newAccess(secret []byte, userID, familyID int64, email string, ttl time.Duration) (*Token, *xerrors.AppError) {
+	now := time.Now()
+	token := &Token{
+		UserID:    userID,
+		Expiry:    now.Add(ttl),
+		Scope:     ScopeAuthentication,
+		CreatedAt: now,
+		UpdatedAt: now,
+		FamilyID:  &familyID,
+	}
+
+	data, err := json.Marshal(Claims{UserID: userID, FamilyID: familyID, Email: email, Expiry: token.Expiry.Unix()})
+	if err != nil {
+		return nil, xerrors.ServerError("tokens.newAccess", err)
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	token.Plaintext = payload + "." + base64.RawURLEncoding.EncodeToString(sign(secret, payload))
+
+	return token, nil
+}
+
+// Signs the payload of an access token, apart from other uses of the secret
+func sign(secret []byte, payload string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("access:" + payload))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,317 @@
+package tokens
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"pm4devs.strawhats/internal/xerrors"
+)
+
+// ============================================================================
+// Constants
+// ============================================================================
+
+const (
+	// Letters of user codes, without vowels so codes never spell words and
+	// without letters mistaken for digits
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+
+	// Letters in a user code, shown in two halves
+	userCodeLength = 8
+
+	// How much longer devices polling too often have to wait
+	slowDown = 5 * time.Second
+
+	// Devices an IP address can have waiting for approval at once, which
+	// limits how many logins it starts until they expire
+	maxDevicesPerIP = 5
+
+	// Devices waiting for approval at once, from every IP address
+	maxDevices = 10_000
+)
+
+// Errors of a device polling for its tokens, named after RFC 8628
+const (
+	DeviceAuthorizationPending = "authorization_pending"
+	DeviceSlowDown             = "slow_down"
+	DeviceAccessDenied         = "access_denied"
+	DeviceExpiredToken         = "expired_token"
+)
+
+// ============================================================================
+// Types
+// ============================================================================
+
+// Login of a device without a browser, waiting for a user logged in elsewhere
+// to approve it
+type DeviceAuthorization struct {
+	DeviceCode string        // Polled with by the device
+	UserCode   string        // Entered by the user, as XXXX-XXXX
+	Expiry     time.Time     // Until when the user can approve it
+	Interval   time.Duration // How long the device waits between polls
+}
+
+// Device waiting for approval, shown to the user before they approve it
+type DeviceClient struct {
+	Device    *string   `json:"device"`
+	UserAgent *string   `json:"user_agent"`
+	IP        *string   `json:"ip"`
+	CreatedAt time.Time `json:"created_at"`
+	Expiry    time.Time `json:"expires_at"`
+}
+
+// ============================================================================
+// Device Authorization
+// ============================================================================
+
+// Starts the login of a device from a client, valid for the given duration
+// and polled at the given interval, and removes the expired ones
+//
+// Clients with too many devices waiting already, or starting them while too
+// many are waiting overall, are told to try again later.
+func (m Tokens) NewDeviceAuthorization(client Client, ttl, interval time.Duration) (*DeviceAuthorization, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Device codes are as random as other tokens, but belong to no user yet
+	device, appErr := new(0, ttl, "")
+	if appErr != nil {
+		return nil, appErr
+	}
+	userCode, appErr := newUserCode()
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	query := `
+		WITH expired AS (
+			DELETE FROM device_authorizations WHERE expiry < NOW()
+		)
+		INSERT INTO device_authorizations (device_hash, user_hash, device, user_agent, ip, poll_interval, expiry)
+		SELECT $1, $2, NULLIF($3, ''), NULLIF($4, ''), NULLIF($5, ''), $6, $7
+		WHERE (
+			SELECT COUNT(*) FROM device_authorizations
+			WHERE ip IS NOT DISTINCT FROM NULLIF($5, '') AND expiry > NOW()
+		) < $8
+		AND (SELECT COUNT(*) FROM device_authorizations WHERE expiry > NOW()) < $9;
+	`
+	args := []any{device.Hash, Hash(normalizeUserCode(userCode)), client.Device, client.UserAgent, client.IP,
+		int(interval.Seconds()), device.Expiry, maxDevicesPerIP, maxDevices}
+	result, err := m.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, "tokens.NewDeviceAuthorization")
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return nil, xerrors.DatabaseError(err, "tokens.NewDeviceAuthorization")
+	} else if rows == 0 {
+		return nil, xerrors.ClientError(http.StatusTooManyRequests,
+			"Too many devices are waiting for approval, try again later", "tokens.NewDeviceAuthorization",
+			xerrors.ErrTooManyRequests)
+	}
+
+	return &DeviceAuthorization{
+		DeviceCode: device.Plaintext,
+		UserCode:   userCode,
+		Expiry:     device.Expiry,
+		Interval:   interval,
+	}, nil
+}
+
+// Returns the client of a device waiting for approval with a user code
+func (m Tokens) GetDeviceClient(userCode string) (*DeviceClient, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT device, user_agent, ip, created_at, expiry
+		FROM device_authorizations
+		WHERE user_hash = $1 AND user_id IS NULL AND NOT denied AND expiry > NOW();
+	`
+
+	var client DeviceClient
+	dest := []any{&client.Device, &client.UserAgent, &client.IP, &client.CreatedAt, &client.Expiry}
+	err := m.DB.QueryRowContext(ctx, query, Hash(normalizeUserCode(userCode))).Scan(dest...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, unknownUserCode("tokens.GetDeviceClient")
+	}
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, "tokens.GetDeviceClient")
+	}
+
+	return &client, nil
+}
+
+// Approves the device waiting with a user code, logging it in as the user at
+// its next poll, or denies it
+//
+// Each user code is approved or denied once.
+func (m Tokens) DecideDevice(userCode string, userID int64, approve bool) *xerrors.AppError {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		UPDATE device_authorizations
+		SET user_id = CASE WHEN $3 THEN $2::bigint END, denied = NOT $3
+		WHERE user_hash = $1 AND user_id IS NULL AND NOT denied AND expiry > NOW();
+	`
+
+	result, err := m.DB.ExecContext(ctx, query, Hash(normalizeUserCode(userCode)), userID, approve)
+	if err != nil {
+		return xerrors.DatabaseError(err, "tokens.DecideDevice")
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return xerrors.DatabaseError(err, "tokens.DecideDevice")
+	} else if rows == 0 {
+		return unknownUserCode("tokens.DecideDevice")
+	}
+
+	return nil
+}
+
+// Polls for the tokens of a device, starting a new token family once the user
+// approved it
+//
+// Until then, the device is told to keep waiting, or to slow down if it polls
+// more often than its interval, which grows each time. The authorization is
+// removed once the device gets its tokens or learns it was denied.
+func (m Tokens) PollDevice(deviceCode string, accessTTL, refreshTTL time.Duration) (*Pair, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Start a new transaction
+	db, ok := m.DB.(*sql.DB)
+	if !ok {
+		return nil, xerrors.DatabaseError(fmt.Errorf("failed to cast DB to *sql.DB"), "tokens.PollDevice")
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, "tokens.PollDevice")
+	}
+	// Rollback is a no-op once the transaction is committed
+	defer tx.Rollback()
+
+	// Lock the authorization so concurrent polls don't both get tokens
+	var (
+		userID        *int64
+		denied, early bool
+		client        Client
+	)
+	err = tx.QueryRowContext(ctx, `
+		SELECT user_id, denied, COALESCE(device, ''), COALESCE(user_agent, ''), COALESCE(ip, ''),
+			COALESCE(polled_at > NOW() - make_interval(secs => poll_interval), false)
+		FROM device_authorizations
+		WHERE device_hash = $1 AND expiry > NOW()
+		FOR UPDATE;
+	`, Hash(deviceCode)).Scan(&userID, &denied, &client.Device, &client.UserAgent, &client.IP, &early)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, pollError(DeviceExpiredToken, xerrors.ErrUnauthenticated)
+	}
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, "tokens.PollDevice")
+	}
+
+	// Pending devices are answered once the poll is recorded, those polling too
+	// often have to wait longer
+	if userID == nil && !denied {
+		answer, wait := pollError(DeviceAuthorizationPending, xerrors.ErrBadRequest), 0
+		if early {
+			answer, wait = pollError(DeviceSlowDown, xerrors.ErrBadRequest), int(slowDown.Seconds())
+		}
+		query := `
+			UPDATE device_authorizations SET polled_at = NOW(), poll_interval = poll_interval + $2
+			WHERE device_hash = $1;
+		`
+		if _, err := tx.ExecContext(ctx, query, Hash(deviceCode), wait); err != nil {
+			return nil, xerrors.DatabaseError(err, "tokens.PollDevice - poll")
+		}
+		if err = tx.Commit(); err != nil {
+			return nil, xerrors.DatabaseError(err, "tokens.PollDevice: failed to commit transaction")
+		}
+		return nil, answer
+	}
+
+	// Decided devices get their answer once
+	_, err = tx.ExecContext(ctx, `DELETE FROM device_authorizations WHERE device_hash = $1;`, Hash(deviceCode))
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, "tokens.PollDevice - delete")
+	}
+	if denied {
+		if err = tx.Commit(); err != nil {
+			return nil, xerrors.DatabaseError(err, "tokens.PollDevice: failed to commit transaction")
+		}
+		return nil, pollError(DeviceAccessDenied, xerrors.ErrUnauthorized)
+	}
+
+	// The session is the device's, not that of the browser it was approved with
+	familyID, email, appErr := insertFamily(ctx, tx, *userID, client, "tokens.PollDevice")
+	if appErr != nil {
+		return nil, appErr
+	}
+	pair, appErr := insertPair(ctx, tx, m.Secret, *userID, familyID, email, accessTTL, refreshTTL, "tokens.PollDevice")
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	// Commit the transaction
+	if err = tx.Commit(); err != nil {
+		return nil, xerrors.DatabaseError(err, "tokens.PollDevice: failed to commit transaction")
+	}
+
+	return pair, nil
+}
+
+// ============================================================================
+// Helpers
+// ============================================================================
+
+// Generates a random user code, as XXXX-XXXX
+func newUserCode() (string, *xerrors.AppError) {
+	var code strings.Builder
+	letters := big.NewInt(int64(len(userCodeAlphabet)))
+	for i := 0; i < userCodeLength; i++ {
+		if i == userCodeLength/2 {
+			code.WriteByte('-')
+		}
+		n, err := rand.Int(rand.Reader, letters)
+		if err != nil {
+			return "", xerrors.ServerError("tokens.newUserCode", xerrors.ErrServerInternal)
+		}
+		code.WriteByte(userCodeAlphabet[n.Int64()])
+	}
+	return code.String(), nil
+}
+
+// Returns the letters of a user code as typed by a user, in upper case and
+// without separators
+func normalizeUserCode(userCode string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' {
+			r -= 'a' - 'A'
+		}
+		if !strings.ContainsRune(userCodeAlphabet, r) {
+			return -1
+		}
+		return r
+	}, userCode)
+}
+
+// Returns the error of a user code that is unknown, expired or already
+// decided
+func unknownUserCode(op string) *xerrors.AppError {
+	return xerrors.ClientError(http.StatusNotFound, "The code is invalid or expired, start the login on the device again",
+		op, xerrors.ErrNotFound)
+}
+
+// Returns an error of a device polling for its tokens, whose message is the
+// error code of RFC 8628
+func pollError(code string, err error) *xerrors.AppError {
+	return xerrors.ClientError(http.StatusBadRequest, code, "tokens.PollDevice", err)
+}
@@ -0,0 +1,212 @@
+package tokens
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"pm4devs.strawhats/internal/xerrors"
+)
+
+// Starts a new family of tokens for a user who logged in from a client,
+// returning its first access and refresh tokens
+func (m Tokens) NewFamily(userID int64, client Client, accessTTL, refreshTTL time.Duration) (*Pair, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Start a new transaction
+	db, ok := m.DB.(*sql.DB)
+	if !ok {
+		return nil, xerrors.DatabaseError(fmt.Errorf("failed to cast DB to *sql.DB"), "tokens.NewFamily")
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, "tokens.NewFamily")
+	}
+	// Rollback is a no-op once the transaction is committed
+	defer tx.Rollback()
+
+	familyID, email, appErr := insertFamily(ctx, tx, userID, client, "tokens.NewFamily")
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	pair, appErr := insertPair(ctx, tx, m.Secret, userID, familyID, email, accessTTL, refreshTTL, "tokens.NewFamily")
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	// Commit the transaction
+	if err = tx.Commit(); err != nil {
+		return nil, xerrors.DatabaseError(err, "tokens.NewFamily: failed to commit transaction")
+	}
+
+	return pair, nil
+}
+
+// Rotates a refresh token, returning a new access and refresh token of its
+// family
+//
+// The refresh token is marked as used. Using a refresh token twice means it
+// was stolen, so the whole family is revoked, logging out both the user and
+// the thief once their access tokens expire.
+func (m Tokens) Refresh(plaintext string, client Client, accessTTL, refreshTTL time.Duration) (*Pair, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Start a new transaction
+	db, ok := m.DB.(*sql.DB)
+	if !ok {
+		return nil, xerrors.DatabaseError(fmt.Errorf("failed to cast DB to *sql.DB"), "tokens.Refresh")
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, "tokens.Refresh")
+	}
+	// Rollback is a no-op once the transaction is committed
+	defer tx.Rollback()
+
+	// Lock the token so it isn't rotated twice concurrently
+	var (
+		userID, familyID int64
+		email            string
+		usedAt           *time.Time
+	)
+	err = tx.QueryRowContext(ctx, `
+		SELECT t.user_id, t.family_id, u.email, t.used_at
+		FROM tokens t
+		INNER JOIN users u ON u.id = t.user_id
+		WHERE t.hash = $1 AND t.scope = $2 AND t.expiry > NOW()
+		FOR UPDATE OF t;
+	`, Hash(plaintext), ScopeRefresh).Scan(&userID, &familyID, &email, &usedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, xerrors.ClientError(http.StatusUnauthorized,
+			"The refresh token is invalid or expired, log in again", "tokens.Refresh", xerrors.ErrUnauthenticated)
+	}
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, "tokens.Refresh")
+	}
+
+	// Reuse revokes the family
+	if usedAt != nil {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM token_families WHERE id = $1;`, familyID); err != nil {
+			return nil, xerrors.DatabaseError(err, "tokens.Refresh - revoke family")
+		}
+		if err = tx.Commit(); err != nil {
+			return nil, xerrors.DatabaseError(err, "tokens.Refresh: failed to commit transaction")
+		}
+		return nil, xerrors.ClientError(http.StatusUnauthorized,
+			"The refresh token was already used, every token it was issued with is revoked, log in again",
+			"tokens.Refresh", xerrors.ErrUnauthenticated)
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE tokens SET used_at = NOW(), updated_at = NOW() WHERE hash = $1;`,
+		Hash(plaintext))
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, "tokens.Refresh - rotate")
+	}
+	if appErr := touchFamily(ctx, tx, familyID, client, "tokens.Refresh"); appErr != nil {
+		return nil, appErr
+	}
+
+	pair, appErr := insertPair(ctx, tx, m.Secret, userID, familyID, email, accessTTL, refreshTTL, "tokens.Refresh")
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	// Commit the transaction
+	if err = tx.Commit(); err != nil {
+		return nil, xerrors.DatabaseError(err, "tokens.Refresh: failed to commit transaction")
+	}
+
+	return pair, nil
+}
+
+// Revokes a family along with its refresh tokens, doing nothing if it was
+// already revoked
+func (m Tokens) DeleteFamily(id int64) *xerrors.AppError {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if _, err := m.DB.ExecContext(ctx, `DELETE FROM token_families WHERE id = $1;`, id); err != nil {
+		return xerrors.DatabaseError(err, "tokens.DeleteFamily")
+	}
+
+	return nil
+}
+
+// ============================================================================
+// Helpers
+// ============================================================================
+
+// Inserts a family of tokens for a user who logged in from a client in a
+// transaction, returning its ID and the email of the user
+//
+// Users deprovisioned by the identity provider can't log in.
+func insertFamily(ctx context.Context, tx *sql.Tx, userID int64, client Client, op string) (int64, string, *xerrors.AppError) {
+	var (
+		familyID int64
+		email    string
+	)
+	err := tx.QueryRowContext(ctx, `
+		WITH f AS (
+			INSERT INTO token_families (user_id, device, user_agent, ip)
+			SELECT id, NULLIF($2, ''), NULLIF($3, ''), NULLIF($4, '')
+			FROM users
+			WHERE id = $1 AND deactivated_at IS NULL
+			RETURNING id, user_id
+		)
+		SELECT f.id, u.email FROM f INNER JOIN users u ON u.id = f.user_id;
+	`, userID, client.Device, client.UserAgent, client.IP).Scan(&familyID, &email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, "", xerrors.ClientError(http.StatusForbidden, "Your account has been deactivated", op,
+			xerrors.ErrUnauthorized)
+	}
+	if err != nil {
+		return 0, "", xerrors.DatabaseError(err, op+" - insert family")
+	}
+	return familyID, email, nil
+}
+
+// Signs an access token and inserts a refresh token of a family in a
+// transaction
+func insertPair(ctx context.Context, tx *sql.Tx, secret []byte, userID, familyID int64, email string, accessTTL, refreshTTL time.Duration, op string) (*Pair, *xerrors.AppError) {
+	access, appErr := newAccess(secret, userID, familyID, email, accessTTL)
+	if appErr != nil {
+		return nil, appErr
+	}
+	refresh, appErr := new(userID, refreshTTL, ScopeRefresh)
+	if appErr != nil {
+		return nil, appErr
+	}
+	refresh.FamilyID = &familyID
+
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO tokens (hash, user_id, expiry, scope, created_at, updated_at, family_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7);
+	`, refresh.Hash, refresh.UserID, refresh.Expiry, refresh.Scope, refresh.CreatedAt, refresh.UpdatedAt, refresh.FamilyID)
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, op+" - insert token")
+	}
+
+	return &Pair{Access: access, Refresh: refresh}, nil
+}
+
+// Records the client a family was last used from
+func touchFamily(ctx context.Context, tx *sql.Tx, familyID int64, client Client, op string) *xerrors.AppError {
+	_, err := tx.ExecContext(ctx, `
+		UPDATE token_families
+		SET device = COALESCE(NULLIF($2, ''), device), user_agent = NULLIF($3, ''), ip = NULLIF($4, ''),
+			last_used_at = NOW()
+		WHERE id = $1;
+	`, familyID, client.Device, client.UserAgent, client.IP)
+	if err != nil {
+		return xerrors.DatabaseError(err, op+" - touch family")
+	}
+	return nil
+}
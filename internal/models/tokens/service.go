@@ -17,10 +17,25 @@ type TokensRepository interface {
 	Insert(token *Token) (int64, *xerrors.AppError)
 	Delete(plaintext string, scope string) (int64, *xerrors.AppError)
 	DeleteAllForScope(userID int64, scope string) (int64, *xerrors.AppError)
+	NewFamily(userID int64, client Client, accessTTL, refreshTTL time.Duration) (*Pair, *xerrors.AppError)
+	Refresh(plaintext string, client Client, accessTTL, refreshTTL time.Duration) (*Pair, *xerrors.AppError)
+	DeleteFamily(id int64) *xerrors.AppError
+	Verify(plaintext string) (*Claims, *xerrors.AppError)
+	Touch(familyID int64, client Client)
+	SaveUses() (int64, *xerrors.AppError)
+	GetSessions(userID, currentID int64) (*[]Session, *xerrors.AppError)
+	DeleteSession(id, userID int64) *xerrors.AppError
+	DeleteOtherSessions(userID, currentID int64) (int64, *xerrors.AppError)
+	DeleteAllSessions(userID int64) (int64, *xerrors.AppError)
+	NewDeviceAuthorization(client Client, ttl, interval time.Duration) (*DeviceAuthorization, *xerrors.AppError)
+	GetDeviceClient(userCode string) (*DeviceClient, *xerrors.AppError)
+	DecideDevice(userCode string, userID int64, approve bool) *xerrors.AppError
+	PollDevice(deviceCode string, accessTTL, refreshTTL time.Duration) (*Pair, *xerrors.AppError)
 }
 
-func Repository(db core.Queryable) TokensRepository {
-	return &Tokens{DB: db}
+// Access tokens are signed with the given server secret
+func Repository(db core.Queryable, secret []byte) TokensRepository {
+	return &Tokens{DB: db, Secret: secret, uses: &uses{clients: map[int64]Client{}}}
 }
 
 // ===========================================================================
@@ -29,7 +44,9 @@ func Repository(db core.Queryable) TokensRepository {
 
 // Provides access to the Tokens database methods
 type Tokens struct {
-	DB core.Queryable
+	DB     core.Queryable
+	Secret []byte
+	uses   *uses // Shared by the copies of the repository
 }
 
 // Creates a Token with the given user ID, expiry, and scope
@@ -39,6 +56,11 @@ type Tokens struct {
 //	ScopeActivation
 //	ScopeAuthentication
 //	ScopePasswordReset
+//	ScopeShareLink
+//	ScopeEmergencyVeto
+//	ScopeTwoFactor
+//	ScopeTwoFactorSetup
+//	ScopeRefresh
 func (Tokens) New(userID int64, expiryDuration time.Duration, scope string) (*Token, *xerrors.AppError) {
 	token, err := new(userID, expiryDuration, scope)
 
@@ -52,10 +74,10 @@ func (Tokens) New(userID int64, expiryDuration time.Duration, scope string) (*To
 // Insert token
 func (m Tokens) Insert(token *Token) (int64, *xerrors.AppError) {
 	query := `
-		INSERT INTO tokens (hash, user_id, expiry, scope, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO tokens (hash, user_id, expiry, scope, created_at, updated_at, family_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
 	`
-	args := []any{token.Hash, token.UserID, token.Expiry, token.Scope, token.CreatedAt, token.UpdatedAt}
+	args := []any{token.Hash, token.UserID, token.Expiry, token.Scope, token.CreatedAt, token.UpdatedAt, token.FamilyID}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
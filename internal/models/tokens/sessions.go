@@ -0,0 +1,194 @@
+package tokens
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+	"pm4devs.strawhats/internal/models/core"
+	"pm4devs.strawhats/internal/xerrors"
+)
+
+// Uses of sessions waiting to be saved, with the client each was last used
+// from
+type uses struct {
+	mu      sync.Mutex
+	clients map[int64]Client
+}
+
+// Records the client a session is used from, in memory until SaveUses is
+// called
+func (m Tokens) Touch(familyID int64, client Client) {
+	m.uses.mu.Lock()
+	defer m.uses.mu.Unlock()
+
+	m.uses.clients[familyID] = client
+}
+
+// Saves the uses of sessions recorded since the last call in a single write,
+// returning the number of sessions updated
+//
+// last_used_at is only as precise as the interval it is called at. Uses are
+// kept for the next call if the write fails.
+func (m Tokens) SaveUses() (int64, *xerrors.AppError) {
+	m.uses.mu.Lock()
+	clients := m.uses.clients
+	m.uses.clients = map[int64]Client{}
+	m.uses.mu.Unlock()
+
+	if len(clients) == 0 {
+		return 0, nil
+	}
+
+	ids := make([]int64, 0, len(clients))
+	userAgents := make([]string, 0, len(clients))
+	ips := make([]string, 0, len(clients))
+	for id, client := range clients {
+		ids = append(ids, id)
+		userAgents = append(userAgents, client.UserAgent)
+		ips = append(ips, client.IP)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Revoked sessions are left out by the join
+	query := `
+		UPDATE token_families f
+		SET user_agent = NULLIF(u.user_agent, ''), ip = NULLIF(u.ip, ''), last_used_at = NOW()
+		FROM unnest($1::bigint[], $2::text[], $3::text[]) AS u(id, user_agent, ip)
+		WHERE f.id = u.id;
+	`
+
+	result, err := m.DB.ExecContext(ctx, query, pq.Array(ids), pq.Array(userAgents), pq.Array(ips))
+	if err != nil {
+		// Later uses of a session replace the failed one
+		m.uses.mu.Lock()
+		for id, client := range clients {
+			if _, ok := m.uses.clients[id]; !ok {
+				m.uses.clients[id] = client
+			}
+		}
+		m.uses.mu.Unlock()
+		return 0, xerrors.DatabaseError(err, "tokens.SaveUses")
+	}
+
+	return core.RowsAffected(result, "tokens.SaveUses")
+}
+
+// Lists the sessions of a user that can still be refreshed, most recently
+// used first, flagging the current one
+func (m Tokens) GetSessions(userID, currentID int64) (*[]Session, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT f.id, f.device, f.user_agent, f.ip, f.id = $2, f.created_at, f.last_used_at
+		FROM token_families f
+		WHERE f.user_id = $1
+		AND EXISTS (
+			SELECT 1 FROM tokens t WHERE t.family_id = f.id AND t.expiry > NOW() AND t.used_at IS NULL
+		)
+		ORDER BY f.last_used_at DESC, f.id DESC;
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, currentID)
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, "tokens.GetSessions")
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		var session Session
+		err := rows.Scan(&session.ID, &session.Device, &session.UserAgent, &session.IP, &session.Current,
+			&session.CreatedAt, &session.LastUsedAt)
+		if err != nil {
+			return nil, xerrors.DatabaseError(err, "tokens.GetSessions - scan")
+		}
+		sessions = append(sessions, session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, xerrors.DatabaseError(err, "tokens.GetSessions - rows error")
+	}
+
+	return &sessions, nil
+}
+
+// Revokes a session of a user, along with its access and refresh tokens
+func (m Tokens) DeleteSession(id, userID int64) *xerrors.AppError {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM token_families WHERE id = $1 AND user_id = $2;`, id, userID)
+	if err != nil {
+		return xerrors.DatabaseError(err, "tokens.DeleteSession")
+	}
+
+	rowsAffected, appErr := core.RowsAffected(result, "tokens.DeleteSession")
+	if appErr != nil {
+		return appErr
+	}
+
+	if rowsAffected == 0 {
+		return xerrors.ClientError(http.StatusNotFound,
+			fmt.Sprintf("No session found with id: %d", id), "tokens.DeleteSession", xerrors.ErrNotFound)
+	}
+
+	return nil
+}
+
+// Revokes every session of a user but the current one, returning the number
+// of sessions revoked
+//
+// Access tokens handed out before sessions existed are revoked as well.
+func (m Tokens) DeleteOtherSessions(userID, currentID int64) (int64, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		WITH legacy AS (
+			DELETE FROM tokens WHERE user_id = $1 AND scope = $3 AND family_id IS NULL
+		), f AS (
+			DELETE FROM token_families WHERE user_id = $1 AND id <> $2
+			RETURNING id
+		)
+		SELECT COUNT(*) FROM f;
+	`
+
+	var count int64
+	if err := m.DB.QueryRowContext(ctx, query, userID, currentID, ScopeAuthentication).Scan(&count); err != nil {
+		return 0, xerrors.DatabaseError(err, "tokens.DeleteOtherSessions")
+	}
+
+	return count, nil
+}
+
+// Revokes every session of a user, returning the number of sessions revoked
+//
+// Access tokens handed out before sessions existed are revoked as well.
+func (m Tokens) DeleteAllSessions(userID int64) (int64, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		WITH legacy AS (
+			DELETE FROM tokens WHERE user_id = $1 AND scope = $2 AND family_id IS NULL
+		), f AS (
+			DELETE FROM token_families WHERE user_id = $1
+			RETURNING id
+		)
+		SELECT COUNT(*) FROM f;
+	`
+
+	var count int64
+	if err := m.DB.QueryRowContext(ctx, query, userID, ScopeAuthentication).Scan(&count); err != nil {
+		return 0, xerrors.DatabaseError(err, "tokens.DeleteAllSessions")
+	}
+
+	return count, nil
+}
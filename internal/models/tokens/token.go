@@ -17,6 +17,11 @@ const (
 	ScopeActivation     = "activate"
 	ScopeAuthentication = "authneticate"
 	ScopePasswordReset  = "reset"
+	ScopeShareLink      = "link"
+	ScopeEmergencyVeto  = "emergency-veto"
+	ScopeTwoFactor      = "2fa"
+	ScopeTwoFactorSetup = "2fa-setup"
+	ScopeRefresh        = "refresh"
 )
 
 // ============================================================================
@@ -31,6 +36,32 @@ type Token struct {
 	CreatedAt time.Time `json:"-"`
 	Scope     string    `json:"-"`
 	UpdatedAt time.Time `json:"-"`
+	FamilyID  *int64    `json:"-"` // Family of access and refresh tokens, if any
+}
+
+// Access token handed out along with the refresh token to get the next one
+// with
+type Pair struct {
+	Access  *Token
+	Refresh *Token
+}
+
+// Client a session was started or last used from
+type Client struct {
+	Device    string // Name the client gave the device, if any
+	UserAgent string
+	IP        string
+}
+
+// Login of a user on a device, along with the client it was last used from
+type Session struct {
+	ID         int64     `json:"id"`
+	Device     *string   `json:"device"`
+	UserAgent  *string   `json:"user_agent"`
+	IP         *string   `json:"ip"`
+	Current    bool      `json:"current"` // Whether the request was made with it
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
 }
 
 // New Token
@@ -0,0 +1,421 @@
+package twofactor
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"pm4devs.strawhats/internal/envelope"
+	"pm4devs.strawhats/internal/models/core"
+	"pm4devs.strawhats/internal/models/tokens"
+	"pm4devs.strawhats/internal/xerrors"
+)
+
+// ============================================================================
+// Interface
+// ============================================================================
+
+// Defines a mockable interface for two-factor authentication operations
+type TwoFactorRepository interface {
+	Enroll(userID int64, secret []byte) *xerrors.AppError
+	Get(userID int64) (*TOTPRecord, *xerrors.AppError)
+	GetStatus(userID int64) (*Status, *xerrors.AppError)
+	Confirm(userID, step int64, codeHashes [][]byte) *xerrors.AppError
+	UseStep(userID, step int64) *xerrors.AppError
+	UseRecoveryCode(userID int64, codeHash []byte) *xerrors.AppError
+	SetRecoveryCodes(userID int64, codeHashes [][]byte) *xerrors.AppError
+	Disable(userID int64) *xerrors.AppError
+	Required(userID int64) (bool, *xerrors.AppError)
+	SetGroupRequired(groupName string, required bool) *xerrors.AppError
+}
+
+func Repository(db core.Queryable, envelope *envelope.Envelope) TwoFactorRepository {
+	return &TwoFactor{DB: db, Envelope: envelope}
+}
+
+// ============================================================================
+// Implementation
+// ============================================================================
+
+// Provides access to the TwoFactor database methods
+type TwoFactor struct {
+	DB       core.Queryable
+	Envelope *envelope.Envelope // Encrypts the TOTP secrets at rest
+}
+
+// Enrolls a new TOTP secret for a user, unconfirmed until Confirm
+//
+// An unconfirmed secret is replaced. Users who already enabled two-factor
+// authentication must disable it first.
+func (tf *TwoFactor) Enroll(userID int64, secret []byte) *xerrors.AppError {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	dataKey, sealed, err := tf.Envelope.Seal(Binding(userID), secret)
+	if err != nil {
+		return xerrors.ServerError("twofactor.Enroll", err)
+	}
+
+	query := `
+		INSERT INTO user_totp (user_id, secret, data_key, master_key_id)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret, data_key = EXCLUDED.data_key, master_key_id = EXCLUDED.master_key_id,
+			last_step = 0, created_at = NOW()
+		WHERE user_totp.confirmed_at IS NULL;
+	`
+
+	result, dbErr := tf.DB.ExecContext(ctx, query, userID, sealed[0], dataKey.Wrapped, dataKey.MasterKeyID)
+	if dbErr != nil {
+		return xerrors.DatabaseError(dbErr, "twofactor.Enroll")
+	}
+
+	rowsAffected, appErr := core.RowsAffected(result, "twofactor.Enroll")
+	if appErr != nil {
+		return appErr
+	}
+
+	if rowsAffected == 0 {
+		return xerrors.ClientError(http.StatusConflict,
+			"Two-factor authentication is already enabled", "twofactor.Enroll", xerrors.ErrEditConflict)
+	}
+
+	return nil
+}
+
+// Gets the TOTP secret of a user, confirmed or not
+func (tf *TwoFactor) Get(userID int64) (*TOTPRecord, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT user_id, secret, data_key, master_key_id, last_step, confirmed_at, created_at
+		FROM user_totp
+		WHERE user_id = $1;
+	`
+
+	var record TOTPRecord
+	var dataKey envelope.Key
+	err := tf.DB.QueryRowContext(ctx, query, userID).Scan(&record.UserID, &record.Secret,
+		&dataKey.Wrapped, &dataKey.MasterKeyID, &record.LastStep, &record.ConfirmedAt, &record.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, notEnrolled("twofactor.Get")
+	}
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, "twofactor.Get")
+	}
+
+	if err := tf.Envelope.Open(dataKey, Binding(userID), &record.Secret); err != nil {
+		return nil, xerrors.ServerError("twofactor.Get", err)
+	}
+
+	return &record, nil
+}
+
+// Gets the two-factor authentication settings of a user
+func (tf *TwoFactor) GetStatus(userID int64) (*Status, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT
+			t.confirmed_at,
+			(SELECT COUNT(*) FROM webauthn_credentials w WHERE w.user_id = $1),
+			(SELECT COUNT(*) FROM totp_recovery_codes c WHERE c.user_id = $1 AND c.used_at IS NULL)
+		FROM (SELECT $1::bigint AS user_id) u
+		LEFT JOIN user_totp t ON t.user_id = u.user_id;
+	`
+
+	var status Status
+	err := tf.DB.QueryRowContext(ctx, query, userID).Scan(&status.ConfirmedAt, &status.SecurityKeys,
+		&status.RecoveryCodes)
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, "twofactor.GetStatus")
+	}
+	status.TOTP = status.ConfirmedAt != nil
+	status.Enabled = status.TOTP || status.SecurityKeys > 0
+
+	required, appErr := tf.Required(userID)
+	if appErr != nil {
+		return nil, appErr
+	}
+	status.Required = required
+
+	return &status, nil
+}
+
+// Confirms the TOTP secret of a user with the step of a first valid code,
+// enabling two-factor authentication, and replaces their recovery codes
+func (tf *TwoFactor) Confirm(userID, step int64, codeHashes [][]byte) *xerrors.AppError {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Start a new transaction
+	db, ok := tf.DB.(*sql.DB)
+	if !ok {
+		return xerrors.DatabaseError(fmt.Errorf("failed to cast DB to *sql.DB"), "twofactor.Confirm")
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return xerrors.DatabaseError(err, "twofactor.Confirm")
+	}
+	// Rollback is a no-op once the transaction is committed
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE user_totp
+		SET confirmed_at = NOW(), last_step = $2
+		WHERE user_id = $1 AND confirmed_at IS NULL;
+	`, userID, step)
+	if err != nil {
+		return xerrors.DatabaseError(err, "twofactor.Confirm")
+	}
+
+	rowsAffected, appErr := core.RowsAffected(result, "twofactor.Confirm")
+	if appErr != nil {
+		return appErr
+	}
+
+	if rowsAffected == 0 {
+		return xerrors.ClientError(http.StatusConflict,
+			"Two-factor authentication is already enabled", "twofactor.Confirm", xerrors.ErrEditConflict)
+	}
+
+	if appErr := setRecoveryCodes(ctx, tx, userID, codeHashes, "twofactor.Confirm"); appErr != nil {
+		return appErr
+	}
+
+	// Commit the transaction
+	if err = tx.Commit(); err != nil {
+		return xerrors.DatabaseError(err, "twofactor.Confirm: failed to commit transaction")
+	}
+
+	return nil
+}
+
+// Records the step of a code accepted for a user
+//
+// Codes of the last step accepted or earlier are rejected, so a code cannot
+// be used twice.
+func (tf *TwoFactor) UseStep(userID, step int64) *xerrors.AppError {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		UPDATE user_totp
+		SET last_step = $2
+		WHERE user_id = $1 AND confirmed_at IS NOT NULL AND last_step < $2;
+	`
+
+	result, err := tf.DB.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return xerrors.DatabaseError(err, "twofactor.UseStep")
+	}
+
+	rowsAffected, appErr := core.RowsAffected(result, "twofactor.UseStep")
+	if appErr != nil {
+		return appErr
+	}
+
+	if rowsAffected == 0 {
+		return invalidCode("twofactor.UseStep")
+	}
+
+	return nil
+}
+
+// Marks a recovery code of a user as used
+func (tf *TwoFactor) UseRecoveryCode(userID int64, codeHash []byte) *xerrors.AppError {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		UPDATE totp_recovery_codes
+		SET used_at = NOW()
+		WHERE user_id = $1 AND hash = $2 AND used_at IS NULL;
+	`
+
+	result, err := tf.DB.ExecContext(ctx, query, userID, codeHash)
+	if err != nil {
+		return xerrors.DatabaseError(err, "twofactor.UseRecoveryCode")
+	}
+
+	rowsAffected, appErr := core.RowsAffected(result, "twofactor.UseRecoveryCode")
+	if appErr != nil {
+		return appErr
+	}
+
+	if rowsAffected == 0 {
+		return invalidCode("twofactor.UseRecoveryCode")
+	}
+
+	return nil
+}
+
+// Replaces the recovery codes of a user
+func (tf *TwoFactor) SetRecoveryCodes(userID int64, codeHashes [][]byte) *xerrors.AppError {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Start a new transaction
+	db, ok := tf.DB.(*sql.DB)
+	if !ok {
+		return xerrors.DatabaseError(fmt.Errorf("failed to cast DB to *sql.DB"), "twofactor.SetRecoveryCodes")
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return xerrors.DatabaseError(err, "twofactor.SetRecoveryCodes")
+	}
+	// Rollback is a no-op once the transaction is committed
+	defer tx.Rollback()
+
+	if appErr := setRecoveryCodes(ctx, tx, userID, codeHashes, "twofactor.SetRecoveryCodes"); appErr != nil {
+		return appErr
+	}
+
+	// Commit the transaction
+	if err = tx.Commit(); err != nil {
+		return xerrors.DatabaseError(err, "twofactor.SetRecoveryCodes: failed to commit transaction")
+	}
+
+	return nil
+}
+
+// Disables the authenticator app of a user, removing their secret. Their
+// recovery codes are removed as well unless they registered a security key.
+func (tf *TwoFactor) Disable(userID int64) *xerrors.AppError {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		WITH codes AS (
+			DELETE FROM totp_recovery_codes
+			WHERE user_id = $1 AND NOT EXISTS (SELECT 1 FROM webauthn_credentials w WHERE w.user_id = $1)
+		)
+		DELETE FROM user_totp WHERE user_id = $1;
+	`
+
+	result, err := tf.DB.ExecContext(ctx, query, userID)
+	if err != nil {
+		return xerrors.DatabaseError(err, "twofactor.Disable")
+	}
+
+	rowsAffected, appErr := core.RowsAffected(result, "twofactor.Disable")
+	if appErr != nil {
+		return appErr
+	}
+
+	if rowsAffected == 0 {
+		return notEnrolled("twofactor.Disable")
+	}
+
+	return nil
+}
+
+// Checks if a user created or is a member of a group requiring two-factor
+// authentication
+func (tf *TwoFactor) Required(userID int64) (bool, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM groups g
+			WHERE g.require_2fa AND g.deleted_at IS NULL
+			AND (g.creator_id = $1 OR EXISTS (
+				SELECT 1 FROM group_members m WHERE m.group_id = g.id AND m.user_id = $1
+			))
+		);
+	`
+
+	var required bool
+	if err := tf.DB.QueryRowContext(ctx, query, userID).Scan(&required); err != nil {
+		return false, xerrors.DatabaseError(err, "twofactor.Required")
+	}
+
+	return required, nil
+}
+
+// Sets whether the members of a group must use two-factor authentication
+//
+// Members who have not enabled it yet are logged out, and must enroll the
+// next time they log in.
+func (tf *TwoFactor) SetGroupRequired(groupName string, required bool) *xerrors.AppError {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		WITH g AS (
+			UPDATE groups
+			SET require_2fa = $2, updated_at = NOW()
+			WHERE name = $1 AND deleted_at IS NULL
+			RETURNING id, creator_id
+		), logout AS (
+			DELETE FROM tokens t
+			USING g
+			WHERE $2 AND t.scope IN ($3, $4)
+			AND (t.user_id = g.creator_id OR t.user_id IN (SELECT user_id FROM group_members WHERE group_id = g.id))
+			AND NOT EXISTS (SELECT 1 FROM user_totp u WHERE u.user_id = t.user_id AND u.confirmed_at IS NOT NULL)
+			AND NOT EXISTS (SELECT 1 FROM webauthn_credentials w WHERE w.user_id = t.user_id)
+		)
+		SELECT COUNT(*) FROM g;
+	`
+
+	var count int
+	err := tf.DB.QueryRowContext(ctx, query, groupName, required, tokens.ScopeAuthentication, tokens.ScopeRefresh).
+		Scan(&count)
+	if err != nil {
+		return xerrors.DatabaseError(err, "twofactor.SetGroupRequired")
+	}
+
+	if count == 0 {
+		return xerrors.ClientError(http.StatusNotFound,
+			fmt.Sprintf("No group found with name: %s", groupName), "twofactor.SetGroupRequired", xerrors.ErrNotFound)
+	}
+
+	return nil
+}
+
+// ============================================================================
+// Helpers
+// ============================================================================
+
+// Returns where the TOTP secret of a user is stored, which its encryption at
+// rest is bound to
+func Binding(userID any) envelope.Record {
+	return envelope.Bind("user_totp", []string{"secret"}, userID)
+}
+
+// Replaces the recovery codes of a user in a transaction
+func setRecoveryCodes(ctx context.Context, tx *sql.Tx, userID int64, codeHashes [][]byte, op string) *xerrors.AppError {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM totp_recovery_codes WHERE user_id = $1;`, userID); err != nil {
+		return xerrors.DatabaseError(err, op+" - delete codes")
+	}
+
+	for _, hash := range codeHashes {
+		_, err := tx.ExecContext(ctx, `INSERT INTO totp_recovery_codes (user_id, hash) VALUES ($1, $2);`, userID, hash)
+		if err != nil {
+			return xerrors.DatabaseError(err, op+" - insert code")
+		}
+	}
+
+	return nil
+}
+
+// Returns a not found error for a user without a TOTP secret
+func notEnrolled(op string) *xerrors.AppError {
+	return xerrors.ClientError(http.StatusNotFound,
+		"Two-factor authentication is not set up", op, xerrors.ErrNotFound)
+}
+
+// Returns an unauthenticated error for a wrong or reused code
+func invalidCode(op string) *xerrors.AppError {
+	return xerrors.ClientError(http.StatusUnauthorized,
+		"The code is invalid or was already used", op, xerrors.ErrUnauthenticated)
+}
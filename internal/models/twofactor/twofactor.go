@@ -0,0 +1,75 @@
+package twofactor
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"strings"
+	"time"
+)
+
+// Number of recovery codes handed to a user at once
+const RecoveryCodeCount = 10
+
+// ============================================================================
+// Types
+// ============================================================================
+
+// Encapsulates the database properties of the TOTP secret of a user
+type TOTPRecord struct {
+	UserID      int64      `db:"user_id" json:"user_id"`           // Foreign key referencing users(id)
+	Secret      []byte     `db:"secret" json:"-"`                  // Shared secret, decrypted
+	LastStep    int64      `db:"last_step" json:"-"`               // Step of the last code accepted
+	ConfirmedAt *time.Time `db:"confirmed_at" json:"confirmed_at"` // Set once the user confirmed a first code
+	CreatedAt   time.Time  `db:"created_at" json:"created_at"`     // Timestamp of enrollment
+}
+
+// Checks if the secret was confirmed, and is required to log in
+func (t *TOTPRecord) Enabled() bool {
+	return t.ConfirmedAt != nil
+}
+
+// Two-factor authentication settings of a user
+type Status struct {
+	Enabled       bool       `json:"enabled"`        // Whether a second factor is required to log in
+	Required      bool       `json:"required"`       // Whether a group of the user requires it
+	TOTP          bool       `json:"totp"`           // Whether an authenticator app is enabled
+	SecurityKeys  int        `json:"security_keys"`  // Number of WebAuthn credentials registered
+	RecoveryCodes int        `json:"recovery_codes"` // Number of unused recovery codes
+	ConfirmedAt   *time.Time `json:"confirmed_at"`   // Set once the authenticator app is enabled
+}
+
+// ============================================================================
+// Recovery Codes
+// ============================================================================
+
+// Encodes recovery codes in lowercase base32, easier to read and type
+var codeEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// Generates a set of recovery codes, returning them along with their hashes
+//
+// Codes are formatted as two groups of five characters, like "abcde-fghij".
+func NewRecoveryCodes() ([]string, [][]byte, error) {
+	codes := make([]string, RecoveryCodeCount)
+	hashes := make([][]byte, RecoveryCodeCount)
+
+	for i := range codes {
+		randomBytes := make([]byte, 10)
+		if _, err := rand.Read(randomBytes); err != nil {
+			return nil, nil, err
+		}
+		code := codeEncoding.EncodeToString(randomBytes)[:10]
+		codes[i] = code[:5] + "-" + code[5:]
+		hashes[i] = HashRecoveryCode(codes[i])
+	}
+
+	return codes, hashes, nil
+}
+
+// Hashes a recovery code, ignoring case, spaces and dashes
+func HashRecoveryCode(code string) []byte {
+	code = strings.ToLower(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+	hash := sha256.Sum256([]byte(code))
+	return hash[:]
+}
@@ -0,0 +1,94 @@
+package users
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+
+	"pm4devs.strawhats/internal/validator"
+	"pm4devs.strawhats/internal/xerrors"
+)
+
+// ============================================================================
+// Constants
+// ============================================================================
+
+// Algorithms clients may derive keys from the master password with
+const (
+	KDFPBKDF2   = "pbkdf2-sha256"
+	KDFArgon2id = "argon2id"
+)
+
+// Lower bounds of the KDF parameters, following the OWASP recommendations
+const (
+	minSaltBytes        = 16
+	minPBKDF2Iterations = 600_000
+	minArgon2Iterations = 2
+	minArgon2Memory     = 19_456 // KiB
+)
+
+// ============================================================================
+// Type
+// ============================================================================
+
+// Parameters clients use to derive keys from the master password. The server
+// only stores them so every client derives the same keys.
+type KDF struct {
+	Algorithm   string `json:"algorithm"`             // pbkdf2-sha256 or argon2id
+	Salt        string `json:"salt"`                  // Base64 encoded, at least 16 bytes
+	Iterations  int    `json:"iterations"`            // Iterations of PBKDF2, passes of Argon2id
+	Memory      *int   `json:"memory,omitempty"`      // Memory of Argon2id in KiB
+	Parallelism *int   `json:"parallelism,omitempty"` // Lanes of Argon2id
+}
+
+// Creates the parameters given to users who register without any, PBKDF2
+// with a random salt
+func DefaultKDF() (*KDF, *xerrors.AppError) {
+	salt := make([]byte, minSaltBytes)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, xerrors.ServerError("users.DefaultKDF", xerrors.ErrServerInternal)
+	}
+
+	return &KDF{
+		Algorithm:  KDFPBKDF2,
+		Salt:       base64.StdEncoding.EncodeToString(salt),
+		Iterations: minPBKDF2Iterations,
+	}, nil
+}
+
+// Creates the parameters returned for an email without an account, PBKDF2
+// like the default with a salt derived from the email and the server secret
+//
+// The same email always gets the same parameters, so they can't be told apart
+// from those of an existing account.
+func FakeKDF(secret []byte, email string) *KDF {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("prelogin:" + email))
+
+	return &KDF{
+		Algorithm:  KDFPBKDF2,
+		Salt:       base64.StdEncoding.EncodeToString(mac.Sum(nil)[:minSaltBytes]),
+		Iterations: minPBKDF2Iterations,
+	}
+}
+
+// Checks the parameters of a KDF under the given key
+func ValidateKDF(v *validator.Validator, kdf *KDF, key string) {
+	salt, err := base64.StdEncoding.DecodeString(kdf.Salt)
+	v.Check(err == nil && len(salt) >= minSaltBytes, key, "salt must be at least 16 bytes, base64 encoded")
+
+	switch kdf.Algorithm {
+	case KDFPBKDF2:
+		v.Check(kdf.Iterations >= minPBKDF2Iterations, key, "iterations must be at least 600000 for pbkdf2-sha256")
+		v.Check(kdf.Memory == nil && kdf.Parallelism == nil, key, "memory and parallelism only apply to argon2id")
+
+	case KDFArgon2id:
+		v.Check(kdf.Iterations >= minArgon2Iterations, key, "iterations must be at least 2 for argon2id")
+		v.Check(kdf.Memory != nil && *kdf.Memory >= minArgon2Memory, key, "memory must be at least 19456 KiB for argon2id")
+		v.Check(kdf.Parallelism != nil && *kdf.Parallelism >= 1, key, "parallelism must be at least 1 for argon2id")
+
+	default:
+		v.AddError(key, "algorithm must be one of pbkdf2-sha256 or argon2id")
+	}
+}
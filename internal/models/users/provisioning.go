@@ -0,0 +1,234 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"pm4devs.strawhats/internal/models/core"
+	"pm4devs.strawhats/internal/xerrors"
+)
+
+// ============================================================================
+// Types
+// ============================================================================
+
+// UserFilter narrows down user listings. Zero values are ignored.
+type UserFilter struct {
+	ID     int64  // Unique identifier, negative to match no user
+	Email  string // Case-insensitive email
+	Name   string // Display name
+	Active *bool  // Whether the user is deactivated or not
+}
+
+// Builds the SQL conditions for the filter. Placeholders continue from the
+// args already given.
+func (f UserFilter) where(args []any) (string, []any) {
+	var conditions []string
+	add := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if f.ID != 0 {
+		add("id = $%d", f.ID)
+	}
+	if f.Email != "" {
+		add("lower(email) = lower($%d)", f.Email)
+	}
+	if f.Name != "" {
+		add("name = $%d", f.Name)
+	}
+	if f.Active != nil {
+		add("(deactivated_at IS NULL) = $%d", *f.Active)
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return " AND " + strings.Join(conditions, " AND "), args
+}
+
+// ============================================================================
+// Provisioning
+// ============================================================================
+
+// Users within reach of the identity provider: the ones it provisioned and the
+// ones linked to it with single sign-on. Service accounts and accounts made by
+// hand are left out.
+const provisioned = `owner_group_id IS NULL
+	AND (idp_managed OR id IN (SELECT user_id FROM sso_identities))`
+
+// Lists the users within reach of the identity provider matching a filter,
+// along with how many match in total
+func (m Users) GetAll(filter UserFilter, offset, limit int) (*[]UserRecord, int, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	where, args := filter.where(nil)
+
+	var total int
+	query := `SELECT COUNT(*) FROM users WHERE ` + provisioned + where
+	if err := m.DB.QueryRowContext(ctx, query, args...).Scan(&total); err != nil {
+		return nil, 0, xerrors.DatabaseError(err, "users.GetAll: failed to count users")
+	}
+
+	args = append(args, offset, limit)
+	query = fmt.Sprintf(`
+		SELECT id, email, COALESCE(name, ''), activated, created_at, version, deactivated_at
+		FROM users
+		WHERE %s%s
+		ORDER BY id
+		OFFSET $%d LIMIT $%d
+	`, provisioned, where, len(args)-1, len(args))
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, xerrors.DatabaseError(err, "users.GetAll")
+	}
+	defer rows.Close()
+
+	result := []UserRecord{}
+	for rows.Next() {
+		var user UserRecord
+		dest := []any{&user.ID, &user.Email, &user.Name, &user.Activated, &user.CreatedAt, &user.Version,
+			&user.DeactivatedAt}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, 0, xerrors.DatabaseError(err, "users.GetAll")
+		}
+		result = append(result, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, xerrors.DatabaseError(err, "users.GetAll")
+	}
+
+	return &result, total, nil
+}
+
+// Creates an activated user without a password, provisioned by the identity
+// provider, who signs in with single sign-on. The provider vouches for their
+// email.
+//
+// Check for xerrors.ErrUniqueViolation for email conflicts.
+func (m Users) InsertProvisioned(email, name string) (*UserRecord, *xerrors.AppError) {
+	kdf, appErr := DefaultKDF()
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	query := `
+		INSERT INTO users (email, password, name, activated, email_verified, idp_managed, kdf_algorithm, kdf_salt,
+			kdf_iterations, kdf_memory, kdf_parallelism)
+		VALUES ($1, '', NULLIF($2, ''), true, true, true, $3, $4, $5, $6, $7)
+		RETURNING id, activated, created_at, version
+	`
+	user := UserRecord{Email: email, Name: name, KDF: kdf}
+	args := append([]any{email, name}, kdfArgs(kdf)...)
+	dest := []any{&user.ID, &user.Activated, &user.CreatedAt, &user.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if err := m.DB.QueryRowContext(ctx, query, args...).Scan(dest...); err != nil {
+		return nil, xerrors.DatabaseError(err, "users.InsertProvisioned")
+	}
+
+	return &user, nil
+}
+
+// Sets the email and display name of a user within reach of the identity
+// provider
+//
+// A new email is no longer verified, so single sign-on doesn't link another
+// identity to the account by it. Check for xerrors.ErrUniqueViolation for
+// email conflicts.
+func (m Users) SetProfile(id int64, email, name string) *xerrors.AppError {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		UPDATE users
+		SET email = $1, name = NULLIF($2, ''), email_verified = email_verified AND lower(email) = lower($1),
+			version = version + 1
+		WHERE id = $3 AND ` + provisioned
+
+	result, err := m.DB.ExecContext(ctx, query, email, name, id)
+	if err != nil {
+		return xerrors.DatabaseError(err, "users.SetProfile")
+	}
+
+	return notFound(result, id, "users.SetProfile")
+}
+
+// Reactivates a user within reach of the identity provider, or deactivates
+// them and revokes every token they hold: sessions, personal access tokens and
+// pending activation or reset tokens
+//
+// Deactivated users keep their account, secrets and groups.
+func (m Users) SetActive(id int64, active bool) *xerrors.AppError {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	db, ok := m.DB.(*sql.DB)
+	if !ok {
+		return xerrors.DatabaseError(fmt.Errorf("failed to cast DB to *sql.DB"), "users.SetActive")
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return xerrors.DatabaseError(err, "users.SetActive")
+	}
+	// Rollback is a no-op once the transaction is committed
+	defer tx.Rollback()
+
+	query := `
+		UPDATE users
+		SET deactivated_at = CASE WHEN $2 THEN NULL ELSE COALESCE(deactivated_at, NOW()) END,
+			version = version + 1
+		WHERE id = $1 AND ` + provisioned
+	result, err := tx.ExecContext(ctx, query, id, active)
+	if err != nil {
+		return xerrors.DatabaseError(err, "users.SetActive")
+	}
+	if appErr := notFound(result, id, "users.SetActive"); appErr != nil {
+		return appErr
+	}
+
+	if !active {
+		for _, query := range []string{
+			`DELETE FROM tokens WHERE user_id = $1`,
+			`DELETE FROM token_families WHERE user_id = $1`,
+			`DELETE FROM access_tokens WHERE user_id = $1`,
+		} {
+			if _, err := tx.ExecContext(ctx, query, id); err != nil {
+				return xerrors.DatabaseError(err, "users.SetActive: failed to revoke tokens")
+			}
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return xerrors.DatabaseError(err, "users.SetActive: failed to commit transaction")
+	}
+
+	return nil
+}
+
+// ============================================================================
+// Helpers
+// ============================================================================
+
+// Returns a not found error if no user was affected
+func notFound(result sql.Result, id int64, op string) *xerrors.AppError {
+	rowsAffected, err := core.RowsAffected(result, op)
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return xerrors.ClientError(http.StatusNotFound, fmt.Sprintf("No user found with id: %d", id), op,
+			xerrors.ErrNotFound)
+	}
+	return nil
+}
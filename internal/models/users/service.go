@@ -2,6 +2,7 @@ package users
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"pm4devs.strawhats/internal/models/core"
@@ -16,11 +17,23 @@ import (
 // Defines a mockable interface for user operations
 type UsersRepository interface {
 	Delete(user *UserRecord) (int64, *xerrors.AppError)
+	DeleteServiceAccount(id int64) *xerrors.AppError
 	GetByEmail(email string) (*UserRecord, *xerrors.AppError)
-	GetByToken(plaintext string) (*UserRecord, *xerrors.AppError)
+	GetByID(id int64) (*UserRecord, *xerrors.AppError)
+	GetAll(filter UserFilter, offset, limit int) (*[]UserRecord, int, *xerrors.AppError)
+	GetByToken(plaintext, scope string) (*UserRecord, *xerrors.AppError)
+	GetKDF(email string) (*KDF, *xerrors.AppError)
+	GetServiceAccount(id int64) (*ServiceAccount, *xerrors.AppError)
+	GetServiceAccounts(groupID int64) (*[]ServiceAccount, *xerrors.AppError)
 	Insert(user *UserRecord) *xerrors.AppError
+	InsertProvisioned(email, name string) (*UserRecord, *xerrors.AppError)
+	InsertServiceAccount(name string, groupID int64) (*ServiceAccount, *xerrors.AppError)
 	New(email, plaintext string) (*UserRecord, *xerrors.AppError)
+	SetActive(id int64, active bool) *xerrors.AppError
+	SetKDF(userID int64, kdf *KDF) *xerrors.AppError
+	SetProfile(id int64, email, name string) *xerrors.AppError
 	Update(user *UserRecord) *xerrors.AppError
+	VerifyEmail(id int64) *xerrors.AppError
 }
 
 func Repository(db core.Queryable) UsersRepository {
@@ -59,11 +72,11 @@ func (Users) New(email, plaintext string) (*UserRecord, *xerrors.AppError) {
 // User.Version
 func (m Users) Insert(user *UserRecord) *xerrors.AppError {
 	query := `
-		INSERT INTO users (email, password)
-		VALUES ($1, $2)
+		INSERT INTO users (email, password, kdf_algorithm, kdf_salt, kdf_iterations, kdf_memory, kdf_parallelism)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
 		RETURNING id, activated, created_at, version
 	`
-	args := []any{user.Email, user.Password}
+	args := append([]any{user.Email, user.Password}, kdfArgs(user.KDF)...)
 	dest := []any{&user.ID, &user.Activated, &user.CreatedAt, &user.Version}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -79,12 +92,13 @@ func (m Users) Insert(user *UserRecord) *xerrors.AppError {
 // Gets the user by their email
 func (m Users) GetByEmail(email string) (*UserRecord, *xerrors.AppError) {
 	query := `
-		SELECT id, email, password, activated, created_at, version
+		SELECT id, email, password, activated, created_at, version, owner_group_id
 		FROM users
 		WHERE email = $1
 	`
 	var user UserRecord
-	dest := []any{&user.ID, &user.Email, &user.Password, &user.Activated, &user.CreatedAt, &user.Version}
+	dest := []any{&user.ID, &user.Email, &user.Password, &user.Activated, &user.CreatedAt, &user.Version,
+		&user.OwnerGroupID}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -96,19 +110,44 @@ func (m Users) GetByEmail(email string) (*UserRecord, *xerrors.AppError) {
 	return &user, nil
 }
 
+// Gets the user by their ID
+func (m Users) GetByID(id int64) (*UserRecord, *xerrors.AppError) {
+	query := `
+		SELECT id, email, password, activated, created_at, version, owner_group_id
+		FROM users
+		WHERE id = $1
+	`
+	var user UserRecord
+	dest := []any{&user.ID, &user.Email, &user.Password, &user.Activated, &user.CreatedAt, &user.Version,
+		&user.OwnerGroupID}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if err := m.DB.QueryRowContext(ctx, query, id).Scan(dest...); err != nil {
+		return nil, xerrors.DatabaseError(err, "users.GetByID")
+	}
+
+	return &user, nil
+}
+
 // Gets the user from one of their tokens
-func (m Users) GetByToken(plaintext string) (*UserRecord, *xerrors.AppError) {
+func (m Users) GetByToken(plaintext, scope string) (*UserRecord, *xerrors.AppError) {
 	query := `
-		SELECT users.id, users.email, users.password, users.activated, users.created_at, users.version
+		SELECT users.id, users.email, users.password, users.activated, users.created_at, users.version,
+			users.owner_group_id
 		FROM users
 		INNER JOIN tokens
 		ON users.id = tokens.user_id
 		WHERE tokens.hash = $1
-		AND tokens.expiry > $2
+		AND tokens.scope = $2
+		AND tokens.expiry > $3
+		AND users.deactivated_at IS NULL
 	`
 	var user UserRecord
-	args := []any{tokens.Hash(plaintext), time.Now()}
-	dest := []any{&user.ID, &user.Email, &user.Password, &user.Activated, &user.CreatedAt, &user.Version}
+	args := []any{tokens.Hash(plaintext), scope, time.Now()}
+	dest := []any{&user.ID, &user.Email, &user.Password, &user.Activated, &user.CreatedAt, &user.Version,
+		&user.OwnerGroupID}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -150,6 +189,19 @@ func (m Users) Update(user *UserRecord) *xerrors.AppError {
 	return nil
 }
 
+// Records that a user proved they own their email
+func (m Users) VerifyEmail(id int64) *xerrors.AppError {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `UPDATE users SET email_verified = true WHERE id = $1`, id)
+	if err != nil {
+		return xerrors.DatabaseError(err, "users.VerifyEmail")
+	}
+
+	return nil
+}
+
 // Deletes a user
 func (m Users) Delete(user *UserRecord) (int64, *xerrors.AppError) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -162,3 +214,72 @@ func (m Users) Delete(user *UserRecord) (int64, *xerrors.AppError) {
 
 	return core.RowsAffected(result, "users.Delete")
 }
+
+// Gets the KDF parameters of the user with the given email
+//
+// Returns nil for accounts registered before the parameters were stored.
+func (m Users) GetKDF(email string) (*KDF, *xerrors.AppError) {
+	query := `
+		SELECT kdf_algorithm, kdf_salt, kdf_iterations, kdf_memory, kdf_parallelism
+		FROM users
+		WHERE email = $1
+	`
+	var algorithm, salt sql.NullString
+	var iterations sql.NullInt64
+	var kdf KDF
+	dest := []any{&algorithm, &salt, &iterations, &kdf.Memory, &kdf.Parallelism}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if err := m.DB.QueryRowContext(ctx, query, email).Scan(dest...); err != nil {
+		return nil, xerrors.DatabaseError(err, "users.GetKDF")
+	}
+	if !algorithm.Valid {
+		return nil, nil
+	}
+
+	kdf.Algorithm, kdf.Salt, kdf.Iterations = algorithm.String, salt.String, int(iterations.Int64)
+	return &kdf, nil
+}
+
+// Replaces the KDF parameters of a user
+func (m Users) SetKDF(userID int64, kdf *KDF) *xerrors.AppError {
+	query := `
+		UPDATE users
+		SET kdf_algorithm = $1, kdf_salt = $2, kdf_iterations = $3, kdf_memory = $4, kdf_parallelism = $5,
+			version = version + 1
+		WHERE id = $6
+	`
+	args := append(kdfArgs(kdf), userID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return xerrors.DatabaseError(err, "users.SetKDF")
+	}
+
+	rowsAffected, appErr := core.RowsAffected(result, "users.SetKDF")
+	if appErr != nil {
+		return appErr
+	}
+	if rowsAffected == 0 {
+		return xerrors.DatabaseError(sql.ErrNoRows, "users.SetKDF")
+	}
+
+	return nil
+}
+
+// ============================================================================
+// Helpers
+// ============================================================================
+
+// Returns the KDF columns of a user, all NULL when no parameters are given
+func kdfArgs(kdf *KDF) []any {
+	if kdf == nil {
+		return []any{nil, nil, nil, nil, nil}
+	}
+	return []any{kdf.Algorithm, kdf.Salt, kdf.Iterations, kdf.Memory, kdf.Parallelism}
+}
@@ -0,0 +1,183 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"pm4devs.strawhats/internal/validator"
+	"pm4devs.strawhats/internal/xerrors"
+)
+
+// Reserved domain of the service account emails, which is never mailed
+const ServiceAccountDomain = "service.invalid"
+
+// Service account names fit in the local part of their email
+var serviceAccountNameRX = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,62}[a-z0-9]$`)
+
+// ============================================================================
+// Type
+// ============================================================================
+
+// A non-human user owned by a group, authenticating with access tokens only
+type ServiceAccount struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"` // Identifies the account when sharing secrets or adding it to groups
+	GroupID   int64     `json:"group_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Returns the email identifying a service account of a group
+func ServiceAccountEmail(name string, groupID int64) string {
+	return fmt.Sprintf("%s.%d@%s", name, groupID, ServiceAccountDomain)
+}
+
+// Validates the name of a service account
+func ValidateServiceAccountName(v *validator.Validator, name, key string) {
+	v.Check(serviceAccountNameRX.MatchString(name), key,
+		"must be 3 to 64 lowercase letters, digits or hyphens, not starting or ending with a hyphen")
+}
+
+// Checks if an email belongs to the service account domain
+func IsServiceAccountEmail(email string) bool {
+	return strings.HasSuffix(strings.ToLower(email), "@"+ServiceAccountDomain)
+}
+
+// ============================================================================
+// Implementation
+// ============================================================================
+
+// Creates a service account owned by a group, as a member of the group
+//
+// Check for xerrors.ErrUniqueViolation for name conflicts within the group.
+func (m Users) InsertServiceAccount(name string, groupID int64) (*ServiceAccount, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	db, ok := m.DB.(*sql.DB)
+	if !ok {
+		return nil, xerrors.DatabaseError(fmt.Errorf("failed to cast DB to *sql.DB"), "users.InsertServiceAccount")
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, "users.InsertServiceAccount")
+	}
+	// Rollback is a no-op once the transaction is committed
+	defer tx.Rollback()
+
+	// Without a password, the account can't log in
+	query := `
+		INSERT INTO users (email, password, name, activated, owner_group_id)
+		VALUES ($1, '', $2, true, $3)
+		RETURNING id, created_at
+	`
+	account := ServiceAccount{Name: name, Email: ServiceAccountEmail(name, groupID), GroupID: groupID}
+	err = tx.QueryRowContext(ctx, query, account.Email, name, groupID).Scan(&account.ID, &account.CreatedAt)
+	if err != nil {
+		appErr := xerrors.DatabaseError(err, "users.InsertServiceAccount")
+		if appErr.Matches(xerrors.ErrUniqueViolation) {
+			return nil, xerrors.ClientError(http.StatusConflict,
+				fmt.Sprintf("A service account named %s already exists in this group", name),
+				"users.InsertServiceAccount", xerrors.ErrUniqueViolation)
+		}
+		return nil, appErr
+	}
+
+	query = `
+		WITH member AS (
+			INSERT INTO group_members (group_id, user_id)
+			VALUES ($1, $2)
+			RETURNING group_id
+		)
+		UPDATE groups SET version = version + 1 WHERE id IN (SELECT group_id FROM member);
+	`
+	if _, err = tx.ExecContext(ctx, query, groupID, account.ID); err != nil {
+		return nil, xerrors.DatabaseError(err, "users.InsertServiceAccount: failed to add to group")
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, xerrors.DatabaseError(err, "users.InsertServiceAccount: failed to commit transaction")
+	}
+
+	return &account, nil
+}
+
+// Gets a service account by its ID
+func (m Users) GetServiceAccount(id int64) (*ServiceAccount, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT id, name, email, owner_group_id, created_at
+		FROM users
+		WHERE id = $1 AND owner_group_id IS NOT NULL
+	`
+
+	var account ServiceAccount
+	dest := []any{&account.ID, &account.Name, &account.Email, &account.GroupID, &account.CreatedAt}
+	if err := m.DB.QueryRowContext(ctx, query, id).Scan(dest...); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, xerrors.ClientError(http.StatusNotFound,
+				fmt.Sprintf("No service account found with id: %d", id), "users.GetServiceAccount",
+				xerrors.ErrNotFound)
+		}
+		return nil, xerrors.DatabaseError(err, "users.GetServiceAccount")
+	}
+
+	return &account, nil
+}
+
+// Lists the service accounts owned by a group
+func (m Users) GetServiceAccounts(groupID int64) (*[]ServiceAccount, *xerrors.AppError) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT id, name, email, owner_group_id, created_at
+		FROM users
+		WHERE owner_group_id = $1
+		ORDER BY name
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, groupID)
+	if err != nil {
+		return nil, xerrors.DatabaseError(err, "users.GetServiceAccounts")
+	}
+	defer rows.Close()
+
+	accounts := []ServiceAccount{}
+	for rows.Next() {
+		var account ServiceAccount
+		dest := []any{&account.ID, &account.Name, &account.Email, &account.GroupID, &account.CreatedAt}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, xerrors.DatabaseError(err, "users.GetServiceAccounts - scan")
+		}
+		accounts = append(accounts, account)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, xerrors.DatabaseError(err, "users.GetServiceAccounts - rows error")
+	}
+
+	return &accounts, nil
+}
+
+// Deletes a service account, along with its memberships, shares and access
+// tokens
+func (m Users) DeleteServiceAccount(id int64) *xerrors.AppError {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `DELETE FROM users WHERE id = $1 AND owner_group_id IS NOT NULL`
+	if _, err := m.DB.ExecContext(ctx, query, id); err != nil {
+		return xerrors.DatabaseError(err, "users.DeleteServiceAccount")
+	}
+
+	return nil
+}
@@ -25,12 +25,17 @@ type UserRecord struct {
 	Activated bool      `json:"activated"`
 	CreatedAt time.Time `json:"created_at"`
 	Version   int       `json:"-"`
+	KDF       *KDF      `json:"kdf,omitempty"`
+
+	OwnerGroupID  *int64     `json:"owner_group_id,omitempty"` // Group owning the user if it is a service account
+	DeactivatedAt *time.Time `json:"deactivated_at,omitempty"` // Set while the identity provider deprovisioned the user
 }
 
 // Create a new User
 func new(email, plaintext string) (*UserRecord, *xerrors.AppError) {
 	v := validator.New()
 	v.IsEmail(email, "email", "is invalid")
+	v.Check(!IsServiceAccountEmail(email), "email", "is reserved for service accounts")
 	v.Check(len(plaintext) >= 8, "password", "must be at least 8 characters")
 
 	if err := v.Valid("users.new.valid"); err != nil {
@@ -58,8 +63,25 @@ func (u *UserRecord) SetPassword(plaintext string) *xerrors.AppError {
 	return nil
 }
 
+// Checks if a user is a service account, which never logs in nor receives
+// emails
+func (u *UserRecord) IsServiceAccount() bool {
+	return u.OwnerGroupID != nil
+}
+
+// Checks if a user was deprovisioned, which keeps them from logging in
+func (u *UserRecord) IsDeactivated() bool {
+	return u.DeactivatedAt != nil
+}
+
 // Checks a user's password
+//
+// Users without a password, who only sign in with single sign-on, never match.
 func (user *UserRecord) PasswordMatches(plaintext string) (bool, *xerrors.AppError) {
+	if user.Password == "" {
+		return false, nil
+	}
+
 	err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(plaintext))
 	if err != nil {
 		switch {
@@ -0,0 +1,418 @@
+// oidc signs users in with an OpenID Connect provider (OpenID Connect Core
+// 1.0), using the authorization code flow with PKCE (RFC 7636)
+//
+// The server hands the client the URL of the provider's authorization
+// endpoint, carrying a random state, a nonce and the S256 challenge of a code
+// verifier. Once the user signed in, the provider redirects the client back
+// with a code, exchanged along with the verifier for an ID token. The ID token
+// is verified with the keys the provider publishes, found through discovery,
+// and must be signed with RS256 or ES256.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	RandomSize = 32               // Size of states, nonces and code verifiers
+	Timeout    = 10 * time.Minute // How long a sign-in may take
+	Leeway     = time.Minute      // Clock drift allowed with the provider
+)
+
+var (
+	ErrDiscovery    = errors.New("discovery failed")
+	ErrExchange     = errors.New("code exchange failed")
+	ErrInvalidToken = errors.New("invalid ID token")
+	ErrUnknownKey   = errors.New("unknown signing key")
+)
+
+// ============================================================================
+// Types
+// ============================================================================
+
+// Claims of an ID token
+type Claims struct {
+	Issuer          string   `json:"iss"`
+	Subject         string   `json:"sub"`
+	Audience        audience `json:"aud"`
+	AuthorizedParty string   `json:"azp"`
+	Expiry          int64    `json:"exp"`
+	IssuedAt        int64    `json:"iat"`
+	Nonce           string   `json:"nonce"`
+	Email           string   `json:"email"`
+	EmailVerified   bool     `json:"email_verified"`
+	Name            string   `json:"name"`
+
+	raw map[string]json.RawMessage
+}
+
+// Returns the values of a claim listing groups, a single string or an array
+// of strings, nil if missing
+func (c *Claims) Groups(claim string) []string {
+	raw, ok := c.raw[claim]
+	if !ok {
+		return nil
+	}
+
+	var groups []string
+	if err := json.Unmarshal(raw, &groups); err == nil {
+		return groups
+	}
+	var group string
+	if err := json.Unmarshal(raw, &group); err == nil && group != "" {
+		return []string{group}
+	}
+	return nil
+}
+
+// Audience of an ID token, a single string or an array of strings
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(a))
+}
+
+// Endpoints of a provider, found through discovery
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// ============================================================================
+// Provider
+// ============================================================================
+
+// OpenID Connect provider users sign in with
+type Provider struct {
+	Issuer       string   // Issuer identifier, the ID tokens must carry it
+	ClientID     string   // ID of the client registered with the provider
+	ClientSecret string   // Secret of a confidential client, empty for a public one
+	RedirectURL  string   // Where the provider sends the client back with a code by default
+	Scopes       []string // Scopes requested, openid is always included
+	Client       *http.Client
+
+	mu       sync.Mutex
+	metadata *metadata
+	keys     map[string]any
+}
+
+// Generates a random state, nonce or code verifier
+func Random() (string, error) {
+	random := make([]byte, RandomSize)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(random), nil
+}
+
+// Returns the S256 challenge of a code verifier
+func Challenge(verifier string) string {
+	digest := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(digest[:])
+}
+
+// Returns the URL of the provider's authorization endpoint to send the user
+// to, carrying the state, nonce and challenge of the code verifier
+//
+// The user is sent back to the redirect URL, or to the default one if empty.
+func (p *Provider) AuthURL(ctx context.Context, state, nonce, verifier, redirectURL string) (string, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	scopes := []string{"openid"}
+	for _, scope := range p.Scopes {
+		if scope != "openid" {
+			scopes = append(scopes, scope)
+		}
+	}
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.ClientID},
+		"redirect_uri":          {p.redirect(redirectURL)},
+		"scope":                 {strings.Join(scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {Challenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(metadata.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return metadata.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchanges a code for an ID token and returns its verified claims
+//
+// The redirect URL must be the one the sign-in was started with.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce, redirectURL string) (*Claims, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.redirect(redirectURL)},
+		"code_verifier": {verifier},
+	}
+	if p.ClientSecret == "" {
+		form.Set("client_id", p.ClientID)
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, metadata.TokenEndpoint,
+		strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrExchange, err)
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	if p.ClientSecret != "" {
+		request.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+	}
+
+	var response struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	status, err := p.do(request, &response)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrExchange, err)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s %s", ErrExchange, response.Error, response.ErrorDescription)
+	}
+	if response.IDToken == "" {
+		return nil, fmt.Errorf("%w: no ID token was returned", ErrExchange)
+	}
+
+	return p.verify(ctx, response.IDToken, nonce)
+}
+
+// Returns the redirect URL of a sign-in, the default one if empty
+func (p *Provider) redirect(redirectURL string) string {
+	if redirectURL == "" {
+		return p.RedirectURL
+	}
+	return redirectURL
+}
+
+// ============================================================================
+// ID Tokens
+// ============================================================================
+
+// Verifies the signature and claims of an ID token
+func (p *Provider) verify(ctx context.Context, token, nonce string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed", ErrInvalidToken)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature", ErrInvalidToken)
+	}
+	key, err := p.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if err := decodeSegment(parts[1], &claims.raw); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	switch {
+	case claims.Issuer != p.Issuer:
+		return nil, fmt.Errorf("%w: issued by %q", ErrInvalidToken, claims.Issuer)
+
+	case !contains(claims.Audience, p.ClientID):
+		return nil, fmt.Errorf("%w: not issued to this client", ErrInvalidToken)
+
+	case len(claims.Audience) > 1 && claims.AuthorizedParty != p.ClientID:
+		return nil, fmt.Errorf("%w: not authorized for this client", ErrInvalidToken)
+
+	case claims.Subject == "":
+		return nil, fmt.Errorf("%w: no subject", ErrInvalidToken)
+
+	case now.Add(-Leeway).After(time.Unix(claims.Expiry, 0)):
+		return nil, fmt.Errorf("%w: expired", ErrInvalidToken)
+
+	case now.Add(Leeway).Before(time.Unix(claims.IssuedAt, 0)):
+		return nil, fmt.Errorf("%w: issued in the future", ErrInvalidToken)
+
+	case claims.Nonce != nonce:
+		return nil, fmt.Errorf("%w: nonce does not match", ErrInvalidToken)
+	}
+
+	return &claims, nil
+}
+
+// Decodes a base64url encoded JSON segment of a token
+func decodeSegment(segment string, dst any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return fmt.Errorf("%w: malformed", ErrInvalidToken)
+	}
+	if err := json.Unmarshal(data, dst); err != nil {
+		return fmt.Errorf("%w: malformed", ErrInvalidToken)
+	}
+	return nil
+}
+
+// Checks if a list holds a value
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// ============================================================================
+// Discovery
+// ============================================================================
+
+// Returns the endpoints of the provider, fetched once
+func (p *Provider) discover(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		strings.TrimSuffix(p.Issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDiscovery, err)
+	}
+
+	var metadata metadata
+	status, err := p.do(request, &metadata)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDiscovery, err)
+	}
+	switch {
+	case status != http.StatusOK:
+		return nil, fmt.Errorf("%w: status %d", ErrDiscovery, status)
+
+	case metadata.Issuer != p.Issuer:
+		return nil, fmt.Errorf("%w: the provider identifies as %q", ErrDiscovery, metadata.Issuer)
+
+	case metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "":
+		return nil, fmt.Errorf("%w: missing endpoints", ErrDiscovery)
+	}
+
+	p.metadata = &metadata
+	return p.metadata, nil
+}
+
+// Returns the signing key with the given ID, fetching the keys of the
+// provider again if it is unknown as the provider may have rotated them
+func (p *Provider) key(ctx context.Context, kid string) (any, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, metadata.JWKSURI, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDiscovery, err)
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	status, err := p.do(request, &set)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDiscovery, err)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("%w: status %d fetching keys", ErrDiscovery, status)
+	}
+
+	// Keys that aren't for signatures, or of unsupported types, are skipped
+	p.keys = map[string]any{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		if key, err := jwk.publicKey(); err == nil {
+			p.keys[jwk.Kid] = key
+		}
+	}
+
+	key, ok := p.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+	}
+	return key, nil
+}
+
+// Sends a request to the provider and decodes its JSON response, returning
+// its status
+func (p *Provider) do(request *http.Request, dst any) (int, error) {
+	client := p.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	// Error responses may not be JSON
+	body, err := io.ReadAll(io.LimitReader(response.Body, 1<<20))
+	if err != nil {
+		return 0, err
+	}
+	if err := json.Unmarshal(body, dst); err != nil && response.StatusCode == http.StatusOK {
+		return 0, err
+	}
+	return response.StatusCode, nil
+}
@@ -0,0 +1,153 @@
+package oidc
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"pm4devs.strawhats/internal/assert"
+	"pm4devs.strawhats/internal/mocks"
+)
+
+// Creates a provider for an issuer
+func provider(issuer *mocks.Issuer) *Provider {
+	return &Provider{
+		Issuer:       issuer.URL,
+		ClientID:     issuer.ClientID,
+		ClientSecret: issuer.ClientSecret,
+		RedirectURL:  "http://localhost:4000/sso/callback",
+		Scopes:       []string{"email", "profile"},
+	}
+}
+
+// Starts a sign-in, returning the code and the verifier and nonce it was
+// started with
+func signIn(t *testing.T, p *Provider, issuer *mocks.Issuer, claims map[string]any) (string, string, string) {
+	t.Helper()
+
+	state, _ := Random()
+	nonce, _ := Random()
+	verifier, _ := Random()
+	authURL, err := p.AuthURL(context.Background(), state, nonce, verifier, "")
+	assert.Check(t, err == nil)
+
+	code, returned, err := issuer.Authorize(authURL, claims)
+	assert.Check(t, err == nil)
+	assert.Equal(t, returned, state)
+	return code, verifier, nonce
+}
+
+func TestAuthURL(t *testing.T) {
+	issuer := mocks.NewIssuer(t)
+	p := provider(issuer)
+
+	authURL, err := p.AuthURL(context.Background(), "state", "nonce", "verifier", "")
+	assert.Check(t, err == nil)
+	assert.Check(t, strings.HasPrefix(authURL, issuer.URL+"/authorize?"))
+
+	parsed, _ := url.Parse(authURL)
+	query := parsed.Query()
+	assert.Equal(t, query.Get("scope"), "openid email profile")
+	assert.Equal(t, query.Get("code_challenge"), Challenge("verifier"))
+	assert.Equal(t, query.Get("code_challenge_method"), "S256")
+
+	// The issuer must identify as configured
+	p = provider(issuer)
+	p.Issuer = issuer.URL + "/"
+	_, err = p.AuthURL(context.Background(), "state", "nonce", "verifier", "")
+	assert.Is(t, err, ErrDiscovery)
+}
+
+func TestExchange(t *testing.T) {
+	issuer := mocks.NewIssuer(t)
+	p := provider(issuer)
+	claims := map[string]any{
+		"sub":            "1234",
+		"email":          "test@example.com",
+		"email_verified": true,
+		"name":           "Test",
+		"groups":         []string{"backend", "ops"},
+	}
+
+	code, verifier, nonce := signIn(t, p, issuer, claims)
+	result, err := p.Exchange(context.Background(), code, verifier, nonce, "")
+	assert.Check(t, err == nil)
+	assert.Equal(t, result.Subject, "1234")
+	assert.Equal(t, result.Email, "test@example.com")
+	assert.True(t, result.EmailVerified)
+	assert.Equal(t, fmt.Sprint(result.Groups("groups")), "[backend ops]")
+	assert.Check(t, result.Groups("roles") == nil)
+
+	// Codes are used once
+	_, err = p.Exchange(context.Background(), code, verifier, nonce, "")
+	assert.Is(t, err, ErrExchange)
+
+	// The verifier must match the challenge
+	code, _, nonce = signIn(t, p, issuer, claims)
+	_, err = p.Exchange(context.Background(), code, "other", nonce, "")
+	assert.Is(t, err, ErrExchange)
+
+	// The nonce must match
+	code, verifier, _ = signIn(t, p, issuer, claims)
+	_, err = p.Exchange(context.Background(), code, verifier, "other", "")
+	assert.Is(t, err, ErrInvalidToken)
+}
+
+func TestVerify(t *testing.T) {
+	issuer := mocks.NewIssuer(t)
+	p := provider(issuer)
+	now := time.Now()
+	valid := func() map[string]any {
+		return map[string]any{
+			"iss":   issuer.URL,
+			"aud":   issuer.ClientID,
+			"sub":   "1234",
+			"iat":   now.Unix(),
+			"exp":   now.Add(5 * time.Minute).Unix(),
+			"nonce": "nonce",
+		}
+	}
+
+	_, err := p.verify(context.Background(), issuer.Sign(valid()), "nonce")
+	assert.Check(t, err == nil)
+
+	tests := []struct {
+		name   string
+		modify func(claims map[string]any)
+	}{
+		{"Issuer", func(claims map[string]any) { claims["iss"] = "https://evil.example.com" }},
+		{"Audience", func(claims map[string]any) { claims["aud"] = "other" }},
+		{"AuthorizedParty", func(claims map[string]any) { claims["aud"] = []string{issuer.ClientID, "other"} }},
+		{"Subject", func(claims map[string]any) { delete(claims, "sub") }},
+		{"Expired", func(claims map[string]any) { claims["exp"] = now.Add(-time.Hour).Unix() }},
+		{"Future", func(claims map[string]any) { claims["iat"] = now.Add(time.Hour).Unix() }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := valid()
+			tt.modify(claims)
+			_, err := p.verify(context.Background(), issuer.Sign(claims), "nonce")
+			assert.Is(t, err, ErrInvalidToken)
+		})
+	}
+
+	// Signatures must verify
+	token := issuer.Sign(valid())
+	parts := strings.Split(token, ".")
+	tampered := issuer.Sign(map[string]any{"sub": "other"})
+	_, err = p.verify(context.Background(), parts[0]+"."+strings.Split(tampered, ".")[1]+"."+parts[2], "nonce")
+	assert.Is(t, err, ErrInvalidToken)
+
+	// Unsigned tokens are refused
+	_, err = p.verify(context.Background(), "eyJhbGciOiJub25lIiwia2lkIjoidGVzdCJ9."+parts[1]+".", "nonce")
+	assert.Is(t, err, ErrInvalidToken)
+
+	// Keys the provider does not publish are unknown
+	other := mocks.NewIssuer(t)
+	other.KeyID = "other"
+	_, err = p.verify(context.Background(), other.Sign(valid()), "nonce")
+	assert.Is(t, err, ErrUnknownKey)
+}
@@ -0,0 +1,79 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"pm4devs.strawhats/internal/xerrors"
+)
+
+// ============================================================================
+// ETag
+// ============================================================================
+
+// Formats the ETag of a versioned record, e.g. ETag(id, version)
+func ETag(parts ...any) string {
+	values := make([]string, len(parts))
+	for i, part := range parts {
+		values[i] = fmt.Sprint(part)
+	}
+	return `"` + strings.Join(values, "-") + `"`
+}
+
+// Sets the ETag header of a response. Returns true after writing 304 Not
+// Modified when the If-None-Match header already holds the ETag, in which
+// case the handler should stop.
+func (rest *Rest) NotModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+
+	if matches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+// Checks the If-Match header of a request against the current ETag of the
+// record it changes. Requests without If-Match are not checked.
+func IfMatch(r *http.Request, etag, op string) *xerrors.AppError {
+	header := r.Header.Get("If-Match")
+	if header == "" || matches(header, etag) {
+		return nil
+	}
+	return preconditionFailed(op)
+}
+
+// Reports an edit conflict on a request with If-Match as a failed
+// precondition, since the record changed after the client last read it
+func Precondition(r *http.Request, err *xerrors.AppError) *xerrors.AppError {
+	if r.Header.Get("If-Match") != "" && err.Matches(xerrors.ErrEditConflict) {
+		return preconditionFailed(err.Op)
+	}
+	return err
+}
+
+// ============================================================================
+// Helpers
+// ============================================================================
+
+// Reports whether a comma separated If-Match or If-None-Match header holds
+// the ETag. Weak comparison is used, as both headers allow it for GET.
+func matches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func preconditionFailed(op string) *xerrors.AppError {
+	return xerrors.ClientError(
+		http.StatusPreconditionFailed,
+		"The resource was changed since it was last read, fetch it again and retry",
+		op,
+		xerrors.ErrPreconditionFailed,
+	)
+}
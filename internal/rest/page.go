@@ -0,0 +1,65 @@
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"pm4devs.strawhats/internal/xerrors"
+)
+
+// ============================================================================
+// Write Page
+// ============================================================================
+
+// Writes a page of a listing with the cursor of the next page. The rows are
+// reduced to the given JSON fields, if any. Listings leave the large values
+// of other fields out of their queries, only the keys are dropped here.
+func (rest *Rest) WritePage(w http.ResponseWriter, op string, data any, fields []string, next string) {
+	if len(fields) > 0 {
+		projected, err := project(data, fields)
+		if err != nil {
+			rest.Error(w, xerrors.ServerError(op, fmt.Errorf("%w: %v", xerrors.ErrServerInternal, err)))
+			return
+		}
+		data = projected
+	}
+
+	var nextCursor *string
+	if next != "" {
+		nextCursor = &next
+	}
+
+	rest.WriteJSON(w, op, http.StatusOK, Envelope{
+		"message":     "Success!",
+		"data":        data,
+		"next_cursor": nextCursor,
+	})
+}
+
+// Keeps only the given JSON fields of every row. Unknown fields are ignored.
+func project(data any, fields []string) ([]map[string]json.RawMessage, error) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []map[string]json.RawMessage
+	if err := json.Unmarshal(encoded, &rows); err != nil {
+		return nil, err
+	}
+
+	keep := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		keep[field] = true
+	}
+
+	for _, row := range rows {
+		for field := range row {
+			if !keep[field] {
+				delete(row, field)
+			}
+		}
+	}
+	return rows, nil
+}
@@ -0,0 +1,59 @@
+package accesstoken
+
+import (
+	"net/http"
+
+	"pm4devs.strawhats/internal/app"
+	"pm4devs.strawhats/internal/models/accesstokens"
+	"pm4devs.strawhats/internal/models/group"
+	"pm4devs.strawhats/internal/models/secrets"
+	"pm4devs.strawhats/internal/models/users"
+	"pm4devs.strawhats/internal/rest"
+	"pm4devs.strawhats/internal/routes/middleware"
+	"pm4devs.strawhats/internal/xlogger"
+)
+
+// Encapsulates the Application dependencies required by routes
+type AccessToken struct {
+	logger       xlogger.Logger
+	rest         *rest.Rest
+	accessTokens accesstokens.AccessTokensRepository
+	group        group.GroupRepository
+	secrets      secrets.SecretsRepository
+	users        users.UsersRepository
+}
+
+func New(app *app.App) *AccessToken {
+	return &AccessToken{
+		logger:       app.Logger,
+		rest:         app.Rest,
+		accessTokens: app.Models.AccessTokens,
+		group:        app.Models.Group,
+		secrets:      app.Models.Secrets,
+		users:        app.Models.Users,
+	}
+}
+
+// Access tokens are managed with a session, never with an access token
+func (at *AccessToken) Route(mux *http.ServeMux, mw *middleware.Middleware) {
+	mux.HandleFunc(TokensRoute, mw.Authenticated(at.handleTokens))
+}
+
+// ============================================================================
+// Tokens
+// ============================================================================
+
+const TokensRoute = "/v1/tokens"
+
+func (app *AccessToken) handleTokens(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		app.list(w, r)
+	case http.MethodPost:
+		app.create(w, r)
+	case http.MethodDelete:
+		app.revoke(w, r)
+	default:
+		app.rest.MethodNotAllowed(w, r, "GET, POST, DELETE")
+	}
+}
@@ -0,0 +1,226 @@
+package accesstoken
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"pm4devs.strawhats/internal/models/accesstokens"
+	"pm4devs.strawhats/internal/models/secrets"
+	"pm4devs.strawhats/internal/rest"
+	"pm4devs.strawhats/internal/routes/middleware"
+	"pm4devs.strawhats/internal/validator"
+	"pm4devs.strawhats/internal/xerrors"
+)
+
+// Longest name of an access token
+const maxNameLength = 100
+
+// ============================================================================
+// GET
+// ============================================================================
+
+// Lists the access tokens of a user or of one of their service accounts,
+// without their plaintext
+func (app *AccessToken) list(w http.ResponseWriter, r *http.Request) {
+	var serviceAccountID int64
+	if param := r.URL.Query().Get("service_account_id"); param != "" {
+		id, err := strconv.ParseInt(param, 10, 64)
+		v := validator.New()
+		v.Check(err == nil && id > 0, "service_account_id", "must be a positive integer")
+		if err := v.Valid("accesstoken.list"); err != nil {
+			app.rest.Error(w, err)
+			return
+		}
+		serviceAccountID = id
+	}
+
+	userID, err := app.holder(r, serviceAccountID, "accesstoken.list")
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	accessTokens, err := app.accessTokens.GetByUserID(userID)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	app.rest.WriteJSON(w, "accesstoken.list", http.StatusOK, rest.Envelope{
+		"message": "Success!",
+		"data":    accessTokens,
+	})
+}
+
+// ============================================================================
+// POST
+// ============================================================================
+
+// Creates an access token carrying the given scopes, optionally restricted to
+// some secrets or groups of the user. The plaintext is only returned once.
+//
+// With a service account, the token is its credentials and restrictions are
+// checked against what the service account can reach.
+func (app *AccessToken) create(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		ServiceAccountID int64      `json:"service_account_id"`
+		Name             string     `json:"name"`
+		Scopes           []string   `json:"scopes"`
+		SecretIDs        *[]int64   `json:"secret_ids"`
+		GroupIDs         *[]int64   `json:"group_ids"`
+		ExpiresAt        *time.Time `json:"expires_at"`
+	}
+
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, "accesstoken.create", &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	// Validate parameters
+	v := validator.New()
+	v.Check(len(input.Name) > 0, "name", "must be provided")
+	v.Check(len(input.Name) <= maxNameLength, "name", "must not be more than 100 bytes long")
+	v.Check(len(input.Scopes) > 0, "scopes", "must be provided")
+	for _, scope := range input.Scopes {
+		v.Check(accesstokens.ValidScope(scope), "scopes",
+			"must be among secrets:read, secrets:write, groups:manage and scim:provision")
+	}
+	if input.SecretIDs != nil {
+		v.Check(len(*input.SecretIDs) > 0, "secret_ids", "must not be empty")
+	}
+	if input.GroupIDs != nil {
+		v.Check(len(*input.GroupIDs) > 0, "group_ids", "must not be empty")
+	}
+	v.Check(input.ExpiresAt == nil || input.ExpiresAt.After(time.Now()), "expires_at", "must be in the future")
+	if err := v.Valid("accesstoken.create"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	userID, err := app.holder(r, input.ServiceAccountID, "accesstoken.create")
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	// Tokens can only be restricted to what the user can reach
+	v = validator.New()
+	if input.SecretIDs != nil {
+		for _, secretID := range *input.SecretIDs {
+			// Missing secrets are reported with a bare 404
+			permission, err := app.secrets.GetUserSecretPermission(userID, secretID)
+			if err != nil && err.StatusCode != http.StatusNotFound {
+				app.rest.Error(w, err)
+				return
+			}
+			v.Check(err == nil && permission != secrets.NOTALLOWED, "secret_ids", "must be secrets you have access to")
+		}
+	}
+	if input.GroupIDs != nil {
+		for _, groupID := range *input.GroupIDs {
+			member, err := app.group.IsUserInGroup(groupID, userID)
+			if err != nil {
+				app.rest.Error(w, err)
+				return
+			}
+			v.Check(member, "group_ids", "must be groups you are a member of")
+		}
+	}
+	if err := v.Valid("accesstoken.create"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	slices.Sort(input.Scopes)
+	accessToken, err := app.accessTokens.New(userID, input.Name, slices.Compact(input.Scopes), input.ExpiresAt)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	if input.SecretIDs != nil {
+		accessToken.SecretIDs = *input.SecretIDs
+	}
+	if input.GroupIDs != nil {
+		accessToken.GroupIDs = *input.GroupIDs
+	}
+	if err := app.accessTokens.Insert(accessToken); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	app.rest.WriteJSON(w, "accesstoken.create", http.StatusCreated, rest.Envelope{
+		"message": "Success! Copy the token now, it won't be shown again.",
+		"data":    accessToken,
+	})
+}
+
+// ============================================================================
+// DELETE
+// ============================================================================
+
+// Revokes an access token of a user or of one of their service accounts
+func (app *AccessToken) revoke(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		ID               int64 `json:"id"`
+		ServiceAccountID int64 `json:"service_account_id"`
+	}
+
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, "accesstoken.revoke", &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	// Validate parameters
+	v := validator.New()
+	v.Check(input.ID > 0, "id", "must be provided")
+	if err := v.Valid("accesstoken.revoke"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	userID, err := app.holder(r, input.ServiceAccountID, "accesstoken.revoke")
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	if err := app.accessTokens.Delete(input.ID, userID); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	app.rest.WriteJSON(w, "accesstoken.revoke", http.StatusOK, rest.Envelope{
+		"message": "Success! The access token is revoked.",
+	})
+}
+
+// ============================================================================
+// Helpers
+// ============================================================================
+
+// Returns the ID of the user holding the tokens, the caller or, given its ID,
+// a service account of a group the caller created
+func (app *AccessToken) holder(r *http.Request, serviceAccountID int64, op string) (int64, *xerrors.AppError) {
+	user := middleware.ContextGetUser(r)
+	if serviceAccountID == 0 {
+		return user.ID, nil
+	}
+
+	account, err := app.users.GetServiceAccount(serviceAccountID)
+	if err != nil {
+		return 0, err
+	}
+	owner, err := app.group.GetByGroupID(account.GroupID)
+	if err != nil {
+		return 0, err
+	}
+	if err := xerrors.ClientUnauthorized(owner.CreatorID != user.ID, op); err != nil {
+		err.Data = "Only the owner of its group can manage the access tokens of a service account"
+		return 0, err
+	}
+
+	return account.ID, nil
+}
@@ -0,0 +1,128 @@
+package accesstoken
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"pm4devs.strawhats/internal/assert"
+	"pm4devs.strawhats/internal/mocks"
+	"pm4devs.strawhats/internal/models/users"
+	"pm4devs.strawhats/internal/routes/accesstoken"
+	"pm4devs.strawhats/internal/routes/auth"
+	"pm4devs.strawhats/internal/routes/group"
+	"pm4devs.strawhats/internal/routes/secret"
+	"pm4devs.strawhats/internal/routes/utils"
+)
+
+// Helper created service account type
+type createdAccount struct {
+	Data users.ServiceAccount `json:"data"`
+}
+
+// Helper service accounts type
+type accounts struct {
+	Data []users.ServiceAccount `json:"data"`
+}
+
+func TestServiceAccounts(t *testing.T) {
+	assert.Integration(t)
+	app := mocks.App(t)
+	handler := accessTokensHandler(app)
+	authHandler := utils.AuthHandler(app)
+
+	credentials := `{"email": "test@example.com", "password": "password"}`
+	assert.Check(t, utils.RegisterUser(authHandler, credentials))
+	session := utils.LoginUser(authHandler, credentials)
+	otherCredentials := `{"email": "other@example.com", "password": "password"}`
+	assert.Check(t, utils.RegisterUser(authHandler, otherCredentials))
+	other := utils.LoginUser(authHandler, otherCredentials)
+
+	// A group owning the service account, and a secret to share with it
+	use(t, handler, "Seed/Group", "POST", group.CRUDGroupRoute, session, `{"group_name": "pipelines"}`,
+		http.StatusCreated)
+	var secretID int64
+	type createdSecret struct {
+		SecretID int64 `json:"secret_id"`
+	}
+	assert.RunHandlerTestCase(t, handler, "POST", secret.SecretCRUDRoute, assert.HandlerTestCase[createdSecret]{
+		Name:   "Seed/Secret",
+		Auth:   session,
+		Body:   `{"name": "deploy-key", "encrypted_data": "data", "iv": "iv"}`,
+		Status: http.StatusCreated,
+		FN: func(t *testing.T, result createdSecret) {
+			secretID = result.SecretID
+		},
+	})
+
+	// Create
+	use(t, handler, "Create/AuthRequired", "POST", group.ServiceAccountsRoute, "", `{}`, http.StatusUnauthorized)
+	assert.RunHandlerTestCase(t, handler, "POST", group.ServiceAccountsRoute, assert.HandlerTestCase[failures]{
+		Name:   "Create/Validation",
+		Auth:   session,
+		Body:   `{"name": "CI pipeline"}`,
+		Status: http.StatusUnprocessableEntity,
+		FN: func(t *testing.T, result failures) {
+			assert.Equal(t, result.Error["group_name"], "must be provided")
+			assert.Equal(t, result.Error["name"],
+				"must be 3 to 64 lowercase letters, digits or hyphens, not starting or ending with a hyphen")
+		},
+	})
+	body := `{"group_name": "pipelines", "name": "ci-deploy"}`
+	use(t, handler, "Create/NotOwner", "POST", group.ServiceAccountsRoute, other, body, http.StatusUnauthorized)
+	var account users.ServiceAccount
+	assert.RunHandlerTestCase(t, handler, "POST", group.ServiceAccountsRoute, assert.HandlerTestCase[createdAccount]{
+		Name:   "Create/Success",
+		Auth:   session,
+		Body:   body,
+		Status: http.StatusCreated,
+		FN: func(t *testing.T, result createdAccount) {
+			assert.Equal(t, result.Data.Email, users.ServiceAccountEmail("ci-deploy", result.Data.GroupID))
+			account = result.Data
+		},
+	})
+	use(t, handler, "Create/Duplicate", "POST", group.ServiceAccountsRoute, session, body, http.StatusConflict)
+
+	// Listed to the members of the group
+	listed := group.ServiceAccountsRoute + "?group_name=pipelines"
+	assert.RunHandlerTestCase(t, handler, "GET", listed, assert.HandlerTestCase[accounts]{
+		Name:   "List",
+		Auth:   session,
+		Status: http.StatusOK,
+		FN: func(t *testing.T, result accounts) {
+			assert.Equal(t, len(result.Data), 1)
+		},
+	})
+	use(t, handler, "List/NotMember", "GET", listed, other, "", http.StatusUnauthorized)
+
+	// Never logs in, nor registers
+	login := fmt.Sprintf(`{"email": %q, "password": "password"}`, account.Email)
+	use(t, authHandler, "Login", "POST", auth.LoginRoute, "", login, http.StatusUnauthorized)
+	use(t, authHandler, "Register", "POST", auth.RegisterRoute, "", login, http.StatusUnprocessableEntity)
+
+	// Secrets are shared to it like to any user, and read with its own tokens
+	use(t, handler, "Share", "POST", secret.SecretShareUserRoute, session, fmt.Sprintf(
+		`{"secret_id": %d, "user_email": %q, "permission": "read-only"}`, secretID, account.Email),
+		http.StatusCreated)
+	create := fmt.Sprintf(`{"service_account_id": %d, "name": "ci", "scopes": ["secrets:read"]}`, account.ID)
+	use(t, handler, "Token/NotOwner", "POST", accesstoken.TokensRoute, other, create, http.StatusUnauthorized)
+	token := createToken(t, handler, "Token/Create", session, create)
+	get := fmt.Sprintf(`{"secret_id": %d}`, secretID)
+	use(t, handler, "Token/Get", "GET", secret.SecretCRUDRoute, token.Plaintext, get, http.StatusOK)
+	assert.RunHandlerTestCase(t, handler, "GET", fmt.Sprintf("%s?service_account_id=%d", accesstoken.TokensRoute,
+		account.ID), assert.HandlerTestCase[list]{
+		Name:   "Token/List",
+		Auth:   session,
+		Status: http.StatusOK,
+		FN: func(t *testing.T, result list) {
+			assert.Equal(t, len(result.Data), 1)
+		},
+	})
+
+	// Deleting it revokes its tokens
+	remove := fmt.Sprintf(`{"id": %d}`, account.ID)
+	use(t, handler, "Delete/NotOwner", "DELETE", group.ServiceAccountsRoute, other, remove, http.StatusUnauthorized)
+	use(t, handler, "Delete/Success", "DELETE", group.ServiceAccountsRoute, session, remove, http.StatusOK)
+	use(t, handler, "Delete/NotFound", "DELETE", group.ServiceAccountsRoute, session, remove, http.StatusNotFound)
+	use(t, handler, "Delete/Revoked", "GET", secret.SecretCRUDRoute, token.Plaintext, get, http.StatusUnauthorized)
+}
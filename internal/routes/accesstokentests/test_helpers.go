@@ -0,0 +1,51 @@
+package accesstoken
+
+import (
+	"net/http"
+
+	"pm4devs.strawhats/internal/app"
+	"pm4devs.strawhats/internal/routes/accesstoken"
+	"pm4devs.strawhats/internal/routes/group"
+	"pm4devs.strawhats/internal/routes/keys"
+	"pm4devs.strawhats/internal/routes/middleware"
+	"pm4devs.strawhats/internal/routes/secret"
+)
+
+// ============================================================================
+// Helpers
+// ============================================================================
+
+// Creates a complete Access Tokens handler including middleware. The secrets,
+// group and keys routes are included to use the tokens on.
+func accessTokensHandler(app *app.App) http.HandlerFunc {
+	handler := func() http.Handler {
+		mux := http.NewServeMux()
+
+		middleware := middleware.New(app)
+		accesstoken.New(app).Route(mux, middleware)
+		secret.New(app).Route(mux, middleware)
+		group.New(app).Route(mux, middleware)
+		keys.New(app).Route(mux, middleware)
+
+		return middleware.User(mux)
+	}()
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r)
+	}
+}
+
+// Helper failure type
+type failure struct {
+	Error string `json:"error"`
+}
+
+// Helper failures type
+type failures struct {
+	Error map[string]string `json:"error"`
+}
+
+// Helper success type
+type message struct {
+	Message string `json:"message"`
+}
@@ -0,0 +1,206 @@
+package accesstoken
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"pm4devs.strawhats/internal/assert"
+	"pm4devs.strawhats/internal/mocks"
+	"pm4devs.strawhats/internal/models/accesstokens"
+	"pm4devs.strawhats/internal/routes/accesstoken"
+	"pm4devs.strawhats/internal/routes/group"
+	"pm4devs.strawhats/internal/routes/secret"
+	"pm4devs.strawhats/internal/routes/utils"
+)
+
+// Helper created access token type
+type created struct {
+	Data accesstokens.AccessToken `json:"data"`
+}
+
+// Helper access tokens type
+type list struct {
+	Data []accesstokens.AccessToken `json:"data"`
+}
+
+// Helper listing type
+type listing struct {
+	Data []map[string]any `json:"data"`
+}
+
+// Creates an access token with a session, returning it
+func createToken(t *testing.T, handler http.HandlerFunc, name, session, body string) accesstokens.AccessToken {
+	t.Helper()
+	var token accesstokens.AccessToken
+	assert.RunHandlerTestCase(t, handler, "POST", accesstoken.TokensRoute, assert.HandlerTestCase[created]{
+		Name:   name,
+		Auth:   session,
+		Body:   body,
+		Status: http.StatusCreated,
+		FN: func(t *testing.T, result created) {
+			assert.Check(t, strings.HasPrefix(result.Data.Plaintext, accesstokens.Prefix))
+			token = result.Data
+		},
+	})
+	return token
+}
+
+// Sends a request with an access token, expecting the given status
+func use(t *testing.T, handler http.HandlerFunc, name, method, route, token, body string, status int) {
+	t.Helper()
+	assert.RunHandlerTestCase(t, handler, method, route, assert.HandlerTestCase[failure]{
+		Name:   name,
+		Auth:   token,
+		Body:   body,
+		Status: status,
+	})
+}
+
+func TestAccessTokens(t *testing.T) {
+	assert.Integration(t)
+	app := mocks.App(t)
+	handler := accessTokensHandler(app)
+	authHandler := utils.AuthHandler(app)
+
+	credentials := `{"email": "test@example.com", "password": "password"}`
+	assert.Check(t, utils.RegisterUser(authHandler, credentials))
+	session := utils.LoginUser(authHandler, credentials)
+	assert.Check(t, len(session) > 0)
+
+	// Secrets and a group to restrict tokens to
+	var secretIDs []int64
+	for _, name := range []string{"deploy-key", "database"} {
+		type createdSecret struct {
+			SecretID int64 `json:"secret_id"`
+		}
+		assert.RunHandlerTestCase(t, handler, "POST", secret.SecretCRUDRoute, assert.HandlerTestCase[createdSecret]{
+			Name:   "Seed/Secret",
+			Auth:   session,
+			Body:   fmt.Sprintf(`{"name": %q, "encrypted_data": "data", "iv": "iv"}`, name),
+			Status: http.StatusCreated,
+			FN: func(t *testing.T, result createdSecret) {
+				secretIDs = append(secretIDs, result.SecretID)
+			},
+		})
+	}
+	var groupID int64
+	type createdGroup struct {
+		Data struct {
+			ID int64 `json:"id"`
+		} `json:"data"`
+	}
+	assert.RunHandlerTestCase(t, handler, "POST", group.CRUDGroupRoute, assert.HandlerTestCase[createdGroup]{
+		Name:   "Seed/Group",
+		Auth:   session,
+		Body:   `{"group_name": "backend"}`,
+		Status: http.StatusCreated,
+		FN: func(t *testing.T, result createdGroup) {
+			groupID = result.Data.ID
+		},
+	})
+
+	// Create
+	use(t, handler, "Create/AuthRequired", "POST", accesstoken.TokensRoute, "", `{}`, http.StatusUnauthorized)
+	assert.RunHandlerTestCase(t, handler, "POST", accesstoken.TokensRoute, assert.HandlerTestCase[failures]{
+		Name:   "Create/Validation",
+		Auth:   session,
+		Body:   `{"scopes": ["secrets:admin"], "group_ids": [], "expires_at": "2000-01-01T00:00:00Z"}`,
+		Status: http.StatusUnprocessableEntity,
+		FN: func(t *testing.T, result failures) {
+			assert.Equal(t, result.Error["name"], "must be provided")
+			assert.Equal(t, result.Error["scopes"], "must be among secrets:read, secrets:write, groups:manage and scim:provision")
+			assert.Equal(t, result.Error["group_ids"], "must not be empty")
+			assert.Equal(t, result.Error["expires_at"], "must be in the future")
+		},
+	})
+	assert.RunHandlerTestCase(t, handler, "POST", accesstoken.TokensRoute, assert.HandlerTestCase[failures]{
+		Name:   "Create/Unreachable",
+		Auth:   session,
+		Body:   `{"name": "ci", "scopes": ["secrets:read"], "secret_ids": [999999], "group_ids": [999999]}`,
+		Status: http.StatusUnprocessableEntity,
+		FN: func(t *testing.T, result failures) {
+			assert.Equal(t, result.Error["secret_ids"], "must be secrets you have access to")
+			assert.Equal(t, result.Error["group_ids"], "must be groups you are a member of")
+		},
+	})
+
+	// A read-only token reads every secret, and nothing else
+	read := createToken(t, handler, "Create/Read", session, `{"name": "backup", "scopes": ["secrets:read"]}`)
+	assert.RunHandlerTestCase(t, handler, "GET", secret.GetUserSecretsRoute, assert.HandlerTestCase[listing]{
+		Name:   "Read/List",
+		Auth:   read.Plaintext,
+		Status: http.StatusOK,
+		FN: func(t *testing.T, result listing) {
+			assert.Equal(t, len(result.Data), 2)
+		},
+	})
+	get := fmt.Sprintf(`{"secret_id": %d}`, secretIDs[1])
+	use(t, handler, "Read/Get", "GET", secret.SecretCRUDRoute, read.Plaintext, get, http.StatusOK)
+	use(t, handler, "Read/Create", "POST", secret.SecretCRUDRoute, read.Plaintext,
+		`{"name": "new", "encrypted_data": "data", "iv": "iv"}`, http.StatusForbidden)
+	use(t, handler, "Read/Groups", "GET", group.ListUserGroupRoute, read.Plaintext, "", http.StatusForbidden)
+	use(t, handler, "Read/Tokens", "GET", accesstoken.TokensRoute, read.Plaintext, "", http.StatusForbidden)
+	use(t, handler, "Read/Invalid", "GET", secret.GetUserSecretsRoute, accesstokens.Prefix+"invalid", "",
+		http.StatusUnauthorized)
+
+	// A restricted token only reaches its secrets
+	deploy := createToken(t, handler, "Create/Restricted", session, fmt.Sprintf(
+		`{"name": "deploy", "scopes": ["secrets:read", "secrets:write"], "secret_ids": [%d]}`, secretIDs[0]))
+	assert.RunHandlerTestCase(t, handler, "GET", secret.GetUserSecretsRoute, assert.HandlerTestCase[listing]{
+		Name:   "Restricted/List",
+		Auth:   deploy.Plaintext,
+		Status: http.StatusOK,
+		FN: func(t *testing.T, result listing) {
+			assert.Equal(t, len(result.Data), 1)
+		},
+	})
+	use(t, handler, "Restricted/Get", "GET", secret.SecretCRUDRoute, deploy.Plaintext,
+		fmt.Sprintf(`{"secret_id": %d}`, secretIDs[0]), http.StatusOK)
+	use(t, handler, "Restricted/Update", "PATCH", secret.SecretCRUDRoute, deploy.Plaintext,
+		fmt.Sprintf(`{"secret_id": %d, "name": "deploy-key", "encrypted_data": "new", "iv": "iv"}`, secretIDs[0]),
+		http.StatusOK)
+	use(t, handler, "Restricted/OtherSecret", "GET", secret.SecretCRUDRoute, deploy.Plaintext, get,
+		http.StatusForbidden)
+	use(t, handler, "Restricted/Create", "POST", secret.SecretCRUDRoute, deploy.Plaintext,
+		`{"name": "new", "encrypted_data": "data", "iv": "iv"}`, http.StatusForbidden)
+
+	// Group tokens manage their groups
+	groups := createToken(t, handler, "Create/Groups", session, fmt.Sprintf(
+		`{"name": "provisioning", "scopes": ["groups:manage"], "group_ids": [%d]}`, groupID))
+	use(t, handler, "Groups/Get", "GET", group.CRUDGroupRoute, groups.Plaintext, `{"group_name": "backend"}`,
+		http.StatusOK)
+	use(t, handler, "Groups/Create", "POST", group.CRUDGroupRoute, groups.Plaintext, `{"group_name": "frontend"}`,
+		http.StatusForbidden)
+	use(t, handler, "Groups/Secrets", "GET", secret.SecretCRUDRoute, groups.Plaintext, get, http.StatusForbidden)
+
+	// Listed without their plaintext, along with their last use
+	assert.RunHandlerTestCase(t, handler, "GET", accesstoken.TokensRoute, assert.HandlerTestCase[list]{
+		Name:   "List",
+		Auth:   session,
+		Status: http.StatusOK,
+		FN: func(t *testing.T, result list) {
+			assert.Equal(t, len(result.Data), 3)
+			for _, token := range result.Data {
+				assert.Equal(t, token.Plaintext, "")
+				assert.Check(t, token.LastUsedAt != nil)
+			}
+			assert.Equal(t, fmt.Sprint(result.Data[1].Scopes), "[secrets:read secrets:write]")
+			assert.Equal(t, fmt.Sprint(result.Data[1].SecretIDs), fmt.Sprint(secretIDs[:1]))
+		},
+	})
+
+	// Revoke
+	revoke := fmt.Sprintf(`{"id": %d}`, read.ID)
+	use(t, handler, "Revoke/WithToken", "DELETE", accesstoken.TokensRoute, deploy.Plaintext, revoke,
+		http.StatusForbidden)
+	assert.RunHandlerTestCase(t, handler, "DELETE", accesstoken.TokensRoute, assert.HandlerTestCase[message]{
+		Name:   "Revoke/Success",
+		Auth:   session,
+		Body:   revoke,
+		Status: http.StatusOK,
+	})
+	use(t, handler, "Revoke/NotFound", "DELETE", accesstoken.TokensRoute, session, revoke, http.StatusNotFound)
+	use(t, handler, "Revoke/Revoked", "GET", secret.GetUserSecretsRoute, read.Plaintext, "", http.StatusUnauthorized)
+}
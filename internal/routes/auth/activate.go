@@ -24,18 +24,22 @@ func (app *Auth) activatePut(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get user
-	user, err := app.users.GetByToken(input.Token)
+	user, err := app.users.GetByToken(input.Token, tokens.ScopeActivation)
 	if err != nil {
 		app.rest.Error(w, err)
 		return
 	}
 
-	// Activate user
+	// Activate user, who proved they own their email
 	user.Activated = true
 	if err := app.users.Update(user); err != nil {
 		app.rest.Error(w, err)
 		return
 	}
+	if err := app.users.VerifyEmail(user.ID); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
 
 	// Delete activation token
 	if _, err := app.tokens.Delete(input.Token, tokens.ScopeActivation); err != nil {
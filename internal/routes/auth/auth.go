@@ -2,13 +2,20 @@ package auth
 
 import (
 	"net/http"
+	"time"
 
 	"pm4devs.strawhats/internal/app"
 	"pm4devs.strawhats/internal/mailer"
+	"pm4devs.strawhats/internal/models/passkeys"
+	"pm4devs.strawhats/internal/models/permissions"
+	"pm4devs.strawhats/internal/models/sso"
 	"pm4devs.strawhats/internal/models/tokens"
+	"pm4devs.strawhats/internal/models/twofactor"
 	"pm4devs.strawhats/internal/models/users"
+	"pm4devs.strawhats/internal/oidc"
 	"pm4devs.strawhats/internal/rest"
 	"pm4devs.strawhats/internal/routes/middleware"
+	"pm4devs.strawhats/internal/webauthn"
 	"pm4devs.strawhats/internal/xlogger"
 )
 
@@ -18,22 +25,63 @@ import (
 
 // Encapsulates the Application dependencies required by routes
 type Auth struct {
-	bg     app.Backgrounder
-	logger xlogger.Logger
-	mailer mailer.Mailer
-	rest   *rest.Rest
-	tokens tokens.TokensRepository
-	users  users.UsersRepository
+	accessTTL       time.Duration
+	refreshTTL      time.Duration
+	bg              app.Backgrounder
+	verificationURL string // Page users approve the login of a device on
+	groupsClaim     string
+	logger          xlogger.Logger
+	mailer          mailer.Mailer
+	passkeys        passkeys.PasskeysRepository
+	passwordLogin   bool
+	provider        *oidc.Provider // Nil without single sign-on
+	rest            *rest.Rest
+	rp              *webauthn.RelyingParty
+	secret          []byte // Server secret the parameters of unknown emails are derived from
+	sso             sso.SSORepository
+	tokens          tokens.TokensRepository
+	twofactor       twofactor.TwoFactorRepository
+	users           users.UsersRepository
 }
 
 func New(app *app.App) *Auth {
+	// Passkeys and security keys are scoped to the configured relying party
+	rp := &webauthn.RelyingParty{
+		ID:      app.Config.WebAuthn.RPID,
+		Name:    app.Config.WebAuthn.RPName,
+		Origins: app.Config.WebAuthn.Origins,
+	}
+
+	// Users sign in with the configured OpenID Connect provider, if any
+	var provider *oidc.Provider
+	if app.Config.SSOEnabled() {
+		provider = &oidc.Provider{
+			Issuer:       app.Config.OIDC.Issuer,
+			ClientID:     app.Config.OIDC.ClientID,
+			ClientSecret: app.Config.OIDC.ClientSecret,
+			RedirectURL:  app.Config.OIDC.RedirectURL,
+			Scopes:       app.Config.OIDC.Scopes,
+		}
+	}
+
 	return &Auth{
-		bg:     app.BG,
-		logger: app.Logger,
-		mailer: app.Mailer,
-		rest:   app.Rest,
-		tokens: app.Models.Tokens,
-		users:  app.Models.Users,
+		accessTTL:       app.Config.Tokens.AccessTTL,
+		refreshTTL:      app.Config.Tokens.RefreshTTL,
+		bg:              app.BG,
+		verificationURL: app.Config.Device.VerificationURL,
+		groupsClaim:     app.Config.OIDC.GroupsClaim,
+		logger:          app.Logger,
+		mailer:          app.Mailer,
+		passkeys:        app.Models.Passkeys,
+		passwordLogin:   app.Config.PasswordLogin,
+		provider:        provider,
+		rest:            app.Rest,
+		rp:              rp,
+		secret:          app.Config.SecretKey(),
+		sso:             app.Models.SSO,
+		tokens:          app.Models.Tokens,
+		twofactor:       app.Models.TwoFactor,
+		users:           app.Models.Users,
 	}
 }
 
@@ -46,13 +94,49 @@ func (auth *Auth) Route(mux *http.ServeMux, mw *middleware.Middleware) {
 
 	mux.HandleFunc(DeleteRoute, mw.Authenticated(auth.Delete))
 
+	mux.HandleFunc(DeviceRoute, auth.Device)
+
+	mux.HandleFunc(DeviceApprovalRoute, mw.Authenticated(auth.DeviceApproval))
+
+	mux.HandleFunc(DeviceTokenRoute, auth.DeviceToken)
+
+	mux.HandleFunc(KDFRoute, mw.Authenticated(auth.KDF))
+
 	mux.HandleFunc(LoginRoute, auth.Login)
 
 	mux.HandleFunc(LogoutRoute, mw.Authenticated(auth.Logout))
 
+	mux.HandleFunc(PreloginRoute, auth.Prelogin)
+
+	mux.HandleFunc(RefreshRoute, auth.Refresh)
+
 	mux.HandleFunc(RegisterRoute, auth.Register)
 
 	mux.HandleFunc(ResetRoute, auth.Reset)
+
+	mux.HandleFunc(SessionsRoute, mw.Authenticated(auth.Sessions))
+
+	mux.HandleFunc(SessionsOthersRoute, mw.Authenticated(auth.SessionsOthers))
+
+	mux.HandleFunc(SessionsUserRoute, mw.RequirePermission(permissions.PermissionAdmin, auth.SessionsUser))
+
+	mux.HandleFunc(SSORoute, auth.SSO)
+
+	mux.HandleFunc(SSOGroupRoute, mw.RequirePermission(permissions.PermissionAdmin, auth.SSOGroup))
+
+	mux.HandleFunc(TwoFactorRoute, auth.TwoFactor)
+
+	mux.HandleFunc(TwoFactorGroupRoute, mw.RequirePermission(permissions.PermissionAdmin, auth.TwoFactorGroup))
+
+	mux.HandleFunc(TwoFactorLoginRoute, auth.TwoFactorLogin)
+
+	mux.HandleFunc(TwoFactorRecoveryRoute, mw.Authenticated(auth.TwoFactorRecovery))
+
+	mux.HandleFunc(WebAuthnCredentialsRoute, mw.Authenticated(auth.WebAuthnCredentials))
+
+	mux.HandleFunc(WebAuthnLoginRoute, auth.WebAuthnLogin)
+
+	mux.HandleFunc(WebAuthnRegisterRoute, auth.WebAuthnRegister)
 }
 
 // ============================================================================
@@ -90,6 +174,71 @@ func (app *Auth) Delete(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// ============================================================================
+// Device
+// ============================================================================
+
+const DeviceRoute = "/v1/auth/device"
+
+func (app *Auth) Device(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		http.ServeFile(w, r, "static/device.html")
+
+	case "POST":
+		app.devicePost(w, r)
+
+	default:
+		app.rest.MethodNotAllowed(w, r, "GET, POST")
+	}
+}
+
+const DeviceApprovalRoute = "/v1/auth/device/approval"
+
+func (app *Auth) DeviceApproval(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		app.deviceApprovalGet(w, r)
+
+	case "PUT":
+		app.deviceApprovalPut(w, r)
+
+	case "DELETE":
+		app.deviceApprovalDelete(w, r)
+
+	default:
+		app.rest.MethodNotAllowed(w, r, "GET, PUT, DELETE")
+	}
+}
+
+const DeviceTokenRoute = "/v1/auth/device/token"
+
+func (app *Auth) DeviceToken(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "POST":
+		app.deviceTokenPost(w, r)
+
+	default:
+		app.rest.MethodNotAllowed(w, r, "POST")
+	}
+}
+
+// ============================================================================
+// KDF
+// ============================================================================
+
+const KDFRoute = "/v1/auth/kdf"
+
+func (app *Auth) KDF(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "PUT":
+		app.kdfPut(w, r)
+
+	default:
+		app.rest.MethodNotAllowed(w, r, "PUT")
+	}
+}
+
 // ============================================================================
 // Login
 // ============================================================================
@@ -122,6 +271,38 @@ func (app *Auth) Logout(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// ============================================================================
+// Prelogin
+// ============================================================================
+
+const PreloginRoute = "/v1/auth/prelogin"
+
+func (app *Auth) Prelogin(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "POST":
+		app.preloginPost(w, r)
+
+	default:
+		app.rest.MethodNotAllowed(w, r, "POST")
+	}
+}
+
+// ============================================================================
+// Refresh
+// ============================================================================
+
+const RefreshRoute = "/v1/auth/refresh"
+
+func (app *Auth) Refresh(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "POST":
+		app.refreshPost(w, r)
+
+	default:
+		app.rest.MethodNotAllowed(w, r, "POST")
+	}
+}
+
 // ============================================================================
 // Register
 // ============================================================================
@@ -159,3 +340,190 @@ func (app *Auth) Reset(w http.ResponseWriter, r *http.Request) {
 		app.rest.MethodNotAllowed(w, r, "GET, POST, PUT")
 	}
 }
+
+// ============================================================================
+// Sessions
+// ============================================================================
+
+const SessionsRoute = "/v1/auth/sessions"
+
+func (app *Auth) Sessions(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		app.sessionsGet(w, r)
+
+	case "DELETE":
+		app.sessionsDelete(w, r)
+
+	default:
+		app.rest.MethodNotAllowed(w, r, "GET, DELETE")
+	}
+}
+
+const SessionsOthersRoute = "/v1/auth/sessions/others"
+
+func (app *Auth) SessionsOthers(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "DELETE":
+		app.sessionsOthersDelete(w, r)
+
+	default:
+		app.rest.MethodNotAllowed(w, r, "DELETE")
+	}
+}
+
+const SessionsUserRoute = "/v1/auth/sessions/users"
+
+func (app *Auth) SessionsUser(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "DELETE":
+		app.sessionsUserDelete(w, r)
+
+	default:
+		app.rest.MethodNotAllowed(w, r, "DELETE")
+	}
+}
+
+// ============================================================================
+// SSO
+// ============================================================================
+
+const SSORoute = "/v1/auth/sso"
+
+func (app *Auth) SSO(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		app.ssoGet(w, r)
+
+	case "POST":
+		app.ssoPost(w, r)
+
+	case "PUT":
+		app.ssoPut(w, r)
+
+	default:
+		app.rest.MethodNotAllowed(w, r, "GET, POST, PUT")
+	}
+}
+
+const SSOGroupRoute = "/v1/auth/sso/groups"
+
+func (app *Auth) SSOGroup(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "PUT":
+		app.ssoGroupPut(w, r)
+
+	default:
+		app.rest.MethodNotAllowed(w, r, "PUT")
+	}
+}
+
+// ============================================================================
+// Two-Factor
+// ============================================================================
+
+const TwoFactorRoute = "/v1/auth/2fa"
+
+func (app *Auth) TwoFactor(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		app.twoFactorGet(w, r)
+
+	case "POST":
+		app.twoFactorPost(w, r)
+
+	case "PUT":
+		app.twoFactorPut(w, r)
+
+	case "DELETE":
+		app.twoFactorDelete(w, r)
+
+	default:
+		app.rest.MethodNotAllowed(w, r, "GET, POST, PUT, DELETE")
+	}
+}
+
+const TwoFactorGroupRoute = "/v1/auth/2fa/groups"
+
+func (app *Auth) TwoFactorGroup(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "PUT":
+		app.twoFactorGroupPut(w, r)
+
+	default:
+		app.rest.MethodNotAllowed(w, r, "PUT")
+	}
+}
+
+const TwoFactorLoginRoute = "/v1/auth/2fa/login"
+
+func (app *Auth) TwoFactorLogin(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "POST":
+		app.twoFactorLoginPost(w, r)
+
+	default:
+		app.rest.MethodNotAllowed(w, r, "POST")
+	}
+}
+
+const TwoFactorRecoveryRoute = "/v1/auth/2fa/recovery-codes"
+
+func (app *Auth) TwoFactorRecovery(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "POST":
+		app.twoFactorRecoveryPost(w, r)
+
+	default:
+		app.rest.MethodNotAllowed(w, r, "POST")
+	}
+}
+
+// ============================================================================
+// WebAuthn
+// ============================================================================
+
+const WebAuthnCredentialsRoute = "/v1/auth/webauthn/credentials"
+
+func (app *Auth) WebAuthnCredentials(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		app.webAuthnCredentialsGet(w, r)
+
+	case "DELETE":
+		app.webAuthnCredentialsDelete(w, r)
+
+	default:
+		app.rest.MethodNotAllowed(w, r, "GET, DELETE")
+	}
+}
+
+const WebAuthnLoginRoute = "/v1/auth/webauthn/login"
+
+func (app *Auth) WebAuthnLogin(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "POST":
+		app.webAuthnLoginPost(w, r)
+
+	case "PUT":
+		app.webAuthnLoginPut(w, r)
+
+	default:
+		app.rest.MethodNotAllowed(w, r, "POST, PUT")
+	}
+}
+
+const WebAuthnRegisterRoute = "/v1/auth/webauthn/register"
+
+func (app *Auth) WebAuthnRegister(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "POST":
+		app.webAuthnRegisterPost(w, r)
+
+	case "PUT":
+		app.webAuthnRegisterPut(w, r)
+
+	default:
+		app.rest.MethodNotAllowed(w, r, "POST, PUT")
+	}
+}
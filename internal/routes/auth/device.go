@@ -0,0 +1,172 @@
+package auth
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"pm4devs.strawhats/internal/rest"
+	"pm4devs.strawhats/internal/routes/middleware"
+	"pm4devs.strawhats/internal/validator"
+)
+
+// ============================================================================
+// Constants
+// ============================================================================
+
+const (
+	// How long users have to approve the login of a device
+	deviceTTL = 10 * time.Minute
+
+	// How long devices wait between polls for their tokens
+	devicePollInterval = 5 * time.Second
+)
+
+// ============================================================================
+// GET
+// ============================================================================
+
+// Shows the device waiting for approval with a user code, for the user to
+// check it is theirs
+func (app *Auth) deviceApprovalGet(w http.ResponseWriter, r *http.Request) {
+	userCode := r.URL.Query().Get("user_code")
+
+	// Validate parameters
+	v := validator.New()
+	v.Check(len(userCode) > 0, "user_code", "must be provided")
+	if err := v.Valid("auth.deviceApprovalGet"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	client, err := app.tokens.GetDeviceClient(userCode)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	app.rest.WriteJSON(w, "auth.deviceApprovalGet", http.StatusOK, rest.Envelope{
+		"message": "Success!",
+		"data":    client,
+	})
+}
+
+// ============================================================================
+// POST
+// ============================================================================
+
+// Starts the login of a device without a browser, like a terminal, returning
+// the code the user approves it with on the verification page and the code
+// the device polls for its tokens with (RFC 8628)
+func (app *Auth) devicePost(w http.ResponseWriter, r *http.Request) {
+	authorization, err := app.tokens.NewDeviceAuthorization(middleware.Client(r), deviceTTL, devicePollInterval)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	// The complete URI fills in the user code, to be shown as a QR code
+	complete := app.verificationURL + "?" + url.Values{"user_code": {authorization.UserCode}}.Encode()
+
+	app.rest.WriteJSON(w, "auth.devicePost", http.StatusOK, rest.Envelope{
+		"device_code":               authorization.DeviceCode,
+		"user_code":                 authorization.UserCode,
+		"verification_uri":          app.verificationURL,
+		"verification_uri_complete": complete,
+		"expires_in":                int64(deviceTTL.Seconds()),
+		"interval":                  int64(devicePollInterval.Seconds()),
+	})
+}
+
+// Polls for the tokens of a device, returning an access and refresh token like
+// the login once the user approved it
+//
+// Until then, the error is authorization_pending, or slow_down if the device
+// polls more often than its interval. Denied devices get access_denied and
+// expired ones expired_token.
+func (app *Auth) deviceTokenPost(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		DeviceCode string `json:"device_code"`
+	}
+
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, "auth.deviceTokenPost", &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	// Validate parameters
+	v := validator.New()
+	v.Check(len(input.DeviceCode) > 0, "device_code", "must be provided")
+	if err := v.Valid("auth.deviceTokenPost"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	pair, err := app.tokens.PollDevice(input.DeviceCode, app.accessTTL, app.refreshTTL)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	// Send response
+	app.rest.WriteJSON(w, "auth.deviceTokenPost", http.StatusOK, tokenResponse(pair, app.accessTTL))
+}
+
+// ============================================================================
+// PUT
+// ============================================================================
+
+// Approves the device waiting with a user code, which logs in as the
+// authenticated user at its next poll
+func (app *Auth) deviceApprovalPut(w http.ResponseWriter, r *http.Request) {
+	app.decideDevice(w, r, true, "auth.deviceApprovalPut")
+}
+
+// ============================================================================
+// DELETE
+// ============================================================================
+
+// Denies the device waiting with a user code
+func (app *Auth) deviceApprovalDelete(w http.ResponseWriter, r *http.Request) {
+	app.decideDevice(w, r, false, "auth.deviceApprovalDelete")
+}
+
+// ============================================================================
+// Helpers
+// ============================================================================
+
+// Approves or denies the device waiting with the user code of a request
+func (app *Auth) decideDevice(w http.ResponseWriter, r *http.Request, approve bool, op string) {
+	var input struct {
+		UserCode string `json:"user_code"`
+	}
+
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, op, &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	// Validate parameters
+	v := validator.New()
+	v.Check(len(input.UserCode) > 0, "user_code", "must be provided")
+	if err := v.Valid(op); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	user := middleware.ContextGetUser(r)
+	if err := app.tokens.DecideDevice(input.UserCode, user.ID, approve); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	message := "Success! The device is denied"
+	if approve {
+		message = "Success! The device is approved"
+	}
+	app.rest.WriteJSON(w, op, http.StatusOK, rest.Envelope{
+		"message": message,
+	})
+}
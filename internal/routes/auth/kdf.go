@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"net/http"
+
+	"pm4devs.strawhats/internal/models/users"
+	"pm4devs.strawhats/internal/rest"
+	"pm4devs.strawhats/internal/routes/middleware"
+	"pm4devs.strawhats/internal/validator"
+	"pm4devs.strawhats/internal/xerrors"
+)
+
+// ============================================================================
+// PUT
+// ============================================================================
+
+// Replaces the KDF parameters of an authenticated user
+//
+// Users must also provide their password to confirm the change, as the keys
+// derived by their clients change with it.
+func (app *Auth) kdfPut(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Password string     `json:"password"`
+		KDF      *users.KDF `json:"kdf"`
+	}
+
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, "auth.kdfPut", &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	// Validate parameters
+	v := validator.New()
+	v.Check(len(input.Password) > 0, "password", "must be provided")
+	v.Check(input.KDF != nil, "kdf", "must be provided")
+	if input.KDF != nil {
+		users.ValidateKDF(v, input.KDF, "kdf")
+	}
+	if err := v.Valid("auth.kdfPut"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	// Compare passwords
+	user := middleware.ContextGetUser(r)
+	// The context only carries the ID and email of the user
+	account, err := app.users.GetByID(user.ID)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	passwordIsCorrect, err := account.PasswordMatches(input.Password)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	err = xerrors.ClientUnauthorized(!passwordIsCorrect, "auth.kdfPut.Password")
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	// Store parameters
+	if err := app.users.SetKDF(user.ID, input.KDF); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	// Send response
+	app.rest.WriteJSON(w, "auth.kdfPut", http.StatusOK, rest.Envelope{"kdf": input.KDF})
+}
@@ -5,7 +5,9 @@ import (
 	"time"
 
 	"pm4devs.strawhats/internal/models/tokens"
+	"pm4devs.strawhats/internal/models/twofactor"
 	"pm4devs.strawhats/internal/rest"
+	"pm4devs.strawhats/internal/routes/middleware"
 	"pm4devs.strawhats/internal/validator"
 	"pm4devs.strawhats/internal/xerrors"
 )
@@ -21,6 +23,11 @@ func (app *Auth) loginPost(w http.ResponseWriter, r *http.Request) {
 		Password string `json:"password"`
 	}
 
+	if err := app.requirePasswordLogin("auth.loginPost"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
 	// Parse request
 	if err := app.rest.ReadJSON(w, r, "auth.loginPost", &input); err != nil {
 		app.rest.Error(w, err)
@@ -47,6 +54,18 @@ func (app *Auth) loginPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Service accounts never log in, they use access tokens
+	if user.IsServiceAccount() {
+		clientError := xerrors.ClientError(
+			http.StatusUnauthorized,
+			"The provided credentials are invalid",
+			"auth.loginPost",
+			xerrors.ErrUnauthenticated,
+		)
+		app.rest.Error(w, clientError)
+		return
+	}
+
 	// Verify password
 	match, err := user.PasswordMatches(input.Password)
 	if err != nil {
@@ -76,19 +95,154 @@ func (app *Auth) loginPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Create token
-	token, err := app.tokens.New(user.ID, 30*24*time.Hour, tokens.ScopeAuthentication)
+	app.completeLogin(w, r, user.ID, "auth.loginPost")
+}
+
+// Validates the second factor of a user who proved their password and
+// returns an access token if valid
+//
+// The two-factor token is deleted whether the code is valid or not, so a
+// wrong code requires logging in again.
+func (app *Auth) twoFactorLoginPost(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token        string `json:"token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, "auth.twoFactorLoginPost", &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	// Validate parameters
+	v := validator.New()
+	v.Check(len(input.Token) > 0, "token", "must be provided")
+	checkSecondFactor(v, input.Code, input.RecoveryCode)
+	if err := v.Valid("auth.twoFactorLoginPost"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	// Get user
+	user, err := app.users.GetByToken(input.Token, tokens.ScopeTwoFactor)
+	if err != nil {
+		app.rest.Error(w, invalidTwoFactorToken(err))
+		return
+	}
+	if _, err := app.tokens.Delete(input.Token, tokens.ScopeTwoFactor); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	// Verify second factor
+	if err := app.verifySecondFactor(user.ID, input.Code, input.RecoveryCode, "auth.twoFactorLoginPost"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	app.sendAccessToken(w, r, user.ID, "auth.twoFactorLoginPost")
+}
+
+// ============================================================================
+// Helpers
+// ============================================================================
+
+// Sends an access token to a user who proved their password, unless a second
+// factor is required
+//
+// Users who enabled two-factor authentication get a short-lived token to
+// submit a code or assert a security key with instead, along with the methods
+// available to them. Users a group requires it from, who have not
+// enabled it yet, get one to enroll with.
+func (app *Auth) completeLogin(w http.ResponseWriter, r *http.Request, userID int64, op string) {
+	status, err := app.twofactor.GetStatus(userID)
 	if err != nil {
 		app.rest.Error(w, err)
 		return
 	}
 
-	// Insert token
+	var (
+		scope, next string
+		ttl         time.Duration
+	)
+	switch {
+	case status.Enabled:
+		scope, next, ttl = tokens.ScopeTwoFactor, "verify", twoFactorTTL
+	case status.Required:
+		scope, next, ttl = tokens.ScopeTwoFactorSetup, "enroll", twoFactorSetupTTL
+	default:
+		app.sendAccessToken(w, r, userID, op)
+		return
+	}
+
+	token, err := app.tokens.New(userID, ttl, scope)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
 	if _, err := app.tokens.Insert(token); err != nil {
 		app.rest.Error(w, err)
 		return
 	}
 
+	response := rest.Envelope{
+		"two_factor":       next,
+		"two_factor_token": token.Plaintext,
+	}
+	if status.Enabled {
+		response["methods"] = secondFactorMethods(status)
+	}
+
+	app.rest.WriteJSON(w, op, http.StatusOK, response)
+}
+
+// Lists the second factors a user can log in with: "totp" for a code from
+// their authenticator app, "webauthn" for a security key and
+// "recovery_code"
+func secondFactorMethods(status *twofactor.Status) []string {
+	methods := []string{}
+	if status.TOTP {
+		methods = append(methods, "totp")
+	}
+	if status.SecurityKeys > 0 {
+		methods = append(methods, "webauthn")
+	}
+	if status.RecoveryCodes > 0 {
+		methods = append(methods, "recovery_code")
+	}
+	return methods
+}
+
+// Starts a new token family for a user and sends its access and refresh
+// tokens
+func (app *Auth) sendAccessToken(w http.ResponseWriter, r *http.Request, userID int64, op string) {
+	response, err := app.newTokens(r, userID)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
 	// Send response
-	app.rest.WriteJSON(w, "auth.loginPost", http.StatusOK, rest.Envelope{"token": token.Plaintext})
+	app.rest.WriteJSON(w, op, http.StatusOK, response)
+}
+
+// Starts a new token family for a user logging in with a request, returning
+// the response fields of its access and refresh tokens
+func (app *Auth) newTokens(r *http.Request, userID int64) (rest.Envelope, *xerrors.AppError) {
+	pair, err := app.tokens.NewFamily(userID, middleware.Client(r), app.accessTTL, app.refreshTTL)
+	if err != nil {
+		return nil, err
+	}
+	return tokenResponse(pair, app.accessTTL), nil
+}
+
+// Returns the response fields of an access and refresh token
+func tokenResponse(pair *tokens.Pair, accessTTL time.Duration) rest.Envelope {
+	return rest.Envelope{
+		"token":         pair.Access.Plaintext,
+		"refresh_token": pair.Refresh.Plaintext,
+		"expires_in":    int64(accessTTL.Seconds()),
+	}
 }
@@ -3,7 +3,6 @@ package auth
 import (
 	"net/http"
 
-	"pm4devs.strawhats/internal/models/tokens"
 	"pm4devs.strawhats/internal/routes/middleware"
 )
 
@@ -11,11 +10,12 @@ import (
 // POST
 // ============================================================================
 
-// Logs the user out by deleting their access token from the tokens table
+// Logs the user out by revoking the session of their access token, along
+// with the refresh token it was issued with
 func (app *Auth) logoutPost(w http.ResponseWriter, r *http.Request) {
-	token := middleware.ContextGetToken(r)
+	session := middleware.ContextGetSession(r)
 
-	if _, err := app.tokens.Delete(token, tokens.ScopeAuthentication); err != nil {
+	if err := app.tokens.DeleteFamily(session); err != nil {
 		app.rest.Error(w, err)
 		return
 	}
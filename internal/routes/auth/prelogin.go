@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"net/http"
+
+	"pm4devs.strawhats/internal/models/users"
+	"pm4devs.strawhats/internal/rest"
+	"pm4devs.strawhats/internal/validator"
+	"pm4devs.strawhats/internal/xerrors"
+)
+
+// ============================================================================
+// POST
+// ============================================================================
+
+// Returns the KDF parameters of a user so the client can derive their keys
+// from the master password before signing in
+//
+// Emails without an account get made up parameters, the same for each email,
+// so the response doesn't reveal who has an account.
+func (app *Auth) preloginPost(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, "auth.preloginPost", &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	// Validate parameters
+	v := validator.New()
+	v.Check(len(input.Email) > 0, "email", "must be provided")
+	if err := v.Valid("auth.preloginPost"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	// Get parameters, null for accounts registered before they were stored
+	kdf, err := app.users.GetKDF(input.Email)
+	if err != nil && err.Matches(xerrors.ErrNotFound) {
+		kdf, err = users.FakeKDF(app.secret, input.Email), nil
+	}
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	// Send response
+	app.rest.WriteJSON(w, "auth.preloginPost", http.StatusOK, rest.Envelope{"kdf": kdf})
+}
@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"net/http"
+
+	"pm4devs.strawhats/internal/routes/middleware"
+	"pm4devs.strawhats/internal/validator"
+)
+
+// ============================================================================
+// POST
+// ============================================================================
+
+// Exchanges a refresh token for a new access and refresh token
+//
+// Each refresh token can only be used once. Using one again revokes every
+// token issued since the login it comes from.
+func (app *Auth) refreshPost(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, "auth.refreshPost", &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	// Validate parameters
+	v := validator.New()
+	v.Check(len(input.RefreshToken) > 0, "refresh_token", "must be provided")
+	if err := v.Valid("auth.refreshPost"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	// Rotate tokens
+	pair, err := app.tokens.Refresh(input.RefreshToken, middleware.Client(r), app.accessTTL, app.refreshTTL)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	// Send response
+	app.rest.WriteJSON(w, "auth.refreshPost", http.StatusOK, tokenResponse(pair, app.accessTTL))
+}
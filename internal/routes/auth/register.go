@@ -5,7 +5,9 @@ import (
 	"time"
 
 	"pm4devs.strawhats/internal/models/tokens"
+	"pm4devs.strawhats/internal/models/users"
 	"pm4devs.strawhats/internal/rest"
+	"pm4devs.strawhats/internal/validator"
 	"pm4devs.strawhats/internal/xerrors"
 )
 
@@ -16,8 +18,14 @@ import (
 // Registers a user with a given email and password and responds with http.StatusCreated
 func (auth *Auth) registerPost(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Email    string     `json:"email"`
+		Password string     `json:"password"`
+		KDF      *users.KDF `json:"kdf"`
+	}
+
+	if err := auth.requirePasswordLogin("auth.registerPost"); err != nil {
+		auth.rest.Error(w, err)
+		return
 	}
 
 	// Parse request
@@ -33,6 +41,20 @@ func (auth *Auth) registerPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Use the client's KDF parameters, or a default with a random salt
+	if input.KDF != nil {
+		v := validator.New()
+		users.ValidateKDF(v, input.KDF, "kdf")
+		if err := v.Valid("auth.registerPost"); err != nil {
+			auth.rest.Error(w, err)
+			return
+		}
+		user.KDF = input.KDF
+	} else if user.KDF, err = users.DefaultKDF(); err != nil {
+		auth.rest.Error(w, err)
+		return
+	}
+
 	// Insert user
 	if err := auth.users.Insert(user); err != nil {
 		err.If(xerrors.ErrUniqueViolation, func(err *xerrors.AppError) {
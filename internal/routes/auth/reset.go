@@ -20,6 +20,11 @@ func (auth *Auth) resetPost(w http.ResponseWriter, r *http.Request) {
 		Email string `json:"email"`
 	}
 
+	if err := auth.requirePasswordLogin("auth.resetPost"); err != nil {
+		auth.rest.Error(w, err)
+		return
+	}
+
 	// Parse email
 	if err := auth.rest.ReadJSON(w, r, "auth.resetPost", &input); err != nil {
 		auth.rest.Error(w, err)
@@ -33,6 +38,13 @@ func (auth *Auth) resetPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Service accounts have no password, nor an email to send to
+	if user.IsServiceAccount() {
+		auth.rest.Error(w, xerrors.ClientError(http.StatusForbidden,
+			"Service accounts have no password to reset", "auth.resetPost", xerrors.ErrUnauthorized))
+		return
+	}
+
 	// Verify active
 	err = xerrors.ClientUnauthorized(!user.Activated, "auth.resetPost")
 	if err != nil {
@@ -82,6 +94,11 @@ func (auth *Auth) resetPut(w http.ResponseWriter, r *http.Request) {
 		Token    string `json:"token"`
 	}
 
+	if err := auth.requirePasswordLogin("auth.resetPut"); err != nil {
+		auth.rest.Error(w, err)
+		return
+	}
+
 	// Parse password and token
 	if err := auth.rest.ReadJSON(w, r, "auth.resetPut", &input); err != nil {
 		auth.rest.Error(w, err)
@@ -99,7 +116,7 @@ func (auth *Auth) resetPut(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get user
-	user, err := auth.users.GetByToken(input.Token)
+	user, err := auth.users.GetByToken(input.Token, tokens.ScopePasswordReset)
 	if err != nil {
 		auth.rest.Error(w, err)
 		return
@@ -111,11 +128,15 @@ func (auth *Auth) resetPut(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Update user
+	// Update user, who proved they own their email
 	if err := auth.users.Update(user); err != nil {
 		auth.rest.Error(w, err)
 		return
 	}
+	if err := auth.users.VerifyEmail(user.ID); err != nil {
+		auth.rest.Error(w, err)
+		return
+	}
 
 	// Delete token
 	if _, err := auth.tokens.DeleteAllForScope(user.ID, tokens.ScopePasswordReset); err != nil {
@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"net/http"
+
+	"pm4devs.strawhats/internal/rest"
+	"pm4devs.strawhats/internal/routes/middleware"
+	"pm4devs.strawhats/internal/validator"
+	"pm4devs.strawhats/internal/xerrors"
+)
+
+// ============================================================================
+// GET
+// ============================================================================
+
+// Lists the sessions of an authenticated user, the devices they are logged in
+// on
+func (app *Auth) sessionsGet(w http.ResponseWriter, r *http.Request) {
+	user := middleware.ContextGetUser(r)
+
+	sessions, err := app.tokens.GetSessions(user.ID, middleware.ContextGetSession(r))
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	app.rest.WriteJSON(w, "auth.sessionsGet", http.StatusOK, rest.Envelope{
+		"message": "Success!",
+		"data":    sessions,
+	})
+}
+
+// ============================================================================
+// DELETE
+// ============================================================================
+
+// Revokes a session of an authenticated user, logging out the device it was
+// started on. Revoking the current session logs the user out.
+func (app *Auth) sessionsDelete(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		ID int64 `json:"id"`
+	}
+
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, "auth.sessionsDelete", &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	// Validate parameters
+	v := validator.New()
+	v.Check(input.ID > 0, "id", "must be provided")
+	if err := v.Valid("auth.sessionsDelete"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	user := middleware.ContextGetUser(r)
+	if err := app.tokens.DeleteSession(input.ID, user.ID); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	app.rest.WriteJSON(w, "auth.sessionsDelete", http.StatusOK, rest.Envelope{
+		"message": "Success! The session is revoked.",
+	})
+}
+
+// Revokes every session of an authenticated user but the current one
+func (app *Auth) sessionsOthersDelete(w http.ResponseWriter, r *http.Request) {
+	user := middleware.ContextGetUser(r)
+
+	revoked, err := app.tokens.DeleteOtherSessions(user.ID, middleware.ContextGetSession(r))
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	app.rest.WriteJSON(w, "auth.sessionsOthersDelete", http.StatusOK, rest.Envelope{
+		"message": "Success! Your other sessions are revoked.",
+		"revoked": revoked,
+	})
+}
+
+// Revokes every session of a user, logging them out everywhere. Admins only.
+func (app *Auth) sessionsUserDelete(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, "auth.sessionsUserDelete", &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	// Validate parameters
+	v := validator.New()
+	v.Check(len(input.Email) > 0, "email", "must be provided")
+	if err := v.Valid("auth.sessionsUserDelete"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	user, err := app.users.GetByEmail(input.Email)
+	if err != nil {
+		err.If(xerrors.ErrNotFound, func(err *xerrors.AppError) {
+			err.Data = "No user found with that email"
+		})
+		app.rest.Error(w, err)
+		return
+	}
+
+	revoked, err := app.tokens.DeleteAllSessions(user.ID)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	app.rest.WriteJSON(w, "auth.sessionsUserDelete", http.StatusOK, rest.Envelope{
+		"message": "Success! Every session of the user is revoked.",
+		"revoked": revoked,
+	})
+}
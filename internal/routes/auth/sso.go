@@ -0,0 +1,237 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+
+	"pm4devs.strawhats/internal/models/sso"
+	"pm4devs.strawhats/internal/models/users"
+	"pm4devs.strawhats/internal/oidc"
+	"pm4devs.strawhats/internal/rest"
+	"pm4devs.strawhats/internal/validator"
+	"pm4devs.strawhats/internal/xerrors"
+)
+
+// ============================================================================
+// GET
+// ============================================================================
+
+// Tells clients how users sign in, with single sign-on and/or a password
+func (app *Auth) ssoGet(w http.ResponseWriter, r *http.Request) {
+	app.rest.WriteJSON(w, "auth.ssoGet", http.StatusOK, rest.Envelope{
+		"sso":            app.provider != nil,
+		"password_login": app.passwordLogin,
+	})
+}
+
+// ============================================================================
+// POST
+// ============================================================================
+
+// Starts a sign-in with the OpenID Connect provider, returning the URL to
+// send the user to
+//
+// Sign-ins started with ?device=true send the user back to the page approving
+// devices instead of the client's callback.
+func (app *Auth) ssoPost(w http.ResponseWriter, r *http.Request) {
+	if err := app.requireSSO("auth.ssoPost"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	redirectURL := ""
+	if r.URL.Query().Get("device") == "true" {
+		redirectURL = app.verificationURL
+	}
+
+	// The state ties the redirect back to this sign-in, the nonce ties the ID
+	// token to it and the verifier proves the code is exchanged by the server
+	var state, nonce, verifier string
+	for _, value := range []*string{&state, &nonce, &verifier} {
+		random, err := oidc.Random()
+		if err != nil {
+			app.rest.Error(w, xerrors.ServerError("auth.ssoPost", err))
+			return
+		}
+		*value = random
+	}
+	if err := app.sso.NewState(state, nonce, verifier, redirectURL, oidc.Timeout); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	authURL, err := app.provider.AuthURL(r.Context(), state, nonce, verifier, redirectURL)
+	if err != nil {
+		app.rest.Error(w, providerError(err, "auth.ssoPost"))
+		return
+	}
+
+	app.rest.WriteJSON(w, "auth.ssoPost", http.StatusOK, rest.Envelope{
+		"authorization_url": authURL,
+	})
+}
+
+// ============================================================================
+// PUT
+// ============================================================================
+
+// Finishes a sign-in with the code and state the provider redirected the user
+// back with, returning an access token
+//
+// Users are provisioned on their first sign-in and their groups follow the
+// groups claim. Users with two-factor authentication, or in a group requiring
+// it, finish like a password login.
+func (app *Auth) ssoPut(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Code  string `json:"code"`
+		State string `json:"state"`
+	}
+
+	if err := app.requireSSO("auth.ssoPut"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, "auth.ssoPut", &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	// Validate parameters
+	v := validator.New()
+	v.Check(len(input.Code) > 0, "code", "must be provided")
+	v.Check(len(input.State) > 0, "state", "must be provided")
+	if err := v.Valid("auth.ssoPut"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	// Verify the sign-in
+	state, err := app.sso.TakeState(input.State)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	claims, exchangeErr := app.provider.Exchange(r.Context(), input.Code, state.Verifier, state.Nonce, state.RedirectURL)
+	if exchangeErr != nil {
+		app.rest.Error(w, providerError(exchangeErr, "auth.ssoPut"))
+		return
+	}
+	if !claims.EmailVerified || users.IsServiceAccountEmail(claims.Email) {
+		app.rest.Error(w, xerrors.ClientError(http.StatusForbidden,
+			"The identity provider did not verify your email", "auth.ssoPut", xerrors.ErrUnauthorized))
+		return
+	}
+	v = validator.New()
+	v.IsEmail(claims.Email, "email", "is invalid")
+	if err := v.Valid("auth.ssoPut"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	// Provision the user just in time
+	user, created, err := app.sso.Provision(sso.Identity{
+		Issuer:  claims.Issuer,
+		Subject: claims.Subject,
+		Email:   claims.Email,
+		Name:    claims.Name,
+	})
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	if created {
+		kdf, err := users.DefaultKDF()
+		if err != nil {
+			app.rest.Error(w, err)
+			return
+		}
+		if err := app.users.SetKDF(user.ID, kdf); err != nil {
+			app.rest.Error(w, err)
+			return
+		}
+	}
+
+	// Map the groups claim onto groups
+	if app.groupsClaim != "" {
+		if err := app.sso.SyncGroups(user.ID, claims.Groups(app.groupsClaim)); err != nil {
+			app.rest.Error(w, err)
+			return
+		}
+	}
+
+	// Groups joined from the claim may require two-factor authentication
+	app.completeLogin(w, r, user.ID, "auth.ssoPut")
+}
+
+// Binds a group to the provider, so its members follow the groups claim, or
+// unbinds it
+func (app *Auth) ssoGroupPut(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		GroupName string `json:"group_name"`
+		Managed   *bool  `json:"managed"`
+	}
+
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, "auth.ssoGroupPut", &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	// Validate parameters
+	v := validator.New()
+	v.Check(len(input.GroupName) > 0, "group_name", "must be provided")
+	v.Check(input.Managed != nil, "managed", "must be provided")
+	if err := v.Valid("auth.ssoGroupPut"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	if err := app.sso.SetGroupManaged(input.GroupName, *input.Managed); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	app.rest.WriteJSON(w, "auth.ssoGroupPut", http.StatusOK, rest.Envelope{
+		"message": "Success!",
+		"data": rest.Envelope{
+			"group_name":  input.GroupName,
+			"idp_managed": *input.Managed,
+		},
+	})
+}
+
+// ============================================================================
+// Helpers
+// ============================================================================
+
+// Returns an error if single sign-on is not configured
+func (app *Auth) requireSSO(op string) *xerrors.AppError {
+	if app.provider == nil {
+		return xerrors.ClientError(http.StatusNotFound, "Single sign-on is not configured", op, xerrors.ErrNotFound)
+	}
+	return nil
+}
+
+// Returns an error if password login is disabled
+func (app *Auth) requirePasswordLogin(op string) *xerrors.AppError {
+	if !app.passwordLogin {
+		return xerrors.ClientError(http.StatusForbidden, "Password login is disabled, sign in with single sign-on",
+			op, xerrors.ErrUnauthorized)
+	}
+	return nil
+}
+
+// Returns an error for a failed exchange with the provider, unauthenticated
+// if the provider rejected the code or its ID token could not be verified
+func providerError(err error, op string) *xerrors.AppError {
+	if errors.Is(err, oidc.ErrDiscovery) {
+		appErr := xerrors.ServerError(op, err)
+		appErr.StatusCode = http.StatusBadGateway
+		appErr.Data = "The identity provider could not be reached"
+		return appErr
+	}
+	return xerrors.ClientError(http.StatusUnauthorized, "The sign-in could not be verified: "+err.Error(), op,
+		xerrors.ErrUnauthenticated)
+}
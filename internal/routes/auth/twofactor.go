@@ -0,0 +1,414 @@
+package auth
+
+import (
+	"maps"
+	"net/http"
+	"time"
+
+	"pm4devs.strawhats/internal/models/tokens"
+	"pm4devs.strawhats/internal/models/twofactor"
+	"pm4devs.strawhats/internal/models/users"
+	"pm4devs.strawhats/internal/rest"
+	"pm4devs.strawhats/internal/routes/middleware"
+	"pm4devs.strawhats/internal/totp"
+	"pm4devs.strawhats/internal/validator"
+	"pm4devs.strawhats/internal/xerrors"
+)
+
+const (
+	// Issuer shown by authenticator apps next to the account
+	totpIssuer = "pm4devs"
+
+	// How long the token to submit a code with at login is valid for
+	twoFactorTTL = 5 * time.Minute
+
+	// How long the token to enroll with at login is valid for
+	twoFactorSetupTTL = 15 * time.Minute
+)
+
+// ============================================================================
+// GET
+// ============================================================================
+
+// Gets the two-factor authentication settings of an authenticated user
+func (app *Auth) twoFactorGet(w http.ResponseWriter, r *http.Request) {
+	user := middleware.ContextGetUser(r)
+	if err := xerrors.ClientUnauthorized(user.IsAnonymous(), "auth.twoFactorGet"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	status, err := app.twofactor.GetStatus(user.ID)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	app.rest.WriteJSON(w, "auth.twoFactorGet", http.StatusOK, rest.Envelope{
+		"message": "Success!",
+		"data":    status,
+	})
+}
+
+// ============================================================================
+// POST
+// ============================================================================
+
+// Enrolls a new TOTP secret, returning it along with its otpauth URI for
+// authenticator apps to scan as a QR code
+//
+// Users a group requires two-factor authentication from enroll with the token
+// handed to them at login instead of an access token.
+func (app *Auth) twoFactorPost(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token string `json:"token"`
+	}
+
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, "auth.twoFactorPost", &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	user, err := app.twoFactorUser(r, input.Token, "auth.twoFactorPost")
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	secret, genErr := totp.GenerateSecret()
+	if genErr != nil {
+		app.rest.Error(w, xerrors.ServerError("auth.twoFactorPost", genErr))
+		return
+	}
+	if err := app.twofactor.Enroll(user.ID, secret); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	app.rest.WriteJSON(w, "auth.twoFactorPost", http.StatusCreated, rest.Envelope{
+		"message": "Success! Confirm a code from your authenticator app to enable two-factor authentication.",
+		"secret":  totp.Encode(secret),
+		"uri":     totp.URI(totpIssuer, user.Email, secret),
+	})
+}
+
+// Replaces the recovery codes of an authenticated user, given a valid code
+func (app *Auth) twoFactorRecoveryPost(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Code string `json:"code"`
+	}
+
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, "auth.twoFactorRecoveryPost", &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	// Validate parameters
+	v := validator.New()
+	v.Check(len(input.Code) > 0, "code", "must be provided")
+	if err := v.Valid("auth.twoFactorRecoveryPost"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	user := middleware.ContextGetUser(r)
+	if err := app.verifySecondFactor(user.ID, input.Code, "", "auth.twoFactorRecoveryPost"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	codes, hashes, genErr := twofactor.NewRecoveryCodes()
+	if genErr != nil {
+		app.rest.Error(w, xerrors.ServerError("auth.twoFactorRecoveryPost", genErr))
+		return
+	}
+	if err := app.twofactor.SetRecoveryCodes(user.ID, hashes); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	app.rest.WriteJSON(w, "auth.twoFactorRecoveryPost", http.StatusOK, rest.Envelope{
+		"message":        "Success! Store your recovery codes safely, they are only shown once.",
+		"recovery_codes": codes,
+	})
+}
+
+// ============================================================================
+// PUT
+// ============================================================================
+
+// Confirms the enrolled TOTP secret with a first code, enabling two-factor
+// authentication, and returns a new set of recovery codes
+//
+// Users enrolling with the token handed to them at login are logged in.
+func (app *Auth) twoFactorPut(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token string `json:"token"`
+		Code  string `json:"code"`
+	}
+
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, "auth.twoFactorPut", &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	// Validate parameters
+	v := validator.New()
+	v.Check(len(input.Code) > 0, "code", "must be provided")
+	if err := v.Valid("auth.twoFactorPut"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	user, err := app.twoFactorUser(r, input.Token, "auth.twoFactorPut")
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	record, err := app.twofactor.Get(user.ID)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	if record.Enabled() {
+		app.rest.Error(w, xerrors.ClientError(http.StatusConflict,
+			"Two-factor authentication is already enabled", "auth.twoFactorPut", xerrors.ErrEditConflict))
+		return
+	}
+	step, ok := totp.Validate(record.Secret, input.Code, time.Now())
+	if !ok {
+		app.rest.Error(w, invalidCode("auth.twoFactorPut"))
+		return
+	}
+
+	codes, hashes, genErr := twofactor.NewRecoveryCodes()
+	if genErr != nil {
+		app.rest.Error(w, xerrors.ServerError("auth.twoFactorPut", genErr))
+		return
+	}
+	if err := app.twofactor.Confirm(user.ID, step, hashes); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	response := rest.Envelope{
+		"message":        "Success! Store your recovery codes safely, they are only shown once.",
+		"recovery_codes": codes,
+	}
+
+	// Complete the login of users enrolling with a token
+	if middleware.ContextGetUser(r).IsAnonymous() {
+		if _, err := app.tokens.Delete(input.Token, tokens.ScopeTwoFactorSetup); err != nil {
+			app.rest.Error(w, err)
+			return
+		}
+		issued, err := app.newTokens(r, user.ID)
+		if err != nil {
+			app.rest.Error(w, err)
+			return
+		}
+		maps.Copy(response, issued)
+	}
+
+	app.rest.WriteJSON(w, "auth.twoFactorPut", http.StatusOK, response)
+}
+
+// Requires the members of a group to use two-factor authentication, or stops
+// requiring it
+func (app *Auth) twoFactorGroupPut(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		GroupName string `json:"group_name"`
+		Required  *bool  `json:"required"`
+	}
+
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, "auth.twoFactorGroupPut", &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	// Validate parameters
+	v := validator.New()
+	v.Check(len(input.GroupName) > 0, "group_name", "must be provided")
+	v.Check(input.Required != nil, "required", "must be provided")
+	if err := v.Valid("auth.twoFactorGroupPut"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	if err := app.twofactor.SetGroupRequired(input.GroupName, *input.Required); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	app.rest.WriteJSON(w, "auth.twoFactorGroupPut", http.StatusOK, rest.Envelope{
+		"message": "Success!",
+		"data": rest.Envelope{
+			"group_name":  input.GroupName,
+			"require_2fa": *input.Required,
+		},
+	})
+}
+
+// ============================================================================
+// DELETE
+// ============================================================================
+
+// Disables the authenticator app of an authenticated user, given their
+// password and a code or recovery code
+//
+// An enrollment that was not confirmed yet is cancelled with the password
+// only. Users a group requires two-factor authentication from cannot disable
+// it unless they registered a security key.
+func (app *Auth) twoFactorDelete(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Password     string `json:"password"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	user := middleware.ContextGetUser(r)
+	if err := xerrors.ClientUnauthorized(user.IsAnonymous(), "auth.twoFactorDelete"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, "auth.twoFactorDelete", &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	// Validate parameters
+	v := validator.New()
+	v.Check(len(input.Password) > 0, "password", "must be provided")
+	if err := v.Valid("auth.twoFactorDelete"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	// Compare passwords
+	// The context only carries the ID and email of the user
+	account, err := app.users.GetByID(user.ID)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	passwordIsCorrect, err := account.PasswordMatches(input.Password)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	err = xerrors.ClientUnauthorized(!passwordIsCorrect, "auth.twoFactorDelete.Password")
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	record, err := app.twofactor.Get(user.ID)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	if record.Enabled() {
+		status, err := app.twofactor.GetStatus(user.ID)
+		if err != nil {
+			app.rest.Error(w, err)
+			return
+		}
+		if status.Required && status.SecurityKeys == 0 {
+			app.rest.Error(w, xerrors.ClientError(http.StatusForbidden,
+				"A group you belong to requires two-factor authentication", "auth.twoFactorDelete",
+				xerrors.ErrUnauthorized))
+			return
+		}
+
+		v := validator.New()
+		checkSecondFactor(v, input.Code, input.RecoveryCode)
+		if err := v.Valid("auth.twoFactorDelete"); err != nil {
+			app.rest.Error(w, err)
+			return
+		}
+		if err := app.verifySecondFactor(user.ID, input.Code, input.RecoveryCode, "auth.twoFactorDelete"); err != nil {
+			app.rest.Error(w, err)
+			return
+		}
+	}
+
+	if err := app.twofactor.Disable(user.ID); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	app.rest.WriteJSON(w, "auth.twoFactorDelete", http.StatusOK, rest.Envelope{
+		"message": "Success! Two-factor authentication is disabled.",
+	})
+}
+
+// ============================================================================
+// Helpers
+// ============================================================================
+
+// Gets the authenticated user, or the user of a token handed out at login to
+// enroll with
+func (app *Auth) twoFactorUser(r *http.Request, token, op string) (*users.UserRecord, *xerrors.AppError) {
+	user := middleware.ContextGetUser(r)
+	if !user.IsAnonymous() {
+		return user, nil
+	}
+	if err := xerrors.ClientUnauthorized(token == "", op); err != nil {
+		return nil, err
+	}
+
+	user, err := app.users.GetByToken(token, tokens.ScopeTwoFactorSetup)
+	if err != nil {
+		return nil, invalidTwoFactorToken(err)
+	}
+	return user, nil
+}
+
+// Checks that exactly one of a code or a recovery code is given
+func checkSecondFactor(v *validator.Validator, code, recoveryCode string) {
+	v.Check(len(code) > 0 || len(recoveryCode) > 0, "code", "must be provided, or a recovery_code")
+	v.Check(len(code) == 0 || len(recoveryCode) == 0, "recovery_code", "must not be provided along with a code")
+}
+
+// Verifies a code from the authenticator app of a user, or one of their
+// recovery codes. Both can only be used once.
+//
+// Recovery codes are accepted without an authenticator app, for users who
+// only registered security keys.
+func (app *Auth) verifySecondFactor(userID int64, code, recoveryCode, op string) *xerrors.AppError {
+	if recoveryCode != "" {
+		return app.twofactor.UseRecoveryCode(userID, twofactor.HashRecoveryCode(recoveryCode))
+	}
+
+	record, err := app.twofactor.Get(userID)
+	if err != nil {
+		return err
+	}
+	if !record.Enabled() {
+		return notEnabled(op)
+	}
+	step, ok := totp.Validate(record.Secret, code, time.Now())
+	if !ok {
+		return invalidCode(op)
+	}
+	return app.twofactor.UseStep(record.UserID, step)
+}
+
+// Returns a conflict error for a user whose enrollment was not confirmed
+func notEnabled(op string) *xerrors.AppError {
+	return xerrors.ClientError(http.StatusConflict,
+		"Two-factor authentication is not enabled", op, xerrors.ErrEditConflict)
+}
+
+// Returns an unauthenticated error for a wrong code
+func invalidCode(op string) *xerrors.AppError {
+	return xerrors.ClientError(http.StatusUnauthorized,
+		"The code is invalid or was already used", op, xerrors.ErrUnauthenticated)
+}
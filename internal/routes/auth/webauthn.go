@@ -0,0 +1,504 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"maps"
+	"net/http"
+
+	"pm4devs.strawhats/internal/models/passkeys"
+	"pm4devs.strawhats/internal/models/tokens"
+	"pm4devs.strawhats/internal/models/twofactor"
+	"pm4devs.strawhats/internal/rest"
+	"pm4devs.strawhats/internal/routes/middleware"
+	"pm4devs.strawhats/internal/validator"
+	"pm4devs.strawhats/internal/webauthn"
+	"pm4devs.strawhats/internal/xerrors"
+)
+
+// Returned when a passkey was not stored for the user its credential belongs
+// to
+var errUserHandle = errors.New("user handle does not match")
+
+// ============================================================================
+// GET
+// ============================================================================
+
+// Lists the passkeys and security keys of an authenticated user
+func (app *Auth) webAuthnCredentialsGet(w http.ResponseWriter, r *http.Request) {
+	user := middleware.ContextGetUser(r)
+
+	credentials, err := app.passkeys.GetByUserID(user.ID)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	app.rest.WriteJSON(w, "auth.webAuthnCredentialsGet", http.StatusOK, rest.Envelope{
+		"message": "Success!",
+		"data":    credentials,
+	})
+}
+
+// ============================================================================
+// POST
+// ============================================================================
+
+// Begins the registration of a passkey or security key, returning the
+// options of navigator.credentials.create
+//
+// Users a group requires two-factor authentication from may register one with
+// the token handed to them at login instead of an access token.
+func (app *Auth) webAuthnRegisterPost(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token string `json:"token"`
+	}
+
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, "auth.webAuthnRegisterPost", &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	user, err := app.twoFactorUser(r, input.Token, "auth.webAuthnRegisterPost")
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	// Credentials already registered are excluded, an authenticator holds one
+	// credential per user
+	credentials, err := app.passkeys.GetByUserID(user.ID)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	challenge, err := app.newChallenge(&user.ID, passkeys.CeremonyRegister, "auth.webAuthnRegisterPost")
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	app.rest.WriteJSON(w, "auth.webAuthnRegisterPost", http.StatusOK, rest.Envelope{
+		"options": app.rp.CreationOptions(challenge, userHandle(user.ID), user.Email, credentialIDs(*credentials)),
+	})
+}
+
+// Begins a login with a passkey, or with a security key as a second factor,
+// returning the options of navigator.credentials.get
+//
+// Users who proved their password send the two-factor token handed to them at
+// login, and may assert any of their credentials. Others may send their email
+// to be offered their credentials, or nothing to pick a passkey stored on
+// their authenticator.
+func (app *Auth) webAuthnLoginPost(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token string `json:"token"`
+		Email string `json:"email"`
+	}
+
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, "auth.webAuthnLoginPost", &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	// Second factor
+	if input.Token != "" {
+		user, err := app.users.GetByToken(input.Token, tokens.ScopeTwoFactor)
+		if err != nil {
+			app.rest.Error(w, invalidTwoFactorToken(err))
+			return
+		}
+		credentials, err := app.passkeys.GetByUserID(user.ID)
+		if err != nil {
+			app.rest.Error(w, err)
+			return
+		}
+		if len(*credentials) == 0 {
+			app.rest.Error(w, xerrors.ClientError(http.StatusConflict,
+				"No security key is registered", "auth.webAuthnLoginPost", xerrors.ErrEditConflict))
+			return
+		}
+		challenge, err := app.newChallenge(&user.ID, passkeys.CeremonySecondFactor, "auth.webAuthnLoginPost")
+		if err != nil {
+			app.rest.Error(w, err)
+			return
+		}
+
+		app.rest.WriteJSON(w, "auth.webAuthnLoginPost", http.StatusOK, rest.Envelope{
+			"options": app.rp.RequestOptions(challenge, credentialIDs(*credentials), "discouraged"),
+		})
+		return
+	}
+
+	// Passkey, unknown emails get no credentials so users cannot be discovered
+	allow := [][]byte{}
+	if input.Email != "" {
+		user, err := app.users.GetByEmail(input.Email)
+		if err != nil && !err.Matches(xerrors.ErrNotFound) {
+			app.rest.Error(w, err)
+			return
+		}
+		if user != nil {
+			credentials, err := app.passkeys.GetByUserID(user.ID)
+			if err != nil {
+				app.rest.Error(w, err)
+				return
+			}
+			allow = credentialIDs(*credentials)
+		}
+	}
+	challenge, err := app.newChallenge(nil, passkeys.CeremonyLogin, "auth.webAuthnLoginPost")
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	app.rest.WriteJSON(w, "auth.webAuthnLoginPost", http.StatusOK, rest.Envelope{
+		"options": app.rp.RequestOptions(challenge, allow, "required"),
+	})
+}
+
+// ============================================================================
+// PUT
+// ============================================================================
+
+// Completes the registration of a passkey or security key with the response
+// of the authenticator
+//
+// Users registering their first second factor get a set of recovery codes,
+// and users registering with the token handed to them at login are logged in.
+func (app *Auth) webAuthnRegisterPut(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token      string                        `json:"token"`
+		Name       string                        `json:"name"`
+		Credential *webauthn.AttestationResponse `json:"credential"`
+	}
+
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, "auth.webAuthnRegisterPut", &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	// Validate parameters
+	v := validator.New()
+	v.Check(len(input.Name) > 0, "name", "must be provided")
+	v.Check(len(input.Name) <= 64, "name", "must not be more than 64 bytes long")
+	v.Check(input.Credential != nil, "credential", "must be provided")
+	if err := v.Valid("auth.webAuthnRegisterPut"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	user, err := app.twoFactorUser(r, input.Token, "auth.webAuthnRegisterPut")
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	// Verify response
+	challenge, err := app.takeChallenge(input.Credential.Response.ClientDataJSON, passkeys.CeremonyRegister,
+		user.ID, "auth.webAuthnRegisterPut")
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	credential, verifyErr := app.rp.VerifyRegistration(challenge, input.Credential, false)
+	if verifyErr != nil {
+		app.rest.Error(w, verificationError(verifyErr, "auth.webAuthnRegisterPut"))
+		return
+	}
+
+	status, err := app.twofactor.GetStatus(user.ID)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	record := &passkeys.CredentialRecord{
+		UserID:            user.ID,
+		CredentialID:      credential.ID,
+		PublicKey:         credential.PublicKey,
+		SignCount:         credential.SignCount,
+		AttestationFormat: credential.Format,
+		AAGUID:            credential.AAGUID,
+		Name:              input.Name,
+	}
+	if err := app.passkeys.Insert(record); err != nil {
+		err.If(xerrors.ErrUniqueViolation, func(err *xerrors.AppError) {
+			err.Data = "The credential is already registered"
+		})
+		app.rest.Error(w, err)
+		return
+	}
+
+	response := rest.Envelope{
+		"message": "Success! Your security key is registered.",
+		"data":    record,
+	}
+
+	// Hand out recovery codes along with the first second factor
+	if !status.Enabled {
+		codes, hashes, genErr := twofactor.NewRecoveryCodes()
+		if genErr != nil {
+			app.rest.Error(w, xerrors.ServerError("auth.webAuthnRegisterPut", genErr))
+			return
+		}
+		if err := app.twofactor.SetRecoveryCodes(user.ID, hashes); err != nil {
+			app.rest.Error(w, err)
+			return
+		}
+		response["message"] = "Success! Store your recovery codes safely, they are only shown once."
+		response["recovery_codes"] = codes
+	}
+
+	// Complete the login of users registering with a token
+	if middleware.ContextGetUser(r).IsAnonymous() {
+		if _, err := app.tokens.Delete(input.Token, tokens.ScopeTwoFactorSetup); err != nil {
+			app.rest.Error(w, err)
+			return
+		}
+		issued, err := app.newTokens(r, user.ID)
+		if err != nil {
+			app.rest.Error(w, err)
+			return
+		}
+		maps.Copy(response, issued)
+	}
+
+	app.rest.WriteJSON(w, "auth.webAuthnRegisterPut", http.StatusCreated, response)
+}
+
+// Completes a login with a passkey, or with a security key as a second factor,
+// with the response of the authenticator and returns an access token if valid
+//
+// Passkeys must verify their user, with a PIN or biometrics, since they stand
+// in for the password. The two-factor token is deleted whether the response
+// is valid or not, so a failed attempt requires logging in again.
+func (app *Auth) webAuthnLoginPut(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token      string                      `json:"token"`
+		Credential *webauthn.AssertionResponse `json:"credential"`
+	}
+
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, "auth.webAuthnLoginPut", &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	// Validate parameters
+	v := validator.New()
+	v.Check(input.Credential != nil, "credential", "must be provided")
+	if err := v.Valid("auth.webAuthnLoginPut"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	// Get the user expected to answer the challenge
+	var (
+		challenge []byte
+		userID    int64
+		err       *xerrors.AppError
+	)
+	ceremony := passkeys.CeremonyLogin
+	if input.Token != "" {
+		ceremony = passkeys.CeremonySecondFactor
+		user, err := app.users.GetByToken(input.Token, tokens.ScopeTwoFactor)
+		if err != nil {
+			app.rest.Error(w, invalidTwoFactorToken(err))
+			return
+		}
+		if _, err := app.tokens.Delete(input.Token, tokens.ScopeTwoFactor); err != nil {
+			app.rest.Error(w, err)
+			return
+		}
+		userID = user.ID
+	}
+	challenge, err = app.takeChallenge(input.Credential.Response.ClientDataJSON, ceremony, userID,
+		"auth.webAuthnLoginPut")
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	// Get credential
+	credential, err := app.passkeys.GetByCredentialID(input.Credential.RawID)
+	if err == nil && userID != 0 && credential.UserID != userID {
+		err = xerrors.ClientError(http.StatusNotFound,
+			"The credential is not registered", "auth.webAuthnLoginPut", xerrors.ErrNotFound)
+	}
+	if err != nil {
+		err.If(xerrors.ErrNotFound, func(err *xerrors.AppError) {
+			err.StatusCode = http.StatusUnauthorized
+		})
+		app.rest.Error(w, err)
+		return
+	}
+
+	// Verify response
+	signCount, verifyErr := app.rp.VerifyAssertion(challenge, credential.PublicKey, credential.SignCount,
+		input.Credential, ceremony == passkeys.CeremonyLogin)
+	if verifyErr == nil && len(input.Credential.Response.UserHandle) > 0 &&
+		!bytes.Equal(input.Credential.Response.UserHandle, userHandle(credential.UserID)) {
+		verifyErr = errUserHandle
+	}
+	if verifyErr != nil {
+		app.rest.Error(w, verificationError(verifyErr, "auth.webAuthnLoginPut"))
+		return
+	}
+	// A concurrent assertion with the same counter comes from a clone too
+	if err := app.passkeys.UpdateSignCount(credential.ID, signCount); err != nil {
+		if err.Matches(xerrors.ErrEditConflict) {
+			err = verificationError(webauthn.ErrSignCount, "auth.webAuthnLoginPut")
+		}
+		app.rest.Error(w, err)
+		return
+	}
+
+	app.sendAccessToken(w, r, credential.UserID, "auth.webAuthnLoginPut")
+}
+
+// ============================================================================
+// DELETE
+// ============================================================================
+
+// Removes a passkey or security key of an authenticated user, given their
+// password
+//
+// Users a group requires two-factor authentication from cannot remove their
+// last second factor.
+func (app *Auth) webAuthnCredentialsDelete(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		ID       int64  `json:"id"`
+		Password string `json:"password"`
+	}
+
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, "auth.webAuthnCredentialsDelete", &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	// Validate parameters
+	v := validator.New()
+	v.Check(input.ID > 0, "id", "must be provided")
+	v.Check(len(input.Password) > 0, "password", "must be provided")
+	if err := v.Valid("auth.webAuthnCredentialsDelete"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	// Compare passwords
+	user := middleware.ContextGetUser(r)
+	// The context only carries the ID and email of the user
+	account, err := app.users.GetByID(user.ID)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	passwordIsCorrect, err := account.PasswordMatches(input.Password)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	err = xerrors.ClientUnauthorized(!passwordIsCorrect, "auth.webAuthnCredentialsDelete.Password")
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	status, err := app.twofactor.GetStatus(user.ID)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	if status.Required && !status.TOTP && status.SecurityKeys <= 1 {
+		app.rest.Error(w, xerrors.ClientError(http.StatusForbidden,
+			"A group you belong to requires two-factor authentication", "auth.webAuthnCredentialsDelete",
+			xerrors.ErrUnauthorized))
+		return
+	}
+
+	if err := app.passkeys.Delete(input.ID, user.ID); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	app.rest.WriteJSON(w, "auth.webAuthnCredentialsDelete", http.StatusOK, rest.Envelope{
+		"message": "Success! The security key is removed.",
+	})
+}
+
+// ============================================================================
+// Helpers
+// ============================================================================
+
+// Returns the user handle of a user, their ID in big-endian
+//
+// Authenticators store it along with passkeys, and return it at login.
+func userHandle(userID int64) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(userID))
+}
+
+// Returns the IDs of credentials
+func credentialIDs(credentials []passkeys.CredentialRecord) [][]byte {
+	ids := make([][]byte, len(credentials))
+	for i, credential := range credentials {
+		ids[i] = credential.CredentialID
+	}
+	return ids
+}
+
+// Generates and stores a challenge for a ceremony, bound to a user if given
+func (app *Auth) newChallenge(userID *int64, ceremony, op string) ([]byte, *xerrors.AppError) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return nil, xerrors.ServerError(op, err)
+	}
+	if err := app.passkeys.NewChallenge(challenge, userID, ceremony, webauthn.Timeout); err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// Takes the challenge a response answers, checking it was handed out for the
+// ceremony and to the user expected to answer it, 0 if none is
+func (app *Auth) takeChallenge(clientDataJSON []byte, ceremony string, userID int64, op string) ([]byte, *xerrors.AppError) {
+	challenge, err := webauthn.Challenge(clientDataJSON)
+	if err != nil {
+		return nil, verificationError(err, op)
+	}
+
+	boundID, appErr := app.passkeys.TakeChallenge(challenge, ceremony)
+	if appErr != nil {
+		return nil, appErr
+	}
+	if (boundID == nil) != (userID == 0) || (boundID != nil && *boundID != userID) {
+		return nil, verificationError(webauthn.ErrChallenge, op)
+	}
+	return challenge, nil
+}
+
+// Returns an error for a response of an authenticator that failed
+// verification, a bad request if it could not be understood
+func verificationError(err error, op string) *xerrors.AppError {
+	message := "The credential could not be verified: " + err.Error()
+	if errors.Is(err, webauthn.ErrMalformed) || errors.Is(err, webauthn.ErrUnsupportedKey) ||
+		errors.Is(err, webauthn.ErrUnsupportedAttestation) {
+		return xerrors.ClientError(http.StatusBadRequest, message, op, xerrors.ErrBadRequest)
+	}
+	return xerrors.ClientError(http.StatusUnauthorized, message, op, xerrors.ErrUnauthenticated)
+}
+
+// Rewords the error of a missing two-factor token
+func invalidTwoFactorToken(err *xerrors.AppError) *xerrors.AppError {
+	err.If(xerrors.ErrNotFound, func(err *xerrors.AppError) {
+		err.StatusCode = http.StatusUnauthorized
+		err.Data = "The two-factor token is invalid or expired, log in again"
+	})
+	return err
+}
@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"pm4devs.strawhats/internal/assert"
+	"pm4devs.strawhats/internal/mocks"
+	"pm4devs.strawhats/internal/models/tokens"
+	"pm4devs.strawhats/internal/routes/auth"
+	"pm4devs.strawhats/internal/routes/utils"
+)
+
+// Helper device authorization type
+type deviceAuthorization struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int64  `json:"interval"`
+}
+
+// Helper device client type
+type deviceClient struct {
+	Data tokens.DeviceClient `json:"data"`
+}
+
+// Starts the login of a device, returning its codes
+func startDevice(t *testing.T, handler http.HandlerFunc, name string) deviceAuthorization {
+	t.Helper()
+	var result deviceAuthorization
+	assert.RunHandlerTestCase(t, handler, "POST", auth.DeviceRoute, assert.HandlerTestCase[deviceAuthorization]{
+		Name:   name,
+		Status: http.StatusOK,
+		FN: func(t *testing.T, r deviceAuthorization) {
+			result = r
+		},
+	})
+	return result
+}
+
+// Polls for the tokens of a device, expecting an error of RFC 8628
+func pollDevice(t *testing.T, handler http.HandlerFunc, name, deviceCode, expected string) {
+	t.Helper()
+	assert.RunHandlerTestCase(t, handler, "POST", auth.DeviceTokenRoute, assert.HandlerTestCase[failure]{
+		Name:   name,
+		Body:   fmt.Sprintf(`{"device_code": %q}`, deviceCode),
+		Status: http.StatusBadRequest,
+		FN: func(t *testing.T, r failure) {
+			assert.Equal(t, r.Error, expected)
+		},
+	})
+}
+
+func TestDevice(t *testing.T) {
+	assert.Integration(t)
+	app := mocks.App(t)
+	handler := utils.AuthHandler(app)
+
+	credentials := `{"email": "test@example.com", "password": "password"}`
+	assert.Check(t, utils.RegisterUser(handler, credentials))
+	assert.Check(t, utils.ActivateUser(handler, app))
+	session := utils.LoginUser(handler, credentials)
+
+	// The device gets codes to show the user
+	device := startDevice(t, handler, "Start")
+	assert.Equal(t, len(device.UserCode), 9)
+	assert.Equal(t, device.VerificationURI, "http://localhost:4000/v1/auth/device")
+	assert.Equal(t, device.VerificationURIComplete, device.VerificationURI+"?user_code="+device.UserCode)
+	assert.Equal(t, device.ExpiresIn, int64(600))
+	assert.Equal(t, device.Interval, int64(5))
+
+	// And polls until the user approves it
+	assert.RunHandlerTestCase(t, handler, "POST", auth.DeviceTokenRoute, assert.HandlerTestCase[failures]{
+		Name:   "Poll/Validation",
+		Body:   `{}`,
+		Status: http.StatusUnprocessableEntity,
+		FN: func(t *testing.T, r failures) {
+			assert.Equal(t, r.Error["device_code"], "must be provided")
+		},
+	})
+	pollDevice(t, handler, "Poll/Pending", device.DeviceCode, tokens.DeviceAuthorizationPending)
+	pollDevice(t, handler, "Poll/SlowDown", device.DeviceCode, tokens.DeviceSlowDown)
+	pollDevice(t, handler, "Poll/Unknown", "unknown", tokens.DeviceExpiredToken)
+
+	// Users check the device before approving it, typing the code as they like
+	typed := strings.ToLower(strings.ReplaceAll(device.UserCode, "-", " "))
+	approval := auth.DeviceApprovalRoute + "?user_code=" + strings.ReplaceAll(typed, " ", "+")
+	assert.RunHandlerTestCase(t, handler, "GET", approval, assert.HandlerTestCase[failure]{
+		Name:   "Check/AuthRequired",
+		Status: http.StatusUnauthorized,
+	})
+	assert.RunHandlerTestCase(t, handler, "GET", approval, assert.HandlerTestCase[deviceClient]{
+		Name:   "Check/Success",
+		Auth:   session,
+		Status: http.StatusOK,
+		FN: func(t *testing.T, r deviceClient) {
+			assert.Check(t, r.Data.Expiry.After(r.Data.CreatedAt))
+		},
+	})
+	assert.RunHandlerTestCase(t, handler, "GET", auth.DeviceApprovalRoute+"?user_code=BBBB-BBBB",
+		assert.HandlerTestCase[failure]{
+			Name:   "Check/Unknown",
+			Auth:   session,
+			Status: http.StatusNotFound,
+		})
+
+	body := fmt.Sprintf(`{"user_code": %q}`, typed)
+	assert.RunHandlerTestCase(t, handler, "PUT", auth.DeviceApprovalRoute, assert.HandlerTestCase[message]{
+		Name:   "Approve/Success",
+		Auth:   session,
+		Body:   body,
+		Status: http.StatusOK,
+		FN: func(t *testing.T, r message) {
+			assert.Equal(t, r.Message, "Success! The device is approved")
+		},
+	})
+	assert.RunHandlerTestCase(t, handler, "PUT", auth.DeviceApprovalRoute, assert.HandlerTestCase[failure]{
+		Name:   "Approve/Twice",
+		Auth:   session,
+		Body:   body,
+		Status: http.StatusNotFound,
+	})
+
+	// The next poll logs the device in, once
+	var pair tokenPair
+	assert.RunHandlerTestCase(t, handler, "POST", auth.DeviceTokenRoute, assert.HandlerTestCase[tokenPair]{
+		Name:   "Poll/Approved",
+		Body:   fmt.Sprintf(`{"device_code": %q}`, device.DeviceCode),
+		Status: http.StatusOK,
+		FN: func(t *testing.T, r tokenPair) {
+			pair = r
+		},
+	})
+	authenticated(t, handler, "Poll/Authenticated", pair.Token, true)
+	refresh(t, handler, "Poll/Refresh", pair.RefreshToken, http.StatusOK)
+	pollDevice(t, handler, "Poll/Used", device.DeviceCode, tokens.DeviceExpiredToken)
+	listSessions(t, handler, "Poll/Session", session, 2)
+
+	// Denied devices are told once
+	denied := startDevice(t, handler, "Deny/Start")
+	assert.RunHandlerTestCase(t, handler, "DELETE", auth.DeviceApprovalRoute, assert.HandlerTestCase[message]{
+		Name:   "Deny/Success",
+		Auth:   session,
+		Body:   fmt.Sprintf(`{"user_code": %q}`, denied.UserCode),
+		Status: http.StatusOK,
+		FN: func(t *testing.T, r message) {
+			assert.Equal(t, r.Message, "Success! The device is denied")
+		},
+	})
+	pollDevice(t, handler, "Deny/Poll", denied.DeviceCode, tokens.DeviceAccessDenied)
+	pollDevice(t, handler, "Deny/PollAgain", denied.DeviceCode, tokens.DeviceExpiredToken)
+
+	// An IP address can only have a few devices waiting
+	for i := 0; i < 5; i++ {
+		startDevice(t, handler, fmt.Sprintf("Limit/Start%d", i))
+	}
+	assert.RunHandlerTestCase(t, handler, "POST", auth.DeviceRoute, assert.HandlerTestCase[failure]{
+		Name:   "Limit/Exceeded",
+		Status: http.StatusTooManyRequests,
+	})
+}
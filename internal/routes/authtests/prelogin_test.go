@@ -0,0 +1,167 @@
+package auth
+
+import (
+	"net/http"
+	"testing"
+
+	"pm4devs.strawhats/internal/assert"
+	"pm4devs.strawhats/internal/mocks"
+	"pm4devs.strawhats/internal/models/users"
+	"pm4devs.strawhats/internal/routes/auth"
+	"pm4devs.strawhats/internal/routes/utils"
+)
+
+const argon2Body = `{"email": "argon@example.com", "password": "password",
+	"kdf": {"algorithm": "argon2id", "salt": "c2FsdHNhbHRzYWx0c2FsdA==", "iterations": 3, "memory": 65536, "parallelism": 4}}`
+
+type preloginResponse struct {
+	Error map[string]string `json:"error"`
+	KDF   *users.KDF        `json:"kdf"`
+}
+
+// Tests the KDF parameters returned before login
+func TestPrelogin(t *testing.T) {
+	assert.Integration(t)
+	app := mocks.App(t)
+	handler := utils.AuthHandler(app)
+
+	assert.Check(t, utils.RegisterUser(handler, registerSuccessBody))
+	assert.Check(t, utils.RegisterUser(handler, argon2Body))
+
+	tests := []assert.HandlerTestCase[preloginResponse]{
+		{
+			Name:   "Email/Validation",
+			Body:   `{}`,
+			Status: http.StatusUnprocessableEntity,
+			FN: func(t *testing.T, result preloginResponse) {
+				assert.Equal(t, result.Error["email"], "must be provided")
+			},
+		},
+		{
+			Name:   "Unknown",
+			Body:   `{"email": "unknown@example.com"}`,
+			Status: http.StatusOK,
+			FN: func(t *testing.T, result preloginResponse) {
+				fake := users.FakeKDF(app.Config.SecretKey(), "unknown@example.com")
+				assert.Equal(t, result.KDF.Algorithm, users.KDFPBKDF2)
+				assert.Equal(t, result.KDF.Iterations, 600000)
+				assert.Equal(t, result.KDF.Salt, fake.Salt)
+			},
+		},
+		{
+			Name:   "Default",
+			Body:   `{"email": "test@example.com"}`,
+			Status: http.StatusOK,
+			FN: func(t *testing.T, result preloginResponse) {
+				assert.Equal(t, result.KDF.Algorithm, users.KDFPBKDF2)
+				assert.Equal(t, result.KDF.Iterations, 600000)
+				assert.Check(t, len(result.KDF.Salt) > 0)
+				assert.Check(t, result.KDF.Memory == nil)
+			},
+		},
+		{
+			Name:   "Argon2id",
+			Body:   `{"email": "argon@example.com"}`,
+			Status: http.StatusOK,
+			FN: func(t *testing.T, result preloginResponse) {
+				assert.Equal(t, result.KDF.Algorithm, users.KDFArgon2id)
+				assert.Equal(t, result.KDF.Salt, "c2FsdHNhbHRzYWx0c2FsdA==")
+				assert.Equal(t, *result.KDF.Memory, 65536)
+				assert.Equal(t, *result.KDF.Parallelism, 4)
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		assert.RunHandlerTestCase(t, handler, "POST", auth.PreloginRoute, tc)
+	}
+}
+
+// Tests the validation of KDF parameters at registration
+func TestRegisterKDFValidation(t *testing.T) {
+	assert.Integration(t)
+	app := mocks.App(t)
+	handler := utils.AuthHandler(app)
+
+	tests := []assert.HandlerTestCase[failures]{
+		{
+			Name:   "Algorithm",
+			Body:   `{"email": "test@example.com", "password": "password", "kdf": {"algorithm": "md5", "salt": "c2FsdHNhbHRzYWx0c2FsdA==", "iterations": 1}}`,
+			Status: http.StatusUnprocessableEntity,
+			FN: func(t *testing.T, result failures) {
+				assert.Equal(t, result.Error["kdf"], "algorithm must be one of pbkdf2-sha256 or argon2id")
+			},
+		},
+		{
+			Name:   "Salt",
+			Body:   `{"email": "test@example.com", "password": "password", "kdf": {"algorithm": "pbkdf2-sha256", "salt": "c2FsdA==", "iterations": 600000}}`,
+			Status: http.StatusUnprocessableEntity,
+			FN: func(t *testing.T, result failures) {
+				assert.Equal(t, result.Error["kdf"], "salt must be at least 16 bytes, base64 encoded")
+			},
+		},
+		{
+			Name:   "Iterations",
+			Body:   `{"email": "test@example.com", "password": "password", "kdf": {"algorithm": "pbkdf2-sha256", "salt": "c2FsdHNhbHRzYWx0c2FsdA==", "iterations": 1000}}`,
+			Status: http.StatusUnprocessableEntity,
+			FN: func(t *testing.T, result failures) {
+				assert.Equal(t, result.Error["kdf"], "iterations must be at least 600000 for pbkdf2-sha256")
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		assert.RunHandlerTestCase(t, handler, "POST", auth.RegisterRoute, tc)
+	}
+}
+
+// Tests replacing the KDF parameters of a user
+func TestKDFUpdate(t *testing.T) {
+	assert.Integration(t)
+	app := mocks.App(t)
+	handler := utils.AuthHandler(app)
+
+	assert.Check(t, utils.RegisterUser(handler, registerSuccessBody))
+	token := utils.LoginUser(handler, registerSuccessBody)
+	assert.Check(t, len(token) > 0)
+
+	kdf := `"kdf": {"algorithm": "argon2id", "salt": "bmV3c2FsdG5ld3NhbHRuZXc=", "iterations": 2, "memory": 19456, "parallelism": 1}`
+
+	tests := []assert.HandlerTestCase[preloginResponse]{
+		{
+			Name:   "AuthRequired",
+			Body:   `{"password": "password", ` + kdf + `}`,
+			Status: http.StatusUnauthorized,
+		},
+		{
+			Name:   "Validation",
+			Body:   `{"password": "password", "kdf": {"algorithm": "argon2id", "salt": "bmV3c2FsdG5ld3NhbHRuZXc=", "iterations": 2}}`,
+			Auth:   token,
+			Status: http.StatusUnprocessableEntity,
+			FN: func(t *testing.T, result preloginResponse) {
+				assert.Equal(t, result.Error["kdf"], "memory must be at least 19456 KiB for argon2id")
+			},
+		},
+		{
+			Name:   "WrongPassword",
+			Body:   `{"password": "wrong-password", ` + kdf + `}`,
+			Auth:   token,
+			Status: http.StatusUnauthorized,
+		},
+		{
+			Name:   "Success",
+			Body:   `{"password": "password", ` + kdf + `}`,
+			Auth:   token,
+			Status: http.StatusOK,
+		},
+	}
+
+	for _, tc := range tests {
+		assert.RunHandlerTestCase(t, handler, "PUT", auth.KDFRoute, tc)
+	}
+
+	kdfAfter, err := app.Models.Users.GetKDF("test@example.com")
+	assert.Check(t, err == nil)
+	assert.Equal(t, kdfAfter.Algorithm, users.KDFArgon2id)
+	assert.Equal(t, kdfAfter.Salt, "bmV3c2FsdG5ld3NhbHRuZXc=")
+}
@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"pm4devs.strawhats/internal/assert"
+	"pm4devs.strawhats/internal/mocks"
+	"pm4devs.strawhats/internal/routes/auth"
+	"pm4devs.strawhats/internal/routes/utils"
+)
+
+// Helper token pair type
+type tokenPair struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+// Refreshes a token pair, expecting the given status
+func refresh(t *testing.T, handler http.HandlerFunc, name, refreshToken string, status int) tokenPair {
+	t.Helper()
+	var result tokenPair
+	assert.RunHandlerTestCase(t, handler, "POST", auth.RefreshRoute, assert.HandlerTestCase[tokenPair]{
+		Name:   name,
+		Body:   fmt.Sprintf(`{"refresh_token": %q}`, refreshToken),
+		Status: status,
+		FN: func(t *testing.T, r tokenPair) {
+			result = r
+		},
+	})
+	return result
+}
+
+// Checks whether an access token is accepted
+func authenticated(t *testing.T, handler http.HandlerFunc, name, token string, ok bool) {
+	t.Helper()
+	status := http.StatusOK
+	if !ok {
+		status = http.StatusUnauthorized
+	}
+	assert.RunHandlerTestCase(t, handler, "GET", auth.TwoFactorRoute, assert.HandlerTestCase[failure]{
+		Name:   name,
+		Auth:   token,
+		Status: status,
+	})
+}
+
+func TestRefresh(t *testing.T) {
+	assert.Integration(t)
+	app := mocks.App(t)
+	handler := utils.AuthHandler(app)
+
+	credentials := `{"email": "test@example.com", "password": "password"}`
+	assert.Check(t, utils.RegisterUser(handler, credentials))
+	assert.Check(t, utils.ActivateUser(handler, app))
+
+	// Login hands out both tokens
+	first := loginFirstStep(t, handler, credentials)
+	assert.Check(t, len(first.Token) > 0)
+	var session tokenPair
+	assert.RunHandlerTestCase(t, handler, "POST", auth.LoginRoute, assert.HandlerTestCase[tokenPair]{
+		Name:   "Login",
+		Body:   credentials,
+		Status: http.StatusOK,
+		FN: func(t *testing.T, result tokenPair) {
+			assert.Check(t, len(result.RefreshToken) > 0)
+			assert.Equal(t, result.ExpiresIn, int64(15*60))
+			session = result
+		},
+	})
+
+	// Validation
+	assert.RunHandlerTestCase(t, handler, "POST", auth.RefreshRoute, assert.HandlerTestCase[failures]{
+		Name:   "Refresh/Validation",
+		Body:   `{}`,
+		Status: http.StatusUnprocessableEntity,
+		FN: func(t *testing.T, result failures) {
+			assert.Equal(t, result.Error["refresh_token"], "must be provided")
+		},
+	})
+	refresh(t, handler, "Refresh/Unknown", "unknown", http.StatusUnauthorized)
+	refresh(t, handler, "Refresh/AccessToken", session.Token, http.StatusUnauthorized)
+
+	// Access tokens are signed
+	authenticated(t, handler, "AccessToken/Signed", session.Token, true)
+	authenticated(t, handler, "AccessToken/Tampered", session.Token[1:], false)
+	authenticated(t, handler, "AccessToken/Malformed", "unknown", false)
+
+	// Refreshing rotates both tokens
+	rotated := refresh(t, handler, "Refresh/Success", session.RefreshToken, http.StatusOK)
+	assert.Check(t, rotated.Token != session.Token)
+	assert.Check(t, rotated.RefreshToken != session.RefreshToken)
+	authenticated(t, handler, "Refresh/NewAccessToken", rotated.Token, true)
+
+	// Other logins are left alone when a refresh token is reused
+	authenticated(t, handler, "OtherLogin", first.Token, true)
+
+	// Reusing a refresh token revokes its family, its access tokens are
+	// accepted until they expire
+	refresh(t, handler, "Refresh/Reused", session.RefreshToken, http.StatusUnauthorized)
+	refresh(t, handler, "Reused/RefreshTokenRevoked", rotated.RefreshToken, http.StatusUnauthorized)
+	authenticated(t, handler, "Reused/OtherLogin", first.Token, true)
+
+	// Logging out revokes the refresh token
+	assert.RunHandlerTestCase(t, handler, "POST", auth.LoginRoute, assert.HandlerTestCase[tokenPair]{
+		Name:   "Login/Again",
+		Body:   credentials,
+		Status: http.StatusOK,
+		FN: func(t *testing.T, result tokenPair) {
+			session = result
+		},
+	})
+	assert.RunHandlerTestCase(t, handler, "POST", auth.LogoutRoute, assert.HandlerTestCase[struct{}]{
+		Name:   "Logout",
+		Auth:   session.Token,
+		Status: http.StatusNoContent,
+	})
+	refresh(t, handler, "Logout/RefreshTokenRevoked", session.RefreshToken, http.StatusUnauthorized)
+}
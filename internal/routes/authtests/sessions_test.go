@@ -0,0 +1,150 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"pm4devs.strawhats/internal/assert"
+	"pm4devs.strawhats/internal/mocks"
+	"pm4devs.strawhats/internal/models/permissions"
+	"pm4devs.strawhats/internal/models/tokens"
+	"pm4devs.strawhats/internal/routes/auth"
+	"pm4devs.strawhats/internal/routes/utils"
+)
+
+// Helper sessions type
+type sessions struct {
+	Data []tokens.Session `json:"data"`
+}
+
+// Helper revoked sessions type
+type revoked struct {
+	Revoked int64 `json:"revoked"`
+}
+
+// Lists the sessions of a user, returning them
+func listSessions(t *testing.T, handler http.HandlerFunc, name, token string, count int) []tokens.Session {
+	t.Helper()
+	var result []tokens.Session
+	assert.RunHandlerTestCase(t, handler, "GET", auth.SessionsRoute, assert.HandlerTestCase[sessions]{
+		Name:   name,
+		Auth:   token,
+		Status: http.StatusOK,
+		FN: func(t *testing.T, r sessions) {
+			assert.Equal(t, len(r.Data), count)
+			result = r.Data
+		},
+	})
+	return result
+}
+
+func TestSessions(t *testing.T) {
+	assert.Integration(t)
+	app := mocks.App(t)
+	handler := utils.AuthHandler(app)
+
+	credentials := `{"email": "test@example.com", "password": "password"}`
+	assert.Check(t, utils.RegisterUser(handler, credentials))
+	assert.Check(t, utils.ActivateUser(handler, app))
+	laptop := utils.LoginUser(handler, credentials)
+	phone := utils.LoginUser(handler, credentials)
+
+	// Require Authed User
+	assert.RunHandlerTestCase(t, handler, "GET", auth.SessionsRoute, assert.HandlerTestCase[failure]{
+		Name:   "List/AuthRequired",
+		Status: http.StatusUnauthorized,
+	})
+
+	// Each login is a session, recording its client
+	var other int64
+	for _, session := range listSessions(t, handler, "List", laptop, 2) {
+		assert.Equal(t, *session.IP, "192.0.2.1")
+		if !session.Current {
+			other = session.ID
+		}
+	}
+	assert.Check(t, other > 0)
+
+	// Uses are saved in the background, in a single write
+	saved, err := app.Models.Tokens.SaveUses()
+	assert.Check(t, err == nil)
+	assert.Equal(t, saved, int64(1))
+	saved, err = app.Models.Tokens.SaveUses()
+	assert.Check(t, err == nil)
+	assert.Equal(t, saved, int64(0))
+
+	// Revoke one
+	assert.RunHandlerTestCase(t, handler, "DELETE", auth.SessionsRoute, assert.HandlerTestCase[failures]{
+		Name:   "Delete/Validation",
+		Auth:   laptop,
+		Body:   `{}`,
+		Status: http.StatusUnprocessableEntity,
+		FN: func(t *testing.T, result failures) {
+			assert.Equal(t, result.Error["id"], "must be provided")
+		},
+	})
+	assert.RunHandlerTestCase(t, handler, "DELETE", auth.SessionsRoute, assert.HandlerTestCase[message]{
+		Name:   "Delete/Success",
+		Auth:   laptop,
+		Body:   fmt.Sprintf(`{"id": %d}`, other),
+		Status: http.StatusOK,
+	})
+	assert.RunHandlerTestCase(t, handler, "DELETE", auth.SessionsRoute, assert.HandlerTestCase[failure]{
+		Name:   "Delete/NotFound",
+		Auth:   laptop,
+		Body:   fmt.Sprintf(`{"id": %d}`, other),
+		Status: http.StatusNotFound,
+	})
+	assert.True(t, listSessions(t, handler, "Delete/List", laptop, 1)[0].Current)
+
+	// The access token of a revoked session is accepted until it expires
+	assert.False(t, listSessions(t, handler, "Delete/Revoked", phone, 1)[0].Current)
+
+	// Revoke all others
+	phone = utils.LoginUser(handler, credentials)
+	tablet := utils.LoginUser(handler, credentials)
+	assert.RunHandlerTestCase(t, handler, "DELETE", auth.SessionsOthersRoute, assert.HandlerTestCase[revoked]{
+		Name:   "Others/Success",
+		Auth:   laptop,
+		Status: http.StatusOK,
+		FN: func(t *testing.T, result revoked) {
+			assert.Equal(t, result.Revoked, int64(2))
+		},
+	})
+	assert.True(t, listSessions(t, handler, "Others/Current", laptop, 1)[0].Current)
+	listSessions(t, handler, "Others/TabletRevoked", tablet, 1)
+
+	// Admins revoke every session of a user
+	adminCredentials := `{"email": "admin@example.com", "password": "password"}`
+	assert.Check(t, utils.RegisterUser(handler, adminCredentials))
+	assert.Check(t, utils.ActivateUser(handler, app))
+	admin := utils.LoginUser(handler, adminCredentials)
+	body := `{"email": "test@example.com"}`
+	assert.RunHandlerTestCase(t, handler, "DELETE", auth.SessionsUserRoute, assert.HandlerTestCase[failure]{
+		Name:   "User/NotAdmin",
+		Auth:   admin,
+		Body:   body,
+		Status: http.StatusUnauthorized,
+	})
+	adminUser, err := app.Models.Users.GetByEmail("admin@example.com")
+	assert.Check(t, err == nil)
+	_, err = app.Models.Permissions.Insert(adminUser.ID, permissions.PermissionAdmin)
+	assert.Check(t, err == nil)
+	assert.RunHandlerTestCase(t, handler, "DELETE", auth.SessionsUserRoute, assert.HandlerTestCase[failure]{
+		Name:   "User/NotFound",
+		Auth:   admin,
+		Body:   `{"email": "missing@example.com"}`,
+		Status: http.StatusNotFound,
+	})
+	assert.RunHandlerTestCase(t, handler, "DELETE", auth.SessionsUserRoute, assert.HandlerTestCase[revoked]{
+		Name:   "User/Success",
+		Auth:   admin,
+		Body:   body,
+		Status: http.StatusOK,
+		FN: func(t *testing.T, result revoked) {
+			assert.Equal(t, result.Revoked, int64(1))
+		},
+	})
+	listSessions(t, handler, "User/Revoked", laptop, 0)
+}
@@ -0,0 +1,242 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"pm4devs.strawhats/internal/assert"
+	"pm4devs.strawhats/internal/mocks"
+	"pm4devs.strawhats/internal/models/permissions"
+	"pm4devs.strawhats/internal/routes/auth"
+	"pm4devs.strawhats/internal/routes/utils"
+)
+
+// Helper sign-in type
+type authorization struct {
+	AuthorizationURL string `json:"authorization_url"`
+}
+
+// Signs a user in with the issuer, returning the code and state to finish
+// with
+func ssoStart(t *testing.T, handler http.HandlerFunc, issuer *mocks.Issuer, claims map[string]any) string {
+	t.Helper()
+	var body string
+	assert.RunHandlerTestCase(t, handler, "POST", auth.SSORoute, assert.HandlerTestCase[authorization]{
+		Name:   "Start",
+		Status: http.StatusOK,
+		FN: func(t *testing.T, result authorization) {
+			code, state, err := issuer.Authorize(result.AuthorizationURL, claims)
+			assert.Check(t, err == nil)
+			body = fmt.Sprintf(`{"code": %q, "state": %q}`, code, state)
+		},
+	})
+	return body
+}
+
+// Signs a user in with the issuer, returning their access token
+func ssoLogin(t *testing.T, handler http.HandlerFunc, issuer *mocks.Issuer, name string, claims map[string]any) string {
+	t.Helper()
+	var token string
+	assert.RunHandlerTestCase(t, handler, "PUT", auth.SSORoute, assert.HandlerTestCase[tokenPair]{
+		Name:   name,
+		Body:   ssoStart(t, handler, issuer, claims),
+		Status: http.StatusOK,
+		FN: func(t *testing.T, result tokenPair) {
+			assert.Check(t, len(result.RefreshToken) > 0)
+			token = result.Token
+		},
+	})
+	return token
+}
+
+func TestSSO(t *testing.T) {
+	assert.Integration(t)
+	app := mocks.App(t)
+
+	// Not configured
+	handler := utils.AuthHandler(app)
+	assert.RunHandlerTestCase(t, handler, "POST", auth.SSORoute, assert.HandlerTestCase[failure]{
+		Name:   "NotConfigured",
+		Status: http.StatusNotFound,
+	})
+
+	issuer := mocks.NewIssuer(t)
+	mocks.SSO(app, issuer)
+	handler = utils.AuthHandler(app)
+	claims := map[string]any{
+		"sub":            "1234",
+		"email":          "sso@example.com",
+		"email_verified": true,
+		"name":           "Single Sign-On",
+		"groups":         []string{"backend", "frontend", "unknown"},
+	}
+
+	// Validation
+	assert.RunHandlerTestCase(t, handler, "PUT", auth.SSORoute, assert.HandlerTestCase[failures]{
+		Name:   "Finish/Validation",
+		Body:   `{}`,
+		Status: http.StatusUnprocessableEntity,
+		FN: func(t *testing.T, result failures) {
+			assert.Equal(t, result.Error["code"], "must be provided")
+			assert.Equal(t, result.Error["state"], "must be provided")
+		},
+	})
+	assert.RunHandlerTestCase(t, handler, "PUT", auth.SSORoute, assert.HandlerTestCase[failure]{
+		Name:   "Finish/UnknownState",
+		Body:   `{"code": "code", "state": "unknown"}`,
+		Status: http.StatusUnauthorized,
+	})
+
+	// Groups bound to the provider and named in the claim are joined, others
+	// are ignored
+	ownerCredentials := `{"email": "owner@example.com", "password": "password"}`
+	assert.Check(t, utils.RegisterUser(handler, ownerCredentials))
+	ownerToken := utils.LoginUser(handler, ownerCredentials)
+	owner, err := app.Models.Users.GetByEmail("owner@example.com")
+	assert.Check(t, err == nil)
+	backend, err := app.Models.Group.NewRecord("backend", owner.ID)
+	assert.Check(t, err == nil)
+	frontend, err := app.Models.Group.NewRecord("frontend", owner.ID)
+	assert.Check(t, err == nil)
+	ops, err := app.Models.Group.NewRecord("ops", owner.ID)
+	assert.Check(t, err == nil)
+
+	bind := `{"group_name": "backend", "managed": true}`
+	assert.RunHandlerTestCase(t, handler, "PUT", auth.SSOGroupRoute, assert.HandlerTestCase[failure]{
+		Name:   "Group/NotAdmin",
+		Auth:   ownerToken,
+		Body:   bind,
+		Status: http.StatusUnauthorized,
+	})
+	_, err = app.Models.Permissions.Insert(owner.ID, permissions.PermissionAdmin)
+	assert.Check(t, err == nil)
+	assert.RunHandlerTestCase(t, handler, "PUT", auth.SSOGroupRoute, assert.HandlerTestCase[failure]{
+		Name:   "Group/NotFound",
+		Auth:   ownerToken,
+		Body:   `{"group_name": "missing", "managed": true}`,
+		Status: http.StatusNotFound,
+	})
+	assert.RunHandlerTestCase(t, handler, "PUT", auth.SSOGroupRoute, assert.HandlerTestCase[message]{
+		Name:   "Group/Bound",
+		Auth:   ownerToken,
+		Body:   bind,
+		Status: http.StatusOK,
+	})
+
+	// First sign-in provisions the user
+	token := ssoLogin(t, handler, issuer, "Finish/Provisioned", claims)
+	authenticated(t, handler, "Finish/Authenticated", token, true)
+	user, err := app.Models.Users.GetByEmail("sso@example.com")
+	assert.Check(t, err == nil)
+	assert.True(t, user.Activated)
+	member, _ := app.Models.Group.IsUserInGroup(backend.ID, user.ID)
+	assert.True(t, member)
+	member, _ = app.Models.Group.IsUserInGroup(frontend.ID, user.ID)
+	assert.False(t, member)
+
+	// A state finishes a single sign-in
+	body := ssoStart(t, handler, issuer, claims)
+	assert.RunHandlerTestCase(t, handler, "PUT", auth.SSORoute, assert.HandlerTestCase[tokenPair]{
+		Name:   "Finish/Once",
+		Body:   body,
+		Status: http.StatusOK,
+	})
+	assert.RunHandlerTestCase(t, handler, "PUT", auth.SSORoute, assert.HandlerTestCase[failure]{
+		Name:   "Finish/Replayed",
+		Body:   body,
+		Status: http.StatusUnauthorized,
+	})
+
+	// Sign-ins approving a device are sent back to the verification page
+	assert.RunHandlerTestCase(t, handler, "POST", auth.SSORoute+"?device=true", assert.HandlerTestCase[authorization]{
+		Name:   "Device/Start",
+		Status: http.StatusOK,
+		FN: func(t *testing.T, result authorization) {
+			parsed, _ := url.Parse(result.AuthorizationURL)
+			assert.Equal(t, parsed.Query().Get("redirect_uri"), app.Config.Device.VerificationURL)
+			code, state, err := issuer.Authorize(result.AuthorizationURL, claims)
+			assert.Check(t, err == nil)
+			body = fmt.Sprintf(`{"code": %q, "state": %q}`, code, state)
+		},
+	})
+	assert.RunHandlerTestCase(t, handler, "PUT", auth.SSORoute, assert.HandlerTestCase[tokenPair]{
+		Name:   "Device/Finish",
+		Body:   body,
+		Status: http.StatusOK,
+	})
+
+	// Later sign-ins follow the claim, memberships added by hand stay
+	assert.Check(t, app.Models.Group.AddUser(ops.ID, user.ID) == nil)
+	claims["groups"] = []string{}
+	ssoLogin(t, handler, issuer, "Finish/Groups", claims)
+	member, _ = app.Models.Group.IsUserInGroup(backend.ID, user.ID)
+	assert.False(t, member)
+	member, _ = app.Models.Group.IsUserInGroup(ops.ID, user.ID)
+	assert.True(t, member)
+
+	// Groups requiring two-factor authentication apply to single sign-on too
+	assert.Check(t, app.Models.TwoFactor.SetGroupRequired("ops", true) == nil)
+	assert.RunHandlerTestCase(t, handler, "PUT", auth.SSORoute, assert.HandlerTestCase[login]{
+		Name:   "Finish/TwoFactorRequired",
+		Body:   ssoStart(t, handler, issuer, claims),
+		Status: http.StatusOK,
+		FN: func(t *testing.T, result login) {
+			assert.Equal(t, result.Token, "")
+			assert.Equal(t, result.TwoFactor, "enroll")
+			assert.Check(t, len(result.TwoFactorToken) > 0)
+		},
+	})
+	assert.Check(t, app.Models.TwoFactor.SetGroupRequired("ops", false) == nil)
+
+	// The user has no password
+	ssoCredentials := `{"email": "sso@example.com", "password": "password"}`
+	assert.RunHandlerTestCase(t, handler, "POST", auth.LoginRoute, assert.HandlerTestCase[failure]{
+		Name:   "Password/None",
+		Body:   ssoCredentials,
+		Status: http.StatusUnauthorized,
+	})
+
+	// Unverified emails are refused
+	assert.RunHandlerTestCase(t, handler, "PUT", auth.SSORoute, assert.HandlerTestCase[failure]{
+		Name:   "Finish/Unverified",
+		Body:   ssoStart(t, handler, issuer, map[string]any{"sub": "5678", "email": "other@example.com"}),
+		Status: http.StatusForbidden,
+	})
+
+	// Accounts registered with a password are linked by their email, once
+	// their owner verified it
+	credentials := `{"email": "test@example.com", "password": "password"}`
+	assert.Check(t, utils.RegisterUser(handler, credentials))
+	linkClaims := map[string]any{
+		"sub":            "9012",
+		"email":          "test@example.com",
+		"email_verified": true,
+	}
+	assert.RunHandlerTestCase(t, handler, "PUT", auth.SSORoute, assert.HandlerTestCase[failure]{
+		Name:   "Finish/Unverified/Account",
+		Body:   ssoStart(t, handler, issuer, linkClaims),
+		Status: http.StatusConflict,
+	})
+	assert.Check(t, utils.ActivateUser(handler, app))
+	ssoLogin(t, handler, issuer, "Finish/Linked", linkClaims)
+	linked, err := app.Models.Users.GetByEmail("test@example.com")
+	assert.Check(t, err == nil)
+	assert.True(t, linked.Activated)
+
+	// Password login can be disabled
+	app.Config.PasswordLogin = false
+	handler = utils.AuthHandler(app)
+	assert.RunHandlerTestCase(t, handler, "POST", auth.LoginRoute, assert.HandlerTestCase[failure]{
+		Name:   "PasswordLogin/Disabled",
+		Body:   credentials,
+		Status: http.StatusForbidden,
+	})
+	assert.RunHandlerTestCase(t, handler, "POST", auth.RegisterRoute, assert.HandlerTestCase[failure]{
+		Name:   "PasswordLogin/Register",
+		Body:   `{"email": "new@example.com", "password": "password"}`,
+		Status: http.StatusForbidden,
+	})
+	ssoLogin(t, handler, issuer, "PasswordLogin/SSO", claims)
+}
@@ -0,0 +1,304 @@
+package auth
+
+import (
+	"encoding/base32"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"pm4devs.strawhats/internal/assert"
+	"pm4devs.strawhats/internal/mocks"
+	"pm4devs.strawhats/internal/models/permissions"
+	"pm4devs.strawhats/internal/routes/auth"
+	"pm4devs.strawhats/internal/routes/utils"
+	"pm4devs.strawhats/internal/totp"
+)
+
+// Helper enrollment type
+type enrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// Helper confirmation type
+type confirmation struct {
+	Token         string   `json:"token"`
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// Helper login type
+type login struct {
+	Token          string   `json:"token"`
+	TwoFactor      string   `json:"two_factor"`
+	TwoFactorToken string   `json:"two_factor_token"`
+	Methods        []string `json:"methods"`
+}
+
+// Returns the code of an enrolled secret, steps after the current one
+func code(t *testing.T, secret string, steps int64) string {
+	t.Helper()
+	decoded, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	assert.Check(t, err == nil)
+	return totp.Code(decoded, totp.Step(time.Now())+steps)
+}
+
+// Logs in with the password only, returning the response
+func loginFirstStep(t *testing.T, handler http.HandlerFunc, credentials string) login {
+	t.Helper()
+	var result login
+	assert.RunHandlerTestCase(t, handler, "POST", auth.LoginRoute, assert.HandlerTestCase[login]{
+		Name:   "Login/FirstStep",
+		Body:   credentials,
+		Status: http.StatusOK,
+		FN: func(t *testing.T, r login) {
+			result = r
+		},
+	})
+	return result
+}
+
+func TestTwoFactor(t *testing.T) {
+	assert.Integration(t)
+	app := mocks.App(t)
+	handler := utils.AuthHandler(app)
+
+	credentials := `{"email": "test@example.com", "password": "password"}`
+	assert.Check(t, utils.RegisterUser(handler, credentials))
+	assert.Check(t, utils.ActivateUser(handler, app))
+	token := utils.LoginUser(handler, credentials)
+	assert.Check(t, len(token) > 0)
+
+	// Enroll
+	var secret string
+	assert.RunHandlerTestCase(t, handler, "POST", auth.TwoFactorRoute, assert.HandlerTestCase[enrollment]{
+		Name:   "Enroll/AuthRequired",
+		Body:   `{}`,
+		Status: http.StatusUnauthorized,
+	})
+	assert.RunHandlerTestCase(t, handler, "POST", auth.TwoFactorRoute, assert.HandlerTestCase[enrollment]{
+		Name:   "Enroll/Success",
+		Auth:   token,
+		Body:   `{}`,
+		Status: http.StatusCreated,
+		FN: func(t *testing.T, result enrollment) {
+			assert.Equal(t, len(result.Secret), 32)
+			assert.Check(t, strings.HasPrefix(result.URI, "otpauth://totp/pm4devs:test@example.com?"))
+			secret = result.Secret
+		},
+	})
+
+	// Not required to log in until confirmed
+	assert.Check(t, len(utils.LoginUser(handler, credentials)) > 0)
+
+	// Confirm
+	var recoveryCodes []string
+	assert.RunHandlerTestCase(t, handler, "PUT", auth.TwoFactorRoute, assert.HandlerTestCase[failure]{
+		Name:   "Confirm/WrongCode",
+		Auth:   token,
+		Body:   fmt.Sprintf(`{"code": %q}`, code(t, secret, 5)),
+		Status: http.StatusUnauthorized,
+	})
+	assert.RunHandlerTestCase(t, handler, "PUT", auth.TwoFactorRoute, assert.HandlerTestCase[confirmation]{
+		Name:   "Confirm/Success",
+		Auth:   token,
+		Body:   fmt.Sprintf(`{"code": %q}`, code(t, secret, 0)),
+		Status: http.StatusOK,
+		FN: func(t *testing.T, result confirmation) {
+			assert.Equal(t, len(result.RecoveryCodes), 10)
+			assert.Equal(t, result.Token, "")
+			recoveryCodes = result.RecoveryCodes
+		},
+	})
+	assert.RunHandlerTestCase(t, handler, "POST", auth.TwoFactorRoute, assert.HandlerTestCase[failure]{
+		Name:   "Enroll/AlreadyEnabled",
+		Auth:   token,
+		Body:   `{}`,
+		Status: http.StatusConflict,
+	})
+
+	// Logging in takes two steps
+	first := loginFirstStep(t, handler, credentials)
+	assert.Equal(t, first.Token, "")
+	assert.Equal(t, first.TwoFactor, "verify")
+	assert.Check(t, len(first.TwoFactorToken) > 0)
+
+	// The intermediate token is no access token
+	assert.RunHandlerTestCase(t, handler, "GET", auth.TwoFactorRoute, assert.HandlerTestCase[failure]{
+		Name:   "TwoFactorToken/NotAccessToken",
+		Auth:   first.TwoFactorToken,
+		Status: http.StatusUnauthorized,
+	})
+
+	// A wrong code ends the login attempt
+	wrong := fmt.Sprintf(`{"token": %q, "code": %q}`, first.TwoFactorToken, code(t, secret, 5))
+	assert.RunHandlerTestCase(t, handler, "POST", auth.TwoFactorLoginRoute, assert.HandlerTestCase[failure]{
+		Name:   "SecondStep/WrongCode",
+		Body:   wrong,
+		Status: http.StatusUnauthorized,
+	})
+	assert.RunHandlerTestCase(t, handler, "POST", auth.TwoFactorLoginRoute, assert.HandlerTestCase[failure]{
+		Name:   "SecondStep/TokenUsed",
+		Body:   fmt.Sprintf(`{"token": %q, "recovery_code": %q}`, first.TwoFactorToken, recoveryCodes[0]),
+		Status: http.StatusUnauthorized,
+	})
+
+	// Recovery codes are single use
+	first = loginFirstStep(t, handler, credentials)
+	assert.RunHandlerTestCase(t, handler, "POST", auth.TwoFactorLoginRoute, assert.HandlerTestCase[login]{
+		Name:   "SecondStep/RecoveryCode",
+		Body:   fmt.Sprintf(`{"token": %q, "recovery_code": %q}`, first.TwoFactorToken, recoveryCodes[0]),
+		Status: http.StatusOK,
+		FN: func(t *testing.T, result login) {
+			assert.Check(t, len(result.Token) > 0)
+		},
+	})
+	first = loginFirstStep(t, handler, credentials)
+	assert.RunHandlerTestCase(t, handler, "POST", auth.TwoFactorLoginRoute, assert.HandlerTestCase[failure]{
+		Name:   "SecondStep/RecoveryCodeUsed",
+		Body:   fmt.Sprintf(`{"token": %q, "recovery_code": %q}`, first.TwoFactorToken, recoveryCodes[0]),
+		Status: http.StatusUnauthorized,
+	})
+
+	// Codes cannot be replayed
+	regenerate := fmt.Sprintf(`{"code": %q}`, code(t, secret, 1))
+	assert.RunHandlerTestCase(t, handler, "POST", auth.TwoFactorRecoveryRoute, assert.HandlerTestCase[confirmation]{
+		Name:   "RecoveryCodes/Success",
+		Auth:   token,
+		Body:   regenerate,
+		Status: http.StatusOK,
+		FN: func(t *testing.T, result confirmation) {
+			assert.Equal(t, len(result.RecoveryCodes), 10)
+			recoveryCodes = result.RecoveryCodes
+		},
+	})
+	assert.RunHandlerTestCase(t, handler, "POST", auth.TwoFactorRecoveryRoute, assert.HandlerTestCase[failure]{
+		Name:   "RecoveryCodes/Replay",
+		Auth:   token,
+		Body:   regenerate,
+		Status: http.StatusUnauthorized,
+	})
+
+	// Disable
+	assert.RunHandlerTestCase(t, handler, "DELETE", auth.TwoFactorRoute, assert.HandlerTestCase[failure]{
+		Name:   "Disable/WrongPassword",
+		Auth:   token,
+		Body:   fmt.Sprintf(`{"password": "pa55word", "recovery_code": %q}`, recoveryCodes[0]),
+		Status: http.StatusUnauthorized,
+	})
+	assert.RunHandlerTestCase(t, handler, "DELETE", auth.TwoFactorRoute, assert.HandlerTestCase[failures]{
+		Name:   "Disable/CodeRequired",
+		Auth:   token,
+		Body:   `{"password": "password"}`,
+		Status: http.StatusUnprocessableEntity,
+		FN: func(t *testing.T, result failures) {
+			assert.Equal(t, result.Error["code"], "must be provided, or a recovery_code")
+		},
+	})
+	assert.RunHandlerTestCase(t, handler, "DELETE", auth.TwoFactorRoute, assert.HandlerTestCase[message]{
+		Name:   "Disable/Success",
+		Auth:   token,
+		Body:   fmt.Sprintf(`{"password": "password", "recovery_code": %q}`, recoveryCodes[0]),
+		Status: http.StatusOK,
+	})
+	assert.Check(t, len(utils.LoginUser(handler, credentials)) > 0)
+}
+
+func TestTwoFactorRequired(t *testing.T) {
+	assert.Integration(t)
+	app := mocks.App(t)
+	handler := utils.AuthHandler(app)
+
+	credentials := `{"email": "admin@example.com", "password": "password"}`
+	assert.Check(t, utils.RegisterUser(handler, credentials))
+	assert.Check(t, utils.ActivateUser(handler, app))
+	token := utils.LoginUser(handler, credentials)
+	assert.Check(t, len(token) > 0)
+
+	// Seed – a group created by the user
+	admin, err := app.Models.Users.GetByEmail("admin@example.com")
+	assert.Check(t, err == nil)
+	_, err = app.Models.Group.NewRecord("Operations", admin.ID)
+	assert.Check(t, err == nil)
+
+	// Only admins require two-factor authentication
+	body := `{"group_name": "Operations", "required": true}`
+	assert.RunHandlerTestCase(t, handler, "PUT", auth.TwoFactorGroupRoute, assert.HandlerTestCase[failure]{
+		Name:   "Group/NotAdmin",
+		Auth:   token,
+		Body:   body,
+		Status: http.StatusUnauthorized,
+	})
+	_, err = app.Models.Permissions.Insert(admin.ID, permissions.PermissionAdmin)
+	assert.Check(t, err == nil)
+	assert.RunHandlerTestCase(t, handler, "PUT", auth.TwoFactorGroupRoute, assert.HandlerTestCase[failure]{
+		Name:   "Group/NotFound",
+		Auth:   token,
+		Body:   `{"group_name": "Missing", "required": true}`,
+		Status: http.StatusNotFound,
+	})
+	assert.RunHandlerTestCase(t, handler, "PUT", auth.TwoFactorGroupRoute, assert.HandlerTestCase[message]{
+		Name:   "Group/Success",
+		Auth:   token,
+		Body:   body,
+		Status: http.StatusOK,
+	})
+
+	// Members without two-factor authentication are logged out once their
+	// access tokens expire
+	listSessions(t, handler, "Group/LoggedOut", token, 0)
+
+	// And must enroll to log in
+	first := loginFirstStep(t, handler, credentials)
+	assert.Equal(t, first.Token, "")
+	assert.Equal(t, first.TwoFactor, "enroll")
+
+	var secret string
+	assert.RunHandlerTestCase(t, handler, "POST", auth.TwoFactorRoute, assert.HandlerTestCase[enrollment]{
+		Name:   "Enroll/WithToken",
+		Body:   fmt.Sprintf(`{"token": %q}`, first.TwoFactorToken),
+		Status: http.StatusCreated,
+		FN: func(t *testing.T, result enrollment) {
+			secret = result.Secret
+		},
+	})
+	confirm := fmt.Sprintf(`{"token": %q, "code": %q}`, first.TwoFactorToken, code(t, secret, 0))
+	assert.RunHandlerTestCase(t, handler, "PUT", auth.TwoFactorRoute, assert.HandlerTestCase[confirmation]{
+		Name:   "Confirm/WithToken",
+		Body:   confirm,
+		Status: http.StatusOK,
+		FN: func(t *testing.T, result confirmation) {
+			assert.Check(t, len(result.Token) > 0)
+			token = result.Token
+		},
+	})
+	assert.RunHandlerTestCase(t, handler, "PUT", auth.TwoFactorRoute, assert.HandlerTestCase[failure]{
+		Name:   "Confirm/TokenUsed",
+		Body:   confirm,
+		Status: http.StatusUnauthorized,
+	})
+
+	// Which cannot be disabled while required
+	type status struct {
+		Data struct {
+			Enabled  bool `json:"enabled"`
+			Required bool `json:"required"`
+		} `json:"data"`
+	}
+	assert.RunHandlerTestCase(t, handler, "GET", auth.TwoFactorRoute, assert.HandlerTestCase[status]{
+		Name:   "Status",
+		Auth:   token,
+		Status: http.StatusOK,
+		FN: func(t *testing.T, result status) {
+			assert.True(t, result.Data.Enabled)
+			assert.True(t, result.Data.Required)
+		},
+	})
+	assert.RunHandlerTestCase(t, handler, "DELETE", auth.TwoFactorRoute, assert.HandlerTestCase[failure]{
+		Name:   "Disable/Required",
+		Auth:   token,
+		Body:   fmt.Sprintf(`{"password": "password", "code": %q}`, code(t, secret, 1)),
+		Status: http.StatusForbidden,
+	})
+}
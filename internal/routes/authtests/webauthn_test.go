@@ -0,0 +1,205 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"pm4devs.strawhats/internal/assert"
+	"pm4devs.strawhats/internal/mocks"
+	"pm4devs.strawhats/internal/models/passkeys"
+	"pm4devs.strawhats/internal/routes/auth"
+	"pm4devs.strawhats/internal/routes/utils"
+	"pm4devs.strawhats/internal/webauthn"
+	"pm4devs.strawhats/internal/xerrors"
+)
+
+// Helper creation options type
+type creationOptions struct {
+	Options webauthn.CreationOptions `json:"options"`
+}
+
+// Helper request options type
+type requestOptions struct {
+	Options webauthn.RequestOptions `json:"options"`
+}
+
+// Helper registration type
+type registration struct {
+	Data          passkeys.CredentialRecord `json:"data"`
+	RecoveryCodes []string                  `json:"recovery_codes"`
+}
+
+// Begins a WebAuthn login, returning the challenge
+func beginWebAuthnLogin(t *testing.T, handler http.HandlerFunc, body string, allowed int) []byte {
+	t.Helper()
+	var challenge []byte
+	assert.RunHandlerTestCase(t, handler, "POST", auth.WebAuthnLoginRoute, assert.HandlerTestCase[requestOptions]{
+		Name:   "Login/Begin",
+		Body:   body,
+		Status: http.StatusOK,
+		FN: func(t *testing.T, result requestOptions) {
+			assert.Equal(t, len(result.Options.AllowCredentials), allowed)
+			challenge = result.Options.Challenge
+		},
+	})
+	return challenge
+}
+
+func TestWebAuthn(t *testing.T) {
+	assert.Integration(t)
+	app := mocks.App(t)
+	handler := utils.AuthHandler(app)
+
+	credentials := `{"email": "test@example.com", "password": "password"}`
+	assert.Check(t, utils.RegisterUser(handler, credentials))
+	assert.Check(t, utils.ActivateUser(handler, app))
+	token := utils.LoginUser(handler, credentials)
+	assert.Check(t, len(token) > 0)
+
+	// Register
+	var options webauthn.CreationOptions
+	assert.RunHandlerTestCase(t, handler, "POST", auth.WebAuthnRegisterRoute, assert.HandlerTestCase[failure]{
+		Name:   "Register/AuthRequired",
+		Body:   `{}`,
+		Status: http.StatusUnauthorized,
+	})
+	assert.RunHandlerTestCase(t, handler, "POST", auth.WebAuthnRegisterRoute, assert.HandlerTestCase[creationOptions]{
+		Name:   "Register/Begin",
+		Auth:   token,
+		Body:   `{}`,
+		Status: http.StatusOK,
+		FN: func(t *testing.T, result creationOptions) {
+			assert.Equal(t, result.Options.RP.ID, "localhost")
+			assert.Equal(t, result.Options.User.Name, "test@example.com")
+			assert.Equal(t, len(result.Options.Challenge), webauthn.ChallengeSize)
+			options = result.Options
+		},
+	})
+
+	authenticator := mocks.NewAuthenticator("localhost", "http://localhost:4000")
+	register := fmt.Sprintf(`{"name": "Security key", "credential": %s}`,
+		authenticator.Create(options.Challenge, options.User.ID))
+	assert.RunHandlerTestCase(t, handler, "PUT", auth.WebAuthnRegisterRoute, assert.HandlerTestCase[registration]{
+		Name:   "Register/Success",
+		Auth:   token,
+		Body:   register,
+		Status: http.StatusCreated,
+		FN: func(t *testing.T, result registration) {
+			assert.Equal(t, result.Data.Name, "Security key")
+			assert.Equal(t, result.Data.AttestationFormat, "none")
+			assert.Equal(t, len(result.RecoveryCodes), 10)
+		},
+	})
+	assert.RunHandlerTestCase(t, handler, "PUT", auth.WebAuthnRegisterRoute, assert.HandlerTestCase[failure]{
+		Name:   "Register/ChallengeUsed",
+		Auth:   token,
+		Body:   register,
+		Status: http.StatusUnauthorized,
+	})
+
+	// Registered credentials are excluded, and other origins are rejected
+	assert.RunHandlerTestCase(t, handler, "POST", auth.WebAuthnRegisterRoute, assert.HandlerTestCase[creationOptions]{
+		Name:   "Register/Excluded",
+		Auth:   token,
+		Body:   `{}`,
+		Status: http.StatusOK,
+		FN: func(t *testing.T, result creationOptions) {
+			assert.Equal(t, len(result.Options.ExcludeCredentials), 1)
+			options = result.Options
+		},
+	})
+	phishing := mocks.NewAuthenticator("localhost", "http://example.com")
+	assert.RunHandlerTestCase(t, handler, "PUT", auth.WebAuthnRegisterRoute, assert.HandlerTestCase[failure]{
+		Name:   "Register/WrongOrigin",
+		Auth:   token,
+		Body:   fmt.Sprintf(`{"name": "Phishing", "credential": %s}`, phishing.Create(options.Challenge, options.User.ID)),
+		Status: http.StatusUnauthorized,
+	})
+
+	var credentialID int64
+	type list struct {
+		Data []passkeys.CredentialRecord `json:"data"`
+	}
+	assert.RunHandlerTestCase(t, handler, "GET", auth.WebAuthnCredentialsRoute, assert.HandlerTestCase[list]{
+		Name:   "Credentials",
+		Auth:   token,
+		Status: http.StatusOK,
+		FN: func(t *testing.T, result list) {
+			assert.Equal(t, len(result.Data), 1)
+			credentialID = result.Data[0].ID
+		},
+	})
+
+	// The security key is a second factor
+	first := loginFirstStep(t, handler, credentials)
+	assert.Equal(t, first.TwoFactor, "verify")
+	assert.Equal(t, fmt.Sprint(first.Methods), "[webauthn recovery_code]")
+
+	challenge := beginWebAuthnLogin(t, handler, fmt.Sprintf(`{"token": %q}`, first.TwoFactorToken), 1)
+	assert.RunHandlerTestCase(t, handler, "PUT", auth.WebAuthnLoginRoute, assert.HandlerTestCase[login]{
+		Name:   "SecondFactor/Success",
+		Body:   fmt.Sprintf(`{"token": %q, "credential": %s}`, first.TwoFactorToken, authenticator.Get(challenge)),
+		Status: http.StatusOK,
+		FN: func(t *testing.T, result login) {
+			assert.Check(t, len(result.Token) > 0)
+		},
+	})
+
+	// And a passkey, verifying its user
+	challenge = beginWebAuthnLogin(t, handler, `{}`, 0)
+	passkey := fmt.Sprintf(`{"credential": %s}`, authenticator.Get(challenge))
+	assert.RunHandlerTestCase(t, handler, "PUT", auth.WebAuthnLoginRoute, assert.HandlerTestCase[login]{
+		Name:   "Passkey/Success",
+		Body:   passkey,
+		Status: http.StatusOK,
+		FN: func(t *testing.T, result login) {
+			assert.Check(t, len(result.Token) > 0)
+		},
+	})
+	assert.RunHandlerTestCase(t, handler, "PUT", auth.WebAuthnLoginRoute, assert.HandlerTestCase[failure]{
+		Name:   "Passkey/ChallengeUsed",
+		Body:   passkey,
+		Status: http.StatusUnauthorized,
+	})
+
+	authenticator.UserVerified = false
+	challenge = beginWebAuthnLogin(t, handler, `{"email": "test@example.com"}`, 1)
+	assert.RunHandlerTestCase(t, handler, "PUT", auth.WebAuthnLoginRoute, assert.HandlerTestCase[failure]{
+		Name:   "Passkey/UserNotVerified",
+		Body:   fmt.Sprintf(`{"credential": %s}`, authenticator.Get(challenge)),
+		Status: http.StatusUnauthorized,
+	})
+
+	// A cloned authenticator is caught by its sign counter
+	authenticator.UserVerified = true
+	authenticator.SignCount = 0
+	challenge = beginWebAuthnLogin(t, handler, `{"email": "unknown@example.com"}`, 0)
+	assert.RunHandlerTestCase(t, handler, "PUT", auth.WebAuthnLoginRoute, assert.HandlerTestCase[failure]{
+		Name:   "Passkey/Cloned",
+		Body:   fmt.Sprintf(`{"credential": %s}`, authenticator.Get(challenge)),
+		Status: http.StatusUnauthorized,
+	})
+
+	// Even when both assertions were verified against the same stored counter
+	stored, err := app.Models.Passkeys.GetByCredentialID(authenticator.CredentialID)
+	assert.Check(t, err == nil)
+	err = app.Models.Passkeys.UpdateSignCount(stored.ID, stored.SignCount)
+	assert.Check(t, err != nil && err.Matches(xerrors.ErrEditConflict))
+	assert.Check(t, app.Models.Passkeys.UpdateSignCount(stored.ID, stored.SignCount+1) == nil)
+
+	// Removing the security key disables two-factor authentication
+	assert.RunHandlerTestCase(t, handler, "DELETE", auth.WebAuthnCredentialsRoute, assert.HandlerTestCase[failure]{
+		Name:   "Delete/WrongPassword",
+		Auth:   token,
+		Body:   fmt.Sprintf(`{"id": %d, "password": "wrong"}`, credentialID),
+		Status: http.StatusUnauthorized,
+	})
+	assert.RunHandlerTestCase(t, handler, "DELETE", auth.WebAuthnCredentialsRoute, assert.HandlerTestCase[message]{
+		Name:   "Delete/Success",
+		Auth:   token,
+		Body:   fmt.Sprintf(`{"id": %d, "password": "password"}`, credentialID),
+		Status: http.StatusOK,
+	})
+	assert.Check(t, len(utils.LoginUser(handler, credentials)) > 0)
+}
@@ -0,0 +1,154 @@
+package emergency
+
+import (
+	"net/http"
+
+	"pm4devs.strawhats/internal/models/core"
+	"pm4devs.strawhats/internal/models/emergency"
+	"pm4devs.strawhats/internal/models/secrets"
+	"pm4devs.strawhats/internal/models/users"
+	"pm4devs.strawhats/internal/rest"
+	"pm4devs.strawhats/internal/routes/middleware"
+	"pm4devs.strawhats/internal/validator"
+	"pm4devs.strawhats/internal/xerrors"
+)
+
+// ============================================================================
+// Vault
+// ============================================================================
+
+const VaultRoute = "/v1/emergency/vault"
+
+// Lists the secrets of a grantor to a trusted contact that was granted access
+//
+// The content keys are wrapped for the grantor, the contact unwraps them with
+// the private key wrapped for it in the contact record.
+func (app *Emergency) vault(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		app.rest.MethodNotAllowed(w, r, "GET")
+		return
+	}
+	contactID, err := readContactID(r, "emergency.vault")
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	page, err := core.ParsePage(r.URL.Query(), "emergency.vault")
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	user := middleware.ContextGetUser(r)
+	contact, err := app.grantedContact(contactID, user.ID, "emergency.vault")
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	grantorSecrets, next, err := app.secrets.GetByUserID(contact.GrantorID, secrets.SecretFilter{}, page)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	app.rest.WritePage(w, "emergency.vault", grantorSecrets, page.Fields, next)
+}
+
+// ============================================================================
+// Takeover
+// ============================================================================
+
+const TakeoverRoute = "/v1/emergency/takeover"
+
+// Takes over the account of a grantor as a trusted contact with takeover
+// access by setting a new password
+//
+// Clients re-encrypt the private key of the grantor for the new password and
+// send it along with its KDF parameters, the key pair is required if the
+// grantor has one. Every change is made at once: the sessions of the grantor
+// are ended and the contact must request access again afterwards.
+func (app *Emergency) takeover(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.rest.MethodNotAllowed(w, r, "POST")
+		return
+	}
+	var input struct {
+		ContactID           int64      `json:"contact_id"`
+		Password            string     `json:"password"`
+		KDF                 *users.KDF `json:"kdf"`
+		PublicKey           string     `json:"public_key"`
+		EncryptedPrivateKey string     `json:"encrypted_private_key"`
+	}
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, "emergency.takeover", &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	// Validate parameters
+	v := validator.New()
+	v.Check(input.ContactID > 0, "contact_id", "must be provided")
+	v.Check(len(input.Password) >= 8, "password", "must be at least 8 characters")
+	if input.KDF != nil {
+		users.ValidateKDF(v, input.KDF, "kdf")
+	}
+	v.Check((input.PublicKey == "") == (input.EncryptedPrivateKey == ""), "encrypted_private_key",
+		"must be provided along with public_key")
+	if err := v.Valid("emergency.takeover"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	user := middleware.ContextGetUser(r)
+	contact, err := app.grantedContact(input.ContactID, user.ID, "emergency.takeover")
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	if contact.Access != emergency.AccessTakeover {
+		app.rest.Error(w, xerrors.ClientError(http.StatusForbidden,
+			"Your access is view only", "emergency.takeover", xerrors.ErrUnauthorized))
+		return
+	}
+
+	grantor, err := app.users.GetByEmail(contact.GrantorEmail)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	// The private key of the grantor is encrypted with their password, it
+	// must be encrypted again for the new one
+	if input.PublicKey == "" {
+		_, err := app.keys.GetActive(grantor.ID)
+		if err == nil {
+			v.AddError("public_key", "must be provided, the private key of the account is encrypted with its password")
+			app.rest.Error(w, v.Valid("emergency.takeover"))
+			return
+		}
+		if !err.Matches(xerrors.ErrNotFound) {
+			app.rest.Error(w, err)
+			return
+		}
+	}
+
+	// Set the password, KDF and key pair of the grantor, end their sessions and
+	// the granted access at once
+	if err := grantor.SetPassword(input.Password); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	err = app.emergency.Takeover(emergency.Takeover{
+		ContactID:           contact.ID,
+		GranteeID:           user.ID,
+		Grantor:             grantor,
+		KDF:                 input.KDF,
+		PublicKey:           input.PublicKey,
+		EncryptedPrivateKey: input.EncryptedPrivateKey,
+	})
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	app.rest.WriteJSON(w, "emergency.takeover", http.StatusOK, rest.Envelope{
+		"message": "Success! The password of the account was changed.",
+	})
+}
@@ -0,0 +1,122 @@
+package emergency
+
+import (
+	"net/http"
+
+	"pm4devs.strawhats/internal/models/emergency"
+	"pm4devs.strawhats/internal/rest"
+	"pm4devs.strawhats/internal/routes/middleware"
+	"pm4devs.strawhats/internal/validator"
+	"pm4devs.strawhats/internal/xerrors"
+)
+
+const ContactsRoute = "/v1/emergency/contacts"
+
+func (app *Emergency) handleContacts(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		app.getContacts(w, r)
+	case http.MethodPost:
+		app.addContact(w, r)
+	case http.MethodDelete:
+		app.deleteContact(w, r)
+	default:
+		app.rest.MethodNotAllowed(w, r, "GET, POST, DELETE")
+	}
+}
+
+// Lists the trusted contacts of the user along with the users who trust them
+func (app *Emergency) getContacts(w http.ResponseWriter, r *http.Request) {
+	user := middleware.ContextGetUser(r)
+	contacts, err := app.emergency.GetByUserID(user.ID)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	app.rest.WriteJSON(w, "emergency.getContacts", http.StatusOK, rest.Envelope{
+		"message": "Success!",
+		"data":    contacts,
+	})
+}
+
+// Nominates a trusted contact of the user
+//
+// The wrapped key is the private key of the user wrapped with the active
+// public key of the contact. It is only released once access is granted.
+func (app *Emergency) addContact(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email      string           `json:"email"`
+		Access     emergency.Access `json:"access"`
+		WaitDays   *int             `json:"wait_days"`
+		WrappedKey string           `json:"wrapped_key"`
+	}
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, "emergency.addContact", &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	waitDays := emergency.DefaultWaitDays
+	if input.WaitDays != nil {
+		waitDays = *input.WaitDays
+	}
+	// Validate parameters
+	user := middleware.ContextGetUser(r)
+	v := validator.New()
+	v.Check(len(input.Email) > 0, "email", "must be provided")
+	v.Check(input.Email != user.Email, "email", "must not be your own")
+	v.Check(input.Access.Valid(), "access", "must be one of view or takeover")
+	v.Check(waitDays > 0 && waitDays <= emergency.MaxWaitDays, "wait_days", "must be between 1 and 90")
+	v.Check(len(input.WrappedKey) > 0, "wrapped_key", "must be provided")
+	if err := v.Valid("emergency.addContact"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	// The contact needs a key pair to unwrap the private key of the user
+	key, err := app.keys.GetByEmail(input.Email)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	contact, err := app.emergency.NewRecord(user.ID, key.UserID, input.Access, waitDays,
+		input.WrappedKey, key.Fingerprint)
+	if err != nil {
+		err.If(xerrors.ErrUniqueViolation, func(err *xerrors.AppError) {
+			err.Data = "This user is already one of your trusted contacts"
+		})
+		app.rest.Error(w, err)
+		return
+	}
+	app.rest.WriteJSON(w, "emergency.addContact", http.StatusCreated, rest.Envelope{
+		"message": "Success!",
+		"data":    contact,
+	})
+}
+
+// Removes a trusted contact, as either the grantor or the contact
+func (app *Emergency) deleteContact(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		ContactID int64 `json:"contact_id"`
+	}
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, "emergency.deleteContact", &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	// Validate parameters
+	v := validator.New()
+	v.Check(input.ContactID > 0, "contact_id", "must be provided")
+	if err := v.Valid("emergency.deleteContact"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	user := middleware.ContextGetUser(r)
+	if err := app.emergency.Delete(input.ContactID, user.ID); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	app.rest.WriteJSON(w, "emergency.deleteContact", http.StatusOK, rest.Envelope{
+		"message": "Success!",
+	})
+}
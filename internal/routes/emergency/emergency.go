@@ -0,0 +1,87 @@
+package emergency
+
+import (
+	"net/http"
+	"strconv"
+
+	"pm4devs.strawhats/internal/app"
+	"pm4devs.strawhats/internal/mailer"
+	"pm4devs.strawhats/internal/models/emergency"
+	"pm4devs.strawhats/internal/models/keys"
+	"pm4devs.strawhats/internal/models/secrets"
+	"pm4devs.strawhats/internal/models/tokens"
+	"pm4devs.strawhats/internal/models/users"
+	"pm4devs.strawhats/internal/rest"
+	"pm4devs.strawhats/internal/routes/middleware"
+	"pm4devs.strawhats/internal/validator"
+	"pm4devs.strawhats/internal/xerrors"
+	"pm4devs.strawhats/internal/xlogger"
+)
+
+// Encapsulates the Application dependencies required by routes
+type Emergency struct {
+	bg        app.Backgrounder
+	logger    xlogger.Logger
+	mailer    mailer.Mailer
+	rest      *rest.Rest
+	emergency emergency.EmergencyRepository
+	keys      keys.KeysRepository
+	secrets   secrets.SecretsRepository
+	tokens    tokens.TokensRepository
+	users     users.UsersRepository
+}
+
+func New(app *app.App) *Emergency {
+	return &Emergency{
+		bg:        app.BG,
+		logger:    app.Logger,
+		mailer:    app.Mailer,
+		rest:      app.Rest,
+		emergency: app.Models.Emergency,
+		keys:      app.Models.Keys,
+		secrets:   app.Models.Secrets,
+		tokens:    app.Models.Tokens,
+		users:     app.Models.Users,
+	}
+}
+
+func (e *Emergency) Route(mux *http.ServeMux, mw *middleware.Middleware) {
+	mux.HandleFunc(ContactsRoute, mw.Authenticated(e.handleContacts))
+	mux.HandleFunc(RequestRoute, mw.Authenticated(e.handleRequest))
+	mux.HandleFunc(VetoRoute, e.handleVeto)
+	mux.HandleFunc(VaultRoute, mw.Authenticated(e.vault))
+	mux.HandleFunc(TakeoverRoute, mw.Authenticated(e.takeover))
+}
+
+// ============================================================================
+// Helpers
+// ============================================================================
+
+// Gets a contact the user was granted access through, as the trusted contact
+func (app *Emergency) grantedContact(contactID, userID int64, op string) (*emergency.ContactRecord, *xerrors.AppError) {
+	contact, err := app.emergency.GetByID(contactID)
+	if err != nil {
+		return nil, err
+	}
+	if contact.GranteeID != userID {
+		return nil, xerrors.ClientError(http.StatusNotFound,
+			"No emergency contact found with id: "+strconv.FormatInt(contactID, 10), op, xerrors.ErrNotFound)
+	}
+	if contact.Status != emergency.StatusGranted {
+		return nil, xerrors.ClientError(http.StatusForbidden,
+			"Access to the vault was not granted yet", op, xerrors.ErrUnauthorized)
+	}
+	return contact, nil
+}
+
+// Reads the contact_id query parameter
+func readContactID(r *http.Request, op string) (int64, *xerrors.AppError) {
+	id, err := strconv.ParseInt(r.URL.Query().Get("contact_id"), 10, 64)
+
+	v := validator.New()
+	v.Check(err == nil && id > 0, "contact_id", "must be a positive integer")
+	if err := v.Valid(op); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
@@ -0,0 +1,167 @@
+package emergency
+
+import (
+	"net/http"
+	"time"
+
+	"pm4devs.strawhats/internal/models/tokens"
+	"pm4devs.strawhats/internal/rest"
+	"pm4devs.strawhats/internal/routes/middleware"
+	"pm4devs.strawhats/internal/validator"
+)
+
+// ============================================================================
+// Request
+// ============================================================================
+
+const RequestRoute = "/v1/emergency/request"
+
+func (app *Emergency) handleRequest(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		app.requestAccess(w, r)
+	case http.MethodDelete:
+		app.cancelAccess(w, r)
+	default:
+		app.rest.MethodNotAllowed(w, r, "POST, DELETE")
+	}
+}
+
+// Requests access to the vault of a user as their trusted contact
+//
+// The grantor is emailed a token to veto the request. Access is granted by a
+// background job once the waiting period ends without a veto.
+func (app *Emergency) requestAccess(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		ContactID int64 `json:"contact_id"`
+	}
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, "emergency.requestAccess", &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	// Validate parameters
+	v := validator.New()
+	v.Check(input.ContactID > 0, "contact_id", "must be provided")
+	if err := v.Valid("emergency.requestAccess"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	user := middleware.ContextGetUser(r)
+	contact, err := app.emergency.GetByID(input.ContactID)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	// The veto token expires when the waiting period ends
+	ttl := time.Duration(contact.WaitDays) * 24 * time.Hour
+	token, err := app.tokens.New(contact.GrantorID, ttl, tokens.ScopeEmergencyVeto)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	contact, err = app.emergency.Request(input.ContactID, user.ID, token)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	// Send an email to the grantor
+	app.bg.Run(func() {
+		data := map[string]string{
+			"contact":   contact.GranteeEmail,
+			"access":    string(contact.Access),
+			"grantsAt":  contact.GrantsAt.Format(time.RFC1123),
+			"vetoToken": token.Plaintext,
+		}
+
+		err := app.mailer.SendEmergencyRequestEmail(contact.GrantorEmail, data)
+		if err != nil {
+			app.logger.Error(err.Error())
+		}
+	})
+
+	app.rest.WriteJSON(w, "emergency.requestAccess", http.StatusAccepted, rest.Envelope{
+		"message": "Success! Access will be granted unless your request is rejected.",
+		"data":    contact,
+	})
+}
+
+// Ends a pending request or a granted access, as either the grantor or the
+// contact
+func (app *Emergency) cancelAccess(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		ContactID int64 `json:"contact_id"`
+	}
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, "emergency.cancelAccess", &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	// Validate parameters
+	v := validator.New()
+	v.Check(input.ContactID > 0, "contact_id", "must be provided")
+	if err := v.Valid("emergency.cancelAccess"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	user := middleware.ContextGetUser(r)
+	if err := app.emergency.Cancel(input.ContactID, user.ID); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	app.rest.WriteJSON(w, "emergency.cancelAccess", http.StatusOK, rest.Envelope{
+		"message": "Success!",
+	})
+}
+
+// ============================================================================
+// Veto
+// ============================================================================
+
+// Vetoing is a POST so that link previews fetching the page with a GET do
+// not reject the request
+const VetoRoute = "/v1/emergency/veto"
+
+func (app *Emergency) handleVeto(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		http.ServeFile(w, r, "static/emergency_veto.html")
+	case http.MethodPost:
+		app.veto(w, r)
+	default:
+		app.rest.MethodNotAllowed(w, r, "GET, POST")
+	}
+}
+
+// Rejects a pending request with the token emailed to the grantor
+func (app *Emergency) veto(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token string `json:"token"`
+	}
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, "emergency.veto", &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	// Validate parameters
+	v := validator.New()
+	v.Check(len(input.Token) > 0, "token", "must be provided")
+	if err := v.Valid("emergency.veto"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	contact, err := app.emergency.Veto(input.Token)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	app.rest.WriteJSON(w, "emergency.veto", http.StatusOK, rest.Envelope{
+		"message": "Success! The request was rejected.",
+		"data":    contact,
+	})
+}
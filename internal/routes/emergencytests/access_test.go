@@ -0,0 +1,234 @@
+package emergency
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"pm4devs.strawhats/internal/assert"
+	"pm4devs.strawhats/internal/jobs"
+	"pm4devs.strawhats/internal/mocks"
+	"pm4devs.strawhats/internal/models/tokens"
+	"pm4devs.strawhats/internal/routes/emergency"
+	"pm4devs.strawhats/internal/routes/secret"
+	"pm4devs.strawhats/internal/routes/utils"
+)
+
+func TestRequestAndVeto(t *testing.T) {
+	assert.Integration(t)
+	app := mocks.App(t)
+	handler := emergencyHandler(app)
+
+	token := registerWithKey(t, app, handler, "grantor@example.com")
+	contactToken := registerWithKey(t, app, handler, "contact@example.com")
+
+	nominate := `{"email": "contact@example.com", "access": "view", "wait_days": 3, "wrapped_key": "wrapped"}`
+	res := sendAuthRequest(handler, http.MethodPost, emergency.ContactsRoute, nominate, token)
+	assert.Equal(t, res, http.StatusCreated)
+
+	tests := []assert.HandlerTestCase[contactResponse]{
+		{
+			Name:   "NotTheContact",
+			Body:   `{"contact_id": 1}`,
+			Auth:   token,
+			Status: http.StatusNotFound,
+		},
+		{
+			Name:   "Success",
+			Body:   `{"contact_id": 1}`,
+			Auth:   contactToken,
+			Status: http.StatusAccepted,
+			FN: func(t *testing.T, result contactResponse) {
+				assert.Equal(t, result.Data.Status, "requested")
+				assert.Check(t, result.Data.WrappedKey == nil)
+			},
+		},
+		{
+			Name:   "AlreadyRequested",
+			Body:   `{"contact_id": 1}`,
+			Auth:   contactToken,
+			Status: http.StatusConflict,
+		},
+	}
+
+	for _, tc := range tests {
+		assert.RunHandlerTestCase(t, handler, http.MethodPost, emergency.RequestRoute, tc)
+	}
+
+	// The grantor is emailed a veto token
+	app.BG.Wait()
+	mailer := mocks.Mailer(app)
+	assert.Equal(t, mailer.EmergencyRequestCount, 1)
+	assert.NotEqual(t, mailer.EmergencyVetoToken, "")
+
+	// The waiting period is still running
+	jobs.New(app).GrantEmergencyAccess()
+	assert.Equal(t, mailer.EmergencyGrantedCount, 0)
+
+	vetoTests := []assert.HandlerTestCase[contactResponse]{
+		{
+			Name:   "UnknownToken",
+			Body:   `{"token": "unknown"}`,
+			Status: http.StatusNotFound,
+		},
+		{
+			Name:   "Veto",
+			Body:   fmt.Sprintf(`{"token": %q}`, mailer.EmergencyVetoToken),
+			Status: http.StatusOK,
+			FN: func(t *testing.T, result contactResponse) {
+				assert.Equal(t, result.Data.Status, "idle")
+			},
+		},
+		{
+			Name:   "AlreadyVetoed",
+			Body:   fmt.Sprintf(`{"token": %q}`, mailer.EmergencyVetoToken),
+			Status: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range vetoTests {
+		assert.RunHandlerTestCase(t, handler, http.MethodPost, emergency.VetoRoute, tc)
+	}
+
+	// The contact can request again and cancel the request
+	res = sendAuthRequest(handler, http.MethodPost, emergency.RequestRoute, `{"contact_id": 1}`, contactToken)
+	assert.Equal(t, res, http.StatusAccepted)
+	res = sendAuthRequest(handler, http.MethodDelete, emergency.RequestRoute, `{"contact_id": 1}`, contactToken)
+	assert.Equal(t, res, http.StatusOK)
+	res = sendAuthRequest(handler, http.MethodDelete, emergency.RequestRoute, `{"contact_id": 1}`, contactToken)
+	assert.Equal(t, res, http.StatusNotFound)
+}
+
+func TestGrantedAccess(t *testing.T) {
+	assert.Integration(t)
+	app := mocks.App(t)
+	handler := emergencyHandler(app)
+	authHandler := utils.AuthHandler(app)
+
+	token := registerWithKey(t, app, handler, "grantor@example.com")
+	viewToken := registerWithKey(t, app, handler, "viewer@example.com")
+	takeoverToken := registerWithKey(t, app, handler, "heir@example.com")
+
+	secretData := `{"encrypted_data": "data", "name": "testname", "iv": "testing"}`
+	res := sendAuthRequest(handler, http.MethodPost, secret.SecretCRUDRoute, secretData, token)
+	assert.Equal(t, res, http.StatusCreated)
+
+	nominate := `{"email": "viewer@example.com", "access": "view", "wrapped_key": "wrapped-view"}`
+	res = sendAuthRequest(handler, http.MethodPost, emergency.ContactsRoute, nominate, token)
+	assert.Equal(t, res, http.StatusCreated)
+	nominate = `{"email": "heir@example.com", "access": "takeover", "wrapped_key": "wrapped-takeover"}`
+	res = sendAuthRequest(handler, http.MethodPost, emergency.ContactsRoute, nominate, token)
+	assert.Equal(t, res, http.StatusCreated)
+
+	// The vault stays closed until access is granted
+	res = sendAuthRequest(handler, http.MethodGet, emergency.VaultRoute+"?contact_id=1", "", viewToken)
+	assert.Equal(t, res, http.StatusForbidden)
+
+	// Requests with a waiting period that already ended, skipping the route
+	grantor, err := app.Models.Users.GetByEmail("grantor@example.com")
+	assert.Check(t, err == nil)
+	for contactID, email := range map[int64]string{1: "viewer@example.com", 2: "heir@example.com"} {
+		contact, err := app.Models.Users.GetByEmail(email)
+		assert.Check(t, err == nil)
+		veto, err := app.Models.Tokens.New(grantor.ID, -time.Minute, tokens.ScopeEmergencyVeto)
+		assert.Check(t, err == nil)
+		_, err = app.Models.Emergency.Request(contactID, contact.ID, veto)
+		assert.Check(t, err == nil)
+	}
+
+	jobs.New(app).GrantEmergencyAccess()
+	mailer := mocks.Mailer(app)
+	assert.Equal(t, mailer.EmergencyGrantedCount, 2)
+
+	type vaultResponse struct {
+		Data []map[string]any `json:"data"`
+	}
+
+	vaultTests := []assert.HandlerTestCase[vaultResponse]{
+		{
+			Name:   "MissingContact",
+			Route:  emergency.VaultRoute,
+			Auth:   viewToken,
+			Status: http.StatusUnprocessableEntity,
+		},
+		{
+			Name:   "NotTheContact",
+			Route:  emergency.VaultRoute + "?contact_id=1",
+			Auth:   takeoverToken,
+			Status: http.StatusNotFound,
+		},
+		{
+			Name:   "Success",
+			Route:  emergency.VaultRoute + "?contact_id=1",
+			Auth:   viewToken,
+			Status: http.StatusOK,
+			FN: func(t *testing.T, result vaultResponse) {
+				assert.Equal(t, len(result.Data), 1)
+				assert.Equal(t, result.Data[0]["name"], "testname")
+			},
+		},
+	}
+
+	for _, tc := range vaultTests {
+		assert.RunHandlerTestCase(t, handler, http.MethodGet, tc.Route, tc)
+	}
+
+	// The wrapped key is released to the contact once granted
+	assert.RunHandlerTestCase(t, handler, http.MethodGet, emergency.ContactsRoute, assert.HandlerTestCase[contactsResponse]{
+		Name:   "KeyReleased",
+		Auth:   viewToken,
+		Status: http.StatusOK,
+		FN: func(t *testing.T, result contactsResponse) {
+			assert.Equal(t, len(result.Data), 1)
+			assert.Equal(t, result.Data[0]["wrapped_key"], "wrapped-view")
+		},
+	})
+
+	takeoverTests := []assert.HandlerTestCase[contactResponse]{
+		{
+			Name:   "ViewOnly",
+			Body:   `{"contact_id": 1, "password": "newpassword"}`,
+			Auth:   viewToken,
+			Status: http.StatusForbidden,
+		},
+		{
+			Name:   "ShortPassword",
+			Body:   `{"contact_id": 2, "password": "short"}`,
+			Auth:   takeoverToken,
+			Status: http.StatusUnprocessableEntity,
+		},
+		{
+			Name:   "MissingKey",
+			Body:   `{"contact_id": 2, "password": "newpassword"}`,
+			Auth:   takeoverToken,
+			Status: http.StatusUnprocessableEntity,
+			FN: func(t *testing.T, result contactResponse) {
+				assert.Equal(t, result.Error["public_key"],
+					"must be provided, the private key of the account is encrypted with its password")
+			},
+		},
+		{
+			Name:   "Success",
+			Body:   `{"contact_id": 2, "password": "newpassword", "public_key": "public-new", "encrypted_private_key": "private-new"}`,
+			Auth:   takeoverToken,
+			Status: http.StatusOK,
+		},
+		{
+			Name:   "AccessEnded",
+			Body:   `{"contact_id": 2, "password": "newpassword"}`,
+			Auth:   takeoverToken,
+			Status: http.StatusForbidden,
+		},
+	}
+
+	for _, tc := range takeoverTests {
+		assert.RunHandlerTestCase(t, handler, http.MethodPost, emergency.TakeoverRoute, tc)
+	}
+
+	// The grantor was logged out and the new password works
+	res = sendAuthRequest(handler, http.MethodGet, emergency.ContactsRoute, "", token)
+	assert.Equal(t, res, http.StatusUnauthorized)
+	newToken := utils.LoginUser(authHandler, `{"email": "grantor@example.com", "password": "newpassword"}`)
+	assert.Check(t, len(newToken) > 0)
+}
@@ -0,0 +1,111 @@
+package emergency
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"pm4devs.strawhats/internal/assert"
+	"pm4devs.strawhats/internal/mocks"
+	modelkeys "pm4devs.strawhats/internal/models/keys"
+	"pm4devs.strawhats/internal/routes/emergency"
+)
+
+type contactResponse struct {
+	Error map[string]string `json:"error"`
+	Data  struct {
+		ID             int64   `json:"id"`
+		GrantorEmail   string  `json:"grantor_email"`
+		GranteeEmail   string  `json:"grantee_email"`
+		Access         string  `json:"access"`
+		WaitDays       int     `json:"wait_days"`
+		WrappedKey     *string `json:"wrapped_key"`
+		KeyFingerprint string  `json:"key_fingerprint"`
+		Status         string  `json:"status"`
+	} `json:"data"`
+}
+
+type contactsResponse struct {
+	Data []map[string]any `json:"data"`
+}
+
+func TestContacts(t *testing.T) {
+	assert.Integration(t)
+	app := mocks.App(t)
+	handler := emergencyHandler(app)
+
+	token := registerWithKey(t, app, handler, "grantor@example.com")
+	contactToken := registerWithKey(t, app, handler, "contact@example.com")
+
+	var contactID int64
+	tests := []assert.HandlerTestCase[contactResponse]{
+		{
+			Name:   "Unauthenticated",
+			Body:   `{"email": "contact@example.com", "access": "view", "wrapped_key": "wrapped"}`,
+			Status: http.StatusUnauthorized,
+		},
+		{
+			Name:   "InvalidInput",
+			Body:   `{"email": "grantor@example.com", "access": "admin", "wait_days": 91}`,
+			Auth:   token,
+			Status: http.StatusUnprocessableEntity,
+			FN: func(t *testing.T, result contactResponse) {
+				assert.Equal(t, result.Error["email"], "must not be your own")
+				assert.Equal(t, result.Error["access"], "must be one of view or takeover")
+				assert.Equal(t, result.Error["wait_days"], "must be between 1 and 90")
+				assert.Equal(t, result.Error["wrapped_key"], "must be provided")
+			},
+		},
+		{
+			Name:   "NoKey",
+			Body:   `{"email": "unknown@example.com", "access": "view", "wrapped_key": "wrapped"}`,
+			Auth:   token,
+			Status: http.StatusNotFound,
+		},
+		{
+			Name:   "Success",
+			Body:   `{"email": "contact@example.com", "access": "view", "wrapped_key": "wrapped"}`,
+			Auth:   token,
+			Status: http.StatusCreated,
+			FN: func(t *testing.T, result contactResponse) {
+				assert.Equal(t, result.Data.GrantorEmail, "grantor@example.com")
+				assert.Equal(t, result.Data.GranteeEmail, "contact@example.com")
+				assert.Equal(t, result.Data.WaitDays, 7)
+				assert.Equal(t, result.Data.Status, "idle")
+				assert.Equal(t, result.Data.KeyFingerprint, modelkeys.Fingerprint("public-contact@example.com"))
+				// The key is held back until access is granted
+				assert.Check(t, result.Data.WrappedKey == nil)
+				contactID = result.Data.ID
+			},
+		},
+		{
+			Name:   "AlreadyNominated",
+			Body:   `{"email": "contact@example.com", "access": "takeover", "wrapped_key": "wrapped"}`,
+			Auth:   token,
+			Status: http.StatusConflict,
+		},
+	}
+
+	for _, tc := range tests {
+		assert.RunHandlerTestCase(t, handler, http.MethodPost, emergency.ContactsRoute, tc)
+	}
+
+	// Both sides see the contact
+	for name, auth := range map[string]string{"GrantorList": token, "ContactList": contactToken} {
+		assert.RunHandlerTestCase(t, handler, http.MethodGet, emergency.ContactsRoute, assert.HandlerTestCase[contactsResponse]{
+			Name:   name,
+			Auth:   auth,
+			Status: http.StatusOK,
+			FN: func(t *testing.T, result contactsResponse) {
+				assert.Equal(t, len(result.Data), 1)
+			},
+		})
+	}
+
+	// Either side can remove the contact
+	body := fmt.Sprintf(`{"contact_id": %d}`, contactID)
+	res := sendAuthRequest(handler, http.MethodDelete, emergency.ContactsRoute, body, contactToken)
+	assert.Equal(t, res, http.StatusOK)
+	res = sendAuthRequest(handler, http.MethodDelete, emergency.ContactsRoute, body, token)
+	assert.Equal(t, res, http.StatusNotFound)
+}
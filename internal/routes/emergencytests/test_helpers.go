@@ -0,0 +1,71 @@
+package emergency
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"pm4devs.strawhats/internal/app"
+	"pm4devs.strawhats/internal/assert"
+	"pm4devs.strawhats/internal/routes/emergency"
+	"pm4devs.strawhats/internal/routes/keys"
+	"pm4devs.strawhats/internal/routes/middleware"
+	"pm4devs.strawhats/internal/routes/secret"
+	"pm4devs.strawhats/internal/routes/utils"
+)
+
+// ============================================================================
+// Helpers
+// ============================================================================
+
+// Creates a complete Emergency handler including middleware. The keys and
+// secrets routes are included to register key pairs and fill the vault.
+func emergencyHandler(app *app.App) http.HandlerFunc {
+	handler := func() http.Handler {
+		mux := http.NewServeMux()
+
+		middleware := middleware.New(app)
+		emergency.New(app).Route(mux, middleware)
+		keys.New(app).Route(mux, middleware)
+		secret.New(app).Route(mux, middleware)
+
+		return middleware.User(mux)
+	}()
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r)
+	}
+}
+
+// Registers and logs in a user with a key pair, returning their token
+func registerWithKey(t *testing.T, app *app.App, handler http.HandlerFunc, email string) string {
+	t.Helper()
+
+	authHandler := utils.AuthHandler(app)
+	credentials := `{"email": "` + email + `", "password": "password"}`
+	assert.Check(t, utils.RegisterUser(authHandler, credentials))
+	token := utils.LoginUser(authHandler, credentials)
+	assert.Check(t, len(token) > 0)
+
+	keyPair := `{"public_key": "public-` + email + `", "encrypted_private_key": "private-` + email + `"}`
+	assert.Equal(t, sendAuthRequest(handler, http.MethodPut, keys.KeysRoute, keyPair, token), http.StatusCreated)
+
+	return token
+}
+
+func sendAuthRequest(handler http.HandlerFunc, method, route, body, authToken string) int {
+	req := httptest.NewRequest(method, route, bytes.NewBufferString(body))
+
+	// If authToken is provided, set the Authorization header
+	if authToken != "" {
+		req.Header.Set("Authorization", "Bearer "+authToken)
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	resp := rr.Result()
+	defer resp.Body.Close()
+
+	return resp.StatusCode
+}
@@ -0,0 +1,215 @@
+package folder
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"pm4devs.strawhats/internal/models/folders"
+	"pm4devs.strawhats/internal/models/secrets"
+	"pm4devs.strawhats/internal/rest"
+	"pm4devs.strawhats/internal/routes/middleware"
+	"pm4devs.strawhats/internal/validator"
+	"pm4devs.strawhats/internal/xerrors"
+)
+
+const FolderCRUDRoute = "/v1/folders"
+
+func (app *Folder) CRUDRoute(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		app.get(w, r)
+
+	case http.MethodPost:
+		app.createNew(w, r)
+
+	case http.MethodPatch:
+		app.rename(w, r)
+
+	case http.MethodDelete:
+		app.delete(w, r)
+
+	default:
+		app.rest.MethodNotAllowed(w, r, "GET, POST, PATCH, DELETE")
+	}
+}
+
+// Lists the folders and secrets inside a folder, or the root of the user's
+// vault when no folder_id query parameter is given
+func (app *Folder) get(w http.ResponseWriter, r *http.Request) {
+	var folderID int64
+	if param := r.URL.Query().Get("folder_id"); param != "" {
+		id, err := strconv.ParseInt(param, 10, 64)
+
+		v := validator.New()
+		v.Check(err == nil && id > 0, "folder_id", "must be a positive integer")
+		if err := v.Valid("folders.get"); err != nil {
+			app.rest.Error(w, err)
+			return
+		}
+		folderID = id
+	}
+
+	user := middleware.ContextGetUser(r)
+	if folderID == 0 {
+		contents, err := app.folders.GetRootContents(user.ID)
+		if err != nil {
+			app.rest.Error(w, err)
+			return
+		}
+		app.rest.WriteJSON(w, "folders.get", http.StatusOK, rest.Envelope{
+			"message": "Success!",
+			"data":    contents,
+		})
+		return
+	}
+
+	permission, err := app.folders.GetUserFolderPermission(user.ID, folderID)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	if permission == secrets.NOTALLOWED {
+		app.rest.WriteJSON(w, "folders.get", http.StatusUnauthorized, rest.Envelope{
+			"message": "Your not allowed",
+		})
+		return
+	}
+
+	contents, err := app.folders.GetContents(folderID)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	app.rest.WriteJSON(w, "folders.get", http.StatusOK, rest.Envelope{
+		"message": "Success!",
+		"data":    contents,
+	})
+}
+
+func (app *Folder) createNew(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name     string `json:"name"`
+		ParentID int64  `json:"parent_id"`
+	}
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, "folders.createNew", &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	// Validate parameters
+	v := validator.New()
+	v.Check(len(input.Name) > 0, "name", "must be provided")
+	v.Check(input.ParentID >= 0, "parent_id", "must not be negative")
+	if err := v.Valid("folders.createNew"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	if input.ParentID > 0 {
+		if _, err := app.validateFolderOwnership(w, r, input.ParentID); err != nil {
+			return
+		}
+	}
+
+	user := middleware.ContextGetUser(r)
+	folder, err := app.folders.NewRecord(input.Name, user.ID, input.ParentID)
+	if err != nil {
+		nameTaken(err)
+		app.rest.Error(w, err)
+		return
+	}
+	app.rest.WriteJSON(w, "folders.createNew", http.StatusCreated, rest.Envelope{
+		"message": "Success!",
+		"data":    folder,
+	})
+}
+
+func (app *Folder) rename(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		FolderID int64  `json:"folder_id"`
+		Name     string `json:"name"`
+	}
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, "folders.rename", &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	// Validate parameters
+	v := validator.New()
+	v.Check(input.FolderID > 0, "folder_id", "must be provided")
+	v.Check(len(input.Name) > 0, "name", "must be provided")
+	if err := v.Valid("folders.rename"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	if _, err := app.validateFolderOwnership(w, r, input.FolderID); err != nil {
+		return
+	}
+
+	folder, err := app.folders.Rename(input.FolderID, input.Name)
+	if err != nil {
+		nameTaken(err)
+		app.rest.Error(w, err)
+		return
+	}
+	app.rest.WriteJSON(w, "folders.rename", http.StatusOK, rest.Envelope{
+		"message": "Success!",
+		"data":    folder,
+	})
+}
+
+// Deletes a folder, moving everything inside it up to its parent
+func (app *Folder) delete(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		FolderID int64 `json:"folder_id"`
+	}
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, "folders.delete", &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	// Validate parameters
+	v := validator.New()
+	v.Check(input.FolderID > 0, "folder_id", "must be provided")
+	if err := v.Valid("folders.delete"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	if _, err := app.validateFolderOwnership(w, r, input.FolderID); err != nil {
+		return
+	}
+
+	if err := app.folders.Delete(input.FolderID); err != nil {
+		nameTaken(err)
+		app.rest.Error(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Ensures the current user owns the folder, writing the error response if not
+func (app *Folder) validateFolderOwnership(w http.ResponseWriter, r *http.Request, folderID int64) (*folders.FolderRecord, error) {
+	currUser := middleware.ContextGetUser(r)
+	folder, err := app.folders.GetByID(folderID)
+	if err != nil {
+		app.rest.Error(w, err)
+		return nil, fmt.Errorf("error")
+	}
+	if currUser.ID != folder.OwnerID {
+		app.rest.WriteJSON(w, "folders.validateFolderOwnership", http.StatusUnauthorized, rest.Envelope{
+			"message": "Only folder owner can manage the folder",
+		})
+		return nil, fmt.Errorf("error")
+	}
+	return folder, nil
+}
+
+// Replaces the unique violation message with something readable
+func nameTaken(err *xerrors.AppError) {
+	err.If(xerrors.ErrUniqueViolation, func(err *xerrors.AppError) {
+		err.Data = "A folder with that name already exists here"
+	})
+}
@@ -0,0 +1,45 @@
+package folder
+
+import (
+	"net/http"
+
+	"pm4devs.strawhats/internal/app"
+	"pm4devs.strawhats/internal/models/folders"
+	"pm4devs.strawhats/internal/models/group"
+	"pm4devs.strawhats/internal/models/secrets"
+	"pm4devs.strawhats/internal/models/users"
+	"pm4devs.strawhats/internal/rest"
+	"pm4devs.strawhats/internal/routes/middleware"
+	"pm4devs.strawhats/internal/xlogger"
+)
+
+// Encapsulates the Application dependencies required by routes
+type Folder struct {
+	logger  xlogger.Logger
+	rest    *rest.Rest
+	users   users.UsersRepository
+	secrets secrets.SecretsRepository
+	group   group.GroupRepository
+	folders folders.FoldersRepository
+}
+
+func New(app *app.App) *Folder {
+	return &Folder{
+		logger:  app.Logger,
+		rest:    app.Rest,
+		users:   app.Models.Users,
+		secrets: app.Models.Secrets,
+		group:   app.Models.Group,
+		folders: app.Models.Folders,
+	}
+}
+
+func (f *Folder) Route(mux *http.ServeMux, mw *middleware.Middleware) {
+	mux.HandleFunc(FolderCRUDRoute, mw.Authenticated(f.CRUDRoute))
+	mux.HandleFunc(FolderMoveRoute, mw.Authenticated(f.moveFolder))
+	mux.HandleFunc(FolderSecretsRoute, mw.Authenticated(f.moveSecret))
+
+	mux.HandleFunc(FolderShareUserRoute, mw.Authenticated(f.handleShareToUser))
+	mux.HandleFunc(FolderShareGroupRoute, mw.Authenticated(f.handleShareToGroup))
+	mux.HandleFunc(GetFoldersSharedToUser, mw.Authenticated(f.getSharedToUserFolders))
+}
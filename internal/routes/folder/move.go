@@ -0,0 +1,110 @@
+package folder
+
+import (
+	"net/http"
+
+	"pm4devs.strawhats/internal/rest"
+	"pm4devs.strawhats/internal/routes/middleware"
+	"pm4devs.strawhats/internal/validator"
+)
+
+const FolderMoveRoute = "/v1/folders/move"
+
+// Moves a folder under a new parent, or to the root when parent_id is 0
+func (app *Folder) moveFolder(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.rest.MethodNotAllowed(w, r, "POST")
+		return
+	}
+
+	var input struct {
+		FolderID int64 `json:"folder_id"`
+		ParentID int64 `json:"parent_id"`
+	}
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, "folders.moveFolder", &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	// Validate parameters
+	v := validator.New()
+	v.Check(input.FolderID > 0, "folder_id", "must be provided")
+	v.Check(input.ParentID >= 0, "parent_id", "must not be negative")
+	if err := v.Valid("folders.moveFolder"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	if _, err := app.validateFolderOwnership(w, r, input.FolderID); err != nil {
+		return
+	}
+	if input.ParentID > 0 {
+		if _, err := app.validateFolderOwnership(w, r, input.ParentID); err != nil {
+			return
+		}
+	}
+
+	if err := app.folders.Move(input.FolderID, input.ParentID); err != nil {
+		nameTaken(err)
+		app.rest.Error(w, err)
+		return
+	}
+	app.rest.WriteJSON(w, "folders.moveFolder", http.StatusOK, rest.Envelope{
+		"message": "Success!",
+	})
+}
+
+const FolderSecretsRoute = "/v1/folders/secrets"
+
+// Files a secret into one of the owner's folders, or back to the root when
+// folder_id is 0
+func (app *Folder) moveSecret(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.rest.MethodNotAllowed(w, r, "POST")
+		return
+	}
+
+	var input struct {
+		SecretID int64 `json:"secret_id"`
+		FolderID int64 `json:"folder_id"`
+	}
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, "folders.moveSecret", &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	// Validate parameters
+	v := validator.New()
+	v.Check(input.SecretID > 0, "secret_id", "must be provided")
+	v.Check(input.FolderID >= 0, "folder_id", "must not be negative")
+	if err := v.Valid("folders.moveSecret"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	user := middleware.ContextGetUser(r)
+	secret, err := app.secrets.GetSecretByID(input.SecretID)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	if secret.OwnerID != user.ID {
+		app.rest.WriteJSON(w, "folders.moveSecret", http.StatusUnauthorized, rest.Envelope{
+			"message": "Only secret owner can move the secret",
+		})
+		return
+	}
+	if input.FolderID > 0 {
+		if _, err := app.validateFolderOwnership(w, r, input.FolderID); err != nil {
+			return
+		}
+	}
+
+	if err := app.folders.MoveSecret(input.SecretID, input.FolderID); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	app.rest.WriteJSON(w, "folders.moveSecret", http.StatusOK, rest.Envelope{
+		"message": "Success!",
+	})
+}
@@ -0,0 +1,237 @@
+package folder
+
+import (
+	"net/http"
+
+	"pm4devs.strawhats/internal/models/core"
+	"pm4devs.strawhats/internal/models/secrets"
+	"pm4devs.strawhats/internal/rest"
+	"pm4devs.strawhats/internal/routes/middleware"
+	"pm4devs.strawhats/internal/validator"
+)
+
+const FolderShareUserRoute = "/v1/folders/share/user"
+
+func (app *Folder) handleShareToUser(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		app.shareToUser(w, r)
+	case http.MethodPatch:
+		app.updateUserPermission(w, r)
+	case http.MethodDelete:
+		app.revokeUserPermission(w, r)
+	default:
+		app.rest.MethodNotAllowed(w, r, "POST, PATCH, DELETE")
+	}
+}
+
+const FolderShareGroupRoute = "/v1/folders/share/group"
+
+func (app *Folder) handleShareToGroup(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		app.shareToGroup(w, r)
+	case http.MethodPatch:
+		app.updateGroupPermission(w, r)
+	case http.MethodDelete:
+		app.revokeGroupPermission(w, r)
+	default:
+		app.rest.MethodNotAllowed(w, r, "POST, PATCH, DELETE")
+	}
+}
+
+const GetFoldersSharedToUser = "/v1/folders/shared"
+
+func (app *Folder) getSharedToUserFolders(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		app.rest.MethodNotAllowed(w, r, "GET")
+		return
+	}
+
+	page, err := core.ParsePage(r.URL.Query(), "folders.getSharedToUserFolders")
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	user := middleware.ContextGetUser(r)
+	shared, next, err := app.folders.GetFoldersSharedWithUser(user.ID, page)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	app.rest.WritePage(w, "folders.getSharedToUserFolders", shared, page.Fields, next)
+}
+
+// Input shared by the user sharing routes
+type userShareInput struct {
+	FolderID   int64              `json:"folder_id"`
+	UserEmail  string             `json:"user_email"`
+	Permission secrets.Permission `json:"permission"`
+}
+
+// Input shared by the group sharing routes
+type groupShareInput struct {
+	FolderID   int64              `json:"folder_id"`
+	GroupName  string             `json:"group_name"`
+	Permission secrets.Permission `json:"permission"`
+}
+
+// Parses and validates a user share request, checking that the current user
+// owns the folder. Returns the target user's ID, or false if a response has
+// already been written.
+func (app *Folder) readUserShare(w http.ResponseWriter, r *http.Request, op string, withPermission bool) (*userShareInput, int64, bool) {
+	var input userShareInput
+	if err := app.rest.ReadJSON(w, r, op, &input); err != nil {
+		app.rest.Error(w, err)
+		return nil, 0, false
+	}
+
+	v := validator.New()
+	v.Check(input.FolderID > 0, "folder_id", "must be provided")
+	v.Check(len(input.UserEmail) > 0, "user_email", "must be provided")
+	if withPermission {
+		v.Check(input.Permission == secrets.ReadOnly || input.Permission == secrets.ReadWrite,
+			"permission", "must be 'read-only' or 'read-write'")
+	}
+	if err := v.Valid(op); err != nil {
+		app.rest.Error(w, err)
+		return nil, 0, false
+	}
+
+	if _, err := app.validateFolderOwnership(w, r, input.FolderID); err != nil {
+		return nil, 0, false
+	}
+
+	user, err := app.users.GetByEmail(input.UserEmail)
+	if err != nil {
+		app.rest.Error(w, err)
+		return nil, 0, false
+	}
+
+	return &input, user.ID, true
+}
+
+// Parses and validates a group share request, checking that the current user
+// owns the folder. Returns the target group's ID, or false if a response has
+// already been written.
+func (app *Folder) readGroupShare(w http.ResponseWriter, r *http.Request, op string, withPermission bool) (*groupShareInput, int64, bool) {
+	var input groupShareInput
+	if err := app.rest.ReadJSON(w, r, op, &input); err != nil {
+		app.rest.Error(w, err)
+		return nil, 0, false
+	}
+
+	v := validator.New()
+	v.Check(input.FolderID > 0, "folder_id", "must be provided")
+	v.Check(len(input.GroupName) > 0, "group_name", "must be provided")
+	if withPermission {
+		v.Check(input.Permission == secrets.ReadOnly || input.Permission == secrets.ReadWrite,
+			"permission", "must be 'read-only' or 'read-write'")
+	}
+	if err := v.Valid(op); err != nil {
+		app.rest.Error(w, err)
+		return nil, 0, false
+	}
+
+	if _, err := app.validateFolderOwnership(w, r, input.FolderID); err != nil {
+		return nil, 0, false
+	}
+
+	group, err := app.group.GetGroupUsers(input.GroupName)
+	if err != nil {
+		app.rest.Error(w, err)
+		return nil, 0, false
+	}
+
+	return &input, group.ID, true
+}
+
+func (app *Folder) shareToUser(w http.ResponseWriter, r *http.Request) {
+	input, userID, ok := app.readUserShare(w, r, "folders.shareToUser", true)
+	if !ok {
+		return
+	}
+
+	if err := app.folders.ShareToUser(input.FolderID, userID, input.Permission); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	app.rest.WriteJSON(w, "folders.shareToUser", http.StatusCreated, rest.Envelope{
+		"message": "Folder shared successfully with the user.",
+	})
+}
+
+func (app *Folder) updateUserPermission(w http.ResponseWriter, r *http.Request) {
+	input, userID, ok := app.readUserShare(w, r, "folders.updateUserPermission", true)
+	if !ok {
+		return
+	}
+
+	if err := app.folders.UpdateUserPermission(input.FolderID, userID, input.Permission); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	app.rest.WriteJSON(w, "folders.updateUserPermission", http.StatusOK, rest.Envelope{
+		"message": "Permission updated successfully for the user.",
+	})
+}
+
+func (app *Folder) revokeUserPermission(w http.ResponseWriter, r *http.Request) {
+	input, userID, ok := app.readUserShare(w, r, "folders.revokeUserPermission", false)
+	if !ok {
+		return
+	}
+
+	if err := app.folders.RevokeFromUser(input.FolderID, userID); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	app.rest.WriteJSON(w, "folders.revokeUserPermission", http.StatusOK, rest.Envelope{
+		"message": "Permission revoked successfully for the user.",
+	})
+}
+
+func (app *Folder) shareToGroup(w http.ResponseWriter, r *http.Request) {
+	input, groupID, ok := app.readGroupShare(w, r, "folders.shareToGroup", true)
+	if !ok {
+		return
+	}
+
+	if err := app.folders.ShareToGroup(input.FolderID, groupID, input.Permission); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	app.rest.WriteJSON(w, "folders.shareToGroup", http.StatusCreated, rest.Envelope{
+		"message": "Folder shared successfully with the group.",
+	})
+}
+
+func (app *Folder) updateGroupPermission(w http.ResponseWriter, r *http.Request) {
+	input, groupID, ok := app.readGroupShare(w, r, "folders.updateGroupPermission", true)
+	if !ok {
+		return
+	}
+
+	if err := app.folders.UpdateGroupPermission(input.FolderID, groupID, input.Permission); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	app.rest.WriteJSON(w, "folders.updateGroupPermission", http.StatusOK, rest.Envelope{
+		"message": "Permission updated successfully for the group.",
+	})
+}
+
+func (app *Folder) revokeGroupPermission(w http.ResponseWriter, r *http.Request) {
+	input, groupID, ok := app.readGroupShare(w, r, "folders.revokeGroupPermission", false)
+	if !ok {
+		return
+	}
+
+	if err := app.folders.RevokeFromGroup(input.FolderID, groupID); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	app.rest.WriteJSON(w, "folders.revokeGroupPermission", http.StatusOK, rest.Envelope{
+		"message": "Permission revoked successfully for the group.",
+	})
+}
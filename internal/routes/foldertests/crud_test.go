@@ -0,0 +1,231 @@
+package folder
+
+import (
+	"net/http"
+	"testing"
+
+	"pm4devs.strawhats/internal/assert"
+	"pm4devs.strawhats/internal/mocks"
+	"pm4devs.strawhats/internal/routes/folder"
+	"pm4devs.strawhats/internal/routes/secret"
+	"pm4devs.strawhats/internal/routes/utils"
+)
+
+func TestFolderCRUD(t *testing.T) {
+	assert.Integration(t)
+	app := mocks.App(t)
+	handler := folderHandler(app)
+	authHandler := utils.AuthHandler(app)
+
+	credentials := `{"email": "test@example.com", "password": "password"}`
+	assert.Check(t, utils.RegisterUser(authHandler, credentials))
+	token := utils.LoginUser(authHandler, credentials)
+	assert.Check(t, len(token) > 0)
+
+	credentialsTwo := `{"email": "test2@example.com", "password": "password"}`
+	assert.Check(t, utils.RegisterUser(authHandler, credentialsTwo))
+	tokenTwo := utils.LoginUser(authHandler, credentialsTwo)
+	assert.Check(t, len(tokenTwo) > 0)
+
+	// Seed – a secret at the root of the vault
+	secretData := `{"encrypted_data": "test@example.com", "name": "testname", "iv": "testing"}`
+	res := sendAuthRequest(handler, http.MethodPost, secret.SecretCRUDRoute, secretData, token)
+	assert.Equal(t, res, http.StatusCreated)
+
+	type responseMessage struct {
+		Error   map[string]string `json:"error"`
+		Message string            `json:"message"`
+		Data    struct {
+			ID       int64  `json:"id"`
+			Name     string `json:"name"`
+			ParentID *int64 `json:"parent_id"`
+			Folders  []struct {
+				ID int64 `json:"id"`
+			} `json:"folders"`
+			Secrets []struct {
+				ID       int64  `json:"id"`
+				FolderID *int64 `json:"folder_id"`
+			} `json:"secrets"`
+		} `json:"data"`
+	}
+
+	tests := []assert.HandlerTestCase[responseMessage]{
+		{
+			Name:   "AuthRequired",
+			Method: http.MethodGet,
+			Route:  folder.FolderCRUDRoute,
+			Status: http.StatusUnauthorized,
+		},
+		{
+			Name:   "MethodNotAllowed",
+			Auth:   token,
+			Method: http.MethodPut,
+			Route:  folder.FolderCRUDRoute,
+			Status: http.StatusMethodNotAllowed,
+		},
+		{
+			Name:   "Create/MissingName",
+			Auth:   token,
+			Body:   `{"name": ""}`,
+			Method: http.MethodPost,
+			Route:  folder.FolderCRUDRoute,
+			Status: http.StatusUnprocessableEntity,
+			FN: func(t *testing.T, result responseMessage) {
+				assert.Equal(t, result.Error["name"], "must be provided")
+			},
+		},
+		{
+			Name:   "Create/Root",
+			Auth:   token,
+			Body:   `{"name": "work"}`,
+			Method: http.MethodPost,
+			Route:  folder.FolderCRUDRoute,
+			Status: http.StatusCreated,
+			FN: func(t *testing.T, result responseMessage) {
+				assert.Equal(t, result.Data.ID, int64(1))
+				assert.True(t, result.Data.ParentID == nil)
+			},
+		},
+		{
+			Name:   "Create/DuplicateName",
+			Auth:   token,
+			Body:   `{"name": "work"}`,
+			Method: http.MethodPost,
+			Route:  folder.FolderCRUDRoute,
+			Status: http.StatusConflict,
+		},
+		{
+			Name:   "Create/Nested",
+			Auth:   token,
+			Body:   `{"name": "servers", "parent_id": 1}`,
+			Method: http.MethodPost,
+			Route:  folder.FolderCRUDRoute,
+			Status: http.StatusCreated,
+			FN: func(t *testing.T, result responseMessage) {
+				assert.Equal(t, result.Data.ID, int64(2))
+				assert.Equal(t, *result.Data.ParentID, int64(1))
+			},
+		},
+		{
+			Name:   "Create/NotParentOwner",
+			Auth:   tokenTwo,
+			Body:   `{"name": "mine", "parent_id": 1}`,
+			Method: http.MethodPost,
+			Route:  folder.FolderCRUDRoute,
+			Status: http.StatusUnauthorized,
+		},
+		{
+			Name:   "MoveSecret/NotOwner",
+			Auth:   tokenTwo,
+			Body:   `{"secret_id": 1, "folder_id": 2}`,
+			Method: http.MethodPost,
+			Route:  folder.FolderSecretsRoute,
+			Status: http.StatusUnauthorized,
+		},
+		{
+			Name:   "MoveSecret/Success",
+			Auth:   token,
+			Body:   `{"secret_id": 1, "folder_id": 2}`,
+			Method: http.MethodPost,
+			Route:  folder.FolderSecretsRoute,
+			Status: http.StatusOK,
+		},
+		{
+			Name:   "Get/Root",
+			Auth:   token,
+			Method: http.MethodGet,
+			Route:  folder.FolderCRUDRoute,
+			Status: http.StatusOK,
+			FN: func(t *testing.T, result responseMessage) {
+				assert.Equal(t, len(result.Data.Folders), 1)
+				assert.Equal(t, len(result.Data.Secrets), 0)
+			},
+		},
+		{
+			Name:   "Get/Folder",
+			Auth:   token,
+			Method: http.MethodGet,
+			Route:  folder.FolderCRUDRoute + "?folder_id=2",
+			Status: http.StatusOK,
+			FN: func(t *testing.T, result responseMessage) {
+				assert.Equal(t, len(result.Data.Secrets), 1)
+				assert.Equal(t, *result.Data.Secrets[0].FolderID, int64(2))
+			},
+		},
+		{
+			Name:   "Get/InvalidFolderID",
+			Auth:   token,
+			Method: http.MethodGet,
+			Route:  folder.FolderCRUDRoute + "?folder_id=abc",
+			Status: http.StatusUnprocessableEntity,
+		},
+		{
+			Name:   "Get/NotAllowed",
+			Auth:   tokenTwo,
+			Method: http.MethodGet,
+			Route:  folder.FolderCRUDRoute + "?folder_id=2",
+			Status: http.StatusUnauthorized,
+		},
+		{
+			Name:   "Move/IntoDescendant",
+			Auth:   token,
+			Body:   `{"folder_id": 1, "parent_id": 2}`,
+			Method: http.MethodPost,
+			Route:  folder.FolderMoveRoute,
+			Status: http.StatusUnprocessableEntity,
+			FN: func(t *testing.T, result responseMessage) {
+				assert.Equal(t, result.Error["parent_id"], "cannot be the folder itself or one of its subfolders")
+			},
+		},
+		{
+			Name:   "Move/ToRoot",
+			Auth:   token,
+			Body:   `{"folder_id": 2, "parent_id": 0}`,
+			Method: http.MethodPost,
+			Route:  folder.FolderMoveRoute,
+			Status: http.StatusOK,
+		},
+		{
+			Name:   "Rename/Success",
+			Auth:   token,
+			Body:   `{"folder_id": 2, "name": "infra"}`,
+			Method: http.MethodPatch,
+			Route:  folder.FolderCRUDRoute,
+			Status: http.StatusOK,
+			FN: func(t *testing.T, result responseMessage) {
+				assert.Equal(t, result.Data.Name, "infra")
+			},
+		},
+		{
+			Name:   "Delete/NotOwner",
+			Auth:   tokenTwo,
+			Body:   `{"folder_id": 2}`,
+			Method: http.MethodDelete,
+			Route:  folder.FolderCRUDRoute,
+			Status: http.StatusUnauthorized,
+		},
+		{
+			Name:   "Delete/Success",
+			Auth:   token,
+			Body:   `{"folder_id": 2}`,
+			Method: http.MethodDelete,
+			Route:  folder.FolderCRUDRoute,
+			Status: http.StatusNoContent,
+		},
+		{
+			Name:   "Delete/MovedContentsUp",
+			Auth:   token,
+			Method: http.MethodGet,
+			Route:  folder.FolderCRUDRoute,
+			Status: http.StatusOK,
+			FN: func(t *testing.T, result responseMessage) {
+				assert.Equal(t, len(result.Data.Folders), 1)
+				assert.Equal(t, len(result.Data.Secrets), 1)
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		assert.RunHandlerTestCase(t, handler, tc.Method, tc.Route, tc)
+	}
+}
@@ -0,0 +1,130 @@
+package folder
+
+import (
+	"net/http"
+	"testing"
+
+	"pm4devs.strawhats/internal/assert"
+	"pm4devs.strawhats/internal/mocks"
+	"pm4devs.strawhats/internal/routes/folder"
+	"pm4devs.strawhats/internal/routes/group"
+	"pm4devs.strawhats/internal/routes/secret"
+	"pm4devs.strawhats/internal/routes/utils"
+)
+
+func TestFolderSharing(t *testing.T) {
+	assert.Integration(t)
+	app := mocks.App(t)
+	handler := folderHandler(app)
+	authHandler := utils.AuthHandler(app)
+
+	credentials := `{"email": "test@example.com", "password": "password"}`
+	assert.Check(t, utils.RegisterUser(authHandler, credentials))
+	token := utils.LoginUser(authHandler, credentials)
+	assert.Check(t, len(token) > 0)
+
+	credentialsTwo := `{"email": "test2@example.com", "password": "password"}`
+	assert.Check(t, utils.RegisterUser(authHandler, credentialsTwo))
+	tokenTwo := utils.LoginUser(authHandler, credentialsTwo)
+	assert.Check(t, len(tokenTwo) > 0)
+
+	// Seed – a secret inside a nested folder
+	res := sendAuthRequest(handler, http.MethodPost, folder.FolderCRUDRoute, `{"name": "work"}`, token)
+	assert.Equal(t, res, http.StatusCreated)
+	res = sendAuthRequest(handler, http.MethodPost, folder.FolderCRUDRoute, `{"name": "servers", "parent_id": 1}`, token)
+	assert.Equal(t, res, http.StatusCreated)
+
+	secretData := `{"encrypted_data": "test@example.com", "name": "testname", "iv": "testing"}`
+	res = sendAuthRequest(handler, http.MethodPost, secret.SecretCRUDRoute, secretData, token)
+	assert.Equal(t, res, http.StatusCreated)
+	res = sendAuthRequest(handler, http.MethodPost, folder.FolderSecretsRoute, `{"secret_id": 1, "folder_id": 2}`, token)
+	assert.Equal(t, res, http.StatusOK)
+
+	// Not shared yet
+	res = sendAuthRequest(handler, http.MethodGet, secret.SecretCRUDRoute, `{"secret_id": 1}`, tokenTwo)
+	assert.Equal(t, res, http.StatusUnauthorized)
+
+	type responseMessage struct {
+		Error   map[string]string `json:"error"`
+		Message string            `json:"message"`
+	}
+
+	tests := []assert.HandlerTestCase[responseMessage]{
+		{
+			Name:   "MethodNotAllowed",
+			Auth:   token,
+			Method: http.MethodGet,
+			Route:  folder.FolderShareUserRoute,
+			Status: http.StatusMethodNotAllowed,
+		},
+		{
+			Name:   "ShareUser/InvalidPermission",
+			Auth:   token,
+			Body:   `{"folder_id": 1, "user_email": "test2@example.com", "permission": "admin"}`,
+			Method: http.MethodPost,
+			Route:  folder.FolderShareUserRoute,
+			Status: http.StatusUnprocessableEntity,
+			FN: func(t *testing.T, result responseMessage) {
+				assert.Equal(t, result.Error["permission"], "must be 'read-only' or 'read-write'")
+			},
+		},
+		{
+			Name:   "ShareUser/NotOwner",
+			Auth:   tokenTwo,
+			Body:   `{"folder_id": 1, "user_email": "test2@example.com", "permission": "read-only"}`,
+			Method: http.MethodPost,
+			Route:  folder.FolderShareUserRoute,
+			Status: http.StatusUnauthorized,
+		},
+		{
+			Name:   "ShareUser/Success",
+			Auth:   token,
+			Body:   `{"folder_id": 1, "user_email": "test2@example.com", "permission": "read-only"}`,
+			Method: http.MethodPost,
+			Route:  folder.FolderShareUserRoute,
+			Status: http.StatusCreated,
+		},
+	}
+
+	for _, tc := range tests {
+		assert.RunHandlerTestCase(t, handler, tc.Method, tc.Route, tc)
+	}
+
+	// Shares apply to nested folders and their secrets
+	res = sendAuthRequest(handler, http.MethodGet, folder.FolderCRUDRoute+"?folder_id=2", "", tokenTwo)
+	assert.Equal(t, res, http.StatusOK)
+	res = sendAuthRequest(handler, http.MethodGet, secret.SecretCRUDRoute, `{"secret_id": 1}`, tokenTwo)
+	assert.Equal(t, res, http.StatusOK)
+	res = sendAuthRequest(handler, http.MethodGet, folder.GetFoldersSharedToUser, "", tokenTwo)
+	assert.Equal(t, res, http.StatusOK)
+
+	// Read-only users cannot update the secret
+	update := `{"secret_id": 1, "name": "renamed", "encrypted_data": "data", "iv": "iv"}`
+	res = sendAuthRequest(handler, http.MethodPatch, secret.SecretCRUDRoute, update, tokenTwo)
+	assert.Equal(t, res, http.StatusUnauthorized)
+
+	// Group shares on a subfolder grant write access, even over a read-only
+	// share of the secret itself
+	res = sendAuthRequest(handler, http.MethodPost, secret.SecretShareUserRoute, `{"secret_id": 1, "user_email": "test2@example.com", "permission": "read-only"}`, token)
+	assert.Equal(t, res, http.StatusCreated)
+	res = sendAuthRequest(handler, http.MethodPatch, secret.SecretCRUDRoute, update, tokenTwo)
+	assert.Equal(t, res, http.StatusUnauthorized)
+	res = sendAuthRequest(handler, http.MethodPost, group.CRUDGroupRoute, `{"group_name": "testgroup"}`, token)
+	assert.Equal(t, res, http.StatusCreated)
+	res = sendAuthRequest(handler, http.MethodPost, group.AddUserToGroupRoute, `{"group_name": "testgroup", "user_email": "test2@example.com"}`, token)
+	assert.Equal(t, res, http.StatusOK)
+	res = sendAuthRequest(handler, http.MethodPost, folder.FolderShareGroupRoute, `{"folder_id": 2, "group_name": "testgroup", "permission": "read-write"}`, token)
+	assert.Equal(t, res, http.StatusCreated)
+	res = sendAuthRequest(handler, http.MethodPatch, secret.SecretCRUDRoute, update, tokenTwo)
+	assert.Equal(t, res, http.StatusOK)
+
+	// Revoking removes access again
+	res = sendAuthRequest(handler, http.MethodDelete, folder.FolderShareGroupRoute, `{"folder_id": 2, "group_name": "testgroup"}`, token)
+	assert.Equal(t, res, http.StatusOK)
+	res = sendAuthRequest(handler, http.MethodDelete, folder.FolderShareUserRoute, `{"folder_id": 1, "user_email": "test2@example.com"}`, token)
+	assert.Equal(t, res, http.StatusOK)
+	res = sendAuthRequest(handler, http.MethodDelete, secret.SecretShareUserRoute, `{"secret_id": 1, "user_id": 2}`, token)
+	assert.Equal(t, res, http.StatusOK)
+	res = sendAuthRequest(handler, http.MethodGet, secret.SecretCRUDRoute, `{"secret_id": 1}`, tokenTwo)
+	assert.Equal(t, res, http.StatusUnauthorized)
+}
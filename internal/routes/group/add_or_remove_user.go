@@ -53,6 +53,10 @@ func (app *Group) addUser(w http.ResponseWriter, r *http.Request) {
 		app.rest.Error(w, err)
 		return
 	}
+	if err := middleware.CheckGroup(r, group.ID, "group.addUser"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
   // check if the user is creator of the group
 	if currUser.ID != currGroup.CreatorID {
 		app.rest.WriteJSON(w, "group.addUser", http.StatusUnauthorized, rest.Envelope{
@@ -109,6 +113,10 @@ func (app *Group) removeUser(w http.ResponseWriter, r *http.Request) {
 		app.rest.Error(w, err)
 		return
 	}
+	if err := middleware.CheckGroup(r, currGroup.ID, "group.removeUser"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
 	if currUser.ID != currGroup.CreatorID {
 		app.rest.WriteJSON(w, "group.removeUser", http.StatusUnauthorized, rest.Envelope{
 			"Message": "Only owner can remove member to the group",
@@ -1,11 +1,15 @@
 package group
 
 import (
+	"fmt"
+	"hash/fnv"
 	"net/http"
 
+	"pm4devs.strawhats/internal/models/group"
 	"pm4devs.strawhats/internal/rest"
 	"pm4devs.strawhats/internal/routes/middleware"
 	"pm4devs.strawhats/internal/validator"
+	"pm4devs.strawhats/internal/xerrors"
 )
 
 const CRUDGroupRoute = "/v1/groups"
@@ -48,6 +52,10 @@ func (app *Group) createNew(w http.ResponseWriter, r *http.Request) {
 		app.rest.Error(w, err)
 		return
 	}
+	if err := middleware.CheckGroup(r, 0, "group.createNew"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
 	currUser := middleware.ContextGetUser(r)
 	newGroup, err := app.group.NewRecord(input.GroupName, currUser.ID)
 	if err != nil {
@@ -91,11 +99,19 @@ func (app *Group) delete(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
-	err = app.group.DeleteByGroupID(currGroup.ID)
-	if err != nil {
+	if err := app.ifMatch(r, currGroup, "group.delete"); err != nil {
 		app.rest.Error(w, err)
 		return
 	}
+	if err := middleware.CheckGroup(r, currGroup.ID, "group.delete"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	err = app.group.DeleteByGroupID(currGroup.ID, currGroup.Version)
+	if err != nil {
+		app.rest.Error(w, rest.Precondition(r, err))
+		return
+	}
 	app.rest.WriteJSON(w, "group.delete", http.StatusNoContent, rest.Envelope{
 		"Message": "Success!",
 	})
@@ -132,11 +148,19 @@ func (app *Group) update(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
-	_, err = app.group.UpdateGroupName(input.NewGroupName, input.GroupName)
-	if err != nil {
+	if err := app.ifMatch(r, currGroup, "group.update"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	if err := middleware.CheckGroup(r, currGroup.ID, "group.update"); err != nil {
 		app.rest.Error(w, err)
 		return
 	}
+	_, err = app.group.UpdateGroupName(input.NewGroupName, input.GroupName, currGroup.Version)
+	if err != nil {
+		app.rest.Error(w, rest.Precondition(r, err))
+		return
+	}
 	app.rest.WriteJSON(w, "group.delete", http.StatusOK, rest.Envelope{
 		"Message": "Success!",
 	})
@@ -163,6 +187,13 @@ func (app *Group) get(w http.ResponseWriter, r *http.Request) {
 		app.rest.Error(w, err)
 		return
 	}
+	if err := middleware.CheckGroup(r, usersInGroup.ID, "group.get"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	if app.rest.NotModified(w, r, groupETag(usersInGroup, secretsInGroup)) {
+		return
+	}
 	app.rest.WriteJSON(w, "group.get", http.StatusOK, rest.Envelope{
 		"message": "Success!",
 		"data": rest.Envelope{
@@ -197,6 +228,9 @@ func (app *Group) getWithQuery(w http.ResponseWriter, r *http.Request) {
 		app.rest.Error(w, err)
 		return
 	}
+	if app.rest.NotModified(w, r, groupETag(usersInGroup, secretsInGroup)) {
+		return
+	}
 
 	app.rest.WriteJSON(w, "group.get", http.StatusOK, rest.Envelope{
 		"message": "Success!",
@@ -210,3 +244,27 @@ func (app *Group) getWithQuery(w http.ResponseWriter, r *http.Request) {
 		},
 	})
 }
+
+// Checks the If-Match header of a request changing a group
+func (app *Group) ifMatch(r *http.Request, currGroup *group.GroupRecordWithUsers, op string) *xerrors.AppError {
+	if r.Header.Get("If-Match") == "" {
+		return nil
+	}
+	secretsInGroup, err := app.group.GetGroupSharedSecrets(currGroup.Name)
+	if err != nil {
+		return err
+	}
+	return rest.IfMatch(r, groupETag(currGroup, secretsInGroup), op)
+}
+
+// Returns the ETag of a group as returned by GET. The version of the group
+// covers its name and members. The secrets shared with the group are part of
+// the response as well, so a digest of their versions and permissions is
+// added.
+func groupETag(currGroup *group.GroupRecordWithUsers, secretsInGroup *group.GroupRecordWithSecrets) string {
+	digest := fnv.New32a()
+	for _, secret := range secretsInGroup.Secrets {
+		fmt.Fprintf(digest, "%d:%d:%s,", secret.SecretID, secret.Version, secret.Permission)
+	}
+	return rest.ETag(currGroup.ID, currGroup.Version, fmt.Sprintf("%08x", digest.Sum32()))
+}
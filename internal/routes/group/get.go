@@ -2,8 +2,10 @@ package group
 
 import (
 	"net/http"
+	"slices"
 
-	"pm4devs.strawhats/internal/rest"
+	"pm4devs.strawhats/internal/models/core"
+	"pm4devs.strawhats/internal/models/group"
 	"pm4devs.strawhats/internal/routes/middleware"
 )
 
@@ -15,14 +17,22 @@ func (app *Group) listUserGroups(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	page, err := core.ParsePage(r.URL.Query(), "group.listUserGroups")
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
 	currUser := middleware.ContextGetUser(r)
-	groups, err := app.group.GetGroupsByUserID(currUser.ID)
+	groups, next, err := app.group.GetGroupsByUserID(currUser.ID, page)
 	if err != nil {
 		app.rest.Error(w, err)
 		return
 	}
-	app.rest.WriteJSON(w, "group.createNew", http.StatusOK, rest.Envelope{
-		"Message": "Success!",
-		"data":    groups,
+	// Access tokens restricted to some groups only list those, pages may come
+	// out shorter
+	accessToken := middleware.ContextGetAccessToken(r)
+	groups = slices.DeleteFunc(groups, func(record group.GroupRecord) bool {
+		return !accessToken.AllowsGroup(record.ID)
 	})
+	app.rest.WritePage(w, "group.listUserGroups", groups, page.Fields, next)
 }
@@ -5,6 +5,7 @@ import (
 
 	"pm4devs.strawhats/internal/app"
 	"pm4devs.strawhats/internal/mailer"
+	"pm4devs.strawhats/internal/models/accesstokens"
 	"pm4devs.strawhats/internal/models/group"
 	"pm4devs.strawhats/internal/models/secrets"
 	"pm4devs.strawhats/internal/models/tokens"
@@ -40,9 +41,11 @@ func New(app *app.App) *Group {
 }
 
 func (s *Group) Route(mux *http.ServeMux, mw *middleware.Middleware) {
-	mux.HandleFunc(CRUDGroupRoute, mw.Authenticated(s.CRUDRoute))
-	mux.HandleFunc(AddUserToGroupRoute, mw.Authenticated(s.addUser))
-	mux.HandleFunc(RemoveUserFromGroupRoute, mw.Authenticated(s.removeUser))
-	mux.HandleFunc(ListUserGroupRoute, mw.Authenticated(s.listUserGroups))
+	mux.HandleFunc(CRUDGroupRoute, mw.RequireScope(accesstokens.ScopeGroupsManage, s.CRUDRoute))
+	mux.HandleFunc(AddUserToGroupRoute, mw.RequireScope(accesstokens.ScopeGroupsManage, s.addUser))
+	mux.HandleFunc(RemoveUserFromGroupRoute, mw.RequireScope(accesstokens.ScopeGroupsManage, s.removeUser))
+	mux.HandleFunc(ListUserGroupRoute, mw.RequireScope(accesstokens.ScopeGroupsManage, s.listUserGroups))
 	mux.HandleFunc("/v1/ops/group", mw.Authenticated(s.getWithQuery))
+	mux.HandleFunc(GroupTrashRoute, mw.Authenticated(s.handleTrash))
+	mux.HandleFunc(ServiceAccountsRoute, mw.Authenticated(s.handleServiceAccounts))
 }
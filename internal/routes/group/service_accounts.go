@@ -0,0 +1,162 @@
+package group
+
+import (
+	"net/http"
+
+	"pm4devs.strawhats/internal/models/users"
+	"pm4devs.strawhats/internal/rest"
+	"pm4devs.strawhats/internal/routes/middleware"
+	"pm4devs.strawhats/internal/validator"
+	"pm4devs.strawhats/internal/xerrors"
+)
+
+const ServiceAccountsRoute = "/v1/service-accounts"
+
+func (app *Group) handleServiceAccounts(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		app.listServiceAccounts(w, r)
+
+	case http.MethodPost:
+		app.createServiceAccount(w, r)
+
+	case http.MethodDelete:
+		app.deleteServiceAccount(w, r)
+
+	default:
+		app.rest.MethodNotAllowed(w, r, "GET, POST, DELETE")
+	}
+}
+
+// Lists the service accounts of a group, to its members
+func (app *Group) listServiceAccounts(w http.ResponseWriter, r *http.Request) {
+	groupName := r.URL.Query().Get("group_name")
+	v := validator.New()
+	v.Check(len(groupName) > 0, "group_name", "must be provided")
+	if err := v.Valid("group.listServiceAccounts"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	currUser := middleware.ContextGetUser(r)
+	currGroup, err := app.group.GetGroupUsers(groupName)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	isMember, err := app.group.IsUserInGroup(currGroup.ID, currUser.ID)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	if err := xerrors.ClientUnauthorized(!isMember, "group.listServiceAccounts"); err != nil {
+		err.Data = "Only members can list the service accounts of the group"
+		app.rest.Error(w, err)
+		return
+	}
+
+	accounts, err := app.users.GetServiceAccounts(currGroup.ID)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	app.rest.WriteJSON(w, "group.listServiceAccounts", http.StatusOK, rest.Envelope{
+		"message": "Success!",
+		"data":    accounts,
+	})
+}
+
+// Creates a service account owned by a group, which joins it
+//
+// Its email identifies it to share secrets with it or add it to other groups,
+// and its access tokens are created with the service_account_id of /v1/tokens.
+func (app *Group) createServiceAccount(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		GroupName string `json:"group_name"`
+		Name      string `json:"name"`
+	}
+
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, "group.createServiceAccount", &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	// Validate parameters
+	v := validator.New()
+	v.Check(len(input.GroupName) > 0, "group_name", "must be provided")
+	users.ValidateServiceAccountName(v, input.Name, "name")
+	if err := v.Valid("group.createServiceAccount"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	currUser := middleware.ContextGetUser(r)
+	currGroup, err := app.group.GetGroupUsers(input.GroupName)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	if err := xerrors.ClientUnauthorized(currUser.ID != currGroup.CreatorID, "group.createServiceAccount"); err != nil {
+		err.Data = "Only owner can manage the service accounts of the group"
+		app.rest.Error(w, err)
+		return
+	}
+
+	account, err := app.users.InsertServiceAccount(input.Name, currGroup.ID)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	app.rest.WriteJSON(w, "group.createServiceAccount", http.StatusCreated, rest.Envelope{
+		"message": "Success!",
+		"data":    account,
+	})
+}
+
+// Deletes a service account, revoking its access tokens, memberships and
+// shares at once
+func (app *Group) deleteServiceAccount(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		ID int64 `json:"id"`
+	}
+
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, "group.deleteServiceAccount", &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	// Validate parameters
+	v := validator.New()
+	v.Check(input.ID > 0, "id", "must be provided")
+	if err := v.Valid("group.deleteServiceAccount"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	currUser := middleware.ContextGetUser(r)
+	account, err := app.users.GetServiceAccount(input.ID)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	currGroup, err := app.group.GetByGroupID(account.GroupID)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	if err := xerrors.ClientUnauthorized(currUser.ID != currGroup.CreatorID, "group.deleteServiceAccount"); err != nil {
+		err.Data = "Only owner can manage the service accounts of the group"
+		app.rest.Error(w, err)
+		return
+	}
+
+	if err := app.users.DeleteServiceAccount(account.ID); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	app.rest.WriteJSON(w, "group.deleteServiceAccount", http.StatusOK, rest.Envelope{
+		"message": "Success!",
+	})
+}
@@ -0,0 +1,106 @@
+package group
+
+import (
+	"net/http"
+
+	"pm4devs.strawhats/internal/models/core"
+	"pm4devs.strawhats/internal/rest"
+	"pm4devs.strawhats/internal/routes/middleware"
+	"pm4devs.strawhats/internal/validator"
+	"pm4devs.strawhats/internal/xerrors"
+)
+
+const GroupTrashRoute = "/v1/groups/trash"
+
+func (app *Group) handleTrash(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		app.listTrash(w, r)
+
+	case http.MethodPost:
+		app.restoreFromTrash(w, r)
+
+	case http.MethodDelete:
+		app.purgeFromTrash(w, r)
+
+	default:
+		app.rest.MethodNotAllowed(w, r, "GET, POST, DELETE")
+	}
+}
+
+// Lists the deleted groups created by the user
+func (app *Group) listTrash(w http.ResponseWriter, r *http.Request) {
+	page, err := core.ParsePage(r.URL.Query(), "group.listTrash")
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	currUser := middleware.ContextGetUser(r)
+	groups, next, err := app.group.GetDeletedByCreatorID(currUser.ID, page)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	app.rest.WritePage(w, "group.listTrash", groups, page.Fields, next)
+}
+
+// Restores a deleted group together with its members and shared secrets
+func (app *Group) restoreFromTrash(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		GroupID int64 `json:"group_id"`
+	}
+
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, "group.restoreFromTrash", &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	// Validate parameters
+	v := validator.New()
+	v.Check(input.GroupID > 0, "group_id", "must be provided")
+	if err := v.Valid("group.restoreFromTrash"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	currUser := middleware.ContextGetUser(r)
+	if err := app.group.Restore(input.GroupID, currUser.ID); err != nil {
+		err.If(xerrors.ErrUniqueViolation, func(err *xerrors.AppError) {
+			err.Data = "Another group is already using that name"
+		})
+		app.rest.Error(w, err)
+		return
+	}
+	app.rest.WriteJSON(w, "group.restoreFromTrash", http.StatusOK, rest.Envelope{
+		"message": "Success!",
+	})
+}
+
+// Permanently deletes a group from the trash
+func (app *Group) purgeFromTrash(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		GroupID int64 `json:"group_id"`
+	}
+
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, "group.purgeFromTrash", &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	// Validate parameters
+	v := validator.New()
+	v.Check(input.GroupID > 0, "group_id", "must be provided")
+	if err := v.Valid("group.purgeFromTrash"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	currUser := middleware.ContextGetUser(r)
+	if err := app.group.Purge(input.GroupID, currUser.ID); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -1,7 +1,9 @@
 package group
 
 import (
+	"bytes"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"pm4devs.strawhats/internal/app"
@@ -199,3 +201,19 @@ func groupHandler(app *app.App) http.HandlerFunc {
 		handler.ServeHTTP(w, r)
 	}
 }
+
+func sendAuthRequest(handler http.HandlerFunc, method, route, body, authToken string) int {
+	req := httptest.NewRequest(method, route, bytes.NewBufferString(body))
+
+	// If authToken is provided, set the Authorization header
+	if authToken != "" {
+		req.Header.Set("Authorization", "Bearer "+authToken)
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	resp := rr.Result()
+	defer resp.Body.Close()
+
+	return resp.StatusCode
+}
@@ -0,0 +1,86 @@
+package group
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"pm4devs.strawhats/internal/assert"
+	"pm4devs.strawhats/internal/mocks"
+	"pm4devs.strawhats/internal/routes/group"
+	"pm4devs.strawhats/internal/routes/utils"
+	"pm4devs.strawhats/internal/xerrors"
+)
+
+func TestGroupETags(t *testing.T) {
+	assert.Integration(t)
+	app := mocks.App(t)
+	handler := groupHandler(app)
+	authHandler := utils.AuthHandler(app)
+
+	credentials := `{"email": "test@example.com", "password": "password"}`
+	credentialsTwo := `{"email": "test2@example.com", "password": "password"}`
+
+	assert.Check(t, utils.RegisterUser(authHandler, credentials))
+	token := utils.LoginUser(authHandler, credentials)
+	assert.Check(t, utils.RegisterUser(authHandler, credentialsTwo))
+
+	res := sendAuthRequest(handler, http.MethodPost, group.CRUDGroupRoute, `{"group_name": "devops"}`, token)
+	assert.Equal(t, res, http.StatusCreated)
+
+	getData := `{"group_name": "devops"}`
+
+	status, etag := sendConditionalRequest(handler, http.MethodGet, getData, token, "", "")
+	assert.Equal(t, status, http.StatusOK)
+	assert.Check(t, etag != "")
+
+	status, _ = sendConditionalRequest(handler, http.MethodGet, getData, token, "If-None-Match", etag)
+	assert.Equal(t, status, http.StatusNotModified)
+
+	// Adding a member changes the group
+	addData := `{"group_name": "devops", "user_email": "test2@example.com"}`
+	res = sendAuthRequest(handler, http.MethodPost, group.AddUserToGroupRoute, addData, token)
+	assert.Equal(t, res, http.StatusOK)
+
+	status, newETag := sendConditionalRequest(handler, http.MethodGet, getData, token, "If-None-Match", etag)
+	assert.Equal(t, status, http.StatusOK)
+	assert.Check(t, newETag != etag)
+
+	// Renaming with the stale ETag fails, with the current one succeeds
+	updateData := `{"group_name": "devops", "new_group_name": "platform"}`
+	status, _ = sendConditionalRequest(handler, http.MethodPatch, updateData, token, "If-Match", etag)
+	assert.Equal(t, status, http.StatusPreconditionFailed)
+
+	status, _ = sendConditionalRequest(handler, http.MethodPatch, updateData, token, "If-Match", newETag)
+	assert.Equal(t, status, http.StatusOK)
+
+	status, _ = sendConditionalRequest(handler, http.MethodDelete, `{"group_name": "platform"}`, token, "If-Match", newETag)
+	assert.Equal(t, status, http.StatusPreconditionFailed)
+
+	// Deletes racing an update find a newer version than they checked
+	platform, err := app.Models.Group.GetGroupUsers("platform")
+	assert.Check(t, err == nil)
+	appErr := app.Models.Group.DeleteByGroupID(platform.ID, platform.Version-1)
+	assert.Check(t, appErr != nil && appErr.Matches(xerrors.ErrEditConflict))
+
+	status, _ = sendConditionalRequest(handler, http.MethodDelete, `{"group_name": "platform"}`, token, "If-Match", "*")
+	assert.Equal(t, status, http.StatusNoContent)
+}
+
+// Sends a request to the group CRUD route with an optional conditional
+// header, returning the status and ETag of the response
+func sendConditionalRequest(handler http.HandlerFunc, method, body, authToken, header, value string) (int, string) {
+	req := httptest.NewRequest(method, group.CRUDGroupRoute, bytes.NewBufferString(body))
+	req.Header.Set("Authorization", "Bearer "+authToken)
+	if header != "" {
+		req.Header.Set(header, value)
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	resp := rr.Result()
+	defer resp.Body.Close()
+
+	return resp.StatusCode, resp.Header.Get("ETag")
+}
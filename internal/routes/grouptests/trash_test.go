@@ -0,0 +1,120 @@
+package group
+
+import (
+	"net/http"
+	"testing"
+
+	"pm4devs.strawhats/internal/assert"
+	"pm4devs.strawhats/internal/mocks"
+	"pm4devs.strawhats/internal/routes/group"
+	"pm4devs.strawhats/internal/routes/utils"
+)
+
+func TestGroupTrash(t *testing.T) {
+	assert.Integration(t)
+	app := mocks.App(t)
+	handler := groupHandler(app)
+	authHandler := utils.AuthHandler(app)
+
+	credentials := `{"email": "test@example.com", "password": "password"}`
+	credentialsTwo := `{"email": "test2@example.com", "password": "password"}`
+
+	assert.Check(t, utils.RegisterUser(authHandler, credentials))
+	token := utils.LoginUser(authHandler, credentials)
+	assert.Check(t, len(token) > 0)
+
+	assert.Check(t, utils.RegisterUser(authHandler, credentialsTwo))
+	tokenTwo := utils.LoginUser(authHandler, credentialsTwo)
+	assert.Check(t, len(tokenTwo) > 0)
+
+	type responseMessage struct {
+		Error   map[string]string `json:"error"`
+		Message string            `json:"message"`
+		Data    []map[string]any  `json:"data"`
+	}
+
+	// Seed – create and delete two groups with the same name
+	for i := 1; i <= 2; i++ {
+		status := sendAuthRequest(handler, http.MethodPost, group.CRUDGroupRoute, `{"group_name": "testgroup"}`, token)
+		assert.Equal(t, status, http.StatusCreated)
+
+		status = sendAuthRequest(handler, http.MethodDelete, group.CRUDGroupRoute, `{"group_name": "testgroup"}`, token)
+		assert.Equal(t, status, http.StatusNoContent)
+	}
+
+	tests := []assert.HandlerTestCase[responseMessage]{
+		{
+			Name:   "AuthRequired",
+			Status: http.StatusUnauthorized,
+			Method: http.MethodGet,
+		},
+		{
+			Name:   "MethodNotAllowed/PUT",
+			Auth:   token,
+			Status: http.StatusMethodNotAllowed,
+			Method: http.MethodPut,
+		},
+		{
+			Name:   "List/GET",
+			Auth:   token,
+			Status: http.StatusOK,
+			Method: http.MethodGet,
+			FN: func(t *testing.T, result responseMessage) {
+				assert.Equal(t, len(result.Data), 2)
+			},
+		},
+		{
+			Name:   "InvalidGroupID/POST",
+			Auth:   token,
+			Body:   `{"group_id": 0}`,
+			Status: http.StatusUnprocessableEntity,
+			Method: http.MethodPost,
+			FN: func(t *testing.T, result responseMessage) {
+				assert.Equal(t, result.Error["group_id"], "must be provided")
+			},
+		},
+		{
+			Name:   "NotOwner/POST",
+			Auth:   tokenTwo,
+			Body:   `{"group_id": 1}`,
+			Status: http.StatusNotFound,
+			Method: http.MethodPost,
+		},
+		{
+			Name:   "Restore/POST",
+			Auth:   token,
+			Body:   `{"group_id": 1}`,
+			Status: http.StatusOK,
+			Method: http.MethodPost,
+		},
+		{
+			Name:   "NameTaken/POST",
+			Auth:   token,
+			Body:   `{"group_id": 2}`,
+			Status: http.StatusConflict,
+			Method: http.MethodPost,
+		},
+		{
+			Name:   "Purge/DELETE",
+			Auth:   token,
+			Body:   `{"group_id": 2}`,
+			Status: http.StatusNoContent,
+			Method: http.MethodDelete,
+		},
+		{
+			Name:   "PurgeNotInTrash/DELETE",
+			Auth:   token,
+			Body:   `{"group_id": 1}`,
+			Status: http.StatusNotFound,
+			Method: http.MethodDelete,
+		},
+	}
+
+	for _, tc := range tests {
+		assert.RunHandlerTestCase(t, handler, tc.Method, group.GroupTrashRoute, tc)
+	}
+
+	// The restored group is accessible again
+	status := sendAuthRequest(handler, http.MethodGet, group.CRUDGroupRoute, `{"group_name": "testgroup"}`, token)
+	assert.Equal(t, status, http.StatusOK)
+}
@@ -0,0 +1,172 @@
+package keys
+
+import (
+	"net/http"
+
+	"pm4devs.strawhats/internal/app"
+	"pm4devs.strawhats/internal/models/accesstokens"
+	"pm4devs.strawhats/internal/models/keys"
+	"pm4devs.strawhats/internal/rest"
+	"pm4devs.strawhats/internal/routes/middleware"
+	"pm4devs.strawhats/internal/validator"
+	"pm4devs.strawhats/internal/xerrors"
+	"pm4devs.strawhats/internal/xlogger"
+)
+
+// Encapsulates the Application dependencies required by routes
+type Keys struct {
+	logger xlogger.Logger
+	rest   *rest.Rest
+	keys   keys.KeysRepository
+}
+
+func New(app *app.App) *Keys {
+	return &Keys{
+		logger: app.Logger,
+		rest:   app.Rest,
+		keys:   app.Models.Keys,
+	}
+}
+
+func (k *Keys) Route(mux *http.ServeMux, mw *middleware.Middleware) {
+	mux.HandleFunc("GET "+KeysRoute, mw.RequireScope(accesstokens.ScopeSecretsRead, k.handleKeys))
+	mux.HandleFunc(KeysRoute, mw.Authenticated(k.handleKeys))
+	mux.HandleFunc(KeyHistoryRoute, mw.Authenticated(k.history))
+}
+
+// ============================================================================
+// Keys
+// ============================================================================
+
+const KeysRoute = "/v1/keys"
+
+func (app *Keys) handleKeys(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		app.get(w, r)
+	case http.MethodPut:
+		app.rotate(w, r)
+	case http.MethodDelete:
+		app.revoke(w, r)
+	default:
+		app.rest.MethodNotAllowed(w, r, "GET, PUT, DELETE")
+	}
+}
+
+// Gets the active public key of a user to wrap content keys for them, or the
+// caller's own key pair when no email is given so a new device can unlock it
+func (app *Keys) get(w http.ResponseWriter, r *http.Request) {
+	email := r.URL.Query().Get("email")
+
+	var key *keys.KeyRecord
+	var err *xerrors.AppError
+	if email == "" {
+		key, err = app.keys.GetActive(middleware.ContextGetUser(r).ID)
+	} else {
+		key, err = app.keys.GetByEmail(email)
+	}
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	app.rest.WriteJSON(w, "keys.get", http.StatusOK, rest.Envelope{
+		"message": "Success!",
+		"data":    key,
+	})
+}
+
+// Registers a new key pair for the user, retiring the active one
+func (app *Keys) rotate(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		PublicKey           string `json:"public_key"`
+		EncryptedPrivateKey string `json:"encrypted_private_key"`
+	}
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, "keys.rotate", &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	// Validate parameters
+	v := validator.New()
+	v.Check(len(input.PublicKey) > 0, "public_key", "must be provided")
+	v.Check(len(input.EncryptedPrivateKey) > 0, "encrypted_private_key", "must be provided")
+	if err := v.Valid("keys.rotate"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	user := middleware.ContextGetUser(r)
+	key, err := app.keys.Rotate(user.ID, input.PublicKey, input.EncryptedPrivateKey)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	app.rest.WriteJSON(w, "keys.rotate", http.StatusCreated, rest.Envelope{
+		"message": "Success!",
+		"data":    key,
+	})
+}
+
+// Revokes a compromised key of the user, the active one by default
+//
+// The secrets with a content key wrapped with it are flagged for re-keying.
+func (app *Keys) revoke(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Fingerprint string `json:"fingerprint"`
+	}
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, "keys.revoke", &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	user := middleware.ContextGetUser(r)
+	key, flagged, err := app.keys.Revoke(user.ID, input.Fingerprint)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	key.EncryptedPrivateKey = nil
+	app.rest.WriteJSON(w, "keys.revoke", http.StatusOK, rest.Envelope{
+		"message":        "Success!",
+		"data":           key,
+		"rekey_required": flagged,
+	})
+}
+
+// ============================================================================
+// History
+// ============================================================================
+
+const KeyHistoryRoute = "/v1/keys/history"
+
+// Lists every key of a user, newest first, so content keys wrapped with a
+// retired key can still be resolved by fingerprint. The encrypted private
+// keys are only included in the caller's own history.
+func (app *Keys) history(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		app.rest.MethodNotAllowed(w, r, "GET")
+		return
+	}
+
+	user := middleware.ContextGetUser(r)
+	email := r.URL.Query().Get("email")
+	if email == "" {
+		email = user.Email
+	}
+
+	history, err := app.keys.GetHistory(email)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	if email != user.Email {
+		for _, key := range history {
+			key.EncryptedPrivateKey = nil
+		}
+	}
+	app.rest.WriteJSON(w, "keys.history", http.StatusOK, rest.Envelope{
+		"message": "Success!",
+		"data":    history,
+	})
+}
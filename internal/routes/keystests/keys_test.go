@@ -0,0 +1,221 @@
+package keys
+
+import (
+	"net/http"
+	"testing"
+
+	"pm4devs.strawhats/internal/assert"
+	"pm4devs.strawhats/internal/mocks"
+	modelkeys "pm4devs.strawhats/internal/models/keys"
+	"pm4devs.strawhats/internal/routes/keys"
+	"pm4devs.strawhats/internal/routes/secret"
+	"pm4devs.strawhats/internal/routes/utils"
+)
+
+type keyResponse struct {
+	Error         map[string]string `json:"error"`
+	RekeyRequired int64             `json:"rekey_required"`
+	Data          struct {
+		Email               string  `json:"email"`
+		Version             int     `json:"version"`
+		PublicKey           string  `json:"public_key"`
+		EncryptedPrivateKey *string `json:"encrypted_private_key"`
+		Fingerprint         string  `json:"fingerprint"`
+		Status              string  `json:"status"`
+	} `json:"data"`
+}
+
+func TestPublicKeys(t *testing.T) {
+	assert.Integration(t)
+	app := mocks.App(t)
+	handler := keysHandler(app)
+	authHandler := utils.AuthHandler(app)
+
+	credentials := `{"email": "test@example.com", "password": "password"}`
+	assert.Check(t, utils.RegisterUser(authHandler, credentials))
+	token := utils.LoginUser(authHandler, credentials)
+	assert.Check(t, len(token) > 0)
+
+	otherCredentials := `{"email": "other@example.com", "password": "password"}`
+	assert.Check(t, utils.RegisterUser(authHandler, otherCredentials))
+	otherToken := utils.LoginUser(authHandler, otherCredentials)
+	assert.Check(t, len(otherToken) > 0)
+
+	tests := []assert.HandlerTestCase[keyResponse]{
+		{
+			Name:   "Unauthenticated",
+			Method: http.MethodPut,
+			Route:  keys.KeysRoute,
+			Body:   `{"public_key": "key-1", "encrypted_private_key": "private-1"}`,
+			Status: http.StatusUnauthorized,
+		},
+		{
+			Name:   "MissingKeys",
+			Method: http.MethodPut,
+			Route:  keys.KeysRoute,
+			Body:   `{}`,
+			Auth:   token,
+			Status: http.StatusUnprocessableEntity,
+			FN: func(t *testing.T, result keyResponse) {
+				assert.Equal(t, result.Error["public_key"], "must be provided")
+				assert.Equal(t, result.Error["encrypted_private_key"], "must be provided")
+			},
+		},
+		{
+			Name:   "NotRegistered",
+			Method: http.MethodGet,
+			Route:  keys.KeysRoute + "?email=test@example.com",
+			Auth:   otherToken,
+			Status: http.StatusNotFound,
+		},
+		{
+			Name:   "Register",
+			Method: http.MethodPut,
+			Route:  keys.KeysRoute,
+			Body:   `{"public_key": "key-1", "encrypted_private_key": "private-1"}`,
+			Auth:   token,
+			Status: http.StatusCreated,
+			FN: func(t *testing.T, result keyResponse) {
+				assert.Equal(t, result.Data.Version, 1)
+				assert.Equal(t, result.Data.Status, string(modelkeys.StatusActive))
+				assert.Equal(t, result.Data.Fingerprint, modelkeys.Fingerprint("key-1"))
+			},
+		},
+		{
+			Name:   "Rotate",
+			Method: http.MethodPut,
+			Route:  keys.KeysRoute,
+			Body:   `{"public_key": "key-2", "encrypted_private_key": "private-2"}`,
+			Auth:   token,
+			Status: http.StatusCreated,
+			FN: func(t *testing.T, result keyResponse) {
+				assert.Equal(t, result.Data.Version, 2)
+			},
+		},
+		{
+			Name:   "GetOwn",
+			Method: http.MethodGet,
+			Route:  keys.KeysRoute,
+			Auth:   token,
+			Status: http.StatusOK,
+			FN: func(t *testing.T, result keyResponse) {
+				assert.Equal(t, result.Data.PublicKey, "key-2")
+				assert.Equal(t, *result.Data.EncryptedPrivateKey, "private-2")
+			},
+		},
+		{
+			Name:   "GetByEmail",
+			Method: http.MethodGet,
+			Route:  keys.KeysRoute + "?email=test@example.com",
+			Auth:   otherToken,
+			Status: http.StatusOK,
+			FN: func(t *testing.T, result keyResponse) {
+				assert.Equal(t, result.Data.Email, "test@example.com")
+				assert.Equal(t, result.Data.PublicKey, "key-2")
+				assert.Equal(t, result.Data.Fingerprint, modelkeys.Fingerprint("key-2"))
+				assert.Check(t, result.Data.EncryptedPrivateKey == nil)
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		assert.RunHandlerTestCase(t, handler, tc.Method, tc.Route, tc)
+	}
+
+	type historyResponse struct {
+		Data []struct {
+			Version             int     `json:"version"`
+			EncryptedPrivateKey *string `json:"encrypted_private_key"`
+			Status              string  `json:"status"`
+		} `json:"data"`
+	}
+
+	history := []assert.HandlerTestCase[historyResponse]{
+		{
+			Name:   "OwnHistory",
+			Route:  keys.KeyHistoryRoute,
+			Auth:   token,
+			Status: http.StatusOK,
+			FN: func(t *testing.T, result historyResponse) {
+				assert.Equal(t, len(result.Data), 2)
+				assert.Equal(t, result.Data[0].Version, 2)
+				assert.Equal(t, result.Data[1].Status, string(modelkeys.StatusRetired))
+				assert.Equal(t, *result.Data[1].EncryptedPrivateKey, "private-1")
+			},
+		},
+		{
+			Name:   "OtherHistory",
+			Route:  keys.KeyHistoryRoute + "?email=test@example.com",
+			Auth:   otherToken,
+			Status: http.StatusOK,
+			FN: func(t *testing.T, result historyResponse) {
+				assert.Equal(t, len(result.Data), 2)
+				assert.Check(t, result.Data[0].EncryptedPrivateKey == nil)
+				assert.Check(t, result.Data[1].EncryptedPrivateKey == nil)
+			},
+		},
+	}
+
+	for _, tc := range history {
+		assert.RunHandlerTestCase(t, handler, http.MethodGet, tc.Route, tc)
+	}
+}
+
+func TestRevokeKey(t *testing.T) {
+	assert.Integration(t)
+	app := mocks.App(t)
+	handler := keysHandler(app)
+	authHandler := utils.AuthHandler(app)
+
+	credentials := `{"email": "test@example.com", "password": "password"}`
+	assert.Check(t, utils.RegisterUser(authHandler, credentials))
+	token := utils.LoginUser(authHandler, credentials)
+	assert.Check(t, len(token) > 0)
+
+	res := sendAuthRequest(handler, http.MethodPut, keys.KeysRoute,
+		`{"public_key": "key-1", "encrypted_private_key": "private-1"}`, token)
+	assert.Equal(t, res, http.StatusCreated)
+
+	// The owner's content key is wrapped with the key about to be revoked
+	secretData := `{"encrypted_data": "data", "name": "testname", "iv": "iv", "wrapped_key": "owner-key", "key_fingerprint": "` +
+		modelkeys.Fingerprint("key-1") + `"}`
+	res = sendAuthRequest(handler, http.MethodPost, secret.SecretCRUDRoute, secretData, token)
+	assert.Equal(t, res, http.StatusCreated)
+
+	current, err := app.Models.Secrets.GetSecretByID(1)
+	assert.Check(t, err == nil)
+	assert.Equal(t, *current.KeyFingerprint, modelkeys.Fingerprint("key-1"))
+
+	tests := []assert.HandlerTestCase[keyResponse]{
+		{
+			Name:   "UnknownFingerprint",
+			Body:   `{"fingerprint": "SHA256:unknown"}`,
+			Auth:   token,
+			Status: http.StatusNotFound,
+		},
+		{
+			Name:   "Success",
+			Body:   `{}`,
+			Auth:   token,
+			Status: http.StatusOK,
+			FN: func(t *testing.T, result keyResponse) {
+				assert.Equal(t, result.Data.Status, string(modelkeys.StatusRevoked))
+				assert.Equal(t, result.RekeyRequired, int64(1))
+			},
+		},
+		{
+			Name:   "NoActiveKey",
+			Body:   `{}`,
+			Auth:   token,
+			Status: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range tests {
+		assert.RunHandlerTestCase(t, handler, http.MethodDelete, keys.KeysRoute, tc)
+	}
+
+	current, err = app.Models.Secrets.GetSecretByID(1)
+	assert.Check(t, err == nil)
+	assert.Check(t, current.RekeyRequired)
+}
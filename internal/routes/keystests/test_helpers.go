@@ -0,0 +1,52 @@
+package keys
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+
+	"pm4devs.strawhats/internal/app"
+	"pm4devs.strawhats/internal/routes/group"
+	"pm4devs.strawhats/internal/routes/keys"
+	"pm4devs.strawhats/internal/routes/middleware"
+	"pm4devs.strawhats/internal/routes/secret"
+)
+
+// ============================================================================
+// Helpers
+// ============================================================================
+
+// Creates a complete Keys handler including middleware. The secrets and group
+// routes are included to share secrets with wrapped keys.
+func keysHandler(app *app.App) http.HandlerFunc {
+	handler := func() http.Handler {
+		mux := http.NewServeMux()
+
+		middleware := middleware.New(app)
+		keys.New(app).Route(mux, middleware)
+		secret.New(app).Route(mux, middleware)
+		group.New(app).Route(mux, middleware)
+
+		return middleware.User(mux)
+	}()
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r)
+	}
+}
+
+func sendAuthRequest(handler http.HandlerFunc, method, route, body, authToken string) int {
+	req := httptest.NewRequest(method, route, bytes.NewBufferString(body))
+
+	// If authToken is provided, set the Authorization header
+	if authToken != "" {
+		req.Header.Set("Authorization", "Bearer "+authToken)
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	resp := rr.Result()
+	defer resp.Body.Close()
+
+	return resp.StatusCode
+}
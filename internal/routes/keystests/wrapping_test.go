@@ -0,0 +1,178 @@
+package keys
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"pm4devs.strawhats/internal/assert"
+	"pm4devs.strawhats/internal/mocks"
+	modelkeys "pm4devs.strawhats/internal/models/keys"
+	"pm4devs.strawhats/internal/routes/group"
+	"pm4devs.strawhats/internal/routes/keys"
+	"pm4devs.strawhats/internal/routes/secret"
+	"pm4devs.strawhats/internal/routes/utils"
+)
+
+func TestWrappedKeys(t *testing.T) {
+	assert.Integration(t)
+	app := mocks.App(t)
+	handler := keysHandler(app)
+	authHandler := utils.AuthHandler(app)
+
+	// Register and login the owner and two recipients, each with a key pair
+	tokens, fingerprints := map[string]string{}, map[string]string{}
+	for _, email := range []string{"owner@example.com", "alice@example.com", "bob@example.com"} {
+		credentials := `{"email": "` + email + `", "password": "password"}`
+		assert.Check(t, utils.RegisterUser(authHandler, credentials))
+		tokens[email] = utils.LoginUser(authHandler, credentials)
+		assert.Check(t, len(tokens[email]) > 0)
+
+		res := sendAuthRequest(handler, http.MethodPut, keys.KeysRoute,
+			`{"public_key": "`+email+`", "encrypted_private_key": "private"}`, tokens[email])
+		assert.Equal(t, res, http.StatusCreated)
+		fingerprints[email] = modelkeys.Fingerprint(email)
+	}
+	owner, alice, bob := tokens["owner@example.com"], tokens["alice@example.com"], tokens["bob@example.com"]
+
+	secretData := fmt.Sprintf(`{"encrypted_data": "data", "name": "testname", "iv": "iv", "wrapped_key": "owner-key", "key_fingerprint": %q}`,
+		fingerprints["owner@example.com"])
+	res := sendAuthRequest(handler, http.MethodPost, secret.SecretCRUDRoute, secretData, owner)
+	assert.Equal(t, res, http.StatusCreated)
+
+	// Alice gets the secret directly, Bob through a group
+	share := fmt.Sprintf(`{"secret_id": 1, "user_email": "alice@example.com", "permission": "read-only", "wrapped_key": "alice-key", "key_fingerprint": %q}`,
+		fingerprints["alice@example.com"])
+	res = sendAuthRequest(handler, http.MethodPost, secret.SecretShareUserRoute, share, owner)
+	assert.Equal(t, res, http.StatusCreated)
+
+	res = sendAuthRequest(handler, http.MethodPost, group.CRUDGroupRoute, `{"group_name": "readers"}`, owner)
+	assert.Equal(t, res, http.StatusCreated)
+	res = sendAuthRequest(handler, http.MethodPost, group.AddUserToGroupRoute,
+		`{"group_name": "readers", "user_email": "bob@example.com"}`, owner)
+	assert.Equal(t, res, http.StatusOK)
+
+	type responseMessage struct {
+		Error   map[string]string `json:"error"`
+		Message string            `json:"message"`
+		Data    []struct {
+			WrappedKey *string `json:"wrapped_key"`
+		} `json:"data"`
+	}
+
+	shareTests := []assert.HandlerTestCase[responseMessage]{
+		{
+			Name:   "KeyForNonMember",
+			Body:   `{"secret_id": 1, "group_name": "readers", "permission": "read-only", "wrapped_keys": {"alice@example.com": "alice-key"}}`,
+			Auth:   owner,
+			Status: http.StatusUnprocessableEntity,
+			FN: func(t *testing.T, result responseMessage) {
+				assert.Equal(t, result.Error["wrapped_keys"], "alice@example.com is not a member of the group")
+			},
+		},
+		{
+			Name:   "MissingFingerprint",
+			Body:   `{"secret_id": 1, "group_name": "readers", "permission": "read-only", "wrapped_keys": {"bob@example.com": "bob-key"}}`,
+			Auth:   owner,
+			Status: http.StatusUnprocessableEntity,
+			FN: func(t *testing.T, result responseMessage) {
+				assert.Equal(t, result.Error["key_fingerprints"], "must be provided for bob@example.com")
+			},
+		},
+		{
+			Name: "WrappedWithOtherKey",
+			Body: `{"secret_id": 1, "group_name": "readers", "permission": "read-only", "wrapped_keys": {"bob@example.com": "bob-key"},
+				"key_fingerprints": {"bob@example.com": "SHA256:retired"}}`,
+			Auth:   owner,
+			Status: http.StatusConflict,
+		},
+		{
+			Name: "Success",
+			Body: fmt.Sprintf(`{"secret_id": 1, "group_name": "readers", "permission": "read-only", "wrapped_keys": {"bob@example.com": "bob-key"},
+				"key_fingerprints": {"bob@example.com": %q}}`, fingerprints["bob@example.com"]),
+			Auth:   owner,
+			Status: http.StatusCreated,
+		},
+	}
+
+	for _, tc := range shareTests {
+		assert.RunHandlerTestCase(t, handler, http.MethodPost, secret.SecretShareGroupRoute, tc)
+	}
+
+	// Each recipient only sees the key wrapped for them
+	listings := []assert.HandlerTestCase[responseMessage]{
+		{
+			Name:   "DirectShare",
+			Route:  secret.GetSecretsSharedToUser,
+			Method: http.MethodGet,
+			Auth:   alice,
+			Status: http.StatusOK,
+			FN: func(t *testing.T, result responseMessage) {
+				assert.Equal(t, len(result.Data), 1)
+				assert.Equal(t, *result.Data[0].WrappedKey, "alice-key")
+			},
+		},
+		{
+			Name:   "GroupShare",
+			Route:  secret.GetGroupSecretsRoute,
+			Method: http.MethodGet,
+			Body:   `{"group_name": "readers"}`,
+			Auth:   bob,
+			Status: http.StatusOK,
+			FN: func(t *testing.T, result responseMessage) {
+				assert.Equal(t, len(result.Data), 1)
+				assert.Equal(t, *result.Data[0].WrappedKey, "bob-key")
+			},
+		},
+		{
+			Name:   "Owner",
+			Route:  secret.GetUserSecretsRoute,
+			Method: http.MethodGet,
+			Auth:   owner,
+			Status: http.StatusOK,
+			FN: func(t *testing.T, result responseMessage) {
+				assert.Equal(t, *result.Data[0].WrappedKey, "owner-key")
+			},
+		},
+	}
+
+	for _, tc := range listings {
+		assert.RunHandlerTestCase(t, handler, tc.Method, tc.Route, tc)
+	}
+
+	// Revoking Alice requires a new content key before sharing again
+	res = sendAuthRequest(handler, http.MethodDelete, secret.SecretShareUserRoute,
+		`{"secret_id": 1, "user_email": "alice@example.com"}`, owner)
+	assert.Equal(t, res, http.StatusOK)
+
+	current, err := app.Models.Secrets.GetSecretByID(1)
+	assert.Check(t, err == nil)
+	assert.Check(t, current.RekeyRequired)
+
+	res = sendAuthRequest(handler, http.MethodPost, secret.SecretShareUserRoute, share, owner)
+	assert.Equal(t, res, http.StatusConflict)
+
+	rekey := fmt.Sprintf(`{"secret_id": 1, "encrypted_data": "new-data", "iv": "new-iv", "owner_key": "new-owner-key",
+		"group_keys": {"readers": {"bob@example.com": "new-bob-key"}},
+		"key_fingerprints": {"owner@example.com": %q, "bob@example.com": %q}}`,
+		fingerprints["owner@example.com"], fingerprints["bob@example.com"])
+	res = sendAuthRequest(handler, http.MethodPost, secret.SecretRekeyRoute, rekey, owner)
+	assert.Equal(t, res, http.StatusOK)
+
+	current, err = app.Models.Secrets.GetSecretByID(1)
+	assert.Check(t, err == nil)
+	assert.Check(t, !current.RekeyRequired)
+	assert.Equal(t, *current.WrappedKey, "new-owner-key")
+
+	bobKey, err := app.Models.Secrets.GetWrappedKey(1, 3)
+	assert.Check(t, err == nil)
+	assert.Equal(t, bobKey.WrappedKey, "new-bob-key")
+
+	// The version kept by the re-key is encrypted with the previous content key
+	rollback := fmt.Sprintf(`{"secret_id": 1, "version": %d}`, current.Version-1)
+	res = sendAuthRequest(handler, http.MethodPost, secret.SecretRollbackRoute, rollback, owner)
+	assert.Equal(t, res, http.StatusConflict)
+
+	res = sendAuthRequest(handler, http.MethodPost, secret.SecretShareUserRoute, share, owner)
+	assert.Equal(t, res, http.StatusCreated)
+}
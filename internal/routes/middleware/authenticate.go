@@ -11,6 +11,13 @@ func (mw *Middleware) Authenticated(next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user := ContextGetUser(r)
 
+		// Personal access tokens are only accepted by routes requiring a scope
+		if user.IsAnonymous() && ContextGetAccessToken(r) != nil {
+			mw.rest.Error(w, xerrors.ClientError(http.StatusForbidden,
+				"Access tokens can't be used for this request", "middleware.Authenticated", xerrors.ErrUnauthorized))
+			return
+		}
+
 		err := xerrors.ClientUnauthorized(user.IsAnonymous(), "middleware.Authenticated")
 		if err != nil {
 			mw.rest.Error(w, err)
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+
+	"pm4devs.strawhats/internal/models/tokens"
+)
+
+// Longest device name kept, in bytes
+const maxDeviceName = 100
+
+// Header clients name the device they run on with
+const DeviceNameHeader = "Device-Name"
+
+// Returns the client a request was made from
+//
+// The IP is the address of the peer, requests forwarded by a proxy all share
+// the address of the proxy.
+func Client(r *http.Request) tokens.Client {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	device := r.Header.Get(DeviceNameHeader)
+	if len(device) > maxDeviceName {
+		device = device[:maxDeviceName]
+	}
+
+	return tokens.Client{Device: device, UserAgent: r.UserAgent(), IP: ip}
+}
@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"pm4devs.strawhats/internal/models/accesstokens"
+	"pm4devs.strawhats/internal/models/users"
+	"pm4devs.strawhats/internal/xerrors"
+)
+
+// ===========================================================================
+// Scope Middleware
+// ===========================================================================
+
+// Requires personal access tokens to carry a scope for a request to be
+// performed, and lets them act as their user. Requests made with a session
+// are not limited.
+//
+// Internally, this will require the user to be authenticated
+func (mw *Middleware) RequireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	fn := mw.Authenticated(next)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		accessToken, ok := r.Context().Value(accessTokenContextKey).(*accessTokenContext)
+		if ok {
+			if !accessToken.token.Includes(scope) {
+				mw.rest.Error(w, xerrors.ClientError(http.StatusForbidden,
+					"The access token is missing the "+scope+" scope", "middleware.RequireScope",
+					xerrors.ErrUnauthorized))
+				return
+			}
+
+			r = contextSetUser(r, accessToken.user)
+		}
+
+		fn(w, r)
+	}
+}
+
+// Checks that the access token of a request reaches a secret. New secrets,
+// with a zero ID, are out of reach of tokens restricted to some secrets.
+func CheckSecret(r *http.Request, secretID int64, op string) *xerrors.AppError {
+	if ContextGetAccessToken(r).AllowsSecret(secretID) {
+		return nil
+	}
+	return xerrors.ClientError(http.StatusForbidden, "The access token can't be used for this secret", op,
+		xerrors.ErrUnauthorized)
+}
+
+// Checks that the access token of a request reaches a group. New groups, with a
+// zero ID, are out of reach of tokens restricted to some groups.
+func CheckGroup(r *http.Request, groupID int64, op string) *xerrors.AppError {
+	if ContextGetAccessToken(r).AllowsGroup(groupID) {
+		return nil
+	}
+	return xerrors.ClientError(http.StatusForbidden, "The access token can't be used for this group", op,
+		xerrors.ErrUnauthorized)
+}
+
+// ============================================================================
+// Context: Access Token
+// ===========================================================================
+
+// The contextKey for storing the personal access token of a request
+const accessTokenContextKey = contextKey("access_token")
+
+// Personal access token of a request, along with the user it acts as
+type accessTokenContext struct {
+	token *accesstokens.AccessToken
+	user  *users.UserRecord
+}
+
+// Retrieves the personal access token a request was made with, nil for
+// requests made with a session or without a token
+func ContextGetAccessToken(r *http.Request) *accesstokens.AccessToken {
+	accessToken, ok := r.Context().Value(accessTokenContextKey).(*accessTokenContext)
+
+	if !ok {
+		return nil
+	}
+
+	return accessToken.token
+}
+
+// Returns a new copy of the request with the access token and its user added
+// to the context
+func contextSetAccessToken(r *http.Request, token *accesstokens.AccessToken, user *users.UserRecord) *http.Request {
+	ctx := context.WithValue(r.Context(), accessTokenContextKey, &accessTokenContext{token: token, user: user})
+	return r.WithContext(ctx)
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"strings"
 
+	"pm4devs.strawhats/internal/models/accesstokens"
 	"pm4devs.strawhats/internal/models/users"
 	"pm4devs.strawhats/internal/xerrors"
 )
@@ -31,25 +32,51 @@ func (mw *Middleware) User(next http.Handler) http.Handler {
 			return
 		}
 		if token == "" {
-			r = contextSetToken(r, token)
+			r = contextSetSession(r, 0)
 			r = contextSetUser(r, users.AnonymousUser)
 			next.ServeHTTP(w, r)
 			return
 		}
 
-		// Fetch the user's details and add them to the context
-		user, err := mw.users.GetByToken(token)
+		// Personal access tokens only act as their user on the routes that
+		// require a scope, which check the token and add its user
+		if accesstokens.IsAccessToken(token) {
+			accessToken, user, err := mw.accessTokens.GetByPlaintext(token)
+			if err != nil {
+				err.If(xerrors.ErrNotFound, func(err *xerrors.AppError) {
+					err.StatusCode = http.StatusUnauthorized
+					err.Data = "Access token is invalid or expired"
+				})
+				mw.rest.Error(w, err)
+				return
+			}
+
+			// Record the use, the request goes on regardless
+			if err := mw.accessTokens.Touch(accessToken.ID); err != nil {
+				mw.logger.Error(err.Error())
+			}
+
+			r = contextSetSession(r, 0)
+			r = contextSetUser(r, users.AnonymousUser)
+			r = contextSetAccessToken(r, accessToken, user)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Access tokens are signed, their claims are trusted without a lookup
+		claims, err := mw.tokens.Verify(token)
 		if err != nil {
-			err.If(xerrors.ErrNotFound, func(err *xerrors.AppError) {
-				err.StatusCode = http.StatusUnauthorized
-				err.Data = "Auth token is invalid"
-			})
 			mw.rest.Error(w, err)
 			return
 		}
 
-		// Add the user to the request context
-		r = contextSetToken(r, token)
+		// Record where the session is used from, saved in the background
+		mw.tokens.Touch(claims.FamilyID, Client(r))
+
+		// Add the user to the request context. Only logins of activated users
+		// are handed tokens.
+		user := &users.UserRecord{ID: claims.UserID, Email: claims.Email, Activated: true}
+		r = contextSetSession(r, claims.FamilyID)
 		r = contextSetUser(r, user)
 		next.ServeHTTP(w, r)
 	})
@@ -68,6 +95,9 @@ const userContextKey = contextKey("user")
 // Retrieves the User struct from the request context. This value is set by
 // Authentication middleware and can be trusted. However, you should always
 // check for user.IsAnonymous().
+//
+// Only the ID and email of the user are set, fetch the user to check their
+// password.
 func ContextGetUser(r *http.Request) *users.UserRecord {
 	user, ok := r.Context().Value(userContextKey).(*users.UserRecord)
 
@@ -85,30 +115,30 @@ func contextSetUser(r *http.Request, user *users.UserRecord) *http.Request {
 }
 
 // ===========================================================================
-// Context: Token
+// Context: Session
 // ===========================================================================
 
-// The contextKey for storing the extracted authorization token
-const tokenContextKey = contextKey("token")
+// The contextKey for storing the session of the authorization token
+const sessionContextKey = contextKey("session")
 
-// Retrieves the token string from the request context. This value is set by
-// Authentication middleware and can be trusted. However, you should always
-// check for an an empty string (no user). If you use ContextGetUser, checking
-// for user.IsAnonymous() is sufficient, and checking for an empty string is
-// not ncessary.
-func ContextGetToken(r *http.Request) string {
-	token, ok := r.Context().Value(tokenContextKey).(string)
+// Retrieves the ID of the session the access token belongs to from the
+// request context. This value is set by Authentication middleware and can be
+// trusted. However, you should always check for 0 (no user). If you use
+// ContextGetUser, checking for user.IsAnonymous() is sufficient, and checking
+// for 0 is not necessary.
+func ContextGetSession(r *http.Request) int64 {
+	session, ok := r.Context().Value(sessionContextKey).(int64)
 
 	if !ok {
-		panic("missing token string in request context")
+		panic("missing session in request context")
 	}
 
-	return token
+	return session
 }
 
-// Returns a new copy of the request with the token added to the context
-func contextSetToken(r *http.Request, token string) *http.Request {
-	ctx := context.WithValue(r.Context(), tokenContextKey, token)
+// Returns a new copy of the request with the session added to the context
+func contextSetSession(r *http.Request, session int64) *http.Request {
+	ctx := context.WithValue(r.Context(), sessionContextKey, session)
 	return r.WithContext(ctx)
 }
 
@@ -0,0 +1,331 @@
+package recovery
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+
+	"pm4devs.strawhats/internal/escrow"
+	"pm4devs.strawhats/internal/models/recovery"
+	"pm4devs.strawhats/internal/rest"
+	"pm4devs.strawhats/internal/routes/middleware"
+	"pm4devs.strawhats/internal/shamir"
+	"pm4devs.strawhats/internal/validator"
+	"pm4devs.strawhats/internal/xerrors"
+)
+
+// ============================================================================
+// Ceremonies
+// ============================================================================
+
+const CeremoniesRoute = "/v1/recovery/ceremonies"
+
+func (app *Recovery) handleCeremonies(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		app.getCeremony(w, r)
+	case http.MethodPost:
+		app.openCeremony(w, r)
+	case http.MethodDelete:
+		app.abortCeremony(w, r)
+	default:
+		app.rest.MethodNotAllowed(w, r, "GET, POST, DELETE")
+	}
+}
+
+// Gets a ceremony along with the number of shares submitted so far
+func (app *Recovery) getCeremony(w http.ResponseWriter, r *http.Request) {
+	ceremonyID, parseErr := strconv.ParseInt(r.URL.Query().Get("ceremony_id"), 10, 64)
+
+	v := validator.New()
+	v.Check(parseErr == nil && ceremonyID > 0, "ceremony_id", "must be a positive integer")
+	if err := v.Valid("recovery.getCeremony"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	ceremony, err := app.recovery.GetCeremony(ceremonyID)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	key, err := app.recovery.GetKey(ceremony.KeyID)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	app.rest.WriteJSON(w, "recovery.getCeremony", http.StatusOK, rest.Envelope{
+		"message":   "Success!",
+		"data":      ceremony,
+		"submitted": app.pool.count(ceremony.ID),
+		"threshold": key.Threshold,
+	})
+}
+
+// Opens a ceremony to hand a group to a new creator with the active recovery
+// key. The new creator needs a public key to wrap the recovered content keys
+// for.
+func (app *Recovery) openCeremony(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		GroupName       string `json:"group_name"`
+		NewCreatorEmail string `json:"new_creator_email"`
+	}
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, "recovery.openCeremony", &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	// Validate parameters
+	v := validator.New()
+	v.Check(len(input.GroupName) > 0, "group_name", "must be provided")
+	v.Check(len(input.NewCreatorEmail) > 0, "new_creator_email", "must be provided")
+	if err := v.Valid("recovery.openCeremony"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	group, err := app.group.GetGroupUsers(input.GroupName)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	newCreator, err := app.users.GetByEmail(input.NewCreatorEmail)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	newCreatorKey, err := app.sealingKey(newCreator.ID)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	if newCreatorKey == nil {
+		v.AddError("new_creator_email", "has no X25519 public key to wrap the recovered keys for")
+		app.rest.Error(w, v.Valid("recovery.openCeremony"))
+		return
+	}
+	key, err := app.recovery.GetActiveKey()
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	user := middleware.ContextGetUser(r)
+	ceremony, err := app.recovery.NewCeremony(key.ID, group.ID, newCreator.ID, user.ID)
+	if err != nil {
+		err.If(xerrors.ErrUniqueViolation, func(err *xerrors.AppError) {
+			err.Data = "This group already has an open recovery ceremony"
+		})
+		app.rest.Error(w, err)
+		return
+	}
+	app.rest.WriteJSON(w, "recovery.openCeremony", http.StatusCreated, rest.Envelope{
+		"message": "Success! Admins can now submit their shares.",
+		"data":    ceremony,
+	})
+}
+
+// Aborts an open ceremony, discarding the shares submitted to it
+func (app *Recovery) abortCeremony(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		CeremonyID int64 `json:"ceremony_id"`
+	}
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, "recovery.abortCeremony", &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	// Validate parameters
+	v := validator.New()
+	v.Check(input.CeremonyID > 0, "ceremony_id", "must be provided")
+	if err := v.Valid("recovery.abortCeremony"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	ceremony, err := app.recovery.GetCeremony(input.CeremonyID)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	user := middleware.ContextGetUser(r)
+	if err := app.recovery.Abort(ceremony, user.ID, "cancelled"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	app.pool.drop(ceremony.ID)
+	app.rest.WriteJSON(w, "recovery.abortCeremony", http.StatusOK, rest.Envelope{
+		"message": "Success!",
+		"data":    ceremony,
+	})
+}
+
+// ============================================================================
+// Shares
+// ============================================================================
+
+const CeremonySharesRoute = "/v1/recovery/ceremonies/shares"
+
+// Submits the share of an admin to an open ceremony
+//
+// Shares are held in memory only. Once the threshold is reached the private
+// key is rebuilt, checked against the public key, used to open the escrows of
+// the group and cleared. The group is handed to its new creator along with the
+// content keys, wrapped for them. Content keys are never returned.
+func (app *Recovery) submitShare(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.rest.MethodNotAllowed(w, r, "POST")
+		return
+	}
+	var input struct {
+		CeremonyID int64  `json:"ceremony_id"`
+		Share      []byte `json:"share"`
+	}
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, "recovery.submitShare", &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	// Validate parameters
+	v := validator.New()
+	v.Check(input.CeremonyID > 0, "ceremony_id", "must be provided")
+	v.Check(len(input.Share) == escrow.KeySize+1, "share", "must be a share of the recovery key")
+	if err := v.Valid("recovery.submitShare"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	ceremony, err := app.recovery.GetCeremony(input.CeremonyID)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	if ceremony.Status != recovery.CeremonyOpen {
+		app.rest.Error(w, xerrors.ClientError(http.StatusConflict,
+			"The recovery ceremony is "+string(ceremony.Status), "recovery.submitShare", xerrors.ErrEditConflict))
+		return
+	}
+	key, err := app.recovery.GetKey(ceremony.KeyID)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	// The share must be the one handed to the admin
+	user := middleware.ContextGetUser(r)
+	shareIndex := 0
+	for _, holder := range key.Shareholders {
+		if holder.UserID == user.ID {
+			shareIndex = holder.ShareIndex
+		}
+	}
+	if shareIndex == 0 {
+		app.rest.Error(w, xerrors.ClientError(http.StatusForbidden,
+			"You do not hold a share of this recovery key", "recovery.submitShare", xerrors.ErrUnauthorized))
+		return
+	}
+	if int(input.Share[0]) != shareIndex {
+		v.AddError("share", "is not the share you were handed")
+		app.rest.Error(w, v.Valid("recovery.submitShare"))
+		return
+	}
+
+	submitted, shares, ok := app.pool.add(ceremony.ID, user.ID, input.Share, key.Threshold)
+	if !ok {
+		app.rest.Error(w, xerrors.ClientError(http.StatusConflict,
+			"You already submitted your share", "recovery.submitShare", xerrors.ErrEditConflict))
+		return
+	}
+	if err := app.recovery.Audit(ceremony, user.ID, recovery.EventShareSubmitted, map[string]any{
+		"share_index": shareIndex,
+		"submitted":   submitted,
+	}); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	if shares == nil {
+		app.rest.WriteJSON(w, "recovery.submitShare", http.StatusAccepted, rest.Envelope{
+			"message":   "Success! Waiting for more shares.",
+			"submitted": submitted,
+			"threshold": key.Threshold,
+		})
+		return
+	}
+
+	recovered, err := app.recover(ceremony, key, shares, user.ID)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	app.rest.WriteJSON(w, "recovery.submitShare", http.StatusOK, rest.Envelope{
+		"message":        "Success! The group was recovered.",
+		"data":           ceremony,
+		"recovered_keys": recovered,
+	})
+}
+
+// Rebuilds the recovery key from the shares of a ceremony, opens the escrows
+// of its group, wraps their content keys for the new creator and completes
+// it. Returns the number of content keys recovered. The shares, the key and
+// the content keys are cleared.
+func (app *Recovery) recover(ceremony *recovery.CeremonyRecord, key *recovery.KeyRecord, shares [][]byte, actorID int64) (int, *xerrors.AppError) {
+	privateKey, combineErr := shamir.Combine(shares)
+	for _, share := range shares {
+		clear(share)
+	}
+	defer clear(privateKey)
+
+	// Shares of another key rebuild garbage rather than failing
+	publicKey, keyErr := escrow.PublicKey(privateKey)
+	if combineErr != nil || keyErr != nil || !bytes.Equal(publicKey, key.PublicKey) {
+		if err := app.recovery.Abort(ceremony, actorID, "the shares did not rebuild the recovery key"); err != nil {
+			return 0, err
+		}
+		return 0, xerrors.ClientError(http.StatusUnprocessableEntity,
+			"The shares did not rebuild the recovery key, the ceremony was aborted", "recovery.recover",
+			xerrors.ErrFailedValidation)
+	}
+
+	// The new creator may have rotated their key since the ceremony was opened
+	newCreatorKey, err := app.sealingKey(ceremony.NewCreatorID)
+	if err != nil {
+		return 0, err
+	}
+	if newCreatorKey == nil {
+		if err := app.recovery.Abort(ceremony, actorID, "the new creator has no public key"); err != nil {
+			return 0, err
+		}
+		return 0, xerrors.ClientError(http.StatusUnprocessableEntity,
+			"The new creator has no X25519 public key, the ceremony was aborted", "recovery.recover",
+			xerrors.ErrFailedValidation)
+	}
+
+	escrows, err := app.recovery.GetEscrows(ceremony.GroupID, ceremony.KeyID)
+	if err != nil {
+		return 0, err
+	}
+	recovered := []recovery.RecoveredKey{}
+	for _, sealed := range escrows {
+		contentKey, openErr := escrow.Open(privateKey, sealed.SealedKey)
+		if openErr != nil {
+			app.logger.Error("failed to open escrow", "secret_id", sealed.SecretID, "error", openErr.Error())
+			continue
+		}
+		wrapped, sealErr := sealTo(newCreatorKey, contentKey)
+		clear(contentKey)
+		if sealErr != nil {
+			return 0, xerrors.ServerError("recovery.recover", sealErr)
+		}
+		recovered = append(recovered, recovery.RecoveredKey{
+			SecretID:    sealed.SecretID,
+			WrappedKey:  base64.StdEncoding.EncodeToString(wrapped),
+			Fingerprint: newCreatorKey.Fingerprint,
+		})
+	}
+
+	if err := app.recovery.Complete(ceremony, actorID, recovered); err != nil {
+		return 0, err
+	}
+	return len(recovered), nil
+}
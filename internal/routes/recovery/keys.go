@@ -0,0 +1,287 @@
+package recovery
+
+import (
+	"encoding/base64"
+	"net/http"
+
+	"pm4devs.strawhats/internal/escrow"
+	"pm4devs.strawhats/internal/models/keys"
+	"pm4devs.strawhats/internal/models/permissions"
+	"pm4devs.strawhats/internal/models/recovery"
+	"pm4devs.strawhats/internal/rest"
+	"pm4devs.strawhats/internal/routes/middleware"
+	"pm4devs.strawhats/internal/shamir"
+	"pm4devs.strawhats/internal/validator"
+	"pm4devs.strawhats/internal/xerrors"
+)
+
+// ============================================================================
+// Key
+// ============================================================================
+
+const KeyRoute = "/v1/recovery/key"
+
+// Gets the active recovery key, whose public key content keys are escrowed to
+func (app *Recovery) getKey(w http.ResponseWriter, r *http.Request) {
+	key, err := app.recovery.GetActiveKey()
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	app.rest.WriteJSON(w, "recovery.getKey", http.StatusOK, rest.Envelope{
+		"message": "Success!",
+		"data":    key,
+	})
+}
+
+// Creates a new recovery key, splitting its private key among admins
+//
+// The private key is cleared from memory once split, and each share is sealed
+// to the public key of its admin and waits for them to collect it. The active
+// key is retired.
+func (app *Recovery) createKey(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Threshold int      `json:"threshold"`
+		Admins    []string `json:"admins"`
+	}
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, "recovery.createKey", &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	// Validate parameters
+	v := validator.New()
+	v.Check(len(input.Admins) >= 2 && len(input.Admins) <= shamir.MaxShares, "admins", "must hold between 2 and 255 emails")
+	v.Check(unique(input.Admins), "admins", "must not contain duplicates")
+	v.Check(input.Threshold >= 2 && input.Threshold <= len(input.Admins), "threshold",
+		"must be at least 2 and at most the number of admins")
+	if err := v.Valid("recovery.createKey"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	// Every shareholder must be an admin with a public key to seal their share to
+	holders := make([]int64, len(input.Admins))
+	holderKeys := make([]*keys.KeyRecord, len(input.Admins))
+	for i, email := range input.Admins {
+		admin, err := app.users.GetByEmail(email)
+		if err != nil {
+			app.rest.Error(w, err)
+			return
+		}
+		perms, err := app.permissions.GetByID(admin.ID)
+		if err != nil {
+			app.rest.Error(w, err)
+			return
+		}
+		if !perms.Include(permissions.PermissionAdmin) {
+			v.AddError("admins", email+" is not an admin")
+			app.rest.Error(w, v.Valid("recovery.createKey"))
+			return
+		}
+		holderKeys[i], err = app.sealingKey(admin.ID)
+		if err != nil {
+			app.rest.Error(w, err)
+			return
+		}
+		if holderKeys[i] == nil {
+			v.AddError("admins", email+" has no X25519 public key to seal their share to")
+			app.rest.Error(w, v.Valid("recovery.createKey"))
+			return
+		}
+		holders[i] = admin.ID
+	}
+
+	privateKey, publicKey, genErr := escrow.GenerateKey()
+	if genErr != nil {
+		app.rest.Error(w, xerrors.ServerError("recovery.createKey", genErr))
+		return
+	}
+	shares, splitErr := shamir.Split(privateKey, len(holders), input.Threshold)
+	clear(privateKey)
+	if splitErr != nil {
+		app.rest.Error(w, xerrors.ServerError("recovery.createKey", splitErr))
+		return
+	}
+
+	pending := make([]recovery.PendingShare, len(holders))
+	var sealErr error
+	for i, userID := range holders {
+		pending[i] = recovery.PendingShare{
+			UserID:      userID,
+			ShareIndex:  int(shares[i][0]),
+			Fingerprint: &holderKeys[i].Fingerprint,
+		}
+		if pending[i].Share, sealErr = sealTo(holderKeys[i], shares[i]); sealErr != nil {
+			break
+		}
+	}
+	for _, share := range shares {
+		clear(share)
+	}
+	if sealErr != nil {
+		app.rest.Error(w, xerrors.ServerError("recovery.createKey", sealErr))
+		return
+	}
+
+	user := middleware.ContextGetUser(r)
+	key, err := app.recovery.NewKey(user.ID, publicKey, input.Threshold, pending)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	app.rest.WriteJSON(w, "recovery.createKey", http.StatusCreated, rest.Envelope{
+		"message": "Success! Each admin must now collect their share.",
+		"data":    key,
+	})
+}
+
+// ============================================================================
+// Share
+// ============================================================================
+
+const ShareRoute = "/v1/recovery/share"
+
+// Hands an admin their share of the active recovery key, sealed to their
+// public key. A share can only be collected once, so a POST rather than a GET.
+func (app *Recovery) collectShare(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.rest.MethodNotAllowed(w, r, "POST")
+		return
+	}
+
+	user := middleware.ContextGetUser(r)
+	share, key, err := app.recovery.CollectShare(user.ID)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	app.rest.WriteJSON(w, "recovery.collectShare", http.StatusOK, rest.Envelope{
+		"message": "Success! Store your share safely, it cannot be collected again.",
+		"data": rest.Envelope{
+			"key_id":          key.ID,
+			"threshold":       key.Threshold,
+			"share_index":     share.ShareIndex,
+			"share":           share.Share,
+			"key_fingerprint": share.Fingerprint,
+		},
+	})
+}
+
+// ============================================================================
+// Escrow
+// ============================================================================
+
+const EscrowRoute = "/v1/recovery/escrow"
+
+// Stores the content key of a secret shared with a group, sealed by the owner
+// to the active recovery key
+func (app *Recovery) setEscrow(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		app.rest.MethodNotAllowed(w, r, "PUT")
+		return
+	}
+	var input struct {
+		SecretID  int64  `json:"secret_id"`
+		GroupName string `json:"group_name"`
+		SealedKey []byte `json:"sealed_key"`
+	}
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, "recovery.setEscrow", &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	// Validate parameters
+	v := validator.New()
+	v.Check(input.SecretID > 0, "secret_id", "must be provided")
+	v.Check(len(input.GroupName) > 0, "group_name", "must be provided")
+	v.Check(len(input.SealedKey) > escrow.KeySize, "sealed_key", "must be a key sealed to the recovery key")
+	if err := v.Valid("recovery.setEscrow"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	user := middleware.ContextGetUser(r)
+	secret, err := app.secrets.GetSecretByID(input.SecretID)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	if secret.OwnerID != user.ID {
+		app.rest.WriteJSON(w, "recovery.setEscrow", http.StatusUnauthorized, rest.Envelope{
+			"message": "Only owner can escrow the key of a secret",
+		})
+		return
+	}
+	group, err := app.group.GetGroupUsers(input.GroupName)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	key, err := app.recovery.GetActiveKey()
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	err = app.recovery.SetEscrow(&recovery.Escrow{
+		SecretID:  secret.ID,
+		GroupID:   group.ID,
+		KeyID:     key.ID,
+		SealedKey: input.SealedKey,
+	}, user.ID)
+	if err != nil {
+		err.If(xerrors.ErrForeignKeyViolation, func(err *xerrors.AppError) {
+			err.Data = "The secret is not shared with this group"
+		})
+		app.rest.Error(w, err)
+		return
+	}
+	app.rest.WriteJSON(w, "recovery.setEscrow", http.StatusOK, rest.Envelope{
+		"message": "Success!",
+	})
+}
+
+// ============================================================================
+// Helpers
+// ============================================================================
+
+// Gets the active key of a user that shares and content keys are sealed to
+//
+// Returns nil if the user has no active key, or if it is not the base64 of an
+// X25519 public key.
+func (app *Recovery) sealingKey(userID int64) (*keys.KeyRecord, *xerrors.AppError) {
+	key, err := app.keys.GetActive(userID)
+	if err != nil {
+		if err.Matches(xerrors.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	publicKey, decodeErr := base64.StdEncoding.DecodeString(key.PublicKey)
+	if decodeErr != nil || len(publicKey) != escrow.KeySize {
+		return nil, nil
+	}
+	return key, nil
+}
+
+// Seals data to a key returned by sealingKey
+func sealTo(key *keys.KeyRecord, data []byte) ([]byte, error) {
+	publicKey, err := base64.StdEncoding.DecodeString(key.PublicKey)
+	if err != nil {
+		return nil, escrow.ErrInvalidKey
+	}
+	return escrow.Seal(publicKey, data)
+}
+
+// Returns true if no email is listed twice
+func unique(emails []string) bool {
+	seen := map[string]bool{}
+	for _, email := range emails {
+		if seen[email] {
+			return false
+		}
+		seen[email] = true
+	}
+	return true
+}
@@ -0,0 +1,66 @@
+package recovery
+
+import "sync"
+
+// Holds the shares submitted to open ceremonies until enough were submitted
+// to rebuild the recovery key
+//
+// Shares are only ever kept in memory: they are lost on restart and admins
+// submit them again.
+type sharePool struct {
+	mu     sync.Mutex
+	shares map[int64]map[int64][]byte // Shares by ceremony, then by admin
+}
+
+func newSharePool() *sharePool {
+	return &sharePool{shares: map[int64]map[int64][]byte{}}
+}
+
+// Adds the share of an admin to a ceremony and returns the number of shares
+// submitted. Once threshold shares were submitted they are removed and
+// returned, to a single caller. Returns false if the admin already submitted
+// a share.
+func (p *sharePool) add(ceremonyID, userID int64, share []byte, threshold int) (int, [][]byte, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	submitted, ok := p.shares[ceremonyID]
+	if !ok {
+		submitted = map[int64][]byte{}
+		p.shares[ceremonyID] = submitted
+	}
+	if _, ok := submitted[userID]; ok {
+		return len(submitted), nil, false
+	}
+	submitted[userID] = share
+
+	count := len(submitted)
+	if count < threshold {
+		return count, nil, true
+	}
+	shares := make([][]byte, 0, count)
+	for _, share := range submitted {
+		shares = append(shares, share)
+	}
+	delete(p.shares, ceremonyID)
+	return count, shares, true
+}
+
+// Returns the number of shares submitted to a ceremony
+func (p *sharePool) count(ceremonyID int64) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return len(p.shares[ceremonyID])
+}
+
+// Clears and removes the shares of a ceremony
+func (p *sharePool) drop(ceremonyID int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, share := range p.shares[ceremonyID] {
+		clear(share)
+	}
+	delete(p.shares, ceremonyID)
+}
@@ -0,0 +1,83 @@
+package recovery
+
+import (
+	"net/http"
+
+	"pm4devs.strawhats/internal/app"
+	"pm4devs.strawhats/internal/models/core"
+	"pm4devs.strawhats/internal/models/group"
+	"pm4devs.strawhats/internal/models/keys"
+	"pm4devs.strawhats/internal/models/permissions"
+	"pm4devs.strawhats/internal/models/recovery"
+	"pm4devs.strawhats/internal/models/secrets"
+	"pm4devs.strawhats/internal/models/users"
+	"pm4devs.strawhats/internal/rest"
+	"pm4devs.strawhats/internal/routes/middleware"
+	"pm4devs.strawhats/internal/xlogger"
+)
+
+// Encapsulates the Application dependencies required by routes
+type Recovery struct {
+	logger      xlogger.Logger
+	rest        *rest.Rest
+	recovery    recovery.RecoveryRepository
+	group       group.GroupRepository
+	keys        keys.KeysRepository
+	permissions permissions.PermissionsRepository
+	secrets     secrets.SecretsRepository
+	users       users.UsersRepository
+	pool        *sharePool
+}
+
+func New(app *app.App) *Recovery {
+	return &Recovery{
+		logger:      app.Logger,
+		rest:        app.Rest,
+		recovery:    app.Models.Recovery,
+		group:       app.Models.Group,
+		keys:        app.Models.Keys,
+		permissions: app.Models.Permissions,
+		secrets:     app.Models.Secrets,
+		users:       app.Models.Users,
+		pool:        newSharePool(),
+	}
+}
+
+func (rc *Recovery) Route(mux *http.ServeMux, mw *middleware.Middleware) {
+	// Anyone escrowing a content key needs the public key, only superadmins
+	// create a new one
+	mux.HandleFunc("GET "+KeyRoute, mw.Authenticated(rc.getKey))
+	mux.HandleFunc("POST "+KeyRoute, mw.RequirePermission(permissions.PermissionSuperAdmin, rc.createKey))
+	mux.HandleFunc(ShareRoute, mw.RequirePermission(permissions.PermissionAdmin, rc.collectShare))
+	mux.HandleFunc(EscrowRoute, mw.Authenticated(rc.setEscrow))
+
+	mux.HandleFunc(CeremoniesRoute, mw.RequirePermission(permissions.PermissionAdmin, rc.handleCeremonies))
+	mux.HandleFunc(CeremonySharesRoute, mw.RequirePermission(permissions.PermissionAdmin, rc.submitShare))
+
+	mux.HandleFunc(AuditRoute, mw.RequirePermission(permissions.PermissionSuperAdmin, rc.getAudit))
+}
+
+// ============================================================================
+// Audit
+// ============================================================================
+
+const AuditRoute = "/v1/recovery/audit"
+
+// Lists the audit log of the recovery keys and ceremonies
+func (app *Recovery) getAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		app.rest.MethodNotAllowed(w, r, "GET")
+		return
+	}
+	page, err := core.ParsePage(r.URL.Query(), "recovery.getAudit")
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	entries, next, err := app.recovery.GetAudit(page)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	app.rest.WritePage(w, "recovery.getAudit", entries, page.Fields, next)
+}
@@ -0,0 +1,333 @@
+package recovery
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"pm4devs.strawhats/internal/assert"
+	"pm4devs.strawhats/internal/escrow"
+	"pm4devs.strawhats/internal/mocks"
+	"pm4devs.strawhats/internal/models/permissions"
+	"pm4devs.strawhats/internal/routes/group"
+	"pm4devs.strawhats/internal/routes/recovery"
+	"pm4devs.strawhats/internal/routes/secret"
+)
+
+type keyResponse struct {
+	Error map[string]string `json:"error"`
+	Data  struct {
+		ID        int64  `json:"id"`
+		PublicKey []byte `json:"public_key"`
+		Threshold int    `json:"threshold"`
+		Shares    int    `json:"shares"`
+	} `json:"data"`
+}
+
+type shareResponse struct {
+	Data struct {
+		Share          []byte `json:"share"`
+		KeyFingerprint string `json:"key_fingerprint"`
+	} `json:"data"`
+}
+
+type ceremonyResponse struct {
+	Error     any `json:"error"`
+	Submitted int `json:"submitted"`
+	Data      struct {
+		ID     int64  `json:"id"`
+		Status string `json:"status"`
+	} `json:"data"`
+	RecoveredKeys int `json:"recovered_keys"`
+}
+
+// Creates a recovery key split among three admins, two of which recover it,
+// and returns the tokens of the admins along with their shares, opened with
+// their private keys
+func setupKey(t *testing.T, handler http.HandlerFunc, superadmin string, admins []string, privateKeys [][]byte) ([]string, [][]byte) {
+	t.Helper()
+
+	var key keyResponse
+	body := `{"threshold": 2, "admins": ["admin1@example.com", "admin2@example.com", "admin3@example.com"]}`
+	res := sendAuthRequestGetResult(handler, http.MethodPost, recovery.KeyRoute, body, superadmin, &key)
+	assert.Equal(t, res, http.StatusCreated)
+	assert.Equal(t, key.Data.Threshold, 2)
+	assert.Equal(t, key.Data.Shares, 3)
+
+	var shares [][]byte
+	for i, admin := range admins {
+		var share shareResponse
+		res := sendAuthRequestGetResult(handler, http.MethodPost, recovery.ShareRoute, "", admin, &share)
+		assert.Equal(t, res, http.StatusOK)
+		assert.Check(t, share.Data.KeyFingerprint != "")
+		opened, err := escrow.Open(privateKeys[i], share.Data.Share)
+		assert.Check(t, err == nil)
+		assert.Equal(t, len(opened), escrow.KeySize+1)
+		shares = append(shares, opened)
+	}
+	return admins, shares
+}
+
+func TestRecoveryKey(t *testing.T) {
+	assert.Integration(t)
+	app := mocks.App(t)
+	handler := recoveryHandler(app)
+
+	superadmin := registerUser(t, app, "super@example.com", permissions.PermissionSuperAdmin)
+	admin := registerAdmin(t, app, "admin1@example.com")
+	registerAdmin(t, app, "admin2@example.com")
+	registerAdmin(t, app, "admin3@example.com")
+	registerUser(t, app, "user@example.com")
+	registerKey(t, app, "admin1@example.com")
+	registerKey(t, app, "admin2@example.com")
+
+	tests := []assert.HandlerTestCase[keyResponse]{
+		{
+			Name:   "NotSuperadmin",
+			Body:   `{"threshold": 2, "admins": ["admin1@example.com", "admin2@example.com"]}`,
+			Auth:   admin,
+			Status: http.StatusUnauthorized,
+		},
+		{
+			Name:   "InvalidThreshold",
+			Body:   `{"threshold": 3, "admins": ["admin1@example.com", "admin2@example.com"]}`,
+			Auth:   superadmin,
+			Status: http.StatusUnprocessableEntity,
+			FN: func(t *testing.T, result keyResponse) {
+				assert.Equal(t, result.Error["threshold"], "must be at least 2 and at most the number of admins")
+			},
+		},
+		{
+			Name:   "Duplicates",
+			Body:   `{"threshold": 2, "admins": ["admin1@example.com", "admin1@example.com"]}`,
+			Auth:   superadmin,
+			Status: http.StatusUnprocessableEntity,
+			FN: func(t *testing.T, result keyResponse) {
+				assert.Equal(t, result.Error["admins"], "must not contain duplicates")
+			},
+		},
+		{
+			Name:   "NotAdmin",
+			Body:   `{"threshold": 2, "admins": ["admin1@example.com", "user@example.com"]}`,
+			Auth:   superadmin,
+			Status: http.StatusUnprocessableEntity,
+			FN: func(t *testing.T, result keyResponse) {
+				assert.Equal(t, result.Error["admins"], "user@example.com is not an admin")
+			},
+		},
+		{
+			Name:   "NoPublicKey",
+			Body:   `{"threshold": 2, "admins": ["admin1@example.com", "admin3@example.com"]}`,
+			Auth:   superadmin,
+			Status: http.StatusUnprocessableEntity,
+			FN: func(t *testing.T, result keyResponse) {
+				assert.Equal(t, result.Error["admins"], "admin3@example.com has no X25519 public key to seal their share to")
+			},
+		},
+		{
+			Name:   "Success",
+			Body:   `{"threshold": 2, "admins": ["admin1@example.com", "admin2@example.com"]}`,
+			Auth:   superadmin,
+			Status: http.StatusCreated,
+			FN: func(t *testing.T, result keyResponse) {
+				assert.Equal(t, len(result.Data.PublicKey), escrow.KeySize)
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		assert.RunHandlerTestCase(t, handler, http.MethodPost, recovery.KeyRoute, tc)
+	}
+
+	// Shares are collected once
+	res := sendAuthRequest(handler, http.MethodPost, recovery.ShareRoute, "", admin)
+	assert.Equal(t, res, http.StatusOK)
+	res = sendAuthRequest(handler, http.MethodPost, recovery.ShareRoute, "", admin)
+	assert.Equal(t, res, http.StatusConflict)
+	res = sendAuthRequest(handler, http.MethodPost, recovery.ShareRoute, "", superadmin)
+	assert.Equal(t, res, http.StatusUnauthorized)
+}
+
+func TestCeremony(t *testing.T) {
+	assert.Integration(t)
+	app := mocks.App(t)
+	handler := recoveryHandler(app)
+
+	superadmin := registerUser(t, app, "super@example.com", permissions.PermissionSuperAdmin)
+	admins := []string{
+		registerAdmin(t, app, "admin1@example.com"),
+		registerAdmin(t, app, "admin2@example.com"),
+		registerAdmin(t, app, "admin3@example.com"),
+	}
+	adminKeys := [][]byte{
+		registerKey(t, app, "admin1@example.com"),
+		registerKey(t, app, "admin2@example.com"),
+		registerKey(t, app, "admin3@example.com"),
+	}
+	creator := registerUser(t, app, "creator@example.com")
+	registerUser(t, app, "heir@example.com")
+	heirKey := registerKey(t, app, "heir@example.com")
+	admins, shares := setupKey(t, handler, superadmin, admins, adminKeys)
+
+	// The creator shares a secret with a group and escrows its content key
+	res := sendAuthRequest(handler, http.MethodPost, group.CRUDGroupRoute, `{"group_name": "Vault"}`, creator)
+	assert.Equal(t, res, http.StatusCreated)
+	secretData := `{"encrypted_data": "data", "name": "testname", "iv": "testing"}`
+	res = sendAuthRequest(handler, http.MethodPost, secret.SecretCRUDRoute, secretData, creator)
+	assert.Equal(t, res, http.StatusCreated)
+	share := `{"secret_id": 1, "group_name": "Vault", "permission": "read-only"}`
+	res = sendAuthRequest(handler, http.MethodPost, secret.SecretShareGroupRoute, share, creator)
+	assert.Equal(t, res, http.StatusCreated)
+
+	var key keyResponse
+	res = sendAuthRequestGetResult(handler, http.MethodGet, recovery.KeyRoute, "", creator, &key)
+	assert.Equal(t, res, http.StatusOK)
+	contentKey := []byte("0123456789abcdef0123456789abcdef")
+	sealed, err := escrow.Seal(key.Data.PublicKey, contentKey)
+	assert.Check(t, err == nil)
+	escrowBody := fmt.Sprintf(`{"secret_id": 1, "group_name": "Vault", "sealed_key": %q}`,
+		base64.StdEncoding.EncodeToString(sealed))
+	res = sendAuthRequest(handler, http.MethodPut, recovery.EscrowRoute, escrowBody, admins[0])
+	assert.Equal(t, res, http.StatusUnauthorized)
+	res = sendAuthRequest(handler, http.MethodPut, recovery.EscrowRoute, escrowBody, creator)
+	assert.Equal(t, res, http.StatusOK)
+
+	// Admins open a ceremony to hand the group to a new creator, who needs a
+	// public key to wrap the content keys for
+	noKey := `{"group_name": "Vault", "new_creator_email": "creator@example.com"}`
+	res = sendAuthRequest(handler, http.MethodPost, recovery.CeremoniesRoute, noKey, admins[0])
+	assert.Equal(t, res, http.StatusUnprocessableEntity)
+	open := `{"group_name": "Vault", "new_creator_email": "heir@example.com"}`
+	res = sendAuthRequest(handler, http.MethodPost, recovery.CeremoniesRoute, open, creator)
+	assert.Equal(t, res, http.StatusUnauthorized)
+	res = sendAuthRequest(handler, http.MethodPost, recovery.CeremoniesRoute, open, admins[0])
+	assert.Equal(t, res, http.StatusCreated)
+	res = sendAuthRequest(handler, http.MethodPost, recovery.CeremoniesRoute, open, admins[1])
+	assert.Equal(t, res, http.StatusConflict)
+
+	submit := func(i int) string {
+		return fmt.Sprintf(`{"ceremony_id": 1, "share": %q}`, base64.StdEncoding.EncodeToString(shares[i]))
+	}
+	tests := []assert.HandlerTestCase[ceremonyResponse]{
+		{
+			Name:   "NotTheirShare",
+			Body:   submit(1),
+			Auth:   admins[0],
+			Status: http.StatusUnprocessableEntity,
+		},
+		{
+			Name:   "FirstShare",
+			Body:   submit(0),
+			Auth:   admins[0],
+			Status: http.StatusAccepted,
+			FN: func(t *testing.T, result ceremonyResponse) {
+				assert.Equal(t, result.Submitted, 1)
+			},
+		},
+		{
+			Name:   "AlreadySubmitted",
+			Body:   submit(0),
+			Auth:   admins[0],
+			Status: http.StatusConflict,
+		},
+		{
+			Name:   "Threshold",
+			Body:   submit(2),
+			Auth:   admins[2],
+			Status: http.StatusOK,
+			FN: func(t *testing.T, result ceremonyResponse) {
+				assert.Equal(t, result.Data.Status, "completed")
+				assert.Equal(t, result.RecoveredKeys, 1)
+			},
+		},
+		{
+			Name:   "Closed",
+			Body:   submit(1),
+			Auth:   admins[1],
+			Status: http.StatusConflict,
+		},
+	}
+
+	for _, tc := range tests {
+		assert.RunHandlerTestCase(t, handler, http.MethodPost, recovery.CeremonySharesRoute, tc)
+	}
+
+	// The group now belongs to its new creator
+	recovered, appErr := app.Models.Group.GetGroupUsers("Vault")
+	assert.Check(t, appErr == nil)
+	heir, appErr := app.Models.Users.GetByEmail("heir@example.com")
+	assert.Check(t, appErr == nil)
+	assert.Equal(t, recovered.CreatorID, heir.ID)
+
+	// Along with the content key, wrapped for them
+	wrappedKey, appErr := app.Models.Secrets.GetWrappedKey(1, heir.ID)
+	assert.Check(t, appErr == nil && wrappedKey != nil)
+	wrapped, err := base64.StdEncoding.DecodeString(wrappedKey.WrappedKey)
+	assert.Check(t, err == nil)
+	unwrapped, err := escrow.Open(heirKey, wrapped)
+	assert.Check(t, err == nil)
+	assert.Check(t, bytes.Equal(unwrapped, contentKey))
+
+	// Every step was logged
+	type auditResponse struct {
+		Data []struct {
+			Event string `json:"event"`
+		} `json:"data"`
+	}
+	var audit auditResponse
+	res = sendAuthRequestGetResult(handler, http.MethodGet, recovery.AuditRoute, "", superadmin, &audit)
+	assert.Equal(t, res, http.StatusOK)
+	var events []string
+	for _, entry := range audit.Data {
+		events = append(events, entry.Event)
+	}
+	assert.Equal(t, fmt.Sprint(events), fmt.Sprint([]string{
+		"key_created", "share_collected", "share_collected", "share_collected", "escrow_stored",
+		"ceremony_opened", "share_submitted", "share_submitted", "ceremony_completed",
+	}))
+}
+
+func TestCeremonyWrongShares(t *testing.T) {
+	assert.Integration(t)
+	app := mocks.App(t)
+	handler := recoveryHandler(app)
+
+	superadmin := registerUser(t, app, "super@example.com", permissions.PermissionSuperAdmin)
+	admins := []string{
+		registerAdmin(t, app, "admin1@example.com"),
+		registerAdmin(t, app, "admin2@example.com"),
+		registerAdmin(t, app, "admin3@example.com"),
+	}
+	adminKeys := [][]byte{
+		registerKey(t, app, "admin1@example.com"),
+		registerKey(t, app, "admin2@example.com"),
+		registerKey(t, app, "admin3@example.com"),
+	}
+	creator := registerUser(t, app, "creator@example.com")
+	admins, shares := setupKey(t, handler, superadmin, admins, adminKeys)
+
+	res := sendAuthRequest(handler, http.MethodPost, group.CRUDGroupRoute, `{"group_name": "Vault"}`, creator)
+	assert.Equal(t, res, http.StatusCreated)
+	open := `{"group_name": "Vault", "new_creator_email": "admin1@example.com"}`
+	res = sendAuthRequest(handler, http.MethodPost, recovery.CeremoniesRoute, open, admins[0])
+	assert.Equal(t, res, http.StatusCreated)
+
+	// A corrupted share rebuilds another key, which aborts the ceremony
+	shares[1][5] ^= 1
+	for i, status := range []int{http.StatusAccepted, http.StatusUnprocessableEntity} {
+		body := fmt.Sprintf(`{"ceremony_id": 1, "share": %q}`, base64.StdEncoding.EncodeToString(shares[i]))
+		res = sendAuthRequest(handler, http.MethodPost, recovery.CeremonySharesRoute, body, admins[i])
+		assert.Equal(t, res, status)
+	}
+
+	var ceremony ceremonyResponse
+	res = sendAuthRequestGetResult(handler, http.MethodGet, recovery.CeremoniesRoute+"?ceremony_id=1", "", admins[2], &ceremony)
+	assert.Equal(t, res, http.StatusOK)
+	assert.Equal(t, ceremony.Data.Status, "aborted")
+
+	// The group can be recovered with a new ceremony
+	res = sendAuthRequest(handler, http.MethodPost, recovery.CeremoniesRoute, open, admins[0])
+	assert.Equal(t, res, http.StatusCreated)
+}
@@ -0,0 +1,106 @@
+package recovery
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"pm4devs.strawhats/internal/app"
+	"pm4devs.strawhats/internal/assert"
+	"pm4devs.strawhats/internal/escrow"
+	"pm4devs.strawhats/internal/models/permissions"
+	"pm4devs.strawhats/internal/routes/group"
+	"pm4devs.strawhats/internal/routes/middleware"
+	"pm4devs.strawhats/internal/routes/recovery"
+	"pm4devs.strawhats/internal/routes/secret"
+	"pm4devs.strawhats/internal/routes/utils"
+)
+
+// ============================================================================
+// Helpers
+// ============================================================================
+
+// Creates a complete Recovery handler including middleware. The secrets and
+// group routes are included to share secrets with groups.
+func recoveryHandler(app *app.App) http.HandlerFunc {
+	handler := func() http.Handler {
+		mux := http.NewServeMux()
+
+		middleware := middleware.New(app)
+		recovery.New(app).Route(mux, middleware)
+		secret.New(app).Route(mux, middleware)
+		group.New(app).Route(mux, middleware)
+
+		return middleware.User(mux)
+	}()
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r)
+	}
+}
+
+// Registers and logs in a user with the given permissions, returning their
+// token
+func registerUser(t *testing.T, app *app.App, email string, codes ...string) string {
+	t.Helper()
+
+	authHandler := utils.AuthHandler(app)
+	credentials := `{"email": "` + email + `", "password": "password"}`
+	assert.Check(t, utils.RegisterUser(authHandler, credentials))
+	token := utils.LoginUser(authHandler, credentials)
+	assert.Check(t, len(token) > 0)
+
+	if len(codes) > 0 {
+		user, err := app.Models.Users.GetByEmail(email)
+		assert.Check(t, err == nil)
+		_, err = app.Models.Permissions.Insert(user.ID, codes...)
+		assert.Check(t, err == nil)
+	}
+
+	return token
+}
+
+// Registers an admin
+func registerAdmin(t *testing.T, app *app.App, email string) string {
+	return registerUser(t, app, email, permissions.PermissionAdmin)
+}
+
+// Registers an X25519 key pair for a user, returning its private key
+func registerKey(t *testing.T, app *app.App, email string) []byte {
+	t.Helper()
+
+	user, err := app.Models.Users.GetByEmail(email)
+	assert.Check(t, err == nil)
+	privateKey, publicKey, genErr := escrow.GenerateKey()
+	assert.Check(t, genErr == nil)
+	_, err = app.Models.Keys.Rotate(user.ID, base64.StdEncoding.EncodeToString(publicKey), "encrypted")
+	assert.Check(t, err == nil)
+
+	return privateKey
+}
+
+// Sends a request and decodes the response into dst
+func sendAuthRequestGetResult[T any](handler http.HandlerFunc, method, route, body, authToken string, dst *T) int {
+	req := httptest.NewRequest(method, route, bytes.NewBufferString(body))
+
+	// If authToken is provided, set the Authorization header
+	if authToken != "" {
+		req.Header.Set("Authorization", "Bearer "+authToken)
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	resp := rr.Result()
+	defer resp.Body.Close()
+
+	_ = json.NewDecoder(resp.Body).Decode(dst)
+	return resp.StatusCode
+}
+
+func sendAuthRequest(handler http.HandlerFunc, method, route, body, authToken string) int {
+	var discard map[string]any
+	return sendAuthRequestGetResult(handler, method, route, body, authToken, &discard)
+}
@@ -6,9 +6,15 @@ import (
 
 	"pm4devs.strawhats/internal/app"
 	"pm4devs.strawhats/internal/models/permissions"
+	"pm4devs.strawhats/internal/routes/accesstoken"
 	"pm4devs.strawhats/internal/routes/auth"
+	"pm4devs.strawhats/internal/routes/emergency"
+	"pm4devs.strawhats/internal/routes/folder"
 	"pm4devs.strawhats/internal/routes/group"
+	"pm4devs.strawhats/internal/routes/keys"
 	"pm4devs.strawhats/internal/routes/middleware"
+	"pm4devs.strawhats/internal/routes/recovery"
+	"pm4devs.strawhats/internal/routes/scim"
 	"pm4devs.strawhats/internal/routes/secret"
 )
 
@@ -21,11 +27,23 @@ func Mux(app *app.App) http.Handler {
 	auth := auth.New(app)
 	secrets := secret.New(app)
 	group := group.New(app)
+	folders := folder.New(app)
+	keys := keys.New(app)
+	emergency := emergency.New(app)
+	recovery := recovery.New(app)
+	accessTokens := accesstoken.New(app)
+	scim := scim.New(app)
 
 	// Register
 	auth.Route(mux, middleware)
 	secrets.Route(mux, middleware)
 	group.Route(mux, middleware)
+	folders.Route(mux, middleware)
+	keys.Route(mux, middleware)
+	emergency.Route(mux, middleware)
+	recovery.Route(mux, middleware)
+	accessTokens.Route(mux, middleware)
+	scim.Route(mux, middleware)
 	// Example permission check
 	mux.Handle(
 		"GET /v1/debug/vars",
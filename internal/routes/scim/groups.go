@@ -0,0 +1,385 @@
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"pm4devs.strawhats/internal/models/group"
+	"pm4devs.strawhats/internal/routes/middleware"
+	"pm4devs.strawhats/internal/scim"
+	"pm4devs.strawhats/internal/validator"
+	"pm4devs.strawhats/internal/xerrors"
+)
+
+// ============================================================================
+// GET
+// ============================================================================
+
+// Lists the groups bound to the identity provider matching the filter, with
+// their members
+func (s *SCIM) groupsGet(w http.ResponseWriter, r *http.Request) {
+	filter, err := groupFilter(r.URL.Query().Get("filter"), "scim.groupsGet")
+	if err != nil {
+		s.error(w, err)
+		return
+	}
+	offset, limit, err := page(r, "scim.groupsGet")
+	if err != nil {
+		s.error(w, err)
+		return
+	}
+
+	records, total, err := s.group.GetAll(filter, offset, limit)
+	if err != nil {
+		s.error(w, err)
+		return
+	}
+
+	resources := make([]scim.Group, 0, len(*records))
+	for i := range *records {
+		resources = append(resources, groupResource(&(*records)[i]))
+	}
+	s.write(w, "scim.groupsGet", http.StatusOK, scim.NewListResponse(resources, total, offset+1))
+}
+
+// Gets a group with its members
+func (s *SCIM) groupGet(w http.ResponseWriter, r *http.Request) {
+	record, err := s.groupRecord(r, "scim.groupGet")
+	if err != nil {
+		s.error(w, err)
+		return
+	}
+
+	s.write(w, "scim.groupGet", http.StatusOK, groupResource(record))
+}
+
+// ============================================================================
+// POST
+// ============================================================================
+
+// Provisions a group with its members
+//
+// The admin whose token provisions the group becomes its creator, without
+// joining it.
+func (s *SCIM) groupsPost(w http.ResponseWriter, r *http.Request) {
+	var input scim.Group
+
+	// Parse request
+	if err := read(w, r, "scim.groupsPost", &input); err != nil {
+		s.error(w, err)
+		return
+	}
+
+	// Validate parameters
+	if err := validateGroup(input.DisplayName, "scim.groupsPost"); err != nil {
+		s.error(w, err)
+		return
+	}
+	members, membersErr := memberIDs(input.Members)
+	if membersErr != nil {
+		s.error(w, invalid(membersErr, "scim.groupsPost"))
+		return
+	}
+
+	// Create the group
+	creator := middleware.ContextGetUser(r)
+	record, err := s.group.InsertProvisioned(input.DisplayName, creator.ID, members)
+	if err != nil {
+		s.error(w, groupConflict(err, input.DisplayName))
+		return
+	}
+
+	s.sendGroup(w, record.ID, http.StatusCreated, "scim.groupsPost")
+}
+
+// ============================================================================
+// PUT
+// ============================================================================
+
+// Replaces the name and members of a group
+func (s *SCIM) groupPut(w http.ResponseWriter, r *http.Request) {
+	var input scim.Group
+
+	record, err := s.groupRecord(r, "scim.groupPut")
+	if err != nil {
+		s.error(w, err)
+		return
+	}
+
+	// Parse request
+	if err := read(w, r, "scim.groupPut", &input); err != nil {
+		s.error(w, err)
+		return
+	}
+	members, membersErr := memberIDs(input.Members)
+	if membersErr != nil {
+		s.error(w, invalid(membersErr, "scim.groupPut"))
+		return
+	}
+
+	s.updateGroup(w, record, input.DisplayName, members, "scim.groupPut")
+}
+
+// ============================================================================
+// PATCH
+// ============================================================================
+
+// Applies operations to the name and members of a group
+//
+// Members are removed with a `members[value eq "<id>"]` path or by listing
+// them in the value.
+func (s *SCIM) groupPatch(w http.ResponseWriter, r *http.Request) {
+	var input scim.PatchRequest
+
+	record, err := s.groupRecord(r, "scim.groupPatch")
+	if err != nil {
+		s.error(w, err)
+		return
+	}
+
+	// Parse request
+	if err := read(w, r, "scim.groupPatch", &input); err != nil {
+		s.error(w, err)
+		return
+	}
+
+	name := record.Name
+	members := map[int64]bool{}
+	for _, user := range record.Users {
+		members[user.ID] = true
+	}
+
+	apply := func(kind string, path scim.Path, value json.RawMessage) error {
+		switch path.Attribute {
+		case "displayname":
+			if kind == "remove" {
+				return fmt.Errorf("%w: displayName can't be removed", scim.ErrInvalidPath)
+			}
+			var err error
+			name, err = scim.ParseString(value)
+			return err
+
+		case "members":
+			return patchMembers(members, kind, path, value)
+		}
+		return nil
+	}
+
+	for _, operation := range input.Operations {
+		kind, err := operation.Kind()
+		if err != nil {
+			s.error(w, invalid(err, "scim.groupPatch"))
+			return
+		}
+
+		if err := patch(kind, operation, apply); err != nil {
+			s.error(w, invalid(err, "scim.groupPatch"))
+			return
+		}
+	}
+
+	ids := make([]int64, 0, len(members))
+	for id := range members {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	s.updateGroup(w, record, name, ids, "scim.groupPatch")
+}
+
+// ============================================================================
+// DELETE
+// ============================================================================
+
+// Deprovisions a group by moving it to the trash, which its creator can
+// restore it from
+func (s *SCIM) groupDelete(w http.ResponseWriter, r *http.Request) {
+	record, err := s.groupRecord(r, "scim.groupDelete")
+	if err != nil {
+		s.error(w, err)
+		return
+	}
+
+	if err := s.group.DeleteByGroupID(record.ID, record.Version); err != nil {
+		s.error(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ============================================================================
+// Helpers
+// ============================================================================
+
+// Gets the group of a request with its members, if it is bound to the
+// identity provider
+func (s *SCIM) groupRecord(r *http.Request, op string) (*group.GroupRecordWithUsers, *xerrors.AppError) {
+	id, err := resourceID(r, "group", op)
+	if err != nil {
+		return nil, err
+	}
+
+	records, _, err := s.group.GetAll(group.GroupFilter{ID: id}, 0, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(*records) == 0 {
+		return nil, notFound("group", r.PathValue("id"), op)
+	}
+
+	return &(*records)[0], nil
+}
+
+// Sets the name and members of a group, and sends the group back
+func (s *SCIM) updateGroup(w http.ResponseWriter, record *group.GroupRecordWithUsers, name string, members []int64, op string) {
+	if err := validateGroup(name, op); err != nil {
+		s.error(w, err)
+		return
+	}
+
+	if _, err := s.group.UpdateProvisioned(record.ID, name, members, record.Version); err != nil {
+		s.error(w, groupConflict(err, name))
+		return
+	}
+
+	s.sendGroup(w, record.ID, http.StatusOK, op)
+}
+
+// Sends a group as it is stored
+func (s *SCIM) sendGroup(w http.ResponseWriter, id int64, status int, op string) {
+	records, _, err := s.group.GetAll(group.GroupFilter{ID: id}, 0, 1)
+	if err != nil {
+		s.error(w, err)
+		return
+	}
+	if len(*records) == 0 {
+		s.error(w, notFound("group", strconv.FormatInt(id, 10), op))
+		return
+	}
+
+	resource := groupResource(&(*records)[0])
+	w.Header().Set("Location", resource.Meta.Location)
+	s.write(w, op, status, resource)
+}
+
+// Applies an operation on the members of a group
+func patchMembers(members map[int64]bool, kind string, path scim.Path, value json.RawMessage) error {
+	// Removes the members matching the filter of the path
+	if kind == "remove" && path.Filter != nil {
+		for _, condition := range path.Filter {
+			value, ok := condition.Text()
+			if condition.Attribute != "value" || condition.Operator != "eq" || !ok {
+				return fmt.Errorf("%w: members can only be selected with value eq", scim.ErrInvalidPath)
+			}
+			if id, err := strconv.ParseInt(value, 10, 64); err == nil {
+				delete(members, id)
+			}
+		}
+		return nil
+	}
+
+	// Removes every member
+	if kind == "remove" && (len(value) == 0 || string(value) == "null") {
+		clear(members)
+		return nil
+	}
+
+	list, err := scim.ParseMembers(value)
+	if err != nil {
+		return err
+	}
+	ids, err := memberIDs(list)
+	if err != nil {
+		return err
+	}
+
+	if kind == "replace" {
+		clear(members)
+	}
+	for _, id := range ids {
+		if kind == "remove" {
+			delete(members, id)
+		} else {
+			members[id] = true
+		}
+	}
+	return nil
+}
+
+// Checks the name of a group
+func validateGroup(name, op string) *xerrors.AppError {
+	v := validator.New()
+	v.Check(len(name) > 0, "displayName", "must be provided")
+	return v.Valid(op)
+}
+
+// Reports name conflicts as a uniqueness error
+func groupConflict(err *xerrors.AppError, name string) *xerrors.AppError {
+	err.If(xerrors.ErrUniqueViolation, func(err *xerrors.AppError) {
+		err.Data = fmt.Sprintf("A group named %s already exists", name)
+	})
+	return err
+}
+
+// Builds the filter of a group listing
+//
+// Groups are looked up by displayName and id, compared with eq.
+func groupFilter(raw, op string) (group.GroupFilter, *xerrors.AppError) {
+	var filter group.GroupFilter
+	if raw == "" {
+		return filter, nil
+	}
+
+	conditions, err := scim.ParseFilter(raw)
+	if err != nil {
+		return filter, invalid(err, op)
+	}
+
+	for _, condition := range conditions {
+		value, appErr := equals(condition, op)
+		if appErr != nil {
+			return filter, appErr
+		}
+		switch condition.Attribute {
+		case "displayname":
+			filter.Name = value
+		case "id":
+			// IDs that are not numbers match no group
+			filter.ID = -1
+			if id, err := strconv.ParseInt(value, 10, 64); err == nil && id > 0 {
+				filter.ID = id
+			}
+		default:
+			return filter, badRequest(scim.ErrInvalidFilter,
+				fmt.Sprintf("Groups can't be filtered by %s", condition.Attribute), op, nil)
+		}
+	}
+
+	return filter, nil
+}
+
+// Converts a group to its SCIM resource
+func groupResource(record *group.GroupRecordWithUsers) scim.Group {
+	id := strconv.FormatInt(record.ID, 10)
+
+	members := make([]scim.Member, 0, len(record.Users))
+	for _, user := range record.Users {
+		members = append(members, scim.Member{Value: strconv.FormatInt(user.ID, 10), Display: user.Email})
+	}
+
+	return scim.Group{
+		Schemas:     []string{scim.SchemaGroup},
+		ID:          id,
+		DisplayName: record.Name,
+		Members:     members,
+		Meta: &scim.Meta{
+			ResourceType: "Group",
+			Created:      record.CreatedAt,
+			Location:     GroupsRoute + "/" + id,
+			Version:      fmt.Sprintf(`W/"%d"`, record.Version),
+		},
+	}
+}
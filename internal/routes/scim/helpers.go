@@ -0,0 +1,242 @@
+package scim
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"pm4devs.strawhats/internal/models/core"
+	"pm4devs.strawhats/internal/scim"
+	"pm4devs.strawhats/internal/xerrors"
+)
+
+// ============================================================================
+// Service Provider Configuration
+// ============================================================================
+
+// Describes the supported features to the identity provider
+func (s *SCIM) serviceProviderConfigGet(w http.ResponseWriter, r *http.Request) {
+	s.write(w, "scim.serviceProviderConfigGet", http.StatusOK, scim.ServiceProviderConfig(core.MaxPageLimit))
+}
+
+// ============================================================================
+// Responses
+// ============================================================================
+
+// Writes a SCIM resource or message
+func (s *SCIM) write(w http.ResponseWriter, op string, status int, data any) {
+	response, err := json.Marshal(data)
+	if err != nil {
+		s.error(w, xerrors.ServerError(op, fmt.Errorf("%w: %v", xerrors.ErrServerInternal, err)))
+		return
+	}
+
+	w.Header().Set("Content-Type", scim.ContentType)
+	w.WriteHeader(status)
+	w.Write(response)
+}
+
+// Writes an error as a SCIM error response, which identity providers expect
+// instead of the usual envelope
+func (s *SCIM) error(w http.ResponseWriter, err *xerrors.AppError) {
+	s.logger.Error(err.Error())
+
+	status := err.StatusCode
+	scimType := ""
+	switch {
+	case err.Matches(xerrors.ErrFailedValidation):
+		status = http.StatusBadRequest
+		scimType = scim.ErrInvalidValue.Error()
+	case err.Matches(xerrors.ErrUniqueViolation):
+		scimType = scim.Uniqueness
+	case err.Matches(scim.ErrInvalidFilter):
+		scimType = scim.ErrInvalidFilter.Error()
+	case err.Matches(scim.ErrInvalidPath):
+		scimType = scim.ErrInvalidPath.Error()
+	case err.Matches(scim.ErrInvalidValue):
+		scimType = scim.ErrInvalidValue.Error()
+	case err.Matches(scim.ErrInvalidSyntax), err.Matches(xerrors.ErrBadRequest):
+		scimType = scim.ErrInvalidSyntax.Error()
+	}
+
+	s.write(w, err.Op, status, scim.NewError(status, scimType, detail(err.Data)))
+}
+
+// Returns the message of an error, joining validation errors
+func detail(data any) string {
+	switch data := data.(type) {
+	case string:
+		return data
+	case map[string]string:
+		messages := make([]string, 0, len(data))
+		for key, message := range data {
+			messages = append(messages, key+" "+message)
+		}
+		// Map order is random, keep error messages stable
+		sort.Strings(messages)
+		return strings.Join(messages, ", ")
+	default:
+		return fmt.Sprint(data)
+	}
+}
+
+// ============================================================================
+// Requests
+// ============================================================================
+
+// Reads a SCIM request body. Unlike rest.ReadJSON, unknown attributes are
+// ignored, as identity providers send many the resources don't have.
+func read(w http.ResponseWriter, r *http.Request, op string, dst any) *xerrors.AppError {
+	r.Body = http.MaxBytesReader(w, r.Body, 1_048_576)
+	dec := json.NewDecoder(r.Body)
+
+	if err := dec.Decode(dst); err != nil {
+		message := "Request body is malformed"
+		switch {
+		case errors.Is(err, io.EOF):
+			message = "Request body cannot be empty"
+		case err.Error() == "http: request body too large":
+			message = "Request body must not be larger than 1MB"
+		}
+		return badRequest(scim.ErrInvalidSyntax, message, op, err)
+	}
+
+	return nil
+}
+
+// Reads the ID of the resource of a request, unknown if not a number
+func resourceID(r *http.Request, resource, op string) (int64, *xerrors.AppError) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, notFound(resource, r.PathValue("id"), op)
+	}
+	return id, nil
+}
+
+// Reads the 1-based index of the first resource and the number of resources
+// to list, returning the offset and limit of the query
+func page(r *http.Request, op string) (int, int, *xerrors.AppError) {
+	offset, limit := 0, core.DefaultPageLimit
+	query := r.URL.Query()
+
+	if value := query.Get("startIndex"); value != "" {
+		startIndex, err := strconv.Atoi(value)
+		if err != nil {
+			return 0, 0, badRequest(scim.ErrInvalidValue, "startIndex must be a number", op, err)
+		}
+		// Values below 1 are interpreted as 1
+		offset = max(startIndex, 1) - 1
+	}
+
+	if value := query.Get("count"); value != "" {
+		count, err := strconv.Atoi(value)
+		if err != nil {
+			return 0, 0, badRequest(scim.ErrInvalidValue, "count must be a number", op, err)
+		}
+		// Negative values are interpreted as 0
+		limit = min(max(count, 0), core.MaxPageLimit)
+	}
+
+	return offset, limit, nil
+}
+
+// Returns the condition of a filter comparing an attribute with a string, the
+// only comparison supported
+func equals(condition scim.Condition, op string) (string, *xerrors.AppError) {
+	value, ok := condition.Text()
+	if condition.Operator != "eq" || !ok {
+		return "", badRequest(scim.ErrInvalidFilter,
+			fmt.Sprintf("%s can only be compared with eq and a string", condition.Attribute), op, nil)
+	}
+	return value, nil
+}
+
+// Parses the IDs of members, which must be users
+func memberIDs(members []scim.Member) ([]int64, error) {
+	ids := make([]int64, 0, len(members))
+	for _, member := range members {
+		id, err := strconv.ParseInt(member.Value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: member %q is not a user", scim.ErrInvalidValue, member.Value)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// Applies a PATCH operation with apply, once per attribute when the operation
+// has no path and its value holds the attributes
+func patch(kind string, operation scim.Operation, apply func(kind string, path scim.Path, value json.RawMessage) error) error {
+	if operation.Path != "" {
+		path, err := scim.ParsePath(operation.Path)
+		if err != nil {
+			return err
+		}
+		return apply(kind, path, operation.Value)
+	}
+
+	if kind == "remove" {
+		return fmt.Errorf("%w: remove requires a path", scim.ErrInvalidPath)
+	}
+	var attributes map[string]json.RawMessage
+	if err := json.Unmarshal(operation.Value, &attributes); err != nil {
+		return fmt.Errorf("%w: the value of an operation without a path must be an object", scim.ErrInvalidValue)
+	}
+
+	// Map order is random, apply the attributes in a stable order
+	names := make([]string, 0, len(attributes))
+	for name := range attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		path, err := scim.ParsePath(name)
+		if err != nil {
+			return err
+		}
+		if err := apply(kind, path, attributes[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ============================================================================
+// Errors
+// ============================================================================
+
+// Returns a 400 Bad Request with a SCIM detail error
+func badRequest(scimErr error, message, op string, err error) *xerrors.AppError {
+	if err != nil {
+		scimErr = fmt.Errorf("%w: %v", scimErr, err)
+	}
+	return xerrors.ClientError(http.StatusBadRequest, message, op, scimErr)
+}
+
+// Returns the 400 Bad Request of an error of the scim package
+func invalid(err error, op string) *xerrors.AppError {
+	// Paths wrap the errors of their filter, trim every prefix
+	message := err.Error()
+	for trimmed := true; trimmed; {
+		trimmed = false
+		for _, scimErr := range []error{scim.ErrInvalidFilter, scim.ErrInvalidPath, scim.ErrInvalidSyntax,
+			scim.ErrInvalidValue} {
+			if rest, ok := strings.CutPrefix(message, scimErr.Error()+": "); ok {
+				message, trimmed = rest, true
+			}
+		}
+	}
+	return xerrors.ClientError(http.StatusBadRequest, message, op, err)
+}
+
+// Returns a 404 Not Found for a resource
+func notFound(resource, id, op string) *xerrors.AppError {
+	return xerrors.ClientError(http.StatusNotFound, fmt.Sprintf("No %s found with id: %s", resource, id), op,
+		xerrors.ErrNotFound)
+}
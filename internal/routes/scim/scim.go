@@ -0,0 +1,141 @@
+package scim
+
+import (
+	"net/http"
+
+	"pm4devs.strawhats/internal/app"
+	"pm4devs.strawhats/internal/models/accesstokens"
+	"pm4devs.strawhats/internal/models/group"
+	"pm4devs.strawhats/internal/models/permissions"
+	"pm4devs.strawhats/internal/models/users"
+	"pm4devs.strawhats/internal/rest"
+	"pm4devs.strawhats/internal/routes/middleware"
+	"pm4devs.strawhats/internal/xlogger"
+)
+
+// Encapsulates the Application dependencies required by routes
+type SCIM struct {
+	logger xlogger.Logger
+	rest   *rest.Rest
+	group  group.GroupRepository
+	users  users.UsersRepository
+}
+
+func New(app *app.App) *SCIM {
+	return &SCIM{
+		logger: app.Logger,
+		rest:   app.Rest,
+		group:  app.Models.Group,
+		users:  app.Models.Users,
+	}
+}
+
+// The identity provider authenticates with an access token of an admin
+// carrying the scim:provision scope
+func (s *SCIM) Route(mux *http.ServeMux, mw *middleware.Middleware) {
+	provisioner := func(next http.HandlerFunc) http.HandlerFunc {
+		return mw.RequireScope(accesstokens.ScopeSCIM, mw.RequirePermission(permissions.PermissionAdmin, next))
+	}
+
+	mux.HandleFunc(ServiceProviderConfigRoute, provisioner(s.ServiceProviderConfig))
+	mux.HandleFunc(UsersRoute, provisioner(s.Users))
+	mux.HandleFunc(UserRoute, provisioner(s.User))
+	mux.HandleFunc(GroupsRoute, provisioner(s.Groups))
+	mux.HandleFunc(GroupRoute, provisioner(s.Group))
+}
+
+// ============================================================================
+// Service Provider Configuration
+// ============================================================================
+
+const ServiceProviderConfigRoute = "/scim/v2/ServiceProviderConfig"
+
+func (s *SCIM) ServiceProviderConfig(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.serviceProviderConfigGet(w, r)
+
+	default:
+		s.rest.MethodNotAllowed(w, r, "GET")
+	}
+}
+
+// ============================================================================
+// Users
+// ============================================================================
+
+const UsersRoute = "/scim/v2/Users"
+
+func (s *SCIM) Users(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.usersGet(w, r)
+
+	case http.MethodPost:
+		s.usersPost(w, r)
+
+	default:
+		s.rest.MethodNotAllowed(w, r, "GET, POST")
+	}
+}
+
+const UserRoute = "/scim/v2/Users/{id}"
+
+func (s *SCIM) User(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.userGet(w, r)
+
+	case http.MethodPut:
+		s.userPut(w, r)
+
+	case http.MethodPatch:
+		s.userPatch(w, r)
+
+	case http.MethodDelete:
+		s.userDelete(w, r)
+
+	default:
+		s.rest.MethodNotAllowed(w, r, "GET, PUT, PATCH, DELETE")
+	}
+}
+
+// ============================================================================
+// Groups
+// ============================================================================
+
+const GroupsRoute = "/scim/v2/Groups"
+
+func (s *SCIM) Groups(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.groupsGet(w, r)
+
+	case http.MethodPost:
+		s.groupsPost(w, r)
+
+	default:
+		s.rest.MethodNotAllowed(w, r, "GET, POST")
+	}
+}
+
+const GroupRoute = "/scim/v2/Groups/{id}"
+
+func (s *SCIM) Group(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.groupGet(w, r)
+
+	case http.MethodPut:
+		s.groupPut(w, r)
+
+	case http.MethodPatch:
+		s.groupPatch(w, r)
+
+	case http.MethodDelete:
+		s.groupDelete(w, r)
+
+	default:
+		s.rest.MethodNotAllowed(w, r, "GET, PUT, PATCH, DELETE")
+	}
+}
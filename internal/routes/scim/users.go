@@ -0,0 +1,356 @@
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"pm4devs.strawhats/internal/models/users"
+	"pm4devs.strawhats/internal/scim"
+	"pm4devs.strawhats/internal/validator"
+	"pm4devs.strawhats/internal/xerrors"
+)
+
+// ============================================================================
+// GET
+// ============================================================================
+
+// Lists the users within reach of the identity provider matching the filter
+func (s *SCIM) usersGet(w http.ResponseWriter, r *http.Request) {
+	filter, err := userFilter(r.URL.Query().Get("filter"), "scim.usersGet")
+	if err != nil {
+		s.error(w, err)
+		return
+	}
+	offset, limit, err := page(r, "scim.usersGet")
+	if err != nil {
+		s.error(w, err)
+		return
+	}
+
+	records, total, err := s.users.GetAll(filter, offset, limit)
+	if err != nil {
+		s.error(w, err)
+		return
+	}
+
+	resources := make([]scim.User, 0, len(*records))
+	for i := range *records {
+		resources = append(resources, userResource(&(*records)[i]))
+	}
+	s.write(w, "scim.usersGet", http.StatusOK, scim.NewListResponse(resources, total, offset+1))
+}
+
+// Gets a user
+func (s *SCIM) userGet(w http.ResponseWriter, r *http.Request) {
+	user, err := s.user(r, "scim.userGet")
+	if err != nil {
+		s.error(w, err)
+		return
+	}
+
+	s.write(w, "scim.userGet", http.StatusOK, userResource(user))
+}
+
+// ============================================================================
+// POST
+// ============================================================================
+
+// Provisions a user, who signs in with single sign-on
+//
+// The user name is the email of the user and the user has no password.
+func (s *SCIM) usersPost(w http.ResponseWriter, r *http.Request) {
+	var input scim.User
+
+	// Parse request
+	if err := read(w, r, "scim.usersPost", &input); err != nil {
+		s.error(w, err)
+		return
+	}
+
+	// Validate parameters
+	if err := validateUser(input.UserName, "scim.usersPost"); err != nil {
+		s.error(w, err)
+		return
+	}
+
+	// Create the user
+	user, err := s.users.InsertProvisioned(input.UserName, input.FullName())
+	if err != nil {
+		s.error(w, conflict(err, input.UserName))
+		return
+	}
+	if input.Active != nil && !*input.Active {
+		if err := s.users.SetActive(user.ID, false); err != nil {
+			s.error(w, err)
+			return
+		}
+	}
+
+	s.sendUser(w, user.ID, http.StatusCreated, "scim.usersPost")
+}
+
+// ============================================================================
+// PUT
+// ============================================================================
+
+// Replaces the user name, display name and active state of a user
+func (s *SCIM) userPut(w http.ResponseWriter, r *http.Request) {
+	var input scim.User
+
+	user, err := s.user(r, "scim.userPut")
+	if err != nil {
+		s.error(w, err)
+		return
+	}
+
+	// Parse request
+	if err := read(w, r, "scim.userPut", &input); err != nil {
+		s.error(w, err)
+		return
+	}
+
+	active := !user.IsDeactivated()
+	if input.Active != nil {
+		active = *input.Active
+	}
+	s.updateUser(w, user, input.UserName, input.FullName(), active, "scim.userPut")
+}
+
+// ============================================================================
+// PATCH
+// ============================================================================
+
+// Applies operations to the user name, display name and active state of a
+// user
+//
+// Identity providers send attributes the user doesn't have, such as the
+// given name or title. Those operations are ignored rather than failing the
+// whole request.
+func (s *SCIM) userPatch(w http.ResponseWriter, r *http.Request) {
+	var input scim.PatchRequest
+
+	user, err := s.user(r, "scim.userPatch")
+	if err != nil {
+		s.error(w, err)
+		return
+	}
+
+	// Parse request
+	if err := read(w, r, "scim.userPatch", &input); err != nil {
+		s.error(w, err)
+		return
+	}
+
+	email, name, active := user.Email, user.Name, !user.IsDeactivated()
+	apply := func(kind string, path scim.Path, value json.RawMessage) error {
+		var err error
+		switch {
+		case path.Attribute == "active":
+			if kind == "remove" {
+				return fmt.Errorf("%w: active can't be removed", scim.ErrInvalidPath)
+			}
+			active, err = scim.ParseBool(value)
+
+		case path.Attribute == "username":
+			if kind == "remove" {
+				return fmt.Errorf("%w: userName can't be removed", scim.ErrInvalidPath)
+			}
+			email, err = scim.ParseString(value)
+
+		case path.Attribute == "displayname", path.Attribute == "name" && path.SubAttribute == "formatted":
+			name = ""
+			if kind != "remove" {
+				name, err = scim.ParseString(value)
+			}
+		}
+		return err
+	}
+
+	for _, operation := range input.Operations {
+		kind, err := operation.Kind()
+		if err != nil {
+			s.error(w, invalid(err, "scim.userPatch"))
+			return
+		}
+
+		if err := patch(kind, operation, apply); err != nil {
+			s.error(w, invalid(err, "scim.userPatch"))
+			return
+		}
+	}
+
+	s.updateUser(w, user, email, name, active, "scim.userPatch")
+}
+
+// ============================================================================
+// DELETE
+// ============================================================================
+
+// Deprovisions a user: the user is deactivated and their tokens revoked, but
+// their account and secrets are kept
+func (s *SCIM) userDelete(w http.ResponseWriter, r *http.Request) {
+	user, err := s.user(r, "scim.userDelete")
+	if err != nil {
+		s.error(w, err)
+		return
+	}
+
+	if err := s.users.SetActive(user.ID, false); err != nil {
+		s.error(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ============================================================================
+// Helpers
+// ============================================================================
+
+// Gets the user of a request, if it is within reach of the identity provider
+func (s *SCIM) user(r *http.Request, op string) (*users.UserRecord, *xerrors.AppError) {
+	id, err := resourceID(r, "user", op)
+	if err != nil {
+		return nil, err
+	}
+
+	records, _, err := s.users.GetAll(users.UserFilter{ID: id}, 0, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(*records) == 0 {
+		return nil, notFound("user", r.PathValue("id"), op)
+	}
+
+	return &(*records)[0], nil
+}
+
+// Sets the email, name and active state of a user, deactivating them revokes
+// their tokens, and sends the user back
+func (s *SCIM) updateUser(w http.ResponseWriter, user *users.UserRecord, email, name string, active bool, op string) {
+	if err := validateUser(email, op); err != nil {
+		s.error(w, err)
+		return
+	}
+
+	if email != user.Email || name != user.Name {
+		if err := s.users.SetProfile(user.ID, email, name); err != nil {
+			s.error(w, conflict(err, email))
+			return
+		}
+	}
+	if active == user.IsDeactivated() {
+		if err := s.users.SetActive(user.ID, active); err != nil {
+			s.error(w, err)
+			return
+		}
+	}
+
+	s.sendUser(w, user.ID, http.StatusOK, op)
+}
+
+// Sends a user as it is stored
+func (s *SCIM) sendUser(w http.ResponseWriter, id int64, status int, op string) {
+	records, _, err := s.users.GetAll(users.UserFilter{ID: id}, 0, 1)
+	if err != nil {
+		s.error(w, err)
+		return
+	}
+	if len(*records) == 0 {
+		s.error(w, notFound("user", strconv.FormatInt(id, 10), op))
+		return
+	}
+
+	user := userResource(&(*records)[0])
+	w.Header().Set("Location", user.Meta.Location)
+	s.write(w, op, status, user)
+}
+
+// Checks the user name, which must be an email
+func validateUser(email, op string) *xerrors.AppError {
+	v := validator.New()
+	v.IsEmail(email, "userName", "must be an email")
+	v.Check(!users.IsServiceAccountEmail(email), "userName", "is reserved for service accounts")
+	return v.Valid(op)
+}
+
+// Reports email conflicts as a uniqueness error
+func conflict(err *xerrors.AppError, email string) *xerrors.AppError {
+	err.If(xerrors.ErrUniqueViolation, func(err *xerrors.AppError) {
+		err.Data = fmt.Sprintf("A user with the userName %s already exists", email)
+	})
+	return err
+}
+
+// Builds the filter of a user listing
+//
+// Users are looked up by userName, displayName, active and id, compared with
+// eq.
+func userFilter(raw, op string) (users.UserFilter, *xerrors.AppError) {
+	var filter users.UserFilter
+	if raw == "" {
+		return filter, nil
+	}
+
+	conditions, err := scim.ParseFilter(raw)
+	if err != nil {
+		return filter, invalid(err, op)
+	}
+
+	for _, condition := range conditions {
+		if condition.Attribute == "active" {
+			active, ok := condition.Value.(bool)
+			if condition.Operator != "eq" || !ok {
+				return filter, badRequest(scim.ErrInvalidFilter, "active can only be compared with eq and a boolean",
+					op, nil)
+			}
+			filter.Active = &active
+			continue
+		}
+
+		value, appErr := equals(condition, op)
+		if appErr != nil {
+			return filter, appErr
+		}
+		switch condition.Attribute {
+		case "username", "emails.value":
+			filter.Email = value
+		case "displayname":
+			filter.Name = value
+		case "id":
+			// IDs that are not numbers match no user
+			filter.ID = -1
+			if id, err := strconv.ParseInt(value, 10, 64); err == nil && id > 0 {
+				filter.ID = id
+			}
+		default:
+			return filter, badRequest(scim.ErrInvalidFilter,
+				fmt.Sprintf("Users can't be filtered by %s", condition.Attribute), op, nil)
+		}
+	}
+
+	return filter, nil
+}
+
+// Converts a user to its SCIM resource
+func userResource(user *users.UserRecord) scim.User {
+	id := strconv.FormatInt(user.ID, 10)
+	active := !user.IsDeactivated()
+
+	return scim.User{
+		Schemas:     []string{scim.SchemaUser},
+		ID:          id,
+		UserName:    user.Email,
+		DisplayName: user.Name,
+		Emails:      []scim.Email{{Value: user.Email, Type: "work", Primary: true}},
+		Active:      &active,
+		Meta: &scim.Meta{
+			ResourceType: "User",
+			Created:      user.CreatedAt,
+			Location:     UsersRoute + "/" + id,
+			Version:      fmt.Sprintf(`W/"%d"`, user.Version),
+		},
+	}
+}
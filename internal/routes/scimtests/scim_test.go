@@ -0,0 +1,227 @@
+package scim
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"pm4devs.strawhats/internal/assert"
+	"pm4devs.strawhats/internal/mocks"
+	"pm4devs.strawhats/internal/models/accesstokens"
+	"pm4devs.strawhats/internal/models/permissions"
+	"pm4devs.strawhats/internal/models/sso"
+	"pm4devs.strawhats/internal/routes/accesstoken"
+	"pm4devs.strawhats/internal/routes/scim"
+	"pm4devs.strawhats/internal/routes/utils"
+	internalscim "pm4devs.strawhats/internal/scim"
+	"pm4devs.strawhats/internal/xerrors"
+)
+
+// Helper created access token type
+type created struct {
+	Data accesstokens.AccessToken `json:"data"`
+}
+
+func TestProvisioning(t *testing.T) {
+	assert.Integration(t)
+	app := mocks.App(t)
+	handler := scimHandler(app)
+
+	// An admin sets up provisioning with an access token
+	adminCredentials := `{"email": "admin@example.com", "password": "password"}`
+	assert.Check(t, utils.RegisterUser(handler, adminCredentials))
+	assert.Check(t, utils.ActivateUser(handler, app))
+	session := utils.LoginUser(handler, adminCredentials)
+
+	var token, readToken string
+	for _, scope := range []string{accesstokens.ScopeSCIM, accesstokens.ScopeSecretsRead} {
+		assert.RunHandlerTestCase(t, handler, "POST", accesstoken.TokensRoute, assert.HandlerTestCase[created]{
+			Name:   "Seed/" + scope,
+			Auth:   session,
+			Body:   fmt.Sprintf(`{"name": "identity-provider", "scopes": ["%s"]}`, scope),
+			Status: http.StatusCreated,
+			FN: func(t *testing.T, result created) {
+				if scope == accesstokens.ScopeSCIM {
+					token = result.Data.Plaintext
+				} else {
+					readToken = result.Data.Plaintext
+				}
+			},
+		})
+	}
+
+	provision[failure](t, handler, "Auth/Required", "GET", scim.UsersRoute, "", "", http.StatusUnauthorized, nil)
+	provision[failure](t, handler, "Auth/Scope", "GET", scim.UsersRoute, readToken, "", http.StatusForbidden, nil)
+	provision[failure](t, handler, "Auth/NotAdmin", "GET", scim.UsersRoute, token, "", http.StatusUnauthorized, nil)
+	admin, err := app.Models.Users.GetByEmail("admin@example.com")
+	assert.Check(t, err == nil)
+	_, err = app.Models.Permissions.Insert(admin.ID, permissions.PermissionAdmin)
+	assert.Check(t, err == nil)
+
+	// Users
+	body := `{
+		"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+		"userName": "alice@example.com",
+		"name": {"givenName": "Alice", "familyName": "Liddell"},
+		"externalId": "00u1"
+	}`
+	var alice internalscim.User
+	provision(t, handler, "Users/Create", "POST", scim.UsersRoute, token, body, http.StatusCreated,
+		func(t *testing.T, result internalscim.User) {
+			assert.Equal(t, result.UserName, "alice@example.com")
+			assert.Equal(t, result.DisplayName, "Alice Liddell")
+			assert.True(t, *result.Active)
+			alice = result
+		})
+	provision(t, handler, "Users/Duplicate", "POST", scim.UsersRoute, token, body, http.StatusConflict,
+		func(t *testing.T, result internalscim.Error) {
+			assert.Equal(t, result.ScimType, internalscim.Uniqueness)
+		})
+	provision(t, handler, "Users/Invalid", "POST", scim.UsersRoute, token, `{"userName": "alice"}`,
+		http.StatusBadRequest, func(t *testing.T, result internalscim.Error) {
+			assert.Equal(t, result.ScimType, internalscim.ErrInvalidValue.Error())
+			assert.Equal(t, result.Detail, "userName must be an email")
+		})
+
+	filtered := scim.UsersRoute + `?filter=userName+eq+%22ALICE@example.com%22`
+	provision(t, handler, "Users/Filter", "GET", filtered, token, "", http.StatusOK,
+		func(t *testing.T, result usersListing) {
+			assert.Equal(t, result.TotalResults, 1)
+			assert.Equal(t, result.Resources[0].ID, alice.ID)
+		})
+	provision(t, handler, "Users/FilterUnsupported", "GET", scim.UsersRoute+`?filter=title+eq+%22CEO%22`, token, "",
+		http.StatusBadRequest, func(t *testing.T, result internalscim.Error) {
+			assert.Equal(t, result.ScimType, internalscim.ErrInvalidFilter.Error())
+		})
+	provision[internalscim.Error](t, handler, "Users/NotFound", "GET", scim.UsersRoute+"/999999", token, "",
+		http.StatusNotFound, nil)
+
+	// Accounts made by hand are out of reach of the identity provider
+	adminRoute := fmt.Sprintf("%s/%d", scim.UsersRoute, admin.ID)
+	provision(t, handler, "Users/Unlinked/List", "GET", scim.UsersRoute+`?filter=userName+eq+%22admin@example.com%22`,
+		token, "", http.StatusOK, func(t *testing.T, result usersListing) {
+			assert.Equal(t, result.TotalResults, 0)
+		})
+	provision[internalscim.Error](t, handler, "Users/Unlinked/Get", "GET", adminRoute, token, "",
+		http.StatusNotFound, nil)
+	provision[internalscim.Error](t, handler, "Users/Unlinked/Patch", "PATCH", adminRoute, token,
+		`{"Operations": [{"op": "replace", "path": "userName", "value": "mallory@example.com"}]}`,
+		http.StatusNotFound, nil)
+	provision[internalscim.Error](t, handler, "Users/Unlinked/Delete", "DELETE", adminRoute, token, "",
+		http.StatusNotFound, nil)
+
+	// Deprovisioning deactivates users and revokes their tokens
+	bobCredentials := `{"email": "bob@example.com", "password": "password"}`
+	assert.Check(t, utils.RegisterUser(handler, bobCredentials))
+	assert.Check(t, utils.ActivateUser(handler, app))
+	assert.Check(t, utils.LoginUser(handler, bobCredentials) != "")
+	bob, err := app.Models.Users.GetByEmail("bob@example.com")
+	assert.Check(t, err == nil)
+	bobRoute := fmt.Sprintf("%s/%d", scim.UsersRoute, bob.ID)
+
+	// Signing in with single sign-on brings bob within reach
+	_, _, err = app.Models.SSO.Provision(sso.Identity{Issuer: "https://idp.example.com", Subject: "00u2",
+		Email: "bob@example.com"})
+	assert.Check(t, err == nil)
+
+	deactivate := `{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [{"op": "Replace", "value": {"active": "False"}}]
+	}`
+	provision(t, handler, "Users/Deactivate", "PATCH", bobRoute, token, deactivate, http.StatusOK,
+		func(t *testing.T, result internalscim.User) {
+			assert.False(t, *result.Active)
+		})
+	sessions, err := app.Models.Tokens.GetSessions(bob.ID, 0)
+	assert.Check(t, err == nil)
+	assert.Equal(t, len(*sessions), 0)
+	assert.Equal(t, utils.LoginUser(handler, bobCredentials), "")
+
+	reactivate := `{"Operations": [{"op": "replace", "path": "active", "value": true}]}`
+	provision(t, handler, "Users/Reactivate", "PATCH", bobRoute, token, reactivate, http.StatusOK,
+		func(t *testing.T, result internalscim.User) {
+			assert.True(t, *result.Active)
+		})
+	assert.Check(t, utils.LoginUser(handler, bobCredentials) != "")
+
+	provision[internalscim.Error](t, handler, "Users/Delete", "DELETE", bobRoute, token, "", http.StatusNoContent,
+		nil)
+	provision(t, handler, "Users/Inactive", "GET", scim.UsersRoute+"?filter=active+eq+false", token, "",
+		http.StatusOK, func(t *testing.T, result usersListing) {
+			assert.Equal(t, result.TotalResults, 1)
+			assert.Equal(t, result.Resources[0].UserName, "bob@example.com")
+		})
+
+	// A changed email is no longer verified, other identities can't claim the
+	// account by it
+	provision(t, handler, "Users/Rename", "PATCH", bobRoute, token,
+		`{"Operations": [{"op": "replace", "path": "userName", "value": "robert@example.com"}]}`, http.StatusOK,
+		func(t *testing.T, result internalscim.User) {
+			assert.Equal(t, result.UserName, "robert@example.com")
+		})
+	_, _, err = app.Models.SSO.Provision(sso.Identity{Issuer: "https://idp.example.com", Subject: "00u3",
+		Email: "robert@example.com"})
+	assert.True(t, err != nil && err.Matches(xerrors.ErrEditConflict))
+
+	// Groups
+	body = fmt.Sprintf(`{"displayName": "engineering", "members": [{"value": "%s"}, {"value": "%d"}]}`,
+		alice.ID, bob.ID)
+	var engineering internalscim.Group
+	provision(t, handler, "Groups/Create", "POST", scim.GroupsRoute, token, body, http.StatusCreated,
+		func(t *testing.T, result internalscim.Group) {
+			assert.Equal(t, result.DisplayName, "engineering")
+			assert.Equal(t, len(result.Members), 2)
+			engineering = result
+		})
+	provision(t, handler, "Groups/Duplicate", "POST", scim.GroupsRoute, token, body, http.StatusConflict,
+		func(t *testing.T, result internalscim.Error) {
+			assert.Equal(t, result.ScimType, internalscim.Uniqueness)
+		})
+	provision(t, handler, "Groups/Filter", "GET", scim.GroupsRoute+`?filter=displayName+eq+%22engineering%22`, token,
+		"", http.StatusOK, func(t *testing.T, result groupsListing) {
+			assert.Equal(t, result.TotalResults, 1)
+			assert.Equal(t, result.Resources[0].ID, engineering.ID)
+		})
+
+	groupRoute := scim.GroupsRoute + "/" + engineering.ID
+	patch := fmt.Sprintf(`{"Operations": [
+		{"op": "remove", "path": "members[value eq \"%d\"]"},
+		{"op": "replace", "path": "displayName", "value": "platform"}
+	]}`, bob.ID)
+	provision(t, handler, "Groups/Patch", "PATCH", groupRoute, token, patch, http.StatusOK,
+		func(t *testing.T, result internalscim.Group) {
+			assert.Equal(t, result.DisplayName, "platform")
+			assert.Equal(t, len(result.Members), 1)
+			assert.Equal(t, result.Members[0].Value, alice.ID)
+		})
+	provision(t, handler, "Groups/PatchInvalid", "PATCH", groupRoute, token,
+		`{"Operations": [{"op": "remove", "path": "displayName"}]}`, http.StatusBadRequest,
+		func(t *testing.T, result internalscim.Error) {
+			assert.Equal(t, result.ScimType, internalscim.ErrInvalidPath.Error())
+		})
+	provision(t, handler, "Groups/Replace", "PUT", groupRoute, token, `{"displayName": "platform", "members": []}`,
+		http.StatusOK, func(t *testing.T, result internalscim.Group) {
+			assert.Equal(t, len(result.Members), 0)
+		})
+
+	// Groups created by hand are out of reach of the identity provider
+	payroll, appErr := app.Models.Group.NewRecord("payroll", admin.ID)
+	assert.Check(t, appErr == nil)
+	provision(t, handler, "Groups/Unbound/List", "GET", scim.GroupsRoute, token, "", http.StatusOK,
+		func(t *testing.T, result groupsListing) {
+			assert.Equal(t, result.TotalResults, 1)
+			assert.Equal(t, result.Resources[0].ID, engineering.ID)
+		})
+	payrollRoute := fmt.Sprintf("%s/%d", scim.GroupsRoute, payroll.ID)
+	provision[internalscim.Error](t, handler, "Groups/Unbound/Get", "GET", payrollRoute, token, "",
+		http.StatusNotFound, nil)
+	provision[internalscim.Error](t, handler, "Groups/Unbound/Replace", "PUT", payrollRoute, token,
+		`{"displayName": "payroll", "members": []}`, http.StatusNotFound, nil)
+	provision[internalscim.Error](t, handler, "Groups/Unbound/Delete", "DELETE", payrollRoute, token, "",
+		http.StatusNotFound, nil)
+
+	provision[internalscim.Error](t, handler, "Groups/Delete", "DELETE", groupRoute, token, "",
+		http.StatusNoContent, nil)
+	provision[internalscim.Error](t, handler, "Groups/Deleted", "GET", groupRoute, token, "", http.StatusNotFound,
+		nil)
+}
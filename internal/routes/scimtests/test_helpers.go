@@ -0,0 +1,87 @@
+package scim
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"pm4devs.strawhats/internal/app"
+	"pm4devs.strawhats/internal/assert"
+	"pm4devs.strawhats/internal/routes/accesstoken"
+	"pm4devs.strawhats/internal/routes/auth"
+	"pm4devs.strawhats/internal/routes/middleware"
+	"pm4devs.strawhats/internal/routes/scim"
+	internalscim "pm4devs.strawhats/internal/scim"
+)
+
+// ============================================================================
+// Helpers
+// ============================================================================
+
+// Creates a complete SCIM handler including middleware. The auth and access
+// tokens routes are included to sign in and create the provisioning token.
+func scimHandler(app *app.App) http.HandlerFunc {
+	handler := func() http.Handler {
+		mux := http.NewServeMux()
+
+		middleware := middleware.New(app)
+		auth.New(app).Route(mux, middleware)
+		accesstoken.New(app).Route(mux, middleware)
+		scim.New(app).Route(mux, middleware)
+
+		return middleware.User(mux)
+	}()
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r)
+	}
+}
+
+// Sends a SCIM request, expecting the given status, and passes the decoded
+// response to fn. SCIM responses aren't application/json, which
+// assert.RunHandlerTestCase expects.
+func provision[T any](t *testing.T, handler http.HandlerFunc, name, method, route, token, body string, status int,
+	fn func(t *testing.T, result T),
+) {
+	t.Helper()
+
+	t.Run(name, func(t *testing.T) {
+		req := httptest.NewRequest(method, route, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", internalscim.ContentType)
+		if token != "" {
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		}
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+		resp := rr.Result()
+		defer resp.Body.Close()
+
+		assert.Equal(t, resp.StatusCode, status)
+		if fn != nil {
+			assert.Equal(t, resp.Header.Get("Content-Type"), internalscim.ContentType)
+			var result T
+			assert.Decode(t, resp, &result)
+			fn(t, result)
+		}
+	})
+}
+
+// Helper failure type
+type failure struct {
+	Error string `json:"error"`
+}
+
+// Helper users listing type
+type usersListing struct {
+	TotalResults int                 `json:"totalResults"`
+	Resources    []internalscim.User `json:"Resources"`
+}
+
+// Helper groups listing type
+type groupsListing struct {
+	TotalResults int                  `json:"totalResults"`
+	Resources    []internalscim.Group `json:"Resources"`
+}
@@ -46,6 +46,10 @@ func (app *Secret) get(w http.ResponseWriter, r *http.Request) {
 		app.rest.Error(w, err)
 		return
 	}
+	if err := middleware.CheckSecret(r, input.SecretID, "secrets.get"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
 	user := middleware.ContextGetUser(r)
 	currSecret, err := app.secrets.GetSecretByID(input.SecretID)
 	if err != nil {
@@ -63,6 +67,21 @@ func (app *Secret) get(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
+	// Recipients get the content key wrapped for them instead of the owner's
+	if currSecret.OwnerID != user.ID {
+		wrappedKey, err := app.secrets.GetWrappedKey(currSecret.ID, user.ID)
+		if err != nil {
+			app.rest.Error(w, err)
+			return
+		}
+		currSecret.WrappedKey, currSecret.KeyFingerprint = nil, nil
+		if wrappedKey != nil {
+			currSecret.WrappedKey, currSecret.KeyFingerprint = &wrappedKey.WrappedKey, wrappedKey.Fingerprint
+		}
+	}
+	if app.rest.NotModified(w, r, rest.ETag(currSecret.ID, currSecret.Version)) {
+		return
+	}
 	app.rest.WriteJSON(w, "secrets.get", http.StatusOK, rest.Envelope{
 		"message": "Success!",
 		"data":    currSecret,
@@ -71,10 +90,15 @@ func (app *Secret) get(w http.ResponseWriter, r *http.Request) {
 
 func (app *Secret) update(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		SecretID      int64  `json:"secret_id"`
-		Name          string `json:"name"`
-		EncryptedData string `json:"encrypted_data"`
-		IV            string `json:"iv"`
+		SecretID      int64             `json:"secret_id"`
+		Name          string            `json:"name"`
+		EncryptedData string            `json:"encrypted_data"`
+		IV            string            `json:"iv"`
+		Cipher        *secrets.Cipher   `json:"cipher"`
+		CipherVersion *int              `json:"cipher_version"`
+		Kind          *secrets.Kind     `json:"kind"`
+		Tags          *[]string         `json:"tags"`
+		Metadata      *secrets.Metadata `json:"metadata"`
 	}
 	// Parse request
 	if err := app.rest.ReadJSON(w, r, "secrets.update", &input); err != nil {
@@ -87,10 +111,18 @@ func (app *Secret) update(w http.ResponseWriter, r *http.Request) {
 	v.Check(len(input.Name) > 0, "name", "must be provided")
 	v.Check(len(input.EncryptedData) > 0, "encrypted_data", "must be provided")
 	v.Check(len(input.IV) > 0, "iv", "must be provided")
+	if input.Tags != nil {
+		*input.Tags = normalizeTags(*input.Tags)
+	}
+	checkCipher(v, input.Cipher, input.CipherVersion)
 	if err := v.Valid("secrets.update"); err != nil {
 		app.rest.Error(w, err)
 		return
 	}
+	if err := middleware.CheckSecret(r, input.SecretID, "secrets.update"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
 
 	user := middleware.ContextGetUser(r)
 	permission, err := app.secrets.GetUserSecretPermission(user.ID, input.SecretID)
@@ -104,12 +136,48 @@ func (app *Secret) update(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
-	err = app.secrets.Update(input.SecretID, input.Name, input.EncryptedData, input.IV)
+
+	current, err := app.secrets.GetSecretByID(input.SecretID)
 	if err != nil {
 		app.rest.Error(w, err)
 		return
 	}
+	if err := rest.IfMatch(r, rest.ETag(current.ID, current.Version), "secrets.update"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	// Labels are only replaced when given, keeping the current value otherwise.
+	// The result is checked as a whole since a new kind may require metadata.
+	current.Name = input.Name
+	current.EncryptedData = []byte(input.EncryptedData)
+	current.IV = []byte(input.IV)
+	current.Cipher, current.CipherVersion = resolveCipher(current.Cipher, current.CipherVersion,
+		input.Cipher, input.CipherVersion)
+	if input.Kind != nil {
+		current.Kind = *input.Kind
+	}
+	if input.Tags != nil {
+		current.Tags = *input.Tags
+	}
+	if input.Metadata != nil {
+		current.Metadata = *input.Metadata
+	}
+	if input.Kind != nil || input.Tags != nil || input.Metadata != nil {
+		v := validator.New()
+		checkLabels(v, current.Kind, current.Tags, current.Metadata)
+		if err := v.Valid("secrets.update"); err != nil {
+			app.rest.Error(w, err)
+			return
+		}
+	}
+
+	if err := app.secrets.Update(current); err != nil {
+		app.rest.Error(w, rest.Precondition(r, err))
+		return
+	}
 
+	w.Header().Set("ETag", rest.ETag(current.ID, current.Version))
 	app.rest.WriteJSON(w, "secrets.update", http.StatusOK, rest.Envelope{
 		"message": "Success!",
 	})
@@ -131,6 +199,10 @@ func (app *Secret) delete(w http.ResponseWriter, r *http.Request) {
 		app.rest.Error(w, err)
 		return
 	}
+	if err := middleware.CheckSecret(r, input.SecretID, "secrets.delete"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
 	user := middleware.ContextGetUser(r)
 	currSecret, err := app.secrets.GetSecretByID(input.SecretID)
 	if err != nil {
@@ -143,11 +215,15 @@ func (app *Secret) delete(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
-	err = app.secrets.Delete(input.SecretID)
-	if err != nil {
+	if err := rest.IfMatch(r, rest.ETag(currSecret.ID, currSecret.Version), "secrets.delete"); err != nil {
 		app.rest.Error(w, err)
 		return
 	}
+	err = app.secrets.Delete(input.SecretID, currSecret.Version)
+	if err != nil {
+		app.rest.Error(w, rest.Precondition(r, err))
+		return
+	}
 	app.rest.WriteJSON(w, "secrets.delete", http.StatusNoContent, rest.Envelope{
 		"message": "Success!",
 	})
@@ -161,9 +237,16 @@ func (app *Secret) createNew(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	var input struct {
-		Name          string `json:"name"`
-		EncryptedData string `json:"encrypted_data"`
-		IV            string `json:"iv"`
+		Name           string           `json:"name"`
+		EncryptedData  string           `json:"encrypted_data"`
+		IV             string           `json:"iv"`
+		Cipher         *secrets.Cipher  `json:"cipher"`
+		CipherVersion  *int             `json:"cipher_version"`
+		Kind           secrets.Kind     `json:"kind"`
+		Tags           []string         `json:"tags"`
+		Metadata       secrets.Metadata `json:"metadata"`
+		WrappedKey     *string          `json:"wrapped_key"`
+		KeyFingerprint *string          `json:"key_fingerprint"`
 	}
 	// Parse request
 	if err := app.rest.ReadJSON(w, r, "secrets.createNew", &input); err != nil {
@@ -175,18 +258,71 @@ func (app *Secret) createNew(w http.ResponseWriter, r *http.Request) {
 	v.Check(len(input.Name) > 0, "name", "must be provided")
 	v.Check(len(input.EncryptedData) > 0, "encrypted_data", "must be provided")
 	v.Check(len(input.IV) > 0, "iv", "Initialization vector must be provided")
+	if input.Kind == "" {
+		input.Kind = secrets.KindNote
+	}
+	input.Tags = normalizeTags(input.Tags)
+	checkLabels(v, input.Kind, input.Tags, input.Metadata)
+	checkCipher(v, input.Cipher, input.CipherVersion)
+	checkKeyFingerprint(v, input.WrappedKey, input.KeyFingerprint)
 	if err := v.Valid("secrets.createNew"); err != nil {
 		app.rest.Error(w, err)
 		return
 	}
+	if err := middleware.CheckSecret(r, 0, "secrets.createNew"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
 
 	user := middleware.ContextGetUser(r)
-	newSecret, err := app.secrets.NewRecord(input.Name, input.EncryptedData, input.IV, user.ID)
-	if err != nil {
+	cipher, cipherVersion := resolveCipher(secrets.DefaultCipher, secrets.DefaultCipherVersion,
+		input.Cipher, input.CipherVersion)
+	newSecret := &secrets.SecretRecord{
+		Name:           input.Name,
+		EncryptedData:  []byte(input.EncryptedData),
+		IV:             []byte(input.IV),
+		Cipher:         cipher,
+		CipherVersion:  cipherVersion,
+		OwnerID:        user.ID,
+		Kind:           input.Kind,
+		Tags:           input.Tags,
+		Metadata:       input.Metadata,
+		WrappedKey:     input.WrappedKey,
+		KeyFingerprint: input.KeyFingerprint,
+	}
+	if err := app.secrets.NewRecord(newSecret); err != nil {
 		app.rest.Error(w, err)
+		return
 	}
 	app.rest.WriteJSON(w, "secret.createNew", http.StatusCreated, rest.Envelope{
 		"message":   "Success! Your secret has been created.",
 		"secret_id": newSecret.ID,
 	})
 }
+
+// ============================================================================
+// Helpers
+// ============================================================================
+
+// Checks the cipher and cipher version of a secret when given
+func checkCipher(v *validator.Validator, cipher *secrets.Cipher, cipherVersion *int) {
+	if cipher != nil {
+		v.Check(cipher.Valid(), "cipher", "must be one of aes-256-gcm or xchacha20-poly1305")
+	}
+	if cipherVersion != nil {
+		v.Check(*cipherVersion > 0, "cipher_version", "must be greater than zero")
+	}
+}
+
+// Returns the cipher and cipher version of a secret with the given ones
+// applied. A new cipher without a version starts at the first version of its
+// format.
+func resolveCipher(cipher secrets.Cipher, cipherVersion int, newCipher *secrets.Cipher, newVersion *int) (secrets.Cipher, int) {
+	if newCipher != nil && *newCipher != cipher {
+		cipher, cipherVersion = *newCipher, secrets.DefaultCipherVersion
+	}
+	if newVersion != nil {
+		cipherVersion = *newVersion
+	}
+	return cipher, cipherVersion
+}
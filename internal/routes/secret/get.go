@@ -2,7 +2,10 @@ package secret
 
 import (
 	"net/http"
+	"slices"
 
+	"pm4devs.strawhats/internal/models/core"
+	"pm4devs.strawhats/internal/models/secrets"
 	"pm4devs.strawhats/internal/rest"
 	"pm4devs.strawhats/internal/routes/middleware"
 	"pm4devs.strawhats/internal/validator"
@@ -15,16 +18,23 @@ func (app *Secret) getUserSecrets(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
+	filter, err := readSecretFilter(r, "secrets.getUserSecrets")
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	page, err := core.ParsePage(r.URL.Query(), "secrets.getUserSecrets")
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
 	user := middleware.ContextGetUser(r)
-	userSecrets, err := app.secrets.GetByUserID(user.ID)
+	userSecrets, next, err := app.secrets.GetByUserID(user.ID, filter, page)
 	if err != nil {
 		app.rest.Error(w, err)
 		return
 	}
-	app.rest.WriteJSON(w, "secret.createNew", http.StatusOK, rest.Envelope{
-		"message": "Success!",
-		"data":    userSecrets,
-	})
+	app.rest.WritePage(w, "secrets.getUserSecrets", userSecrets, page.Fields, next)
 }
 
 const GetGroupSecretsRoute = "/v1/secrets/group"
@@ -49,6 +59,11 @@ func (app *Secret) getGroupSecrets(w http.ResponseWriter, r *http.Request) {
 		app.rest.Error(w, err)
 		return
 	}
+	page, err := core.ParsePage(r.URL.Query(), "secrets.getGroupSecrets")
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
 	user := middleware.ContextGetUser(r)
 	group, err := app.group.GetGroupUsers(input.GroupName)
 	if err != nil {
@@ -67,15 +82,22 @@ func (app *Secret) getGroupSecrets(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
-	data, err := app.secrets.GetByGroupID(group.ID)
+	if err := middleware.CheckGroup(r, group.ID, "secrets.getGroupSecrets"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	data, next, err := app.secrets.GetByGroupID(group.ID, user.ID, page)
 	if err != nil {
 		app.rest.Error(w, err)
 		return
 	}
-	app.rest.WriteJSON(w, "secrets.getGroupSecrets", http.StatusOK, rest.Envelope{
-		"message": "Success!",
-		"data":    data,
+	// Access tokens restricted to some secrets only list those, pages may
+	// come out shorter
+	accessToken := middleware.ContextGetAccessToken(r)
+	*data = slices.DeleteFunc(*data, func(secret secrets.SecretRecord) bool {
+		return !accessToken.AllowsSecret(secret.ID)
 	})
+	app.rest.WritePage(w, "secrets.getGroupSecrets", data, page.Fields, next)
 }
 
 const GetSecretsSharedToUser = "/v1/secrets/sharedto/user"
@@ -85,16 +107,23 @@ func (app *Secret) getSharedToUserSecrets(w http.ResponseWriter, r *http.Request
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
+	filter, err := readSecretFilter(r, "secrets.getSharedToUserSecrets")
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	page, err := core.ParsePage(r.URL.Query(), "secrets.getSharedToUserSecrets")
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
 	user := middleware.ContextGetUser(r)
-	userSecrets, err := app.secrets.GetSecretsSharedWithUser(user.ID)
+	userSecrets, next, err := app.secrets.GetSecretsSharedWithUser(user.ID, filter, page)
 	if err != nil {
 		app.rest.Error(w, err)
 		return
 	}
-	app.rest.WriteJSON(w, "secret.createNew", http.StatusOK, rest.Envelope{
-		"message": "Success!",
-		"data":    userSecrets,
-	})
+	app.rest.WritePage(w, "secrets.getSharedToUserSecrets", userSecrets, page.Fields, next)
 }
 
 const GetSecretsSharedByUser = "/v1/secrets/sharedby/user"
@@ -104,16 +133,23 @@ func (app *Secret) getSharedByUserSecrets(w http.ResponseWriter, r *http.Request
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
+	filter, err := readSecretFilter(r, "secrets.getSharedByUserSecrets")
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	page, err := core.ParsePage(r.URL.Query(), "secrets.getSharedByUserSecrets")
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
 	user := middleware.ContextGetUser(r)
-	shared, err := app.secrets.GetSecretsSharedToOtherUsers(user.ID)
+	shared, next, err := app.secrets.GetSecretsSharedToOtherUsers(user.ID, filter, page)
 	if err != nil {
 		app.rest.Error(w, err)
 		return
 	}
-	app.rest.WriteJSON(w, "secret.createNew", http.StatusOK, rest.Envelope{
-		"message": "Success!",
-		"data":    shared,
-	})
+	app.rest.WritePage(w, "secrets.getSharedByUserSecrets", shared, page.Fields, next)
 }
 
 const GetSecretsSharedToGroup = "/v1/secrets/sharedto/group"
@@ -124,14 +160,21 @@ func (app *Secret) getSharedToGroupSecrets(w http.ResponseWriter, r *http.Reques
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
+	filter, err := readSecretFilter(r, "secrets.getSharedToGroupSecrets")
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	page, err := core.ParsePage(r.URL.Query(), "secrets.getSharedToGroupSecrets")
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
 	user := middleware.ContextGetUser(r)
-	shared, err := app.secrets.GetSecretsSharedToGroups(user.ID)
+	shared, next, err := app.secrets.GetSecretsSharedToGroups(user.ID, filter, page)
 	if err != nil {
 		app.rest.Error(w, err)
 		return
 	}
-	app.rest.WriteJSON(w, "secret.createNew", http.StatusOK, rest.Envelope{
-		"message": "Success!",
-		"data":    shared,
-	})
+	app.rest.WritePage(w, "secrets.getSharedToGroupSecrets", shared, page.Fields, next)
 }
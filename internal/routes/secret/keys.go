@@ -0,0 +1,252 @@
+package secret
+
+import (
+	"fmt"
+	"net/http"
+
+	"pm4devs.strawhats/internal/models/secrets"
+	"pm4devs.strawhats/internal/models/users"
+	"pm4devs.strawhats/internal/rest"
+	"pm4devs.strawhats/internal/routes/middleware"
+	"pm4devs.strawhats/internal/validator"
+	"pm4devs.strawhats/internal/xerrors"
+)
+
+// Content keys wrapped for recipients, by user email and by group name then
+// member email, along with the fingerprints of the public keys they were
+// wrapped with by recipient email
+type wrappedKeysInput struct {
+	UserKeys        map[string]string            `json:"user_keys"`
+	GroupKeys       map[string]map[string]string `json:"group_keys"`
+	KeyFingerprints map[string]string            `json:"key_fingerprints"`
+}
+
+const SecretKeysRoute = "/v1/secrets/keys"
+
+// Stores content keys wrapped for the owner and the current recipients of a
+// secret, such as a member who joined a group after the secret was shared
+func (app *Secret) setWrappedKeys(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		app.rest.MethodNotAllowed(w, r, "PUT")
+		return
+	}
+	var input struct {
+		SecretID int64   `json:"secret_id"`
+		OwnerKey *string `json:"owner_key"`
+		wrappedKeysInput
+	}
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, "secrets.setWrappedKeys", &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	// Validate parameters
+	v := validator.New()
+	v.Check(input.SecretID > 0, "secret_id", "must be provided")
+	if err := v.Valid("secrets.setWrappedKeys"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	if err := app.validateSecretOwnership(w, r, input.SecretID); err != nil {
+		return
+	}
+	if !app.requireRekeyed(w, input.SecretID, "secrets.setWrappedKeys") {
+		return
+	}
+	keys, err := app.resolveWrappedKeys(input.wrappedKeysInput, "secrets.setWrappedKeys")
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	var ownerKey *secrets.WrappedKey
+	if input.OwnerKey != nil {
+		user := middleware.ContextGetUser(r)
+		ownerKey = &secrets.WrappedKey{UserID: user.ID, WrappedKey: *input.OwnerKey}
+		if ownerKey.Fingerprint, err = fingerprintOf(input.KeyFingerprints, user.Email, "secrets.setWrappedKeys"); err != nil {
+			app.rest.Error(w, err)
+			return
+		}
+	}
+	if err := app.secrets.SetWrappedKeys(input.SecretID, ownerKey, keys); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	app.rest.WriteJSON(w, "secrets.setWrappedKeys", http.StatusOK, rest.Envelope{
+		"message": "Success!",
+	})
+}
+
+const SecretRekeyRoute = "/v1/secrets/rekey"
+
+// Replaces the content key of a secret. The content is sent encrypted with the
+// new key, wrapped for the owner and for every recipient that keeps access.
+func (app *Secret) rekeySecret(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.rest.MethodNotAllowed(w, r, "POST")
+		return
+	}
+	var input struct {
+		SecretID      int64           `json:"secret_id"`
+		EncryptedData string          `json:"encrypted_data"`
+		IV            string          `json:"iv"`
+		Cipher        *secrets.Cipher `json:"cipher"`
+		CipherVersion *int            `json:"cipher_version"`
+		OwnerKey      string          `json:"owner_key"`
+		wrappedKeysInput
+	}
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, "secrets.rekeySecret", &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	// Validate parameters
+	v := validator.New()
+	v.Check(input.SecretID > 0, "secret_id", "must be provided")
+	v.Check(len(input.EncryptedData) > 0, "encrypted_data", "must be provided")
+	v.Check(len(input.IV) > 0, "iv", "must be provided")
+	v.Check(len(input.OwnerKey) > 0, "owner_key", "must be provided")
+	checkCipher(v, input.Cipher, input.CipherVersion)
+	if err := v.Valid("secrets.rekeySecret"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	user := middleware.ContextGetUser(r)
+	current, err := app.secrets.GetSecretByID(input.SecretID)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	if current.OwnerID != user.ID {
+		app.rest.WriteJSON(w, "secrets.rekeySecret", http.StatusUnauthorized, rest.Envelope{
+			"message": "Only owner can re-key a secret",
+		})
+		return
+	}
+	if err := rest.IfMatch(r, rest.ETag(current.ID, current.Version), "secrets.rekeySecret"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	keys, err := app.resolveWrappedKeys(input.wrappedKeysInput, "secrets.rekeySecret")
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	ownerFingerprint, err := fingerprintOf(input.KeyFingerprints, user.Email, "secrets.rekeySecret")
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	current.EncryptedData = []byte(input.EncryptedData)
+	current.IV = []byte(input.IV)
+	current.Cipher, current.CipherVersion = resolveCipher(current.Cipher, current.CipherVersion,
+		input.Cipher, input.CipherVersion)
+	current.WrappedKey, current.KeyFingerprint = &input.OwnerKey, ownerFingerprint
+	if err := app.secrets.Rekey(current, keys); err != nil {
+		app.rest.Error(w, rest.Precondition(r, err))
+		return
+	}
+
+	w.Header().Set("ETag", rest.ETag(current.ID, current.Version))
+	app.rest.WriteJSON(w, "secrets.rekeySecret", http.StatusOK, rest.Envelope{
+		"message": "Success!",
+	})
+}
+
+// ============================================================================
+// Helpers
+// ============================================================================
+
+// Writes a conflict and returns false if a secret must be re-keyed before it
+// is shared again
+func (app *Secret) requireRekeyed(w http.ResponseWriter, secretID int64, op string) bool {
+	secret, err := app.secrets.GetSecretByID(secretID)
+	if err != nil {
+		app.rest.Error(w, err)
+		return false
+	}
+	if secret.RekeyRequired {
+		app.rest.Error(w, xerrors.ClientError(http.StatusConflict,
+			"A recipient lost access to the secret, re-key it before sharing it again",
+			op, xerrors.ErrEditConflict))
+		return false
+	}
+	return true
+}
+
+// Resolves the recipients of wrapped keys given by email and group name
+//
+// Group keys may only be given for members of the group.
+func (app *Secret) resolveWrappedKeys(input wrappedKeysInput, op string) ([]secrets.WrappedKey, *xerrors.AppError) {
+	v := validator.New()
+	for _, wrappedKey := range input.UserKeys {
+		v.Check(len(wrappedKey) > 0, "user_keys", "must not be empty")
+	}
+	if err := v.Valid(op); err != nil {
+		return nil, err
+	}
+
+	keys := []secrets.WrappedKey{}
+	for email, wrappedKey := range input.UserKeys {
+		fingerprint, err := fingerprintOf(input.KeyFingerprints, email, op)
+		if err != nil {
+			return nil, err
+		}
+		user, err := app.users.GetByEmail(email)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, secrets.WrappedKey{UserID: user.ID, WrappedKey: wrappedKey, Fingerprint: fingerprint})
+	}
+	for groupName, memberKeys := range input.GroupKeys {
+		group, err := app.group.GetGroupUsers(groupName)
+		if err != nil {
+			return nil, err
+		}
+		groupKeys, err := groupWrappedKeys(group.ID, group.Users, memberKeys, input.KeyFingerprints, op)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, groupKeys...)
+	}
+	return keys, nil
+}
+
+// Matches wrapped keys given by member email with the members of a group
+func groupWrappedKeys(groupID int64, members []*users.UserRecord, memberKeys, fingerprints map[string]string, op string) ([]secrets.WrappedKey, *xerrors.AppError) {
+	v := validator.New()
+	keys := []secrets.WrappedKey{}
+	for email, wrappedKey := range memberKeys {
+		v.Check(len(wrappedKey) > 0, "wrapped_keys", "must not be empty")
+		fingerprint, ok := fingerprints[email]
+		v.Check(ok && len(fingerprint) > 0, "key_fingerprints", fmt.Sprintf("must be provided for %s", email))
+		found := false
+		for _, member := range members {
+			if member.Email == email {
+				keys = append(keys, secrets.WrappedKey{GroupID: groupID, UserID: member.ID, WrappedKey: wrappedKey,
+					Fingerprint: &fingerprint})
+				found = true
+				break
+			}
+		}
+		v.Check(found, "wrapped_keys", fmt.Sprintf("%s is not a member of the group", email))
+	}
+	if err := v.Valid(op); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// Returns the fingerprint of the public key the content key of a recipient
+// was wrapped with
+func fingerprintOf(fingerprints map[string]string, email, op string) (*string, *xerrors.AppError) {
+	fingerprint, ok := fingerprints[email]
+	v := validator.New()
+	v.Check(ok && len(fingerprint) > 0, "key_fingerprints", fmt.Sprintf("must be provided for %s", email))
+	if err := v.Valid(op); err != nil {
+		return nil, err
+	}
+	return &fingerprint, nil
+}
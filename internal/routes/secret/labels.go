@@ -0,0 +1,110 @@
+package secret
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"pm4devs.strawhats/internal/models/secrets"
+	"pm4devs.strawhats/internal/routes/middleware"
+	"pm4devs.strawhats/internal/validator"
+	"pm4devs.strawhats/internal/xerrors"
+)
+
+const (
+	maxTags          = 32
+	maxTagLength     = 64
+	maxMetadataKeys  = 32
+	maxMetadataValue = 256
+)
+
+// Trims, lowercases and de-duplicates tags
+func normalizeTags(tags []string) []string {
+	seen := make(map[string]bool, len(tags))
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
+}
+
+// Checks the kind, tags and metadata attached to a secret. Labels are stored
+// in plaintext so they are kept short, and the metadata must match the schema
+// of the kind.
+func checkLabels(v *validator.Validator, kind secrets.Kind, tags []string, metadata secrets.Metadata) {
+	v.Check(kind.Valid(), "kind", "must be one of login, api_key, ssh_key, database, tls_certificate, note or env_file")
+	v.MatchesSchema(metadata, kind.Schema(), "metadata")
+
+	v.Check(len(tags) <= maxTags, "tags", "must not contain more than 32 tags")
+	for _, tag := range tags {
+		v.Check(len(tag) <= maxTagLength, "tags", "must not be more than 64 characters long")
+	}
+
+	v.Check(len(metadata) <= maxMetadataKeys, "metadata", "must not contain more than 32 keys")
+	for key, value := range metadata {
+		v.Check(len(key) > 0 && len(key) <= maxTagLength, "metadata", "keys must be between 1 and 64 characters long")
+		v.Check(len(value) <= maxMetadataValue, "metadata", "values must not be more than 256 characters long")
+	}
+}
+
+// Reads the listing filters from the query string
+//
+//	?name=<prefix>&kind=<kind>&tag=<tag>&meta=<key>:<value>
+//	&created_after=<RFC3339>&created_before=<RFC3339>
+//	&updated_after=<RFC3339>&updated_before=<RFC3339>
+//
+// tag and meta may be repeated, every value must match.
+func readSecretFilter(r *http.Request, op string) (secrets.SecretFilter, *xerrors.AppError) {
+	query := r.URL.Query()
+	v := validator.New()
+
+	filter := secrets.SecretFilter{
+		NamePrefix: strings.TrimSpace(query.Get("name")),
+		Kind:       secrets.Kind(query.Get("kind")),
+		Tags:       normalizeTags(query["tag"]),
+	}
+	if filter.Kind != "" {
+		v.Check(filter.Kind.Valid(), "kind", "must be a known secret kind")
+	}
+
+	for _, pair := range query["meta"] {
+		key, value, ok := strings.Cut(pair, ":")
+		v.Check(ok && len(key) > 0, "meta", "must be in the form key:value")
+		if filter.Metadata == nil {
+			filter.Metadata = secrets.Metadata{}
+		}
+		filter.Metadata[key] = value
+	}
+
+	parseTime := func(key string) *time.Time {
+		raw := query.Get(key)
+		if raw == "" {
+			return nil
+		}
+		t, err := time.Parse(time.RFC3339, raw)
+		v.Check(err == nil, key, "must be an RFC 3339 timestamp")
+		if err != nil {
+			return nil
+		}
+		return &t
+	}
+	filter.CreatedAfter = parseTime("created_after")
+	filter.CreatedBefore = parseTime("created_before")
+	filter.UpdatedAfter = parseTime("updated_after")
+	filter.UpdatedBefore = parseTime("updated_before")
+
+	// Access tokens restricted to some secrets only list those
+	if accessToken := middleware.ContextGetAccessToken(r); accessToken != nil {
+		filter.IDs = accessToken.SecretIDs
+	}
+
+	if err := v.Valid(op); err != nil {
+		return secrets.SecretFilter{}, err
+	}
+	return filter, nil
+}
@@ -0,0 +1,156 @@
+package secret
+
+import (
+	"net/http"
+	"time"
+
+	"pm4devs.strawhats/internal/models/tokens"
+	"pm4devs.strawhats/internal/rest"
+	"pm4devs.strawhats/internal/routes/middleware"
+	"pm4devs.strawhats/internal/validator"
+)
+
+// Bounds of the one-time links
+const (
+	linkDefaultTTL = 24 * time.Hour
+	linkMaxTTL     = 30 * 24 * time.Hour
+	linkMaxViews   = 100
+)
+
+const SecretLinksRoute = "/v1/secrets/links"
+
+func (app *Secret) handleLinks(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		app.createLink(w, r)
+	case http.MethodDelete:
+		app.deleteLink(w, r)
+	default:
+		app.rest.MethodNotAllowed(w, r, "POST, DELETE")
+	}
+}
+
+// Opening a link is a POST so that link previews fetching the page with a GET
+// do not burn it
+const LinkRoute = "/v1/links"
+
+func (app *Secret) handleLink(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		http.ServeFile(w, r, "static/link.html")
+	case http.MethodPost:
+		app.openLink(w, r)
+	default:
+		app.rest.MethodNotAllowed(w, r, "GET, POST")
+	}
+}
+
+// Stores a payload encrypted by the client behind a new link token. The key
+// stays in the fragment of the link the client builds and is never sent.
+func (app *Secret) createLink(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		EncryptedData string     `json:"encrypted_data"`
+		IV            string     `json:"iv"`
+		MaxViews      *int       `json:"max_views"`
+		ExpiresAt     *time.Time `json:"expires_at"`
+	}
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, "secrets.createLink", &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	maxViews := 1
+	if input.MaxViews != nil {
+		maxViews = *input.MaxViews
+	}
+	ttl := linkDefaultTTL
+	if input.ExpiresAt != nil {
+		ttl = time.Until(*input.ExpiresAt)
+	}
+	// Validate parameters
+	v := validator.New()
+	v.Check(len(input.EncryptedData) > 0, "encrypted_data", "must be provided")
+	v.Check(len(input.IV) > 0, "iv", "must be provided")
+	v.Check(maxViews > 0 && maxViews <= linkMaxViews, "max_views", "must be between 1 and 100")
+	v.Check(ttl > 0, "expires_at", "must be in the future")
+	v.Check(ttl <= linkMaxTTL, "expires_at", "must be within 30 days")
+	if err := v.Valid("secrets.createLink"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	user := middleware.ContextGetUser(r)
+	token, err := app.tokens.New(user.ID, ttl, tokens.ScopeShareLink)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	link, err := app.links.NewRecord(token, input.EncryptedData, input.IV, maxViews)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	app.rest.WriteJSON(w, "secrets.createLink", http.StatusCreated, rest.Envelope{
+		"message": "Success! Your link has been created.",
+		"data":    link,
+	})
+}
+
+// Deletes a link of the user before it is used up
+func (app *Secret) deleteLink(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		LinkID int64 `json:"link_id"`
+	}
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, "secrets.deleteLink", &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	// Validate parameters
+	v := validator.New()
+	v.Check(input.LinkID > 0, "link_id", "must be provided")
+	if err := v.Valid("secrets.deleteLink"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	user := middleware.ContextGetUser(r)
+	if err := app.links.Delete(input.LinkID, user.ID); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	app.rest.WriteJSON(w, "secrets.deleteLink", http.StatusOK, rest.Envelope{
+		"message": "Success!",
+	})
+}
+
+// Returns the payload behind a link, burning it on its last view
+func (app *Secret) openLink(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token string `json:"token"`
+	}
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, "secrets.openLink", &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	// Validate parameters
+	v := validator.New()
+	v.Check(len(input.Token) > 0, "token", "must be provided")
+	if err := v.Valid("secrets.openLink"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	payload, err := app.links.Open(input.Token)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	// The payload must not outlive the link in a cache
+	w.Header().Set("Cache-Control", "no-store")
+	app.rest.WriteJSON(w, "secrets.openLink", http.StatusOK, rest.Envelope{
+		"message": "Success!",
+		"data":    payload,
+	})
+}
@@ -5,7 +5,10 @@ import (
 
 	"pm4devs.strawhats/internal/app"
 	"pm4devs.strawhats/internal/mailer"
+	"pm4devs.strawhats/internal/models/accesstokens"
 	"pm4devs.strawhats/internal/models/group"
+	"pm4devs.strawhats/internal/models/links"
+	"pm4devs.strawhats/internal/models/permissions"
 	"pm4devs.strawhats/internal/models/secrets"
 	"pm4devs.strawhats/internal/models/tokens"
 	"pm4devs.strawhats/internal/models/users"
@@ -24,6 +27,7 @@ type Secret struct {
 	users   users.UsersRepository
 	secrets secrets.SecretsRepository
 	group   group.GroupRepository
+	links   links.LinksRepository
 }
 
 func New(app *app.App) *Secret {
@@ -36,19 +40,35 @@ func New(app *app.App) *Secret {
 		users:   app.Models.Users,
 		secrets: app.Models.Secrets,
 		group:   app.Models.Group,
+		links:   app.Models.Links,
 	}
 }
 
 func (s *Secret) Route(mux *http.ServeMux, mw *middleware.Middleware) {
-	mux.HandleFunc(GetUserSecretsRoute, mw.Authenticated(s.getUserSecrets))
-	mux.HandleFunc(SecretCRUDRoute, mw.Authenticated(s.CRUDRoute))
+	mux.HandleFunc(GetUserSecretsRoute, mw.RequireScope(accesstokens.ScopeSecretsRead, s.getUserSecrets))
+	mux.HandleFunc("GET "+SecretCRUDRoute, mw.RequireScope(accesstokens.ScopeSecretsRead, s.CRUDRoute))
+	mux.HandleFunc(SecretCRUDRoute, mw.RequireScope(accesstokens.ScopeSecretsWrite, s.CRUDRoute))
 	mux.HandleFunc(SecretShareUserRoute, mw.Authenticated(s.handleShareToUser))
 	mux.HandleFunc(SecretShareGroupRoute, mw.Authenticated(s.handleShareToGroup))
 
-	mux.HandleFunc(GetGroupSecretsRoute, mw.Authenticated(s.getGroupSecrets))
-	mux.HandleFunc(GetSecretsSharedToUser, mw.Authenticated(s.getSharedToUserSecrets))
+	mux.HandleFunc(GetGroupSecretsRoute, mw.RequireScope(accesstokens.ScopeSecretsRead, s.getGroupSecrets))
+	mux.HandleFunc(GetSecretsSharedToUser, mw.RequireScope(accesstokens.ScopeSecretsRead, s.getSharedToUserSecrets))
 
 	mux.HandleFunc(GetSecretsSharedByUser, mw.Authenticated(s.getSharedByUserSecrets))
 
 	mux.HandleFunc(GetSecretsSharedToGroup, mw.Authenticated(s.getSharedToGroupSecrets))
+
+	mux.HandleFunc(SecretVersionsRoute, mw.RequireScope(accesstokens.ScopeSecretsRead, s.getSecretVersions))
+	mux.HandleFunc(SecretRollbackRoute, mw.RequireScope(accesstokens.ScopeSecretsWrite, s.rollbackSecret))
+
+	mux.HandleFunc(SecretTrashRoute, mw.Authenticated(s.handleTrash))
+
+	mux.HandleFunc(SecretLinksRoute, mw.Authenticated(s.handleLinks))
+	mux.HandleFunc(LinkRoute, s.handleLink)
+
+	mux.HandleFunc(SecretTransfersRoute, mw.Authenticated(s.handleTransfers))
+	mux.HandleFunc(SecretForceTransferRoute, mw.RequirePermission(permissions.PermissionAdmin, s.forceTransfer))
+
+	mux.HandleFunc(SecretKeysRoute, mw.Authenticated(s.setWrappedKeys))
+	mux.HandleFunc(SecretRekeyRoute, mw.Authenticated(s.rekeySecret))
 }
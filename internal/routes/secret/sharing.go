@@ -3,6 +3,7 @@ package secret
 import (
 	"fmt"
 	"net/http"
+	"time"
 
 	"pm4devs.strawhats/internal/models/secrets"
 	"pm4devs.strawhats/internal/rest"
@@ -52,9 +53,12 @@ func (app *Secret) shareToUser(w http.ResponseWriter, r *http.Request) {
 
 	// Define input structure
 	var input struct {
-		SecretID   int64              `json:"secret_id"`
-		UserEmail  string             `json:"user_email"`
-		Permission secrets.Permission `json:"permission"`
+		SecretID       int64              `json:"secret_id"`
+		UserEmail      string             `json:"user_email"`
+		Permission     secrets.Permission `json:"permission"`
+		ExpiresAt      *time.Time         `json:"expires_at"`
+		WrappedKey     *string            `json:"wrapped_key"`
+		KeyFingerprint *string            `json:"key_fingerprint"`
 	}
 
 	// Parse the request
@@ -68,6 +72,9 @@ func (app *Secret) shareToUser(w http.ResponseWriter, r *http.Request) {
 	v.Check(input.SecretID > 0, "secret_id", "must be provided")
 	v.Check(len(input.UserEmail) > 0, "user_email", "must be provided")
 	v.Check(input.Permission == "read-only" || input.Permission == "read-write", "permission", "must be 'read-only' or 'read-write'")
+	checkExpiry(v, input.ExpiresAt)
+	v.Check(input.WrappedKey == nil || len(*input.WrappedKey) > 0, "wrapped_key", "must not be empty")
+	checkKeyFingerprint(v, input.WrappedKey, input.KeyFingerprint)
 	if err := v.Valid("secrets.shareToUser"); err != nil {
 		app.rest.Error(w, err)
 		return
@@ -77,13 +84,20 @@ func (app *Secret) shareToUser(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		return
 	}
+	if !app.requireRekeyed(w, input.SecretID, "secrets.shareToUser") {
+		return
+	}
 	user, err2 := app.users.GetByEmail(input.UserEmail)
 	if err2 != nil {
 		app.rest.Error(w, err2)
 	}
 
-	// Call the method to share the secret with the user
-	if err := app.secrets.ShareToUser(input.SecretID, user.ID, input.Permission); err != nil {
+	// Call the method to share the secret and its content key with the user
+	var wrappedKey *secrets.WrappedKey
+	if input.WrappedKey != nil {
+		wrappedKey = &secrets.WrappedKey{UserID: user.ID, WrappedKey: *input.WrappedKey, Fingerprint: input.KeyFingerprint}
+	}
+	if err := app.secrets.ShareToUser(input.SecretID, user.ID, input.Permission, input.ExpiresAt, wrappedKey); err != nil {
 		app.rest.Error(w, err)
 		return
 	}
@@ -106,9 +120,12 @@ func (app *Secret) shareToGroup(w http.ResponseWriter, r *http.Request) {
 
 	// Define input structure
 	var input struct {
-		SecretID   int64              `json:"secret_id"`
-		GroupName  string             `json:"group_name"`
-		Permission secrets.Permission `json:"permission"`
+		SecretID        int64              `json:"secret_id"`
+		GroupName       string             `json:"group_name"`
+		Permission      secrets.Permission `json:"permission"`
+		ExpiresAt       *time.Time         `json:"expires_at"`
+		WrappedKeys     map[string]string  `json:"wrapped_keys"`
+		KeyFingerprints map[string]string  `json:"key_fingerprints"`
 	}
 
 	// Parse the request
@@ -123,6 +140,7 @@ func (app *Secret) shareToGroup(w http.ResponseWriter, r *http.Request) {
 	v.Check(len(input.GroupName) > 0, "group_name", "must be provided")
 	v.Check(input.Permission == "read-only" || input.Permission == "read-write",
 		"permission", "must be 'read-only' or 'read-write'")
+	checkExpiry(v, input.ExpiresAt)
 	if err := v.Valid("secrets.shareToGroup"); err != nil {
 		app.rest.Error(w, err)
 		return
@@ -135,13 +153,22 @@ func (app *Secret) shareToGroup(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
+	if !app.requireRekeyed(w, input.SecretID, "secrets.shareToGroup") {
+		return
+	}
 	group, err2 := app.group.GetGroupUsers(input.GroupName)
 	if err2 != nil {
 		app.rest.Error(w, err2)
+		return
+	}
+	keys, err2 := groupWrappedKeys(group.ID, group.Users, input.WrappedKeys, input.KeyFingerprints, "secrets.shareToGroup")
+	if err2 != nil {
+		app.rest.Error(w, err2)
+		return
 	}
 
-	// Call the method to share the secret with the group
-	if err := app.secrets.ShareToGroup(input.SecretID, group.ID, input.Permission); err != nil {
+	// Call the method to share the secret and its content key with the group
+	if err := app.secrets.ShareToGroup(input.SecretID, group.ID, input.Permission, input.ExpiresAt, keys); err != nil {
 		app.rest.Error(w, err)
 		return
 	}
@@ -164,9 +191,11 @@ func (app *Secret) updateGroupPermission(w http.ResponseWriter, r *http.Request)
 
 	// Define input structure
 	var input struct {
-		SecretID   int64              `json:"secret_id"`
-		GroupName  string             `json:"group_name"`
-		Permission secrets.Permission `json:"permission"`
+		SecretID    int64              `json:"secret_id"`
+		GroupName   string             `json:"group_name"`
+		Permission  secrets.Permission `json:"permission"`
+		ExpiresAt   *time.Time         `json:"expires_at"`
+		ClearExpiry bool               `json:"clear_expiry"`
 	}
 
 	// Parse the request
@@ -180,6 +209,8 @@ func (app *Secret) updateGroupPermission(w http.ResponseWriter, r *http.Request)
 	v.Check(input.SecretID > 0, "secret_id", "must be provided")
 	v.Check(len(input.GroupName) > 0, "group_name", "must be provided")
 	v.Check(input.Permission == "read-only" || input.Permission == "read-write", "permission", "must be 'read-only' or 'read-write'")
+	checkExpiry(v, input.ExpiresAt)
+	v.Check(!input.ClearExpiry || input.ExpiresAt == nil, "clear_expiry", "must not be set along with expires_at")
 	if err := v.Valid("secrets.updateGroupPermission"); err != nil {
 		app.rest.Error(w, err)
 		return
@@ -195,7 +226,7 @@ func (app *Secret) updateGroupPermission(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Call the method to update the permission
-	if err := app.secrets.UpdateGroupPermission(input.SecretID, group.ID, input.Permission); err != nil {
+	if err := app.secrets.UpdateGroupPermission(input.SecretID, group.ID, input.Permission, input.ExpiresAt, input.ClearExpiry); err != nil {
 		app.rest.Error(w, err)
 		return
 	}
@@ -212,9 +243,11 @@ func (app *Secret) updateUserPermission(w http.ResponseWriter, r *http.Request)
 
 	// Define input structure
 	var input struct {
-		SecretID   int64              `json:"secret_id"`
-		UserEmail  string             `json:"user_email"`
-		Permission secrets.Permission `json:"permission"`
+		SecretID    int64              `json:"secret_id"`
+		UserEmail   string             `json:"user_email"`
+		Permission  secrets.Permission `json:"permission"`
+		ExpiresAt   *time.Time         `json:"expires_at"`
+		ClearExpiry bool               `json:"clear_expiry"`
 	}
 
 	// Parse the request
@@ -229,6 +262,8 @@ func (app *Secret) updateUserPermission(w http.ResponseWriter, r *http.Request)
 	v.Check(len(input.UserEmail) > 0, "user_email", "must be provided")
 	v.Check(input.Permission == "read-only" || input.Permission == "read-write",
 		"permission", "must be 'read-only' or 'read-write'")
+	checkExpiry(v, input.ExpiresAt)
+	v.Check(!input.ClearExpiry || input.ExpiresAt == nil, "clear_expiry", "must not be set along with expires_at")
 	if err := v.Valid("secrets.updateUserPermission"); err != nil {
 		app.rest.Error(w, err)
 		return
@@ -244,7 +279,7 @@ func (app *Secret) updateUserPermission(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Call the method to update the permission
-	if err := app.secrets.UpdateUserPermission(input.SecretID, user.ID, input.Permission); err != nil {
+	if err := app.secrets.UpdateUserPermission(input.SecretID, user.ID, input.Permission, input.ExpiresAt, input.ClearExpiry); err != nil {
 		app.rest.Error(w, err)
 		return
 	}
@@ -304,7 +339,8 @@ func (app *Secret) revokeGroupPermission(w http.ResponseWriter, r *http.Request)
 
 	// Respond with success
 	app.rest.WriteJSON(w, "secret.revokeGroupPermission", http.StatusOK, rest.Envelope{
-		"message": "Permission revoked successfully for the group.",
+		"message":        "Permission revoked successfully for the group.",
+		"rekey_required": true,
 	})
 }
 
@@ -355,7 +391,8 @@ func (app *Secret) revokeUserPermission(w http.ResponseWriter, r *http.Request)
 
 	// Respond with success
 	app.rest.WriteJSON(w, "secret.revokeUserPermission", http.StatusOK, rest.Envelope{
-		"message": "Permission revoked successfully for the user.",
+		"message":        "Permission revoked successfully for the user.",
+		"rekey_required": true,
 	})
 }
 
@@ -375,3 +412,14 @@ func (app *Secret) validateSecretOwnership(w http.ResponseWriter, r *http.Reques
 	}
 	return nil
 }
+
+// Checks the optional expiry of a share
+func checkExpiry(v *validator.Validator, expiresAt *time.Time) {
+	v.Check(expiresAt == nil || expiresAt.After(time.Now()), "expires_at", "must be in the future")
+}
+
+// Checks that a wrapped key comes with the fingerprint of the public key it
+// was wrapped with
+func checkKeyFingerprint(v *validator.Validator, wrappedKey, fingerprint *string) {
+	v.Check(wrappedKey == nil || (fingerprint != nil && len(*fingerprint) > 0), "key_fingerprint", "must be provided along with wrapped_key")
+}
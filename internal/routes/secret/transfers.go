@@ -0,0 +1,198 @@
+package secret
+
+import (
+	"net/http"
+
+	"pm4devs.strawhats/internal/rest"
+	"pm4devs.strawhats/internal/routes/middleware"
+	"pm4devs.strawhats/internal/validator"
+)
+
+const SecretTransfersRoute = "/v1/secrets/transfers"
+
+func (app *Secret) handleTransfers(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		app.listTransfers(w, r)
+	case http.MethodPost:
+		app.proposeTransfer(w, r)
+	case http.MethodPut:
+		app.acceptTransfer(w, r)
+	case http.MethodDelete:
+		app.cancelTransfer(w, r)
+	default:
+		app.rest.MethodNotAllowed(w, r, "GET, POST, PUT, DELETE")
+	}
+}
+
+// Lists the pending transfers proposed by or to the user
+func (app *Secret) listTransfers(w http.ResponseWriter, r *http.Request) {
+	user := middleware.ContextGetUser(r)
+	transfers, err := app.secrets.GetTransfers(user.ID)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	app.rest.WriteJSON(w, "secrets.listTransfers", http.StatusOK, rest.Envelope{
+		"message": "Success!",
+		"data":    transfers,
+	})
+}
+
+// Proposes to transfer a secret of the user to another user
+func (app *Secret) proposeTransfer(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		SecretID  int64  `json:"secret_id"`
+		UserEmail string `json:"user_email"`
+	}
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, "secrets.proposeTransfer", &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	// Validate parameters
+	user := middleware.ContextGetUser(r)
+	v := validator.New()
+	v.Check(input.SecretID > 0, "secret_id", "must be provided")
+	v.Check(len(input.UserEmail) > 0, "user_email", "must be provided")
+	v.Check(input.UserEmail != user.Email, "user_email", "must be another user")
+	if err := v.Valid("secrets.proposeTransfer"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	if err := app.validateSecretOwnership(w, r, input.SecretID); err != nil {
+		return
+	}
+	recipient, err := app.users.GetByEmail(input.UserEmail)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	if err := app.secrets.ProposeTransfer(input.SecretID, user.ID, recipient.ID); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	app.rest.WriteJSON(w, "secrets.proposeTransfer", http.StatusCreated, rest.Envelope{
+		"message": "Transfer proposed, waiting for the recipient to accept it.",
+	})
+}
+
+// Accepts a transfer proposed to the user
+func (app *Secret) acceptTransfer(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		SecretID int64 `json:"secret_id"`
+	}
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, "secrets.acceptTransfer", &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	// Validate parameters
+	v := validator.New()
+	v.Check(input.SecretID > 0, "secret_id", "must be provided")
+	if err := v.Valid("secrets.acceptTransfer"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	user := middleware.ContextGetUser(r)
+	if err := app.secrets.AcceptTransfer(input.SecretID, user.ID); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	app.rest.WriteJSON(w, "secrets.acceptTransfer", http.StatusOK, rest.Envelope{
+		"message": "Success! You now own the secret.",
+	})
+}
+
+// Cancels a transfer proposed by the user, or declines one proposed to them
+func (app *Secret) cancelTransfer(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		SecretID int64 `json:"secret_id"`
+	}
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, "secrets.cancelTransfer", &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	// Validate parameters
+	v := validator.New()
+	v.Check(input.SecretID > 0, "secret_id", "must be provided")
+	if err := v.Valid("secrets.cancelTransfer"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	user := middleware.ContextGetUser(r)
+	if err := app.secrets.CancelTransfer(input.SecretID, user.ID); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	app.rest.WriteJSON(w, "secrets.cancelTransfer", http.StatusOK, rest.Envelope{
+		"message": "Success!",
+	})
+}
+
+const SecretForceTransferRoute = "/v1/secrets/transfers/force"
+
+// Transfers a secret, or every secret of a user, without the consent of the
+// owner. Used by admins during offboarding.
+func (app *Secret) forceTransfer(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.rest.MethodNotAllowed(w, r, "POST")
+		return
+	}
+	var input struct {
+		SecretID  int64  `json:"secret_id"`
+		FromEmail string `json:"from_email"`
+		UserEmail string `json:"user_email"`
+	}
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, "secrets.forceTransfer", &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	// Validate parameters
+	v := validator.New()
+	v.Check((input.SecretID > 0) != (len(input.FromEmail) > 0), "secret_id", "either secret_id or from_email must be provided")
+	v.Check(len(input.UserEmail) > 0, "user_email", "must be provided")
+	v.Check(input.FromEmail != input.UserEmail, "user_email", "must differ from from_email")
+	if err := v.Valid("secrets.forceTransfer"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	recipient, err := app.users.GetByEmail(input.UserEmail)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	if input.SecretID > 0 {
+		if err := app.secrets.ForceTransfer(input.SecretID, recipient.ID); err != nil {
+			app.rest.Error(w, err)
+			return
+		}
+		app.rest.WriteJSON(w, "secrets.forceTransfer", http.StatusOK, rest.Envelope{
+			"message":     "Success!",
+			"transferred": 1,
+		})
+		return
+	}
+
+	owner, err := app.users.GetByEmail(input.FromEmail)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	transferred, err := app.secrets.ForceTransferAll(owner.ID, recipient.ID)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	app.rest.WriteJSON(w, "secrets.forceTransfer", http.StatusOK, rest.Envelope{
+		"message":     "Success!",
+		"transferred": transferred,
+	})
+}
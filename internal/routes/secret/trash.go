@@ -0,0 +1,95 @@
+package secret
+
+import (
+	"net/http"
+
+	"pm4devs.strawhats/internal/models/core"
+	"pm4devs.strawhats/internal/rest"
+	"pm4devs.strawhats/internal/routes/middleware"
+	"pm4devs.strawhats/internal/validator"
+)
+
+const SecretTrashRoute = "/v1/secrets/trash"
+
+func (app *Secret) handleTrash(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		app.listTrash(w, r)
+	case http.MethodPost:
+		app.restoreFromTrash(w, r)
+	case http.MethodDelete:
+		app.purgeFromTrash(w, r)
+	default:
+		app.rest.MethodNotAllowed(w, r, "GET, POST, DELETE")
+	}
+}
+
+// Lists the user's deleted secrets
+func (app *Secret) listTrash(w http.ResponseWriter, r *http.Request) {
+	page, err := core.ParsePage(r.URL.Query(), "secrets.listTrash")
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	user := middleware.ContextGetUser(r)
+	deleted, next, err := app.secrets.GetDeletedByUserID(user.ID, page)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	app.rest.WritePage(w, "secrets.listTrash", deleted, page.Fields, next)
+}
+
+// Restores a deleted secret together with its shares
+func (app *Secret) restoreFromTrash(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		SecretID int64 `json:"secret_id"`
+	}
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, "secrets.restoreFromTrash", &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	// Validate parameters
+	v := validator.New()
+	v.Check(input.SecretID > 0, "secret_id", "must be provided")
+	if err := v.Valid("secrets.restoreFromTrash"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	user := middleware.ContextGetUser(r)
+	if err := app.secrets.Restore(input.SecretID, user.ID); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	app.rest.WriteJSON(w, "secrets.restoreFromTrash", http.StatusOK, rest.Envelope{
+		"message": "Success!",
+	})
+}
+
+// Permanently deletes a secret from the trash
+func (app *Secret) purgeFromTrash(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		SecretID int64 `json:"secret_id"`
+	}
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, "secrets.purgeFromTrash", &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	// Validate parameters
+	v := validator.New()
+	v.Check(input.SecretID > 0, "secret_id", "must be provided")
+	if err := v.Valid("secrets.purgeFromTrash"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	user := middleware.ContextGetUser(r)
+	if err := app.secrets.Purge(input.SecretID, user.ID); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,133 @@
+package secret
+
+import (
+	"net/http"
+
+	"pm4devs.strawhats/internal/models/secrets"
+	"pm4devs.strawhats/internal/rest"
+	"pm4devs.strawhats/internal/routes/middleware"
+	"pm4devs.strawhats/internal/validator"
+)
+
+const SecretVersionsRoute = "/v1/secrets/versions"
+
+// Lists the previous versions of a secret, or a single version if one is given
+func (app *Secret) getSecretVersions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		app.rest.MethodNotAllowed(w, r, "GET")
+		return
+	}
+
+	var input struct {
+		SecretID int64 `json:"secret_id"`
+		Version  int   `json:"version"`
+	}
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, "secrets.getSecretVersions", &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	// Validate parameters
+	v := validator.New()
+	v.Check(input.SecretID > 0, "secret_id", "must be provided")
+	v.Check(input.Version >= 0, "version", "must be a positive integer")
+	if err := v.Valid("secrets.getSecretVersions"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	if err := middleware.CheckSecret(r, input.SecretID, "secrets.getSecretVersions"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	user := middleware.ContextGetUser(r)
+	permission, err := app.secrets.GetUserSecretPermission(user.ID, input.SecretID)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	if permission == secrets.NOTALLOWED {
+		app.rest.WriteJSON(w, "secrets.getSecretVersions", http.StatusUnauthorized, rest.Envelope{
+			"message": "Your not allowed",
+		})
+		return
+	}
+
+	// A specific version was requested
+	if input.Version > 0 {
+		version, err := app.secrets.GetVersion(input.SecretID, input.Version)
+		if err != nil {
+			app.rest.Error(w, err)
+			return
+		}
+		app.rest.WriteJSON(w, "secrets.getSecretVersions", http.StatusOK, rest.Envelope{
+			"message": "Success!",
+			"data":    version,
+		})
+		return
+	}
+
+	versions, err := app.secrets.GetVersions(input.SecretID)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	app.rest.WriteJSON(w, "secrets.getSecretVersions", http.StatusOK, rest.Envelope{
+		"message": "Success!",
+		"data":    versions,
+	})
+}
+
+const SecretRollbackRoute = "/v1/secrets/rollback"
+
+// Restores a secret to one of its previous versions
+func (app *Secret) rollbackSecret(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.rest.MethodNotAllowed(w, r, "POST")
+		return
+	}
+
+	var input struct {
+		SecretID int64 `json:"secret_id"`
+		Version  int   `json:"version"`
+	}
+	// Parse request
+	if err := app.rest.ReadJSON(w, r, "secrets.rollbackSecret", &input); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	// Validate parameters
+	v := validator.New()
+	v.Check(input.SecretID > 0, "secret_id", "must be provided")
+	v.Check(input.Version > 0, "version", "must be provided")
+	if err := v.Valid("secrets.rollbackSecret"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	if err := middleware.CheckSecret(r, input.SecretID, "secrets.rollbackSecret"); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	user := middleware.ContextGetUser(r)
+	permission, err := app.secrets.GetUserSecretPermission(user.ID, input.SecretID)
+	if err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+	if permission != secrets.ReadWrite {
+		app.rest.WriteJSON(w, "secrets.rollbackSecret", http.StatusUnauthorized, rest.Envelope{
+			"message": "Only users with write access can roll back a secret",
+		})
+		return
+	}
+
+	if err := app.secrets.Rollback(input.SecretID, input.Version); err != nil {
+		app.rest.Error(w, err)
+		return
+	}
+
+	app.rest.WriteJSON(w, "secrets.rollbackSecret", http.StatusOK, rest.Envelope{
+		"message": "Success!",
+	})
+}
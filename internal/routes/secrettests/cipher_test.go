@@ -0,0 +1,89 @@
+package secret
+
+import (
+	"net/http"
+	"testing"
+
+	"pm4devs.strawhats/internal/assert"
+	"pm4devs.strawhats/internal/mocks"
+	"pm4devs.strawhats/internal/models/secrets"
+	"pm4devs.strawhats/internal/routes/secret"
+	"pm4devs.strawhats/internal/routes/utils"
+)
+
+func TestSecretCipher(t *testing.T) {
+	assert.Integration(t)
+	app := mocks.App(t)
+	handler := secretsHandler(app)
+	authHandler := utils.AuthHandler(app)
+
+	credentials := `{"email": "test@example.com", "password": "password"}`
+	assert.Check(t, utils.RegisterUser(authHandler, credentials))
+	token := utils.LoginUser(authHandler, credentials)
+	assert.Check(t, len(token) > 0)
+
+	type responseMessage struct {
+		Error map[string]string `json:"error"`
+	}
+
+	tests := []assert.HandlerTestCase[responseMessage]{
+		{
+			Name:   "InvalidCipher",
+			Body:   `{"name": "a", "encrypted_data": "data", "iv": "iv", "cipher": "rot13"}`,
+			Auth:   token,
+			Status: http.StatusUnprocessableEntity,
+			FN: func(t *testing.T, result responseMessage) {
+				assert.Equal(t, result.Error["cipher"], "must be one of aes-256-gcm or xchacha20-poly1305")
+			},
+		},
+		{
+			Name:   "InvalidVersion",
+			Body:   `{"name": "a", "encrypted_data": "data", "iv": "iv", "cipher_version": 0}`,
+			Auth:   token,
+			Status: http.StatusUnprocessableEntity,
+			FN: func(t *testing.T, result responseMessage) {
+				assert.Equal(t, result.Error["cipher_version"], "must be greater than zero")
+			},
+		},
+		{
+			Name:   "Default",
+			Body:   `{"name": "a", "encrypted_data": "data", "iv": "iv"}`,
+			Auth:   token,
+			Status: http.StatusCreated,
+		},
+		{
+			Name:   "Explicit",
+			Body:   `{"name": "b", "encrypted_data": "data", "iv": "nonce", "cipher": "xchacha20-poly1305", "cipher_version": 2}`,
+			Auth:   token,
+			Status: http.StatusCreated,
+		},
+	}
+
+	for _, tc := range tests {
+		assert.RunHandlerTestCase(t, handler, http.MethodPost, secret.SecretCRUDRoute, tc)
+	}
+
+	first, err := app.Models.Secrets.GetSecretByID(1)
+	assert.Check(t, err == nil)
+	assert.Equal(t, first.Cipher, secrets.CipherAES256GCM)
+	assert.Equal(t, first.CipherVersion, 1)
+
+	second, err := app.Models.Secrets.GetSecretByID(2)
+	assert.Check(t, err == nil)
+	assert.Equal(t, second.Cipher, secrets.CipherXChaCha20Poly1305)
+	assert.Equal(t, second.CipherVersion, 2)
+
+	// Moving to a new cipher keeps the previous one on the version it replaced
+	update := `{"secret_id": 1, "name": "a", "encrypted_data": "new-data", "iv": "nonce", "cipher": "xchacha20-poly1305"}`
+	res := sendAuthRequest(handler, http.MethodPatch, secret.SecretCRUDRoute, update, token)
+	assert.Equal(t, res, http.StatusOK)
+
+	first, err = app.Models.Secrets.GetSecretByID(1)
+	assert.Check(t, err == nil)
+	assert.Equal(t, first.Cipher, secrets.CipherXChaCha20Poly1305)
+	assert.Equal(t, first.CipherVersion, 1)
+
+	previous, err := app.Models.Secrets.GetVersion(1, 1)
+	assert.Check(t, err == nil)
+	assert.Equal(t, previous.Cipher, secrets.CipherAES256GCM)
+}
@@ -0,0 +1,89 @@
+package secret
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"pm4devs.strawhats/internal/assert"
+	"pm4devs.strawhats/internal/mocks"
+	"pm4devs.strawhats/internal/routes/secret"
+	"pm4devs.strawhats/internal/routes/utils"
+	"pm4devs.strawhats/internal/xerrors"
+)
+
+func TestSecretETags(t *testing.T) {
+	assert.Integration(t)
+	app := mocks.App(t)
+	handler := secretsHandler(app)
+	authHandler := utils.AuthHandler(app)
+
+	credentials := `{"email": "test@example.com", "password": "password"}`
+	assert.Check(t, utils.RegisterUser(authHandler, credentials))
+	token := utils.LoginUser(authHandler, credentials)
+	assert.Check(t, len(token) > 0)
+
+	createData := `{"name": "secret", "encrypted_data": "data", "iv": "iv"}`
+	res := sendAuthRequest(handler, http.MethodPost, secret.SecretCRUDRoute, createData, token)
+	assert.Equal(t, res, http.StatusCreated)
+
+	getData := `{"secret_id": 1}`
+	updateData := `{"secret_id": 1, "name": "secret", "encrypted_data": "new", "iv": "iv"}`
+
+	// GET returns the ETag of the current version
+	status, etag := sendConditionalRequest(handler, http.MethodGet, getData, token, "", "")
+	assert.Equal(t, status, http.StatusOK)
+	assert.Equal(t, etag, `"1-0"`)
+
+	status, _ = sendConditionalRequest(handler, http.MethodGet, getData, token, "If-None-Match", etag)
+	assert.Equal(t, status, http.StatusNotModified)
+
+	// A matching If-Match updates the secret and returns the new ETag
+	status, newETag := sendConditionalRequest(handler, http.MethodPatch, updateData, token, "If-Match", etag)
+	assert.Equal(t, status, http.StatusOK)
+	assert.Equal(t, newETag, `"1-1"`)
+
+	status, _ = sendConditionalRequest(handler, http.MethodGet, getData, token, "If-None-Match", etag)
+	assert.Equal(t, status, http.StatusOK)
+
+	// A stale If-Match is rejected for both updates and deletes
+	status, _ = sendConditionalRequest(handler, http.MethodPatch, updateData, token, "If-Match", etag)
+	assert.Equal(t, status, http.StatusPreconditionFailed)
+
+	status, _ = sendConditionalRequest(handler, http.MethodDelete, getData, token, "If-Match", etag)
+	assert.Equal(t, status, http.StatusPreconditionFailed)
+
+	current, err := app.Models.Secrets.GetSecretByID(1)
+	assert.Check(t, err == nil)
+	assert.Equal(t, string(current.EncryptedData), "new")
+	assert.Equal(t, current.Version, 1)
+
+	// Requests without If-Match are not checked
+	status, _ = sendConditionalRequest(handler, http.MethodPatch, updateData, token, "", "")
+	assert.Equal(t, status, http.StatusOK)
+
+	// Deletes racing an update find a newer version than they checked
+	appErr := app.Models.Secrets.Delete(1, 1)
+	assert.Check(t, appErr != nil && appErr.Matches(xerrors.ErrEditConflict))
+
+	status, _ = sendConditionalRequest(handler, http.MethodDelete, getData, token, "If-Match", `"1-2"`)
+	assert.Equal(t, status, http.StatusNoContent)
+}
+
+// Sends a request to the secret CRUD route with an optional conditional
+// header, returning the status and ETag of the response
+func sendConditionalRequest(handler http.HandlerFunc, method, body, authToken, header, value string) (int, string) {
+	req := httptest.NewRequest(method, secret.SecretCRUDRoute, bytes.NewBufferString(body))
+	req.Header.Set("Authorization", "Bearer "+authToken)
+	if header != "" {
+		req.Header.Set(header, value)
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	resp := rr.Result()
+	defer resp.Body.Close()
+
+	return resp.StatusCode, resp.Header.Get("ETag")
+}
@@ -0,0 +1,126 @@
+package secret
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"pm4devs.strawhats/internal/assert"
+	"pm4devs.strawhats/internal/jobs"
+	"pm4devs.strawhats/internal/mocks"
+	"pm4devs.strawhats/internal/models/secrets"
+	"pm4devs.strawhats/internal/routes/secret"
+	"pm4devs.strawhats/internal/routes/utils"
+)
+
+func TestShareExpiry(t *testing.T) {
+	assert.Integration(t)
+	app := mocks.App(t)
+	handler := secretsHandler(app)
+	authHandler := utils.AuthHandler(app)
+
+	// Register and login users
+	credentials := `{"email": "test@example.com", "password": "password"}`
+	assert.Check(t, utils.RegisterUser(authHandler, credentials))
+	token := utils.LoginUser(authHandler, credentials)
+	assert.Check(t, len(token) > 0)
+
+	credentialsTwo := `{"email": "test2@example.com", "password": "password"}`
+	assert.Check(t, utils.RegisterUser(authHandler, credentialsTwo))
+	tokenTwo := utils.LoginUser(authHandler, credentialsTwo)
+	assert.Check(t, len(tokenTwo) > 0)
+
+	secretData := `{"encrypted_data": "test@example.com", "name": "testname", "iv": "testing"}`
+	res := sendAuthRequest(handler, http.MethodPost, secret.SecretCRUDRoute, secretData, token)
+	assert.Equal(t, res, http.StatusCreated)
+
+	type responseMessage struct {
+		Error   map[string]string `json:"error"`
+		Message string            `json:"message"`
+		Data    []map[string]any  `json:"data"`
+	}
+
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	tests := []assert.HandlerTestCase[responseMessage]{
+		{
+			Name:   "ExpiryInPast",
+			Body:   `{"secret_id": 1, "user_email": "test2@example.com", "permission": "read-only", "expires_at": "2000-01-01T00:00:00Z"}`,
+			Method: http.MethodPost,
+			Status: http.StatusBadRequest,
+			Auth:   token,
+			FN: func(t *testing.T, result responseMessage) {
+				assert.Equal(t, result.Error["expires_at"], "must be in the future")
+			},
+		},
+		{
+			Name:   "Success",
+			Body:   `{"secret_id": 1, "user_email": "test2@example.com", "permission": "read-only", "expires_at": "` + future + `"}`,
+			Method: http.MethodPost,
+			Status: http.StatusCreated,
+			Auth:   token,
+		},
+		{
+			Name:   "ClearExpiryWithExpiry",
+			Body:   `{"secret_id": 1, "user_email": "test2@example.com", "permission": "read-only", "expires_at": "` + future + `", "clear_expiry": true}`,
+			Method: http.MethodPatch,
+			Status: http.StatusBadRequest,
+			Auth:   token,
+			FN: func(t *testing.T, result responseMessage) {
+				assert.Equal(t, result.Error["clear_expiry"], "must not be set along with expires_at")
+			},
+		},
+		{
+			Name:   "PermissionOnly",
+			Body:   `{"secret_id": 1, "user_email": "test2@example.com", "permission": "read-write"}`,
+			Method: http.MethodPatch,
+			Status: http.StatusOK,
+			Auth:   token,
+		},
+	}
+
+	for _, tc := range tests {
+		assert.RunHandlerTestCase(t, handler, tc.Method, secret.SecretShareUserRoute, tc)
+	}
+
+	// The recipient can read the secret until the share expires
+	res = sendAuthRequest(handler, http.MethodGet, secret.SecretCRUDRoute, `{"secret_id": 1}`, tokenTwo)
+	assert.Equal(t, res, http.StatusOK)
+
+	assert.RunHandlerTestCase(t, handler, http.MethodGet, secret.GetSecretsSharedByUser, assert.HandlerTestCase[responseMessage]{
+		Name:   "ListedWithExpiry",
+		Auth:   token,
+		Status: http.StatusOK,
+		FN: func(t *testing.T, result responseMessage) {
+			assert.Equal(t, len(result.Data), 1)
+			assert.Equal(t, result.Data[0]["permission"], "read-write")
+			assert.Check(t, result.Data[0]["expires_at"] != nil)
+		},
+	})
+
+	// Moves the expiry into the past, skipping the validation of the route
+	user, err := app.Models.Users.GetByEmail("test2@example.com")
+	assert.Check(t, err == nil)
+	past := time.Now().Add(-time.Minute)
+	assert.Check(t, app.Models.Secrets.UpdateUserPermission(1, user.ID, secrets.ReadOnly, &past, false) == nil)
+
+	res = sendAuthRequest(handler, http.MethodGet, secret.SecretCRUDRoute, `{"secret_id": 1}`, tokenTwo)
+	assert.Equal(t, res, http.StatusUnauthorized)
+
+	assert.RunHandlerTestCase(t, handler, http.MethodGet, secret.GetSecretsSharedByUser, assert.HandlerTestCase[responseMessage]{
+		Name:   "NotListedOnceExpired",
+		Auth:   token,
+		Status: http.StatusOK,
+		FN: func(t *testing.T, result responseMessage) {
+			assert.Equal(t, len(result.Data), 0)
+		},
+	})
+
+	// The sweeper removes the share and tells the owner
+	jobs.New(app).SweepExpiredShares()
+	mailer := mocks.Mailer(app)
+	assert.Equal(t, mailer.ShareExpiredCount, 1)
+	assert.Equal(t, mailer.ShareExpiredRecipients[0], "test@example.com")
+
+	jobs.New(app).SweepExpiredShares()
+	assert.Equal(t, mailer.ShareExpiredCount, 1)
+}
@@ -54,8 +54,10 @@ func TestGetUsrSecrets(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	_, err = app.Models.Secrets.NewRecord(gofakeit.Name(),
-		gofakeit.Sentence(5), gofakeit.MonthString(), user.ID)
+	err = app.Models.Secrets.NewRecord(&secrets.SecretRecord{
+		Name: gofakeit.Name(), EncryptedData: []byte(gofakeit.Sentence(5)), IV: []byte(gofakeit.MonthString()),
+		Cipher: secrets.DefaultCipher, CipherVersion: secrets.DefaultCipherVersion, OwnerID: user.ID, Kind: secrets.KindNote,
+	})
 	if err != nil {
 		t.Error(err)
     return
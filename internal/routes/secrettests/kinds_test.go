@@ -0,0 +1,108 @@
+package secret
+
+import (
+	"net/http"
+	"testing"
+
+	"pm4devs.strawhats/internal/assert"
+	"pm4devs.strawhats/internal/mocks"
+	"pm4devs.strawhats/internal/models/secrets"
+	"pm4devs.strawhats/internal/routes/secret"
+	"pm4devs.strawhats/internal/routes/utils"
+)
+
+func TestSecretKinds(t *testing.T) {
+	assert.Integration(t)
+	app := mocks.App(t)
+	handler := secretsHandler(app)
+	authHandler := utils.AuthHandler(app)
+
+	credentials := `{"email": "test@example.com", "password": "password"}`
+	assert.Check(t, utils.RegisterUser(authHandler, credentials))
+	token := utils.LoginUser(authHandler, credentials)
+	assert.Check(t, len(token) > 0)
+
+	type responseMessage struct {
+		Error   map[string]string `json:"error"`
+		Message string            `json:"message"`
+	}
+
+	tests := []assert.HandlerTestCase[responseMessage]{
+		{
+			Name:   "UnknownKind",
+			Auth:   token,
+			Body:   `{"name": "x", "encrypted_data": "data", "iv": "iv", "kind": "password"}`,
+			Status: http.StatusUnprocessableEntity,
+			FN: func(t *testing.T, result responseMessage) {
+				assert.Equal(t, result.Error["kind"], "must be one of login, api_key, ssh_key, database, tls_certificate, note or env_file")
+			},
+		},
+		{
+			Name:   "InvalidMetadata",
+			Auth:   token,
+			Body:   `{"name": "x", "encrypted_data": "data", "iv": "iv", "kind": "login", "metadata": {"url": "example.com"}}`,
+			Status: http.StatusUnprocessableEntity,
+			FN: func(t *testing.T, result responseMessage) {
+				assert.Equal(t, result.Error["metadata.url"], "must be an absolute http or https URL")
+			},
+		},
+		{
+			Name:   "MissingRequiredMetadata",
+			Auth:   token,
+			Body:   `{"name": "x", "encrypted_data": "data", "iv": "iv", "kind": "tls_certificate", "metadata": {"domain": "example.com"}}`,
+			Status: http.StatusUnprocessableEntity,
+			FN: func(t *testing.T, result responseMessage) {
+				assert.Equal(t, result.Error["metadata.expires"], "must be provided")
+			},
+		},
+		{
+			Name:   "Login/Success",
+			Auth:   token,
+			Body:   `{"name": "GitHub", "encrypted_data": "data", "iv": "iv", "kind": "login", "metadata": {"url": "https://github.com", "username": "octocat"}}`,
+			Status: http.StatusCreated,
+		},
+		{
+			Name:   "DefaultsToNote",
+			Auth:   token,
+			Body:   `{"name": "Note", "encrypted_data": "data", "iv": "iv"}`,
+			Status: http.StatusCreated,
+		},
+	}
+
+	for _, tc := range tests {
+		assert.RunHandlerTestCase(t, handler, http.MethodPost, secret.SecretCRUDRoute, tc)
+	}
+
+	created, err := app.Models.Secrets.GetSecretByID(1)
+	assert.Check(t, err == nil)
+	assert.Equal(t, created.Kind, secrets.KindLogin)
+
+	created, err = app.Models.Secrets.GetSecretByID(2)
+	assert.Check(t, err == nil)
+	assert.Equal(t, created.Kind, secrets.KindNote)
+
+	// Changing the kind checks the existing metadata against the new schema
+	update := `{"secret_id": 2, "name": "Note", "encrypted_data": "data", "iv": "iv", "kind": "database"}`
+	res := sendAuthRequest(handler, http.MethodPatch, secret.SecretCRUDRoute, update, token)
+	assert.Equal(t, res, http.StatusUnprocessableEntity)
+
+	update = `{"secret_id": 2, "name": "Note", "encrypted_data": "data", "iv": "iv", "kind": "database", "metadata": {"host": "db.internal:5432"}}`
+	res = sendAuthRequest(handler, http.MethodPatch, secret.SecretCRUDRoute, update, token)
+	assert.Equal(t, res, http.StatusOK)
+
+	// Listings can be filtered by kind
+	type listResponse struct {
+		Data []struct {
+			Kind secrets.Kind `json:"kind"`
+		} `json:"data"`
+	}
+	assert.RunHandlerTestCase(t, handler, http.MethodGet, secret.GetUserSecretsRoute+"?kind=database", assert.HandlerTestCase[listResponse]{
+		Name:   "FilterByKind",
+		Auth:   token,
+		Status: http.StatusOK,
+		FN: func(t *testing.T, result listResponse) {
+			assert.Equal(t, len(result.Data), 1)
+			assert.Equal(t, result.Data[0].Kind, secrets.KindDatabase)
+		},
+	})
+}
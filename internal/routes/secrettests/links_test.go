@@ -0,0 +1,147 @@
+package secret
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"pm4devs.strawhats/internal/assert"
+	"pm4devs.strawhats/internal/mocks"
+	"pm4devs.strawhats/internal/routes/secret"
+	"pm4devs.strawhats/internal/routes/utils"
+)
+
+func TestLinks(t *testing.T) {
+	assert.Integration(t)
+	app := mocks.App(t)
+	handler := secretsHandler(app)
+	authHandler := utils.AuthHandler(app)
+
+	// Register and login users
+	credentials := `{"email": "test@example.com", "password": "password"}`
+	assert.Check(t, utils.RegisterUser(authHandler, credentials))
+	token := utils.LoginUser(authHandler, credentials)
+	assert.Check(t, len(token) > 0)
+
+	credentialsTwo := `{"email": "test2@example.com", "password": "password"}`
+	assert.Check(t, utils.RegisterUser(authHandler, credentialsTwo))
+	tokenTwo := utils.LoginUser(authHandler, credentialsTwo)
+	assert.Check(t, len(tokenTwo) > 0)
+
+	type linkResponse struct {
+		Error   map[string]string `json:"error"`
+		Message string            `json:"message"`
+		Data    struct {
+			ID       int64  `json:"id"`
+			Token    string `json:"token"`
+			MaxViews int    `json:"max_views"`
+		} `json:"data"`
+	}
+
+	var linkToken string
+	tests := []assert.HandlerTestCase[linkResponse]{
+		{
+			Name:   "Unauthenticated",
+			Body:   `{"encrypted_data": "data", "iv": "iv"}`,
+			Status: http.StatusUnauthorized,
+		},
+		{
+			Name:   "MissingPayload",
+			Body:   `{}`,
+			Auth:   token,
+			Status: http.StatusBadRequest,
+			FN: func(t *testing.T, result linkResponse) {
+				assert.Equal(t, result.Error["encrypted_data"], "must be provided")
+				assert.Equal(t, result.Error["iv"], "must be provided")
+			},
+		},
+		{
+			Name:   "InvalidMaxViews",
+			Body:   `{"encrypted_data": "data", "iv": "iv", "max_views": 0}`,
+			Auth:   token,
+			Status: http.StatusBadRequest,
+			FN: func(t *testing.T, result linkResponse) {
+				assert.Equal(t, result.Error["max_views"], "must be between 1 and 100")
+			},
+		},
+		{
+			Name:   "ExpiryInPast",
+			Body:   `{"encrypted_data": "data", "iv": "iv", "expires_at": "2000-01-01T00:00:00Z"}`,
+			Auth:   token,
+			Status: http.StatusBadRequest,
+			FN: func(t *testing.T, result linkResponse) {
+				assert.Equal(t, result.Error["expires_at"], "must be in the future")
+			},
+		},
+		{
+			Name:   "Success",
+			Body:   `{"encrypted_data": "data", "iv": "iv", "max_views": 2}`,
+			Auth:   token,
+			Status: http.StatusCreated,
+			FN: func(t *testing.T, result linkResponse) {
+				assert.Equal(t, result.Data.MaxViews, 2)
+				assert.Check(t, len(result.Data.Token) > 0)
+				linkToken = result.Data.Token
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		assert.RunHandlerTestCase(t, handler, http.MethodPost, secret.SecretLinksRoute, tc)
+	}
+
+	type openResponse struct {
+		Data struct {
+			EncryptedData string `json:"encrypted_data"`
+			IV            string `json:"iv"`
+			ViewsLeft     int    `json:"views_left"`
+		} `json:"data"`
+	}
+
+	// Anyone holding the token can open the link until it burns
+	body := fmt.Sprintf(`{"token": %q}`, linkToken)
+	openTests := []assert.HandlerTestCase[openResponse]{
+		{
+			Name:   "UnknownToken",
+			Body:   `{"token": "unknown"}`,
+			Status: http.StatusNotFound,
+		},
+		{
+			Name:   "FirstView",
+			Body:   body,
+			Status: http.StatusOK,
+			FN: func(t *testing.T, result openResponse) {
+				assert.Equal(t, result.Data.EncryptedData, "data")
+				assert.Equal(t, result.Data.IV, "iv")
+				assert.Equal(t, result.Data.ViewsLeft, 1)
+			},
+		},
+		{
+			Name:   "LastView",
+			Body:   body,
+			Status: http.StatusOK,
+			FN: func(t *testing.T, result openResponse) {
+				assert.Equal(t, result.Data.ViewsLeft, 0)
+			},
+		},
+		{
+			Name:   "Burned",
+			Body:   body,
+			Status: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range openTests {
+		assert.RunHandlerTestCase(t, handler, http.MethodPost, secret.LinkRoute, tc)
+	}
+
+	// Only the creator can delete a link
+	res := sendAuthRequest(handler, http.MethodPost, secret.SecretLinksRoute, `{"encrypted_data": "data", "iv": "iv"}`, token)
+	assert.Equal(t, res, http.StatusCreated)
+
+	res = sendAuthRequest(handler, http.MethodDelete, secret.SecretLinksRoute, `{"link_id": 2}`, tokenTwo)
+	assert.Equal(t, res, http.StatusNotFound)
+
+	res = sendAuthRequest(handler, http.MethodDelete, secret.SecretLinksRoute, `{"link_id": 2}`, token)
+	assert.Equal(t, res, http.StatusOK)
+}
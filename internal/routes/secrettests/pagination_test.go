@@ -0,0 +1,129 @@
+package secret
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"pm4devs.strawhats/internal/assert"
+	"pm4devs.strawhats/internal/mocks"
+	"pm4devs.strawhats/internal/routes/secret"
+	"pm4devs.strawhats/internal/routes/utils"
+)
+
+func TestSecretPagination(t *testing.T) {
+	assert.Integration(t)
+	app := mocks.App(t)
+	handler := secretsHandler(app)
+	authHandler := utils.AuthHandler(app)
+
+	credentials := `{"email": "test@example.com", "password": "password"}`
+	assert.Check(t, utils.RegisterUser(authHandler, credentials))
+	token := utils.LoginUser(authHandler, credentials)
+	assert.Check(t, len(token) > 0)
+
+	// Seed – five secrets named in reverse of their creation order
+	for i := 5; i > 0; i-- {
+		body := fmt.Sprintf(`{"name": "secret-%d", "encrypted_data": "data", "iv": "iv"}`, i)
+		res := sendAuthRequest(handler, http.MethodPost, secret.SecretCRUDRoute, body, token)
+		assert.Equal(t, res, http.StatusCreated)
+	}
+
+	type responseMessage struct {
+		Error      map[string]string `json:"error"`
+		NextCursor *string           `json:"next_cursor"`
+		Data       []map[string]any  `json:"data"`
+	}
+
+	// Walks the listing two rows at a time
+	var names []string
+	route := secret.GetUserSecretsRoute + "?limit=2&sort=name"
+	for page := 1; page <= 3; page++ {
+		var next *string
+		assert.RunHandlerTestCase(t, handler, http.MethodGet, route, assert.HandlerTestCase[responseMessage]{
+			Name:   fmt.Sprintf("Page%d", page),
+			Auth:   token,
+			Status: http.StatusOK,
+			FN: func(t *testing.T, result responseMessage) {
+				for _, row := range result.Data {
+					names = append(names, row["name"].(string))
+				}
+				next = result.NextCursor
+			},
+		})
+		if page < 3 {
+			assert.Check(t, next != nil)
+			route = secret.GetUserSecretsRoute + "?limit=2&sort=name&cursor=" + *next
+		} else {
+			assert.Check(t, next == nil)
+		}
+	}
+	assert.Equal(t, fmt.Sprint(names), "[secret-1 secret-2 secret-3 secret-4 secret-5]")
+
+	tests := []assert.HandlerTestCase[responseMessage]{
+		{
+			Name:   "Descending",
+			Auth:   token,
+			Route:  secret.GetUserSecretsRoute + "?limit=1&sort=-name",
+			Status: http.StatusOK,
+			FN: func(t *testing.T, result responseMessage) {
+				assert.Equal(t, len(result.Data), 1)
+				assert.Equal(t, result.Data[0]["name"], "secret-5")
+				assert.Check(t, result.NextCursor != nil)
+			},
+		},
+		{
+			Name:   "Fields",
+			Auth:   token,
+			Route:  secret.GetUserSecretsRoute + "?fields=id,name",
+			Status: http.StatusOK,
+			FN: func(t *testing.T, result responseMessage) {
+				assert.Equal(t, len(result.Data), 5)
+				assert.Equal(t, len(result.Data[0]), 2)
+				_, ok := result.Data[0]["encrypted_data"]
+				assert.Check(t, !ok)
+			},
+		},
+		{
+			Name:   "Fields/EncryptedData",
+			Auth:   token,
+			Route:  secret.GetUserSecretsRoute + "?fields=id,encrypted_data",
+			Status: http.StatusOK,
+			FN: func(t *testing.T, result responseMessage) {
+				assert.Equal(t, len(result.Data[0]), 2)
+				assert.Equal(t, result.Data[0]["encrypted_data"], "data")
+			},
+		},
+		{
+			Name:   "InvalidLimit",
+			Auth:   token,
+			Route:  secret.GetUserSecretsRoute + "?limit=500",
+			Status: http.StatusUnprocessableEntity,
+			FN: func(t *testing.T, result responseMessage) {
+				assert.Equal(t, result.Error["limit"], "must be between 1 and 200")
+			},
+		},
+		{
+			Name:   "InvalidSort",
+			Auth:   token,
+			Route:  secret.GetUserSecretsRoute + "?sort=encrypted_data",
+			Status: http.StatusUnprocessableEntity,
+			FN: func(t *testing.T, result responseMessage) {
+				assert.Equal(t, result.Error["sort"], "must be one of created_at, name, updated_at")
+			},
+		},
+		{
+			Name:   "InvalidCursor",
+			Auth:   token,
+			Route:  secret.GetUserSecretsRoute + "?cursor=not-a-cursor",
+			Status: http.StatusUnprocessableEntity,
+			FN: func(t *testing.T, result responseMessage) {
+				assert.Equal(t, result.Error["cursor"], "is invalid")
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		assert.RunHandlerTestCase(t, handler, http.MethodGet, tc.Route, tc)
+	}
+}
@@ -0,0 +1,167 @@
+package secret
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"pm4devs.strawhats/internal/assert"
+	"pm4devs.strawhats/internal/mocks"
+	"pm4devs.strawhats/internal/routes/secret"
+	"pm4devs.strawhats/internal/routes/utils"
+)
+
+func TestSecretSearch(t *testing.T) {
+	assert.Integration(t)
+	app := mocks.App(t)
+	handler := secretsHandler(app)
+	authHandler := utils.AuthHandler(app)
+
+	credentials := `{"email": "test@example.com", "password": "password"}`
+	assert.Check(t, utils.RegisterUser(authHandler, credentials))
+	token := utils.LoginUser(authHandler, credentials)
+	assert.Check(t, len(token) > 0)
+
+	credentialsTwo := `{"email": "test2@example.com", "password": "password"}`
+	assert.Check(t, utils.RegisterUser(authHandler, credentialsTwo))
+	tokenTwo := utils.LoginUser(authHandler, credentialsTwo)
+	assert.Check(t, len(tokenTwo) > 0)
+
+	// Seed – three labelled secrets, one shared with the second user
+	seed := []string{
+		`{"name": "GitHub deploy key", "encrypted_data": "data", "iv": "iv", "tags": ["CI", "prod"], "metadata": {"service": "github", "env": "prod"}}`,
+		`{"name": "GitLab token", "encrypted_data": "data", "iv": "iv", "tags": ["ci"], "metadata": {"service": "gitlab", "env": "staging"}}`,
+		`{"name": "Database password", "encrypted_data": "data", "iv": "iv"}`,
+	}
+	for _, body := range seed {
+		res := sendAuthRequest(handler, http.MethodPost, secret.SecretCRUDRoute, body, token)
+		assert.Equal(t, res, http.StatusCreated)
+	}
+
+	shareData := `{"secret_id": 1, "user_email": "test2@example.com", "permission": "read-only"}`
+	res := sendAuthRequest(handler, http.MethodPost, secret.SecretShareUserRoute, shareData, token)
+	assert.Equal(t, res, http.StatusCreated)
+
+	type responseMessage struct {
+		Error   map[string]string `json:"error"`
+		Message string            `json:"message"`
+		Data    []struct {
+			Name     string            `json:"name"`
+			Tags     []string          `json:"tags"`
+			Metadata map[string]string `json:"metadata"`
+		} `json:"data"`
+	}
+
+	future := url.QueryEscape(time.Now().Add(time.Hour).Format(time.RFC3339))
+
+	tests := []assert.HandlerTestCase[responseMessage]{
+		{
+			Name:   "NoFilter",
+			Auth:   token,
+			Route:  secret.GetUserSecretsRoute,
+			Status: http.StatusOK,
+			FN: func(t *testing.T, result responseMessage) {
+				assert.Equal(t, len(result.Data), 3)
+				assert.Equal(t, result.Data[0].Tags[0], "ci")
+				assert.Equal(t, result.Data[0].Metadata["service"], "github")
+			},
+		},
+		{
+			Name:   "NamePrefix",
+			Auth:   token,
+			Route:  secret.GetUserSecretsRoute + "?name=git",
+			Status: http.StatusOK,
+			FN: func(t *testing.T, result responseMessage) {
+				assert.Equal(t, len(result.Data), 2)
+			},
+		},
+		{
+			Name:   "Tags",
+			Auth:   token,
+			Route:  secret.GetUserSecretsRoute + "?tag=ci&tag=prod",
+			Status: http.StatusOK,
+			FN: func(t *testing.T, result responseMessage) {
+				assert.Equal(t, len(result.Data), 1)
+				assert.Equal(t, result.Data[0].Name, "GitHub deploy key")
+			},
+		},
+		{
+			Name:   "Metadata",
+			Auth:   token,
+			Route:  secret.GetUserSecretsRoute + "?meta=env:staging",
+			Status: http.StatusOK,
+			FN: func(t *testing.T, result responseMessage) {
+				assert.Equal(t, len(result.Data), 1)
+				assert.Equal(t, result.Data[0].Name, "GitLab token")
+			},
+		},
+		{
+			Name:   "CreatedAfter",
+			Auth:   token,
+			Route:  secret.GetUserSecretsRoute + "?created_after=" + future,
+			Status: http.StatusOK,
+			FN: func(t *testing.T, result responseMessage) {
+				assert.Equal(t, len(result.Data), 0)
+			},
+		},
+		{
+			Name:   "InvalidDate",
+			Auth:   token,
+			Route:  secret.GetUserSecretsRoute + "?updated_before=yesterday",
+			Status: http.StatusUnprocessableEntity,
+			FN: func(t *testing.T, result responseMessage) {
+				assert.Equal(t, result.Error["updated_before"], "must be an RFC 3339 timestamp")
+			},
+		},
+		{
+			Name:   "InvalidMetadata",
+			Auth:   token,
+			Route:  secret.GetUserSecretsRoute + "?meta=env",
+			Status: http.StatusUnprocessableEntity,
+			FN: func(t *testing.T, result responseMessage) {
+				assert.Equal(t, result.Error["meta"], "must be in the form key:value")
+			},
+		},
+		{
+			Name:   "SharedTo/Tags",
+			Auth:   tokenTwo,
+			Route:  secret.GetSecretsSharedToUser + "?tag=prod",
+			Status: http.StatusOK,
+			FN: func(t *testing.T, result responseMessage) {
+				assert.Equal(t, len(result.Data), 1)
+			},
+		},
+		{
+			Name:   "SharedBy/NoMatch",
+			Auth:   token,
+			Route:  secret.GetSecretsSharedByUser + "?name=database",
+			Status: http.StatusOK,
+			FN: func(t *testing.T, result responseMessage) {
+				assert.Equal(t, len(result.Data), 0)
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		assert.RunHandlerTestCase(t, handler, http.MethodGet, tc.Route, tc)
+	}
+
+	// Updating without labels keeps them, giving labels replaces them
+	update := `{"secret_id": 2, "name": "GitLab token", "encrypted_data": "new", "iv": "iv"}`
+	res = sendAuthRequest(handler, http.MethodPatch, secret.SecretCRUDRoute, update, token)
+	assert.Equal(t, res, http.StatusOK)
+
+	secret2, err := app.Models.Secrets.GetSecretByID(2)
+	assert.Check(t, err == nil)
+	assert.Equal(t, len(secret2.Tags), 1)
+
+	update = `{"secret_id": 2, "name": "GitLab token", "encrypted_data": "new", "iv": "iv", "tags": []}`
+	res = sendAuthRequest(handler, http.MethodPatch, secret.SecretCRUDRoute, update, token)
+	assert.Equal(t, res, http.StatusOK)
+
+	secret2, err = app.Models.Secrets.GetSecretByID(2)
+	assert.Check(t, err == nil)
+	assert.Equal(t, len(secret2.Tags), 0)
+	assert.Equal(t, secret2.Metadata["env"], "staging")
+}
@@ -0,0 +1,171 @@
+package secret
+
+import (
+	"net/http"
+	"testing"
+
+	"pm4devs.strawhats/internal/assert"
+	"pm4devs.strawhats/internal/mocks"
+	"pm4devs.strawhats/internal/models/permissions"
+	"pm4devs.strawhats/internal/routes/secret"
+	"pm4devs.strawhats/internal/routes/utils"
+)
+
+func TestTransfers(t *testing.T) {
+	assert.Integration(t)
+	app := mocks.App(t)
+	handler := secretsHandler(app)
+	authHandler := utils.AuthHandler(app)
+
+	// Register and login the owner, the recipient and a user the secret is shared with
+	tokens := map[string]string{}
+	for _, email := range []string{"owner@example.com", "recipient@example.com", "reader@example.com", "admin@example.com"} {
+		credentials := `{"email": "` + email + `", "password": "password"}`
+		assert.Check(t, utils.RegisterUser(authHandler, credentials))
+		tokens[email] = utils.LoginUser(authHandler, credentials)
+		assert.Check(t, len(tokens[email]) > 0)
+	}
+	owner, recipient, reader := tokens["owner@example.com"], tokens["recipient@example.com"], tokens["reader@example.com"]
+
+	secretData := `{"encrypted_data": "data", "name": "testname", "iv": "testing"}`
+	res := sendAuthRequest(handler, http.MethodPost, secret.SecretCRUDRoute, secretData, owner)
+	assert.Equal(t, res, http.StatusCreated)
+	for _, email := range []string{"reader@example.com", "recipient@example.com"} {
+		share := `{"secret_id": 1, "user_email": "` + email + `", "permission": "read-only"}`
+		res = sendAuthRequest(handler, http.MethodPost, secret.SecretShareUserRoute, share, owner)
+		assert.Equal(t, res, http.StatusCreated)
+	}
+
+	type responseMessage struct {
+		Error       map[string]string `json:"error"`
+		Message     string            `json:"message"`
+		Transferred int               `json:"transferred"`
+		Data        []map[string]any  `json:"data"`
+	}
+
+	tests := []assert.HandlerTestCase[responseMessage]{
+		{
+			Name:   "ProposeToSelf",
+			Method: http.MethodPost,
+			Body:   `{"secret_id": 1, "user_email": "owner@example.com"}`,
+			Auth:   owner,
+			Status: http.StatusBadRequest,
+			FN: func(t *testing.T, result responseMessage) {
+				assert.Equal(t, result.Error["user_email"], "must be another user")
+			},
+		},
+		{
+			Name:   "ProposeByNonOwner",
+			Method: http.MethodPost,
+			Body:   `{"secret_id": 1, "user_email": "recipient@example.com"}`,
+			Auth:   reader,
+			Status: http.StatusUnauthorized,
+		},
+		{
+			Name:   "Propose",
+			Method: http.MethodPost,
+			Body:   `{"secret_id": 1, "user_email": "recipient@example.com"}`,
+			Auth:   owner,
+			Status: http.StatusCreated,
+		},
+		{
+			Name:   "ListIncoming",
+			Method: http.MethodGet,
+			Auth:   recipient,
+			Status: http.StatusOK,
+			FN: func(t *testing.T, result responseMessage) {
+				assert.Equal(t, len(result.Data), 1)
+				assert.Equal(t, result.Data[0]["from_email"], "owner@example.com")
+			},
+		},
+		{
+			Name:   "AcceptByOther",
+			Method: http.MethodPut,
+			Body:   `{"secret_id": 1}`,
+			Auth:   reader,
+			Status: http.StatusNotFound,
+		},
+		{
+			Name:   "Accept",
+			Method: http.MethodPut,
+			Body:   `{"secret_id": 1}`,
+			Auth:   recipient,
+			Status: http.StatusOK,
+		},
+		{
+			Name:   "AcceptTwice",
+			Method: http.MethodPut,
+			Body:   `{"secret_id": 1}`,
+			Auth:   recipient,
+			Status: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range tests {
+		assert.RunHandlerTestCase(t, handler, tc.Method, secret.SecretTransfersRoute, tc)
+	}
+
+	// The recipient owns the secret and the other shares survived
+	transferred, err := app.Models.Secrets.GetSecretByID(1)
+	assert.Check(t, err == nil)
+	user, err := app.Models.Users.GetByEmail("recipient@example.com")
+	assert.Check(t, err == nil)
+	assert.Equal(t, transferred.OwnerID, user.ID)
+	assert.Check(t, transferred.RekeyRequired)
+
+	res = sendAuthRequest(handler, http.MethodGet, secret.SecretCRUDRoute, `{"secret_id": 1}`, reader)
+	assert.Equal(t, res, http.StatusOK)
+	res = sendAuthRequest(handler, http.MethodGet, secret.SecretCRUDRoute, `{"secret_id": 1}`, owner)
+	assert.Equal(t, res, http.StatusUnauthorized)
+
+	// Admins can move everything a user owns
+	res = sendAuthRequest(handler, http.MethodPost, secret.SecretCRUDRoute, secretData, reader)
+	assert.Equal(t, res, http.StatusCreated)
+	res = sendAuthRequest(handler, http.MethodPost, secret.SecretCRUDRoute, secretData, reader)
+	assert.Equal(t, res, http.StatusCreated)
+
+	admin, err := app.Models.Users.GetByEmail("admin@example.com")
+	assert.Check(t, err == nil)
+	_, err = app.Models.Permissions.Insert(admin.ID, permissions.PermissionAdmin)
+	assert.Check(t, err == nil)
+
+	forceTests := []assert.HandlerTestCase[responseMessage]{
+		{
+			Name:   "NotAdmin",
+			Body:   `{"from_email": "reader@example.com", "user_email": "recipient@example.com"}`,
+			Auth:   owner,
+			Status: http.StatusUnauthorized,
+		},
+		{
+			Name:   "MissingSource",
+			Body:   `{"user_email": "recipient@example.com"}`,
+			Auth:   tokens["admin@example.com"],
+			Status: http.StatusBadRequest,
+			FN: func(t *testing.T, result responseMessage) {
+				assert.Equal(t, result.Error["secret_id"], "either secret_id or from_email must be provided")
+			},
+		},
+		{
+			Name:   "Single",
+			Body:   `{"secret_id": 2, "user_email": "owner@example.com"}`,
+			Auth:   tokens["admin@example.com"],
+			Status: http.StatusOK,
+			FN: func(t *testing.T, result responseMessage) {
+				assert.Equal(t, result.Transferred, 1)
+			},
+		},
+		{
+			Name:   "All",
+			Body:   `{"from_email": "reader@example.com", "user_email": "recipient@example.com"}`,
+			Auth:   tokens["admin@example.com"],
+			Status: http.StatusOK,
+			FN: func(t *testing.T, result responseMessage) {
+				assert.Equal(t, result.Transferred, 1)
+			},
+		},
+	}
+
+	for _, tc := range forceTests {
+		assert.RunHandlerTestCase(t, handler, http.MethodPost, secret.SecretForceTransferRoute, tc)
+	}
+}
@@ -0,0 +1,156 @@
+package secret
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"pm4devs.strawhats/internal/assert"
+	"pm4devs.strawhats/internal/mocks"
+	"pm4devs.strawhats/internal/routes/secret"
+	"pm4devs.strawhats/internal/routes/utils"
+)
+
+func TestSecretTrash(t *testing.T) {
+	assert.Integration(t)
+	app := mocks.App(t)
+	handler := secretsHandler(app)
+	authHandler := utils.AuthHandler(app)
+
+	// Register and login users
+	credentials := `{"email": "test@example.com", "password": "password"}`
+	assert.Check(t, utils.RegisterUser(authHandler, credentials))
+	token := utils.LoginUser(authHandler, credentials)
+	assert.Check(t, len(token) > 0)
+
+	credentialsTwo := `{"email": "test2@example.com", "password": "password"}`
+	assert.Check(t, utils.RegisterUser(authHandler, credentialsTwo))
+	tokenTwo := utils.LoginUser(authHandler, credentialsTwo)
+	assert.Check(t, len(tokenTwo) > 0)
+
+	// Seed – create a secret, share it and delete it
+	secretData := `{"encrypted_data": "test@example.com", "name": "testname", "iv": "testing"}`
+	res := sendAuthRequest(handler, http.MethodPost, secret.SecretCRUDRoute, secretData, token)
+	assert.Equal(t, res, http.StatusCreated)
+
+	shareData := `{"secret_id": 1, "user_email": "test2@example.com", "permission": "read-only"}`
+	res = sendAuthRequest(handler, http.MethodPost, secret.SecretShareUserRoute, shareData, token)
+	assert.Equal(t, res, http.StatusCreated)
+
+	res = sendAuthRequest(handler, http.MethodDelete, secret.SecretCRUDRoute, `{"secret_id": 1}`, token)
+	assert.Equal(t, res, http.StatusNoContent)
+
+	// Deleted secrets are no longer accessible
+	res = sendAuthRequest(handler, http.MethodGet, secret.SecretCRUDRoute, `{"secret_id": 1}`, tokenTwo)
+	assert.Equal(t, res, http.StatusNotFound)
+
+	type responseMessage struct {
+		Error   map[string]string `json:"error"`
+		Message string            `json:"message"`
+		Data    []struct {
+			ID        int64      `json:"id"`
+			DeletedAt *time.Time `json:"deleted_at"`
+		} `json:"data"`
+	}
+
+	tests := []assert.HandlerTestCase[responseMessage]{
+		{
+			Name:   "MethodNotAllowed",
+			Method: http.MethodPut,
+			Status: http.StatusMethodNotAllowed,
+			Auth:   token,
+		},
+		{
+			Name:   "AuthRequired",
+			Method: http.MethodGet,
+			Status: http.StatusUnauthorized,
+		},
+		{
+			Name:   "List/Success",
+			Method: http.MethodGet,
+			Status: http.StatusOK,
+			Auth:   token,
+			FN: func(t *testing.T, result responseMessage) {
+				assert.Equal(t, len(result.Data), 1)
+				assert.Equal(t, result.Data[0].ID, int64(1))
+				assert.True(t, result.Data[0].DeletedAt != nil)
+			},
+		},
+		{
+			Name:   "List/OtherUser",
+			Method: http.MethodGet,
+			Status: http.StatusOK,
+			Auth:   tokenTwo,
+			FN: func(t *testing.T, result responseMessage) {
+				assert.Equal(t, len(result.Data), 0)
+			},
+		},
+		{
+			Name:   "Restore/InvalidSecretID",
+			Body:   `{"secret_id": 0}`,
+			Method: http.MethodPost,
+			Status: http.StatusUnprocessableEntity,
+			Auth:   token,
+			FN: func(t *testing.T, result responseMessage) {
+				assert.Equal(t, result.Error["secret_id"], "must be provided")
+			},
+		},
+		{
+			Name:   "Restore/NotOwner",
+			Body:   `{"secret_id": 1}`,
+			Method: http.MethodPost,
+			Status: http.StatusNotFound,
+			Auth:   tokenTwo,
+		},
+		{
+			Name:   "Restore/Success",
+			Body:   `{"secret_id": 1}`,
+			Method: http.MethodPost,
+			Status: http.StatusOK,
+			Auth:   token,
+		},
+		{
+			Name:   "Restore/NotInTrash",
+			Body:   `{"secret_id": 1}`,
+			Method: http.MethodPost,
+			Status: http.StatusNotFound,
+			Auth:   token,
+		},
+	}
+
+	for _, tc := range tests {
+		assert.RunHandlerTestCase(t, handler, tc.Method, secret.SecretTrashRoute, tc)
+	}
+
+	// The original share was restored
+	res = sendAuthRequest(handler, http.MethodGet, secret.SecretCRUDRoute, `{"secret_id": 1}`, tokenTwo)
+	assert.Equal(t, res, http.StatusOK)
+
+	// Purge
+	res = sendAuthRequest(handler, http.MethodDelete, secret.SecretTrashRoute, `{"secret_id": 1}`, token)
+	assert.Equal(t, res, http.StatusNotFound)
+
+	res = sendAuthRequest(handler, http.MethodDelete, secret.SecretCRUDRoute, `{"secret_id": 1}`, token)
+	assert.Equal(t, res, http.StatusNoContent)
+
+	res = sendAuthRequest(handler, http.MethodDelete, secret.SecretTrashRoute, `{"secret_id": 1}`, token)
+	assert.Equal(t, res, http.StatusNoContent)
+
+	res = sendAuthRequest(handler, http.MethodPost, secret.SecretTrashRoute, `{"secret_id": 1}`, token)
+	assert.Equal(t, res, http.StatusNotFound)
+
+	// Expired items are purged
+	res = sendAuthRequest(handler, http.MethodPost, secret.SecretCRUDRoute, secretData, token)
+	assert.Equal(t, res, http.StatusCreated)
+
+	res = sendAuthRequest(handler, http.MethodDelete, secret.SecretCRUDRoute, `{"secret_id": 2}`, token)
+	assert.Equal(t, res, http.StatusNoContent)
+
+	purged, err := app.Models.Secrets.PurgeDeletedBefore(time.Now().Add(-time.Hour))
+	assert.Check(t, err == nil)
+	assert.Equal(t, purged, int64(0))
+
+	purged, err = app.Models.Secrets.PurgeDeletedBefore(time.Now().Add(time.Hour))
+	assert.Check(t, err == nil)
+	assert.Equal(t, purged, int64(1))
+}
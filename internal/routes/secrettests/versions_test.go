@@ -0,0 +1,167 @@
+package secret
+
+import (
+	"net/http"
+	"testing"
+
+	"pm4devs.strawhats/internal/assert"
+	"pm4devs.strawhats/internal/mocks"
+	"pm4devs.strawhats/internal/routes/secret"
+	"pm4devs.strawhats/internal/routes/utils"
+)
+
+func TestSecretVersions(t *testing.T) {
+	assert.Integration(t)
+	app := mocks.App(t)
+	handler := secretsHandler(app)
+	authHandler := utils.AuthHandler(app)
+
+	// Register and login users
+	credentials := `{"email": "test@example.com", "password": "password"}`
+	assert.Check(t, utils.RegisterUser(authHandler, credentials))
+	token := utils.LoginUser(authHandler, credentials)
+	assert.Check(t, len(token) > 0)
+
+	credentialsTwo := `{"email": "test2@example.com", "password": "password"}`
+	assert.Check(t, utils.RegisterUser(authHandler, credentialsTwo))
+	tokenTwo := utils.LoginUser(authHandler, credentialsTwo)
+	assert.Check(t, len(tokenTwo) > 0)
+
+	// Seed – create a secret and update it twice
+	secretData := `{"encrypted_data": "first", "name": "testname", "iv": "testing"}`
+	res := sendAuthRequest(handler, http.MethodPost, secret.SecretCRUDRoute, secretData, token)
+	assert.Equal(t, res, http.StatusCreated)
+
+	secretData = `{"secret_id": 1, "encrypted_data": "second", "name": "testname", "iv": "testing"}`
+	res = sendAuthRequest(handler, http.MethodPatch, secret.SecretCRUDRoute, secretData, token)
+	assert.Equal(t, res, http.StatusOK)
+
+	secretData = `{"secret_id": 1, "encrypted_data": "third", "name": "testname", "iv": "testing"}`
+	res = sendAuthRequest(handler, http.MethodPatch, secret.SecretCRUDRoute, secretData, token)
+	assert.Equal(t, res, http.StatusOK)
+
+	type versionsResponse struct {
+		Error   map[string]string `json:"error"`
+		Message string            `json:"message"`
+		Data    []struct {
+			Version       int    `json:"version"`
+			EncryptedData []byte `json:"encrypted_data"`
+		} `json:"data"`
+	}
+
+	tests := []assert.HandlerTestCase[versionsResponse]{
+		{
+			Name:   "MethodNotAllowed",
+			Method: http.MethodPut,
+			Status: http.StatusMethodNotAllowed,
+			Auth:   token,
+		},
+		{
+			Name:   "AuthRequired",
+			Method: http.MethodGet,
+			Status: http.StatusUnauthorized,
+		},
+		{
+			Name:   "InvalidSecretID",
+			Body:   `{"secret_id": 0}`,
+			Method: http.MethodGet,
+			Status: http.StatusUnprocessableEntity,
+			Auth:   token,
+			FN: func(t *testing.T, result versionsResponse) {
+				assert.Equal(t, result.Error["secret_id"], "must be provided")
+			},
+		},
+		{
+			Name:   "Unauthorized",
+			Body:   `{"secret_id": 1}`,
+			Method: http.MethodGet,
+			Status: http.StatusUnauthorized,
+			Auth:   tokenTwo,
+		},
+		{
+			Name:   "Success",
+			Body:   `{"secret_id": 1}`,
+			Method: http.MethodGet,
+			Status: http.StatusOK,
+			Auth:   token,
+			FN: func(t *testing.T, result versionsResponse) {
+				assert.Equal(t, len(result.Data), 2)
+				assert.Equal(t, result.Data[0].Version, 2)
+				assert.Equal(t, string(result.Data[0].EncryptedData), "second")
+			},
+		},
+		{
+			Name:   "Version/NotFound",
+			Body:   `{"secret_id": 1, "version": 9}`,
+			Method: http.MethodGet,
+			Status: http.StatusNotFound,
+			Auth:   token,
+		},
+	}
+
+	for _, tc := range tests {
+		assert.RunHandlerTestCase(t, handler, tc.Method, secret.SecretVersionsRoute, tc)
+	}
+
+	type responseMessage struct {
+		Error   map[string]string `json:"error"`
+		Message string            `json:"message"`
+	}
+
+	rollbackTests := []assert.HandlerTestCase[responseMessage]{
+		{
+			Name:   "Rollback/MethodNotAllowed",
+			Method: http.MethodGet,
+			Status: http.StatusMethodNotAllowed,
+			Auth:   token,
+		},
+		{
+			Name:   "Rollback/InvalidVersion",
+			Body:   `{"secret_id": 1}`,
+			Method: http.MethodPost,
+			Status: http.StatusUnprocessableEntity,
+			Auth:   token,
+			FN: func(t *testing.T, result responseMessage) {
+				assert.Equal(t, result.Error["version"], "must be provided")
+			},
+		},
+		{
+			Name:   "Rollback/Unauthorized",
+			Body:   `{"secret_id": 1, "version": 1}`,
+			Method: http.MethodPost,
+			Status: http.StatusUnauthorized,
+			Auth:   tokenTwo,
+		},
+		{
+			Name:   "Rollback/NotFound",
+			Body:   `{"secret_id": 1, "version": 9}`,
+			Method: http.MethodPost,
+			Status: http.StatusNotFound,
+			Auth:   token,
+		},
+		{
+			Name:   "Rollback/Success",
+			Body:   `{"secret_id": 1, "version": 1}`,
+			Method: http.MethodPost,
+			Status: http.StatusOK,
+			Auth:   token,
+			FN: func(t *testing.T, result responseMessage) {
+				assert.Equal(t, result.Message, "Success!")
+			},
+		},
+	}
+
+	for _, tc := range rollbackTests {
+		assert.RunHandlerTestCase(t, handler, tc.Method, secret.SecretRollbackRoute, tc)
+	}
+
+	// The rolled back value is current and the replaced value is kept
+	current, err := app.Models.Secrets.GetSecretByID(1)
+	assert.Check(t, err == nil)
+	assert.Equal(t, string(current.EncryptedData), "first")
+
+	versions, err := app.Models.Secrets.GetVersions(1)
+	assert.Check(t, err == nil)
+	assert.Equal(t, len(*versions), 3)
+	assert.Equal(t, string((*versions)[0].EncryptedData), "third")
+}
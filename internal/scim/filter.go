@@ -0,0 +1,211 @@
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ============================================================================
+// Filter
+// ============================================================================
+
+// Comparison operators of a filter
+var operators = []string{"eq", "ne", "co", "sw", "ew", "gt", "ge", "lt", "le", "pr"}
+
+// A comparison of an attribute with a value. The attribute and operator are
+// in lower case, as both are case-insensitive. The value is a string, a bool,
+// a float64 or nil, and always nil for the pr (present) operator.
+type Condition struct {
+	Attribute string
+	Operator  string
+	Value     any
+}
+
+// Conditions a resource must all meet
+type Filter []Condition
+
+// Parses a filter of comparisons joined by "and"
+//
+// Providers only search for resources by attribute values, so "or", "not"
+// and grouping are reported as unsupported.
+func ParseFilter(filter string) (Filter, error) {
+	tokens, err := tokenize(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var result Filter
+	for len(tokens) > 0 {
+		if len(result) > 0 {
+			if tokens[0].quoted || !strings.EqualFold(tokens[0].text, "and") {
+				return nil, fmt.Errorf("%w: only \"and\" is supported between comparisons, got %q",
+					ErrInvalidFilter, tokens[0].text)
+			}
+			tokens = tokens[1:]
+		}
+
+		if len(tokens) < 2 || tokens[0].quoted || tokens[1].quoted {
+			return nil, fmt.Errorf("%w: expected an attribute and an operator", ErrInvalidFilter)
+		}
+		condition := Condition{
+			Attribute: strings.ToLower(tokens[0].text),
+			Operator:  strings.ToLower(tokens[1].text),
+		}
+		if !slices.Contains(operators, condition.Operator) {
+			return nil, fmt.Errorf("%w: unknown operator %q", ErrInvalidFilter, tokens[1].text)
+		}
+		tokens = tokens[2:]
+
+		if condition.Operator != "pr" {
+			if len(tokens) == 0 {
+				return nil, fmt.Errorf("%w: %s %s is missing a value", ErrInvalidFilter,
+					condition.Attribute, condition.Operator)
+			}
+			value, err := tokens[0].value()
+			if err != nil {
+				return nil, err
+			}
+			condition.Value = value
+			tokens = tokens[1:]
+		}
+
+		result = append(result, condition)
+	}
+
+	if len(result) == 0 {
+		return nil, fmt.Errorf("%w: the filter is empty", ErrInvalidFilter)
+	}
+	return result, nil
+}
+
+// Returns the value of the condition if it is a string
+func (c Condition) Text() (string, bool) {
+	s, ok := c.Value.(string)
+	return s, ok
+}
+
+// ============================================================================
+// Path
+// ============================================================================
+
+// Target of a PATCH operation, such as `members`, `name.givenName` or
+// `members[value eq "42"]`
+type Path struct {
+	Attribute    string // Attribute in lower case
+	Filter       Filter // Values of a multi-valued attribute the operation targets, if any
+	SubAttribute string // Sub-attribute in lower case, if any
+}
+
+// Parses the path of a PATCH operation
+func ParsePath(path string) (Path, error) {
+	var result Path
+
+	// Attributes may be prefixed with the URI of their schema
+	if strings.HasPrefix(strings.ToLower(path), "urn:") {
+		end := len(path)
+		if start := strings.IndexByte(path, '['); start >= 0 {
+			end = start
+		}
+		path = path[strings.LastIndexByte(path[:end], ':')+1:]
+	}
+
+	if start := strings.IndexByte(path, '['); start >= 0 {
+		end := strings.LastIndexByte(path, ']')
+		if end < start {
+			return result, fmt.Errorf("%w: unterminated filter in %q", ErrInvalidPath, path)
+		}
+		filter, err := ParseFilter(path[start+1 : end])
+		if err != nil {
+			return result, fmt.Errorf("%w: %v", ErrInvalidPath, err)
+		}
+		result.Filter = filter
+		result.SubAttribute = strings.TrimPrefix(path[end+1:], ".")
+		path = path[:start]
+	} else if dot := strings.IndexByte(path, '.'); dot >= 0 {
+		result.SubAttribute = path[dot+1:]
+		path = path[:dot]
+	}
+
+	result.Attribute = strings.ToLower(path)
+	result.SubAttribute = strings.ToLower(result.SubAttribute)
+	if result.Attribute == "" {
+		return result, fmt.Errorf("%w: the path is empty", ErrInvalidPath)
+	}
+	return result, nil
+}
+
+// ============================================================================
+// Helpers
+// ============================================================================
+
+type token struct {
+	text   string
+	quoted bool
+}
+
+// Splits a filter on whitespace, keeping quoted strings, with their escapes
+// resolved, as a single token
+func tokenize(filter string) ([]token, error) {
+	var tokens []token
+
+	for i := 0; i < len(filter); {
+		switch c := filter[i]; {
+		case c == ' ' || c == '\t':
+			i++
+
+		case c == '(' || c == ')' || c == '[' || c == ']':
+			return nil, fmt.Errorf("%w: grouping is not supported", ErrInvalidFilter)
+
+		case c == '"':
+			end := i + 1
+			for ; end < len(filter) && filter[end] != '"'; end++ {
+				if filter[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(filter) {
+				return nil, fmt.Errorf("%w: unterminated string", ErrInvalidFilter)
+			}
+
+			var text string
+			if err := json.Unmarshal([]byte(filter[i:end+1]), &text); err != nil {
+				return nil, fmt.Errorf("%w: invalid string %s", ErrInvalidFilter, filter[i:end+1])
+			}
+			tokens = append(tokens, token{text: text, quoted: true})
+			i = end + 1
+
+		default:
+			end := i
+			for end < len(filter) && !strings.ContainsRune(" \t()[]\"", rune(filter[end])) {
+				end++
+			}
+			tokens = append(tokens, token{text: filter[i:end]})
+			i = end
+		}
+	}
+
+	return tokens, nil
+}
+
+// Returns the value of a token compared with
+func (t token) value() (any, error) {
+	if t.quoted {
+		return t.text, nil
+	}
+
+	switch strings.ToLower(t.text) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	if number, err := strconv.ParseFloat(t.text, 64); err == nil {
+		return number, nil
+	}
+	return nil, fmt.Errorf("%w: invalid value %q, strings must be quoted", ErrInvalidFilter, t.text)
+}
@@ -0,0 +1,251 @@
+// Package scim implements the parts of SCIM 2.0 (RFC 7643 and RFC 7644) an
+// identity provider needs to provision users and groups: resources, list
+// responses, errors, filters and PATCH operations.
+package scim
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// Constants
+// ============================================================================
+
+// Media type of every request and response
+const ContentType = "application/scim+json"
+
+// URIs of the schemas and messages
+const (
+	SchemaUser                  = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SchemaGroup                 = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	SchemaServiceProviderConfig = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	SchemaListResponse          = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SchemaPatchOp               = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SchemaError                 = "urn:ietf:params:scim:api:messages:2.0:Error"
+)
+
+// Detail errors of a 400 Bad Request, reported as the scimType of the error
+var (
+	ErrInvalidFilter = errors.New("invalidFilter")
+	ErrInvalidPath   = errors.New("invalidPath")
+	ErrInvalidSyntax = errors.New("invalidSyntax")
+	ErrInvalidValue  = errors.New("invalidValue")
+)
+
+// Detail error of a 409 Conflict
+const Uniqueness = "uniqueness"
+
+// ============================================================================
+// Resources
+// ============================================================================
+
+// Metadata of a resource
+type Meta struct {
+	ResourceType string    `json:"resourceType"`
+	Created      time.Time `json:"created"`
+	Location     string    `json:"location"`
+	Version      string    `json:"version,omitempty"`
+}
+
+// Components of the name of a user
+type Name struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+// An email of a user
+type Email struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// User resource. Attributes the provider sends that are not listed are
+// ignored.
+type User struct {
+	Schemas     []string `json:"schemas"`
+	ID          string   `json:"id,omitempty"`
+	UserName    string   `json:"userName"`
+	DisplayName string   `json:"displayName,omitempty"`
+	Name        *Name    `json:"name,omitempty"`
+	Emails      []Email  `json:"emails,omitempty"`
+	Active      *bool    `json:"active,omitempty"`
+	Meta        *Meta    `json:"meta,omitempty"`
+}
+
+// Returns the name to display for the user: the display name, else the
+// formatted name, else the given and family names
+func (u *User) FullName() string {
+	switch {
+	case u.DisplayName != "":
+		return u.DisplayName
+	case u.Name == nil:
+		return ""
+	case u.Name.Formatted != "":
+		return u.Name.Formatted
+	default:
+		return strings.TrimSpace(u.Name.GivenName + " " + u.Name.FamilyName)
+	}
+}
+
+// A member of a group, referenced by the ID of the user
+type Member struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+}
+
+// Group resource
+type Group struct {
+	Schemas     []string `json:"schemas"`
+	ID          string   `json:"id,omitempty"`
+	DisplayName string   `json:"displayName"`
+	Members     []Member `json:"members"`
+	Meta        *Meta    `json:"meta,omitempty"`
+}
+
+// ============================================================================
+// Messages
+// ============================================================================
+
+// A page of the resources matching a query
+type ListResponse struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int      `json:"totalResults"`
+	StartIndex   int      `json:"startIndex"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	Resources    any      `json:"Resources"`
+}
+
+// Creates a list response for a page of resources, starting at the 1-based
+// index of the first
+func NewListResponse[T any](resources []T, total, startIndex int) ListResponse {
+	if resources == nil {
+		resources = []T{}
+	}
+	return ListResponse{
+		Schemas:      []string{SchemaListResponse},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	}
+}
+
+// Error response
+type Error struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+}
+
+// Creates an error response
+func NewError(status int, scimType, detail string) Error {
+	return Error{
+		Schemas:  []string{SchemaError},
+		Status:   fmt.Sprint(status),
+		ScimType: scimType,
+		Detail:   detail,
+	}
+}
+
+// Body of a PATCH request
+type PatchRequest struct {
+	Schemas    []string    `json:"schemas"`
+	Operations []Operation `json:"Operations"`
+}
+
+// An operation of a PATCH request. The value is decoded by the resource it
+// applies to.
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Returns the operation in lower case, as providers capitalise it
+// differently, or an error if it is unknown
+func (o Operation) Kind() (string, error) {
+	op := strings.ToLower(o.Op)
+	switch op {
+	case "add", "remove", "replace":
+		return op, nil
+	default:
+		return "", fmt.Errorf("%w: unknown op %q", ErrInvalidSyntax, o.Op)
+	}
+}
+
+// Decodes a boolean value, also accepting the strings some providers send
+func ParseBool(value json.RawMessage) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(value, &b); err == nil {
+		return b, nil
+	}
+
+	var s string
+	if err := json.Unmarshal(value, &s); err == nil {
+		switch strings.ToLower(s) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+	}
+	return false, fmt.Errorf("%w: %s is not a boolean", ErrInvalidValue, value)
+}
+
+// Decodes a string value
+func ParseString(value json.RawMessage) (string, error) {
+	var s string
+	if err := json.Unmarshal(value, &s); err != nil {
+		return "", fmt.Errorf("%w: %s is not a string", ErrInvalidValue, value)
+	}
+	return s, nil
+}
+
+// Decodes the members given as the value of an operation, a list or a single
+// member
+func ParseMembers(value json.RawMessage) ([]Member, error) {
+	var members []Member
+	if err := json.Unmarshal(value, &members); err == nil {
+		return members, nil
+	}
+
+	var member Member
+	if err := json.Unmarshal(value, &member); err != nil {
+		return nil, fmt.Errorf("%w: %s are not members", ErrInvalidValue, value)
+	}
+	return []Member{member}, nil
+}
+
+// ============================================================================
+// Service Provider Configuration
+// ============================================================================
+
+// Describes the features of the service provider to the identity provider
+func ServiceProviderConfig(maxResults int) map[string]any {
+	supported := func(supported bool) map[string]bool {
+		return map[string]bool{"supported": supported}
+	}
+
+	return map[string]any{
+		"schemas":        []string{SchemaServiceProviderConfig},
+		"patch":          supported(true),
+		"bulk":           map[string]any{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         map[string]any{"supported": true, "maxResults": maxResults},
+		"changePassword": supported(false),
+		"sort":           supported(false),
+		"etag":           supported(false),
+		"authenticationSchemes": []map[string]any{{
+			"type":        "oauthbearertoken",
+			"name":        "OAuth Bearer Token",
+			"description": "Personal access token with the scim:provision scope",
+			"primary":     true,
+		}},
+	}
+}
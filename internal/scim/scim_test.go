@@ -0,0 +1,96 @@
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"pm4devs.strawhats/internal/assert"
+)
+
+func TestParseFilter(t *testing.T) {
+	filter, err := ParseFilter(`userName eq "bjensen@example.com"`)
+	assert.Check(t, err == nil)
+	assert.Equal(t, len(filter), 1)
+	assert.Equal(t, filter[0].Attribute, "username")
+	assert.Equal(t, filter[0].Operator, "eq")
+	value, ok := filter[0].Text()
+	assert.True(t, ok)
+	assert.Equal(t, value, "bjensen@example.com")
+
+	filter, err = ParseFilter(`displayName EQ "Team \"A\"" and active eq true and title pr`)
+	assert.Check(t, err == nil)
+	assert.Equal(t, fmt.Sprint(filter), `[{displayname eq Team "A"} {active eq true} {title pr <nil>}]`)
+
+	tests := []struct {
+		name   string
+		filter string
+	}{
+		{"Empty", ``},
+		{"Or", `userName eq "a" or userName eq "b"`},
+		{"Not", `not (userName eq "a")`},
+		{"Grouping", `(userName eq "a")`},
+		{"Operator", `userName is "a"`},
+		{"MissingValue", `userName eq`},
+		{"Unquoted", `userName eq bjensen`},
+		{"Unterminated", `userName eq "bjensen`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseFilter(tt.filter)
+			assert.Is(t, err, ErrInvalidFilter)
+		})
+	}
+}
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		path   string
+		result string
+	}{
+		{"active", "{active [] }"},
+		{"name.givenName", "{name [] givenname}"},
+		{`members[value eq "42"]`, "{members [{value eq 42}] }"},
+		{`emails[type eq "work"].value`, "{emails [{type eq work}] value}"},
+		{"urn:ietf:params:scim:schemas:core:2.0:User:userName", "{username [] }"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			path, err := ParsePath(tt.path)
+			assert.Check(t, err == nil)
+			assert.Equal(t, fmt.Sprint(path), tt.result)
+		})
+	}
+
+	_, err := ParsePath(`members[value eq "42"`)
+	assert.Is(t, err, ErrInvalidPath)
+	_, err = ParsePath(`members[value or]`)
+	assert.Is(t, err, ErrInvalidPath)
+}
+
+func TestParseValues(t *testing.T) {
+	for _, value := range []string{`false`, `"False"`, `"false"`} {
+		b, err := ParseBool(json.RawMessage(value))
+		assert.Check(t, err == nil)
+		assert.False(t, b)
+	}
+	b, err := ParseBool(json.RawMessage(`"True"`))
+	assert.Check(t, err == nil)
+	assert.True(t, b)
+	_, err = ParseBool(json.RawMessage(`"yes"`))
+	assert.Is(t, err, ErrInvalidValue)
+
+	members, err := ParseMembers(json.RawMessage(`[{"value": "1"}, {"value": "2"}]`))
+	assert.Check(t, err == nil)
+	assert.Equal(t, len(members), 2)
+	members, err = ParseMembers(json.RawMessage(`{"value": "3"}`))
+	assert.Check(t, err == nil)
+	assert.Equal(t, members[0].Value, "3")
+	_, err = ParseMembers(json.RawMessage(`"3"`))
+	assert.Is(t, err, ErrInvalidValue)
+
+	_, err = Operation{Op: "Replace"}.Kind()
+	assert.Check(t, err == nil)
+	_, err = Operation{Op: "move"}.Kind()
+	assert.Is(t, err, ErrInvalidSyntax)
+}
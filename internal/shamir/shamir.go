@@ -0,0 +1,137 @@
+// shamir splits secrets with Shamir's Secret Sharing over GF(2^8)
+//
+// Each byte of the secret is the constant term of a random polynomial of
+// degree threshold-1, and each share holds one point of every polynomial.
+// Any threshold shares recover the secret with Lagrange interpolation at
+// zero, fewer reveal nothing about it.
+//
+// A share is its x coordinate, from 1 to 255, followed by one y coordinate
+// per byte of the secret.
+package shamir
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+// Most shares a secret can be split into, as x coordinates are non-zero bytes
+const MaxShares = 255
+
+var (
+	ErrInvalidThreshold = errors.New("threshold must be at least 2 and at most the number of shares")
+	ErrEmptySecret      = errors.New("secret must not be empty")
+	ErrInvalidShares    = errors.New("shares must have the same length and distinct x coordinates")
+	ErrTooFewShares     = errors.New("at least 2 shares are required")
+)
+
+// ============================================================================
+// Split and Combine
+// ============================================================================
+
+// Splits a secret into n shares, any threshold of which recover it
+func Split(secret []byte, n, threshold int) ([][]byte, error) {
+	if len(secret) == 0 {
+		return nil, ErrEmptySecret
+	}
+	if n > MaxShares {
+		return nil, fmt.Errorf("cannot split into more than %d shares", MaxShares)
+	}
+	if threshold < 2 || threshold > n {
+		return nil, ErrInvalidThreshold
+	}
+
+	shares := make([][]byte, n)
+	for i := range shares {
+		shares[i] = make([]byte, len(secret)+1)
+		shares[i][0] = byte(i + 1)
+	}
+
+	// The coefficients of one polynomial, the secret byte being the first
+	coefficients := make([]byte, threshold)
+	for j, b := range secret {
+		if _, err := rand.Read(coefficients[1:]); err != nil {
+			return nil, err
+		}
+		coefficients[0] = b
+		for _, share := range shares {
+			share[j+1] = evaluate(coefficients, share[0])
+		}
+	}
+	clear(coefficients)
+
+	return shares, nil
+}
+
+// Recovers a secret from its shares
+//
+// Combining fewer shares than the threshold, or shares of another secret,
+// returns garbage rather than an error: callers verify the result.
+func Combine(shares [][]byte) ([]byte, error) {
+	if len(shares) < 2 {
+		return nil, ErrTooFewShares
+	}
+
+	length := len(shares[0])
+	seen := map[byte]bool{}
+	for _, share := range shares {
+		if len(share) != length || length < 2 || share[0] == 0 || seen[share[0]] {
+			return nil, ErrInvalidShares
+		}
+		seen[share[0]] = true
+	}
+
+	secret := make([]byte, length-1)
+	for j := range secret {
+		// Lagrange interpolation at x = 0
+		var value byte
+		for i, share := range shares {
+			basis := byte(1)
+			for k, other := range shares {
+				if k == i {
+					continue
+				}
+				basis = mul(basis, div(other[0], other[0]^share[0]))
+			}
+			value ^= mul(share[j+1], basis)
+		}
+		secret[j] = value
+	}
+
+	return secret, nil
+}
+
+// ============================================================================
+// GF(2^8)
+// ============================================================================
+
+// Evaluates a polynomial at x with Horner's method
+func evaluate(coefficients []byte, x byte) byte {
+	var result byte
+	for i := len(coefficients) - 1; i >= 0; i-- {
+		result = mul(result, x) ^ coefficients[i]
+	}
+	return result
+}
+
+// Multiplies in GF(2^8) with the AES polynomial, without branching on the
+// operands
+func mul(a, b byte) byte {
+	var product byte
+	for i := 0; i < 8; i++ {
+		product ^= -(b & 1) & a
+		carry := -(a >> 7)
+		a = (a << 1) ^ (carry & 0x1b)
+		b >>= 1
+	}
+	return product
+}
+
+// Divides in GF(2^8), a / b with b non-zero, as a times b^254
+func div(a, b byte) byte {
+	inverse := b
+	for i := 0; i < 6; i++ {
+		inverse = mul(mul(inverse, inverse), b)
+	}
+	return mul(a, mul(inverse, inverse))
+}
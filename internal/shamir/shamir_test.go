@@ -0,0 +1,79 @@
+package shamir
+
+import (
+	"bytes"
+	"testing"
+
+	"pm4devs.strawhats/internal/assert"
+)
+
+func TestSplitAndCombine(t *testing.T) {
+	secret := []byte("correct horse battery staple, 32")
+
+	shares, err := Split(secret, 5, 3)
+	assert.Check(t, err == nil)
+	assert.Equal(t, len(shares), 5)
+	for i, share := range shares {
+		assert.Equal(t, len(share), len(secret)+1)
+		assert.Equal(t, share[0], byte(i+1))
+	}
+
+	// Any three shares recover the secret
+	subsets := [][]int{{0, 1, 2}, {0, 2, 4}, {4, 3, 1}, {1, 2, 3, 4}}
+	for _, subset := range subsets {
+		var picked [][]byte
+		for _, i := range subset {
+			picked = append(picked, shares[i])
+		}
+		recovered, err := Combine(picked)
+		assert.Check(t, err == nil)
+		assert.Check(t, bytes.Equal(recovered, secret))
+	}
+
+	// Two shares do not
+	recovered, err := Combine(shares[:2])
+	assert.Check(t, err == nil)
+	assert.Check(t, !bytes.Equal(recovered, secret))
+}
+
+func TestSplitErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		secret    []byte
+		n         int
+		threshold int
+	}{
+		{name: "EmptySecret", secret: nil, n: 3, threshold: 2},
+		{name: "ThresholdTooLow", secret: []byte("secret"), n: 3, threshold: 1},
+		{name: "ThresholdTooHigh", secret: []byte("secret"), n: 3, threshold: 4},
+		{name: "TooManyShares", secret: []byte("secret"), n: 256, threshold: 2},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Split(tc.secret, tc.n, tc.threshold)
+			assert.Check(t, err != nil)
+		})
+	}
+}
+
+func TestCombineErrors(t *testing.T) {
+	shares, err := Split([]byte("secret"), 3, 2)
+	assert.Check(t, err == nil)
+
+	_, err = Combine(shares[:1])
+	assert.Equal(t, err, ErrTooFewShares)
+
+	_, err = Combine([][]byte{shares[0], shares[0]})
+	assert.Equal(t, err, ErrInvalidShares)
+
+	_, err = Combine([][]byte{shares[0], shares[1][:3]})
+	assert.Equal(t, err, ErrInvalidShares)
+}
+
+func TestField(t *testing.T) {
+	for a := 1; a < 256; a++ {
+		assert.Equal(t, mul(byte(a), div(1, byte(a))), byte(1))
+	}
+	assert.Equal(t, mul(0x57, 0x83), byte(0xc1))
+}
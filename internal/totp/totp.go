@@ -0,0 +1,111 @@
+// totp implements time-based one-time passwords (RFC 6238) as used by
+// authenticator apps
+//
+// Codes are 6 digits derived with HMAC-SHA1 from a shared secret and the
+// number of 30 second periods since the Unix epoch, the step. Codes of the
+// previous and next steps are accepted to allow for clock drift.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	Digits     = 6                // Number of digits of a code
+	Period     = 30 * time.Second // Duration a code is valid for
+	SecretSize = 20               // Size of a secret, as recommended for HMAC-SHA1
+	Skew       = 1                // Number of steps before and after the current one accepted
+)
+
+// Encodes secrets as authenticator apps expect them
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// ============================================================================
+// Secrets
+// ============================================================================
+
+// Generates a random secret
+func GenerateSecret() ([]byte, error) {
+	secret := make([]byte, SecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// Encodes a secret in base32, for users typing it in their app
+func Encode(secret []byte) string {
+	return encoding.EncodeToString(secret)
+}
+
+// Returns the otpauth URI of a secret, which authenticator apps scan as a QR
+// code
+func URI(issuer, account string, secret []byte) string {
+	query := url.Values{}
+	query.Set("secret", Encode(secret))
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(Digits))
+	query.Set("period", fmt.Sprint(int(Period.Seconds())))
+
+	uri := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: query.Encode(),
+	}
+	return uri.String()
+}
+
+// ============================================================================
+// Codes
+// ============================================================================
+
+// Returns the step of the given time
+func Step(t time.Time) int64 {
+	return t.Unix() / int64(Period.Seconds())
+}
+
+// Returns the code of a secret at the given step
+func Code(secret []byte, step int64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation (RFC 4226 section 5.3)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", Digits, value%1_000_000)
+}
+
+// Validates a code at the given time and returns the step it was issued for
+//
+// Callers should reject steps that were already used, so a code cannot be
+// replayed within its period.
+func Validate(secret []byte, code string, t time.Time) (int64, bool) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != Digits {
+		return 0, false
+	}
+
+	current := Step(t)
+	for step := current - Skew; step <= current+Skew; step++ {
+		if subtle.ConstantTimeCompare([]byte(Code(secret, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
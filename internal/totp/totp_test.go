@@ -0,0 +1,74 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"pm4devs.strawhats/internal/assert"
+)
+
+// Secret of the SHA1 test vectors of RFC 6238
+var rfcSecret = []byte("12345678901234567890")
+
+func TestCode(t *testing.T) {
+	// The RFC vectors have 8 digits, codes are their last 6
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+
+	for _, vector := range vectors {
+		step := Step(time.Unix(vector.unix, 0))
+		assert.Equal(t, Code(rfcSecret, step), vector.code[2:])
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	code := Code(rfcSecret, Step(now))
+
+	step, ok := Validate(rfcSecret, code, now)
+	assert.Check(t, ok)
+	assert.Equal(t, step, Step(now))
+
+	// Spaces are ignored
+	_, ok = Validate(rfcSecret, code[:3]+" "+code[3:], now)
+	assert.Check(t, ok)
+
+	// Codes of the adjacent steps are accepted for clock drift
+	step, ok = Validate(rfcSecret, code, now.Add(Period))
+	assert.Check(t, ok)
+	assert.Equal(t, step, Step(now))
+	_, ok = Validate(rfcSecret, code, now.Add(-Period))
+	assert.Check(t, ok)
+
+	// But not further
+	_, ok = Validate(rfcSecret, code, now.Add(2*Period))
+	assert.Check(t, !ok)
+
+	// Nor other codes
+	_, ok = Validate(rfcSecret, "000000", now)
+	assert.Check(t, !ok || code == "000000")
+	_, ok = Validate(rfcSecret, "12345", now)
+	assert.Check(t, !ok)
+}
+
+func TestURI(t *testing.T) {
+	secret, err := GenerateSecret()
+	assert.Check(t, err == nil)
+	assert.Equal(t, len(secret), SecretSize)
+
+	uri := URI("pm4devs", "test@example.com", secret)
+	assert.Check(t, strings.HasPrefix(uri, "otpauth://totp/pm4devs:test@example.com?"))
+	assert.Check(t, strings.Contains(uri, "secret="+Encode(secret)))
+	assert.Check(t, strings.Contains(uri, "issuer=pm4devs"))
+	assert.Check(t, !strings.Contains(Encode(secret), "="))
+}
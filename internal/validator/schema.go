@@ -0,0 +1,85 @@
+package validator
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// The format expected of a value in a Schema
+type FieldType int
+
+const (
+	FieldText FieldType = iota // Any non-empty string
+	FieldURL                   // Absolute http(s) URL
+	FieldDate                  // Calendar date as YYYY-MM-DD
+	FieldHost                  // Hostname or IP address with an optional port
+	FieldPort                  // TCP port between 1 and 65535
+)
+
+// A field of a Schema
+type Field struct {
+	Type     FieldType
+	Required bool
+}
+
+// Describes the known keys of a string map. Keys missing from the schema are
+// not checked.
+type Schema map[string]Field
+
+// A hostname made of dot separated DNS labels
+var hostnameRegex = regexp.MustCompile(`^(?i:[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?)(?:\.(?i:[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?))*\.?$`)
+
+// Adds an error for every value in data that does not match its field in the
+// schema, and for every missing required field. Errors are keyed as
+// "<key>.<field>".
+func (v *Validator) MatchesSchema(data map[string]string, schema Schema, key string) {
+	for name, field := range schema {
+		errKey := fmt.Sprintf("%s.%s", key, name)
+		value, ok := data[name]
+		if !ok {
+			v.Check(!field.Required, errKey, "must be provided")
+			continue
+		}
+
+		switch field.Type {
+		case FieldText:
+			v.Check(len(value) > 0, errKey, "must not be empty")
+		case FieldURL:
+			v.Check(isURL(value), errKey, "must be an absolute http or https URL")
+		case FieldDate:
+			_, err := time.Parse(time.DateOnly, value)
+			v.Check(err == nil, errKey, "must be a date in the form YYYY-MM-DD")
+		case FieldHost:
+			v.Check(isHost(value), errKey, "must be a hostname or IP address")
+		case FieldPort:
+			v.Check(isPort(value), errKey, "must be a port between 1 and 65535")
+		}
+	}
+}
+
+func isURL(value string) bool {
+	u, err := url.Parse(value)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func isHost(value string) bool {
+	if host, port, err := net.SplitHostPort(value); err == nil {
+		if !isPort(port) {
+			return false
+		}
+		value = host
+	}
+	if net.ParseIP(value) != nil {
+		return true
+	}
+	return len(value) > 0 && len(value) <= 253 && hostnameRegex.MatchString(value)
+}
+
+func isPort(value string) bool {
+	port, err := strconv.Atoi(value)
+	return err == nil && port > 0 && port <= 65535
+}
@@ -0,0 +1,72 @@
+package validator
+
+import (
+	"testing"
+
+	"pm4devs.strawhats/internal/assert"
+)
+
+func TestMatchesSchema(t *testing.T) {
+	schema := Schema{
+		"url":     {Type: FieldURL},
+		"expires": {Type: FieldDate, Required: true},
+		"host":    {Type: FieldHost},
+		"port":    {Type: FieldPort},
+		"user":    {Type: FieldText},
+	}
+
+	tests := []struct {
+		Name   string
+		Data   map[string]string
+		Errors []string
+	}{
+		{
+			Name: "Valid",
+			Data: map[string]string{
+				"url":     "https://example.com/login",
+				"expires": "2030-01-31",
+				"host":    "db.example.com:5432",
+				"port":    "5432",
+				"user":    "admin",
+				"team":    "platform",
+			},
+		},
+		{
+			Name: "Valid/IP",
+			Data: map[string]string{"expires": "2030-01-31", "host": "10.0.0.1"},
+		},
+		{
+			Name:   "MissingRequired",
+			Data:   map[string]string{},
+			Errors: []string{"metadata.expires"},
+		},
+		{
+			Name: "Invalid",
+			Data: map[string]string{
+				"url":     "example.com",
+				"expires": "31/01/2030",
+				"host":    "not a host",
+				"port":    "70000",
+				"user":    "",
+			},
+			Errors: []string{"metadata.url", "metadata.expires", "metadata.host", "metadata.port", "metadata.user"},
+		},
+		{
+			Name:   "Invalid/HostPort",
+			Data:   map[string]string{"expires": "2030-01-31", "host": "example.com:0"},
+			Errors: []string{"metadata.host"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.Name, func(t *testing.T) {
+			v := New()
+			v.MatchesSchema(tc.Data, schema, "metadata")
+			assert.Equal(t, len(v.Errors), len(tc.Errors))
+			for _, key := range tc.Errors {
+				_, ok := v.Errors[key]
+				assert.True(t, ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Deepest nesting of CBOR items decoded, attestation objects and COSE keys
+// are only a few levels deep
+const maxDepth = 8
+
+var errCBOR = errors.New("malformed CBOR")
+
+// ============================================================================
+// Decoding
+// ============================================================================
+
+// Decodes the first CBOR item of data and returns it along with the bytes
+// following it
+//
+// Only the subset of CBOR used by authenticators is supported: integers, byte
+// and text strings, arrays, maps, booleans and null, with definite lengths.
+// Integers decode to int64, byte strings to []byte, text strings to string,
+// arrays to []any and maps to map[any]any.
+func decodeCBOR(data []byte) (any, []byte, error) {
+	return decodeItem(data, 0)
+}
+
+func decodeItem(data []byte, depth int) (any, []byte, error) {
+	if depth > maxDepth {
+		return nil, nil, fmt.Errorf("%w: nested too deeply", errCBOR)
+	}
+	if len(data) == 0 {
+		return nil, nil, fmt.Errorf("%w: unexpected end of data", errCBOR)
+	}
+
+	major, info := data[0]>>5, data[0]&0x1f
+	data = data[1:]
+
+	// Simple values carry no argument
+	if major == 7 {
+		switch info {
+		case 20:
+			return false, data, nil
+		case 21:
+			return true, data, nil
+		case 22:
+			return nil, data, nil
+		default:
+			return nil, nil, fmt.Errorf("%w: unsupported simple value %d", errCBOR, info)
+		}
+	}
+
+	arg, data, err := decodeArgument(info, data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch major {
+	case 0:
+		if arg > 1<<63-1 {
+			return nil, nil, fmt.Errorf("%w: integer overflow", errCBOR)
+		}
+		return int64(arg), data, nil
+
+	case 1:
+		if arg > 1<<63-1 {
+			return nil, nil, fmt.Errorf("%w: integer overflow", errCBOR)
+		}
+		return -1 - int64(arg), data, nil
+
+	case 2, 3:
+		if arg > uint64(len(data)) {
+			return nil, nil, fmt.Errorf("%w: string longer than data", errCBOR)
+		}
+		value := make([]byte, arg)
+		copy(value, data[:arg])
+		if major == 3 {
+			return string(value), data[arg:], nil
+		}
+		return value, data[arg:], nil
+
+	case 4:
+		// Every item takes at least one byte
+		if arg > uint64(len(data)) {
+			return nil, nil, fmt.Errorf("%w: array longer than data", errCBOR)
+		}
+		items := make([]any, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			var item any
+			if item, data, err = decodeItem(data, depth+1); err != nil {
+				return nil, nil, err
+			}
+			items = append(items, item)
+		}
+		return items, data, nil
+
+	case 5:
+		if arg > uint64(len(data))/2 {
+			return nil, nil, fmt.Errorf("%w: map longer than data", errCBOR)
+		}
+		items := make(map[any]any, arg)
+		for i := uint64(0); i < arg; i++ {
+			var key, value any
+			if key, data, err = decodeItem(data, depth+1); err != nil {
+				return nil, nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, nil, fmt.Errorf("%w: unsupported map key", errCBOR)
+			}
+			if _, ok := items[key]; ok {
+				return nil, nil, fmt.Errorf("%w: duplicate map key", errCBOR)
+			}
+			if value, data, err = decodeItem(data, depth+1); err != nil {
+				return nil, nil, err
+			}
+			items[key] = value
+		}
+		return items, data, nil
+
+	default:
+		return nil, nil, fmt.Errorf("%w: unsupported major type %d", errCBOR, major)
+	}
+}
+
+// Decodes the argument of an item from its additional information
+func decodeArgument(info byte, data []byte) (uint64, []byte, error) {
+	var size int
+	switch {
+	case info < 24:
+		return uint64(info), data, nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	default:
+		return 0, nil, fmt.Errorf("%w: indefinite lengths are not supported", errCBOR)
+	}
+
+	if len(data) < size {
+		return 0, nil, fmt.Errorf("%w: unexpected end of data", errCBOR)
+	}
+
+	var arg uint64
+	switch size {
+	case 1:
+		arg = uint64(data[0])
+	case 2:
+		arg = uint64(binary.BigEndian.Uint16(data))
+	case 4:
+		arg = uint64(binary.BigEndian.Uint32(data))
+	case 8:
+		arg = binary.BigEndian.Uint64(data)
+	}
+	return arg, data[size:], nil
+}
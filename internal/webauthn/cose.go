@@ -0,0 +1,145 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// COSE algorithms of the credentials accepted, in order of preference
+const (
+	AlgES256 = -7   // ECDSA with P-256 and SHA-256
+	AlgEdDSA = -8   // Ed25519
+	AlgRS256 = -257 // RSASSA-PKCS1-v1_5 with SHA-256
+)
+
+// COSE key types and curves
+const (
+	ktyOKP     = 1
+	ktyEC2     = 2
+	ktyRSA     = 3
+	crvP256    = 1
+	crvEd25519 = 6
+)
+
+// ============================================================================
+// Public Keys
+// ============================================================================
+
+// Public key of a credential along with its COSE algorithm
+type publicKey struct {
+	alg int64
+	key crypto.PublicKey
+}
+
+// Parses a COSE key, as stored for a credential
+func parsePublicKey(coseKey []byte) (*publicKey, error) {
+	item, rest, err := decodeCBOR(coseKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("%w: trailing data after the key", ErrUnsupportedKey)
+	}
+	fields, ok := item.(map[any]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: not a map", ErrUnsupportedKey)
+	}
+
+	kty, _ := fields[int64(1)].(int64)
+	alg, _ := fields[int64(3)].(int64)
+	switch {
+	case kty == ktyEC2 && alg == AlgES256:
+		crv, _ := fields[int64(-1)].(int64)
+		x, _ := fields[int64(-2)].([]byte)
+		y, _ := fields[int64(-3)].([]byte)
+		if crv != crvP256 || len(x) != 32 || len(y) != 32 {
+			return nil, fmt.Errorf("%w: invalid P-256 key", ErrUnsupportedKey)
+		}
+		// Rejects points that are not on the curve
+		point := append(append([]byte{0x04}, x...), y...)
+		if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrUnsupportedKey, err)
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		return &publicKey{alg: alg, key: key}, nil
+
+	case kty == ktyOKP && alg == AlgEdDSA:
+		crv, _ := fields[int64(-1)].(int64)
+		x, _ := fields[int64(-2)].([]byte)
+		if crv != crvEd25519 || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("%w: invalid Ed25519 key", ErrUnsupportedKey)
+		}
+		return &publicKey{alg: alg, key: ed25519.PublicKey(x)}, nil
+
+	case kty == ktyRSA && alg == AlgRS256:
+		n, _ := fields[int64(-1)].([]byte)
+		e, _ := fields[int64(-2)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("%w: invalid RSA key", ErrUnsupportedKey)
+		}
+		key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		return &publicKey{alg: alg, key: key}, nil
+
+	default:
+		return nil, fmt.Errorf("%w: key type %d with algorithm %d", ErrUnsupportedKey, kty, alg)
+	}
+}
+
+// Verifies the signature of data
+func (pk *publicKey) verify(data, signature []byte) error {
+	return verifySignature(pk.key, pk.alg, data, signature)
+}
+
+// Verifies the signature of data with a public key and COSE algorithm
+func verifySignature(key crypto.PublicKey, alg int64, data, signature []byte) error {
+	switch key := key.(type) {
+	case *ecdsa.PublicKey:
+		if alg != AlgES256 {
+			break
+		}
+		digest := sha256.Sum256(data)
+		if !ecdsa.VerifyASN1(key, digest[:], signature) {
+			return ErrInvalidSignature
+		}
+		return nil
+
+	case ed25519.PublicKey:
+		if alg != AlgEdDSA {
+			break
+		}
+		if !ed25519.Verify(key, data, signature) {
+			return ErrInvalidSignature
+		}
+		return nil
+
+	case *rsa.PublicKey:
+		if alg != AlgRS256 {
+			break
+		}
+		digest := sha256.Sum256(data)
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+			return ErrInvalidSignature
+		}
+		return nil
+	}
+
+	return fmt.Errorf("%w: algorithm %d does not match the key", ErrUnsupportedKey, alg)
+}
+
+// Verifies the signature of data with the public key of a certificate
+func verifyCertificateSignature(certificate []byte, alg int64, data, signature []byte) error {
+	cert, err := x509.ParseCertificate(certificate)
+	if err != nil {
+		return errors.Join(ErrInvalidAttestation, err)
+	}
+	return verifySignature(cert.PublicKey, alg, data, signature)
+}
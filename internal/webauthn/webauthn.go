@@ -0,0 +1,498 @@
+// webauthn verifies WebAuthn registrations and assertions (Web
+// Authentication Level 2), for passkeys and security keys
+//
+// The server hands a random challenge to the client along with options for
+// navigator.credentials.create or navigator.credentials.get. The client
+// answers with the response of the authenticator, which is verified against
+// the challenge, the origins and the ID of the relying party. Attestation is
+// not requested, so only the "none" and "packed" formats are verified and
+// attestation certificates are not checked against a trust store.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	ChallengeSize = 32              // Size of a challenge
+	Timeout       = 5 * time.Minute // How long a ceremony may take
+)
+
+// Flags of the authenticator data
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+	flagExtensions   = 0x80
+)
+
+var (
+	ErrMalformed              = errors.New("malformed authenticator response")
+	ErrChallenge              = errors.New("challenge does not match")
+	ErrOrigin                 = errors.New("origin is not allowed")
+	ErrRelyingParty           = errors.New("relying party does not match")
+	ErrUserNotPresent         = errors.New("user was not present")
+	ErrUserNotVerified        = errors.New("user was not verified")
+	ErrUnsupportedKey         = errors.New("unsupported public key")
+	ErrUnsupportedAttestation = errors.New("unsupported attestation format")
+	ErrInvalidAttestation     = errors.New("invalid attestation")
+	ErrInvalidSignature       = errors.New("invalid signature")
+	ErrSignCount              = errors.New("sign count did not increase, the authenticator may be cloned")
+)
+
+// ============================================================================
+// Types
+// ============================================================================
+
+// Binary data encoded in unpadded base64url, as in the WebAuthn JSON
+// serialization. Padded and standard base64 are accepted as well.
+type Bytes []byte
+
+func (b Bytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+func (b *Bytes) UnmarshalJSON(data []byte) error {
+	var encoded string
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+	encoded = strings.TrimRight(encoded, "=")
+	encoded = strings.NewReplacer("+", "-", "/", "_").Replace(encoded)
+
+	decoded, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return err
+	}
+	*b = decoded
+	return nil
+}
+
+// Identifies a credential in options
+type CredentialDescriptor struct {
+	Type string `json:"type"`
+	ID   Bytes  `json:"id"`
+}
+
+// Algorithm of the credentials accepted
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+// Options of navigator.credentials.create
+type CreationOptions struct {
+	Challenge Bytes `json:"challenge"`
+	RP        struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"rp"`
+	User struct {
+		ID          Bytes  `json:"id"`
+		Name        string `json:"name"`
+		DisplayName string `json:"displayName"`
+	} `json:"user"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection struct {
+		ResidentKey      string `json:"residentKey"`
+		UserVerification string `json:"userVerification"`
+	} `json:"authenticatorSelection"`
+	Attestation string `json:"attestation"`
+}
+
+// Options of navigator.credentials.get
+type RequestOptions struct {
+	Challenge        Bytes                  `json:"challenge"`
+	Timeout          int64                  `json:"timeout"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// Response of navigator.credentials.create
+type AttestationResponse struct {
+	ID       string `json:"id"`
+	RawID    Bytes  `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    Bytes `json:"clientDataJSON"`
+		AttestationObject Bytes `json:"attestationObject"`
+	} `json:"response"`
+}
+
+// Response of navigator.credentials.get
+type AssertionResponse struct {
+	ID       string `json:"id"`
+	RawID    Bytes  `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    Bytes `json:"clientDataJSON"`
+		AuthenticatorData Bytes `json:"authenticatorData"`
+		Signature         Bytes `json:"signature"`
+		UserHandle        Bytes `json:"userHandle"`
+	} `json:"response"`
+}
+
+// Credential verified at registration
+type Credential struct {
+	ID           []byte // Credential ID chosen by the authenticator
+	PublicKey    []byte // COSE public key
+	SignCount    uint32 // Signature counter, 0 if not supported
+	Format       string // Attestation format
+	AAGUID       []byte // Model of the authenticator, zero without attestation
+	UserVerified bool   // Whether the user was verified, with a PIN or biometrics
+}
+
+// Client data collected by the browser
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// Parsed authenticator data
+type authenticatorData struct {
+	rpIDHash     []byte
+	flags        byte
+	signCount    uint32
+	aaguid       []byte
+	credentialID []byte
+	publicKey    []byte
+}
+
+// ============================================================================
+// Relying Party
+// ============================================================================
+
+// Relying party credentials are scoped to
+type RelyingParty struct {
+	ID      string   // Domain of the relying party
+	Name    string   // Name shown by authenticators
+	Origins []string // Origins the ceremonies may run on
+}
+
+// Generates a random challenge
+func NewChallenge() ([]byte, error) {
+	challenge := make([]byte, ChallengeSize)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// Returns the options to register a credential for a user
+//
+// The user handle identifies the user to the authenticator, it must not hold
+// personal information. Credentials already registered are excluded.
+func (rp *RelyingParty) CreationOptions(challenge, userHandle []byte, userName string, exclude [][]byte) *CreationOptions {
+	options := &CreationOptions{
+		Challenge: challenge,
+		PubKeyCredParams: []CredentialParameter{
+			{Type: "public-key", Alg: AlgES256},
+			{Type: "public-key", Alg: AlgEdDSA},
+			{Type: "public-key", Alg: AlgRS256},
+		},
+		Timeout:            Timeout.Milliseconds(),
+		ExcludeCredentials: descriptors(exclude),
+		Attestation:        "none",
+	}
+	options.RP.ID, options.RP.Name = rp.ID, rp.Name
+	options.User.ID, options.User.Name, options.User.DisplayName = userHandle, userName, userName
+	options.AuthenticatorSelection.ResidentKey = "preferred"
+	options.AuthenticatorSelection.UserVerification = "preferred"
+	return options
+}
+
+// Returns the options to assert one of the given credentials, or any
+// discoverable credential if none are given
+//
+// userVerification is one of "required", "preferred" or "discouraged".
+func (rp *RelyingParty) RequestOptions(challenge []byte, allow [][]byte, userVerification string) *RequestOptions {
+	return &RequestOptions{
+		Challenge:        challenge,
+		Timeout:          Timeout.Milliseconds(),
+		RPID:             rp.ID,
+		AllowCredentials: descriptors(allow),
+		UserVerification: userVerification,
+	}
+}
+
+// Returns the challenge of client data, to look up the ceremony it belongs to
+// before verifying it
+func Challenge(clientDataJSON []byte) ([]byte, error) {
+	var data clientData
+	if err := json.Unmarshal(clientDataJSON, &data); err != nil {
+		return nil, errors.Join(ErrMalformed, err)
+	}
+	challenge, err := base64.RawURLEncoding.DecodeString(data.Challenge)
+	if err != nil {
+		return nil, errors.Join(ErrMalformed, err)
+	}
+	return challenge, nil
+}
+
+// ============================================================================
+// Registration
+// ============================================================================
+
+// Verifies the response of an authenticator to creation options with the
+// given challenge and returns the new credential
+func (rp *RelyingParty) VerifyRegistration(challenge []byte, response *AttestationResponse, requireUV bool) (*Credential, error) {
+	if response.Type != "public-key" {
+		return nil, fmt.Errorf("%w: type %q", ErrMalformed, response.Type)
+	}
+	if err := rp.verifyClientData(response.Response.ClientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	// Attestation object
+	item, rest, err := decodeCBOR(response.Response.AttestationObject)
+	if err != nil {
+		return nil, errors.Join(ErrMalformed, err)
+	}
+	object, ok := item.(map[any]any)
+	if !ok || len(rest) != 0 {
+		return nil, fmt.Errorf("%w: invalid attestation object", ErrMalformed)
+	}
+	format, _ := object["fmt"].(string)
+	statement, _ := object["attStmt"].(map[any]any)
+	rawAuthData, _ := object["authData"].([]byte)
+	if statement == nil {
+		return nil, fmt.Errorf("%w: missing attestation statement", ErrMalformed)
+	}
+
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.verifyAuthenticatorData(authData, requireUV); err != nil {
+		return nil, err
+	}
+	if authData.flags&flagAttested == 0 {
+		return nil, fmt.Errorf("%w: missing attested credential data", ErrMalformed)
+	}
+	if !bytes.Equal(authData.credentialID, response.RawID) {
+		return nil, fmt.Errorf("%w: credential ID does not match", ErrMalformed)
+	}
+
+	key, err := parsePublicKey(authData.publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// Attestation statement
+	clientDataHash := sha256.Sum256(response.Response.ClientDataJSON)
+	signed := append(append([]byte{}, rawAuthData...), clientDataHash[:]...)
+	switch format {
+	case "none":
+		if len(statement) != 0 {
+			return nil, fmt.Errorf("%w: statement of format none is not empty", ErrInvalidAttestation)
+		}
+
+	case "packed":
+		if err := verifyPacked(statement, key, signed); err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedAttestation, format)
+	}
+
+	return &Credential{
+		ID:           authData.credentialID,
+		PublicKey:    authData.publicKey,
+		SignCount:    authData.signCount,
+		Format:       format,
+		AAGUID:       authData.aaguid,
+		UserVerified: authData.flags&flagUserVerified != 0,
+	}, nil
+}
+
+// Verifies a packed attestation statement, either self attestation signed
+// with the credential key or signed by an attestation certificate
+func verifyPacked(statement map[any]any, key *publicKey, signed []byte) error {
+	alg, _ := statement["alg"].(int64)
+	signature, _ := statement["sig"].([]byte)
+	if signature == nil {
+		return fmt.Errorf("%w: missing signature", ErrInvalidAttestation)
+	}
+
+	chain, ok := statement["x5c"].([]any)
+	if !ok {
+		if alg != key.alg {
+			return fmt.Errorf("%w: algorithm does not match the credential", ErrInvalidAttestation)
+		}
+		if err := key.verify(signed, signature); err != nil {
+			return errors.Join(ErrInvalidAttestation, err)
+		}
+		return nil
+	}
+
+	if len(chain) == 0 {
+		return fmt.Errorf("%w: empty certificate chain", ErrInvalidAttestation)
+	}
+	certificate, _ := chain[0].([]byte)
+	if certificate == nil {
+		return fmt.Errorf("%w: invalid certificate chain", ErrInvalidAttestation)
+	}
+	if err := verifyCertificateSignature(certificate, alg, signed, signature); err != nil {
+		return errors.Join(ErrInvalidAttestation, err)
+	}
+	return nil
+}
+
+// ============================================================================
+// Assertion
+// ============================================================================
+
+// Verifies the response of an authenticator to request options with the
+// given challenge, for a credential with the given public key and sign count,
+// and returns the new sign count
+func (rp *RelyingParty) VerifyAssertion(challenge, publicKey []byte, signCount uint32, response *AssertionResponse, requireUV bool) (uint32, error) {
+	if response.Type != "public-key" {
+		return 0, fmt.Errorf("%w: type %q", ErrMalformed, response.Type)
+	}
+	if err := rp.verifyClientData(response.Response.ClientDataJSON, "webauthn.get", challenge); err != nil {
+		return 0, err
+	}
+
+	rawAuthData := response.Response.AuthenticatorData
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return 0, err
+	}
+	if err := rp.verifyAuthenticatorData(authData, requireUV); err != nil {
+		return 0, err
+	}
+
+	key, err := parsePublicKey(publicKey)
+	if err != nil {
+		return 0, err
+	}
+	clientDataHash := sha256.Sum256(response.Response.ClientDataJSON)
+	signed := append(append([]byte{}, rawAuthData...), clientDataHash[:]...)
+	if err := key.verify(signed, response.Response.Signature); err != nil {
+		return 0, err
+	}
+
+	// Authenticators without a counter always report 0
+	if (authData.signCount != 0 || signCount != 0) && authData.signCount <= signCount {
+		return 0, ErrSignCount
+	}
+
+	return authData.signCount, nil
+}
+
+// ============================================================================
+// Helpers
+// ============================================================================
+
+// Verifies the type, challenge and origin of client data
+func (rp *RelyingParty) verifyClientData(clientDataJSON []byte, ceremony string, challenge []byte) error {
+	var data clientData
+	if err := json.Unmarshal(clientDataJSON, &data); err != nil {
+		return errors.Join(ErrMalformed, err)
+	}
+	if data.Type != ceremony {
+		return fmt.Errorf("%w: client data of type %q", ErrMalformed, data.Type)
+	}
+
+	expected := base64.RawURLEncoding.EncodeToString(challenge)
+	if subtle.ConstantTimeCompare([]byte(data.Challenge), []byte(expected)) != 1 {
+		return ErrChallenge
+	}
+	if data.CrossOrigin || !slices.Contains(rp.Origins, data.Origin) {
+		return fmt.Errorf("%w: %q", ErrOrigin, data.Origin)
+	}
+
+	return nil
+}
+
+// Verifies the relying party and user flags of authenticator data
+func (rp *RelyingParty) verifyAuthenticatorData(authData *authenticatorData, requireUV bool) error {
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(authData.rpIDHash, rpIDHash[:]) {
+		return ErrRelyingParty
+	}
+	if authData.flags&flagUserPresent == 0 {
+		return ErrUserNotPresent
+	}
+	if requireUV && authData.flags&flagUserVerified == 0 {
+		return ErrUserNotVerified
+	}
+	return nil
+}
+
+// Parses authenticator data, along with the attested credential data when
+// present
+func parseAuthenticatorData(data []byte) (*authenticatorData, error) {
+	if len(data) < 37 {
+		return nil, fmt.Errorf("%w: authenticator data too short", ErrMalformed)
+	}
+
+	authData := &authenticatorData{
+		rpIDHash:  data[:32],
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	rest := data[37:]
+
+	if authData.flags&flagAttested != 0 {
+		if len(rest) < 18 {
+			return nil, fmt.Errorf("%w: attested credential data too short", ErrMalformed)
+		}
+		authData.aaguid = rest[:16]
+		length := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if length == 0 || length > 1023 || len(rest) < length {
+			return nil, fmt.Errorf("%w: invalid credential ID", ErrMalformed)
+		}
+		authData.credentialID = rest[:length]
+		rest = rest[length:]
+
+		// The public key is followed by extensions, if any
+		_, afterKey, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, errors.Join(ErrMalformed, err)
+		}
+		authData.publicKey = rest[:len(rest)-len(afterKey)]
+		rest = afterKey
+	}
+
+	if authData.flags&flagExtensions != 0 {
+		_, afterExtensions, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, errors.Join(ErrMalformed, err)
+		}
+		rest = afterExtensions
+	}
+
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("%w: trailing authenticator data", ErrMalformed)
+	}
+
+	return authData, nil
+}
+
+// Returns descriptors of public key credentials
+func descriptors(ids [][]byte) []CredentialDescriptor {
+	list := make([]CredentialDescriptor, len(ids))
+	for i, id := range ids {
+		list[i] = CredentialDescriptor{Type: "public-key", ID: id}
+	}
+	return list
+}
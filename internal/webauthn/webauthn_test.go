@@ -0,0 +1,176 @@
+package webauthn
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"pm4devs.strawhats/internal/assert"
+	"pm4devs.strawhats/internal/mocks"
+)
+
+var rp = &RelyingParty{ID: "localhost", Name: "pm4devs", Origins: []string{"http://localhost:4000"}}
+
+// Registers the credential of an authenticator
+func register(t *testing.T, authenticator *mocks.Authenticator) *Credential {
+	t.Helper()
+
+	challenge, err := NewChallenge()
+	assert.Check(t, err == nil)
+
+	var response AttestationResponse
+	assert.Check(t, json.Unmarshal([]byte(authenticator.Create(challenge, []byte{1})), &response) == nil)
+	credential, err := rp.VerifyRegistration(challenge, &response, false)
+	assert.Check(t, err == nil)
+	return credential
+}
+
+// Asserts the credential of an authenticator
+func assertion(t *testing.T, authenticator *mocks.Authenticator, challenge []byte) *AssertionResponse {
+	t.Helper()
+
+	var response AssertionResponse
+	assert.Check(t, json.Unmarshal([]byte(authenticator.Get(challenge)), &response) == nil)
+	return &response
+}
+
+func TestRegistration(t *testing.T) {
+	for _, format := range []string{"none", "packed"} {
+		authenticator := mocks.NewAuthenticator("localhost", "http://localhost:4000")
+		authenticator.Format = format
+
+		credential := register(t, authenticator)
+		assert.Check(t, bytes.Equal(credential.ID, authenticator.CredentialID))
+		assert.Equal(t, credential.Format, format)
+		assert.Equal(t, credential.SignCount, uint32(0))
+		assert.Check(t, credential.UserVerified)
+
+		key, err := parsePublicKey(credential.PublicKey)
+		assert.Check(t, err == nil)
+		assert.Equal(t, key.alg, int64(AlgES256))
+	}
+
+	// The challenge and origin must match
+	authenticator := mocks.NewAuthenticator("localhost", "http://localhost:4000")
+	challenge, _ := NewChallenge()
+	var response AttestationResponse
+	assert.Check(t, json.Unmarshal([]byte(authenticator.Create(challenge, []byte{1})), &response) == nil)
+
+	clientChallenge, err := Challenge(response.Response.ClientDataJSON)
+	assert.Check(t, err == nil)
+	assert.Check(t, bytes.Equal(clientChallenge, challenge))
+
+	other, _ := NewChallenge()
+	_, err = rp.VerifyRegistration(other, &response, false)
+	assert.Is(t, err, ErrChallenge)
+
+	phishing := &RelyingParty{ID: "localhost", Origins: []string{"https://example.com"}}
+	_, err = phishing.VerifyRegistration(challenge, &response, false)
+	assert.Is(t, err, ErrOrigin)
+
+	// As well as the relying party
+	authenticator.RPID = "example.com"
+	assert.Check(t, json.Unmarshal([]byte(authenticator.Create(challenge, []byte{1})), &response) == nil)
+	_, err = rp.VerifyRegistration(challenge, &response, false)
+	assert.Is(t, err, ErrRelyingParty)
+
+	// User verification may be required
+	authenticator.RPID, authenticator.UserVerified = "localhost", false
+	assert.Check(t, json.Unmarshal([]byte(authenticator.Create(challenge, []byte{1})), &response) == nil)
+	_, err = rp.VerifyRegistration(challenge, &response, true)
+	assert.Is(t, err, ErrUserNotVerified)
+
+	// Only verified formats are accepted
+	authenticator.Format = "fido-u2f"
+	assert.Check(t, json.Unmarshal([]byte(authenticator.Create(challenge, []byte{1})), &response) == nil)
+	_, err = rp.VerifyRegistration(challenge, &response, false)
+	assert.Is(t, err, ErrUnsupportedAttestation)
+}
+
+func TestAssertion(t *testing.T) {
+	authenticator := mocks.NewAuthenticator("localhost", "http://localhost:4000")
+	credential := register(t, authenticator)
+
+	challenge, _ := NewChallenge()
+	response := assertion(t, authenticator, challenge)
+	assert.Check(t, bytes.Equal(response.RawID, credential.ID))
+	assert.Check(t, bytes.Equal(response.Response.UserHandle, []byte{1}))
+
+	signCount, err := rp.VerifyAssertion(challenge, credential.PublicKey, credential.SignCount, response, true)
+	assert.Check(t, err == nil)
+	assert.Equal(t, signCount, uint32(1))
+
+	// A sign count that did not increase reveals a cloned authenticator
+	_, err = rp.VerifyAssertion(challenge, credential.PublicKey, signCount, response, true)
+	assert.Is(t, err, ErrSignCount)
+
+	// Unless the authenticator has no counter
+	authenticator.SignCount = ^uint32(0)
+	response = assertion(t, authenticator, challenge)
+	signCount, err = rp.VerifyAssertion(challenge, credential.PublicKey, 0, response, true)
+	assert.Check(t, err == nil)
+	assert.Equal(t, signCount, uint32(0))
+
+	// Tampered data is rejected
+	response = assertion(t, authenticator, challenge)
+	response.Response.Signature[len(response.Response.Signature)-1] ^= 1
+	_, err = rp.VerifyAssertion(challenge, credential.PublicKey, 0, response, true)
+	assert.Is(t, err, ErrInvalidSignature)
+
+	// Registrations are not assertions
+	var registration AttestationResponse
+	assert.Check(t, json.Unmarshal([]byte(authenticator.Create(challenge, []byte{1})), &registration) == nil)
+	response.Response.ClientDataJSON = registration.Response.ClientDataJSON
+	_, err = rp.VerifyAssertion(challenge, credential.PublicKey, 0, response, true)
+	assert.Is(t, err, ErrMalformed)
+
+	// Security keys used as a second factor may not verify their user
+	authenticator.UserVerified = false
+	response = assertion(t, authenticator, challenge)
+	_, err = rp.VerifyAssertion(challenge, credential.PublicKey, 0, response, true)
+	assert.Is(t, err, ErrUserNotVerified)
+	_, err = rp.VerifyAssertion(challenge, credential.PublicKey, 0, response, false)
+	assert.Check(t, err == nil)
+}
+
+func TestBytes(t *testing.T) {
+	var decoded Bytes
+	for _, encoded := range []string{`"-_8"`, `"+/8="`} {
+		assert.Check(t, json.Unmarshal([]byte(encoded), &decoded) == nil)
+		assert.Check(t, bytes.Equal(decoded, []byte{0xfb, 0xff}))
+	}
+
+	encoded, err := json.Marshal(Bytes{0xfb, 0xff})
+	assert.Check(t, err == nil)
+	assert.Equal(t, string(encoded), `"-_8"`)
+}
+
+func TestCBOR(t *testing.T) {
+	// {1: 2, "a": [h'ff', -1, true, null]}
+	data := []byte{0xa2, 0x01, 0x02, 0x61, 'a', 0x84, 0x41, 0xff, 0x20, 0xf5, 0xf6, 0x00}
+	item, rest, err := decodeCBOR(data)
+	assert.Check(t, err == nil)
+	assert.Check(t, bytes.Equal(rest, []byte{0x00}))
+
+	fields := item.(map[any]any)
+	assert.Equal(t, fields[int64(1)], any(int64(2)))
+	list := fields["a"].([]any)
+	assert.Check(t, bytes.Equal(list[0].([]byte), []byte{0xff}))
+	assert.Equal(t, list[1], any(int64(-1)))
+	assert.Equal(t, list[2], any(true))
+	assert.Equal(t, list[3], nil)
+
+	malformed := [][]byte{
+		{},                             // Empty
+		{0x42, 0x01},                   // Truncated byte string
+		{0x5f},                         // Indefinite length
+		{0xa2, 0x01, 0x02},             // Truncated map
+		{0xa2, 0x01, 0x02, 0x01, 0x03}, // Duplicate key
+		{0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, // Huge array
+	}
+	for _, data := range malformed {
+		_, _, err := decodeCBOR(data)
+		assert.Check(t, errors.Is(err, errCBOR))
+	}
+}
@@ -24,16 +24,20 @@ var (
 	ErrForeignKeyViolation = errors.New("foreign_key_violation")
 	ErrNotFound            = errors.New("not_found")
 	ErrNullViolation       = errors.New("null_violation")
+	ErrSerialization       = errors.New("serialization_failure")
 	ErrUniqueViolation     = errors.New("unique_violation")
 )
 
 // Abstract errors from the api into easy-to-check types
 var (
-	ErrBadRequest       = errors.New("bad_request")
-	ErrEntityTooLarge   = errors.New("entity_too_large")
-	ErrFailedValidation = errors.New("failed_validation")
-	ErrUnauthenticated  = errors.New("unauthenticated")
-	ErrUnauthorized     = errors.New("unauthorized")
+	ErrBadRequest         = errors.New("bad_request")
+	ErrEditConflict       = errors.New("edit_conflict")
+	ErrEntityTooLarge     = errors.New("entity_too_large")
+	ErrFailedValidation   = errors.New("failed_validation")
+	ErrPreconditionFailed = errors.New("precondition_failed")
+	ErrTooManyRequests    = errors.New("too_many_requests")
+	ErrUnauthenticated    = errors.New("unauthenticated")
+	ErrUnauthorized       = errors.New("unauthorized")
 )
 
 // Abstracts unknown errors
@@ -162,6 +166,14 @@ func DatabaseError(err error, op string) *AppError {
 				fmt.Errorf("%w: %v", ErrCheckViolation, err),
 			)
 
+		case "40001":
+			return ClientError(
+				http.StatusConflict,
+				"The resource was changed by another request, try again",
+				op,
+				fmt.Errorf("%w: %v", ErrSerialization, err),
+			)
+
 		case "40P01":
 			return ServerError(
 				op,
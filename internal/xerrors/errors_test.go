@@ -49,6 +49,12 @@ func TestDatabaseError(t *testing.T) {
 			wantStatus: http.StatusBadRequest,
 			wantError:  ErrCheckViolation,
 		},
+		{
+			name:       "SerializationFailure",
+			error:      &pq.Error{Code: "40001"},
+			wantStatus: http.StatusConflict,
+			wantError:  ErrSerialization,
+		},
 		{
 			name:       "DeadlockDetected",
 			error:      &pq.Error{Code: "40P01"},
@@ -0,0 +1,6 @@
+BEGIN;
+
+-- Drop the secret_versions table
+DROP TABLE IF EXISTS secret_versions;
+
+COMMIT;
@@ -0,0 +1,14 @@
+BEGIN;
+
+-- Create the secret_versions table to keep previous values of a secret
+CREATE TABLE IF NOT EXISTS secret_versions (
+    secret_id bigint NOT NULL REFERENCES secrets(id) ON DELETE CASCADE,
+    version integer NOT NULL CHECK (version > 0),
+    name text NOT NULL,
+    encrypted_data bytea NOT NULL,
+    iv bytea NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (secret_id, version)
+);
+
+COMMIT;
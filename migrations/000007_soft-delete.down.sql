@@ -0,0 +1,26 @@
+BEGIN;
+
+-- Drop the indexes
+DROP INDEX IF EXISTS secrets_deleted_at_idx;
+DROP INDEX IF EXISTS groups_deleted_at_idx;
+DROP INDEX IF EXISTS groups_name_active_idx;
+
+-- Permanently remove anything still in the trash and restore the unique group
+-- name constraint, only if the up migration was applied
+DO $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_name = 'groups' AND column_name = 'deleted_at'
+    ) THEN
+        DELETE FROM secrets WHERE deleted_at IS NOT NULL;
+        DELETE FROM groups WHERE deleted_at IS NOT NULL;
+        ALTER TABLE groups ADD CONSTRAINT groups_name_key UNIQUE (name);
+    END IF;
+END $$;
+
+-- Drop the columns
+ALTER TABLE IF EXISTS secrets DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE IF EXISTS groups DROP COLUMN IF EXISTS deleted_at;
+
+COMMIT;
@@ -0,0 +1,15 @@
+BEGIN;
+
+-- Deleted secrets and groups are kept in the trash until purged
+ALTER TABLE secrets ADD COLUMN deleted_at timestamp with time zone;
+ALTER TABLE groups ADD COLUMN deleted_at timestamp with time zone;
+
+-- Group names only need to be unique among groups that are not deleted
+ALTER TABLE groups DROP CONSTRAINT IF EXISTS groups_name_key;
+CREATE UNIQUE INDEX IF NOT EXISTS groups_name_active_idx ON groups (name) WHERE deleted_at IS NULL;
+
+-- Speed up finding expired items to purge
+CREATE INDEX IF NOT EXISTS secrets_deleted_at_idx ON secrets (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS groups_deleted_at_idx ON groups (deleted_at) WHERE deleted_at IS NOT NULL;
+
+COMMIT;
@@ -0,0 +1,14 @@
+BEGIN;
+
+-- Drop the shared folder tables
+DROP TABLE IF EXISTS shared_folders_user;
+DROP TABLE IF EXISTS shared_folders_group;
+
+-- Drop the folder column from secrets
+DROP INDEX IF EXISTS secrets_folder_id_idx;
+ALTER TABLE IF EXISTS secrets DROP COLUMN IF EXISTS folder_id;
+
+-- Drop the folders table
+DROP TABLE IF EXISTS folders;
+
+COMMIT;
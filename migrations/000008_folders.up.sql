@@ -0,0 +1,41 @@
+BEGIN;
+
+-- Create the folders table for organizing secrets hierarchically
+CREATE TABLE IF NOT EXISTS folders (
+    id bigserial PRIMARY KEY,
+    name text NOT NULL CHECK (name <> ''),
+    owner_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    parent_id bigint REFERENCES folders(id) ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp with time zone NOT NULL DEFAULT NOW(),
+    CHECK (parent_id <> id)
+);
+
+-- Folder names are unique within their parent
+CREATE UNIQUE INDEX IF NOT EXISTS folders_parent_name_idx ON folders (owner_id, COALESCE(parent_id, 0), name);
+
+-- Secrets belong to at most one folder, NULL is the root
+ALTER TABLE secrets ADD COLUMN folder_id bigint REFERENCES folders(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS secrets_folder_id_idx ON secrets (folder_id);
+
+-- Create the shared_folders_user table
+CREATE TABLE IF NOT EXISTS shared_folders_user (
+    folder_id bigint NOT NULL REFERENCES folders(id) ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    permission text NOT NULL CHECK (permission IN ('read-only', 'read-write')),
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (folder_id, user_id)
+);
+
+-- Create the shared_folders_group table
+CREATE TABLE IF NOT EXISTS shared_folders_group (
+    folder_id bigint NOT NULL REFERENCES folders(id) ON DELETE CASCADE,
+    group_id bigint NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    permission text NOT NULL CHECK (permission IN ('read-only', 'read-write')),
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (folder_id, group_id)
+);
+
+COMMIT;
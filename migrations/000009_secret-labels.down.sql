@@ -0,0 +1,10 @@
+BEGIN;
+
+DROP INDEX IF EXISTS secrets_owner_name_idx;
+DROP INDEX IF EXISTS secrets_metadata_idx;
+DROP INDEX IF EXISTS secrets_tags_idx;
+
+ALTER TABLE IF EXISTS secrets DROP COLUMN IF EXISTS metadata;
+ALTER TABLE IF EXISTS secrets DROP COLUMN IF EXISTS tags;
+
+COMMIT;
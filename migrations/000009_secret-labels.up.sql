@@ -0,0 +1,11 @@
+BEGIN;
+
+-- Plaintext tags and key/value metadata used to organise and search secrets
+ALTER TABLE secrets ADD COLUMN IF NOT EXISTS tags text[] NOT NULL DEFAULT '{}';
+ALTER TABLE secrets ADD COLUMN IF NOT EXISTS metadata jsonb NOT NULL DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS secrets_tags_idx ON secrets USING GIN (tags);
+CREATE INDEX IF NOT EXISTS secrets_metadata_idx ON secrets USING GIN (metadata);
+CREATE INDEX IF NOT EXISTS secrets_owner_name_idx ON secrets (owner_id, lower(name));
+
+COMMIT;
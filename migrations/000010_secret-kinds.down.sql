@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP INDEX IF EXISTS secrets_owner_kind_idx;
+ALTER TABLE IF EXISTS secrets DROP COLUMN IF EXISTS kind;
+
+COMMIT;
@@ -0,0 +1,9 @@
+BEGIN;
+
+-- The kind of credential stored in a secret, existing secrets become notes
+ALTER TABLE secrets ADD COLUMN IF NOT EXISTS kind text NOT NULL DEFAULT 'note'
+    CHECK (kind IN ('login', 'api_key', 'ssh_key', 'database', 'tls_certificate', 'note', 'env_file'));
+
+CREATE INDEX IF NOT EXISTS secrets_owner_kind_idx ON secrets (owner_id, kind);
+
+COMMIT;
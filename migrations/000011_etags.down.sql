@@ -0,0 +1,6 @@
+BEGIN;
+
+ALTER TABLE IF EXISTS groups DROP COLUMN IF EXISTS version;
+ALTER TABLE IF EXISTS secrets DROP COLUMN IF EXISTS version;
+
+COMMIT;
@@ -0,0 +1,7 @@
+BEGIN;
+
+-- Bumped on every change to a secret or group, exposed to clients as an ETag
+ALTER TABLE secrets ADD COLUMN IF NOT EXISTS version integer NOT NULL DEFAULT 0;
+ALTER TABLE groups ADD COLUMN IF NOT EXISTS version integer NOT NULL DEFAULT 0;
+
+COMMIT;
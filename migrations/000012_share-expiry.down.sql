@@ -0,0 +1,9 @@
+BEGIN;
+
+DROP INDEX IF EXISTS shared_secrets_group_expires_at_idx;
+DROP INDEX IF EXISTS shared_secrets_user_expires_at_idx;
+
+ALTER TABLE IF EXISTS shared_secrets_group DROP COLUMN IF EXISTS expires_at;
+ALTER TABLE IF EXISTS shared_secrets_user DROP COLUMN IF EXISTS expires_at;
+
+COMMIT;
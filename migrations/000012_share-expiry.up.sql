@@ -0,0 +1,10 @@
+BEGIN;
+
+-- Shares stop granting access once they expire and are removed by a sweeper
+ALTER TABLE shared_secrets_user ADD COLUMN IF NOT EXISTS expires_at timestamp with time zone;
+ALTER TABLE shared_secrets_group ADD COLUMN IF NOT EXISTS expires_at timestamp with time zone;
+
+CREATE INDEX IF NOT EXISTS shared_secrets_user_expires_at_idx ON shared_secrets_user (expires_at) WHERE expires_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS shared_secrets_group_expires_at_idx ON shared_secrets_group (expires_at) WHERE expires_at IS NOT NULL;
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+
+-- Drop the secret_links table
+DROP TABLE IF EXISTS secret_links;
+
+COMMIT;
@@ -0,0 +1,20 @@
+BEGIN;
+
+-- One-time links hand a client encrypted payload to people without an account.
+-- Only the hash of the link token is stored, the decryption key never reaches
+-- the server.
+CREATE TABLE IF NOT EXISTS secret_links (
+    id bigserial PRIMARY KEY,
+    hash bytea NOT NULL UNIQUE,
+    creator_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    encrypted_data bytea NOT NULL,
+    iv bytea NOT NULL,
+    max_views integer NOT NULL CHECK (max_views > 0),
+    views integer NOT NULL DEFAULT 0 CHECK (views >= 0),
+    expires_at timestamp(0) with time zone NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS secret_links_expires_at_idx ON secret_links (expires_at);
+
+COMMIT;
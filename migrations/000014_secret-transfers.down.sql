@@ -0,0 +1,6 @@
+BEGIN;
+
+-- Drop the secret_transfers table
+DROP TABLE IF EXISTS secret_transfers;
+
+COMMIT;
@@ -0,0 +1,16 @@
+BEGIN;
+
+-- A secret has at most one pending ownership transfer, proposed by its owner
+-- and waiting for the recipient to accept it
+CREATE TABLE IF NOT EXISTS secret_transfers (
+    secret_id bigint PRIMARY KEY REFERENCES secrets(id) ON DELETE CASCADE,
+    from_user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    to_user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    CHECK (from_user_id <> to_user_id)
+);
+
+CREATE INDEX IF NOT EXISTS secret_transfers_to_user_id_idx ON secret_transfers (to_user_id);
+CREATE INDEX IF NOT EXISTS secret_transfers_from_user_id_idx ON secret_transfers (from_user_id);
+
+COMMIT;
@@ -0,0 +1,10 @@
+BEGIN;
+
+-- Drop the wrapped keys and public keys
+ALTER TABLE secrets DROP COLUMN IF EXISTS rekey_required;
+DROP TABLE IF EXISTS shared_secrets_group_keys;
+ALTER TABLE shared_secrets_user DROP COLUMN IF EXISTS wrapped_key;
+ALTER TABLE secrets DROP COLUMN IF EXISTS wrapped_key;
+DROP TABLE IF EXISTS user_keys;
+
+COMMIT;
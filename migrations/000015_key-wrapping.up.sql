@@ -0,0 +1,27 @@
+BEGIN;
+
+-- Public keys users register to receive shared secrets
+CREATE TABLE IF NOT EXISTS user_keys (
+    user_id bigint PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    public_key text NOT NULL CHECK (public_key <> ''),
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp with time zone NOT NULL DEFAULT NOW()
+);
+
+-- The content key of a secret wrapped for its owner and for each recipient
+ALTER TABLE secrets ADD COLUMN IF NOT EXISTS wrapped_key text;
+ALTER TABLE shared_secrets_user ADD COLUMN IF NOT EXISTS wrapped_key text;
+
+CREATE TABLE IF NOT EXISTS shared_secrets_group_keys (
+    secret_id bigint NOT NULL,
+    group_id bigint NOT NULL,
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    wrapped_key text NOT NULL,
+    PRIMARY KEY (secret_id, group_id, user_id),
+    FOREIGN KEY (secret_id, group_id) REFERENCES shared_secrets_group (secret_id, group_id) ON DELETE CASCADE
+);
+
+-- Set when a recipient loses access, until the owner replaces the content key
+ALTER TABLE secrets ADD COLUMN IF NOT EXISTS rekey_required boolean NOT NULL DEFAULT false;
+
+COMMIT;
@@ -0,0 +1,18 @@
+BEGIN;
+
+-- Drop the key history, keeping the active key of each user
+ALTER TABLE shared_secrets_group_keys DROP COLUMN IF EXISTS key_fingerprint;
+ALTER TABLE shared_secrets_user DROP COLUMN IF EXISTS key_fingerprint;
+ALTER TABLE secrets DROP COLUMN IF EXISTS key_fingerprint;
+
+DELETE FROM user_keys WHERE status <> 'active';
+DROP INDEX IF EXISTS user_keys_active_idx;
+DROP INDEX IF EXISTS user_keys_user_id_version_idx;
+ALTER TABLE user_keys DROP COLUMN IF EXISTS status;
+ALTER TABLE user_keys DROP COLUMN IF EXISTS fingerprint;
+ALTER TABLE user_keys DROP COLUMN IF EXISTS encrypted_private_key;
+ALTER TABLE user_keys DROP COLUMN IF EXISTS version;
+ALTER TABLE user_keys DROP COLUMN IF EXISTS id;
+ALTER TABLE user_keys ADD PRIMARY KEY (user_id);
+
+COMMIT;
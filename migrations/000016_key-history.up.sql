@@ -0,0 +1,32 @@
+BEGIN;
+
+-- Keeps every key a user registered. The current key is 'active', keys
+-- replaced by a rotation are 'retired' and stay usable to unwrap older content
+-- keys, 'revoked' keys are known to be compromised.
+ALTER TABLE user_keys DROP CONSTRAINT IF EXISTS user_keys_pkey;
+ALTER TABLE user_keys ADD COLUMN IF NOT EXISTS id bigserial PRIMARY KEY;
+ALTER TABLE user_keys ADD COLUMN IF NOT EXISTS version integer NOT NULL DEFAULT 1;
+ALTER TABLE user_keys ADD COLUMN IF NOT EXISTS encrypted_private_key text;
+ALTER TABLE user_keys ADD COLUMN IF NOT EXISTS fingerprint text;
+ALTER TABLE user_keys ADD COLUMN IF NOT EXISTS status text NOT NULL DEFAULT 'active'
+    CHECK (status IN ('active', 'retired', 'revoked'));
+
+UPDATE user_keys SET fingerprint = 'SHA256:' || rtrim(encode(sha256(convert_to(public_key, 'UTF8')), 'base64'), '=');
+ALTER TABLE user_keys ALTER COLUMN fingerprint SET NOT NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS user_keys_user_id_version_idx ON user_keys (user_id, version);
+CREATE UNIQUE INDEX IF NOT EXISTS user_keys_active_idx ON user_keys (user_id) WHERE status = 'active';
+
+-- The fingerprint of the public key each content key was wrapped with
+ALTER TABLE secrets ADD COLUMN IF NOT EXISTS key_fingerprint text;
+ALTER TABLE shared_secrets_user ADD COLUMN IF NOT EXISTS key_fingerprint text;
+ALTER TABLE shared_secrets_group_keys ADD COLUMN IF NOT EXISTS key_fingerprint text;
+
+UPDATE secrets s SET key_fingerprint = k.fingerprint
+FROM user_keys k WHERE k.user_id = s.owner_id AND s.wrapped_key IS NOT NULL;
+UPDATE shared_secrets_user ssu SET key_fingerprint = k.fingerprint
+FROM user_keys k WHERE k.user_id = ssu.user_id AND ssu.wrapped_key IS NOT NULL;
+UPDATE shared_secrets_group_keys gk SET key_fingerprint = k.fingerprint
+FROM user_keys k WHERE k.user_id = gk.user_id;
+
+COMMIT;
@@ -0,0 +1,15 @@
+BEGIN;
+
+-- Drop the cipher of secrets and the KDF parameters of users
+ALTER TABLE secret_versions DROP COLUMN IF EXISTS cipher_version;
+ALTER TABLE secret_versions DROP COLUMN IF EXISTS cipher;
+ALTER TABLE secrets DROP COLUMN IF EXISTS cipher_version;
+ALTER TABLE secrets DROP COLUMN IF EXISTS cipher;
+
+ALTER TABLE users DROP COLUMN IF EXISTS kdf_parallelism;
+ALTER TABLE users DROP COLUMN IF EXISTS kdf_memory;
+ALTER TABLE users DROP COLUMN IF EXISTS kdf_iterations;
+ALTER TABLE users DROP COLUMN IF EXISTS kdf_salt;
+ALTER TABLE users DROP COLUMN IF EXISTS kdf_algorithm;
+
+COMMIT;
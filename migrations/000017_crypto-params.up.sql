@@ -0,0 +1,18 @@
+BEGIN;
+
+-- Parameters clients derive keys from the master password with, NULL for
+-- accounts registered before they were stored
+ALTER TABLE users ADD COLUMN IF NOT EXISTS kdf_algorithm text CHECK (kdf_algorithm IN ('pbkdf2-sha256', 'argon2id'));
+ALTER TABLE users ADD COLUMN IF NOT EXISTS kdf_salt text;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS kdf_iterations integer CHECK (kdf_iterations > 0);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS kdf_memory integer CHECK (kdf_memory > 0);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS kdf_parallelism integer CHECK (kdf_parallelism > 0);
+
+-- The algorithm and format each secret, and each of its versions, is
+-- encrypted with
+ALTER TABLE secrets ADD COLUMN IF NOT EXISTS cipher text NOT NULL DEFAULT 'aes-256-gcm';
+ALTER TABLE secrets ADD COLUMN IF NOT EXISTS cipher_version integer NOT NULL DEFAULT 1 CHECK (cipher_version > 0);
+ALTER TABLE secret_versions ADD COLUMN IF NOT EXISTS cipher text NOT NULL DEFAULT 'aes-256-gcm';
+ALTER TABLE secret_versions ADD COLUMN IF NOT EXISTS cipher_version integer NOT NULL DEFAULT 1 CHECK (cipher_version > 0);
+
+COMMIT;
@@ -0,0 +1,13 @@
+BEGIN;
+
+-- Drop the data keys of secrets. Rows encrypted at rest can no longer be
+-- decrypted afterwards.
+DROP INDEX IF EXISTS secret_versions_master_key_id_idx;
+DROP INDEX IF EXISTS secrets_master_key_id_idx;
+
+ALTER TABLE secret_versions DROP COLUMN IF EXISTS master_key_id;
+ALTER TABLE secret_versions DROP COLUMN IF EXISTS data_key;
+ALTER TABLE secrets DROP COLUMN IF EXISTS master_key_id;
+ALTER TABLE secrets DROP COLUMN IF EXISTS data_key;
+
+COMMIT;
@@ -0,0 +1,16 @@
+BEGIN;
+
+-- Data key the encrypted data and IV of each secret, and each of its
+-- versions, are encrypted with at rest, wrapped by the master key of the given
+-- ID. NULL for rows stored before, which are left as given by the client until
+-- the master key is rotated.
+ALTER TABLE secrets ADD COLUMN IF NOT EXISTS data_key bytea;
+ALTER TABLE secrets ADD COLUMN IF NOT EXISTS master_key_id text;
+ALTER TABLE secret_versions ADD COLUMN IF NOT EXISTS data_key bytea;
+ALTER TABLE secret_versions ADD COLUMN IF NOT EXISTS master_key_id text;
+
+-- Rotation looks for rows wrapped by other master keys
+CREATE INDEX IF NOT EXISTS secrets_master_key_id_idx ON secrets (master_key_id);
+CREATE INDEX IF NOT EXISTS secret_versions_master_key_id_idx ON secret_versions (master_key_id);
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+
+-- Drop the emergency contacts
+DROP TABLE IF EXISTS emergency_contacts;
+
+COMMIT;
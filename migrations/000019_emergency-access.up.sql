@@ -0,0 +1,33 @@
+BEGIN;
+
+-- Trusted contacts a grantor nominates to recover their vault. The grantor's
+-- private key is wrapped with the public key of the contact, and only handed
+-- out once access is granted: a request moves the contact from 'idle' to
+-- 'requested' until grants_at, unless the grantor vetoes it with the token
+-- emailed to them, then to 'granted'.
+CREATE TABLE IF NOT EXISTS emergency_contacts (
+    id bigserial PRIMARY KEY,
+    grantor_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    grantee_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    access text NOT NULL CHECK (access IN ('view', 'takeover')),
+    wait_days integer NOT NULL CHECK (wait_days BETWEEN 1 AND 90),
+    wrapped_key text NOT NULL CHECK (wrapped_key <> ''),
+    key_fingerprint text NOT NULL,
+    status text NOT NULL DEFAULT 'idle' CHECK (status IN ('idle', 'requested', 'granted')),
+    veto_hash bytea,
+    requested_at timestamp with time zone,
+    grants_at timestamp with time zone,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    UNIQUE (grantor_id, grantee_id),
+    CHECK (grantor_id <> grantee_id)
+);
+
+CREATE INDEX IF NOT EXISTS emergency_contacts_grantee_id_idx ON emergency_contacts (grantee_id);
+CREATE UNIQUE INDEX IF NOT EXISTS emergency_contacts_veto_hash_idx ON emergency_contacts (veto_hash);
+
+-- The background job looks for requests whose waiting period is over
+CREATE INDEX IF NOT EXISTS emergency_contacts_grants_at_idx ON emergency_contacts (grants_at)
+    WHERE status = 'requested';
+
+COMMIT;
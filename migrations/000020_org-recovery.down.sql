@@ -0,0 +1,9 @@
+BEGIN;
+
+DROP TABLE IF EXISTS recovery_audit;
+DROP TABLE IF EXISTS recovery_ceremonies;
+DROP TABLE IF EXISTS recovery_escrows;
+DROP TABLE IF EXISTS recovery_shareholders;
+DROP TABLE IF EXISTS recovery_keys;
+
+COMMIT;
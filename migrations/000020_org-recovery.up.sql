@@ -0,0 +1,75 @@
+BEGIN;
+
+-- The organization recovery key, an X25519 key pair. Only the public key is
+-- stored: the private key is split with Shamir's Secret Sharing among admins
+-- and only rebuilt in memory during a recovery ceremony.
+CREATE TABLE IF NOT EXISTS recovery_keys (
+    id bigserial PRIMARY KEY,
+    public_key bytea NOT NULL,
+    threshold integer NOT NULL CHECK (threshold >= 2),
+    shares integer NOT NULL CHECK (shares >= threshold AND shares <= 255),
+    status text NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'retired')),
+    created_by bigint REFERENCES users(id) ON DELETE SET NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS recovery_keys_active_idx ON recovery_keys ((true))
+    WHERE status = 'active';
+
+-- The admins holding a share of a recovery key. Each share waits, encrypted
+-- at rest, until its admin collects it once.
+CREATE TABLE IF NOT EXISTS recovery_shareholders (
+    key_id bigint NOT NULL REFERENCES recovery_keys(id) ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    share_index integer NOT NULL CHECK (share_index BETWEEN 1 AND 255),
+    pending_share bytea,
+    data_key bytea,
+    master_key_id text,
+    collected_at timestamp(0) with time zone,
+    PRIMARY KEY (key_id, user_id),
+    UNIQUE (key_id, share_index)
+);
+
+CREATE INDEX IF NOT EXISTS recovery_shareholders_user_id_idx ON recovery_shareholders (user_id);
+
+-- The content key of a secret shared with a group, sealed to a recovery key
+CREATE TABLE IF NOT EXISTS recovery_escrows (
+    secret_id bigint NOT NULL,
+    group_id bigint NOT NULL,
+    key_id bigint NOT NULL REFERENCES recovery_keys(id) ON DELETE CASCADE,
+    sealed_key bytea NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (secret_id, group_id),
+    FOREIGN KEY (secret_id, group_id) REFERENCES shared_secrets_group (secret_id, group_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS recovery_escrows_group_id_idx ON recovery_escrows (group_id, key_id);
+
+-- Recoveries of a group vault, handing the group to a new creator. Shares
+-- submitted by admins are never stored.
+CREATE TABLE IF NOT EXISTS recovery_ceremonies (
+    id bigserial PRIMARY KEY,
+    key_id bigint NOT NULL REFERENCES recovery_keys(id) ON DELETE CASCADE,
+    group_id bigint NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    new_creator_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    opened_by bigint REFERENCES users(id) ON DELETE SET NULL,
+    status text NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'completed', 'aborted')),
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    closed_at timestamp(0) with time zone
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS recovery_ceremonies_open_idx ON recovery_ceremonies (group_id)
+    WHERE status = 'open';
+
+-- Append-only log of every step of the recovery key lifecycle
+CREATE TABLE IF NOT EXISTS recovery_audit (
+    id bigserial PRIMARY KEY,
+    key_id bigint REFERENCES recovery_keys(id) ON DELETE SET NULL,
+    ceremony_id bigint REFERENCES recovery_ceremonies(id) ON DELETE SET NULL,
+    actor_id bigint REFERENCES users(id) ON DELETE SET NULL,
+    event text NOT NULL,
+    details jsonb NOT NULL DEFAULT '{}',
+    created_at timestamp with time zone NOT NULL DEFAULT NOW()
+);
+
+COMMIT;
@@ -0,0 +1,10 @@
+BEGIN;
+
+-- Drop the two-factor requirement of groups
+ALTER TABLE groups DROP COLUMN IF EXISTS require_2fa;
+
+-- Drop the TOTP secrets and recovery codes
+DROP TABLE IF EXISTS totp_recovery_codes;
+DROP TABLE IF EXISTS user_totp;
+
+COMMIT;
@@ -0,0 +1,30 @@
+BEGIN;
+
+-- TOTP secret of a user, encrypted at rest with a data key wrapped by the
+-- master key of the given ID. The secret is enrolled unconfirmed and only
+-- required at login once the user confirmed a first code. last_step is the
+-- step of the last code accepted, so codes cannot be replayed.
+CREATE TABLE IF NOT EXISTS user_totp (
+    user_id bigint PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    secret bytea NOT NULL,
+    data_key bytea NOT NULL,
+    master_key_id text NOT NULL,
+    last_step bigint NOT NULL DEFAULT 0,
+    confirmed_at timestamp(0) with time zone,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+-- Single use recovery codes of a user, stored hashed, to log in without
+-- their authenticator
+CREATE TABLE IF NOT EXISTS totp_recovery_codes (
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    hash bytea NOT NULL,
+    used_at timestamp(0) with time zone,
+    PRIMARY KEY (user_id, hash)
+);
+
+-- Members of groups requiring two-factor authentication must enroll before
+-- they can log in
+ALTER TABLE groups ADD COLUMN IF NOT EXISTS require_2fa bool NOT NULL DEFAULT false;
+
+COMMIT;
@@ -0,0 +1,7 @@
+BEGIN;
+
+-- Drop the WebAuthn challenges and credentials
+DROP TABLE IF EXISTS webauthn_challenges;
+DROP TABLE IF EXISTS webauthn_credentials;
+
+COMMIT;
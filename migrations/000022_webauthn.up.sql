@@ -0,0 +1,32 @@
+BEGIN;
+
+-- WebAuthn credentials of a user, passkeys or security keys. The public key
+-- is the COSE key registered by the authenticator, and sign_count the
+-- signature counter it last reported, 0 if it has none. Assertions with a
+-- counter that did not increase reveal a cloned authenticator.
+CREATE TABLE IF NOT EXISTS webauthn_credentials (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    credential_id bytea UNIQUE NOT NULL,
+    public_key bytea NOT NULL,
+    sign_count bigint NOT NULL DEFAULT 0 CHECK (sign_count >= 0),
+    attestation_format text NOT NULL,
+    aaguid bytea,
+    name text NOT NULL CHECK (name <> ''),
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    last_used_at timestamp(0) with time zone
+);
+
+CREATE INDEX IF NOT EXISTS webauthn_credentials_user_id_idx ON webauthn_credentials (user_id);
+
+-- Challenges handed out for a registration, a passkey login or a security key
+-- used as a second factor, each used once. Passkey logins are not bound to a
+-- user, the credential asserted identifies them.
+CREATE TABLE IF NOT EXISTS webauthn_challenges (
+    challenge bytea PRIMARY KEY,
+    user_id bigint REFERENCES users(id) ON DELETE CASCADE,
+    ceremony text NOT NULL CHECK (ceremony IN ('register', 'login', 'second-factor')),
+    expiry timestamp with time zone NOT NULL
+);
+
+COMMIT;
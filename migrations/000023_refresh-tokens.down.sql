@@ -0,0 +1,11 @@
+BEGIN;
+
+-- Drop the token families along with their refresh tokens
+DELETE FROM tokens WHERE scope = 'refresh';
+DROP INDEX IF EXISTS tokens_family_id_idx;
+ALTER TABLE tokens
+    DROP COLUMN IF EXISTS used_at,
+    DROP COLUMN IF EXISTS family_id;
+DROP TABLE IF EXISTS token_families;
+
+COMMIT;
@@ -0,0 +1,22 @@
+BEGIN;
+
+-- Families of the access and refresh tokens handed out since a login. Each
+-- refresh rotates the refresh token of its family, and deleting the family
+-- revokes every token in it.
+CREATE TABLE IF NOT EXISTS token_families (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at timestamp with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS token_families_user_id_idx ON token_families (user_id);
+
+-- Tokens handed out before families existed have none. Refresh tokens are
+-- kept once used, so using one again reveals it was stolen.
+ALTER TABLE tokens
+    ADD COLUMN IF NOT EXISTS family_id bigint REFERENCES token_families(id) ON DELETE CASCADE,
+    ADD COLUMN IF NOT EXISTS used_at timestamp with time zone;
+
+CREATE INDEX IF NOT EXISTS tokens_family_id_idx ON tokens (family_id);
+
+COMMIT;
@@ -0,0 +1,10 @@
+BEGIN;
+
+-- Drop the client of sessions
+ALTER TABLE token_families
+    DROP COLUMN IF EXISTS last_used_at,
+    DROP COLUMN IF EXISTS ip,
+    DROP COLUMN IF EXISTS user_agent,
+    DROP COLUMN IF EXISTS device;
+
+COMMIT;
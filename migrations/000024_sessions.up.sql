@@ -0,0 +1,12 @@
+BEGIN;
+
+-- Each token family is a session, a login on a device. It outlives the
+-- access and refresh tokens rotated within it, so it records the client they
+-- were last used from.
+ALTER TABLE token_families
+    ADD COLUMN IF NOT EXISTS device text,
+    ADD COLUMN IF NOT EXISTS user_agent text,
+    ADD COLUMN IF NOT EXISTS ip text,
+    ADD COLUMN IF NOT EXISTS last_used_at timestamp with time zone NOT NULL DEFAULT NOW();
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP INDEX IF EXISTS access_tokens_user_id_idx;
+DROP TABLE IF EXISTS access_tokens;
+
+COMMIT;
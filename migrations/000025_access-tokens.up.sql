@@ -0,0 +1,22 @@
+BEGIN;
+
+-- Personal access tokens, for scripts and CI to act as a user within the
+-- scopes they carry. Tokens restricted to secrets or groups only reach those,
+-- NULL reaches every one the user does. Tokens without expiry live until
+-- revoked.
+CREATE TABLE IF NOT EXISTS access_tokens (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name text NOT NULL CHECK (name <> ''),
+    hash bytea UNIQUE NOT NULL,
+    scopes text[] NOT NULL CHECK (cardinality(scopes) > 0),
+    secret_ids bigint[],
+    group_ids bigint[],
+    expires_at timestamp with time zone,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    last_used_at timestamp(0) with time zone
+);
+
+CREATE INDEX IF NOT EXISTS access_tokens_user_id_idx ON access_tokens (user_id);
+
+COMMIT;
@@ -0,0 +1,7 @@
+BEGIN;
+
+DELETE FROM users WHERE owner_group_id IS NOT NULL;
+DROP INDEX IF EXISTS users_owner_group_id_idx;
+ALTER TABLE users DROP COLUMN IF EXISTS owner_group_id;
+
+COMMIT;
@@ -0,0 +1,12 @@
+BEGIN;
+
+-- Service accounts are users owned by a group, for machines rather than
+-- people. They have no password and authenticate with access tokens only.
+-- Their email is an identifier in the reserved .invalid domain, to share
+-- secrets and add them to groups with, and is never mailed. Deleting the group
+-- deletes its service accounts.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS owner_group_id bigint REFERENCES groups(id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS users_owner_group_id_idx ON users (owner_group_id);
+
+COMMIT;
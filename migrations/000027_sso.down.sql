@@ -0,0 +1,7 @@
+BEGIN;
+
+ALTER TABLE group_members DROP COLUMN IF EXISTS sso_managed;
+DROP TABLE IF EXISTS sso_identities;
+DROP TABLE IF EXISTS sso_states;
+
+COMMIT;
@@ -0,0 +1,30 @@
+BEGIN;
+
+-- Sign-ins started with the OpenID Connect provider, each finished once. The
+-- state is stored hashed, along with the nonce the ID token must carry and
+-- the PKCE code verifier the code is exchanged with.
+CREATE TABLE IF NOT EXISTS sso_states (
+    hash bytea PRIMARY KEY,
+    nonce text NOT NULL,
+    code_verifier text NOT NULL,
+    expiry timestamp with time zone NOT NULL
+);
+
+-- Identities at the provider users signed in with, provisioned on their first
+-- sign-in or linked to the account with the same verified email
+CREATE TABLE IF NOT EXISTS sso_identities (
+    issuer text NOT NULL,
+    subject text NOT NULL,
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (issuer, subject)
+);
+
+CREATE INDEX IF NOT EXISTS sso_identities_user_id_idx ON sso_identities (user_id);
+
+-- Memberships granted by the groups claim of the provider, revoked at the next
+-- sign-in once the claim no longer lists the group. Memberships added by hand
+-- are left alone.
+ALTER TABLE group_members ADD COLUMN IF NOT EXISTS sso_managed boolean NOT NULL DEFAULT false;
+
+COMMIT;
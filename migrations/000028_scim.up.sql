@@ -0,0 +1,7 @@
+BEGIN;
+
+-- Users deprovisioned by the identity provider over SCIM. They keep their
+-- account and secrets but can't log in or use any token until reactivated.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deactivated_at timestamp(0) with time zone;
+
+COMMIT;
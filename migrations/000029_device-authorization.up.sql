@@ -0,0 +1,22 @@
+BEGIN;
+
+-- Logins of devices without a browser, like terminals, approved by a user
+-- logged in elsewhere (RFC 8628). Both codes are stored hashed, the device
+-- polls with the device code until the user approves or denies the user code.
+-- The client is the device's, shown to the user before approving and recorded
+-- on the session it gets.
+CREATE TABLE IF NOT EXISTS device_authorizations (
+    device_hash bytea PRIMARY KEY,
+    user_hash bytea UNIQUE NOT NULL,
+    user_id bigint REFERENCES users(id) ON DELETE CASCADE,
+    denied boolean NOT NULL DEFAULT false,
+    device text,
+    user_agent text,
+    ip text,
+    poll_interval integer NOT NULL,
+    polled_at timestamp with time zone,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    expiry timestamp with time zone NOT NULL
+);
+
+COMMIT;
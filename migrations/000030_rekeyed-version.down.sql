@@ -0,0 +1,6 @@
+BEGIN;
+
+-- Drop the version of the last re-key
+ALTER TABLE secrets DROP COLUMN IF EXISTS rekeyed_version;
+
+COMMIT;
@@ -0,0 +1,8 @@
+BEGIN;
+
+-- Version of a secret written by its last re-key. Older versions are
+-- encrypted with a content key the current recipients don't hold, and that
+-- the removed ones may still have, so they can't be restored.
+ALTER TABLE secrets ADD COLUMN IF NOT EXISTS rekeyed_version integer;
+
+COMMIT;
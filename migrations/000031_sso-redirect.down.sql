@@ -0,0 +1,6 @@
+BEGIN;
+
+-- Drop the redirect of sign-ins
+ALTER TABLE sso_states DROP COLUMN IF EXISTS redirect_url;
+
+COMMIT;
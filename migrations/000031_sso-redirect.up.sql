@@ -0,0 +1,7 @@
+BEGIN;
+
+-- Where the provider sends the user back to, the client's callback or the
+-- page approving a device. The code must be exchanged with the same URL.
+ALTER TABLE sso_states ADD COLUMN IF NOT EXISTS redirect_url text NOT NULL DEFAULT '';
+
+COMMIT;
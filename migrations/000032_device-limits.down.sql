@@ -0,0 +1,6 @@
+BEGIN;
+
+-- Drop the index of IP addresses
+DROP INDEX IF EXISTS device_authorizations_ip_idx;
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+
+-- Devices waiting for approval are counted by IP address when a login starts
+CREATE INDEX IF NOT EXISTS device_authorizations_ip_idx ON device_authorizations (ip);
+
+COMMIT;
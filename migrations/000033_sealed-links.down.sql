@@ -0,0 +1,8 @@
+BEGIN;
+
+-- Drop the data keys of links
+DROP INDEX IF EXISTS secret_links_master_key_id_idx;
+ALTER TABLE secret_links DROP COLUMN IF EXISTS master_key_id;
+ALTER TABLE secret_links DROP COLUMN IF EXISTS data_key;
+
+COMMIT;
@@ -0,0 +1,12 @@
+BEGIN;
+
+-- Data key the payload of each link is encrypted with at rest, like secrets.
+-- NULL for links stored before, which are left as given by the client until
+-- the master key is rotated.
+ALTER TABLE secret_links ADD COLUMN IF NOT EXISTS data_key bytea;
+ALTER TABLE secret_links ADD COLUMN IF NOT EXISTS master_key_id text;
+
+-- Rotation looks for rows wrapped by other master keys
+CREATE INDEX IF NOT EXISTS secret_links_master_key_id_idx ON secret_links (master_key_id);
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+
+-- Drop the fingerprints of sealed shares
+ALTER TABLE recovery_shareholders DROP COLUMN IF EXISTS key_fingerprint;
+
+COMMIT;
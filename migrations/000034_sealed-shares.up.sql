@@ -0,0 +1,7 @@
+BEGIN;
+
+-- Fingerprint of the public key of the admin each pending share is sealed to.
+-- NULL for shares stored before, which are handed as they were split.
+ALTER TABLE recovery_shareholders ADD COLUMN IF NOT EXISTS key_fingerprint text;
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+
+-- Drop the verification of emails
+ALTER TABLE users DROP COLUMN IF EXISTS email_verified;
+
+COMMIT;
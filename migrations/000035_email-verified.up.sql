@@ -0,0 +1,12 @@
+BEGIN;
+
+-- Set once the user proved they own their email, with the activation email or
+-- a password reset, or when the identity provider vouches for it. Single
+-- sign-on only links accounts with a verified email.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified boolean NOT NULL DEFAULT false;
+
+-- Users who signed in with the identity provider or were provisioned by it
+UPDATE users SET email_verified = true
+WHERE id IN (SELECT user_id FROM sso_identities) OR (password = '' AND owner_group_id IS NULL);
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+
+-- Drop the binding of groups to the identity provider
+ALTER TABLE groups DROP COLUMN IF EXISTS idp_managed;
+
+COMMIT;
@@ -0,0 +1,11 @@
+BEGIN;
+
+-- Groups bound to the identity provider. Only their members follow the
+-- groups claim at sign-in, other groups with a listed name are left alone.
+ALTER TABLE groups ADD COLUMN IF NOT EXISTS idp_managed boolean NOT NULL DEFAULT false;
+
+-- Groups the claim already granted memberships of stay bound
+UPDATE groups SET idp_managed = true
+WHERE id IN (SELECT group_id FROM group_members WHERE sso_managed);
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+
+-- Drop the binding of users to the identity provider
+ALTER TABLE users DROP COLUMN IF EXISTS idp_managed;
+
+COMMIT;
@@ -0,0 +1,13 @@
+BEGIN;
+
+-- Users provisioned by the identity provider. SCIM only reads and changes
+-- them and the users linked to the provider with single sign-on, accounts
+-- made by hand are out of its reach.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS idp_managed boolean NOT NULL DEFAULT false;
+
+-- Users without a password were provisioned by the provider or created at
+-- their first sign-in with it
+UPDATE users SET idp_managed = true
+WHERE password = '' AND owner_group_id IS NULL;
+
+COMMIT;